@@ -0,0 +1,208 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrCompressedArchive is returned when appending to a compressed archive, which can only be
+// appended to by decompressing and compressing the whole archive again.
+var ErrCompressedArchive = errors.New("compressed archives cannot be appended to in place")
+
+// blockSize is the size of tar blocks. Archives end with two zero blocks.
+const blockSize = 512
+
+// AppendableArchive is an uncompressed archive that files can be appended to in place, without
+// rewriting the existing contents of the archive.
+type AppendableArchive struct {
+	path  string
+	names map[string]struct{}
+	// end is the offset of the end-of-archive marker, which is overwritten by appended entries.
+	end int64
+}
+
+// OpenAppendable reads the entries of the uncompressed archive, extracting the files with the
+// specified names to destDir, e.g. to read metadata that is updated along with appended files. If
+// the archive contains a file multiple times, the last entry is extracted, matching extraction of
+// the whole archive.
+func OpenAppendable(archiveFile, destDir string, extractNames ...string) (*AppendableArchive, error) {
+	index, err := ReadSplitIndex(archiveFile)
+	if err != nil {
+		return nil, err
+	}
+	if index != nil {
+		return nil, fmt.Errorf("%s is split into %d parts: %w", archiveFile, len(index.Parts), ErrSplitArchive)
+	}
+
+	f, err := os.Open(archiveFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	r, compression, err := decompressingReader(f)
+	if err != nil {
+		return nil, err
+	}
+	_ = r.Close()
+	if compression != None {
+		return nil, fmt.Errorf("%s is %s compressed: %w", archiveFile, compression, ErrCompressedArchive)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	toExtract := make(map[string]struct{}, len(extractNames))
+	for _, n := range extractNames {
+		toExtract[n] = struct{}{}
+	}
+
+	a := &AppendableArchive{path: archiveFile, names: map[string]struct{}{}}
+	// The tar reader seeks past the contents of entries that are not read, so reading the entries
+	// of large archives is fast, and the offset of the reader is always at the end of the header
+	// of the entry that was just read.
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		a.end = offset + (hdr.Size+blockSize-1)/blockSize*blockSize
+
+		name := strings.TrimSuffix(hdr.Name, "/")
+		a.names[name] = struct{}{}
+
+		if _, ok := toExtract[name]; ok && hdr.Typeflag == tar.TypeReg {
+			if err := extractFile(tr, filepath.Join(destDir, filepath.FromSlash(name)), 0o644); err != nil {
+				return nil, fmt.Errorf("failed to extract %q: %w", name, err)
+			}
+		}
+	}
+
+	return a, nil
+}
+
+// Contains returns true if the archive contains an entry with the name.
+func (a *AppendableArchive) Contains(name string) bool {
+	_, ok := a.names[strings.TrimSuffix(name, "/")]
+	return ok
+}
+
+// AppendDirectory appends the contents of dir to the archive in place. Entries that the archive
+// already contains are skipped unless replace returns true for their name, in which case they are
+// appended again, superseding the existing entries when the archive is extracted. If appending
+// fails, the archive is truncated to its original contents.
+func (a *AppendableArchive) AppendDirectory(dir string, replace func(name string) bool) (err error) {
+	f, err := os.OpenFile(a.path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		// Restore the end-of-archive marker after the original entries.
+		if truncErr := f.Truncate(a.end); truncErr != nil {
+			err = errors.Join(err, truncErr)
+			return
+		}
+		if _, writeErr := f.WriteAt(make([]byte, 2*blockSize), a.end); writeErr != nil {
+			err = errors.Join(err, writeErr)
+		}
+	}()
+
+	if _, err := f.Seek(a.end, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to append to archive: %w", err)
+	}
+	bw := bufio.NewWriterSize(f, 1<<20)
+	tw := tar.NewWriter(bw)
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if a.Contains(name) && (replace == nil || !replace(name)) {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write header for %q: %w", rel, err)
+		}
+		if fi.Mode().IsRegular() {
+			if err := writeFile(context.Background(), tw, path); err != nil {
+				return fmt.Errorf("failed to write %q: %w", rel, err)
+			}
+		}
+		a.names[name] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to append to archive: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to append to archive: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to append to archive: %w", err)
+	}
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to append to archive: %w", err)
+	}
+	// Remove anything after the end-of-archive marker, e.g. padding written by other tools.
+	if err := f.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to append to archive: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to append to archive: %w", err)
+	}
+	a.end = offset - 2*blockSize
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package archive_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/archive"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+}
+
+func TestAppendDirectory(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	writeFiles(t, srcDir, map[string]string{
+		"meta.yaml":          "v1",
+		"blobs/a/data":       "a",
+		"blobs/b/data":       "b",
+		"repositories/x/tag": "x",
+	})
+	archiveFile := filepath.Join(tmpDir, "bundle.tar")
+	require.NoError(t, archive.ArchiveDirectory(srcDir, archiveFile))
+
+	metaDir := filepath.Join(tmpDir, "meta")
+	a, err := archive.OpenAppendable(archiveFile, metaDir, "meta.yaml")
+	require.NoError(t, err)
+	assert.True(t, a.Contains("blobs/a/data"))
+	assert.True(t, a.Contains("blobs/a/"))
+	assert.False(t, a.Contains("blobs/c/data"))
+	meta, err := os.ReadFile(filepath.Join(metaDir, "meta.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(meta))
+
+	deltaDir := filepath.Join(tmpDir, "delta")
+	writeFiles(t, deltaDir, map[string]string{
+		"meta.yaml":          "v2",
+		"blobs/a/data":       "changed but skipped",
+		"blobs/c/data":       "c",
+		"repositories/y/tag": "y",
+	})
+	require.NoError(t, a.AppendDirectory(deltaDir, func(name string) bool {
+		return name == "meta.yaml"
+	}))
+
+	destDir := filepath.Join(tmpDir, "dest")
+	require.NoError(t, archive.UnarchiveToDirectory(archiveFile, destDir))
+	contents, err := walkDirContentsToMap(destDir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"meta.yaml":          "v2",
+		"blobs/a/data":       "a",
+		"blobs/b/data":       "b",
+		"blobs/c/data":       "c",
+		"repositories/x/tag": "x",
+		"repositories/y/tag": "y",
+	}, contents)
+
+	// Appending again finds the entries appended previously.
+	a, err = archive.OpenAppendable(archiveFile, metaDir, "meta.yaml")
+	require.NoError(t, err)
+	assert.True(t, a.Contains("blobs/c/data"))
+	meta, err = os.ReadFile(filepath.Join(metaDir, "meta.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(meta))
+}
+
+func TestOpenAppendableCompressedArchive(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	writeFiles(t, srcDir, map[string]string{"meta.yaml": "v1"})
+	archiveFile := filepath.Join(tmpDir, "bundle.tar.gz")
+	require.NoError(t, archive.ArchiveDirectory(srcDir, archiveFile))
+
+	_, err := archive.OpenAppendable(archiveFile, filepath.Join(tmpDir, "meta"))
+	require.ErrorIs(t, err, archive.ErrCompressedArchive)
+}
+
+func TestOpenAppendableSplit(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	writeFiles(t, srcDir, map[string]string{"meta.yaml": "v1"})
+	archiveFile := filepath.Join(tmpDir, "bundle.tar")
+	require.NoError(t, archive.ArchiveDirectoryWithOptions(srcDir, archiveFile, archive.Options{SplitSize: 1024}))
+
+	_, err := archive.OpenAppendable(archiveFile, filepath.Join(tmpDir, "meta"))
+	require.ErrorIs(t, err, archive.ErrSplitArchive)
+}
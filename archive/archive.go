@@ -4,29 +4,190 @@
 package archive
 
 import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
-
-	"github.com/mholt/archiver/v3"
 )
 
+// Options configures how directories are archived.
+type Options struct {
+	// Compression to compress the archive with.
+	Compression Compression
+	// CompressionLevel is the compression level, 0 selects the default level of the compression.
+	CompressionLevel int
+	// RemoveArchivedFiles removes every file from the archived directory as soon as it has been
+	// written to the archive, so that archiving needs little more free disk space than the size of
+	// the (compressed) archive itself, rather than twice the size of the directory.
+	RemoveArchivedFiles bool
+	// Exclude excludes files from the archive by their slash-separated path relative to the
+	// archived directory if set. Excluded files are never removed.
+	Exclude func(name string) bool
+	// SplitSize splits the (compressed) archive into parts of at most this many bytes if set,
+	// written next to the output file, with an index of the parts written to the output file
+	// itself. Split archives are read transparently by UnarchiveToDirectory.
+	SplitSize int64
+	// Context stops archiving with its error once it is done, e.g. cancelled on interrupt, leaving
+	// no partially written archive behind. Archiving cannot be stopped if nil.
+	Context context.Context
+}
+
+// ArchiveDirectory archives the directory to the output file, compressed as implied by the output
+// file extension, e.g. gzip for `.tar.gz`.
 func ArchiveDirectory(dir, outputFile string) error {
-	fi, err := os.ReadDir(dir)
-	if err != nil {
+	return ArchiveDirectoryWithOptions(dir, outputFile, Options{
+		Compression: CompressionForFile(outputFile),
+	})
+}
+
+// ArchiveDirectoryWithOptions archives the directory to the output file. The archive is streamed
+// to a temporary file, or temporary parts if split, next to the output file as the directory is
+// walked, and only renamed to the output file once it has been completely written.
+func ArchiveDirectoryWithOptions(dir, outputFile string, opts Options) error {
+	if _, err := os.ReadDir(dir); err != nil {
 		return fmt.Errorf("failed to read directory: %w", err)
 	}
-	filesToArchive := make([]string, 0, len(fi))
-	for _, f := range fi {
-		filesToArchive = append(filesToArchive, filepath.Join(dir, f.Name()))
+
+	var (
+		w      io.Writer
+		commit func() error
+	)
+	if opts.SplitSize > 0 {
+		sw := newSplitWriter(outputFile, opts.SplitSize)
+		defer sw.cleanup()
+		w, commit = sw, sw.commit
+	} else {
+		tempArchive := filepath.Join(filepath.Dir(outputFile), "."+filepath.Base(outputFile))
+		defer os.Remove(tempArchive)
+		f, err := os.Create(tempArchive)
+		if err != nil {
+			return fmt.Errorf("failed to create archive: %w", err)
+		}
+		defer f.Close()
+		w = f
+		commit = func() error {
+			if err := f.Close(); err != nil {
+				return fmt.Errorf("failed to create archive: %w", err)
+			}
+			if err := os.Rename(tempArchive, outputFile); err != nil {
+				return fmt.Errorf("failed to rename temporary archive to output file: %w", err)
+			}
+			return nil
+		}
 	}
-	tempTarArchive := filepath.Join(filepath.Dir(outputFile), "."+filepath.Base(outputFile))
-	defer os.Remove(tempTarArchive)
-	if err = archiver.Archive(filesToArchive, tempTarArchive); err != nil {
+
+	bw := bufio.NewWriterSize(w, 1<<20)
+	cw, err := compressingWriter(bw, opts.Compression, opts.CompressionLevel)
+	if err != nil {
 		return fmt.Errorf("failed to create archive: %w", err)
 	}
-	if err := os.Rename(tempTarArchive, outputFile); err != nil {
-		return fmt.Errorf("failed to rename temporary archive to output file: %w", err)
+	tw := tar.NewWriter(cw)
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := writeDirectory(ctx, tw, dir, opts); err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	if err := cw.Close(); err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	return commit()
+}
+
+func writeDirectory(ctx context.Context, tw *tar.Writer, dir string, opts Options) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if opts.Exclude != nil && opts.Exclude(filepath.ToSlash(rel)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write header for %q: %w", rel, err)
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		if err := writeFile(ctx, tw, path); err != nil {
+			return fmt.Errorf("failed to write %q: %w", rel, err)
+		}
+		if opts.RemoveArchivedFiles {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to remove archived file %q: %w", rel, err)
+			}
+		}
+		return nil
+	})
+}
+
+func writeFile(ctx context.Context, w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, contextReader{ctx: ctx, r: f})
+	return err
+}
+
+// contextReader stops reading with the error of the context once it is done, so that archiving
+// large files can be stopped.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
 	}
-	return nil
+	return r.r.Read(p)
 }
@@ -7,6 +7,7 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"io"
 	"os"
 	"path/filepath"
@@ -140,3 +141,127 @@ func TestArchiveDirectoryUnreadableSource(t *testing.T) {
 		"expected error archiving directory",
 	)
 }
+
+func TestArchiveDirectoryWithOptionsCompressions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		compression archive.Compression
+		level       int
+	}{
+		{name: "none", compression: archive.None},
+		{name: "gzip", compression: archive.Gzip},
+		{name: "gzip with level", compression: archive.Gzip, level: 9},
+		{name: "zstd", compression: archive.Zstd},
+		{name: "zstd with level", compression: archive.Zstd, level: 19},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			testDataDir := filepath.Join("testdata", "archivetest")
+			testDataContents, err := walkDirContentsToMap(testDataDir)
+			require.NoError(t, err, "error walking test data directory")
+
+			// The compression is detected from the content when unarchiving, not the file extension.
+			outputFile := filepath.Join(t.TempDir(), "out.tar")
+			require.NoError(t, archive.ArchiveDirectoryWithOptions(testDataDir, outputFile, archive.Options{
+				Compression:      tt.compression,
+				CompressionLevel: tt.level,
+			}), "error archiving directory")
+
+			untarTmpDir := t.TempDir()
+			require.NoError(t, archive.UnarchiveToDirectory(outputFile, untarTmpDir))
+			unarchivedContents, err := walkDirContentsToMap(untarTmpDir)
+			require.NoError(t, err, "error walking unarchived data directory")
+			require.Equal(t, testDataContents, unarchivedContents, "incorrect unarchived contents")
+		})
+	}
+}
+
+func TestArchiveDirectoryWithOptionsInvalidCompressionLevel(t *testing.T) {
+	t.Parallel()
+	outputFile := filepath.Join(t.TempDir(), "out.tar")
+	require.ErrorContains(
+		t,
+		archive.ArchiveDirectoryWithOptions("testdata", outputFile, archive.Options{
+			Compression:      archive.Gzip,
+			CompressionLevel: 10,
+		}),
+		"invalid compression level 10",
+	)
+	require.NoFileExists(t, outputFile)
+}
+
+func TestArchiveDirectoryWithOptionsCancelled(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	outputDir := t.TempDir()
+	outputFile := filepath.Join(outputDir, "out.tar")
+	require.ErrorIs(
+		t,
+		archive.ArchiveDirectoryWithOptions("testdata", outputFile, archive.Options{Context: ctx}),
+		context.Canceled,
+	)
+	entries, err := os.ReadDir(outputDir)
+	require.NoError(t, err)
+	require.Empty(t, entries, "no partial archive should be left behind")
+}
+
+func TestArchiveDirectoryWithOptionsRemoveArchivedFiles(t *testing.T) {
+	t.Parallel()
+	testDataDir := filepath.Join("testdata", "archivetest")
+	testDataContents, err := walkDirContentsToMap(testDataDir)
+	require.NoError(t, err, "error walking test data directory")
+
+	srcDir := t.TempDir()
+	for name, contents := range testDataContents {
+		require.NoError(t, os.MkdirAll(filepath.Join(srcDir, filepath.Dir(name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), []byte(contents), 0o644))
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "out.tar.zst")
+	require.NoError(t, archive.ArchiveDirectoryWithOptions(srcDir, outputFile, archive.Options{
+		Compression:         archive.Zstd,
+		RemoveArchivedFiles: true,
+	}), "error archiving directory")
+
+	remainingContents, err := walkDirContentsToMap(srcDir)
+	require.NoError(t, err, "error walking source directory")
+	require.Empty(t, remainingContents, "archived files should have been removed")
+
+	untarTmpDir := t.TempDir()
+	require.NoError(t, archive.UnarchiveToDirectory(outputFile, untarTmpDir))
+	unarchivedContents, err := walkDirContentsToMap(untarTmpDir)
+	require.NoError(t, err, "error walking unarchived data directory")
+	require.Equal(t, testDataContents, unarchivedContents, "incorrect unarchived contents")
+}
+
+func TestArchiveDirectoryWithOptionsExclude(t *testing.T) {
+	t.Parallel()
+
+	srcDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "included.txt"), []byte("included"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, ".state.json"), []byte("{}"), 0o644))
+
+	outputFile := filepath.Join(t.TempDir(), "out.tar")
+	require.NoError(t, archive.ArchiveDirectoryWithOptions(srcDir, outputFile, archive.Options{
+		RemoveArchivedFiles: true,
+		Exclude:             func(name string) bool { return name == ".state.json" },
+	}), "error archiving directory")
+
+	remainingContents, err := walkDirContentsToMap(srcDir)
+	require.NoError(t, err, "error walking source directory")
+	require.Equal(t, map[string]string{".state.json": "{}"}, remainingContents,
+		"excluded files should not have been removed")
+
+	untarTmpDir := t.TempDir()
+	require.NoError(t, archive.UnarchiveToDirectory(outputFile, untarTmpDir))
+	unarchivedContents, err := walkDirContentsToMap(untarTmpDir)
+	require.NoError(t, err, "error walking unarchived data directory")
+	require.Equal(t, map[string]string{"included.txt": "included"}, unarchivedContents,
+		"excluded files should not have been archived")
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/thediveo/enumflag/v2"
+)
+
+type Compression enumflag.Flag
+
+const (
+	None Compression = iota
+	Gzip
+	Zstd
+)
+
+var compressionNames = map[Compression]string{
+	None: "none",
+	Gzip: "gzip",
+	Zstd: "zstd",
+}
+
+func (c Compression) String() string {
+	return compressionNames[c]
+}
+
+// Extension returns the file extension conventionally appended to tar archives with the
+// compression, e.g. `.gz` for gzip.
+func (c Compression) Extension() string {
+	switch c {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// CompressionForFile returns the compression implied by the archive file extension, e.g. gzip for
+// `.tar.gz`, defaulting to no compression.
+func CompressionForFile(archiveFile string) Compression {
+	switch {
+	case strings.HasSuffix(archiveFile, ".gz"), strings.HasSuffix(archiveFile, ".tgz"):
+		return Gzip
+	case strings.HasSuffix(archiveFile, ".zst"):
+		return Zstd
+	default:
+		return None
+	}
+}
+
+// ValidateCompressionLevel returns an error if the level is not supported by the compression. A
+// level of 0 always selects the default level of the compression.
+func ValidateCompressionLevel(c Compression, level int) error {
+	if level == 0 {
+		return nil
+	}
+
+	var minLevel, maxLevel int
+	switch c {
+	case Gzip:
+		minLevel, maxLevel = pgzip.BestSpeed, pgzip.BestCompression
+	case Zstd:
+		minLevel, maxLevel = 1, 22
+	default:
+		return fmt.Errorf("compression level is not supported with compression %q", c)
+	}
+	if level < minLevel || level > maxLevel {
+		return fmt.Errorf(
+			"invalid compression level %d for compression %q: must be between %d and %d",
+			level, c, minLevel, maxLevel,
+		)
+	}
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func compressingWriter(w io.Writer, c Compression, level int) (io.WriteCloser, error) {
+	if err := ValidateCompressionLevel(c, level); err != nil {
+		return nil, err
+	}
+
+	switch c {
+	case Gzip:
+		if level == 0 {
+			level = pgzip.DefaultCompression
+		}
+		return pgzip.NewWriterLevel(w, level)
+	case Zstd:
+		opts := []zstd.EOption{}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompressingReader detects the compression of the archive from its content, regardless of its
+// file extension, and returns a reader of the uncompressed archive.
+func decompressingReader(r io.Reader) (io.ReadCloser, Compression, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, None, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzr, err := pgzip.NewReader(br)
+		if err != nil {
+			return nil, Gzip, fmt.Errorf("failed to read gzip compressed archive: %w", err)
+		}
+		return gzr, Gzip, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, Zstd, fmt.Errorf("failed to read zstd compressed archive: %w", err)
+		}
+		return zr.IOReadCloser(), Zstd, nil
+	default:
+		return io.NopCloser(br), None, nil
+	}
+}
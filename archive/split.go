@@ -0,0 +1,318 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrSplitArchive is returned when appending to an archive that is split into parts.
+var ErrSplitArchive = errors.New("archives split into parts cannot be appended to in place")
+
+const (
+	splitIndexKind    = "SplitArchive"
+	splitIndexVersion = "v1"
+	// maxSplitIndexSize bounds the size of files that are read to detect split archive indexes, so
+	// that archives are never read into memory. Indexes of thousands of parts are far smaller.
+	maxSplitIndexSize = 1 << 20
+)
+
+// splitIndexPrefix is the start of every split archive index, which never starts a tar archive or
+// a compressed archive.
+var splitIndexPrefix = []byte("kind: " + splitIndexKind + "\n")
+
+// SplitIndex is the index of an archive that is split into parts of a fixed size, which is written
+// to the archive file itself. The parts are written next to the index and are concatenated in order
+// to read the archive.
+type SplitIndex struct {
+	Kind    string `yaml:"kind"`
+	Version string `yaml:"version"`
+	// Size is the total size of all parts.
+	Size  int64       `yaml:"size"`
+	Parts []SplitPart `yaml:"parts"`
+}
+
+// SplitPart is a part of a split archive.
+type SplitPart struct {
+	// Name is the file name of the part, relative to the directory of the index.
+	Name   string `yaml:"name"`
+	Size   int64  `yaml:"size"`
+	Digest string `yaml:"digest"`
+}
+
+// SplitPartName returns the file name of the nth part, counting from 1, of the archive split into
+// parts, e.g. images.tar.part0001 for images.tar.
+func SplitPartName(archiveFile string, n int) string {
+	return fmt.Sprintf("%s.part%04d", archiveFile, n)
+}
+
+// ReadSplitIndex reads the index of the archive if it is split into parts, returning nil if the
+// archive is a plain archive.
+func ReadSplitIndex(archiveFile string) (*SplitIndex, error) {
+	f, err := os.Open(archiveFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(io.LimitReader(f, maxSplitIndexSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	if len(b) > maxSplitIndexSize || !bytes.HasPrefix(b, splitIndexPrefix) {
+		return nil, nil
+	}
+
+	var index SplitIndex
+	if err := yaml.Unmarshal(b, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse split archive index %s: %w", archiveFile, err)
+	}
+	if index.Version != splitIndexVersion {
+		return nil, fmt.Errorf(
+			"unsupported split archive index version %q, upgrade mindthegap to use this archive",
+			index.Version,
+		)
+	}
+	// Parts must be files next to the index other than the index itself, so that indexes of remote
+	// archives cannot make parts be downloaded to or read from anywhere else.
+	for _, part := range index.Parts {
+		if part.Name == "" || part.Name == "." || part.Name == ".." ||
+			filepath.Base(part.Name) != part.Name || part.Name == filepath.Base(archiveFile) {
+			return nil, fmt.Errorf("illegal part name %q in split archive index %s", part.Name, archiveFile)
+		}
+	}
+	return &index, nil
+}
+
+// Size returns the size of the archive, which is the total size of all parts of archives split into
+// parts.
+func Size(archiveFile string) (int64, error) {
+	index, err := ReadSplitIndex(archiveFile)
+	if err != nil {
+		return 0, err
+	}
+	if index != nil {
+		return index.Size, nil
+	}
+	fi, err := os.Stat(archiveFile)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// openArchive opens the archive for reading, concatenating the parts of archives split into parts.
+func openArchive(archiveFile string) (io.ReadCloser, error) {
+	index, err := ReadSplitIndex(archiveFile)
+	if err != nil {
+		return nil, err
+	}
+	if index != nil {
+		return &splitReader{dir: filepath.Dir(archiveFile), parts: index.Parts}, nil
+	}
+	return os.Open(archiveFile)
+}
+
+// splitReader reads the parts of a split archive in order, opening every part only once the
+// previous part has been read, and verifying the size and digest of every part once it has been
+// read completely.
+type splitReader struct {
+	dir   string
+	parts []SplitPart
+
+	f    *os.File
+	hash hash.Hash
+	read int64
+}
+
+func (r *splitReader) Read(p []byte) (int, error) {
+	for {
+		if r.f == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			f, err := os.Open(filepath.Join(r.dir, r.parts[0].Name))
+			if err != nil {
+				return 0, fmt.Errorf("failed to open part of split archive: %w", err)
+			}
+			r.f, r.hash, r.read = f, sha256.New(), 0
+		}
+
+		n, err := r.f.Read(p)
+		r.hash.Write(p[:n])
+		r.read += int64(n)
+		if errors.Is(err, io.EOF) {
+			if err := r.closePart(); err != nil {
+				return n, err
+			}
+			err = nil
+			if n == 0 {
+				continue
+			}
+		}
+		return n, err
+	}
+}
+
+func (r *splitReader) closePart() error {
+	part := r.parts[0]
+	_ = r.f.Close()
+	r.f, r.parts = nil, r.parts[1:]
+
+	if r.read != part.Size {
+		return fmt.Errorf(
+			"part %s of split archive is %d bytes instead of %d bytes, it may be truncated",
+			part.Name, r.read, part.Size,
+		)
+	}
+	if digest := "sha256:" + hex.EncodeToString(r.hash.Sum(nil)); digest != part.Digest {
+		return fmt.Errorf(
+			"part %s of split archive is corrupt: digest is %s instead of %s", part.Name, digest, part.Digest,
+		)
+	}
+	return nil
+}
+
+func (r *splitReader) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	return r.f.Close()
+}
+
+// splitWriter writes an archive as parts of a fixed size to temporary files next to the output
+// file, which are only renamed to their final names, along with writing the index to the output
+// file, once the archive has been completely written.
+type splitWriter struct {
+	outputFile string
+	partSize   int64
+
+	parts     []SplitPart
+	tempFiles []string
+
+	f       *os.File
+	hash    hash.Hash
+	written int64
+}
+
+func newSplitWriter(outputFile string, partSize int64) *splitWriter {
+	return &splitWriter{outputFile: outputFile, partSize: partSize}
+}
+
+func (w *splitWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if w.f == nil || w.written == w.partSize {
+			if err := w.nextPart(); err != nil {
+				return written, err
+			}
+		}
+		chunk := p
+		if remaining := w.partSize - w.written; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		n, err := w.f.Write(chunk)
+		w.hash.Write(chunk[:n])
+		w.written += int64(n)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (w *splitWriter) nextPart() error {
+	if err := w.closePart(); err != nil {
+		return err
+	}
+	name := filepath.Base(SplitPartName(w.outputFile, len(w.parts)+1))
+	tempFile := filepath.Join(filepath.Dir(w.outputFile), "."+name)
+	f, err := os.Create(tempFile)
+	if err != nil {
+		return fmt.Errorf("failed to create part of split archive: %w", err)
+	}
+	w.tempFiles = append(w.tempFiles, tempFile)
+	w.parts = append(w.parts, SplitPart{Name: name})
+	w.f, w.hash, w.written = f, sha256.New(), 0
+	return nil
+}
+
+func (w *splitWriter) closePart() error {
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	if err != nil {
+		return fmt.Errorf("failed to write part of split archive: %w", err)
+	}
+	part := &w.parts[len(w.parts)-1]
+	part.Size, part.Digest = w.written, "sha256:"+hex.EncodeToString(w.hash.Sum(nil))
+	return nil
+}
+
+// commit renames all parts to their final names, removes parts of a previous archive with the same
+// name that are not part of this archive, and writes the index to the output file.
+func (w *splitWriter) commit() error {
+	if err := w.closePart(); err != nil {
+		return err
+	}
+
+	index := SplitIndex{Kind: splitIndexKind, Version: splitIndexVersion, Parts: w.parts}
+	for i, part := range w.parts {
+		index.Size += part.Size
+		if err := os.Rename(w.tempFiles[i], SplitPartName(w.outputFile, i+1)); err != nil {
+			return fmt.Errorf("failed to rename temporary part to %s: %w", part.Name, err)
+		}
+	}
+	for n := len(w.parts) + 1; ; n++ {
+		err := os.Remove(SplitPartName(w.outputFile, n))
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to remove stale part of split archive: %w", err)
+		}
+	}
+
+	var buf strings.Builder
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(index); err != nil {
+		return fmt.Errorf("failed to marshal split archive index: %w", err)
+	}
+	tempIndex := filepath.Join(filepath.Dir(w.outputFile), "."+filepath.Base(w.outputFile))
+	defer os.Remove(tempIndex)
+	if err := os.WriteFile(tempIndex, []byte(buf.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write split archive index: %w", err)
+	}
+	if err := os.Rename(tempIndex, w.outputFile); err != nil {
+		return fmt.Errorf("failed to rename temporary archive index to output file: %w", err)
+	}
+	return nil
+}
+
+// cleanup removes all parts that have not been committed.
+func (w *splitWriter) cleanup() {
+	if w.f != nil {
+		_ = w.f.Close()
+	}
+	for _, tempFile := range w.tempFiles {
+		_ = os.Remove(tempFile)
+	}
+}
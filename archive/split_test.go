@@ -0,0 +1,123 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package archive_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/archive"
+)
+
+func TestArchiveDirectoryWithOptionsSplit(t *testing.T) {
+	t.Parallel()
+	testDataDir := filepath.Join("testdata", "archivetest")
+	testDataContents, err := walkDirContentsToMap(testDataDir)
+	require.NoError(t, err, "error walking test data directory")
+
+	outputDir := t.TempDir()
+	outputFile := filepath.Join(outputDir, "out.tar")
+	// Stale parts of a previous archive with the same name are removed.
+	for n := 1; n <= 20; n++ {
+		require.NoError(t, os.WriteFile(archive.SplitPartName(outputFile, n), []byte("stale"), 0o644))
+	}
+	require.NoError(t, archive.ArchiveDirectoryWithOptions(testDataDir, outputFile, archive.Options{
+		SplitSize: 1024,
+	}), "error archiving directory")
+
+	index, err := archive.ReadSplitIndex(outputFile)
+	require.NoError(t, err)
+	require.NotNil(t, index, "output file should be a split archive index")
+	require.Greater(t, len(index.Parts), 1, "archive should be split into multiple parts")
+
+	var total int64
+	for i, part := range index.Parts {
+		require.Equal(t, filepath.Base(archive.SplitPartName(outputFile, i+1)), part.Name)
+		fi, err := os.Stat(filepath.Join(outputDir, part.Name))
+		require.NoError(t, err)
+		require.Equal(t, part.Size, fi.Size())
+		if i < len(index.Parts)-1 {
+			require.EqualValues(t, 1024, part.Size)
+		}
+		total += part.Size
+	}
+	require.Equal(t, total, index.Size)
+	size, err := archive.Size(outputFile)
+	require.NoError(t, err)
+	require.Equal(t, total, size)
+
+	entries, err := os.ReadDir(outputDir)
+	require.NoError(t, err)
+	require.Len(t, entries, len(index.Parts)+1, "only the index and the parts should be left")
+
+	untarTmpDir := t.TempDir()
+	require.NoError(t, archive.UnarchiveToDirectory(outputFile, untarTmpDir))
+	unarchivedContents, err := walkDirContentsToMap(untarTmpDir)
+	require.NoError(t, err, "error walking unarchived data directory")
+	require.Equal(t, testDataContents, unarchivedContents, "incorrect unarchived contents")
+}
+
+func TestUnarchiveToDirectorySplitCorrupt(t *testing.T) {
+	t.Parallel()
+	outputFile := filepath.Join(t.TempDir(), "out.tar")
+	require.NoError(t, archive.ArchiveDirectoryWithOptions(
+		filepath.Join("testdata", "archivetest"), outputFile, archive.Options{SplitSize: 512},
+	), "error archiving directory")
+
+	index, err := archive.ReadSplitIndex(outputFile)
+	require.NoError(t, err)
+	require.NotNil(t, index)
+
+	last := archive.SplitPartName(outputFile, len(index.Parts))
+	require.NoError(t, os.Rename(last, last+".missing"))
+	require.ErrorContains(
+		t,
+		archive.UnarchiveToDirectory(outputFile, t.TempDir()),
+		"failed to open part of split archive",
+	)
+	require.NoError(t, os.Rename(last+".missing", last))
+
+	// Corrupt the contents of a file rather than a tar header, so that the archive can still be
+	// read and only the digest of the part reveals the corruption.
+	corrupted := false
+	for n := 1; n <= len(index.Parts) && !corrupted; n++ {
+		part := archive.SplitPartName(outputFile, n)
+		b, err := os.ReadFile(part)
+		require.NoError(t, err)
+		if i := bytes.Index(b, []byte("xyz")); i >= 0 {
+			b[i] = 'X'
+			require.NoError(t, os.WriteFile(part, b, 0o644))
+			corrupted = true
+		}
+	}
+	require.True(t, corrupted, "test data should have been found in a part")
+	require.ErrorContains(
+		t,
+		archive.UnarchiveToDirectory(outputFile, t.TempDir()),
+		"of split archive is corrupt",
+	)
+}
+
+func TestReadSplitIndexIllegalPartNames(t *testing.T) {
+	t.Parallel()
+
+	for _, partName := range []string{"", ".", "..", "../images.tar.part0001", "/images.tar.part0001", "images.tar"} {
+		partName := partName
+		t.Run(partName, func(t *testing.T) {
+			t.Parallel()
+
+			indexFile := filepath.Join(t.TempDir(), "images.tar")
+			require.NoError(t, os.WriteFile(indexFile, []byte(
+				"kind: SplitArchive\nversion: v1\nsize: 1\nparts:\n- name: \""+partName+"\"\n  size: 1\n",
+			), 0o644))
+
+			_, err := archive.ReadSplitIndex(indexFile)
+			require.ErrorContains(t, err, "illegal part name")
+		})
+	}
+}
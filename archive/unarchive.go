@@ -4,32 +4,122 @@
 package archive
 
 import (
+	"archive/tar"
+	"errors"
 	"fmt"
-
-	"github.com/mholt/archiver/v3"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
+// UnarchiveToDirectory extracts the archive to the destination directory, overwriting existing
+// files. The compression of the archive is detected from its content, so all supported
+// compressions can be extracted regardless of the archive file extension. Archives split into
+// parts are extracted from their index, verifying the digest of every part.
 func UnarchiveToDirectory(archive, destDir string) error {
-	archiverByExtension, err := archiver.ByExtension(archive)
+	f, err := openArchive(archive)
 	if err != nil {
-		return fmt.Errorf("failed to identify archive format: %w", err)
+		return fmt.Errorf("failed to unarchive bundle: %w", err)
 	}
+	defer f.Close()
 
-	unarc, ok := archiverByExtension.(archiver.Unarchiver)
-	if !ok {
-		return fmt.Errorf("not an valid archive extension")
+	r, _, err := decompressingReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to unarchive bundle: %w", err)
 	}
+	defer r.Close()
 
-	switch t := unarc.(type) {
-	case *archiver.TarGz:
-		t.OverwriteExisting = true
-	case *archiver.Tar:
-		t.OverwriteExisting = true
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return fmt.Errorf("failed to unarchive bundle: %w", err)
 	}
 
-	if err := unarc.Unarchive(archive, destDir); err != nil {
+	if err := extract(tar.NewReader(r), destDir); err != nil {
+		return fmt.Errorf("failed to unarchive bundle: %w", err)
+	}
+	// Read the archive to its end, even past the end of the tar stream, so that the digests of all
+	// parts of split archives are verified.
+	if _, err := io.Copy(io.Discard, f); err != nil {
 		return fmt.Errorf("failed to unarchive bundle: %w", err)
 	}
 
 	return nil
 }
+
+func extract(tr *tar.Reader, destDir string) error {
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		path := filepath.Join(destDir, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(path, filepath.Clean(destDir)+string(os.PathSeparator)) {
+			return fmt.Errorf("illegal file path in archive: %q", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, hdr.FileInfo().Mode().Perm()|0o700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := extractFile(tr, path, hdr.FileInfo().Mode().Perm()); err != nil {
+				return fmt.Errorf("failed to extract %q: %w", hdr.Name, err)
+			}
+		case tar.TypeSymlink:
+			if !isDescendingLink(hdr.Linkname) {
+				return fmt.Errorf("illegal symlink target in archive: %q -> %q", hdr.Name, hdr.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, path); err != nil {
+				return fmt.Errorf("failed to extract %q: %w", hdr.Name, err)
+			}
+		default:
+			return fmt.Errorf("unsupported file type %q in archive for %q", hdr.Typeflag, hdr.Name)
+		}
+	}
+}
+
+func extractFile(r io.Reader, path string, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Remove existing files rather than truncating them, as they may not be writable.
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// isDescendingLink returns true if the symlink target is relative and does not contain any parent
+// directory references, so that following links extracted from an archive can never resolve to a
+// path outside of the destination directory.
+func isDescendingLink(target string) bool {
+	if target == "" || filepath.IsAbs(target) || strings.HasPrefix(filepath.ToSlash(target), "/") {
+		return false
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(target), "/") {
+		if elem == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package archive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/archive"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	content  string
+}
+
+func tarBytes(tb testing.TB, entries ...tarEntry) []byte {
+	tb.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		require.NoError(tb, tw.WriteHeader(&tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     0o644,
+			Size:     int64(len(e.content)),
+		}))
+		_, err := tw.Write([]byte(e.content))
+		require.NoError(tb, err)
+	}
+	require.NoError(tb, tw.Close())
+	return buf.Bytes()
+}
+
+func gzipBytes(tb testing.TB, b []byte) []byte {
+	tb.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(b)
+	require.NoError(tb, err)
+	require.NoError(tb, zw.Close())
+	return buf.Bytes()
+}
+
+func TestUnarchiveToDirectoryIllegalSymlinks(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		entries []tarEntry
+	}{{
+		name: "absolute symlink",
+		entries: []tarEntry{
+			{name: "etc", typeflag: tar.TypeSymlink, linkname: "/etc"},
+		},
+	}, {
+		name: "symlink to parent directory",
+		entries: []tarEntry{
+			{name: "a/up", typeflag: tar.TypeSymlink, linkname: "../.."},
+			{name: "a/up/evil", typeflag: tar.TypeReg, content: "evil"},
+		},
+	}, {
+		name: "symlink to parent directory via symlink to current directory",
+		entries: []tarEntry{
+			{name: "self", typeflag: tar.TypeSymlink, linkname: "."},
+			{name: "up", typeflag: tar.TypeSymlink, linkname: "self/.."},
+			{name: "up/evil", typeflag: tar.TypeReg, content: "evil"},
+		},
+	}}
+	for ti := range tests {
+		tt := tests[ti]
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			root := t.TempDir()
+			tarFile := filepath.Join(root, "evil.tar")
+			require.NoError(t, os.WriteFile(tarFile, tarBytes(t, tt.entries...), 0o600))
+
+			require.ErrorContains(
+				t,
+				archive.UnarchiveToDirectory(tarFile, filepath.Join(root, "dest")),
+				"illegal symlink target in archive",
+			)
+			require.NoFileExists(t, filepath.Join(root, "evil"))
+		})
+	}
+}
+
+func TestUnarchiveToDirectoryDescendingSymlink(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	tarFile := filepath.Join(root, "bundle.tar")
+	require.NoError(t, os.WriteFile(tarFile, tarBytes(t,
+		tarEntry{name: "a/b/file", typeflag: tar.TypeReg, content: "content"},
+		tarEntry{name: "link", typeflag: tar.TypeSymlink, linkname: "a/b"},
+	), 0o600))
+
+	dest := filepath.Join(root, "dest")
+	require.NoError(t, archive.UnarchiveToDirectory(tarFile, dest))
+	content, err := os.ReadFile(filepath.Join(dest, "link", "file"))
+	require.NoError(t, err)
+	require.Equal(t, "content", string(content))
+}
+
+// FuzzUnarchiveToDirectory checks that extracting arbitrary, potentially hostile, archives never
+// writes outside of the destination directory and never leaves symlinks that resolve outside of it.
+func FuzzUnarchiveToDirectory(f *testing.F) {
+	f.Add(tarBytes(f, tarEntry{name: "dir/file", typeflag: tar.TypeReg, content: "content"}))
+	f.Add(tarBytes(f, tarEntry{name: "../evil", typeflag: tar.TypeReg, content: "evil"}))
+	f.Add(tarBytes(f, tarEntry{name: "/abs/evil", typeflag: tar.TypeReg, content: "evil"}))
+	f.Add(tarBytes(f,
+		tarEntry{name: "link", typeflag: tar.TypeSymlink, linkname: "../outside"},
+		tarEntry{name: "link/evil", typeflag: tar.TypeReg, content: "evil"},
+	))
+	f.Add(tarBytes(f,
+		tarEntry{name: "self", typeflag: tar.TypeSymlink, linkname: "."},
+		tarEntry{name: "up", typeflag: tar.TypeSymlink, linkname: "self/.."},
+		tarEntry{name: "up/outside/evil", typeflag: tar.TypeReg, content: "evil"},
+	))
+	f.Add(tarBytes(f, tarEntry{name: "link", typeflag: tar.TypeLink, linkname: "/etc/passwd"}))
+	f.Add(gzipBytes(f, tarBytes(f, tarEntry{name: "gz/file", typeflag: tar.TypeReg, content: "gz"})))
+	f.Add([]byte("not an archive"))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		root := t.TempDir()
+		tarFile := filepath.Join(root, "bundle.tar")
+		if err := os.WriteFile(tarFile, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		outside := filepath.Join(root, "outside")
+		if err := os.Mkdir(outside, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		dest := filepath.Join(root, "dest")
+
+		// Errors are expected for malformed and hostile archives, only their effects are checked.
+		_ = archive.UnarchiveToDirectory(tarFile, dest)
+
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			switch e.Name() {
+			case "bundle.tar", "outside", "dest":
+			default:
+				t.Fatalf("file written outside of destination directory: %s", e.Name())
+			}
+		}
+		outsideEntries, err := os.ReadDir(outside)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outsideEntries) > 0 {
+			t.Fatalf("file written outside of destination directory: %s", outsideEntries[0].Name())
+		}
+
+		realDest, err := filepath.EvalSymlinks(dest)
+		if err != nil {
+			// The destination directory is always created, unless the archive could not be read at all.
+			return
+		}
+		_ = filepath.WalkDir(dest, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.Type()&fs.ModeSymlink == 0 {
+				return nil
+			}
+			resolved, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				// Dangling and looping symlinks cannot be followed at all.
+				return nil
+			}
+			if resolved != realDest && !strings.HasPrefix(resolved, realDest+string(os.PathSeparator)) {
+				t.Fatalf("symlink %s resolves outside of destination directory: %s", path, resolved)
+			}
+			return nil
+		})
+	})
+}
@@ -4,6 +4,7 @@
 package archive_test
 
 import (
+	"archive/tar"
 	"fmt"
 	"io/fs"
 	"os"
@@ -140,3 +141,27 @@ func TestUnarchiveDirectoryUnreadableSource(t *testing.T) {
 		"expected error unarchiving bundle",
 	)
 }
+
+func TestUnarchiveToDirectoryIllegalPath(t *testing.T) {
+	t.Parallel()
+	tarFile := filepath.Join(t.TempDir(), "evil.tar")
+	f, err := os.Create(tarFile)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name:     "../evil",
+		Typeflag: tar.TypeReg,
+		Mode:     0o644,
+		Size:     4,
+	}))
+	_, err = tw.Write([]byte("evil"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	require.ErrorContains(
+		t,
+		archive.UnarchiveToDirectory(tarFile, t.TempDir()),
+		"illegal file path in archive",
+	)
+}
@@ -4,12 +4,12 @@
 package cleanup
 
 import (
-	"context"
-	"os"
-	"os/signal"
 	"sync"
 )
 
+// Cleaner runs cleanup functions, e.g. removing temporary directories, when a command ends.
+// Commands stop when their context is cancelled on interrupt, so deferring Cleanup also cleans up
+// on interrupt.
 type Cleaner interface {
 	Cleanup()
 	AddCleanupFn(f func())
@@ -20,37 +20,24 @@ func NewCleaner() Cleaner {
 }
 
 type cleaner struct {
-	sigNotifier sync.Once
-	mu          sync.RWMutex
-	cleanups    []func()
-}
-
-func (c *cleaner) setupSignalHandling() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-	go func() {
-		<-ctx.Done()
-		stop()
-		c.Cleanup()
-		p, _ := os.FindProcess(os.Getpid())
-		if err := p.Signal(os.Interrupt); err != nil {
-			panic(err)
-		}
-	}()
+	mu       sync.Mutex
+	cleanups []func()
 }
 
+// Cleanup runs the cleanup functions in the order they were added. Every function is only run
+// once, even if Cleanup is called more than once.
 func (c *cleaner) Cleanup() {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	for _, f := range c.cleanups {
+	cleanups := c.cleanups
+	c.cleanups = nil
+	c.mu.Unlock()
+
+	for _, f := range cleanups {
 		f()
 	}
 }
 
 func (c *cleaner) AddCleanupFn(f func()) {
-	c.sigNotifier.Do(c.setupSignalHandling)
-
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.cleanups = append(c.cleanups, f)
@@ -0,0 +1,22 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package batch
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/batch/create"
+)
+
+func NewCommand(out output.Output) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "batch",
+		Short: "Run operations on multiple bundles at once",
+	}
+
+	cmd.AddCommand(create.NewCommand(out))
+	return cmd
+}
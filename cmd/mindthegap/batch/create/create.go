@@ -0,0 +1,236 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package create
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/cleanup"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/imagebundle"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/images/authnhelpers"
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/metrics"
+)
+
+// configFileExtensions are the extensions of files in the configs directory that bundles are
+// created from.
+var configFileExtensions = []string{".yaml", ".yml", ".txt"}
+
+func NewCommand(out output.Output) *cobra.Command {
+	var (
+		configsDir           string
+		outputDir            string
+		platforms            []platform.Platform
+		overwrite            bool
+		imagePullConcurrency int
+		blobCacheDir         string
+		reportFile           string
+		compression          archive.Compression
+		compressionLevel     int
+		splitSize            flags.SplitSize
+		perImageTimeout      time.Duration
+		stallTimeout         time.Duration
+		stallRetries         int
+		registryAuthFile     string
+		credentialOpts       authnhelpers.CredentialOptions
+		clockSkewTolerance   time.Duration
+		rateLimits           imagebundle.RateLimitOptions
+		annotations          flags.Annotations
+
+		includeNonDistributable bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an image bundle for every images config file in a directory",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := cmd.ValidateRequiredFlags(); err != nil {
+				return err
+			}
+
+			if err := flags.ValidateFlagsThatRequireValues(cmd, "configs-dir", "output-dir"); err != nil {
+				return err
+			}
+
+			return archive.ValidateCompressionLevel(compression, compressionLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configFiles, err := configFilesInDir(configsDir)
+			if err != nil {
+				return err
+			}
+			if len(configFiles) == 0 {
+				return fmt.Errorf("no images config files found in %s", configsDir)
+			}
+			bundleFiles, err := bundleFileNames(configFiles, compression)
+			if err != nil {
+				return err
+			}
+
+			if err := os.MkdirAll(outputDir, 0o755); err != nil {
+				return fmt.Errorf("failed to create output directory: %w", err)
+			}
+
+			cleaner := cleanup.NewCleaner()
+			defer cleaner.Cleanup()
+
+			if blobCacheDir == "" {
+				blobCacheDir, err = os.MkdirTemp(outputDir, ".blob-cache-*")
+				if err != nil {
+					return fmt.Errorf("failed to create temporary blob cache directory: %w", err)
+				}
+				cleaner.AddCleanupFn(func() { _ = os.RemoveAll(blobCacheDir) })
+			}
+
+			if reportFile == "" {
+				reportFile = filepath.Join(outputDir, "report.json")
+			}
+
+			metrics.FromContext(cmd.Context()).AddCount("bundles", len(configFiles))
+
+			report := &batchReport{}
+			for _, configFile := range configFiles {
+				// Stop creating further bundles once interrupted, still reporting the bundles created.
+				if cmd.Context().Err() != nil {
+					break
+				}
+				bundleFile := filepath.Join(outputDir, bundleFiles[configFile])
+				out.Infof("Creating image bundle %s from %s", bundleFile, configFile)
+
+				result, err := imagebundle.Create(cmd.Context(), out, imagebundle.Options{
+					ConfigFile:           configFile,
+					OutputFile:           bundleFile,
+					Overwrite:            overwrite,
+					Platforms:            platforms,
+					PlatformsRequested:   cmd.Flags().Changed("platform"),
+					ImagePullConcurrency: imagePullConcurrency,
+					OnError:              imagebundle.Continue,
+					BlobCacheDir:         blobCacheDir,
+					Compression:          compression,
+					CompressionLevel:     compressionLevel,
+					SplitSize:            splitSize.Bytes,
+					PerImageTimeout:      perImageTimeout,
+					StallTimeout:         stallTimeout,
+					StallRetries:         stallRetries,
+					RegistryAuthFile:     registryAuthFile,
+					Credentials:          credentialOpts,
+					ClockSkewTolerance:   clockSkewTolerance,
+					RateLimits:           rateLimits,
+					Annotations:          annotations,
+					Metrics:              metrics.FromContext(cmd.Context()),
+
+					IncludeNonDistributable: includeNonDistributable,
+				})
+				report.add(configFile, bundleFile, result, err)
+				if err != nil {
+					out.Errorf(err, "Failed to create image bundle %s", bundleFile)
+				}
+			}
+
+			if err := report.writeFile(reportFile); err != nil {
+				return err
+			}
+			if err := cmd.Context().Err(); err != nil {
+				return err
+			}
+
+			out.Info(report.summary())
+			if report.failed() {
+				return fmt.Errorf("not all image bundles were created successfully, see %s", reportFile)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&configsDir, "configs-dir", "",
+		"Directory containing images config files to create bundles from, one bundle per file")
+	_ = cmd.MarkFlagRequired("configs-dir")
+	cmd.Flags().StringVar(&outputDir, "output-dir", "",
+		"Directory to write image bundles to, named after their images config files")
+	_ = cmd.MarkFlagRequired("output-dir")
+	cmd.Flags().
+		Var(flags.NewPlatformsValue([]platform.Platform{platform.MustParse("linux/amd64")}, &platforms), "platform",
+			"platforms to download images (required format: <os>/<arch>[/<variant>][:<os.version>])")
+	cmd.Flags().
+		BoolVar(&overwrite, "overwrite", false, "Overwrite image bundle files if they already exist")
+	cmd.Flags().
+		IntVar(&imagePullConcurrency, "image-pull-concurrency", 1, "Image pull concurrency")
+	imagebundle.AddPullTimeoutFlags(cmd.Flags(), &perImageTimeout, &stallTimeout, &stallRetries)
+	imagebundle.AddRateLimitFlags(cmd.Flags(), &rateLimits)
+	flags.AddAnnotationFlag(cmd.Flags(), &annotations)
+	cmd.Flags().StringVar(&blobCacheDir, "blob-cache-dir", "",
+		"Directory to cache pulled image blobs in, shared by all bundles (defaults to a temporary directory "+
+			"removed once all bundles have been created)")
+	cmd.Flags().StringVar(&reportFile, "report-file", "",
+		"File to write a JSON report of all created bundles to (defaults to report.json in the output directory)")
+	flags.AddCompressionFlags(cmd.Flags(), &compression, &compressionLevel)
+	flags.AddSplitSizeFlag(cmd.Flags(), &splitSize)
+	flags.AddRegistryAuthFileFlag(cmd.Flags(), &registryAuthFile)
+	flags.AddRegistryCredentialFlags(cmd.Flags(), &credentialOpts)
+	flags.AddIncludeNonDistributableFlag(cmd.Flags(), &includeNonDistributable)
+	flags.AddClockSkewToleranceFlag(cmd.Flags(), &clockSkewTolerance)
+
+	return cmd
+}
+
+// configFilesInDir returns the images config files in dir, sorted by name.
+func configFilesInDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configs directory: %w", err)
+	}
+
+	configFiles := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		for _, ext := range configFileExtensions {
+			if filepath.Ext(e.Name()) == ext {
+				configFiles = append(configFiles, filepath.Join(dir, e.Name()))
+				break
+			}
+		}
+	}
+
+	return configFiles, nil
+}
+
+// bundleFileName returns the name of the bundle created from the config file, e.g. `images.tar` for
+// `images.yaml`, or `images.tar.gz` with gzip compression.
+func bundleFileName(configFile string, compression archive.Compression) string {
+	base := filepath.Base(configFile)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + ".tar" + compression.Extension()
+}
+
+// bundleFileNames returns the names of the bundles created from the config files by config file,
+// failing if config files only differing in their extension, e.g. images.yaml and images.txt, would
+// create the same bundle.
+func bundleFileNames(configFiles []string, compression archive.Compression) (map[string]string, error) {
+	names := make(map[string]string, len(configFiles))
+	configFilesByName := make(map[string]string, len(configFiles))
+	for _, configFile := range configFiles {
+		name := bundleFileName(configFile, compression)
+		if other, ok := configFilesByName[name]; ok {
+			return nil, fmt.Errorf(
+				"images config files %s and %s would both create image bundle %s, rename one of them",
+				other, configFile, name,
+			)
+		}
+		configFilesByName[name] = configFile
+		names[configFile] = name
+	}
+	return names, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package create
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/imagebundle"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+func TestConfigFilesInDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, f := range []string{"b.yaml", "a.txt", "c.yml", "README.md", ".hidden.json"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, f), nil, 0o600))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "d.yaml"), 0o700))
+
+	got, err := configFilesInDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, "b.yaml"),
+		filepath.Join(dir, "c.yml"),
+	}, got)
+}
+
+func TestBundleFileName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "images.tar", bundleFileName(filepath.Join("bundles", "images.yaml"), archive.None))
+	assert.Equal(t, "my.images.tar", bundleFileName("my.images.txt", archive.None))
+	assert.Equal(t, "images.tar.gz", bundleFileName("images.yaml", archive.Gzip))
+	assert.Equal(t, "images.tar.zst", bundleFileName("images.yaml", archive.Zstd))
+}
+
+func TestBundleFileNames(t *testing.T) {
+	t.Parallel()
+
+	got, err := bundleFileNames([]string{"a.txt", "b.yaml"}, archive.None)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a.txt": "a.tar", "b.yaml": "b.tar"}, got)
+
+	_, err = bundleFileNames([]string{"images.txt", "images.yaml", "images.yml"}, archive.None)
+	require.EqualError(
+		t, err, "images config files images.txt and images.yaml would both create image bundle images.tar, "+
+			"rename one of them",
+	)
+}
+
+func TestBatchReport(t *testing.T) {
+	t.Parallel()
+
+	r := &batchReport{}
+	r.add("bundles/a.yaml", "out/a.tar", &imagebundle.Result{
+		TotalImages: 2,
+		Warnings: []warnings.Warning{{
+			Kind:    warnings.MissingPlatform,
+			Message: `image "docker.io/library/nginx:1.21.5" does not provide requested platform "linux/arm64"`,
+		}},
+	}, nil)
+	assert.False(t, r.failed())
+
+	r.add("bundles/b.yaml", "out/b.tar", &imagebundle.Result{
+		TotalImages:  3,
+		FailedImages: []imagebundle.ImageError{{Image: "docker.io/library/busybox:latest", Error: "unauthorized"}},
+	}, nil)
+	r.add("bundles/c.yaml", "out/c.tar", nil, errors.New("invalid config"))
+	assert.True(t, r.failed())
+	assert.Equal(t, "Created 2 of 3 image bundles, 1 of 5 images failed", r.summary())
+
+	reportFile := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, r.writeFile(reportFile))
+	b, err := os.ReadFile(reportFile)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "bundles": [{
+    "configFile": "bundles/a.yaml",
+    "bundleFile": "out/a.tar",
+    "totalImages": 2,
+    "failedImages": [],
+    "warnings": [
+      "missing platform: image \"docker.io/library/nginx:1.21.5\" does not provide requested platform \"linux/arm64\""
+    ]
+  }, {
+    "configFile": "bundles/b.yaml",
+    "bundleFile": "out/b.tar",
+    "totalImages": 3,
+    "failedImages": [{"image": "docker.io/library/busybox:latest", "error": "unauthorized"}]
+  }, {
+    "configFile": "bundles/c.yaml",
+    "bundleFile": "out/c.tar",
+    "totalImages": 0,
+    "failedImages": [],
+    "error": "invalid config"
+  }]
+}`, string(b))
+}
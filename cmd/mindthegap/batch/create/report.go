@@ -0,0 +1,83 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package create
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/imagebundle"
+)
+
+// batchReport is the consolidated report of all bundles created in a batch.
+type batchReport struct {
+	Bundles []bundleReport `json:"bundles"`
+}
+
+type bundleReport struct {
+	ConfigFile   string                   `json:"configFile"`
+	BundleFile   string                   `json:"bundleFile"`
+	TotalImages  int                      `json:"totalImages"`
+	FailedImages []imagebundle.ImageError `json:"failedImages"`
+	Warnings     []string                 `json:"warnings,omitempty"`
+	Error        string                   `json:"error,omitempty"`
+}
+
+func (r *batchReport) add(configFile, bundleFile string, result *imagebundle.Result, err error) {
+	b := bundleReport{
+		ConfigFile:   configFile,
+		BundleFile:   bundleFile,
+		FailedImages: []imagebundle.ImageError{},
+	}
+	if result != nil {
+		b.TotalImages = result.TotalImages
+		b.FailedImages = append(b.FailedImages, result.FailedImages...)
+		for _, w := range result.Warnings {
+			b.Warnings = append(b.Warnings, w.String())
+		}
+	}
+	if err != nil {
+		b.Error = err.Error()
+	}
+	r.Bundles = append(r.Bundles, b)
+}
+
+// failed returns true if any bundle failed to be created or any image failed to be pulled.
+func (r *batchReport) failed() bool {
+	for _, b := range r.Bundles {
+		if b.Error != "" || len(b.FailedImages) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *batchReport) summary() string {
+	var created, failedImages, totalImages int
+	for _, b := range r.Bundles {
+		if b.Error == "" {
+			created++
+		}
+		failedImages += len(b.FailedImages)
+		totalImages += b.TotalImages
+	}
+	return fmt.Sprintf(
+		"Created %d of %d image bundles, %d of %d images failed",
+		created, len(r.Bundles), failedImages, totalImages,
+	)
+}
+
+func (r *batchReport) writeFile(fileName string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode batch report: %w", err)
+	}
+	//nolint:gosec // Batch report is not sensitive.
+	if err := os.WriteFile(fileName, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write batch report: %w", err)
+	}
+
+	return nil
+}
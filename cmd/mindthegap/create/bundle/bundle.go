@@ -0,0 +1,212 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package bundle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/helmbundle"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/imagebundle"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/progress"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/images/authnhelpers"
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/metrics"
+)
+
+func NewCommand(out output.Output) *cobra.Command {
+	var (
+		configFile           string
+		platforms            []platform.Platform
+		outputFile           string
+		overwrite            bool
+		imagePullConcurrency int
+		progressMode         progress.Mode
+		strict               bool
+		compression          archive.Compression
+		compressionLevel     int
+		splitSize            flags.SplitSize
+		registryAuthFile     string
+		credentialOpts       authnhelpers.CredentialOptions
+		clockSkewTolerance   time.Duration
+		maxBundleSize        resource.QuantityValue
+		dryRun               bool
+		listenAddress        string
+		repoRewriteRulesFile string
+		requireAllPlatforms  bool
+		scanOpts             imagebundle.ScanOptions
+		rateLimits           imagebundle.RateLimitOptions
+		annotations          flags.Annotations
+		signKey              string
+		listenPortRange      flags.PortRange
+		destinationPlatforms imagebundle.DestinationPlatformOptions
+
+		includeNonDistributable bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Create a bundle containing both images and Helm charts",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := cmd.ValidateRequiredFlags(); err != nil {
+				return err
+			}
+
+			if err := flags.ValidateFlagsThatRequireValues(cmd, "config-file"); err != nil {
+				return err
+			}
+
+			return flags.ResolveCompression(cmd.Flags(), outputFile, &compression, compressionLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out.StartOperation("Parsing bundle config")
+			cfg, err := config.ParseBundleConfigFileWithWarnings(configFile, nil)
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return err
+			}
+			out.EndOperationWithStatus(output.Success())
+			out.V(4).Infof("Bundle config: %+v", cfg)
+
+			configFileAbs, err := filepath.Abs(configFile)
+			if err != nil {
+				return err
+			}
+
+			destPlatforms, err := destinationPlatforms.Resolve(cmd.Context(), out)
+			if err != nil {
+				return err
+			}
+			platformsRequested := cmd.Flags().Changed("platform")
+			if !platformsRequested && len(destPlatforms) > 0 {
+				platforms, platformsRequested = destPlatforms, true
+			}
+
+			imagesCfg := cfg.Images
+			if imagesCfg == nil {
+				imagesCfg = &config.ImagesConfig{}
+			}
+
+			_, err = imagebundle.Create(cmd.Context(), out, imagebundle.Options{
+				ImagesConfig:         imagesCfg,
+				OutputFile:           outputFile,
+				Overwrite:            overwrite,
+				Platforms:            platforms,
+				PlatformsRequested:   platformsRequested,
+				DestinationPlatforms: destPlatforms,
+				MaxBundleSize:        maxBundleSize.Value(),
+				DryRun:               dryRun,
+				ListenAddress:        listenAddress,
+				ListenPortRange:      listenPortRange,
+				RepoRewriteRulesFile: repoRewriteRulesFile,
+				Scan:                 scanOpts,
+				RateLimits:           rateLimits,
+				Annotations:          annotations,
+				SignKey:              signKey,
+				RequireAllPlatforms:  requireAllPlatforms,
+				ImagePullConcurrency: imagePullConcurrency,
+				Strict:               strict,
+				OnError:              imagebundle.Fail,
+				Layout:               imagebundle.RegistryLayout,
+				Compression:          compression,
+				CompressionLevel:     compressionLevel,
+				SplitSize:            splitSize.Bytes,
+				RegistryAuthFile:     registryAuthFile,
+				Credentials:          credentialOpts,
+				ClockSkewTolerance:   clockSkewTolerance,
+				Reporter:             progress.NewReporter(progressMode, cmd.OutOrStdout()),
+				Metrics:              metrics.FromContext(cmd.Context()),
+				BeforeArchive: func(bundleDir, registryAddress string, bundledImages config.ImagesConfig) error {
+					var bundledImagesCfg *config.ImagesConfig
+					if cfg.Images != nil {
+						bundledImagesCfg = &bundledImages
+					} else if err := os.Remove(filepath.Join(bundleDir, "images.yaml")); err != nil {
+						return fmt.Errorf("failed to remove empty images config: %w", err)
+					}
+
+					if cfg.HelmCharts != nil {
+						if err := helmbundle.PushCharts(
+							out, cfg.HelmCharts, filepath.Dir(configFileAbs), registryAddress,
+						); err != nil {
+							return err
+						}
+						if err := config.WriteSanitizedHelmChartsConfig(
+							*cfg.HelmCharts, filepath.Join(bundleDir, "charts.yaml"),
+						); err != nil {
+							return err
+						}
+					}
+
+					if err := utils.WriteBundleInstructions(
+						bundleDir, outputFile, bundledImagesCfg, cfg.HelmCharts,
+					); err != nil {
+						return err
+					}
+					if err := utils.WriteBundleMetadata(bundleDir, utils.NewBundleMetadata(
+						utils.RegistryBundleLayout, bundledImagesCfg, cfg.HelmCharts,
+					)); err != nil {
+						return err
+					}
+					return utils.WriteBundleManifest(bundleDir, bundledImagesCfg, cfg.HelmCharts)
+				},
+
+				IncludeNonDistributable: includeNonDistributable,
+			})
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&configFile, "config-file", "",
+		"YAML file containing images (under images, in any images config format) and Helm charts "+
+			"(under helmCharts, in the Helm charts config format) to create bundle from")
+	_ = cmd.MarkFlagRequired("config-file")
+	cmd.Flags().
+		Var(flags.NewPlatformsOrAllValue([]platform.Platform{platform.MustParse("linux/amd64")}, &platforms), "platform",
+			"platforms to download images (required format: <os>/<arch>[/<variant>][:<os.version>]), or \"all\" to bundle every "+
+				"platform of every image with its complete manifest list")
+	cmd.Flags().BoolVar(&requireAllPlatforms, "require-all-platforms", false,
+		"Fail if any image does not provide all requested platforms, listing every missing image and platform")
+	imagebundle.AddDestinationPlatformFlags(cmd.Flags(), &destinationPlatforms)
+	cmd.Flags().
+		StringVar(&outputFile, "output-file", "bundle.tar", "Output file to write bundle to")
+	cmd.Flags().
+		BoolVar(&overwrite, "overwrite", false, "Overwrite bundle file if it already exists")
+	cmd.Flags().
+		IntVar(&imagePullConcurrency, "image-pull-concurrency", 1, "Image pull concurrency")
+	progress.AddFlag(cmd.Flags(), &progressMode)
+	imagebundle.AddBundleSizeFlags(cmd.Flags(), &maxBundleSize, &dryRun)
+	flags.AddCompressionFlags(cmd.Flags(), &compression, &compressionLevel)
+	flags.AddSplitSizeFlag(cmd.Flags(), &splitSize)
+	flags.AddRegistryAuthFileFlag(cmd.Flags(), &registryAuthFile)
+	flags.AddRegistryCredentialFlags(cmd.Flags(), &credentialOpts)
+	flags.AddIncludeNonDistributableFlag(cmd.Flags(), &includeNonDistributable)
+	flags.AddClockSkewToleranceFlag(cmd.Flags(), &clockSkewTolerance)
+	flags.AddTemporaryRegistryListenFlags(cmd.Flags(), &listenAddress, &listenPortRange)
+	cmd.Flags().StringVar(&repoRewriteRulesFile, "repo-rewrite-rules", "",
+		"File containing rules to rewrite source image repositories to destination repositories, "+
+			"recording the repositories images are pushed to in the bundle")
+	imagebundle.AddScanFlags(cmd.Flags(), &scanOpts)
+	imagebundle.AddRateLimitFlags(cmd.Flags(), &rateLimits)
+	flags.AddAnnotationFlag(cmd.Flags(), &annotations)
+	flags.AddBundleSignKeyFlag(cmd.Flags(), &signKey)
+	cmd.Flags().BoolVar(&strict, "strict", false,
+		"Treat warnings (missing platforms, digests not found, image name normalization changes, platform "+
+			"mismatches, deprecated images, vulnerabilities with --scan-action=warn) as errors")
+
+	// TODO Unhide this from DKP CLI once DKP supports OCI registry for Helm charts.
+	utils.AddCmdAnnotation(cmd, "exclude-from-dkp-cli", "true")
+
+	return cmd
+}
@@ -8,17 +8,23 @@ import (
 
 	"github.com/mesosphere/dkp-cli-runtime/core/output"
 
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/bundle"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/filebundle"
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/helmbundle"
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/imagebundle"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/imagesfile"
 )
 
 func NewCommand(out output.Output) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "create",
-		Short: "Create an image or Helm chart bundle",
+		Short: "Create an image, Helm chart or file bundle",
 	}
 
 	cmd.AddCommand(imagebundle.NewCommand(out))
 	cmd.AddCommand(helmbundle.NewCommand(out))
+	cmd.AddCommand(bundle.NewCommand(out))
+	cmd.AddCommand(filebundle.NewCommand(out))
+	cmd.AddCommand(imagesfile.NewCommand(out))
 	return cmd
 }
@@ -0,0 +1,31 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package filebundle
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/download"
+)
+
+// downloadFile downloads the file to the path it is served at under dir, verifying its checksum and
+// size, and returns the size of the file. Files that have already been downloaded completely, e.g.
+// when resuming, are not downloaded again. The checksum and size of the file are set on opts.
+func downloadFile(ctx context.Context, f config.FileConfig, dir string, opts download.Options) (int64, error) {
+	servedPath, err := f.ServedPath()
+	if err != nil {
+		return 0, err
+	}
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file URL: %w", err)
+	}
+
+	opts.Checksum, opts.Size = f.Checksum, f.Size
+	return download.File(ctx, u, filepath.Join(dir, filepath.FromSlash(servedPath)), opts)
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package filebundle
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/download"
+)
+
+// fileServer serves content, recording range requests.
+type fileServer struct {
+	content []byte
+
+	mu            sync.Mutex
+	rangeRequests []string
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	if rng := req.Header.Get("Range"); req.Method == http.MethodGet && rng != "" {
+		s.rangeRequests = append(s.rangeRequests, rng)
+	}
+	s.mu.Unlock()
+
+	http.ServeContent(w, req, "model.bin", time.Time{}, bytes.NewReader(s.content))
+}
+
+func testFile(t *testing.T, content []byte, u string) config.FileConfig {
+	t.Helper()
+	sum := sha256.Sum256(content)
+	return config.FileConfig{
+		URL:      u + "/models/model.bin",
+		Checksum: "sha256:" + hex.EncodeToString(sum[:]),
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	srv := &fileServer{content: content}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	dir := t.TempDir()
+	f := testFile(t, content, ts.URL)
+	size, err := downloadFile(context.Background(), f, dir, download.Options{ChunkSize: 32})
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), size)
+
+	got, err := os.ReadFile(filepath.Join(dir, "models", "model.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, content, got, "the file should be downloaded to the path it is served at")
+	assert.Equal(t, []string{"bytes=0-31", "bytes=32-63", "bytes=64-95", "bytes=96-99"}, srv.rangeRequests)
+}
+
+func TestVerifyFile(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("content")
+	p := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(p, content, 0o644))
+	f := testFile(t, content, "https://example.com")
+
+	size, err := VerifyFile(f, p)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), size)
+
+	f.Size = 1
+	_, err = VerifyFile(f, p)
+	require.ErrorContains(t, err, "expected 1 bytes")
+
+	f = testFile(t, []byte("other"), "https://example.com")
+	_, err = VerifyFile(f, p)
+	require.ErrorContains(t, err, "checksum of file")
+}
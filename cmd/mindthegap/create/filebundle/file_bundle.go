@@ -0,0 +1,182 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package filebundle
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/cleanup"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/download"
+)
+
+const (
+	// FilesConfigFileName is the name of the config listing the files in a file bundle.
+	FilesConfigFileName = "files.yaml"
+	// FilesDir is the directory of a file bundle containing the files, at the paths they are served at.
+	FilesDir = "files"
+)
+
+func NewCommand(out output.Output) *cobra.Command {
+	var (
+		configFile       string
+		outputFile       string
+		overwrite        bool
+		compression      archive.Compression
+		compressionLevel int
+		chunkSize        = resource.QuantityValue{Quantity: resource.MustParse("64Mi")}
+		downloadRetries  int
+		resumeFromDir    string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "file-bundle",
+		Short: "Create a bundle of files, e.g. binaries, OS packages or install scripts",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := cmd.ValidateRequiredFlags(); err != nil {
+				return err
+			}
+
+			if err := flags.ValidateFlagsThatRequireValues(cmd, "files-file"); err != nil {
+				return err
+			}
+
+			return flags.ResolveCompression(cmd.Flags(), outputFile, &compression, compressionLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !overwrite {
+				out.StartOperation("Checking if output file already exists")
+				_, err := os.Stat(outputFile)
+				switch {
+				case err == nil:
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf(
+						"%s already exists: specify --overwrite to overwrite existing file",
+						outputFile,
+					)
+				case !errors.Is(err, os.ErrNotExist):
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf(
+						"failed to check if output file %s already exists: %w",
+						outputFile,
+						err,
+					)
+				default:
+					out.EndOperationWithStatus(output.Success())
+				}
+			}
+
+			out.StartOperation("Parsing file bundle config")
+			cfg, err := config.ParseFilesConfigFile(configFile)
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return err
+			}
+			out.EndOperationWithStatus(output.Success())
+			out.V(4).Infof("Files config: %+v", cfg)
+
+			cleaner := cleanup.NewCleaner()
+			defer cleaner.Cleanup()
+
+			var tempDir string
+			if resumeFromDir != "" {
+				tempDir = resumeFromDir
+				if err := os.MkdirAll(tempDir, 0o755); err != nil {
+					return fmt.Errorf("failed to create resume directory: %w", err)
+				}
+			} else {
+				out.StartOperation("Creating temporary directory")
+				outputFileAbs, err := filepath.Abs(outputFile)
+				if err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf(
+						"failed to determine where to create temporary directory: %w",
+						err,
+					)
+				}
+
+				tempDir, err = os.MkdirTemp(filepath.Dir(outputFileAbs), ".file-bundle-*")
+				if err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf("failed to create temporary directory: %w", err)
+				}
+				cleaner.AddCleanupFn(func() { _ = os.RemoveAll(tempDir) })
+				out.EndOperationWithStatus(output.Success())
+			}
+
+			dlOpts := download.Options{
+				ChunkSize: chunkSize.Value(),
+				Retries:   downloadRetries,
+				UserAgent: utils.Useragent(),
+			}
+			for i := range cfg.Files {
+				f := &cfg.Files[i]
+				out.StartOperation(fmt.Sprintf("Downloading file %s", f.URL))
+				f.Size, err = downloadFile(cmd.Context(), *f, filepath.Join(tempDir, FilesDir), dlOpts)
+				if err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					if resumeFromDir != "" {
+						out.Infof(
+							"Progress has been saved to %s, re-run with the same --resume-from-dir to resume",
+							resumeFromDir,
+						)
+					}
+					return err
+				}
+				out.EndOperationWithStatus(output.Success())
+			}
+
+			if err := config.WriteFilesConfig(cfg, filepath.Join(tempDir, FilesConfigFileName)); err != nil {
+				return err
+			}
+
+			out.StartOperation(fmt.Sprintf("Archiving files to %s", outputFile))
+			if err := archive.ArchiveDirectoryWithOptions(tempDir, outputFile, archive.Options{
+				Compression:         compression,
+				CompressionLevel:    compressionLevel,
+				RemoveArchivedFiles: true,
+			}); err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to create file bundle tarball: %w", err)
+			}
+			out.EndOperationWithStatus(output.Success())
+			if resumeFromDir != "" {
+				_ = os.RemoveAll(resumeFromDir)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&configFile, "files-file", "",
+		"YAML file containing URLs and checksums of files to create bundle from")
+	_ = cmd.MarkFlagRequired("files-file")
+	cmd.Flags().
+		StringVar(&outputFile, "output-file", "files.tar", "Output file to write file bundle to")
+	cmd.Flags().
+		BoolVar(&overwrite, "overwrite", false, "Overwrite file bundle file if it already exists")
+	flags.AddCompressionFlags(cmd.Flags(), &compression, &compressionLevel)
+	cmd.Flags().Var(&chunkSize, "chunk-size",
+		"Download files larger than this size in chunks of this size via HTTP range requests, if supported by "+
+			"the server, retrying failed chunks (0 downloads every file in a single request)")
+	cmd.Flags().IntVar(&downloadRetries, "download-retries", 3,
+		"Number of times to retry downloading a failed chunk, or to resume downloading a file after a failure")
+	cmd.Flags().StringVar(&resumeFromDir, "resume-from-dir", "",
+		"Directory to download files into, persisting progress including partially downloaded files so that "+
+			"an interrupted run can be resumed by re-running with the same directory (removed once the bundle "+
+			"has been created)")
+
+	return cmd
+}
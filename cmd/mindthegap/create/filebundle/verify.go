@@ -0,0 +1,15 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package filebundle
+
+import (
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/download"
+)
+
+// VerifyFile verifies that the file at path has the checksum, and size if set, of the file config,
+// returning the size of the file.
+func VerifyFile(f config.FileConfig, path string) (int64, error) {
+	return download.Verify(path, f.Checksum, f.Size)
+}
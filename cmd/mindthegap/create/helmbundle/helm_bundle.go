@@ -4,6 +4,7 @@
 package helmbundle
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -27,9 +28,13 @@ import (
 
 func NewCommand(out output.Output) *cobra.Command {
 	var (
-		configFile string
-		outputFile string
-		overwrite  bool
+		configFile       string
+		outputFile       string
+		overwrite        bool
+		compression      archive.Compression
+		compressionLevel int
+		listenAddress    string
+		listenPortRange  flags.PortRange
 	)
 
 	cmd := &cobra.Command{
@@ -44,9 +49,9 @@ func NewCommand(out output.Output) *cobra.Command {
 				return err
 			}
 
-			return nil
+			return flags.ResolveCompression(cmd.Flags(), outputFile, &compression, compressionLevel)
 		},
-		RunE: func(cmd *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			if !overwrite {
 				out.StartOperation("Checking if output file already exists")
 				_, err := os.Stat(outputFile)
@@ -105,147 +110,55 @@ func NewCommand(out output.Output) *cobra.Command {
 			out.EndOperationWithStatus(output.Success())
 
 			out.StartOperation("Starting temporary OCI registry")
-			reg, err := registry.NewRegistry(registry.Config{StorageDirectory: tempRegistryDir})
+			reg, err := registry.NewRegistry(registry.Config{
+				StorageDirectory: tempRegistryDir,
+				Host:             listenAddress,
+				Port:             listenPortRange.First,
+				MaxPort:          listenPortRange.Last,
+			})
 			if err != nil {
 				out.EndOperationWithStatus(output.Failure())
 				return fmt.Errorf("failed to create local OCI registry: %w", err)
 			}
-			go func() {
-				if err := reg.ListenAndServe(); err != nil {
-					out.Error(err, "error serving OCI registry")
-					os.Exit(2)
-				}
-			}()
-			out.EndOperationWithStatus(output.Success())
-
-			out.StartOperation("Creating temporary chart storage directory")
-
-			tempHelmChartStorageDir, err := os.MkdirTemp("", ".helm-bundle-temp-storage-*")
+			regCtx, stopReg := context.WithCancel(cmd.Context())
+			regErrCh, err := reg.Start(regCtx)
 			if err != nil {
+				stopReg()
 				out.EndOperationWithStatus(output.Failure())
-				return fmt.Errorf(
-					"failed to create temporary directory for Helm chart storage: %w",
-					err,
-				)
-			}
-			cleaner.AddCleanupFn(func() { _ = os.RemoveAll(tempHelmChartStorageDir) })
-			out.EndOperationWithStatus(output.Success())
-
-			helmClient, helmCleanup := helm.NewClient(out)
-			cleaner.AddCleanupFn(func() { _ = helmCleanup() })
-
-			ociAddress := fmt.Sprintf("%s://%s/charts", helm.OCIScheme, reg.Address())
-
-			for repoName, repoConfig := range cfg.Repositories {
-				for chartName, chartVersions := range repoConfig.Charts {
-					sort.Strings(chartVersions)
-
-					out.StartOperation(
-						fmt.Sprintf(
-							"Fetching Helm chart %s (versions %v) from %s (%s)",
-							chartName,
-							chartVersions,
-							repoName,
-							repoConfig.RepoURL,
-						),
-					)
-					var opts []action.PullOpt
-					if repoConfig.Username != "" {
-						opts = append(
-							opts,
-							helm.UsernamePasswordOpt(repoConfig.Username, repoConfig.Password),
-						)
-					}
-					if !ptr.Deref(repoConfig.TLSVerify, true) {
-						opts = append(opts, helm.InsecureSkipTLSverifyOpt())
-					}
-					for _, chartVersion := range chartVersions {
-						downloaded, err := helmClient.GetChartFromRepo(
-							tempHelmChartStorageDir,
-							repoConfig.RepoURL,
-							chartName,
-							chartVersion,
-							[]helm.ConfigOpt{helm.RegistryClientConfigOpt()},
-							opts...,
-						)
-						if err != nil {
-							out.EndOperationWithStatus(output.Failure())
-							return fmt.Errorf("failed to create Helm chart bundle: %v", err)
-						}
-
-						if err := helmClient.PushHelmChartToOCIRegistry(
-							downloaded, ociAddress,
-						); err != nil {
-							out.EndOperationWithStatus(output.Failure())
-							return fmt.Errorf(
-								"failed to push Helm chart to temporary registry: %w",
-								err,
-							)
-						}
-
-						// Best effort cleanup of downloaded chart, will be cleaned up when the cleaner deletes the temporary
-						// directory anyway.
-						_ = os.Remove(downloaded)
-					}
-					out.EndOperationWithStatus(output.Success())
-				}
+				return fmt.Errorf("failed to start local OCI registry: %w", err)
 			}
-			for _, chartURL := range cfg.ChartURLs {
-				out.StartOperation(fmt.Sprintf("Fetching Helm chart from URL %s", chartURL))
-				downloaded, err := helmClient.GetChartFromURL(
-					tempRegistryDir,
-					chartURL,
-					filepath.Dir(configFileAbs),
-				)
-				if err != nil {
-					out.EndOperationWithStatus(output.Failure())
-					return fmt.Errorf("failed to create Helm chart bundle: %v", err)
-				}
-
-				chrt, err := helm.LoadChart(downloaded)
-				if err != nil {
-					out.EndOperationWithStatus(output.Failure())
-					return fmt.Errorf(
-						"failed to extract Helm chart details from local chart: %w",
-						err,
-					)
-				}
-
-				_, ok := cfg.Repositories["local"]
-				if !ok {
-					cfg.Repositories["local"] = config.HelmRepositorySyncConfig{
-						Charts: make(map[string][]string, 1),
-					}
-				}
-				_, ok = cfg.Repositories["local"].Charts[chrt.Name()]
-				if !ok {
-					cfg.Repositories["local"].Charts[chrt.Name()] = make([]string, 0, 1)
-				}
-				cfg.Repositories["local"].Charts[chrt.Name()] = append(
-					cfg.Repositories["local"].Charts[chrt.Name()],
-					chrt.Metadata.Version,
-				)
-
-				if err := helmClient.PushHelmChartToOCIRegistry(
-					downloaded, ociAddress,
-				); err != nil {
-					out.EndOperationWithStatus(output.Failure())
-					return fmt.Errorf("failed to push Helm chart to temporary registry: %w", err)
+			// Wait for the registry to stop before its storage is cleaned up.
+			defer func() {
+				stopReg()
+				for regErr := range regErrCh {
+					err = errors.Join(err, regErr)
 				}
+			}()
+			out.EndOperationWithStatus(output.Success())
+			out.V(2).Infof("Temporary OCI registry listening on %s", reg.Address())
 
-				// Best effort cleanup of downloaded chart, will be cleaned up when the cleaner deletes the temporary
-				// directory anyway.
-				_ = os.Remove(downloaded)
-
-				out.EndOperationWithStatus(output.Success())
+			if err := PushCharts(out, &cfg, filepath.Dir(configFileAbs), reg.Address()); err != nil {
+				return err
 			}
 
 			if err := config.WriteSanitizedHelmChartsConfig(cfg, filepath.Join(tempRegistryDir, "charts.yaml")); err != nil {
 				return err
 			}
+			if err := utils.WriteBundleInstructions(tempRegistryDir, outputFile, nil, &cfg); err != nil {
+				return err
+			}
+			if err := utils.WriteBundleMetadata(
+				tempRegistryDir, utils.NewBundleMetadata(utils.RegistryBundleLayout, nil, &cfg),
+			); err != nil {
+				return err
+			}
 
 			out.StartOperation(fmt.Sprintf("Archiving Helm charts to %s", outputFile))
-			if err := archive.ArchiveDirectory(tempRegistryDir, outputFile); err != nil {
+			if err := archive.ArchiveDirectoryWithOptions(tempRegistryDir, outputFile, archive.Options{
+				Compression:         compression,
+				CompressionLevel:    compressionLevel,
+				RemoveArchivedFiles: true,
+			}); err != nil {
 				out.EndOperationWithStatus(output.Failure())
 				return fmt.Errorf("failed to create Helm charts bundle tarball: %w", err)
 			}
@@ -262,9 +175,144 @@ func NewCommand(out output.Output) *cobra.Command {
 		StringVar(&outputFile, "output-file", "helm-charts.tar", "Output file to write Helm charts bundle to")
 	cmd.Flags().
 		BoolVar(&overwrite, "overwrite", false, "Overwrite Helm charts bundle file if it already exists")
+	flags.AddCompressionFlags(cmd.Flags(), &compression, &compressionLevel)
+	flags.AddTemporaryRegistryListenFlags(cmd.Flags(), &listenAddress, &listenPortRange)
 
 	// TODO Unhide this from DKP CLI once DKP supports OCI registry for Helm charts.
 	utils.AddCmdAnnotation(cmd, "exclude-from-dkp-cli", "true")
 
 	return cmd
 }
+
+// PushCharts fetches the Helm charts in the config and pushes them to the charts repository of the
+// registry at registryAddress. Charts fetched from URLs, resolved relative to configDir, are added
+// to the config under the local repository.
+func PushCharts(
+	out output.Output,
+	cfg *config.HelmChartsConfig,
+	configDir, registryAddress string,
+) error {
+	out.StartOperation("Creating temporary chart storage directory")
+
+	tempHelmChartStorageDir, err := os.MkdirTemp("", ".helm-bundle-temp-storage-*")
+	if err != nil {
+		out.EndOperationWithStatus(output.Failure())
+		return fmt.Errorf(
+			"failed to create temporary directory for Helm chart storage: %w",
+			err,
+		)
+	}
+	defer os.RemoveAll(tempHelmChartStorageDir)
+	out.EndOperationWithStatus(output.Success())
+
+	helmClient, helmCleanup := helm.NewClient(out)
+	defer func() { _ = helmCleanup() }()
+
+	ociAddress := fmt.Sprintf("%s://%s/charts", helm.OCIScheme, registryAddress)
+
+	for repoName, repoConfig := range cfg.Repositories {
+		for chartName, chartVersions := range repoConfig.Charts {
+			sort.Strings(chartVersions)
+
+			out.StartOperation(
+				fmt.Sprintf(
+					"Fetching Helm chart %s (versions %v) from %s (%s)",
+					chartName,
+					chartVersions,
+					repoName,
+					repoConfig.RepoURL,
+				),
+			)
+			var opts []action.PullOpt
+			if repoConfig.Username != "" {
+				opts = append(
+					opts,
+					helm.UsernamePasswordOpt(repoConfig.Username, repoConfig.Password),
+				)
+			}
+			if !ptr.Deref(repoConfig.TLSVerify, true) {
+				opts = append(opts, helm.InsecureSkipTLSverifyOpt())
+			}
+			for _, chartVersion := range chartVersions {
+				downloaded, err := helmClient.GetChartFromRepo(
+					tempHelmChartStorageDir,
+					repoConfig.RepoURL,
+					chartName,
+					chartVersion,
+					[]helm.ConfigOpt{helm.RegistryClientConfigOpt()},
+					opts...,
+				)
+				if err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf("failed to create Helm chart bundle: %v", err)
+				}
+
+				if err := helmClient.PushHelmChartToOCIRegistry(
+					downloaded, ociAddress,
+				); err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf(
+						"failed to push Helm chart to temporary registry: %w",
+						err,
+					)
+				}
+
+				// Best effort cleanup of downloaded chart, will be cleaned up when the cleaner deletes the temporary
+				// directory anyway.
+				_ = os.Remove(downloaded)
+			}
+			out.EndOperationWithStatus(output.Success())
+		}
+	}
+	for _, chartURL := range cfg.ChartURLs {
+		out.StartOperation(fmt.Sprintf("Fetching Helm chart from URL %s", chartURL))
+		downloaded, err := helmClient.GetChartFromURL(
+			tempHelmChartStorageDir,
+			chartURL,
+			configDir,
+		)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return fmt.Errorf("failed to create Helm chart bundle: %v", err)
+		}
+
+		chrt, err := helm.LoadChart(downloaded)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return fmt.Errorf(
+				"failed to extract Helm chart details from local chart: %w",
+				err,
+			)
+		}
+
+		_, ok := cfg.Repositories["local"]
+		if !ok {
+			cfg.Repositories["local"] = config.HelmRepositorySyncConfig{
+				Charts: make(map[string][]string, 1),
+			}
+		}
+		_, ok = cfg.Repositories["local"].Charts[chrt.Name()]
+		if !ok {
+			cfg.Repositories["local"].Charts[chrt.Name()] = make([]string, 0, 1)
+		}
+		cfg.Repositories["local"].Charts[chrt.Name()] = append(
+			cfg.Repositories["local"].Charts[chrt.Name()],
+			chrt.Metadata.Version,
+		)
+
+		if err := helmClient.PushHelmChartToOCIRegistry(
+			downloaded, ociAddress,
+		); err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return fmt.Errorf("failed to push Helm chart to temporary registry: %w", err)
+		}
+
+		// Best effort cleanup of downloaded chart, will be cleaned up when the cleaner deletes the temporary
+		// directory anyway.
+		_ = os.Remove(downloaded)
+
+		out.EndOperationWithStatus(output.Success())
+	}
+
+	return nil
+}
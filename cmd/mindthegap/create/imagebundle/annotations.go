@@ -0,0 +1,47 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"fmt"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/images"
+)
+
+// imageAnnotators are the annotators of the images of an images config, keyed by registry and
+// image name. Images without any annotations have no annotator.
+type imageAnnotators map[string]map[string]*images.Annotator
+
+// newImageAnnotators parses the annotations of every image, the requested annotations overridden by
+// the annotations configured for its registry and the image itself, so that invalid annotations
+// fail before any image is pulled.
+func newImageAnnotators(cfg config.ImagesConfig, requested map[string]string) (imageAnnotators, error) {
+	annotators := imageAnnotators{}
+	for registryName, registryConfig := range cfg {
+		for imageName := range registryConfig.Images {
+			a, err := images.NewAnnotator(registryConfig.AnnotationsForImage(imageName, requested))
+			if err != nil {
+				return nil, fmt.Errorf("registry %q: image %q: %w", registryName, imageName, err)
+			}
+			if a == nil {
+				continue
+			}
+			if annotators[registryName] == nil {
+				annotators[registryName] = map[string]*images.Annotator{}
+			}
+			annotators[registryName][imageName] = a
+		}
+	}
+	return annotators, nil
+}
+
+// forImage returns the annotator of the image, or nil if the image has no annotations.
+func (a imageAnnotators) forImage(registryName, imageName string) *images.Annotator {
+	return a[registryName][imageName]
+}
+
+func (a imageAnnotators) empty() bool {
+	return len(a) == 0
+}
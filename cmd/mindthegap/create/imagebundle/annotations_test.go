@@ -0,0 +1,43 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+func TestNewImageAnnotators(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.ImagesConfig{
+		"docker.io": {
+			Images: map[string][]string{
+				"library/nginx":   {"1.21.5"},
+				"library/busybox": {"1.36"},
+			},
+			ImageAnnotations: map[string]map[string]string{
+				"library/nginx": {"com.example.source": "{{ .Digest }}"},
+			},
+		},
+	}
+
+	annotators, err := newImageAnnotators(cfg, nil)
+	require.NoError(t, err)
+	assert.False(t, annotators.empty())
+	assert.NotNil(t, annotators.forImage("docker.io", "library/nginx"))
+	assert.Nil(t, annotators.forImage("docker.io", "library/busybox"))
+
+	annotators, err = newImageAnnotators(cfg, map[string]string{"org.opencontainers.image.vendor": "Example"})
+	require.NoError(t, err)
+	assert.NotNil(t, annotators.forImage("docker.io", "library/busybox"))
+
+	_, err = newImageAnnotators(cfg, map[string]string{"com.example.build": "{{ .Build }}"})
+	require.ErrorContains(t, err, `registry "docker.io": image "library/`)
+	require.ErrorContains(t, err, `invalid value of annotation "com.example.build"`)
+}
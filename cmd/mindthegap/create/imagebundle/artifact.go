@@ -0,0 +1,65 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/cache"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/progress"
+	"github.com/mesosphere/mindthegap/notation"
+)
+
+// writeArtifact writes the OCI artifact, a v1.Image or v1.ImageIndex read exactly as stored in the
+// source registry, into the bundle, returning its digest. Artifacts are not scanned for
+// vulnerabilities, and bundling them fails if Notation signatures are required, as only signatures
+// of container images are verified.
+func writeArtifact(
+	writer imageWriter,
+	registryName, imageName, imageTag, srcImageName string,
+	artifact remote.Taggable,
+	verifier *notation.Verifier,
+	blobCache cache.Cache,
+	reporter progress.Reporter,
+	destRemoteOpts ...remote.Option,
+) (v1.Hash, error) {
+	if verifier != nil {
+		return v1.Hash{}, fmt.Errorf(
+			"cannot verify Notation signatures of OCI artifact %q: only container images are supported",
+			srcImageName,
+		)
+	}
+
+	var digest v1.Hash
+	switch a := artifact.(type) {
+	case v1.ImageIndex:
+		d, err := a.Digest()
+		if err != nil {
+			return v1.Hash{}, fmt.Errorf("failed to calculate digest of artifact %q: %w", srcImageName, err)
+		}
+		digest = d
+		if blobCache != nil {
+			artifact = cache.ImageIndex(a, blobCache)
+		}
+	case v1.Image:
+		d, err := a.Digest()
+		if err != nil {
+			return v1.Hash{}, fmt.Errorf("failed to calculate digest of artifact %q: %w", srcImageName, err)
+		}
+		digest = d
+		if blobCache != nil {
+			artifact = cache.Image(a, blobCache)
+		}
+	default:
+		return v1.Hash{}, fmt.Errorf("unsupported artifact type %T for %q", artifact, srcImageName)
+	}
+
+	if err := writer.write(registryName, imageName, imageTag, artifact, reporter, destRemoteOpts...); err != nil {
+		return v1.Hash{}, err
+	}
+	return digest, nil
+}
@@ -0,0 +1,1006 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/logs"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/cache"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/cleanup"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/progress"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/docker/registry"
+	"github.com/mesosphere/mindthegap/images"
+	"github.com/mesosphere/mindthegap/images/authnhelpers"
+	"github.com/mesosphere/mindthegap/images/httputils"
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/metrics"
+	"github.com/mesosphere/mindthegap/notation"
+	"github.com/mesosphere/mindthegap/signing"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+// Options configures how an image bundle is created.
+type Options struct {
+	ConfigFile string
+	OutputFile string
+	Overwrite  bool
+	// Platforms are the platforms to bundle images for. Every platform of every image is bundled,
+	// keeping its complete manifest list, if empty.
+	Platforms []platform.Platform
+	// PlatformsRequested is true if platforms were explicitly requested, in which case they take
+	// precedence over platforms configured for registries in v2 images config files.
+	PlatformsRequested   bool
+	ImagePullConcurrency int
+	Strict               bool
+	OnError              OnErrorMode
+	ErrorReportFile      string
+	FailOnAnyError       bool
+	Layout               BundleLayout
+	// LocalImages are local images to include in the bundle, see images.ParseLocalImage.
+	LocalImages         []string
+	ContainerdNamespace string
+	// BlobCacheDir caches pulled blobs for reuse across bundles if set.
+	BlobCacheDir     string
+	Compression      archive.Compression
+	CompressionLevel int
+	// SplitSize splits the bundle into parts of at most this many bytes if set, see
+	// archive.Options.SplitSize. Bundles cannot be split when updating them.
+	SplitSize int64
+	// PerImageTimeout bounds pulling every image, including retries, if set.
+	PerImageTimeout time.Duration
+	// StallTimeout cancels transfers from source registries that do not receive any bytes for
+	// longer than the timeout, retrying the image up to StallRetries times, if set.
+	StallTimeout time.Duration
+	StallRetries int
+	// RegistryAuthFile is the file to read registry credentials from that are not configured in the
+	// images config file, defaulting to the Docker config file.
+	RegistryAuthFile string
+	// Credentials configures resolving credentials from the OS keyring and prompting for them.
+	Credentials authnhelpers.CredentialOptions
+	// RateLimits limits the traffic to source registries.
+	RateLimits RateLimitOptions
+	// ClockSkewTolerance accepts TLS certificates of source registries that are not valid at the
+	// local time if they are valid within the tolerance of it, if set.
+	ClockSkewTolerance time.Duration
+	// Reporter reports progress of pulling images, discarding all events if nil.
+	Reporter progress.Reporter
+	// Metrics records metrics of creating the bundle if set.
+	Metrics *metrics.Recorder
+	// ResumeFromDir is used as the bundle directory if set, persisting progress so that an
+	// interrupted run can be resumed. The directory is only removed once the bundle is created.
+	ResumeFromDir string
+	// IncludeNotationSignatures bundles the Notation signatures of images, requiring the registry
+	// layout.
+	IncludeNotationSignatures bool
+	// IncludeNonDistributable bundles non-distributable (foreign) layers, e.g. the base layers of
+	// Windows images, which are otherwise left out of the bundle and pulled from their URLs.
+	IncludeNonDistributable bool
+	// NotationTrustPolicyFile verifies the Notation signatures of images with the trust policy and
+	// NotationTrustStoreDir trust store if set. Both are bundled to verify signatures when pushing.
+	NotationTrustPolicyFile string
+	NotationTrustStoreDir   string
+	// SignaturePolicyFile is a containers signature verification policy (policy.json) that every
+	// image pulled from a registry must be accepted by, see signing.Policy, if set.
+	SignaturePolicyFile string
+	// Annotations are added to every bundled image, its index and its platform images, overridden by
+	// the annotations configured in the images config file. Values are rendered as templates with
+	// images.AnnotationData. OCI artifacts are not annotated, as they are copied faithfully.
+	Annotations map[string]string
+	// RepoRewriteRulesFile is applied to the repositories of the bundled images if set, recording
+	// the repositories they are pushed to in the bundle.
+	RepoRewriteRulesFile string
+	// Scan scans images for vulnerabilities before they are added to the bundle.
+	Scan ScanOptions
+	// SignKey signs the bundle with the cosign private key, or keylessly if it is signing.Keyless,
+	// writing a detached signature next to the bundle, if set.
+	SignKey string
+	// RequireAllPlatforms fails creating the bundle if any image does not provide all of its
+	// requested platforms, listing all missing platforms of all images.
+	RequireAllPlatforms bool
+	// DestinationPlatforms are the platforms the images will run on, e.g. of the nodes of the
+	// destination cluster. A warning is recorded if any of them is not requested.
+	DestinationPlatforms []platform.Platform
+	// MaxBundleSize fails creating the bundle before pulling any images if the size of the bundle,
+	// estimated from the manifests of its images, exceeds it, if set.
+	MaxBundleSize int64
+	// DryRun only estimates and reports the size of the bundle without pulling any images, warning
+	// instead of failing if MaxBundleSize or the maxSize of any image is exceeded.
+	DryRun bool
+	// ListenAddress is the address for the temporary registry to listen on, defaulting to
+	// 127.0.0.1, on the first free port of ListenPortRange if set.
+	ListenAddress   string
+	ListenPortRange flags.PortRange
+	// Update appends the images that the existing uncompressed bundle at OutputFile does not contain
+	// yet to the bundle in place, rewriting its metadata, instead of creating a new bundle. The
+	// layout of the existing bundle is used.
+	Update bool
+	// ImagesConfig is used instead of parsing ConfigFile if set.
+	ImagesConfig *config.ImagesConfig
+	// BeforeArchive adds further contents to the bundle directory before it is archived if set, e.g.
+	// Helm charts pushed to the temporary registry at registryAddress, which is only set for the
+	// registry layout. cfg is the config of the images in the bundle.
+	BeforeArchive func(bundleDir, registryAddress string, cfg config.ImagesConfig) error
+}
+
+// Result summarizes a created image bundle.
+type Result struct {
+	TotalImages  int
+	FailedImages []ImageError
+	Warnings     []warnings.Warning
+}
+
+// Create creates an image bundle. The result is returned even if an error is returned because
+// images failed to be pulled with FailOnAnyError set. Creating the bundle stops and cleans up once
+// ctx is done.
+func Create(ctx context.Context, out output.Output, opts Options) (_ *Result, err error) {
+	if opts.Update && opts.SplitSize > 0 {
+		return nil, errors.New("bundles cannot be split into parts when updating them")
+	}
+
+	if !opts.Overwrite && !opts.DryRun && !opts.Update {
+		out.StartOperation("Checking if output file already exists")
+		_, err := os.Stat(opts.OutputFile)
+		switch {
+		case err == nil:
+			out.EndOperationWithStatus(output.Failure())
+			return nil, fmt.Errorf(
+				"%s already exists: specify --overwrite to overwrite existing file",
+				opts.OutputFile,
+			)
+		case !errors.Is(err, os.ErrNotExist):
+			out.EndOperationWithStatus(output.Failure())
+			return nil, fmt.Errorf(
+				"failed to check if output file %s already exists: %w",
+				opts.OutputFile,
+				err,
+			)
+		default:
+			out.EndOperationWithStatus(output.Success())
+		}
+	}
+
+	warningsCollector := warnings.NewCollector(opts.Strict)
+
+	var cfg config.ImagesConfig
+	if opts.ImagesConfig != nil {
+		cfg = *opts.ImagesConfig
+	} else {
+		out.StartOperation("Parsing image bundle config")
+		cfg, err = config.ParseImagesConfigFileWithWarnings(opts.ConfigFile, warningsCollector)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, err
+		}
+		out.EndOperationWithStatus(output.Success())
+	}
+	out.V(4).Infof("Images config: %+v", cfg)
+
+	cleaner := cleanup.NewCleaner()
+	defer cleaner.Cleanup()
+
+	var existing *existingBundle
+	if opts.Update {
+		out.StartOperation(fmt.Sprintf("Reading existing image bundle %s", opts.OutputFile))
+		metadataDir, err := os.MkdirTemp("", ".image-bundle-metadata-*")
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		cleaner.AddCleanupFn(func() { _ = os.RemoveAll(metadataDir) })
+		existing, err = openExistingBundle(opts.OutputFile, metadataDir)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, err
+		}
+		out.EndOperationWithStatus(output.Success())
+
+		opts.Layout = existing.layout
+		requested := cfg.TotalImages()
+		cfg = existing.newImages(cfg)
+		if cfg.TotalImages() == 0 {
+			out.Infof("All %d images are already in the bundle, nothing to update", requested)
+			return &Result{}, nil
+		}
+		out.Infof("Adding %d of %d images that are not in the bundle yet", cfg.TotalImages(), requested)
+	}
+
+	if err := checkDestinationPlatforms(
+		out, opts.Platforms, opts.DestinationPlatforms, warningsCollector,
+	); err != nil {
+		return nil, err
+	}
+
+	if opts.IncludeNotationSignatures && opts.Layout == OCILayout {
+		return nil, errors.New("bundling Notation signatures requires the registry layout")
+	}
+
+	annotators, err := newImageAnnotators(cfg, opts.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	localImageAnnotator, err := images.NewAnnotator(opts.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	if opts.IncludeNotationSignatures && (!annotators.empty() || localImageAnnotator != nil) {
+		return nil, errors.New(
+			"bundling Notation signatures is not supported with annotations, which change the digests of " +
+				"the signed images",
+		)
+	}
+
+	if err := opts.RateLimits.validate(); err != nil {
+		return nil, err
+	}
+
+	scanner, err := newImageScanner(opts.Scan)
+	if err != nil {
+		return nil, err
+	}
+
+	var cosign *signing.Cosign
+	if opts.SignKey != "" && !opts.DryRun {
+		if cosign, err = signing.NewCosign(); err != nil {
+			return nil, err
+		}
+	}
+
+	var repoRewriteRules *config.RepoRewriteRules
+	switch {
+	case opts.RepoRewriteRulesFile != "":
+		out.StartOperation("Parsing repository rewrite rules")
+		rules, err := config.ParseRepoRewriteRulesFile(opts.RepoRewriteRulesFile)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, err
+		}
+		repoRewriteRules = &rules
+		out.EndOperationWithStatus(output.Success())
+	case existing != nil && existing.hasRepoRewrites:
+		return nil, errors.New(
+			"repository rewrite rules were applied to the existing bundle: specify --repo-rewrite-rules " +
+				"to apply them to the added images",
+		)
+	}
+
+	var verifier *notation.Verifier
+	if opts.NotationTrustPolicyFile != "" {
+		out.StartOperation("Parsing Notation trust policy")
+		trustPolicy, err := notation.ParseTrustPolicyFile(opts.NotationTrustPolicyFile)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, err
+		}
+		verifier = notation.NewVerifier(trustPolicy, opts.NotationTrustStoreDir)
+		out.EndOperationWithStatus(output.Success())
+	}
+
+	var signaturePolicy *signing.Policy
+	if opts.SignaturePolicyFile != "" {
+		out.StartOperation("Parsing signature policy")
+		signaturePolicy, err = signing.ParsePolicyFile(opts.SignaturePolicyFile)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, err
+		}
+		out.EndOperationWithStatus(output.Success())
+	}
+
+	localImages := make([]images.LocalImage, 0, len(opts.LocalImages))
+	for _, n := range opts.LocalImages {
+		localImage, err := images.ParseLocalImage(n)
+		if err != nil {
+			return nil, err
+		}
+		localImages = append(localImages, localImage)
+	}
+
+	defaultKeychain, err := authnhelpers.NewKeychain(opts.RegistryAuthFile)
+	if err != nil {
+		return nil, err
+	}
+	defaultKeychain, err = opts.Credentials.Keychain(defaultKeychain)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun || opts.MaxBundleSize > 0 || cfg.HasImageMaxSizes() {
+		if err := checkBundleSize(
+			ctx, out, cfg, opts, len(localImages), defaultKeychain, warningsCollector,
+		); err != nil {
+			return nil, err
+		}
+		if opts.DryRun {
+			return &Result{
+				TotalImages: cfg.TotalImages() + len(localImages),
+				Warnings:    warningsCollector.Warnings(),
+			}, nil
+		}
+	}
+
+	var (
+		tempDir string
+		state   *resumeState
+	)
+	if opts.ResumeFromDir != "" {
+		out.StartOperation("Loading progress from resume directory")
+		tempDir = opts.ResumeFromDir
+		if err := os.MkdirAll(tempDir, 0o755); err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, fmt.Errorf("failed to create resume directory: %w", err)
+		}
+		state, err = loadResumeState(tempDir, opts.Layout)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, err
+		}
+		out.EndOperationWithStatus(output.Success())
+		if n := len(state.CompletedImages); n > 0 {
+			out.Infof("Resuming, skipping %d images that have already been pulled", n)
+		}
+	} else {
+		out.StartOperation("Creating temporary directory")
+		outputFileAbs, err := filepath.Abs(opts.OutputFile)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, fmt.Errorf(
+				"failed to determine where to create temporary directory: %w",
+				err,
+			)
+		}
+
+		tempDir, err = os.MkdirTemp(filepath.Dir(outputFileAbs), ".image-bundle-*")
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		cleaner.AddCleanupFn(func() { _ = os.RemoveAll(tempDir) })
+
+		out.EndOperationWithStatus(output.Success())
+	}
+
+	reporter := opts.Reporter
+	if reporter == nil {
+		reporter = progress.NewReporter(progress.Human, nil)
+	}
+
+	var (
+		writer          imageWriter
+		registryAddress string
+	)
+	switch opts.Layout {
+	case OCILayout:
+		out.StartOperation("Creating OCI layout")
+		writer, err = newOCILayoutImageWriter(tempDir, opts.IncludeNonDistributable)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, err
+		}
+		out.EndOperationWithStatus(output.Success())
+	default:
+		out.StartOperation("Starting temporary Docker registry")
+		reg, err := registry.NewRegistry(registry.Config{
+			StorageDirectory: tempDir,
+			Host:             opts.ListenAddress,
+			Port:             opts.ListenPortRange.First,
+			MaxPort:          opts.ListenPortRange.Last,
+		})
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, fmt.Errorf("failed to create local Docker registry: %w", err)
+		}
+		regCtx, stopReg := context.WithCancel(ctx)
+		regErrCh, err := reg.Start(regCtx)
+		if err != nil {
+			stopReg()
+			out.EndOperationWithStatus(output.Failure())
+			return nil, fmt.Errorf("failed to start local Docker registry: %w", err)
+		}
+		// Wait for the registry to stop before its storage is cleaned up.
+		defer func() {
+			stopReg()
+			for regErr := range regErrCh {
+				err = errors.Join(err, regErr)
+			}
+		}()
+		out.EndOperationWithStatus(output.Success())
+
+		registryAddress = reg.Address()
+		writer = registryImageWriter{address: registryAddress, blobs: images.NewBlobLocations()}
+		out.V(2).Infof("Temporary Docker registry listening on %s", registryAddress)
+		reporter.RegistryListening(registryAddress)
+	}
+
+	logs.Debug.SetOutput(out.V(4).InfoWriter())
+	logs.Warn.SetOutput(out.V(2).InfoWriter())
+
+	// Sort registries for deterministic ordering.
+	regNames := cfg.SortedRegistryNames()
+
+	failures := &errorReport{}
+
+	var blobCache cache.Cache
+	if opts.BlobCacheDir != "" {
+		blobCache = images.NewBlobCache(opts.BlobCacheDir)
+	}
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(opts.ImagePullConcurrency)
+
+	pullGauge := &output.ProgressGauge{}
+	totalImages := cfg.TotalImages() + len(localImages)
+	pullGauge.SetCapacity(totalImages)
+	pullGauge.SetStatus("Pulling requested images")
+
+	destTLSRoundTripper, err := httputils.LocalRegistryRoundTripper(remote.DefaultTransport)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring TLS for destination registry: %w", err)
+	}
+	defer func() {
+		if tr, ok := destTLSRoundTripper.(*http.Transport); ok {
+			tr.CloseIdleConnections()
+		}
+	}()
+	destRemoteOpts := []remote.Option{
+		remote.WithTransport(destTLSRoundTripper),
+		remote.WithContext(egCtx),
+		remote.WithUserAgent(utils.Useragent()),
+	}
+	if opts.IncludeNonDistributable {
+		destRemoteOpts = append(destRemoteOpts, remote.WithNondistributable)
+	}
+
+	digestAlgorithms := &digestAlgorithmsCopy{
+		writer:                  writer,
+		destTransport:           destTLSRoundTripper,
+		includeNonDistributable: opts.IncludeNonDistributable,
+	}
+	if signaturePolicy != nil {
+		digestAlgorithms.unsupported = append(digestAlgorithms.unsupported, "--policy-file")
+	}
+	if verifier != nil {
+		digestAlgorithms.unsupported = append(digestAlgorithms.unsupported, "--notation-trust-policy")
+	}
+	if opts.IncludeNotationSignatures {
+		digestAlgorithms.unsupported = append(digestAlgorithms.unsupported, "--include-notation-signatures")
+	}
+	if scanner != nil {
+		digestAlgorithms.unsupported = append(digestAlgorithms.unsupported, "--scan")
+	}
+	if !annotators.empty() {
+		digestAlgorithms.unsupported = append(digestAlgorithms.unsupported, "annotations")
+	}
+
+	endPullPhase := opts.Metrics.StartPhase("pull-images")
+	out.StartOperationWithProgress(pullGauge)
+
+	sharedRateLimiter := opts.RateLimits.sharedRateLimiter()
+
+	for registryIdx := range regNames {
+		registryName := regNames[registryIdx]
+
+		registryConfig := cfg[registryName]
+
+		sourceTLSRoundTripper, sourceRemoteOpts, err := sourceRemoteOptions(
+			registryName,
+			registryConfig,
+			defaultKeychain,
+			opts.ClockSkewTolerance,
+			sharedRateLimiter.WithLimits(registryConfig.MaxRequestsPerSecond, registryConfig.MaxBandwidth),
+		)
+		if err != nil {
+			// Wait for images from previous registries so that they do not write to the removed
+			// temporary directory.
+			_ = eg.Wait()
+			out.EndOperationWithStatus(output.Failure())
+			return nil, err
+		}
+		sourceRemoteOpts = withRemoteOptions(sourceRemoteOpts, remote.WithContext(egCtx))
+
+		// Sort images for deterministic ordering.
+		imageNames := registryConfig.SortedImageNames()
+
+		wg := new(sync.WaitGroup)
+
+		for imageIdx := range imageNames {
+			imageName := imageNames[imageIdx]
+			imageTags := registryConfig.Images[imageName]
+
+			wg.Add(len(imageTags))
+			for j := range imageTags {
+				imageTag := imageTags[j]
+
+				eg.Go(func() error {
+					defer wg.Done()
+
+					srcImageName := fmt.Sprintf(
+						"%s/%s:%s",
+						registryName,
+						imageName,
+						imageTag,
+					)
+					destImageName := writer.destination(registryName, imageName, imageTag)
+					platforms := registryConfig.PlatformsForImage(
+						imageName,
+						opts.Platforms,
+						opts.PlatformsRequested,
+					)
+
+					if state.completed(srcImageName, platforms) {
+						reporter.ImageSkipped(srcImageName, destImageName)
+						pullGauge.Inc()
+						return nil
+					}
+
+					reporter.ImageStarted(srcImageName, destImageName)
+
+					var digest v1.Hash
+					err := pullWithRetries(
+						egCtx,
+						srcImageName,
+						sourceTLSRoundTripper,
+						opts,
+						warningsCollector,
+						func(ctx context.Context, transport http.RoundTripper, w *warnings.Collector) error {
+							srcRemoteOpts := withRemoteOptions(
+								sourceRemoteOpts,
+								remote.WithTransport(transport),
+								remote.WithContext(ctx),
+							)
+							imageIndex, artifact, srcDigest, err := images.ImageOrArtifactForImage(
+								srcImageName,
+								platforms,
+								registryConfig.ImageArtifacts[imageName],
+								w,
+								srcRemoteOpts...,
+							)
+							if errors.Is(err, images.ErrUnsupportedDigestAlgorithm) {
+								digest, err = digestAlgorithms.copy(
+									ctx,
+									err,
+									transport,
+									sourceKeychain(registryName, registryConfig, defaultKeychain),
+									registryName,
+									imageName,
+									imageTag,
+									platforms,
+									w,
+								)
+								return err
+							}
+							if err != nil {
+								return err
+							}
+							if err := verifySignaturePolicy(
+								signaturePolicy,
+								srcImageName,
+								srcDigest,
+								srcRemoteOpts...,
+							); err != nil {
+								return err
+							}
+							if artifact != nil {
+								digest, err = writeArtifact(
+									writer,
+									registryName,
+									imageName,
+									imageTag,
+									srcImageName,
+									artifact,
+									verifier,
+									blobCache,
+									reporter,
+									withRemoteOptions(destRemoteOpts, remote.WithContext(ctx))...,
+								)
+								return err
+							}
+							if err := warnIfDeprecated(srcImageName, imageIndex, w); err != nil {
+								return err
+							}
+							if err := verifyNotationSignatures(
+								verifier,
+								srcImageName,
+								srcDigest,
+								fmt.Sprintf("%s/%s", registryName, imageName),
+								imageIndex,
+								w,
+								srcRemoteOpts...,
+							); err != nil {
+								return err
+							}
+							if err := scanner.scan(
+								ctx,
+								srcImageName,
+								fmt.Sprintf("%s/%s", registryName, imageName),
+								imageIndex,
+								registryConfig,
+								w,
+							); err != nil {
+								return err
+							}
+							if blobCache != nil {
+								imageIndex = cache.ImageIndex(imageIndex, blobCache)
+							}
+							imageIndex, err = annotators.forImage(registryName, imageName).AnnotateIndex(
+								imageIndex,
+								srcImageName,
+							)
+							if err != nil {
+								return err
+							}
+
+							if err := writer.write(
+								registryName,
+								imageName,
+								imageTag,
+								imageIndex,
+								reporter,
+								withRemoteOptions(destRemoteOpts, remote.WithContext(ctx))...,
+							); err != nil {
+								return err
+							}
+							if opts.IncludeNotationSignatures {
+								if err := bundleNotationSignatures(
+									srcImageName,
+									srcDigest,
+									imageIndex,
+									destImageName,
+									w,
+									srcRemoteOpts,
+									withRemoteOptions(destRemoteOpts, remote.WithContext(ctx)),
+								); err != nil {
+									return err
+								}
+							}
+
+							digest, err = imageIndex.Digest()
+							return err
+						},
+					)
+					if err == nil {
+						err = state.markCompleted(srcImageName, digest.String(), platforms)
+					}
+					if err != nil {
+						reporter.ImageFailed(srcImageName, destImageName, err)
+						if opts.OnError == Continue {
+							failures.add(registryName, imageName, imageTag, err)
+							pullGauge.Inc()
+							return nil
+						}
+						return err
+					}
+
+					reporter.ImageCompleted(srcImageName, destImageName)
+					pullGauge.Inc()
+
+					return nil
+				})
+			}
+		}
+
+		go func() {
+			wg.Wait()
+
+			if tr, ok := sourceTLSRoundTripper.(interface{ CloseIdleConnections() }); ok {
+				tr.CloseIdleConnections()
+			}
+		}()
+	}
+
+	for i := range localImages {
+		localImage := localImages[i]
+
+		eg.Go(func() error {
+			srcImageName := localImage.String()
+			destImageName := writer.destination(
+				localImage.Registry(),
+				localImage.Repository(),
+				localImage.Name.Tag(),
+			)
+
+			reporter.ImageStarted(srcImageName, destImageName)
+
+			err := func() error {
+				scratchDir, err := os.MkdirTemp("", ".local-image-*")
+				if err != nil {
+					return fmt.Errorf("failed to create temporary directory: %w", err)
+				}
+				defer os.RemoveAll(scratchDir)
+
+				imageIndex, err := images.ManifestListForLocalImage(
+					egCtx,
+					localImage,
+					opts.Platforms,
+					warningsCollector,
+					images.LocalImageOptions{
+						ContainerdNamespace: opts.ContainerdNamespace,
+						ScratchDir:          scratchDir,
+					},
+				)
+				if err != nil {
+					return err
+				}
+				imageIndex, err = localImageAnnotator.AnnotateIndex(imageIndex, srcImageName)
+				if err != nil {
+					return err
+				}
+
+				return writer.write(
+					localImage.Registry(),
+					localImage.Repository(),
+					localImage.Name.Tag(),
+					imageIndex,
+					reporter,
+					destRemoteOpts...,
+				)
+			}()
+			if err != nil {
+				reporter.ImageFailed(srcImageName, destImageName, err)
+				if opts.OnError == Continue {
+					failures.add(
+						localImage.Registry(),
+						localImage.Repository(),
+						localImage.Name.Tag(),
+						err,
+					)
+					pullGauge.Inc()
+					return nil
+				}
+				return err
+			}
+
+			reporter.ImageCompleted(srcImageName, destImageName)
+			pullGauge.Inc()
+
+			return nil
+		})
+	}
+
+	err = eg.Wait()
+	endPullPhase()
+	if err != nil {
+		out.EndOperationWithStatus(output.Failure())
+		return nil, err
+	}
+
+	out.EndOperationWithStatus(output.Success())
+
+	if opts.RequireAllPlatforms {
+		if err := requireAllPlatforms(warningsCollector); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, localImage := range localImages {
+		cfg.AddImage(localImage.Registry(), localImage.Repository(), localImage.Name.Tag())
+	}
+
+	failedImages := failures.sorted()
+	failures.removeFailedImages(cfg)
+
+	if existing != nil {
+		if cfg, err = existing.writeMetadata(tempDir, opts.OutputFile, cfg); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := config.WriteSanitizedImagesConfig(cfg, filepath.Join(tempDir, "images.yaml")); err != nil {
+			return nil, err
+		}
+		if err := utils.WriteBundleInstructions(tempDir, opts.OutputFile, &cfg, nil); err != nil {
+			return nil, err
+		}
+	}
+	var chartsCfg *config.HelmChartsConfig
+	if existing != nil {
+		chartsCfg = existing.chartsCfg
+	}
+	if err := utils.WriteBundleMetadata(
+		tempDir, utils.NewBundleMetadata(bundleLayouts[opts.Layout][0], &cfg, chartsCfg),
+	); err != nil {
+		return nil, err
+	}
+	if repoRewriteRules != nil {
+		if err := config.WriteRepoRewritesFile(
+			repoRewriteRules.RewritesFor(cfg), filepath.Join(tempDir, utils.RepoRewritesFileName),
+		); err != nil {
+			return nil, err
+		}
+	}
+	if opts.NotationTrustPolicyFile != "" {
+		if err := utils.WriteNotationTrustPolicy(
+			tempDir, opts.NotationTrustPolicyFile, opts.NotationTrustStoreDir,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.BeforeArchive != nil {
+		if err := opts.BeforeArchive(tempDir, registryAddress, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	endArchivePhase := opts.Metrics.StartPhase("archive")
+	if existing != nil {
+		out.StartOperation(fmt.Sprintf("Appending new images to %s", opts.OutputFile))
+		err = existing.append(tempDir)
+	} else {
+		out.StartOperation(fmt.Sprintf("Archiving images to %s", opts.OutputFile))
+		// Remove files from the temporary directory as they are archived, so that creating the
+		// bundle does not require twice the disk space of the bundle contents. Resume directories
+		// are kept along with the resume state until the bundle has been written, so that the run
+		// can still be resumed if archiving fails. The resume state is never included in the bundle.
+		err = archive.ArchiveDirectoryWithOptions(tempDir, opts.OutputFile, archive.Options{
+			Compression:         opts.Compression,
+			CompressionLevel:    opts.CompressionLevel,
+			SplitSize:           opts.SplitSize,
+			RemoveArchivedFiles: state == nil,
+			Exclude:             state.excluded,
+			Context:             ctx,
+		})
+	}
+	endArchivePhase()
+	if err != nil {
+		out.EndOperationWithStatus(output.Failure())
+		return nil, fmt.Errorf("failed to create image bundle tarball: %w", err)
+	}
+	out.EndOperationWithStatus(output.Success())
+	if size, err := archive.Size(opts.OutputFile); err == nil {
+		opts.Metrics.AddSize("bundle", size)
+	}
+
+	signatureFile := signing.SignatureFile(opts.OutputFile)
+	if cosign != nil {
+		out.StartOperation(fmt.Sprintf("Signing %s", opts.OutputFile))
+		if err := cosign.SignBlob(ctx, opts.OutputFile, opts.SignKey); err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, err
+		}
+		out.EndOperationWithStatus(output.Success())
+	} else if _, err := os.Stat(signatureFile); err == nil && existing != nil {
+		out.Warnf(
+			"WARNING: signature %s is no longer valid for the updated bundle, specify --sign-key to sign it again",
+			signatureFile,
+		)
+	}
+	if opts.ResumeFromDir != "" {
+		_ = os.RemoveAll(opts.ResumeFromDir)
+	}
+
+	if summary := warningsCollector.Summary(); summary != "" {
+		for _, w := range warningsCollector.Warnings() {
+			out.Warn(w.String())
+		}
+		out.Warnf("Image bundle created with %s, specify --strict to treat warnings as errors", summary)
+	}
+
+	if opts.ErrorReportFile != "" {
+		if err := failures.writeFile(opts.ErrorReportFile, totalImages); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &Result{
+		TotalImages:  totalImages,
+		FailedImages: failures.imageErrors(),
+		Warnings:     warningsCollector.Warnings(),
+	}
+	opts.Metrics.AddCount("images", result.TotalImages)
+	opts.Metrics.AddCount("failed-images", len(result.FailedImages))
+	opts.Metrics.AddCount("warnings", len(result.Warnings))
+
+	if len(failedImages) > 0 {
+		for _, f := range failedImages {
+			out.Errorf(f.err, "Failed to pull %s", f)
+		}
+		failedMsg := fmt.Sprintf(
+			"%d of %d images failed and were skipped", len(failedImages), totalImages,
+		)
+		if opts.FailOnAnyError {
+			return result, errors.New(failedMsg)
+		}
+		out.Warn(failedMsg)
+	}
+
+	return result, nil
+}
+
+// requireAllPlatforms returns an error listing every image and requested platform that is missing
+// from the bundle.
+func requireAllPlatforms(w *warnings.Collector) error {
+	var missing []string
+	for _, warning := range w.Warnings() {
+		if warning.Kind == warnings.MissingPlatform {
+			missing = append(missing, "  "+warning.Message)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf(
+		"%d requested platforms are missing from images (--require-all-platforms):\n%s",
+		len(missing),
+		strings.Join(missing, "\n"),
+	)
+}
+
+// sourceRemoteOptions returns the transport and remote options to read images from the source
+// registry with, authenticating with the credentials configured for the registry, falling back to
+// the default keychain, within the limits of the rate limiter.
+func sourceRemoteOptions(
+	registryName string,
+	registryConfig config.RegistrySyncConfig,
+	defaultKeychain authn.Keychain,
+	clockSkewTolerance time.Duration,
+	rateLimiter *httputils.RateLimiter,
+) (http.RoundTripper, []remote.Option, error) {
+	sourceTransport := remote.DefaultTransport
+	if registryConfig.Proxy != "" {
+		proxy, err := config.ParseProxy(registryConfig.Proxy)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error configuring proxy for source registry: %w", err)
+		}
+		sourceTransport = httputils.ProxiedRoundTripper(sourceTransport, proxy)
+	}
+
+	sourceTLSRoundTripper, err := httputils.TLSConfiguredRoundTripper(
+		sourceTransport,
+		registryName,
+		registryConfig.TLSVerify != nil && !*registryConfig.TLSVerify,
+		"",
+		clockSkewTolerance,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error configuring TLS for source registry: %w", err)
+	}
+
+	sourceRoundTripper := rateLimiter.RoundTripper(sourceTLSRoundTripper)
+
+	return sourceRoundTripper, []remote.Option{
+		remote.WithTransport(sourceRoundTripper),
+		remote.WithAuthFromKeychain(sourceKeychain(registryName, registryConfig, defaultKeychain)),
+		remote.WithUserAgent(utils.Useragent()),
+	}, nil
+}
+
+// withRemoteOptions returns a copy of opts with the further options appended, so that images pulled
+// concurrently never append their options to the same backing array.
+func withRemoteOptions(opts []remote.Option, further ...remote.Option) []remote.Option {
+	return append(opts[:len(opts):len(opts)], further...)
+}
+
+// sourceKeychain returns the keychain for the source registry, preferring the credentials
+// configured in the images config file over defaultKeychain.
+func sourceKeychain(
+	registryName string,
+	registryConfig config.RegistrySyncConfig,
+	defaultKeychain authn.Keychain,
+) authn.Keychain {
+	return authn.NewMultiKeychain(
+		authn.NewKeychainFromHelper(
+			authnhelpers.NewStaticHelper(registryName, registryConfig.Credentials),
+		),
+		defaultKeychain,
+	)
+}
@@ -0,0 +1,113 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/signing"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+func TestRequireAllPlatforms(t *testing.T) {
+	t.Parallel()
+
+	w := warnings.NewCollector(false)
+	require.NoError(t, w.Warnf(warnings.Normalization, "image name %q normalized", "nginx"))
+	require.NoError(t, requireAllPlatforms(w))
+
+	require.NoError(t, w.Warnf(
+		warnings.MissingPlatform, "image %q does not provide requested platform %q", "quay.io/app:v1", "linux/arm64",
+	))
+	require.NoError(t, w.Warnf(
+		warnings.MissingPlatform, "image %q does not provide requested platform %q", "docker.io/nginx:1", "linux/arm64",
+	))
+	require.EqualError(t, requireAllPlatforms(w), `2 requested platforms are missing from images (--require-all-platforms):
+  image "docker.io/nginx:1" does not provide requested platform "linux/arm64"
+  image "quay.io/app:v1" does not provide requested platform "linux/arm64"`)
+}
+
+func TestCreateConcurrentPulls(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(registry.New())
+	t.Cleanup(srv.Close)
+	reg := strings.TrimPrefix(srv.URL, "http://")
+
+	tags := []string{"v1", "v2", "v3", "v4", "v5", "v6"}
+	for _, tag := range tags {
+		img, err := random.Image(128, 2)
+		require.NoError(t, err)
+		ref, err := name.ParseReference(reg + "/library/image:" + tag)
+		require.NoError(t, err)
+		require.NoError(t, remote.Write(ref, img))
+	}
+
+	// Images are pulled concurrently with options appended to the shared remote options of their
+	// registry, which must not race, see go test -race.
+	outputFile := filepath.Join(t.TempDir(), "images.tar")
+	result, err := Create(context.Background(), output.NewDiscardingOutput(), Options{
+		OutputFile: outputFile,
+		ImagesConfig: &config.ImagesConfig{
+			reg: {
+				Images: map[string][]string{"library/image": tags},
+				Proxy:  config.DirectProxy,
+			},
+		},
+		ImagePullConcurrency:    len(tags),
+		IncludeNonDistributable: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, len(tags), result.TotalImages)
+	assert.Empty(t, result.FailedImages)
+	assert.FileExists(t, outputFile)
+}
+
+func TestCreateSignaturePolicy(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(registry.New())
+	t.Cleanup(srv.Close)
+	reg := strings.TrimPrefix(srv.URL, "http://")
+
+	img, err := random.Image(128, 1)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(reg + "/library/image:v1")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(policyFile, []byte(fmt.Sprintf(`{
+  "default": [{"type": "insecureAcceptAnything"}],
+  "transports": {"docker": {%q: [{"type": "reject"}]}}
+}`, reg+"/library")), 0o600))
+
+	_, err = Create(context.Background(), output.NewDiscardingOutput(), Options{
+		OutputFile: filepath.Join(t.TempDir(), "images.tar"),
+		ImagesConfig: &config.ImagesConfig{
+			reg: {
+				Images: map[string][]string{"library/image": {"v1"}},
+				Proxy:  config.DirectProxy,
+			},
+		},
+		ImagePullConcurrency: 1,
+		SignaturePolicyFile:  policyFile,
+	})
+	require.ErrorIs(t, err, signing.ErrRejected)
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+// deprecationKeys are the labels and annotations that mark images as deprecated, either with a
+// boolean value or with a message, e.g. pointing at the image that replaces it.
+var deprecationKeys = []string{
+	// Artifact Hub marks deprecated packages with this annotation.
+	"io.artifacthub.package.deprecated",
+	"org.opencontainers.image.deprecated",
+	"deprecated",
+}
+
+// deprecation returns the key and value of the first deprecation label or annotation that marks
+// the image as deprecated.
+func deprecation(metadata map[string]string) (key, value string, ok bool) {
+	for _, k := range deprecationKeys {
+		v := strings.TrimSpace(metadata[k])
+		if v == "" {
+			continue
+		}
+		if deprecated, err := strconv.ParseBool(v); err == nil && !deprecated {
+			continue
+		}
+		return k, v, true
+	}
+	return "", "", false
+}
+
+// warnIfDeprecated records a warning if the image index, any of its manifests or the config of any
+// of its images marks the image as deprecated.
+func warnIfDeprecated(srcImageName string, index v1.ImageIndex, w *warnings.Collector) error {
+	key, value, found, err := indexDeprecation(index)
+	if err != nil {
+		return fmt.Errorf("failed to check if image %q is deprecated: %w", srcImageName, err)
+	}
+	if !found {
+		return nil
+	}
+	return w.Warnf(warnings.Deprecated, "image %q is marked as deprecated (%s=%s)", srcImageName, key, value)
+}
+
+func indexDeprecation(index v1.ImageIndex) (key, value string, found bool, err error) {
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return "", "", false, err
+	}
+	if key, value, found := deprecation(indexManifest.Annotations); found {
+		return key, value, true, nil
+	}
+
+	for _, desc := range indexManifest.Manifests {
+		if key, value, found := deprecation(desc.Annotations); found {
+			return key, value, true, nil
+		}
+
+		switch {
+		case desc.MediaType.IsIndex():
+			childIndex, err := index.ImageIndex(desc.Digest)
+			if err != nil {
+				return "", "", false, err
+			}
+			if key, value, found, err := indexDeprecation(childIndex); err != nil || found {
+				return key, value, found, err
+			}
+		case desc.MediaType.IsImage():
+			img, err := index.Image(desc.Digest)
+			if err != nil {
+				return "", "", false, err
+			}
+			manifest, err := img.Manifest()
+			if err != nil {
+				return "", "", false, err
+			}
+			if key, value, found := deprecation(manifest.Annotations); found {
+				return key, value, true, nil
+			}
+			cfg, err := img.ConfigFile()
+			if err != nil {
+				return "", "", false, err
+			}
+			if key, value, found := deprecation(cfg.Config.Labels); found {
+				return key, value, true, nil
+			}
+		}
+	}
+	return "", "", false, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+func TestWarnIfDeprecated(t *testing.T) {
+	t.Parallel()
+
+	img, err := random.Image(128, 1)
+	require.NoError(t, err)
+	labeled, err := mutate.Config(img, v1.Config{
+		Labels: map[string]string{"deprecated": "use example.com/new-image instead"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		index v1.ImageIndex
+		want  []warnings.Warning
+	}{{
+		name:  "not deprecated",
+		index: mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img}),
+	}, {
+		name: "deprecated set to false",
+		index: mutate.Annotations(
+			mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img}),
+			map[string]string{"io.artifacthub.package.deprecated": "false"},
+		).(v1.ImageIndex),
+	}, {
+		name: "index annotation",
+		index: mutate.Annotations(
+			mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img}),
+			map[string]string{"io.artifacthub.package.deprecated": "true"},
+		).(v1.ImageIndex),
+		want: []warnings.Warning{{
+			Kind:    warnings.Deprecated,
+			Message: `image "example.com/image:v1" is marked as deprecated (io.artifacthub.package.deprecated=true)`,
+		}},
+	}, {
+		name: "image manifest annotation",
+		index: mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+			Add: mutate.Annotations(img, map[string]string{"org.opencontainers.image.deprecated": "true"}).(v1.Image),
+		}),
+		want: []warnings.Warning{{
+			Kind:    warnings.Deprecated,
+			Message: `image "example.com/image:v1" is marked as deprecated (org.opencontainers.image.deprecated=true)`,
+		}},
+	}, {
+		name:  "config label",
+		index: mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: labeled}),
+		want: []warnings.Warning{{
+			Kind: warnings.Deprecated,
+			Message: `image "example.com/image:v1" is marked as deprecated ` +
+				`(deprecated=use example.com/new-image instead)`,
+		}},
+	}}
+	for ti := range tests {
+		tt := tests[ti]
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			w := warnings.NewCollector(false)
+			require.NoError(t, warnIfDeprecated("example.com/image:v1", tt.index, w))
+			assert.ElementsMatch(t, tt.want, w.Warnings())
+		})
+	}
+}
+
+func TestWarnIfDeprecatedStrict(t *testing.T) {
+	t.Parallel()
+
+	img, err := random.Image(128, 1)
+	require.NoError(t, err)
+	index := mutate.Annotations(
+		mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img}),
+		map[string]string{"deprecated": "true"},
+	).(v1.ImageIndex)
+
+	var warningErr *warnings.Error
+	require.ErrorAs(t, warnIfDeprecated("example.com/image:v1", index, warnings.NewCollector(true)), &warningErr)
+	assert.Equal(t, warnings.Deprecated, warningErr.Warning.Kind)
+}
@@ -0,0 +1,152 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/nodeimport"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+// DestinationPlatformOptions configures how the platforms of the destination of a bundle, e.g. the
+// nodes of the cluster the images will run on, are determined.
+type DestinationPlatformOptions struct {
+	// Platforms are the platforms of the destination specified explicitly.
+	Platforms []platform.Platform
+	// FromCluster discovers the platforms of the nodes of the cluster of Kubeconfig and Context.
+	FromCluster bool
+	Kubeconfig  string
+	Context     string
+}
+
+func AddDestinationPlatformFlags(fs *pflag.FlagSet, opts *DestinationPlatformOptions) {
+	fs.Var(flags.NewPlatformsValue(nil, &opts.Platforms), "destination-platform",
+		"platforms of the destination the images will run on, checked against the requested platforms "+
+			"(required format: <os>/<arch>[/<variant>][:<os.version>])")
+	fs.BoolVar(&opts.FromCluster, "platform-from-cluster", false,
+		"Discover the platforms of the destination from the nodes of the cluster of the kubeconfig")
+	fs.StringVar(&opts.Kubeconfig, "kubeconfig", "",
+		"Path to the kubeconfig file for --platform-from-cluster (defaults to the KUBECONFIG environment "+
+			"variable or ~/.kube/config)")
+	fs.StringVar(&opts.Context, "context", "", "Kubeconfig context to use for --platform-from-cluster")
+}
+
+// Resolve returns the platforms of the destination, discovering them from the cluster nodes if
+// requested.
+func (o DestinationPlatformOptions) Resolve(
+	ctx context.Context,
+	out output.Output,
+) ([]platform.Platform, error) {
+	destPlatforms := append([]platform.Platform{}, o.Platforms...)
+	if o.FromCluster {
+		out.StartOperation("Discovering platforms of cluster nodes")
+		restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{
+				ExplicitPath: o.Kubeconfig,
+				Precedence:   clientcmd.NewDefaultClientConfigLoadingRules().Precedence,
+			},
+			&clientcmd.ConfigOverrides{CurrentContext: o.Context},
+		).ClientConfig()
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+		}
+		clientset, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+		}
+		nodes, err := nodeimport.ClusterNodes(ctx, clientset)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, err
+		}
+		for _, n := range nodes {
+			destPlatforms = append(destPlatforms, n.Platform)
+		}
+		out.EndOperationWithStatus(output.Success())
+	}
+
+	return uniquePlatforms(destPlatforms), nil
+}
+
+func uniquePlatforms(platforms []platform.Platform) []platform.Platform {
+	seen := make(map[platform.Platform]struct{}, len(platforms))
+	unique := make([]platform.Platform, 0, len(platforms))
+	for _, p := range platforms {
+		p = p.Normalized()
+		if _, ok := seen[p]; ok {
+			continue
+		}
+		seen[p] = struct{}{}
+		unique = append(unique, p)
+	}
+	return unique
+}
+
+// missingDestinationPlatforms returns the destination platforms that are not satisfied by any of the
+// requested platforms. No platforms are missing if all platforms are requested.
+func missingDestinationPlatforms(requested, destination []platform.Platform) []platform.Platform {
+	if len(requested) == 0 {
+		return nil
+	}
+	var missing []platform.Platform
+	for _, d := range destination {
+		found := false
+		for _, r := range requested {
+			if r.Matches(d.ToV1()) || d.Matches(r.ToV1()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, d)
+		}
+	}
+	return missing
+}
+
+// checkDestinationPlatforms warns loudly if platforms of the destination are not requested, e.g. when
+// bundling linux/amd64 images for arm64 nodes, returning an error in strict mode.
+func checkDestinationPlatforms(
+	out output.Output,
+	requested, destination []platform.Platform,
+	w *warnings.Collector,
+) error {
+	missing := missingDestinationPlatforms(requested, destination)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	missingStrs := make([]string, 0, len(missing))
+	for _, p := range missing {
+		missingStrs = append(missingStrs, p.String())
+	}
+	requestedStrs := make([]string, 0, len(requested))
+	for _, p := range requested {
+		requestedStrs = append(requestedStrs, p.String())
+	}
+	msg := fmt.Sprintf(
+		"destination platforms %s are not requested (requested platforms: %s): images will not run on "+
+			"the destination, specify --platform to include them",
+		strings.Join(missingStrs, ", "),
+		strings.Join(requestedStrs, ", "),
+	)
+	if err := w.Warnf(warnings.PlatformMismatch, "%s", msg); err != nil {
+		return err
+	}
+	out.Warnf("WARNING: %s", msg)
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+func TestMissingDestinationPlatforms(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		requested   []string
+		destination []string
+		want        []string
+	}{{
+		name:      "no destination platforms",
+		requested: []string{"linux/amd64"},
+	}, {
+		name:        "matching platforms",
+		requested:   []string{"linux/amd64", "linux/arm64"},
+		destination: []string{"linux/arm64"},
+	}, {
+		name:        "default variant",
+		requested:   []string{"linux/arm64/v8"},
+		destination: []string{"linux/arm64"},
+	}, {
+		name:        "architecture alias",
+		requested:   []string{"linux/aarch64"},
+		destination: []string{"linux/arm64"},
+	}, {
+		name:        "mismatching platforms",
+		requested:   []string{"linux/amd64"},
+		destination: []string{"linux/amd64", "linux/arm64"},
+		want:        []string{"linux/arm64"},
+	}, {
+		name:        "all platforms requested",
+		destination: []string{"linux/amd64", "linux/arm64"},
+	}}
+	for ti := range tests {
+		tt := tests[ti]
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := missingDestinationPlatforms(mustParsePlatforms(tt.requested), mustParsePlatforms(tt.destination))
+			assert.Equal(t, mustParsePlatforms(tt.want), got)
+		})
+	}
+}
+
+func TestCheckDestinationPlatforms(t *testing.T) {
+	t.Parallel()
+
+	requested := mustParsePlatforms([]string{"linux/amd64"})
+	destination := mustParsePlatforms([]string{"linux/arm64"})
+
+	w := warnings.NewCollector(false)
+	require.NoError(t, checkDestinationPlatforms(output.NewDiscardingOutput(), requested, destination, w))
+	require.Len(t, w.Warnings(), 1)
+	assert.Equal(t, warnings.PlatformMismatch, w.Warnings()[0].Kind)
+	assert.Contains(t, w.Warnings()[0].Message, "destination platforms linux/arm64 are not requested")
+
+	err := checkDestinationPlatforms(
+		output.NewDiscardingOutput(), requested, destination, warnings.NewCollector(true),
+	)
+	var warningErr *warnings.Error
+	require.True(t, errors.As(err, &warningErr))
+	assert.Equal(t, warnings.PlatformMismatch, warningErr.Warning.Kind)
+}
+
+func mustParsePlatforms(strs []string) []platform.Platform {
+	var platforms []platform.Platform
+	for _, s := range strs {
+		platforms = append(platforms, platform.MustParse(s))
+	}
+	return platforms
+}
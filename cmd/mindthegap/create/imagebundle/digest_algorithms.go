@@ -0,0 +1,75 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/images"
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+// digestAlgorithmsCopy copies images that address content by digests using algorithms other than
+// sha256, e.g. sha512, which go-containerregistry cannot read, see images.DistributionCopier.
+type digestAlgorithmsCopy struct {
+	writer                  imageWriter
+	destTransport           http.RoundTripper
+	includeNonDistributable bool
+	// unsupported lists the features in use that require reading images with go-containerregistry,
+	// which are not available for such images.
+	unsupported []string
+}
+
+// copy copies the image to the bundle, failing with unsupportedErr, the error reading the image
+// with go-containerregistry, if it cannot be copied.
+func (c *digestAlgorithmsCopy) copy(
+	ctx context.Context,
+	unsupportedErr error,
+	srcTransport http.RoundTripper,
+	srcKeychain authn.Keychain,
+	registryName, imageName, imageTag string,
+	platforms []platform.Platform,
+	w *warnings.Collector,
+) (v1.Hash, error) {
+	writer, ok := c.writer.(registryImageWriter)
+	if !ok {
+		return v1.Hash{}, fmt.Errorf("%w, which can only be bundled with --layout registry", unsupportedErr)
+	}
+	if len(c.unsupported) > 0 {
+		return v1.Hash{}, fmt.Errorf(
+			"%w, which cannot be bundled with %s", unsupportedErr, strings.Join(c.unsupported, ", "),
+		)
+	}
+
+	src, err := name.NewRepository(registryName + "/" + imageName)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	dest, err := name.NewTag(writer.destination(registryName, imageName, imageTag), name.StrictValidation)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	copier := &images.DistributionCopier{
+		SourceTransport:         srcTransport,
+		SourceKeychain:          srcKeychain,
+		DestTransport:           c.destTransport,
+		UserAgent:               utils.Useragent(),
+		IncludeNonDistributable: c.includeNonDistributable,
+	}
+	copied, err := copier.Copy(ctx, src, imageTag, dest, platforms, w)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	// v1.Hash is only used to record the digest, it cannot be parsed from non-sha256 digests.
+	return v1.Hash{Algorithm: copied.Algorithm().String(), Hex: copied.Encoded()}, nil
+}
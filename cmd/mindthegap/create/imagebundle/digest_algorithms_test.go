@@ -0,0 +1,95 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/images"
+)
+
+func TestCreateUnsupportedDigestAlgorithmOptions(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(registry.New())
+	t.Cleanup(srv.Close)
+	reg := strings.TrimPrefix(srv.URL, "http://")
+
+	// The manifest is only read, the content it references does not have to exist.
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageConfig,
+			Digest:    digest.SHA512.FromString("config"),
+			Size:      6,
+		},
+	})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPut, srv.URL+"/v2/library/image/manifests/v1", bytes.NewReader(manifest))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", ocispec.MediaTypeImageManifest)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(policyFile, []byte(`{"default": [{"type": "insecureAcceptAnything"}]}`), 0o600))
+
+	tests := []struct {
+		name    string
+		opts    func(*Options)
+		wantErr string
+	}{{
+		name:    "oci layout",
+		opts:    func(o *Options) { o.Layout = OCILayout },
+		wantErr: "which can only be bundled with --layout registry",
+	}, {
+		name:    "signature policy",
+		opts:    func(o *Options) { o.SignaturePolicyFile = policyFile },
+		wantErr: "which cannot be bundled with --policy-file",
+	}, {
+		name:    "annotations",
+		opts:    func(o *Options) { o.Annotations = map[string]string{"org.example": "value"} },
+		wantErr: "which cannot be bundled with annotations",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := Options{
+				OutputFile: filepath.Join(t.TempDir(), "images.tar"),
+				ImagesConfig: &config.ImagesConfig{
+					reg: {
+						Images: map[string][]string{"library/image": {"v1"}},
+						Proxy:  config.DirectProxy,
+					},
+				},
+				ImagePullConcurrency: 1,
+			}
+			tt.opts(&opts)
+			_, err := Create(context.Background(), output.NewDiscardingOutput(), opts)
+			require.ErrorIs(t, err, images.ErrUnsupportedDigestAlgorithm)
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
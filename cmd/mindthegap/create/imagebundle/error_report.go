@@ -0,0 +1,125 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/thediveo/enumflag/v2"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+// OnErrorMode configures how images that fail to be pulled are handled.
+type OnErrorMode enumflag.Flag
+
+const (
+	Fail OnErrorMode = iota
+	Continue
+)
+
+var onErrorModes = map[OnErrorMode][]string{
+	Fail:     {"fail"},
+	Continue: {"continue"},
+}
+
+type failedImage struct {
+	registry string
+	image    string
+	tag      string
+	err      error
+}
+
+func (f failedImage) String() string {
+	return fmt.Sprintf("%s/%s:%s", f.registry, f.image, f.tag)
+}
+
+// errorReport records images that failed to be pulled when continuing on errors.
+type errorReport struct {
+	mu     sync.Mutex
+	failed []failedImage
+}
+
+func (r *errorReport) add(registry, image, tag string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed = append(r.failed, failedImage{registry: registry, image: image, tag: tag, err: err})
+}
+
+func (r *errorReport) sorted() []failedImage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sorted := append([]failedImage{}, r.failed...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].String() < sorted[j].String()
+	})
+	return sorted
+}
+
+// removeFailedImages removes failed images from cfg so that the bundle config only lists images
+// that are actually in the bundle.
+func (r *errorReport) removeFailedImages(cfg config.ImagesConfig) {
+	for _, f := range r.sorted() {
+		registryConfig, ok := cfg[f.registry]
+		if !ok {
+			continue
+		}
+
+		tags := registryConfig.Images[f.image]
+		remaining := make([]string, 0, len(tags))
+		for _, t := range tags {
+			if t != f.tag {
+				remaining = append(remaining, t)
+			}
+		}
+
+		if len(remaining) == 0 {
+			delete(registryConfig.Images, f.image)
+		} else {
+			registryConfig.Images[f.image] = remaining
+		}
+	}
+}
+
+type errorReportFile struct {
+	TotalImages  int          `json:"totalImages"`
+	FailedImages []ImageError `json:"failedImages"`
+}
+
+// ImageError is an image that failed to be pulled.
+type ImageError struct {
+	Image string `json:"image"`
+	Error string `json:"error"`
+}
+
+func (r *errorReport) imageErrors() []ImageError {
+	failed := r.sorted()
+	imageErrors := make([]ImageError, 0, len(failed))
+	for _, f := range failed {
+		imageErrors = append(imageErrors, ImageError{Image: f.String(), Error: f.err.Error()})
+	}
+	return imageErrors
+}
+
+func (r *errorReport) writeFile(fileName string, totalImages int) error {
+	report := errorReportFile{
+		TotalImages:  totalImages,
+		FailedImages: r.imageErrors(),
+	}
+
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode error report: %w", err)
+	}
+	//nolint:gosec // Error report is not sensitive.
+	if err := os.WriteFile(fileName, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write error report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+func TestErrorReport(t *testing.T) {
+	t.Parallel()
+
+	r := &errorReport{}
+	r.add("docker.io", "library/nginx", "1.21.5", errors.New("not found"))
+	r.add("docker.io", "library/busybox", "latest", errors.New("unauthorized"))
+
+	cfg := config.ImagesConfig{
+		"docker.io": config.RegistrySyncConfig{
+			Images: map[string][]string{
+				"library/nginx":   {"1.21.5", "1.21.6"},
+				"library/busybox": {"latest"},
+			},
+		},
+	}
+	r.removeFailedImages(cfg)
+	assert.Equal(t, config.ImagesConfig{
+		"docker.io": config.RegistrySyncConfig{
+			Images: map[string][]string{
+				"library/nginx": {"1.21.6"},
+			},
+		},
+	}, cfg)
+
+	reportFile := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, r.writeFile(reportFile, 3))
+	b, err := os.ReadFile(reportFile)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "totalImages": 3,
+  "failedImages": [
+    {"image": "docker.io/library/busybox:latest", "error": "unauthorized"},
+    {"image": "docker.io/library/nginx:1.21.5", "error": "not found"}
+  ]
+}`, string(b))
+}
@@ -4,41 +4,66 @@
 package imagebundle
 
 import (
-	"context"
-	"errors"
 	"fmt"
-	"net/http"
-	"os"
-	"path/filepath"
-	"sync"
+	"time"
 
-	"github.com/google/go-containerregistry/pkg/authn"
-	"github.com/google/go-containerregistry/pkg/logs"
-	"github.com/google/go-containerregistry/pkg/name"
-	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/spf13/cobra"
-	"golang.org/x/sync/errgroup"
+	"github.com/thediveo/enumflag/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
 
 	"github.com/mesosphere/dkp-cli-runtime/core/output"
 
 	"github.com/mesosphere/mindthegap/archive"
-	"github.com/mesosphere/mindthegap/cleanup"
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
-	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
-	"github.com/mesosphere/mindthegap/config"
-	"github.com/mesosphere/mindthegap/docker/registry"
-	"github.com/mesosphere/mindthegap/images"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/progress"
 	"github.com/mesosphere/mindthegap/images/authnhelpers"
-	"github.com/mesosphere/mindthegap/images/httputils"
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/metrics"
 )
 
 func NewCommand(out output.Output) *cobra.Command {
 	var (
 		configFile           string
-		platforms            []platform
+		platforms            []platform.Platform
 		outputFile           string
 		overwrite            bool
 		imagePullConcurrency int
+		progressMode         progress.Mode
+		strict               bool
+		onError              = Fail
+		errorReportFile      string
+		failOnAnyError       bool
+		layout               = RegistryLayout
+		localImageNames      []string
+		containerdNamespace  string
+		blobCacheDir         string
+		compression          archive.Compression
+		compressionLevel     int
+		splitSize            flags.SplitSize
+		perImageTimeout      time.Duration
+		stallTimeout         time.Duration
+		stallRetries         int
+		resumeFromDir        string
+		includeSignatures    bool
+		trustPolicyFile      string
+		repoRewriteRulesFile string
+		requireAllPlatforms  bool
+		scanOpts             ScanOptions
+		rateLimits           RateLimitOptions
+		annotations          flags.Annotations
+		signKey              string
+		trustStoreDir        string
+		signaturePolicyFile  string
+		registryAuthFile     string
+		credentialOpts       authnhelpers.CredentialOptions
+		clockSkewTolerance   time.Duration
+		maxBundleSize        resource.QuantityValue
+		dryRun               bool
+		listenAddress        string
+		listenPortRange      flags.PortRange
+		destinationPlatforms DestinationPlatformOptions
+
+		includeNonDistributable bool
 	)
 
 	cmd := &cobra.Command{
@@ -53,225 +78,75 @@ func NewCommand(out output.Output) *cobra.Command {
 				return err
 			}
 
-			return nil
-		},
-		RunE: func(cmd *cobra.Command, args []string) error {
-			if !overwrite {
-				out.StartOperation("Checking if output file already exists")
-				_, err := os.Stat(outputFile)
-				switch {
-				case err == nil:
-					out.EndOperationWithStatus(output.Failure())
-					return fmt.Errorf(
-						"%s already exists: specify --overwrite to overwrite existing file",
-						outputFile,
-					)
-				case !errors.Is(err, os.ErrNotExist):
-					out.EndOperationWithStatus(output.Failure())
-					return fmt.Errorf(
-						"failed to check if output file %s already exists: %w",
-						outputFile,
-						err,
-					)
-				default:
-					out.EndOperationWithStatus(output.Success())
-				}
+			if includeSignatures && layout == OCILayout {
+				return fmt.Errorf("--include-notation-signatures requires --layout=registry")
 			}
 
-			out.StartOperation("Parsing image bundle config")
-			cfg, err := config.ParseImagesConfigFile(configFile)
+			return flags.ResolveCompression(cmd.Flags(), outputFile, &compression, compressionLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			destPlatforms, err := destinationPlatforms.Resolve(cmd.Context(), out)
 			if err != nil {
-				out.EndOperationWithStatus(output.Failure())
 				return err
 			}
-			out.EndOperationWithStatus(output.Success())
-			out.V(4).Infof("Images config: %+v", cfg)
-
-			out.StartOperation("Creating temporary directory")
-			outputFileAbs, err := filepath.Abs(outputFile)
-			if err != nil {
-				out.EndOperationWithStatus(output.Failure())
-				return fmt.Errorf(
-					"failed to determine where to create temporary directory: %w",
-					err,
-				)
-			}
-
-			cleaner := cleanup.NewCleaner()
-			defer cleaner.Cleanup()
-
-			tempDir, err := os.MkdirTemp(filepath.Dir(outputFileAbs), ".image-bundle-*")
-			if err != nil {
-				out.EndOperationWithStatus(output.Failure())
-				return fmt.Errorf("failed to create temporary directory: %w", err)
-			}
-			cleaner.AddCleanupFn(func() { _ = os.RemoveAll(tempDir) })
-
-			out.EndOperationWithStatus(output.Success())
-
-			out.StartOperation("Starting temporary Docker registry")
-			reg, err := registry.NewRegistry(registry.Config{StorageDirectory: tempDir})
-			if err != nil {
-				out.EndOperationWithStatus(output.Failure())
-				return fmt.Errorf("failed to create local Docker registry: %w", err)
-			}
-			go func() {
-				if err := reg.ListenAndServe(); err != nil {
-					out.Error(err, "error serving Docker registry")
-					os.Exit(2)
-				}
-			}()
-			out.EndOperationWithStatus(output.Success())
-
-			logs.Debug.SetOutput(out.V(4).InfoWriter())
-			logs.Warn.SetOutput(out.V(2).InfoWriter())
-
-			// Sort registries for deterministic ordering.
-			regNames := cfg.SortedRegistryNames()
-
-			eg, egCtx := errgroup.WithContext(context.Background())
-			eg.SetLimit(imagePullConcurrency)
-
-			pullGauge := &output.ProgressGauge{}
-			pullGauge.SetCapacity(cfg.TotalImages())
-			pullGauge.SetStatus("Pulling requested images")
-
-			destTLSRoundTripper, err := httputils.InsecureTLSRoundTripper(remote.DefaultTransport)
-			if err != nil {
-				out.Error(err, "error configuring TLS for destination registry")
-				os.Exit(2)
-			}
-			defer func() {
-				if tr, ok := destTLSRoundTripper.(*http.Transport); ok {
-					tr.CloseIdleConnections()
-				}
-			}()
-			destRemoteOpts := []remote.Option{
-				remote.WithTransport(destTLSRoundTripper),
-				remote.WithContext(egCtx),
-				remote.WithUserAgent(utils.Useragent()),
+			platformsRequested := cmd.Flags().Changed("platform")
+			if !platformsRequested && len(destPlatforms) > 0 {
+				platforms, platformsRequested = destPlatforms, true
 			}
 
-			out.StartOperationWithProgress(pullGauge)
-
-			for registryIdx := range regNames {
-				registryName := regNames[registryIdx]
-
-				registryConfig := cfg[registryName]
-
-				sourceTLSRoundTripper, err := httputils.TLSConfiguredRoundTripper(
-					remote.DefaultTransport,
-					registryName,
-					registryConfig.TLSVerify != nil && !*registryConfig.TLSVerify,
-					"",
-				)
-				if err != nil {
-					out.EndOperationWithStatus(output.Failure())
-					out.Error(err, "error configuring TLS for source registry")
-					os.Exit(2)
-				}
-
-				keychain := authn.NewMultiKeychain(
-					authn.NewKeychainFromHelper(
-						authnhelpers.NewStaticHelper(registryName, registryConfig.Credentials),
-					),
-					authn.DefaultKeychain,
+			_, err = Create(cmd.Context(), out, Options{
+				ConfigFile:           configFile,
+				OutputFile:           outputFile,
+				Overwrite:            overwrite,
+				Platforms:            platforms,
+				PlatformsRequested:   platformsRequested,
+				DestinationPlatforms: destPlatforms,
+				MaxBundleSize:        maxBundleSize.Value(),
+				DryRun:               dryRun,
+				ListenAddress:        listenAddress,
+				ListenPortRange:      listenPortRange,
+				RepoRewriteRulesFile: repoRewriteRulesFile,
+				Scan:                 scanOpts,
+				RateLimits:           rateLimits,
+				Annotations:          annotations,
+				SignKey:              signKey,
+				RequireAllPlatforms:  requireAllPlatforms,
+				ImagePullConcurrency: imagePullConcurrency,
+				Strict:               strict,
+				OnError:              onError,
+				ErrorReportFile:      errorReportFile,
+				FailOnAnyError:       failOnAnyError,
+				Layout:               layout,
+				LocalImages:          localImageNames,
+				ContainerdNamespace:  containerdNamespace,
+				BlobCacheDir:         blobCacheDir,
+				Compression:          compression,
+				CompressionLevel:     compressionLevel,
+				SplitSize:            splitSize.Bytes,
+				PerImageTimeout:      perImageTimeout,
+				StallTimeout:         stallTimeout,
+				StallRetries:         stallRetries,
+				RegistryAuthFile:     registryAuthFile,
+				Credentials:          credentialOpts,
+				ClockSkewTolerance:   clockSkewTolerance,
+				Reporter:             progress.NewReporter(progressMode, cmd.OutOrStdout()),
+				Metrics:              metrics.FromContext(cmd.Context()),
+				ResumeFromDir:        resumeFromDir,
+
+				IncludeNotationSignatures: includeSignatures,
+				NotationTrustPolicyFile:   trustPolicyFile,
+				NotationTrustStoreDir:     trustStoreDir,
+				SignaturePolicyFile:       signaturePolicyFile,
+
+				IncludeNonDistributable: includeNonDistributable,
+			})
+			if err != nil && resumeFromDir != "" {
+				out.Infof(
+					"Progress has been saved to %s, re-run with the same --resume-from-dir to resume",
+					resumeFromDir,
 				)
-
-				sourceRemoteOpts := []remote.Option{
-					remote.WithTransport(sourceTLSRoundTripper),
-					remote.WithAuthFromKeychain(keychain),
-					remote.WithContext(egCtx),
-					remote.WithUserAgent(utils.Useragent()),
-				}
-
-				platformsStrings := make([]string, 0, len(platforms))
-				for _, p := range platforms {
-					platformsStrings = append(platformsStrings, p.String())
-				}
-
-				// Sort images for deterministic ordering.
-				imageNames := registryConfig.SortedImageNames()
-
-				wg := new(sync.WaitGroup)
-
-				for imageIdx := range imageNames {
-					imageName := imageNames[imageIdx]
-					imageTags := registryConfig.Images[imageName]
-
-					wg.Add(len(imageTags))
-					for j := range imageTags {
-						imageTag := imageTags[j]
-
-						eg.Go(func() error {
-							defer wg.Done()
-
-							srcImageName := fmt.Sprintf(
-								"%s/%s:%s",
-								registryName,
-								imageName,
-								imageTag,
-							)
-
-							imageIndex, err := images.ManifestListForImage(
-								srcImageName,
-								platformsStrings,
-								sourceRemoteOpts...,
-							)
-							if err != nil {
-								return err
-							}
-
-							destImageName := fmt.Sprintf(
-								"%s/%s:%s",
-								reg.Address(),
-								imageName,
-								imageTag,
-							)
-							ref, err := name.ParseReference(destImageName, name.StrictValidation)
-							if err != nil {
-								return err
-							}
-
-							if err := remote.WriteIndex(ref, imageIndex, destRemoteOpts...); err != nil {
-								return err
-							}
-
-							pullGauge.Inc()
-
-							return nil
-						})
-					}
-				}
-
-				go func() {
-					wg.Wait()
-
-					if tr, ok := sourceTLSRoundTripper.(*http.Transport); ok {
-						tr.CloseIdleConnections()
-					}
-				}()
-			}
-
-			if err := eg.Wait(); err != nil {
-				out.EndOperationWithStatus(output.Failure())
-				return err
 			}
-
-			out.EndOperationWithStatus(output.Success())
-
-			if err := config.WriteSanitizedImagesConfig(cfg, filepath.Join(tempDir, "images.yaml")); err != nil {
-				return err
-			}
-
-			out.StartOperation(fmt.Sprintf("Archiving images to %s", outputFile))
-			if err := archive.ArchiveDirectory(tempDir, outputFile); err != nil {
-				out.EndOperationWithStatus(output.Failure())
-				return fmt.Errorf("failed to create image bundle tarball: %w", err)
-			}
-			out.EndOperationWithStatus(output.Success())
-
-			return nil
+			return err
 		},
 	}
 
@@ -279,14 +154,72 @@ func NewCommand(out output.Output) *cobra.Command {
 		"File containing list of images to create bundle from, either as YAML configuration or a simple list of images")
 	_ = cmd.MarkFlagRequired("images-file")
 	cmd.Flags().
-		Var(newPlatformSlicesValue([]platform{{os: "linux", arch: "amd64"}}, &platforms), "platform",
-			"platforms to download images (required format: <os>/<arch>[/<variant>])")
+		Var(flags.NewPlatformsOrAllValue([]platform.Platform{platform.MustParse("linux/amd64")}, &platforms), "platform",
+			"platforms to download images (required format: <os>/<arch>[/<variant>][:<os.version>]), or \"all\" to bundle every "+
+				"platform of every image with its complete manifest list")
+	cmd.Flags().BoolVar(&requireAllPlatforms, "require-all-platforms", false,
+		"Fail if any image does not provide all requested platforms, listing every missing image and platform")
+	AddDestinationPlatformFlags(cmd.Flags(), &destinationPlatforms)
 	cmd.Flags().
 		StringVar(&outputFile, "output-file", "images.tar", "Output file to write image bundle to")
 	cmd.Flags().
 		BoolVar(&overwrite, "overwrite", false, "Overwrite image bundle file if it already exists")
 	cmd.Flags().
 		IntVar(&imagePullConcurrency, "image-pull-concurrency", 1, "Image pull concurrency")
+	AddPullTimeoutFlags(cmd.Flags(), &perImageTimeout, &stallTimeout, &stallRetries)
+	AddBundleSizeFlags(cmd.Flags(), &maxBundleSize, &dryRun)
+	progress.AddFlag(cmd.Flags(), &progressMode)
+	flags.AddCompressionFlags(cmd.Flags(), &compression, &compressionLevel)
+	flags.AddSplitSizeFlag(cmd.Flags(), &splitSize)
+	cmd.Flags().Var(
+		enumflag.New(&layout, "string", bundleLayouts, enumflag.EnumCaseSensitive),
+		"layout",
+		`layout of images in the bundle: one of "registry" (registry storage) or "oci" `+
+			`(portable OCI image layout, requires mindthegap with OCI layout support to serve or push)`,
+	)
+	cmd.Flags().Var(
+		enumflag.New(&onError, "string", onErrorModes, enumflag.EnumCaseSensitive),
+		"on-error",
+		`how to handle images that fail to be pulled: one of "fail" or "continue" (skip failed images)`,
+	)
+	cmd.Flags().StringVar(&errorReportFile, "error-report-file", "",
+		"File to write a JSON report of images that failed to be pulled to")
+	cmd.Flags().BoolVar(&failOnAnyError, "fail-on-any-error", false,
+		"Exit with a non-zero exit code if any image failed to be pulled, even with --on-error=continue")
+	cmd.Flags().StringSliceVar(&localImageNames, "include-local-image", nil,
+		"Local image to include in the bundle that has not been pushed to any registry, in the format "+
+			"[docker-daemon://|containerd://]<image>[:<tag>] (can be specified multiple times)")
+	cmd.Flags().StringVar(&containerdNamespace, "containerd-namespace", "k8s.io",
+		"Containerd namespace to read local images from")
+	flags.AddRegistryAuthFileFlag(cmd.Flags(), &registryAuthFile)
+	flags.AddRegistryCredentialFlags(cmd.Flags(), &credentialOpts)
+	flags.AddIncludeNonDistributableFlag(cmd.Flags(), &includeNonDistributable)
+	flags.AddClockSkewToleranceFlag(cmd.Flags(), &clockSkewTolerance)
+	flags.AddTemporaryRegistryListenFlags(cmd.Flags(), &listenAddress, &listenPortRange)
+	cmd.Flags().StringVar(&blobCacheDir, "blob-cache-dir", "",
+		"Directory to cache pulled image blobs in, for reuse when creating other bundles")
+	cmd.Flags().StringVar(&resumeFromDir, "resume-from-dir", "",
+		"Directory to pull images into, persisting progress so that an interrupted run can be resumed by "+
+			"re-running with the same directory (must be empty or contain progress of a previous run, "+
+			"removed once the bundle has been created)")
+	cmd.Flags().BoolVar(&includeSignatures, "include-notation-signatures", false,
+		"Include Notation signatures of images in the bundle, which are pushed along with the images")
+	flags.AddNotationTrustPolicyFlags(cmd.Flags(), &trustPolicyFile, &trustStoreDir)
+	cmd.MarkFlagsRequiredTogether("notation-trust-policy", "notation-trust-store")
+	cmd.Flags().StringVar(&signaturePolicyFile, "policy-file", "",
+		"Containers signature verification policy file (policy.json) that images must be accepted by before they "+
+			"are added to the bundle, supporting insecureAcceptAnything, reject and sigstoreSigned requirements "+
+			"with public keys")
+	cmd.Flags().StringVar(&repoRewriteRulesFile, "repo-rewrite-rules", "",
+		"File containing rules to rewrite source image repositories to destination repositories, "+
+			"recording the repositories images are pushed to in the bundle")
+	AddScanFlags(cmd.Flags(), &scanOpts)
+	AddRateLimitFlags(cmd.Flags(), &rateLimits)
+	flags.AddAnnotationFlag(cmd.Flags(), &annotations)
+	flags.AddBundleSignKeyFlag(cmd.Flags(), &signKey)
+	cmd.Flags().BoolVar(&strict, "strict", false,
+		"Treat warnings (missing platforms, digests not found, image name normalization changes, platform "+
+			"mismatches, deprecated images, vulnerabilities with --scan-action=warn) as errors")
 
 	return cmd
 }
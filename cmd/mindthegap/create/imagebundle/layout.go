@@ -0,0 +1,156 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/thediveo/enumflag/v2"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/progress"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/images"
+)
+
+// BundleLayout is the layout of images in the bundle.
+type BundleLayout enumflag.Flag
+
+const (
+	// RegistryLayout bundles images as registry storage, which can be served directly by a registry.
+	RegistryLayout BundleLayout = iota
+	// OCILayout bundles images as an OCI image layout, which does not depend on any registry version.
+	OCILayout
+)
+
+var bundleLayouts = map[BundleLayout][]string{
+	RegistryLayout: {"registry"},
+	OCILayout:      {"oci"},
+}
+
+// imageWriter writes pulled images into the bundle.
+type imageWriter interface {
+	// destination returns where the image is written to, used for progress reporting.
+	destination(registryName, imageName, imageTag string) string
+	// write writes the image, which is either a v1.ImageIndex or, for OCI artifacts, a v1.Image.
+	write(
+		registryName, imageName, imageTag string,
+		image remote.Taggable,
+		reporter progress.Reporter,
+		remoteOpts ...remote.Option,
+	) error
+}
+
+// registryImageWriter pushes images to a temporary registry using the bundle directory as storage.
+type registryImageWriter struct {
+	address string
+	// blobs mounts layers that have already been pushed to other repositories of the temporary
+	// registry instead of pulling them again.
+	blobs *images.BlobLocations
+}
+
+func (w registryImageWriter) destination(_, imageName, imageTag string) string {
+	return fmt.Sprintf("%s/%s:%s", w.address, imageName, imageTag)
+}
+
+func (w registryImageWriter) write(
+	registryName, imageName, imageTag string,
+	image remote.Taggable,
+	reporter progress.Reporter,
+	remoteOpts ...remote.Option,
+) error {
+	destImageName := w.destination(registryName, imageName, imageTag)
+	ref, err := name.ParseReference(destImageName, name.StrictValidation)
+	if err != nil {
+		return err
+	}
+
+	progressOpts, waitForProgress := progress.RemoteOptions(
+		reporter,
+		utils.OCILayoutRefName(registryName, imageName, imageTag),
+		destImageName,
+	)
+	defer waitForProgress()
+
+	switch image := image.(type) {
+	case v1.ImageIndex:
+		image, recordLocations := w.blobs.ImageIndex(image, ref.Context())
+		if err := remote.WriteIndex(ref, image, append(progressOpts, remoteOpts...)...); err != nil {
+			return err
+		}
+		recordLocations()
+		return nil
+	case v1.Image:
+		return remote.Write(ref, image, append(progressOpts, remoteOpts...)...)
+	default:
+		return fmt.Errorf("unsupported image type %T", image)
+	}
+}
+
+// ociLayoutImageWriter writes images to an OCI image layout in the bundle directory, annotated with
+// their full image names.
+type ociLayoutImageWriter struct {
+	// mu serializes writes as the OCI layout index is not safe for concurrent updates.
+	mu   sync.Mutex
+	path layout.Path
+	// includeNonDistributable writes non-distributable layers, which are skipped otherwise like they
+	// are when pushing images to the registry.
+	includeNonDistributable bool
+}
+
+// newOCILayoutImageWriter creates an OCI layout in dir, or appends to the existing OCI layout when
+// resuming.
+func newOCILayoutImageWriter(dir string, includeNonDistributable bool) (*ociLayoutImageWriter, error) {
+	if utils.IsOCILayout(dir) {
+		p, err := layout.FromPath(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read existing OCI layout: %w", err)
+		}
+		return &ociLayoutImageWriter{path: p, includeNonDistributable: includeNonDistributable}, nil
+	}
+
+	p, err := layout.Write(dir, empty.Index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCI layout: %w", err)
+	}
+	return &ociLayoutImageWriter{path: p, includeNonDistributable: includeNonDistributable}, nil
+}
+
+func (w *ociLayoutImageWriter) destination(registryName, imageName, imageTag string) string {
+	return "oci-layout:" + utils.OCILayoutRefName(registryName, imageName, imageTag)
+}
+
+func (w *ociLayoutImageWriter) write(
+	registryName, imageName, imageTag string,
+	image remote.Taggable,
+	_ progress.Reporter,
+	_ ...remote.Option,
+) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	annotations := layout.WithAnnotations(map[string]string{
+		ocispec.AnnotationRefName: utils.OCILayoutRefName(registryName, imageName, imageTag),
+	})
+	switch image := image.(type) {
+	case v1.ImageIndex:
+		if !w.includeNonDistributable {
+			image = images.WithoutNonDistributableLayers(image)
+		}
+		return w.path.AppendIndex(image, annotations)
+	case v1.Image:
+		if !w.includeNonDistributable {
+			image = images.ImageWithoutNonDistributableLayers(image)
+		}
+		return w.path.AppendImage(image, annotations)
+	default:
+		return fmt.Errorf("unsupported image type %T", image)
+	}
+}
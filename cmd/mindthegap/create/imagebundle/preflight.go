@@ -0,0 +1,360 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/images/authnhelpers"
+	"github.com/mesosphere/mindthegap/images/httputils"
+	"github.com/mesosphere/mindthegap/metrics"
+)
+
+// PreflightCheckType is the kind of a pre-flight check.
+type PreflightCheckType string
+
+const (
+	// DNSCheck resolves the hostname of a source registry.
+	DNSCheck PreflightCheckType = "dns"
+	// TCPCheck connects to a source registry.
+	TCPCheck PreflightCheckType = "tcp"
+	// TLSCheck reaches the API of a source registry, via its proxy if configured, verifying its TLS
+	// certificate unless TLS verification is disabled.
+	TLSCheck PreflightCheckType = "tls"
+	// CredentialsCheck authenticates with a source registry for pulling all of its images.
+	CredentialsCheck PreflightCheckType = "credentials"
+	// ImageCheck confirms that an image exists in its source registry.
+	ImageCheck PreflightCheckType = "image"
+)
+
+// PreflightStatus is the outcome of a pre-flight check.
+type PreflightStatus string
+
+const (
+	PreflightPassed  PreflightStatus = "passed"
+	PreflightFailed  PreflightStatus = "failed"
+	PreflightSkipped PreflightStatus = "skipped"
+)
+
+// PreflightCheck is the result of a single pre-flight check of a source registry or, if Image is
+// set, of an image.
+type PreflightCheck struct {
+	Registry string             `json:"registry"`
+	Image    string             `json:"image,omitempty"`
+	Check    PreflightCheckType `json:"check"`
+	Status   PreflightStatus    `json:"status"`
+	Message  string             `json:"message,omitempty"`
+	// Category classifies why the check failed, see metrics.Categorize.
+	Category metrics.Category `json:"category,omitempty"`
+}
+
+// PreflightOptions configures the pre-flight checks of an images config file.
+type PreflightOptions struct {
+	// RegistryAuthFile is the file to read registry credentials from that are not configured in the
+	// images config file, defaulting to the Docker config file.
+	RegistryAuthFile string
+	// Credentials configures resolving credentials from the OS keyring and prompting for them.
+	Credentials authnhelpers.CredentialOptions
+	// ClockSkewTolerance accepts TLS certificates of source registries that are not valid at the
+	// local time if they are valid within the tolerance of it, if set.
+	ClockSkewTolerance time.Duration
+	// Concurrency is the number of images checked concurrently.
+	Concurrency int
+	// Timeout bounds every single check if set.
+	Timeout time.Duration
+}
+
+// Preflight checks that every source registry in cfg is reachable and accepts its credentials, and
+// that every image exists, without pulling any images. The results are sorted by registry and image,
+// with the checks of registries before the checks of their images. An error is only returned if the
+// checks cannot be run at all.
+func Preflight(
+	ctx context.Context,
+	cfg config.ImagesConfig,
+	opts PreflightOptions,
+) ([]PreflightCheck, error) {
+	defaultKeychain, err := authnhelpers.NewKeychain(opts.RegistryAuthFile)
+	if err != nil {
+		return nil, err
+	}
+	defaultKeychain, err = opts.Credentials.Keychain(defaultKeychain)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		results []PreflightCheck
+	)
+	record := func(checks ...PreflightCheck) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, checks...)
+	}
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(max(opts.Concurrency, 1))
+
+	for _, registryName := range cfg.SortedRegistryNames() {
+		registryConfig := cfg[registryName]
+
+		var imageNames []string
+		for _, imageName := range registryConfig.SortedImageNames() {
+			for _, imageTag := range registryConfig.Images[imageName] {
+				imageNames = append(imageNames, fmt.Sprintf("%s/%s:%s", registryName, imageName, imageTag))
+			}
+		}
+
+		sourceRoundTripper, sourceRemoteOpts, err := sourceRemoteOptions(
+			registryName,
+			registryConfig,
+			defaultKeychain,
+			opts.ClockSkewTolerance,
+			httputils.NewRateLimiter(registryConfig.MaxRequestsPerSecond, registryConfig.MaxBandwidth),
+		)
+		if err != nil {
+			_ = eg.Wait()
+			return nil, err
+		}
+
+		registryChecks, reachable := checkRegistry(
+			egCtx,
+			registryName,
+			registryConfig,
+			sourceKeychain(registryName, registryConfig, defaultKeychain),
+			sourceRoundTripper,
+			imageNames,
+			opts.Timeout,
+		)
+		record(registryChecks...)
+
+		for _, imageName := range imageNames {
+			if !reachable {
+				record(PreflightCheck{
+					Registry: registryName,
+					Image:    imageName,
+					Check:    ImageCheck,
+					Status:   PreflightSkipped,
+					Message:  "registry is not reachable",
+				})
+				continue
+			}
+			registryName, imageName := registryName, imageName
+			eg.Go(func() error {
+				record(checkImage(egCtx, registryName, imageName, opts.Timeout, sourceRemoteOpts))
+				return nil
+			})
+		}
+	}
+
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Registry != results[j].Registry {
+			return results[i].Registry < results[j].Registry
+		}
+		return results[i].Image < results[j].Image
+	})
+	return results, ctx.Err()
+}
+
+// checkRegistry checks the reachability of the registry and its credentials in order, skipping all
+// checks after the first failed one. It returns true if the API of the registry is reachable.
+func checkRegistry(
+	ctx context.Context,
+	registryName string,
+	registryConfig config.RegistrySyncConfig,
+	keychain authn.Keychain,
+	sourceRoundTripper http.RoundTripper,
+	imageNames []string,
+	timeout time.Duration,
+) (checks []PreflightCheck, reachable bool) {
+	var failed bool
+	skip := func(check PreflightCheckType, reason string) {
+		checks = append(checks, PreflightCheck{
+			Registry: registryName, Check: check, Status: PreflightSkipped, Message: reason,
+		})
+	}
+	// run runs the check unless a previous check failed. The check returns a note to report if it
+	// passes, e.g. to point out insecure configuration.
+	run := func(check PreflightCheckType, fn func(ctx context.Context) (string, error)) {
+		if failed {
+			skip(check, "previous check failed")
+			return
+		}
+
+		checkCtx, cancel := withOptionalTimeout(ctx, timeout)
+		defer cancel()
+		result := PreflightCheck{Registry: registryName, Check: check, Status: PreflightPassed}
+		note, err := fn(checkCtx)
+		if err != nil {
+			failed = true
+			result.Status, note, result.Category = PreflightFailed, err.Error(), metrics.Categorize(err)
+		}
+		result.Message = note
+		checks = append(checks, result)
+	}
+
+	reg, err := name.NewRegistry(registryName)
+	if err != nil {
+		return []PreflightCheck{{
+			Registry: registryName,
+			Check:    DNSCheck,
+			Status:   PreflightFailed,
+			Message:  fmt.Sprintf("invalid registry name: %v", err),
+		}}, false
+	}
+	host, port := registryHostPort(reg)
+
+	if registryProxied(reg, registryConfig) {
+		// The proxy resolves and connects to the registry, which is checked via the proxy.
+		skip(DNSCheck, "registry is reached via a proxy")
+		skip(TCPCheck, "registry is reached via a proxy")
+	} else {
+		run(DNSCheck, func(ctx context.Context) (string, error) {
+			_, err := net.DefaultResolver.LookupHost(ctx, host)
+			return "", err
+		})
+		run(TCPCheck, func(ctx context.Context) (string, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+			if err != nil {
+				return "", err
+			}
+			return "", conn.Close()
+		})
+	}
+
+	run(TLSCheck, func(ctx context.Context) (string, error) {
+		if err := pingRegistry(ctx, reg, sourceRoundTripper); err != nil {
+			return "", err
+		}
+		if reg.Scheme() == "http" {
+			return "registry is served over plain HTTP", nil
+		}
+		return "", nil
+	})
+	reachable = !failed
+
+	run(CredentialsCheck, func(ctx context.Context) (string, error) {
+		auth, err := keychain.Resolve(reg)
+		if err != nil {
+			return "", fmt.Errorf("failed to read credentials: %w", err)
+		}
+		scopes := make([]string, 0, len(imageNames))
+		for _, imageName := range imageNames {
+			if ref, err := name.ParseReference(imageName); err == nil {
+				scopes = append(scopes, ref.Context().Scope(transport.PullScope))
+			}
+		}
+		if _, err := transport.NewWithContext(ctx, reg, auth, sourceRoundTripper, scopes); err != nil {
+			return "", err
+		}
+		if auth == authn.Anonymous {
+			return "no credentials configured, pulling anonymously", nil
+		}
+		return "", nil
+	})
+
+	return checks, reachable
+}
+
+// checkImage confirms that the image exists by reading its descriptor without pulling it.
+func checkImage(
+	ctx context.Context,
+	registryName, imageName string,
+	timeout time.Duration,
+	sourceRemoteOpts []remote.Option,
+) PreflightCheck {
+	result := PreflightCheck{Registry: registryName, Image: imageName, Check: ImageCheck}
+
+	ref, err := name.ParseReference(imageName, name.StrictValidation)
+	if err != nil {
+		result.Status, result.Message = PreflightFailed, fmt.Sprintf("invalid image reference: %v", err)
+		return result
+	}
+
+	ctx, cancel := withOptionalTimeout(ctx, timeout)
+	defer cancel()
+	if _, err := remote.Head(ref, withRemoteOptions(sourceRemoteOpts, remote.WithContext(ctx))...); err != nil {
+		result.Status, result.Message, result.Category = PreflightFailed, err.Error(), metrics.Categorize(err)
+		return result
+	}
+	result.Status = PreflightPassed
+	return result
+}
+
+// registryHostPort returns the host and port that the registry is connected to at.
+func registryHostPort(reg name.Registry) (host, port string) {
+	host = reg.RegistryStr()
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		return h, p
+	}
+	if reg.Scheme() == "http" {
+		return host, "80"
+	}
+	return host, "443"
+}
+
+// registryProxied returns true if the registry is connected to via a proxy, configured either in
+// the images config file or by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func registryProxied(reg name.Registry, registryConfig config.RegistrySyncConfig) bool {
+	if registryConfig.Proxy != "" {
+		return registryConfig.Proxy != config.DirectProxy
+	}
+	proxy, err := http.ProxyFromEnvironment(&http.Request{
+		URL: &url.URL{Scheme: reg.Scheme(), Host: reg.RegistryStr()},
+	})
+	return err != nil || proxy != nil
+}
+
+// pingRegistry requests the base endpoint of the registry API, which any registry responds to,
+// possibly requiring authentication.
+func pingRegistry(ctx context.Context, reg name.Registry, rt http.RoundTripper) error {
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet, fmt.Sprintf("%s://%s/v2/", reg.Scheme(), reg.RegistryStr()), http.NoBody,
+	)
+	if err != nil {
+		return err
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		var recordErr tls.RecordHeaderError
+		if errors.As(err, &recordErr) {
+			return fmt.Errorf("registry does not serve TLS: %w", err)
+		}
+		return err
+	}
+	_ = resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusUnauthorized, http.StatusForbidden:
+		return nil
+	default:
+		return fmt.Errorf("unexpected response from registry API: %s", resp.Status)
+	}
+}
+
+func withOptionalTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
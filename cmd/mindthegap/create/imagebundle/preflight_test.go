@@ -0,0 +1,90 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/metrics"
+)
+
+func TestPreflight(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(registry.New())
+	t.Cleanup(srv.Close)
+	reg := strings.TrimPrefix(srv.URL, "http://")
+
+	img, err := random.Image(128, 1)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(reg + "/library/image:v1")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	// Nothing listens on port 1, so the registry is not reachable.
+	const unreachable = "127.0.0.1:1"
+
+	cfg := config.ImagesConfig{
+		reg: {
+			Images: map[string][]string{"library/image": {"v1", "v2"}},
+			Proxy:  config.DirectProxy,
+		},
+		unreachable: {
+			Images: map[string][]string{"library/image": {"v1"}},
+			Proxy:  config.DirectProxy,
+		},
+	}
+
+	checks, err := Preflight(context.Background(), cfg, PreflightOptions{Concurrency: 2})
+	require.NoError(t, err)
+
+	// Messages of failed checks are not stable, so only compare their categories.
+	for i := range checks {
+		if checks[i].Status == PreflightFailed {
+			checks[i].Message = ""
+		}
+	}
+	// Registries are sorted by name, so the unreachable registry on port 1 comes first.
+	assert.Equal(t, []PreflightCheck{{
+		Registry: unreachable, Check: DNSCheck, Status: PreflightPassed,
+	}, {
+		Registry: unreachable, Check: TCPCheck, Status: PreflightFailed,
+		Category: metrics.Network,
+	}, {
+		Registry: unreachable, Check: TLSCheck, Status: PreflightSkipped,
+		Message: "previous check failed",
+	}, {
+		Registry: unreachable, Check: CredentialsCheck, Status: PreflightSkipped,
+		Message: "previous check failed",
+	}, {
+		Registry: unreachable, Image: unreachable + "/library/image:v1", Check: ImageCheck,
+		Status: PreflightSkipped, Message: "registry is not reachable",
+	}, {
+		Registry: reg, Check: DNSCheck, Status: PreflightPassed,
+	}, {
+		Registry: reg, Check: TCPCheck, Status: PreflightPassed,
+	}, {
+		Registry: reg, Check: TLSCheck, Status: PreflightPassed,
+		Message: "registry is served over plain HTTP",
+	}, {
+		Registry: reg, Check: CredentialsCheck, Status: PreflightPassed,
+		Message: "no credentials configured, pulling anonymously",
+	}, {
+		Registry: reg, Image: reg + "/library/image:v1", Check: ImageCheck, Status: PreflightPassed,
+	}, {
+		Registry: reg, Image: reg + "/library/image:v2", Check: ImageCheck, Status: PreflightFailed,
+		Category: metrics.NotFound,
+	}}, checks)
+}
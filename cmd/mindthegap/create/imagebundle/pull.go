@@ -0,0 +1,87 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/mesosphere/mindthegap/images/httputils"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+// AddPullTimeoutFlags adds the flags configuring timeouts and retries of image pulls to the
+// specified flag set.
+func AddPullTimeoutFlags(
+	fs *pflag.FlagSet,
+	perImageTimeout, stallTimeout *time.Duration,
+	stallRetries *int,
+) {
+	fs.DurationVar(perImageTimeout, "per-image-timeout", 0,
+		"Maximum time to pull every image, including retries (0 means no timeout)")
+	fs.DurationVar(stallTimeout, "stall-timeout", 5*time.Minute,
+		"Retry pulling an image if a transfer does not receive any bytes for this long (0 disables stall detection)")
+	fs.IntVar(stallRetries, "stall-retries", 3,
+		"Number of times to retry pulling an image after a stalled transfer")
+}
+
+// pullFunc pulls a single image using the specified source transport, bounded by ctx, recording
+// warnings to w.
+type pullFunc func(ctx context.Context, transport http.RoundTripper, w *warnings.Collector) error
+
+// pullWithRetries pulls an image, bounded by the per-image timeout if set. Transfers from the source
+// registry that do not receive any bytes for longer than the stall timeout are cancelled and the
+// image is pulled again, up to the configured number of stall retries. Only warnings of the final
+// attempt are recorded, so that retries do not report the same warnings repeatedly.
+func pullWithRetries(
+	ctx context.Context,
+	img string,
+	transport http.RoundTripper,
+	opts Options,
+	w *warnings.Collector,
+	pull pullFunc,
+) error {
+	parentCtx := ctx
+	if opts.PerImageTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.PerImageTimeout)
+		defer cancel()
+	}
+
+	for attempt := 0; ; attempt++ {
+		stallDetectingTransport := httputils.NewStallDetectingRoundTripper(transport, opts.StallTimeout)
+		attemptWarnings := warnings.NewCollector(opts.Strict)
+
+		err := pull(ctx, stallDetectingTransport, attemptWarnings)
+		if err != nil && parentCtx.Err() != nil {
+			// The whole command is cancelled or timed out, so do not retry.
+			return err
+		}
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %s pulling image %q: %w", opts.PerImageTimeout, img, err)
+		}
+		if err != nil && stallDetectingTransport.Stalled() && attempt < opts.StallRetries {
+			continue
+		}
+		if err != nil && stallDetectingTransport.Stalled() {
+			err = fmt.Errorf(
+				"%w: pulling image %q stalled %d times: %v",
+				httputils.ErrTransferStalled, img, attempt+1, err,
+			)
+		}
+
+		for _, warning := range attemptWarnings.Warnings() {
+			if warnErr := w.Warnf(warning.Kind, "%s", warning.Message); warnErr != nil && err == nil {
+				err = warnErr
+			}
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/images/httputils"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+// stallingServer returns a server that stalls the first stalledRequests requests after writing
+// the first bytes of the response.
+func stallingServer(t *testing.T, stalledRequests int32) *httptest.Server {
+	t.Helper()
+
+	release := make(chan struct{})
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("layer"))
+		w.(http.Flusher).Flush()
+		if requests.Add(1) <= stalledRequests {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	t.Cleanup(func() {
+		close(release)
+		srv.Close()
+	})
+	return srv
+}
+
+func fetch(ctx context.Context, transport http.RoundTripper, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.ReadAll(resp.Body)
+	return err
+}
+
+func TestPullWithRetries(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		stalledRequests int32
+		stallRetries    int
+		perImageTimeout time.Duration
+		wantAttempts    int32
+		wantErr         string
+	}{{
+		name:         "no stall",
+		stallRetries: 1,
+		wantAttempts: 1,
+	}, {
+		name:            "stall retried",
+		stalledRequests: 1,
+		stallRetries:    1,
+		wantAttempts:    2,
+	}, {
+		name:            "stall retries exhausted",
+		stalledRequests: 2,
+		stallRetries:    1,
+		wantAttempts:    2,
+		wantErr:         "stalled 2 times",
+	}, {
+		name:            "per-image timeout",
+		stalledRequests: 10,
+		stallRetries:    10,
+		perImageTimeout: 500 * time.Millisecond,
+		wantErr:         "timed out after 500ms",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := stallingServer(t, tt.stalledRequests)
+			w := warnings.NewCollector(false)
+
+			var attempts atomic.Int32
+			err := pullWithRetries(
+				context.Background(),
+				"docker.io/library/nginx:1.21.5",
+				http.DefaultTransport,
+				Options{
+					PerImageTimeout: tt.perImageTimeout,
+					StallTimeout:    200 * time.Millisecond,
+					StallRetries:    tt.stallRetries,
+				},
+				w,
+				func(ctx context.Context, transport http.RoundTripper, w *warnings.Collector) error {
+					n := attempts.Add(1)
+					if err := w.Warnf(warnings.MissingPlatform, "attempt %d", n); err != nil {
+						return err
+					}
+					return fetch(ctx, transport, srv.URL)
+				},
+			)
+
+			if tt.wantAttempts > 0 {
+				assert.Equal(t, tt.wantAttempts, attempts.Load())
+			}
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			// Only warnings of the final attempt are recorded.
+			assert.Equal(t, []warnings.Warning{{
+				Kind:    warnings.MissingPlatform,
+				Message: fmt.Sprintf("attempt %d", tt.wantAttempts),
+			}}, w.Warnings())
+		})
+	}
+}
+
+func TestPullWithRetriesStalledError(t *testing.T) {
+	t.Parallel()
+
+	srv := stallingServer(t, 1)
+	err := pullWithRetries(
+		context.Background(),
+		"docker.io/library/nginx:1.21.5",
+		http.DefaultTransport,
+		Options{StallTimeout: 200 * time.Millisecond},
+		nil,
+		func(ctx context.Context, transport http.RoundTripper, _ *warnings.Collector) error {
+			return fetch(ctx, transport, srv.URL)
+		},
+	)
+	require.ErrorIs(t, err, httputils.ErrTransferStalled)
+}
@@ -0,0 +1,42 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"errors"
+
+	"github.com/spf13/pflag"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/images/httputils"
+)
+
+// RateLimitOptions limits the traffic to source registries. The limits are shared by all source
+// registries that do not configure their own limits in the images config file.
+type RateLimitOptions struct {
+	MaxRequestsPerSecond float64
+	MaxBandwidth         flags.Bandwidth
+}
+
+func AddRateLimitFlags(fs *pflag.FlagSet, opts *RateLimitOptions) {
+	fs.Float64Var(&opts.MaxRequestsPerSecond, "max-requests-per-second", 0,
+		"Maximum rate of requests to source registries, shared by all registries without their own "+
+			"maxRequestsPerSecond in the images file (0 means no limit)")
+	fs.Var(&opts.MaxBandwidth, "max-bandwidth",
+		"Maximum bandwidth of pulling from source registries, e.g. 50Mbps or 5MBps, shared by all registries "+
+			"without their own maxBandwidth in the images file (no limit if not set)")
+}
+
+func (opts RateLimitOptions) validate() error {
+	if opts.MaxRequestsPerSecond < 0 {
+		return errors.New("--max-requests-per-second must not be negative")
+	}
+	return nil
+}
+
+// sharedRateLimiter returns the rate limiter shared by all source registries, which registries that
+// configure their own limits override via httputils.RateLimiter.WithLimits.
+func (opts RateLimitOptions) sharedRateLimiter() *httputils.RateLimiter {
+	return httputils.NewRateLimiter(opts.MaxRequestsPerSecond, opts.MaxBandwidth.BytesPerSecond)
+}
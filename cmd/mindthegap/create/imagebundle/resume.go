@@ -0,0 +1,151 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/mesosphere/mindthegap/images/platform"
+)
+
+// resumeStateFileName is the name of the file in the bundle directory that progress is persisted to.
+// It is excluded when the bundle directory is archived so it is never included in the bundle.
+const resumeStateFileName = ".mindthegap-resume.json"
+
+// resumeState is the progress of creating a bundle, persisted in the bundle directory after every
+// completed image so that an interrupted run can be resumed via --resume-from-dir, skipping images
+// that have already been written to the bundle directory. A nil resumeState persists nothing.
+type resumeState struct {
+	mu   sync.Mutex
+	file string
+
+	Layout string `json:"layout"`
+	// CompletedImages maps images that have been completely written to the bundle directory, by
+	// source image name, to the digests of their manifest lists and the bundled platforms.
+	CompletedImages map[string]completedImage `json:"completedImages"`
+}
+
+type completedImage struct {
+	Digest    string   `json:"digest"`
+	Platforms []string `json:"platforms,omitempty"`
+}
+
+// loadResumeState loads the progress persisted in the bundle directory, if any. It is an error to
+// resume a bundle directory created with a different layout, or to start in a directory that is
+// not empty.
+func loadResumeState(dir string, layout BundleLayout) (*resumeState, error) {
+	s := &resumeState{
+		file:            filepath.Join(dir, resumeStateFileName),
+		Layout:          bundleLayouts[layout][0],
+		CompletedImages: map[string]completedImage{},
+	}
+
+	b, err := os.ReadFile(s.file)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Only start with empty directories, as the directory is archived into the bundle and
+		// removed once the bundle has been created.
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read resume directory: %w", err)
+		}
+		if len(entries) > 0 {
+			return nil, fmt.Errorf(
+				"resume directory %s is not empty and does not contain progress of a previous run",
+				dir,
+			)
+		}
+		// Persist the empty state immediately so the directory can be resumed even if the run is
+		// interrupted before any image has been completed.
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resume state: %w", err)
+	}
+
+	var persisted resumeState
+	if err := json.Unmarshal(b, &persisted); err != nil {
+		return nil, fmt.Errorf("failed to parse resume state %s: %w", s.file, err)
+	}
+	if persisted.Layout != s.Layout {
+		return nil, fmt.Errorf(
+			"cannot resume bundle directory %s created with layout %q using layout %q",
+			dir, persisted.Layout, s.Layout,
+		)
+	}
+	if persisted.CompletedImages != nil {
+		s.CompletedImages = persisted.CompletedImages
+	}
+
+	return s, nil
+}
+
+// completed returns true if the image has already been written to the bundle directory for the
+// same platforms.
+func (s *resumeState) completed(img string, platforms []platform.Platform) bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.CompletedImages[img]
+	return ok && slices.Equal(c.Platforms, platformStrings(platforms))
+}
+
+// markCompleted records that the image has been written to the bundle directory and persists the
+// updated progress.
+func (s *resumeState) markCompleted(img, digest string, platforms []platform.Platform) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.CompletedImages[img] = completedImage{Digest: digest, Platforms: platformStrings(platforms)}
+	return s.save()
+}
+
+// save persists the progress. Callers must hold s.mu unless s is not shared yet.
+func (s *resumeState) save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode resume state: %w", err)
+	}
+	// Write via a temporary file so that an interrupted write never corrupts the persisted state.
+	tempFile := s.file + ".tmp"
+	if err := os.WriteFile(tempFile, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write resume state: %w", err)
+	}
+	if err := os.Rename(tempFile, s.file); err != nil {
+		return fmt.Errorf("failed to write resume state: %w", err)
+	}
+	return nil
+}
+
+// excluded returns true for the persisted progress and its temporary file, which are excluded when
+// archiving the bundle directory.
+func (s *resumeState) excluded(name string) bool {
+	return s != nil && (name == resumeStateFileName || name == resumeStateFileName+".tmp")
+}
+
+func platformStrings(platforms []platform.Platform) []string {
+	strs := make([]string, 0, len(platforms))
+	for _, p := range platforms {
+		strs = append(strs, p.String())
+	}
+	slices.Sort(strs)
+	return strs
+}
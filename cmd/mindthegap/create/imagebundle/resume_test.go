@@ -0,0 +1,131 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/images/platform"
+)
+
+func TestResumeState(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	amd64 := platform.MustParse("linux/amd64")
+	arm64 := platform.MustParse("linux/arm64")
+
+	state, err := loadResumeState(dir, RegistryLayout)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(dir, resumeStateFileName),
+		"state should be persisted immediately so that the directory can be resumed")
+	assert.False(t, state.completed("docker.io/library/nginx:1.21.5", []platform.Platform{amd64}))
+
+	require.NoError(t, state.markCompleted(
+		"docker.io/library/nginx:1.21.5", "sha256:abc", []platform.Platform{arm64, amd64},
+	))
+
+	resumed, err := loadResumeState(dir, RegistryLayout)
+	require.NoError(t, err)
+	assert.True(t, resumed.completed("docker.io/library/nginx:1.21.5", []platform.Platform{amd64, arm64}))
+	assert.False(t, resumed.completed("docker.io/library/nginx:1.21.5", []platform.Platform{amd64}),
+		"images pulled for other platforms must be pulled again")
+	assert.False(t, resumed.completed("docker.io/library/nginx:1.23.0", []platform.Platform{amd64}))
+
+	_, err = loadResumeState(dir, OCILayout)
+	require.ErrorContains(t, err, `created with layout "registry" using layout "oci"`)
+
+	assert.True(t, resumed.excluded(resumeStateFileName))
+	assert.False(t, resumed.excluded("docker/registry/v2/repositories"))
+}
+
+func TestResumeStateNonEmptyDirectory(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "important.txt"), []byte("data"), 0o644))
+
+	_, err := loadResumeState(dir, RegistryLayout)
+	require.ErrorContains(t, err, "is not empty and does not contain progress of a previous run")
+}
+
+func TestNilResumeState(t *testing.T) {
+	t.Parallel()
+
+	var state *resumeState
+	assert.False(t, state.completed("docker.io/library/nginx:1.21.5", nil))
+	require.NoError(t, state.markCompleted("docker.io/library/nginx:1.21.5", "sha256:abc", nil))
+	assert.False(t, state.excluded(resumeStateFileName))
+}
+
+func TestCreateResumeAfterArchiveFailure(t *testing.T) {
+	t.Parallel()
+
+	var unavailable atomic.Bool
+	handler := registry.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unavailable.Load() {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	reg := strings.TrimPrefix(srv.URL, "http://")
+
+	img, err := random.Image(128, 2)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(reg + "/library/image:v1")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	resumeDir := filepath.Join(t.TempDir(), "resume")
+	opts := Options{
+		ImagesConfig: &config.ImagesConfig{
+			reg: {
+				Images: map[string][]string{"library/image": {"v1"}},
+				Proxy:  config.DirectProxy,
+			},
+		},
+		ImagePullConcurrency: 1,
+		ResumeFromDir:        resumeDir,
+	}
+
+	// Archiving fails as the directory of the output file does not exist.
+	opts.OutputFile = filepath.Join(t.TempDir(), "missing", "images.tar")
+	_, err = Create(context.Background(), output.NewDiscardingOutput(), opts)
+	require.ErrorContains(t, err, "failed to create image bundle tarball")
+	require.FileExists(t, filepath.Join(resumeDir, resumeStateFileName),
+		"progress should be kept if archiving fails")
+
+	// The resumed run archives the images pulled before without pulling them again.
+	unavailable.Store(true)
+	opts.OutputFile = filepath.Join(t.TempDir(), "images.tar")
+	_, err = Create(context.Background(), output.NewDiscardingOutput(), opts)
+	require.NoError(t, err)
+	require.NoDirExists(t, resumeDir, "the resume directory should be removed once the bundle has been created")
+
+	bundleDir := t.TempDir()
+	require.NoError(t, archive.UnarchiveToDirectory(opts.OutputFile, bundleDir))
+	assert.NoFileExists(t, filepath.Join(bundleDir, resumeStateFileName),
+		"progress should not be included in the bundle")
+	assert.DirExists(t, filepath.Join(bundleDir, "docker/registry/v2/repositories/library/image/_manifests/tags/v1"))
+}
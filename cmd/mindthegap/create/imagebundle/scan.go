@@ -0,0 +1,184 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/spf13/pflag"
+	"github.com/thediveo/enumflag/v2"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/scan"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+type Scanner enumflag.Flag
+
+const (
+	NoScanner Scanner = iota
+	TrivyScanner
+)
+
+var scanners = map[Scanner][]string{
+	NoScanner:    {"none"},
+	TrivyScanner: {"trivy"},
+}
+
+type ScanAction enumflag.Flag
+
+const (
+	// FailOnFindings fails pulling images with vulnerabilities at or above the severity threshold.
+	FailOnFindings ScanAction = iota
+	// WarnOnFindings only records warnings for images with vulnerabilities at or above the severity
+	// threshold.
+	WarnOnFindings
+)
+
+var scanActions = map[ScanAction][]string{
+	FailOnFindings: {"fail"},
+	WarnOnFindings: {"warn"},
+}
+
+// maxReportedVulnerabilities limits how many vulnerabilities are listed for every image.
+const maxReportedVulnerabilities = 10
+
+// ScanOptions configures scanning images for vulnerabilities before they are added to the bundle.
+type ScanOptions struct {
+	Scanner           Scanner
+	SeverityThreshold string
+	Action            ScanAction
+}
+
+func AddScanFlags(fs *pflag.FlagSet, opts *ScanOptions) {
+	fs.Var(
+		enumflag.New(&opts.Scanner, "string", scanners, enumflag.EnumCaseSensitive),
+		"scan",
+		`scan images for vulnerabilities before adding them to the bundle: one of "none" or "trivy" `+
+			"(requires the trivy binary on the PATH)",
+	)
+	fs.StringVar(&opts.SeverityThreshold, "severity-threshold", scan.SeverityHigh.String(),
+		"Minimum severity of vulnerabilities found by --scan to act on: one of UNKNOWN, LOW, MEDIUM, HIGH or CRITICAL")
+	fs.Var(
+		enumflag.New(&opts.Action, "string", scanActions, enumflag.EnumCaseSensitive),
+		"scan-action",
+		`how to handle images with vulnerabilities at or above --severity-threshold: one of "fail" `+
+			`(handled like images that fail to be pulled, see --on-error) or "warn"`,
+	)
+}
+
+// imageScanner scans the images in an image index for vulnerabilities.
+type imageScanner struct {
+	trivy     *scan.Trivy
+	threshold scan.Severity
+	action    ScanAction
+}
+
+// newImageScanner returns a scanner for the options, or nil if images are not scanned.
+func newImageScanner(opts ScanOptions) (*imageScanner, error) {
+	if opts.Scanner == NoScanner {
+		return nil, nil
+	}
+	threshold, err := scan.ParseSeverity(opts.SeverityThreshold)
+	if err != nil {
+		return nil, err
+	}
+	trivy, err := scan.NewTrivy()
+	if err != nil {
+		return nil, err
+	}
+	return &imageScanner{trivy: trivy, threshold: threshold, action: opts.Action}, nil
+}
+
+// scan scans every image in the index, which is pulled from repository by the scanner itself,
+// failing or recording a warning if any vulnerabilities at or above the threshold are found.
+// Nothing is scanned if s is nil.
+func (s *imageScanner) scan(
+	ctx context.Context,
+	srcImageName, repository string,
+	index v1.ImageIndex,
+	registryConfig config.RegistrySyncConfig,
+	w *warnings.Collector,
+) error {
+	if s == nil {
+		return nil
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return err
+	}
+
+	var creds *scan.Credentials
+	if registryConfig.Credentials != nil && registryConfig.Credentials.Username != "" {
+		creds = &scan.Credentials{
+			Username: registryConfig.Credentials.Username,
+			Password: registryConfig.Credentials.Password,
+		}
+	}
+	insecure := registryConfig.TLSVerify != nil && !*registryConfig.TLSVerify
+
+	found := map[string]scan.Vulnerability{}
+	for _, desc := range indexManifest.Manifests {
+		if !desc.MediaType.IsImage() {
+			continue
+		}
+		vulns, err := s.trivy.Scan(
+			ctx, repository+"@"+desc.Digest.String(), s.threshold, insecure, creds, registryConfig.Proxy,
+		)
+		if err != nil {
+			return err
+		}
+		for _, v := range vulns {
+			found[v.ID+"/"+v.Package] = v
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf(
+		"image %q has %d vulnerabilities of severity %s or higher: %s",
+		srcImageName, len(found), s.threshold, summarizeVulnerabilities(found),
+	)
+	if s.action == WarnOnFindings {
+		return w.Warnf(warnings.Vulnerability, "%s", msg)
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// summarizeVulnerabilities lists the most severe vulnerabilities, e.g.
+// CVE-2022-0001 (CRITICAL, openssl 1.1.1k, fixed in 1.1.1n).
+func summarizeVulnerabilities(found map[string]scan.Vulnerability) string {
+	vulns := make([]scan.Vulnerability, 0, len(found))
+	for _, v := range found {
+		vulns = append(vulns, v)
+	}
+	sort.Slice(vulns, func(i, j int) bool {
+		if vulns[i].Severity != vulns[j].Severity {
+			return vulns[i].Severity > vulns[j].Severity
+		}
+		if vulns[i].ID != vulns[j].ID {
+			return vulns[i].ID < vulns[j].ID
+		}
+		return vulns[i].Package < vulns[j].Package
+	})
+
+	summaries := make([]string, 0, min(len(vulns), maxReportedVulnerabilities)+1)
+	for _, v := range vulns[:min(len(vulns), maxReportedVulnerabilities)] {
+		summary := fmt.Sprintf("%s (%s, %s %s", v.ID, v.Severity, v.Package, v.InstalledVersion)
+		if v.FixedVersion != "" {
+			summary += ", fixed in " + v.FixedVersion
+		}
+		summaries = append(summaries, summary+")")
+	}
+	if len(vulns) > maxReportedVulnerabilities {
+		summaries = append(summaries, fmt.Sprintf("and %d more", len(vulns)-maxReportedVulnerabilities))
+	}
+	return strings.Join(summaries, ", ")
+}
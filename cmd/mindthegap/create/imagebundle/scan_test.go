@@ -0,0 +1,82 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/scan"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+func TestImageScanner(t *testing.T) {
+	t.Parallel()
+
+	trivy := filepath.Join(t.TempDir(), "trivy")
+	require.NoError(t, os.WriteFile(trivy, []byte(`#!/bin/sh
+cat <<EOF
+{"Results": [{"Vulnerabilities": [
+  {"VulnerabilityID": "CVE-2022-0002", "PkgName": "zlib", "InstalledVersion": "1.2.11", "Severity": "HIGH"},
+  {"VulnerabilityID": "CVE-2022-0001", "PkgName": "openssl", "InstalledVersion": "1.1.1k",
+   "FixedVersion": "1.1.1n", "Severity": "CRITICAL"}
+]}]}
+EOF
+`), 0o700))
+
+	img, err := random.Image(128, 1)
+	require.NoError(t, err)
+	index := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img})
+
+	const want = `image "example.com/image:v1" has 2 vulnerabilities of severity HIGH or higher: ` +
+		`CVE-2022-0001 (CRITICAL, openssl 1.1.1k, fixed in 1.1.1n), CVE-2022-0002 (HIGH, zlib 1.2.11)`
+
+	tests := []struct {
+		name         string
+		scanner      *imageScanner
+		wantErr      string
+		wantWarnings []warnings.Warning
+	}{{
+		name: "no scanner",
+	}, {
+		name: "fail",
+		scanner: &imageScanner{
+			trivy: &scan.Trivy{Binary: trivy}, threshold: scan.SeverityHigh, action: FailOnFindings,
+		},
+		wantErr: want,
+	}, {
+		name: "warn",
+		scanner: &imageScanner{
+			trivy: &scan.Trivy{Binary: trivy}, threshold: scan.SeverityHigh, action: WarnOnFindings,
+		},
+		wantWarnings: []warnings.Warning{{Kind: warnings.Vulnerability, Message: want}},
+	}}
+	for ti := range tests {
+		tt := tests[ti]
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			w := warnings.NewCollector(false)
+			err := tt.scanner.scan(
+				context.Background(), "example.com/image:v1", "example.com/image", index,
+				config.RegistrySyncConfig{}, w,
+			)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.ElementsMatch(t, tt.wantWarnings, w.Warnings())
+		})
+	}
+}
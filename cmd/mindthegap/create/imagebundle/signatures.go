@@ -0,0 +1,131 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/mesosphere/mindthegap/notation"
+	"github.com/mesosphere/mindthegap/signing"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+// verifyNotationSignatures verifies the Notation signatures of the source image with the trust
+// policy applying to scope. Signatures of srcDigest, the digest of the source manifest that index
+// has been read from, are verified, as the bundled index may differ if platforms have been removed
+// from it. Nothing is verified if v is nil.
+func verifyNotationSignatures(
+	v *notation.Verifier,
+	srcImageName string,
+	srcDigest v1.Hash,
+	scope string,
+	index v1.ImageIndex,
+	w *warnings.Collector,
+	srcRemoteOpts ...remote.Option,
+) error {
+	if v == nil {
+		return nil
+	}
+
+	ref, err := sourceReferenceToVerify(srcImageName, srcDigest)
+	if err != nil {
+		return err
+	}
+
+	return v.VerifyImage(ref.Context().Digest(srcDigest.String()), scope, index, w, srcRemoteOpts...)
+}
+
+// verifySignaturePolicy verifies that the source image is accepted by the signature policy before
+// it is copied into the bundle. The policy is applied to the image as referenced, verifying the
+// signatures of srcDigest, the digest of the source manifest that is copied, rather than of
+// whatever the reference points to by the time it is verified. Nothing is verified if p is nil.
+func verifySignaturePolicy(
+	p *signing.Policy,
+	srcImageName string,
+	srcDigest v1.Hash,
+	srcRemoteOpts ...remote.Option,
+) error {
+	if p == nil {
+		return nil
+	}
+
+	ref, err := sourceReferenceToVerify(srcImageName, srcDigest)
+	if err != nil {
+		return err
+	}
+
+	return p.VerifyImage(ref, srcDigest, srcRemoteOpts...)
+}
+
+// sourceReferenceToVerify parses the reference of the source image, failing if the image has not
+// been read from a registry, i.e. has no digest, as its signatures cannot be verified then.
+func sourceReferenceToVerify(srcImageName string, srcDigest v1.Hash) (name.Reference, error) {
+	ref, err := name.ParseReference(srcImageName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference %q: %w", srcImageName, err)
+	}
+	if srcDigest == (v1.Hash{}) {
+		return nil, fmt.Errorf(
+			"signatures of image %q cannot be verified, as it has been read from the local Docker daemon",
+			srcImageName,
+		)
+	}
+	return ref, nil
+}
+
+// bundleNotationSignatures copies the Notation signatures of the bundled index and of every manifest
+// in it from the source image to the bundled image. Signatures of the source index are not bundled
+// if platforms have been removed from it, as the bundled index has a different digest.
+func bundleNotationSignatures(
+	srcImageName string,
+	srcDigest v1.Hash,
+	index v1.ImageIndex,
+	destImageName string,
+	w *warnings.Collector,
+	srcRemoteOpts []remote.Option,
+	destRemoteOpts []remote.Option,
+) error {
+	srcRef, err := name.ParseReference(srcImageName)
+	if err != nil {
+		return fmt.Errorf("invalid image reference %q: %w", srcImageName, err)
+	}
+	destRef, err := name.ParseReference(destImageName, name.StrictValidation)
+	if err != nil {
+		return err
+	}
+
+	subjects, err := notation.Subjects(index)
+	if err != nil {
+		return err
+	}
+	if _, err := notation.CopySignatures(
+		srcRef.Context(), srcRemoteOpts, destRef.Context(), destRemoteOpts, subjects...,
+	); err != nil {
+		return err
+	}
+
+	// Digest references are already warned about if the digest changes.
+	if _, isTag := srcRef.(name.Tag); !isTag {
+		return nil
+	}
+	if srcDigest == (v1.Hash{}) || srcDigest == subjects[0] {
+		return nil
+	}
+	sigs, err := notation.Signatures(srcRef.Context().Digest(srcDigest.String()), srcRemoteOpts...)
+	if err != nil {
+		return err
+	}
+	if len(sigs) > 0 {
+		return w.Warnf(
+			warnings.DigestNotFound,
+			"Notation signatures of image index %q are not bundled, as platforms have been removed from it",
+			srcImageName,
+		)
+	}
+	return nil
+}
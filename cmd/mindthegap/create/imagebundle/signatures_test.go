@@ -0,0 +1,133 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/signing"
+)
+
+// cosignSign pushes a sigstore signature of the manifest of ref, like cosign sign does.
+func cosignSign(t *testing.T, key *ecdsa.PrivateKey, ref name.Reference, manifest v1.Hash) {
+	t.Helper()
+
+	payload := []byte(fmt.Sprintf(
+		`{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},`+
+			`"type":"cosign container image signature"},"optional":null}`,
+		ref.Name(), manifest,
+	))
+	digest := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(payload, types.MediaType("application/vnd.dev.cosign.simplesigning.v1+json")),
+		Annotations: map[string]string{"dev.cosignproject.cosign/signature": base64.StdEncoding.EncodeToString(sig)},
+	})
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref.Context().Tag(fmt.Sprintf("sha256-%s.sig", manifest.Hex)), img))
+}
+
+func TestCreateSignaturePolicyVerifiesCopiedManifest(t *testing.T) {
+	t.Parallel()
+
+	var (
+		moveTag  sync.Once
+		moveErr  error
+		handler  = registry.New()
+		imageRef name.Reference
+		signed   v1.Image
+	)
+	// The tag is moved to a signed image right after the unsigned image it points to has been read.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/manifests/v1") {
+			moveTag.Do(func() { moveErr = remote.Write(imageRef, signed) })
+		}
+	}))
+	t.Cleanup(srv.Close)
+	reg := strings.TrimPrefix(srv.URL, "http://")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "cosign.pub")
+	require.NoError(
+		t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600),
+	)
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(policyFile, []byte(fmt.Sprintf(
+		`{"default": [{"type": "sigstoreSigned", "keyPath": %q}]}`, keyFile,
+	)), 0o600))
+
+	imageRef, err = name.ParseReference(reg + "/library/image:v1")
+	require.NoError(t, err)
+	signed, err = random.Image(128, 1)
+	require.NoError(t, err)
+	signedDigest, err := signed.Digest()
+	require.NoError(t, err)
+	cosignSign(t, key, imageRef, signedDigest)
+	unsigned, err := random.Image(128, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(imageRef, unsigned))
+
+	_, err = Create(context.Background(), output.NewDiscardingOutput(), Options{
+		OutputFile: filepath.Join(t.TempDir(), "images.tar"),
+		ImagesConfig: &config.ImagesConfig{
+			reg: {
+				Images: map[string][]string{"library/image": {"v1"}},
+				Proxy:  config.DirectProxy,
+			},
+		},
+		ImagePullConcurrency: 1,
+		SignaturePolicyFile:  policyFile,
+	})
+	require.NoError(t, moveErr)
+	require.ErrorIs(t, err, signing.ErrRejected, "the unsigned image that has been read should be verified")
+	require.ErrorContains(t, err, "no sigstore signatures found")
+
+	// The signed image the tag has been moved to is accepted.
+	_, err = Create(context.Background(), output.NewDiscardingOutput(), Options{
+		OutputFile: filepath.Join(t.TempDir(), "images.tar"),
+		ImagesConfig: &config.ImagesConfig{
+			reg: {
+				Images: map[string][]string{"library/image": {"v1"}},
+				Proxy:  config.DirectProxy,
+			},
+		},
+		ImagePullConcurrency: 1,
+		SignaturePolicyFile:  policyFile,
+	})
+	require.NoError(t, err)
+}
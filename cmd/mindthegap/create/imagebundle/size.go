@@ -0,0 +1,371 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/go-units"
+	"github.com/google/go-containerregistry/pkg/authn"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/pflag"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/images"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+// largestImagesToReport is the number of largest images reported when the bundle size budget is
+// exceeded.
+const largestImagesToReport = 5
+
+// AddBundleSizeFlags adds the flags to limit the size of the bundle and to only estimate it.
+func AddBundleSizeFlags(fs *pflag.FlagSet, maxBundleSize *resource.QuantityValue, dryRun *bool) {
+	fs.Var(maxBundleSize, "max-bundle-size",
+		"Fail before pulling any images if the bundle size, estimated from image manifests, exceeds this size, "+
+			"e.g. 10Gi (0 means no limit)")
+	fs.BoolVar(dryRun, "dry-run", false,
+		"Only estimate and report the bundle size without pulling any images, warning instead of failing if "+
+			"--max-bundle-size or the maxSize of any image is exceeded")
+}
+
+// imageBlobSizes returns the sizes of all blobs that are stored in a bundle for the image index,
+// keyed by digest: the index itself and the manifests, configs and layers of all of its images,
+// recursing into nested indexes. Only manifests are read, no layers are pulled. Non-distributable
+// layers are only included if includeNonDistributable is set, as they are not bundled otherwise.
+func imageBlobSizes(index v1.ImageIndex, includeNonDistributable bool) (map[v1.Hash]int64, error) {
+	sizes := map[v1.Hash]int64{}
+	if err := addImageIndexBlobSizes(index, sizes, includeNonDistributable); err != nil {
+		return nil, err
+	}
+	return sizes, nil
+}
+
+// artifactBlobSizes returns the sizes of all blobs that are stored in a bundle for the OCI artifact,
+// which is either a v1.Image or v1.ImageIndex.
+func artifactBlobSizes(
+	artifact remote.Taggable,
+	includeNonDistributable bool,
+) (map[v1.Hash]int64, error) {
+	switch a := artifact.(type) {
+	case v1.ImageIndex:
+		return imageBlobSizes(a, includeNonDistributable)
+	case v1.Image:
+		sizes := map[v1.Hash]int64{}
+		if err := addImageBlobSizes(a, sizes, includeNonDistributable); err != nil {
+			return nil, err
+		}
+		return sizes, nil
+	default:
+		return nil, fmt.Errorf("unsupported artifact type %T", artifact)
+	}
+}
+
+func addImageBlobSizes(img v1.Image, sizes map[v1.Hash]int64, includeNonDistributable bool) error {
+	digest, err := img.Digest()
+	if err != nil {
+		return fmt.Errorf("failed to read image digest: %w", err)
+	}
+	size, err := img.Size()
+	if err != nil {
+		return fmt.Errorf("failed to read image size: %w", err)
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return fmt.Errorf("failed to read manifest of image %s: %w", digest, err)
+	}
+	sizes[digest] = size
+	sizes[manifest.Config.Digest] = manifest.Config.Size
+	addLayerSizes(manifest.Layers, sizes, includeNonDistributable)
+	return nil
+}
+
+func addLayerSizes(layers []v1.Descriptor, sizes map[v1.Hash]int64, includeNonDistributable bool) {
+	for _, layer := range layers {
+		if includeNonDistributable || layer.MediaType.IsDistributable() {
+			sizes[layer.Digest] = layer.Size
+		}
+	}
+}
+
+func addImageIndexBlobSizes(
+	index v1.ImageIndex,
+	sizes map[v1.Hash]int64,
+	includeNonDistributable bool,
+) error {
+	digest, err := index.Digest()
+	if err != nil {
+		return fmt.Errorf("failed to read image index digest: %w", err)
+	}
+	size, err := index.Size()
+	if err != nil {
+		return fmt.Errorf("failed to read image index size: %w", err)
+	}
+	sizes[digest] = size
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return fmt.Errorf("failed to read image index manifest: %w", err)
+	}
+	for _, desc := range indexManifest.Manifests {
+		switch {
+		case desc.MediaType.IsIndex():
+			childIndex, err := index.ImageIndex(desc.Digest)
+			if err != nil {
+				return fmt.Errorf("failed to read image index %s: %w", desc.Digest, err)
+			}
+			if err := addImageIndexBlobSizes(childIndex, sizes, includeNonDistributable); err != nil {
+				return err
+			}
+		case desc.MediaType.IsImage():
+			img, err := index.Image(desc.Digest)
+			if err != nil {
+				return fmt.Errorf("failed to read image %s: %w", desc.Digest, err)
+			}
+			manifest, err := img.Manifest()
+			if err != nil {
+				return fmt.Errorf("failed to read manifest of image %s: %w", desc.Digest, err)
+			}
+			sizes[desc.Digest] = desc.Size
+			sizes[manifest.Config.Digest] = manifest.Config.Size
+			addLayerSizes(manifest.Layers, sizes, includeNonDistributable)
+		default:
+			sizes[desc.Digest] = desc.Size
+		}
+	}
+	return nil
+}
+
+func sumSizes(sizes map[v1.Hash]int64) int64 {
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+	return total
+}
+
+type imageSize struct {
+	image string
+	size  int64
+}
+
+// bundleSizeEstimate estimates the size of a bundle from the sizes of the blobs of its images.
+// Blobs shared by multiple images are only stored once and only counted once.
+type bundleSizeEstimate struct {
+	mu     sync.Mutex
+	blobs  map[v1.Hash]int64
+	images []imageSize
+}
+
+func newBundleSizeEstimate() *bundleSizeEstimate {
+	return &bundleSizeEstimate{blobs: map[v1.Hash]int64{}}
+}
+
+func (e *bundleSizeEstimate) add(image string, blobs map[v1.Hash]int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for digest, size := range blobs {
+		e.blobs[digest] = size
+	}
+	e.images = append(e.images, imageSize{image: image, size: sumSizes(blobs)})
+}
+
+func (e *bundleSizeEstimate) total() int64 {
+	return sumSizes(e.blobs)
+}
+
+// largestImages returns the n largest images, sorted by decreasing size and then by name.
+func (e *bundleSizeEstimate) largestImages(n int) []imageSize {
+	sorted := append([]imageSize(nil), e.images...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].size != sorted[j].size {
+			return sorted[i].size > sorted[j].size
+		}
+		return sorted[i].image < sorted[j].image
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+func formatSize(size int64) string {
+	return units.BytesSize(float64(size))
+}
+
+// estimateBundleSize reads the manifests of all images in cfg to estimate the size of the bundle,
+// returning an error if any image exceeds its configured maxSize. Local images are not included
+// in the estimate.
+func estimateBundleSize(
+	ctx context.Context,
+	cfg config.ImagesConfig,
+	opts Options,
+	defaultKeychain authn.Keychain,
+	w *warnings.Collector,
+) (*bundleSizeEstimate, error) {
+	estimate := newBundleSizeEstimate()
+
+	var (
+		oversizedMu sync.Mutex
+		oversized   []error
+	)
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(opts.ImagePullConcurrency)
+
+	sharedRateLimiter := opts.RateLimits.sharedRateLimiter()
+
+	for _, registryName := range cfg.SortedRegistryNames() {
+		registryConfig := cfg[registryName]
+
+		_, sourceRemoteOpts, err := sourceRemoteOptions(
+			registryName,
+			registryConfig,
+			defaultKeychain,
+			opts.ClockSkewTolerance,
+			sharedRateLimiter.WithLimits(registryConfig.MaxRequestsPerSecond, registryConfig.MaxBandwidth),
+		)
+		if err != nil {
+			_ = eg.Wait()
+			return nil, err
+		}
+		sourceRemoteOpts = append(sourceRemoteOpts, remote.WithContext(egCtx))
+
+		for _, imageName := range registryConfig.SortedImageNames() {
+			maxSize, hasMaxSize := registryConfig.ImageMaxSizes[imageName]
+			artifact := registryConfig.ImageArtifacts[imageName]
+			platforms := registryConfig.PlatformsForImage(
+				imageName,
+				opts.Platforms,
+				opts.PlatformsRequested,
+			)
+
+			for _, imageTag := range registryConfig.Images[imageName] {
+				srcImageName := fmt.Sprintf("%s/%s:%s", registryName, imageName, imageTag)
+
+				eg.Go(func() error {
+					imageIndex, artifactImage, _, err := images.ImageOrArtifactForImage(
+						srcImageName,
+						platforms,
+						artifact,
+						w,
+						sourceRemoteOpts...,
+					)
+					if err != nil {
+						return err
+					}
+					var blobs map[v1.Hash]int64
+					if artifactImage != nil {
+						blobs, err = artifactBlobSizes(artifactImage, opts.IncludeNonDistributable)
+					} else {
+						blobs, err = imageBlobSizes(imageIndex, opts.IncludeNonDistributable)
+					}
+					if err != nil {
+						return fmt.Errorf("failed to determine size of image %q: %w", srcImageName, err)
+					}
+					estimate.add(srcImageName, blobs)
+
+					if size := sumSizes(blobs); hasMaxSize && size > maxSize {
+						oversizedMu.Lock()
+						defer oversizedMu.Unlock()
+						oversized = append(oversized, fmt.Errorf(
+							"image %q is %s, exceeding its maxSize of %s",
+							srcImageName,
+							formatSize(size),
+							formatSize(maxSize),
+						))
+					}
+					return nil
+				})
+			}
+		}
+	}
+
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(oversized, func(i, j int) bool { return oversized[i].Error() < oversized[j].Error() })
+	return estimate, errors.Join(oversized...)
+}
+
+// checkBundleSize estimates the size of the bundle and fails fast if it exceeds the configured
+// budgets, or only warns about exceeded budgets and reports the estimate if dry-running.
+func checkBundleSize(
+	ctx context.Context,
+	out output.Output,
+	cfg config.ImagesConfig,
+	opts Options,
+	numLocalImages int,
+	defaultKeychain authn.Keychain,
+	w *warnings.Collector,
+) error {
+	// Warnings are recorded when the images are pulled, unless dry-running when they are not.
+	sizingWarnings := warnings.NewCollector(false)
+	if opts.DryRun {
+		sizingWarnings = w
+	}
+
+	out.StartOperation("Estimating bundle size")
+	estimate, err := estimateBundleSize(ctx, cfg, opts, defaultKeychain, sizingWarnings)
+	if estimate == nil {
+		out.EndOperationWithStatus(output.Failure())
+		return err
+	}
+	var budgetErrs []error
+	if err != nil {
+		budgetErrs = append(budgetErrs, err)
+	}
+	total := estimate.total()
+	if opts.MaxBundleSize > 0 && total > opts.MaxBundleSize {
+		largest := estimate.largestImages(largestImagesToReport)
+		largestStrs := make([]string, 0, len(largest))
+		for _, img := range largest {
+			largestStrs = append(largestStrs, fmt.Sprintf("%s (%s)", img.image, formatSize(img.size)))
+		}
+		budgetErrs = append(budgetErrs, fmt.Errorf(
+			"estimated bundle size of %s exceeds the maximum bundle size of %s, largest images: %s",
+			formatSize(total),
+			formatSize(opts.MaxBundleSize),
+			strings.Join(largestStrs, ", "),
+		))
+	}
+
+	if !opts.DryRun {
+		if len(budgetErrs) > 0 {
+			out.EndOperationWithStatus(output.Failure())
+			return errors.Join(budgetErrs...)
+		}
+		out.EndOperationWithStatus(output.Success())
+		out.V(2).Infof("Estimated bundle size: %s", formatSize(total))
+		return nil
+	}
+
+	out.EndOperationWithStatus(output.Success())
+	sort.Slice(estimate.images, func(i, j int) bool {
+		return estimate.images[i].image < estimate.images[j].image
+	})
+	for _, img := range estimate.images {
+		out.Infof("%s: %s", img.image, formatSize(img.size))
+	}
+	msg := fmt.Sprintf("Estimated bundle size: %s (%d images)", formatSize(total), len(estimate.images))
+	if numLocalImages > 0 {
+		msg += fmt.Sprintf(", excluding %d local images", numLocalImages)
+	}
+	out.Info(msg)
+	for _, err := range budgetErrs {
+		out.Warnf("WARNING: %v", err)
+	}
+	return nil
+}
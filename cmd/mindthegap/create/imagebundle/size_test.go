@@ -0,0 +1,75 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageBlobSizes(t *testing.T) {
+	t.Parallel()
+
+	img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	childIndex, err := random.Index(512, 1, 1)
+	require.NoError(t, err)
+	index := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: img},
+		mutate.IndexAddendum{Add: childIndex},
+	)
+
+	sizes, err := imageBlobSizes(index, false)
+	require.NoError(t, err)
+
+	want := map[v1.Hash]int64{}
+	addBlob := func(digest func() (v1.Hash, error), size func() (int64, error)) {
+		d, err := digest()
+		require.NoError(t, err)
+		s, err := size()
+		require.NoError(t, err)
+		want[d] = s
+	}
+	addImage := func(img v1.Image) {
+		addBlob(img.Digest, img.Size)
+		m, err := img.Manifest()
+		require.NoError(t, err)
+		want[m.Config.Digest] = m.Config.Size
+		for _, l := range m.Layers {
+			want[l.Digest] = l.Size
+		}
+	}
+	addBlob(index.Digest, index.Size)
+	addImage(img)
+	addBlob(childIndex.Digest, childIndex.Size)
+	childManifest, err := childIndex.IndexManifest()
+	require.NoError(t, err)
+	for _, desc := range childManifest.Manifests {
+		childImg, err := childIndex.Image(desc.Digest)
+		require.NoError(t, err)
+		addImage(childImg)
+	}
+
+	assert.Equal(t, want, sizes)
+	assert.Len(t, sizes, 1+4+1+3)
+}
+
+func TestBundleSizeEstimate(t *testing.T) {
+	t.Parallel()
+
+	shared := v1.Hash{Algorithm: "sha256", Hex: "shared"}
+	e := newBundleSizeEstimate()
+	e.add("small", map[v1.Hash]int64{shared: 100, {Algorithm: "sha256", Hex: "a"}: 10})
+	e.add("large", map[v1.Hash]int64{shared: 100, {Algorithm: "sha256", Hex: "b"}: 50})
+	e.add("medium", map[v1.Hash]int64{{Algorithm: "sha256", Hex: "c"}: 120})
+
+	assert.EqualValues(t, 100+10+50+120, e.total())
+	assert.Equal(t, []imageSize{{image: "large", size: 150}, {image: "medium", size: 120}}, e.largestImages(2))
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/config"
+)
+
+const ociLayoutIndexFile = "index.json"
+
+// bundleMetadataFiles are the files describing the contents of a bundle, which are rewritten when
+// images are appended to the bundle. All other files in bundles are content-addressed or only
+// describe a single image, so files that a bundle already contains are never appended again.
+var bundleMetadataFiles = []string{
+	"images.yaml",
+	"charts.yaml",
+	utils.BundleManifestFileName,
+	utils.BundleMetadataFileName,
+	utils.InstructionsFileName,
+	utils.RepoRewritesFileName,
+	ociLayoutIndexFile,
+}
+
+// existingBundle is an existing uncompressed bundle that new images are appended to in place.
+type existingBundle struct {
+	archive *archive.AppendableArchive
+	layout  BundleLayout
+	// metadataDir contains the metadata files of the bundle.
+	metadataDir string
+	imagesCfg   config.ImagesConfig
+	chartsCfg   *config.HelmChartsConfig
+	// hasRepoRewrites is true if repository rewrite rules were applied when creating the bundle.
+	hasRepoRewrites bool
+}
+
+// openExistingBundle reads the contents of the bundle, extracting its metadata files to metadataDir.
+func openExistingBundle(bundleFile, metadataDir string) (*existingBundle, error) {
+	a, err := archive.OpenAppendable(bundleFile, metadataDir, bundleMetadataFiles...)
+	if err != nil {
+		if errors.Is(err, archive.ErrCompressedArchive) {
+			return nil, fmt.Errorf(
+				"%w: only uncompressed bundles can be updated, create the bundle with --compression=none",
+				err,
+			)
+		}
+		if errors.Is(err, archive.ErrSplitArchive) {
+			return nil, fmt.Errorf(
+				"%w: only bundles that are not split can be updated, create the bundle without --split-size",
+				err,
+			)
+		}
+		return nil, err
+	}
+
+	b := &existingBundle{
+		archive:         a,
+		metadataDir:     metadataDir,
+		imagesCfg:       config.ImagesConfig{},
+		hasRepoRewrites: a.Contains(utils.RepoRewritesFileName),
+	}
+	if a.Contains(ocispec.ImageLayoutFile) {
+		b.layout = OCILayout
+	}
+
+	if a.Contains("images.yaml") {
+		b.imagesCfg, err = config.ParseImagesConfigFile(filepath.Join(metadataDir, "images.yaml"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse images config of existing bundle: %w", err)
+		}
+	}
+	if a.Contains("charts.yaml") {
+		chartsCfg, err := config.ParseHelmChartsConfigFile(filepath.Join(metadataDir, "charts.yaml"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Helm charts config of existing bundle: %w", err)
+		}
+		b.chartsCfg = &chartsCfg
+	}
+	return b, nil
+}
+
+// newImages returns the config of the images in cfg that the bundle does not contain yet.
+func (b *existingBundle) newImages(cfg config.ImagesConfig) config.ImagesConfig {
+	newCfg := make(config.ImagesConfig, len(cfg))
+	for registryName, rsc := range cfg {
+		existingImages := b.imagesCfg[registryName].Images
+		newRSC := rsc.Clone()
+		for imageName, imageTags := range rsc.Images {
+			var newTags []string
+			for _, imageTag := range imageTags {
+				if !slices.Contains(existingImages[imageName], imageTag) {
+					newTags = append(newTags, imageTag)
+				}
+			}
+			if len(newTags) == 0 {
+				delete(newRSC.Images, imageName)
+				continue
+			}
+			newRSC.Images[imageName] = newTags
+		}
+		if len(newRSC.Images) > 0 {
+			newCfg[registryName] = newRSC
+		}
+	}
+	return newCfg
+}
+
+// writeMetadata writes the metadata files of the bundle including the new images in cfg to
+// bundleDir and returns the config of all images in the bundle.
+func (b *existingBundle) writeMetadata(bundleDir, bundleFile string, cfg config.ImagesConfig) (
+	config.ImagesConfig, error,
+) {
+	bundleCfg := *b.imagesCfg.Merge(cfg)
+
+	if err := config.WriteSanitizedImagesConfig(bundleCfg, filepath.Join(bundleDir, "images.yaml")); err != nil {
+		return nil, err
+	}
+	if err := utils.WriteBundleInstructions(bundleDir, bundleFile, &bundleCfg, b.chartsCfg); err != nil {
+		return nil, err
+	}
+	if b.archive.Contains(utils.BundleManifestFileName) {
+		if err := utils.WriteBundleManifest(bundleDir, &bundleCfg, b.chartsCfg); err != nil {
+			return nil, err
+		}
+	}
+	if b.layout == OCILayout {
+		if err := b.mergeOCILayoutIndex(bundleDir); err != nil {
+			return nil, err
+		}
+	}
+	return bundleCfg, nil
+}
+
+// mergeOCILayoutIndex adds the images in the OCI layout index of the bundle to the index of the
+// OCI layout in bundleDir, which only contains the new images.
+func (b *existingBundle) mergeOCILayoutIndex(bundleDir string) error {
+	existingIndex, err := readOCILayoutIndex(b.metadataDir)
+	if err != nil {
+		return fmt.Errorf("failed to read OCI layout index of existing bundle: %w", err)
+	}
+	newIndex, err := readOCILayoutIndex(bundleDir)
+	if err != nil {
+		return err
+	}
+
+	newIndex.Manifests = append(existingIndex.Manifests, newIndex.Manifests...)
+	bs, err := json.MarshalIndent(newIndex, "", "   ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal OCI layout index: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(bundleDir, ociLayoutIndexFile), bs, 0o644); err != nil {
+		return fmt.Errorf("failed to write OCI layout index: %w", err)
+	}
+	return nil
+}
+
+func readOCILayoutIndex(dir string) (*v1.IndexManifest, error) {
+	f, err := os.Open(filepath.Join(dir, ociLayoutIndexFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return v1.ParseIndexManifest(f)
+}
+
+// append appends the new contents of bundleDir to the bundle, replacing its metadata files.
+func (b *existingBundle) append(bundleDir string) error {
+	return b.archive.AppendDirectory(bundleDir, func(name string) bool {
+		return slices.Contains(bundleMetadataFiles, name)
+	})
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/thediveo/enumflag/v2"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/progress"
+	"github.com/mesosphere/mindthegap/images/authnhelpers"
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/metrics"
+)
+
+// NewUpdateCommand returns the command to append new images to an existing image bundle in place.
+func NewUpdateCommand(out output.Output) *cobra.Command {
+	var (
+		bundleFile           string
+		configFile           string
+		platforms            []platform.Platform
+		imagePullConcurrency int
+		progressMode         progress.Mode
+		strict               bool
+		onError              = Fail
+		errorReportFile      string
+		failOnAnyError       bool
+		blobCacheDir         string
+		perImageTimeout      time.Duration
+		stallTimeout         time.Duration
+		stallRetries         int
+		registryAuthFile     string
+		credentialOpts       authnhelpers.CredentialOptions
+		clockSkewTolerance   time.Duration
+		listenAddress        string
+		listenPortRange      flags.PortRange
+		includeSignatures    bool
+		repoRewriteRulesFile string
+		requireAllPlatforms  bool
+		scanOpts             ScanOptions
+		rateLimits           RateLimitOptions
+		annotations          flags.Annotations
+		signKey              string
+
+		includeNonDistributable bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "image-bundle",
+		Short: "Add images to an existing image bundle in place",
+		Long: "Add the images in the images file that an existing uncompressed image bundle does not contain " +
+			"yet to the bundle in place, appending only the new blobs and rewriting the bundle metadata, " +
+			"rather than creating the whole bundle again",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := cmd.ValidateRequiredFlags(); err != nil {
+				return err
+			}
+
+			return flags.ValidateFlagsThatRequireValues(cmd, "image-bundle", "images-file")
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := Create(cmd.Context(), out, Options{
+				ConfigFile:           configFile,
+				OutputFile:           bundleFile,
+				Update:               true,
+				Platforms:            platforms,
+				PlatformsRequested:   cmd.Flags().Changed("platform"),
+				ListenAddress:        listenAddress,
+				ListenPortRange:      listenPortRange,
+				RepoRewriteRulesFile: repoRewriteRulesFile,
+				Scan:                 scanOpts,
+				RateLimits:           rateLimits,
+				Annotations:          annotations,
+				SignKey:              signKey,
+				RequireAllPlatforms:  requireAllPlatforms,
+				ImagePullConcurrency: imagePullConcurrency,
+				Strict:               strict,
+				OnError:              onError,
+				ErrorReportFile:      errorReportFile,
+				FailOnAnyError:       failOnAnyError,
+				BlobCacheDir:         blobCacheDir,
+				PerImageTimeout:      perImageTimeout,
+				StallTimeout:         stallTimeout,
+				StallRetries:         stallRetries,
+				RegistryAuthFile:     registryAuthFile,
+				Credentials:          credentialOpts,
+				ClockSkewTolerance:   clockSkewTolerance,
+				Reporter:             progress.NewReporter(progressMode, cmd.OutOrStdout()),
+				Metrics:              metrics.FromContext(cmd.Context()),
+
+				IncludeNotationSignatures: includeSignatures,
+
+				IncludeNonDistributable: includeNonDistributable,
+			})
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&bundleFile, "image-bundle", "",
+		"Uncompressed image bundle to add images to")
+	_ = cmd.MarkFlagRequired("image-bundle")
+	cmd.Flags().StringVar(&configFile, "images-file", "",
+		"File containing list of images to add to the bundle, either as YAML configuration or a simple list of "+
+			"images (images that are already in the bundle are skipped)")
+	_ = cmd.MarkFlagRequired("images-file")
+	cmd.Flags().
+		Var(flags.NewPlatformsOrAllValue([]platform.Platform{platform.MustParse("linux/amd64")}, &platforms), "platform",
+			"platforms to download images (required format: <os>/<arch>[/<variant>][:<os.version>]), or \"all\" to bundle every "+
+				"platform of every image with its complete manifest list")
+	cmd.Flags().BoolVar(&requireAllPlatforms, "require-all-platforms", false,
+		"Fail if any image does not provide all requested platforms, listing every missing image and platform")
+	cmd.Flags().
+		IntVar(&imagePullConcurrency, "image-pull-concurrency", 1, "Image pull concurrency")
+	AddPullTimeoutFlags(cmd.Flags(), &perImageTimeout, &stallTimeout, &stallRetries)
+	progress.AddFlag(cmd.Flags(), &progressMode)
+	cmd.Flags().Var(
+		enumflag.New(&onError, "string", onErrorModes, enumflag.EnumCaseSensitive),
+		"on-error",
+		`how to handle images that fail to be pulled: one of "fail" or "continue" (skip failed images)`,
+	)
+	cmd.Flags().StringVar(&errorReportFile, "error-report-file", "",
+		"File to write a JSON report of images that failed to be pulled to")
+	cmd.Flags().BoolVar(&failOnAnyError, "fail-on-any-error", false,
+		"Exit with a non-zero exit code if any image failed to be pulled, even with --on-error=continue")
+	flags.AddRegistryAuthFileFlag(cmd.Flags(), &registryAuthFile)
+	flags.AddRegistryCredentialFlags(cmd.Flags(), &credentialOpts)
+	flags.AddIncludeNonDistributableFlag(cmd.Flags(), &includeNonDistributable)
+	flags.AddClockSkewToleranceFlag(cmd.Flags(), &clockSkewTolerance)
+	flags.AddTemporaryRegistryListenFlags(cmd.Flags(), &listenAddress, &listenPortRange)
+	cmd.Flags().StringVar(&blobCacheDir, "blob-cache-dir", "",
+		"Directory to cache pulled image blobs in, for reuse when creating other bundles")
+	cmd.Flags().BoolVar(&includeSignatures, "include-notation-signatures", false,
+		"Include Notation signatures of the added images in the bundle (requires a bundle with the registry layout)")
+	cmd.Flags().StringVar(&repoRewriteRulesFile, "repo-rewrite-rules", "",
+		"File containing rules to rewrite source image repositories to destination repositories, "+
+			"recording the repositories images are pushed to in the bundle")
+	AddScanFlags(cmd.Flags(), &scanOpts)
+	AddRateLimitFlags(cmd.Flags(), &rateLimits)
+	flags.AddAnnotationFlag(cmd.Flags(), &annotations)
+	flags.AddBundleSignKeyFlag(cmd.Flags(), &signKey)
+	cmd.Flags().BoolVar(&strict, "strict", false,
+		"Treat warnings (missing platforms, digests not found, image name normalization changes, platform "+
+			"mismatches, deprecated images, vulnerabilities with --scan-action=warn) as errors")
+
+	return cmd
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/config"
+)
+
+func TestUpdateExistingBundle(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	blob := filepath.Join(bundleDir, "docker", "registry", "v2", "blobs", "sha256", "aa", "aaaa", "data")
+	require.NoError(t, os.MkdirAll(filepath.Dir(blob), 0o755))
+	require.NoError(t, os.WriteFile(blob, []byte("existing"), 0o644))
+	require.NoError(t, config.WriteSanitizedImagesConfig(config.ImagesConfig{
+		"docker.io": config.RegistrySyncConfig{
+			Images: map[string][]string{"library/nginx": {"1.21"}},
+		},
+	}, filepath.Join(bundleDir, "images.yaml")))
+	bundleFile := filepath.Join(tmpDir, "images.tar")
+	require.NoError(t, archive.ArchiveDirectory(bundleDir, bundleFile))
+
+	existing, err := openExistingBundle(bundleFile, filepath.Join(tmpDir, "metadata"))
+	require.NoError(t, err)
+	assert.Equal(t, RegistryLayout, existing.layout)
+
+	newCfg := existing.newImages(config.ImagesConfig{
+		"docker.io": config.RegistrySyncConfig{
+			Images: map[string][]string{
+				"library/nginx": {"1.21", "1.25"},
+				"library/redis": {"7"},
+			},
+		},
+		"quay.io": config.RegistrySyncConfig{
+			Images: map[string][]string{"library/nginx": {"1.21"}},
+		},
+	})
+	assert.Equal(t, config.ImagesConfig{
+		"docker.io": config.RegistrySyncConfig{
+			Images: map[string][]string{
+				"library/nginx": {"1.25"},
+				"library/redis": {"7"},
+			},
+		},
+		"quay.io": config.RegistrySyncConfig{
+			Images: map[string][]string{"library/nginx": {"1.21"}},
+		},
+	}, newCfg)
+
+	deltaDir := filepath.Join(tmpDir, "delta")
+	newBlob := filepath.Join(deltaDir, "docker", "registry", "v2", "blobs", "sha256", "bb", "bbbb", "data")
+	require.NoError(t, os.MkdirAll(filepath.Dir(newBlob), 0o755))
+	require.NoError(t, os.WriteFile(newBlob, []byte("new"), 0o644))
+	// Blobs that are already in the bundle are not appended again.
+	existingBlob := filepath.Join(deltaDir, "docker", "registry", "v2", "blobs", "sha256", "aa", "aaaa", "data")
+	require.NoError(t, os.MkdirAll(filepath.Dir(existingBlob), 0o755))
+	require.NoError(t, os.WriteFile(existingBlob, []byte("not appended"), 0o644))
+
+	bundleCfg, err := existing.writeMetadata(deltaDir, bundleFile, newCfg)
+	require.NoError(t, err)
+	assert.Equal(t, 4, bundleCfg.TotalImages())
+	require.NoError(t, existing.append(deltaDir))
+
+	destDir := filepath.Join(tmpDir, "dest")
+	require.NoError(t, archive.UnarchiveToDirectory(bundleFile, destDir))
+	cfg, err := config.ParseImagesConfigFile(filepath.Join(destDir, "images.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, bundleCfg, cfg)
+	assert.FileExists(t, filepath.Join(destDir, utils.InstructionsFileName))
+	for p, want := range map[string]string{
+		"docker/registry/v2/blobs/sha256/aa/aaaa/data": "existing",
+		"docker/registry/v2/blobs/sha256/bb/bbbb/data": "new",
+	} {
+		got, err := os.ReadFile(filepath.Join(destDir, filepath.FromSlash(p)))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(got), p)
+	}
+}
+
+func TestUpdateCompressedBundle(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(bundleDir, "images.yaml"), []byte("{}"), 0o644))
+	bundleFile := filepath.Join(tmpDir, "images.tar.gz")
+	require.NoError(t, archive.ArchiveDirectory(bundleDir, bundleFile))
+
+	_, err := openExistingBundle(bundleFile, filepath.Join(tmpDir, "metadata"))
+	require.ErrorIs(t, err, archive.ErrCompressedArchive)
+}
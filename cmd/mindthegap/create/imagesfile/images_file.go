@@ -0,0 +1,211 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagesfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/helm"
+)
+
+func NewCommand(out output.Output) *cobra.Command {
+	var (
+		manifests  []string
+		chartPath  string
+		valueFiles []string
+		setValues  []string
+		outputFile string
+		overwrite  bool
+		allowEmpty bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "images-file",
+		Short: "Create an images file from the images referenced by Kubernetes manifests or Helm charts",
+		Long: "Create an images file listing every image referenced by image fields of Kubernetes manifests, e.g. " +
+			"the output of kustomize build, or of the manifests rendered from a Helm chart with the given values",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if len(manifests) == 0 && chartPath == "" {
+				return errors.New("at least one of --manifests or --chart must be specified")
+			}
+			if chartPath == "" && (len(valueFiles) > 0 || len(setValues) > 0) {
+				return errors.New("--values and --set require --chart to be specified")
+			}
+
+			return flags.ValidateFlagsThatRequireValues(cmd, "output-file")
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !overwrite {
+				out.StartOperation("Checking if output file already exists")
+				_, err := os.Stat(outputFile)
+				switch {
+				case err == nil:
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf(
+						"%s already exists: specify --overwrite to overwrite existing file",
+						outputFile,
+					)
+				case !errors.Is(err, os.ErrNotExist):
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf(
+						"failed to check if output file %s already exists: %w",
+						outputFile,
+						err,
+					)
+				default:
+					out.EndOperationWithStatus(output.Success())
+				}
+			}
+
+			var images []string
+			if len(manifests) > 0 {
+				out.StartOperation("Scanning manifests for images")
+				manifestImages, err := imagesInManifests(cmd.InOrStdin(), manifests)
+				if err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return err
+				}
+				out.EndOperationWithStatus(output.Success())
+				images = append(images, manifestImages...)
+			}
+			if chartPath != "" {
+				out.StartOperation(fmt.Sprintf("Rendering Helm chart %s", chartPath))
+				rendered, err := helm.RenderChart(chartPath, valueFiles, setValues)
+				if err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return err
+				}
+				for _, manifest := range rendered {
+					manifestImages, err := imageReferences([]byte(manifest))
+					if err != nil {
+						out.EndOperationWithStatus(output.Failure())
+						return fmt.Errorf("failed to scan manifests rendered from Helm chart %s: %w", chartPath, err)
+					}
+					images = append(images, manifestImages...)
+				}
+				out.EndOperationWithStatus(output.Success())
+			}
+
+			cfg, warnings, err := imagesConfig(images)
+			if err != nil {
+				return err
+			}
+			for _, w := range warnings {
+				out.Warnf("WARNING: %s", w)
+			}
+			if cfg.TotalImages() == 0 && !allowEmpty {
+				return errors.New("no images found: specify --allow-empty to write an empty images file")
+			}
+
+			out.StartOperation(fmt.Sprintf("Writing images file %s", outputFile))
+			if err := config.WriteSanitizedImagesConfig(cfg, outputFile); err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return err
+			}
+			out.EndOperationWithStatus(output.Success())
+			out.Infof("Found %d images\n", cfg.TotalImages())
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&manifests, "manifests", nil,
+		"Kubernetes manifests to scan for images: YAML files, directories containing YAML files, glob patterns, "+
+			"or - to read manifests from stdin, e.g. piped from kustomize build")
+	cmd.Flags().StringVar(&chartPath, "chart", "",
+		"Local Helm chart (directory or packaged chart) to render and scan for images")
+	cmd.Flags().StringSliceVarP(&valueFiles, "values", "f", nil,
+		"Values files to render the Helm chart with")
+	cmd.Flags().StringArrayVar(&setValues, "set", nil,
+		"Values to render the Helm chart with (e.g. key1=val1,key2=val2)")
+	cmd.Flags().StringVar(&outputFile, "output-file", "images.yaml", "Output file to write the images file to")
+	cmd.Flags().BoolVar(&overwrite, "overwrite", false, "Overwrite output file if it already exists")
+	cmd.Flags().BoolVar(&allowEmpty, "allow-empty", false, "Write the images file even if no images are found")
+
+	return cmd
+}
+
+// imagesInManifests returns the images referenced in the manifests, which are files, directories
+// containing YAML files, glob patterns, or - to read from stdin.
+func imagesInManifests(stdin io.Reader, manifests []string) ([]string, error) {
+	var files []string
+	for _, m := range manifests {
+		if m == "-" {
+			files = append(files, m)
+			continue
+		}
+		matches, err := utils.FilesWithGlobs([]string{m})
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			yamlFiles, err := yamlFilesIn(match)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, yamlFiles...)
+		}
+	}
+
+	var images []string
+	for _, f := range files {
+		var (
+			b   []byte
+			err error
+		)
+		if f == "-" {
+			b, err = io.ReadAll(stdin)
+		} else {
+			b, err = os.ReadFile(f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifests %s: %w", f, err)
+		}
+		fileImages, err := imageReferences(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan manifests %s: %w", f, err)
+		}
+		images = append(images, fileImages...)
+	}
+	return images, nil
+}
+
+// yamlFilesIn returns the YAML files in the directory and its subdirectories, or path itself if it is
+// not a directory.
+func yamlFilesIn(path string) ([]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := filepath.Ext(p); !d.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find manifests in %s: %w", path, err)
+	}
+	return files, nil
+}
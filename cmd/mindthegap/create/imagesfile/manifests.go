@@ -0,0 +1,96 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagesfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/distribution/distribution/v3/reference"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+// imageReferences returns the values of all image fields in the YAML documents of the manifests, e.g.
+// of the containers, init containers and ephemeral containers of workloads, as well as of custom
+// resources that reference images the same way.
+func imageReferences(manifests []byte) ([]string, error) {
+	var refs []string
+	dec := yaml.NewDecoder(bytes.NewReader(manifests))
+	for i := 1; ; i++ {
+		var doc any
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return refs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse YAML document %d: %w", i, err)
+		}
+		refs = appendImageReferences(refs, doc)
+	}
+}
+
+func appendImageReferences(refs []string, node any) []string {
+	switch n := node.(type) {
+	case map[string]any:
+		for k, v := range n {
+			if image, ok := v.(string); ok && k == "image" {
+				if image != "" {
+					refs = append(refs, image)
+				}
+				continue
+			}
+			refs = appendImageReferences(refs, v)
+		}
+	case []any:
+		for _, v := range n {
+			refs = appendImageReferences(refs, v)
+		}
+	}
+	return refs
+}
+
+// imagesConfig returns the images config containing the images. Images without a tag are added with
+// the latest tag, as that is what is pulled for them. Images config files only support tags, so digests
+// are dropped from images with both a tag and a digest, and images with only a digest are skipped. A
+// warning is returned for every such image.
+func imagesConfig(images []string) (cfg config.ImagesConfig, warnings []string, err error) {
+	cfg = config.ImagesConfig{}
+	seen := map[string]struct{}{}
+	for _, image := range images {
+		if _, ok := seen[image]; ok {
+			continue
+		}
+		seen[image] = struct{}{}
+
+		named, err := reference.ParseNormalizedNamed(image)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid image %q: %w", image, err)
+		}
+		tag := "latest"
+		switch r := named.(type) {
+		case reference.NamedTagged:
+			tag = r.Tag()
+			if _, ok := named.(reference.Digested); ok {
+				warnings = append(warnings, fmt.Sprintf(
+					"image %q is pinned by digest, which images config files do not support: using tag %q",
+					image, tag,
+				))
+			}
+		case reference.Digested:
+			warnings = append(warnings, fmt.Sprintf(
+				"image %q is only referenced by digest, which images config files do not support: skipping it",
+				image,
+			))
+			continue
+		}
+		cfg.AddImage(reference.Domain(named), reference.Path(named), tag)
+	}
+	sort.Strings(warnings)
+	return cfg, warnings, nil
+}
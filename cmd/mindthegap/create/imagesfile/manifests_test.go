@@ -0,0 +1,81 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagesfile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+func TestImageReferences(t *testing.T) {
+	t.Parallel()
+
+	refs, err := imageReferences([]byte(`apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: init
+          image: busybox:1.36
+      containers:
+        - name: app
+          image: ghcr.io/org/app:v1.2.3
+        - name: sidecar
+          image: ""
+---
+# Empty document.
+---
+apiVersion: example.com/v1
+kind: Custom
+spec:
+  image: quay.io/org/operand@sha256:0000000000000000000000000000000000000000000000000000000000000000
+  images:
+    image:
+      repository: not-an-image-field
+`))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"busybox:1.36",
+		"ghcr.io/org/app:v1.2.3",
+		"quay.io/org/operand@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+	}, refs)
+
+	_, err = imageReferences([]byte("a: b\n---\n: : :\n"))
+	require.ErrorContains(t, err, "failed to parse YAML document 2")
+}
+
+func TestImagesConfig(t *testing.T) {
+	t.Parallel()
+
+	const digest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	cfg, warnings, err := imagesConfig([]string{
+		"nginx",
+		"busybox:1.36",
+		"busybox:1.36",
+		"ghcr.io/org/app:v1.2.3@" + digest,
+		"quay.io/org/operand@" + digest,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, config.ImagesConfig{
+		"docker.io": {Images: map[string][]string{
+			"library/busybox": {"1.36"},
+			"library/nginx":   {"latest"},
+		}},
+		"ghcr.io": {Images: map[string][]string{"org/app": {"v1.2.3"}}},
+	}, cfg)
+	assert.Equal(t, []string{
+		`image "ghcr.io/org/app:v1.2.3@` + digest + `" is pinned by digest, which images config files do not ` +
+			`support: using tag "v1.2.3"`,
+		`image "quay.io/org/operand@` + digest + `" is only referenced by digest, which images config files do ` +
+			`not support: skipping it`,
+	}, warnings)
+
+	_, _, err = imagesConfig([]string{"Invalid:Image"})
+	require.ErrorContains(t, err, `invalid image "Invalid:Image"`)
+}
@@ -0,0 +1,24 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package export
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/export/imagebundle"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/export/rewriterules"
+)
+
+func NewCommand(out output.Output) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export bundles to other formats",
+	}
+
+	cmd.AddCommand(imagebundle.NewCommand(out))
+	cmd.AddCommand(rewriterules.NewCommand(out))
+	return cmd
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/enumflag/v2"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/cleanup"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/docker/registry"
+	"github.com/mesosphere/mindthegap/images/httputils"
+	"github.com/mesosphere/mindthegap/images/platform"
+)
+
+type exportFormat enumflag.Flag
+
+const (
+	// DockerArchive is the format written by `docker save`, which can be loaded with `docker load` or
+	// `ctr images import`.
+	DockerArchive exportFormat = iota
+)
+
+var exportFormats = map[exportFormat][]string{
+	DockerArchive: {"docker-archive"},
+}
+
+func NewCommand(out output.Output) *cobra.Command {
+	var (
+		imageBundleFiles []string
+		outputFile       string
+		overwrite        bool
+		format           = DockerArchive
+		platformStr      string
+		exportPlatform   platform.Platform
+	)
+
+	cmd := &cobra.Command{
+		Use:   "image-bundle",
+		Short: "Export images from image bundles to a tarball that can be loaded without a registry",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := cmd.ValidateRequiredFlags(); err != nil {
+				return err
+			}
+
+			if err := flags.ValidateFlagsThatRequireValues(cmd, "image-bundle", "output-file"); err != nil {
+				return err
+			}
+
+			if platformStr == "" {
+				return nil
+			}
+			var err error
+			exportPlatform, err = platform.Parse(platformStr)
+			return err
+		},
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if !overwrite {
+				out.StartOperation("Checking if output file already exists")
+				_, err := os.Stat(outputFile)
+				switch {
+				case err == nil:
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf(
+						"%s already exists: specify --overwrite to overwrite existing file",
+						outputFile,
+					)
+				case !errors.Is(err, os.ErrNotExist):
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf(
+						"failed to check if output file %s already exists: %w",
+						outputFile,
+						err,
+					)
+				default:
+					out.EndOperationWithStatus(output.Success())
+				}
+			}
+
+			cleaner := cleanup.NewCleaner()
+			defer cleaner.Cleanup()
+
+			out.StartOperation("Creating temporary directory")
+			tempDir, err := os.MkdirTemp("", ".image-bundle-*")
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to create temporary directory: %w", err)
+			}
+			cleaner.AddCleanupFn(func() { _ = os.RemoveAll(tempDir) })
+			out.EndOperationWithStatus(output.Success())
+
+			imageBundleFiles, err = utils.FilesWithGlobs(imageBundleFiles)
+			if err != nil {
+				return err
+			}
+			cfg, _, err := utils.ExtractBundles(tempDir, out, imageBundleFiles...)
+			if err != nil {
+				return err
+			}
+
+			out.StartOperation("Starting temporary Docker registry")
+			reg, err := registry.NewRegistry(
+				registry.Config{StorageDirectory: tempDir, ReadOnly: true},
+			)
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to create local Docker registry: %w", err)
+			}
+			regCtx, stopReg := context.WithCancel(cmd.Context())
+			regErrCh, err := reg.Start(regCtx)
+			if err != nil {
+				stopReg()
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to start local Docker registry: %w", err)
+			}
+			// Wait for the registry to stop before its storage is cleaned up.
+			defer func() {
+				stopReg()
+				for regErr := range regErrCh {
+					err = errors.Join(err, regErr)
+				}
+			}()
+			out.EndOperationWithStatus(output.Success())
+
+			sourceTLSRoundTripper, err := httputils.LocalRegistryRoundTripper(remote.DefaultTransport)
+			if err != nil {
+				return fmt.Errorf("error configuring TLS for source registry: %w", err)
+			}
+
+			if platformStr == "" {
+				out.StartOperation("Determining platform of bundled images")
+				exportPlatform, err = utils.BundlePlatform(
+					cmd.Context(), reg.Address(), *cfg, sourceTLSRoundTripper,
+				)
+				if err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf("%w: specify --platform to export images for", err)
+				}
+				out.EndOperationWithStatus(output.Success())
+			}
+
+			out.StartOperation(fmt.Sprintf("Exporting images for platform %s to %s", exportPlatform, outputFile))
+			if err := utils.WriteDockerArchive(
+				cmd.Context(), reg.Address(), *cfg, exportPlatform, outputFile, sourceTLSRoundTripper,
+			); err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return err
+			}
+			out.EndOperationWithStatus(output.Success())
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&imageBundleFiles, "image-bundle", nil,
+		"Tarball containing list of images to export. Can also be a glob pattern.")
+	_ = cmd.MarkFlagRequired("image-bundle")
+	cmd.Flags().StringVar(&outputFile, "output-file", "", "Output file to write exported images to")
+	_ = cmd.MarkFlagRequired("output-file")
+	cmd.Flags().
+		BoolVar(&overwrite, "overwrite", false, "Overwrite output file if it already exists")
+	cmd.Flags().Var(
+		enumflag.New(&format, "string", exportFormats, enumflag.EnumCaseSensitive),
+		"format",
+		`format to export images in: "docker-archive" (loadable with "docker load" or "ctr images import")`,
+	)
+	cmd.Flags().StringVar(&platformStr, "platform", "",
+		"platform to export images for, as docker archives only support a single platform per image "+
+			"(required format: <os>/<arch>[/<variant>][:<os.version>]), defaulting to the platform the images "+
+			"are bundled for (required if they are bundled for multiple platforms)")
+
+	return cmd
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/imagebundle"
+	"github.com/mesosphere/mindthegap/config"
+)
+
+// createBundle creates an image bundle containing an index with an image for every platform,
+// returning the bundle file and the name the image has been bundled as.
+func createBundle(t *testing.T, platforms ...v1.Platform) (string, string) {
+	t.Helper()
+
+	srv := httptest.NewServer(registry.New())
+	t.Cleanup(srv.Close)
+	reg := strings.TrimPrefix(srv.URL, "http://")
+
+	var idx v1.ImageIndex = empty.Index
+	for _, p := range platforms {
+		img, err := random.Image(128, 1)
+		require.NoError(t, err)
+		cf, err := img.ConfigFile()
+		require.NoError(t, err)
+		cf = cf.DeepCopy()
+		cf.OS, cf.Architecture, cf.Variant = p.OS, p.Architecture, p.Variant
+		img, err = mutate.ConfigFile(img, cf)
+		require.NoError(t, err)
+		p := p
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &p},
+		})
+	}
+	ref, err := name.ParseReference(reg + "/library/app:v1")
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(ref, idx))
+
+	bundleFile := filepath.Join(t.TempDir(), "images.tar")
+	_, err = imagebundle.Create(context.Background(), output.NewDiscardingOutput(), imagebundle.Options{
+		OutputFile: bundleFile,
+		ImagesConfig: &config.ImagesConfig{
+			reg: {
+				Images: map[string][]string{"library/app": {"v1"}},
+				Proxy:  config.DirectProxy,
+			},
+		},
+		ImagePullConcurrency: 1,
+	})
+	require.NoError(t, err)
+	return bundleFile, ref.String()
+}
+
+func export(t *testing.T, bundleFile string, args ...string) (string, error) {
+	t.Helper()
+
+	outputFile := filepath.Join(t.TempDir(), "docker-archive.tar")
+	cmd := NewCommand(output.NewDiscardingOutput())
+	cmd.SetArgs(append([]string{"--image-bundle", bundleFile, "--output-file", outputFile}, args...))
+	return outputFile, cmd.ExecuteContext(context.Background())
+}
+
+// exportedPlatform returns the platform of the image exported to the docker archive.
+func exportedPlatform(t *testing.T, archive, tag string) v1.Platform {
+	t.Helper()
+
+	ref, err := name.NewTag(tag)
+	require.NoError(t, err)
+	img, err := tarball.ImageFromPath(archive, &ref)
+	require.NoError(t, err)
+	cf, err := img.ConfigFile()
+	require.NoError(t, err)
+	return v1.Platform{OS: cf.OS, Architecture: cf.Architecture, Variant: cf.Variant}
+}
+
+func TestExportImageBundleDefaultsToBundlePlatform(t *testing.T) {
+	t.Parallel()
+
+	arm64 := v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	bundleFile, image := createBundle(t, arm64)
+
+	archive, err := export(t, bundleFile)
+	require.NoError(t, err)
+	assert.Equal(t, arm64, exportedPlatform(t, archive, image))
+}
+
+func TestExportImageBundleMultiplePlatforms(t *testing.T) {
+	t.Parallel()
+
+	amd64 := v1.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := v1.Platform{OS: "linux", Architecture: "arm64"}
+	bundleFile, image := createBundle(t, amd64, arm64)
+
+	_, err := export(t, bundleFile)
+	require.ErrorContains(t, err, "bundled for multiple platforms (linux/amd64, linux/arm64)")
+	require.ErrorContains(t, err, "specify --platform")
+
+	// Default variants match images without variant.
+	archive, err := export(t, bundleFile, "--platform", "linux/arm64/v8")
+	require.NoError(t, err)
+	assert.Equal(t, arm64, exportedPlatform(t, archive, image))
+
+	_, err = export(t, bundleFile, "--platform", "linux/s390x")
+	require.ErrorContains(t, err, "no image found for platform")
+}
@@ -0,0 +1,182 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package rewriterules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/thediveo/enumflag/v2"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/cleanup"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/mirrorconfig"
+)
+
+type exportFormat enumflag.Flag
+
+const (
+	// Kustomize is the images field of kustomization.yaml files.
+	Kustomize exportFormat = iota
+	// FluxImagePolicy are Flux ImageRepository and ImagePolicy objects for image automation.
+	FluxImagePolicy
+	// Containerd is a containerd registry config_path directory of hosts.toml files.
+	Containerd
+)
+
+var exportFormats = map[exportFormat][]string{
+	Kustomize:       {"kustomize"},
+	FluxImagePolicy: {"flux-image-policy"},
+	Containerd:      {"containerd"},
+}
+
+func NewCommand(out output.Output) *cobra.Command {
+	var (
+		imageBundleFiles     []string
+		destRegistryURI      flags.RegistryURI
+		destRepositoryPrefix string
+		format               = Kustomize
+		fluxNamespace        string
+		outputFile           string
+		outputDir            string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rewrite-rules",
+		Short: "Export the repositories that bundled images are pushed to as configuration for clusters",
+		Long: "Export the repositories that the images in image bundles are pushed to, applying the repository " +
+			"rewrite rules recorded in the bundles, as kustomize images, Flux image policies or containerd " +
+			"mirror configuration, so that clusters pull the pushed images consistently",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := cmd.ValidateRequiredFlags(); err != nil {
+				return err
+			}
+
+			if err := flags.ValidateFlagsThatRequireValues(cmd, "image-bundle", "to-registry"); err != nil {
+				return err
+			}
+
+			switch {
+			case format == Containerd && outputDir == "":
+				return errors.New(`--output-dir is required with --format "containerd"`)
+			case format != Containerd && outputDir != "":
+				return errors.New(`--output-dir is only supported with --format "containerd"`)
+			case format == Containerd && outputFile != "":
+				return errors.New(`--output-file is not supported with --format "containerd"`)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cleaner := cleanup.NewCleaner()
+			defer cleaner.Cleanup()
+
+			out.StartOperation("Creating temporary directory")
+			tempDir, err := os.MkdirTemp("", ".image-bundle-*")
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to create temporary directory: %w", err)
+			}
+			cleaner.AddCleanupFn(func() { _ = os.RemoveAll(tempDir) })
+			out.EndOperationWithStatus(output.Success())
+
+			imageBundleFiles, err = utils.FilesWithGlobs(imageBundleFiles)
+			if err != nil {
+				return err
+			}
+			cfg, _, err := utils.ExtractBundles(tempDir, out, imageBundleFiles...)
+			if err != nil {
+				return err
+			}
+
+			rewrites, err := utils.ReadRepoRewrites(tempDir)
+			if err != nil {
+				return err
+			}
+			if rewrites == nil {
+				if cfg == nil {
+					return errors.New("image bundles do not contain any images")
+				}
+				// Without rewrite rules, images are pushed without their source registry.
+				r := config.RepoRewriteRules{}.RewritesFor(*cfg)
+				rewrites = &r
+			}
+
+			mirror := mirrorconfig.Mirror{
+				Address:          destRegistryURI.Host(),
+				TLS:              destRegistryURI.Scheme() != "http",
+				RepositoryPrefix: path.Join(strings.Trim(destRegistryURI.Path(), "/"), destRepositoryPrefix),
+			}
+
+			if format == Containerd {
+				out.StartOperation(fmt.Sprintf("Writing containerd mirror configuration to %s", outputDir))
+				unsupported, err := mirrorconfig.WriteContainerdHostsDirForRewrites(outputDir, *rewrites, mirror)
+				if err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return err
+				}
+				out.EndOperationWithStatus(output.Success())
+				if len(unsupported) > 0 {
+					out.Warnf(
+						"WARNING: containerd cannot mirror repositories of %s that are not rewritten to a common "+
+							"prefix, use --format \"kustomize\" or --format \"flux-image-policy\" for them instead",
+						strings.Join(unsupported, ", "),
+					)
+				}
+				return nil
+			}
+
+			var b []byte
+			switch format {
+			case Kustomize:
+				b, err = mirrorconfig.KustomizeImages(*rewrites, mirror)
+			case FluxImagePolicy:
+				b, err = mirrorconfig.FluxImagePolicies(*rewrites, mirror, fluxNamespace)
+			}
+			if err != nil {
+				return err
+			}
+
+			if outputFile == "" {
+				_, err = cmd.OutOrStdout().Write(b)
+				return err
+			}
+			if err := os.WriteFile(outputFile, b, 0o644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", outputFile, err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&imageBundleFiles, "image-bundle", nil,
+		"Tarball containing list of images to export rewrite rules for. Can also be a glob pattern.")
+	_ = cmd.MarkFlagRequired("image-bundle")
+	cmd.Flags().Var(&destRegistryURI, "to-registry", "Registry the images were pushed to. "+
+		"Prefix with http:// if the registry is served over HTTP")
+	_ = cmd.MarkFlagRequired("to-registry")
+	cmd.Flags().StringVar(&destRepositoryPrefix, "to-registry-prefix", "",
+		"Repository path prefix the images were pushed under in the destination registry, e.g. com/mirror")
+	cmd.Flags().Var(
+		enumflag.New(&format, "string", exportFormats, enumflag.EnumCaseSensitive),
+		"format",
+		`format to export rewrite rules in: one of "kustomize" (images field of kustomization.yaml), `+
+			`"flux-image-policy" (Flux ImageRepository and ImagePolicy objects) or "containerd" `+
+			"(hosts.toml files for the containerd registry config_path)",
+	)
+	cmd.Flags().StringVar(&fluxNamespace, "flux-namespace", "flux-system",
+		"Namespace of the exported Flux objects")
+	cmd.Flags().StringVar(&outputFile, "output-file", "",
+		"File to write the exported rewrite rules to, defaulting to stdout")
+	cmd.Flags().StringVar(&outputDir, "output-dir", "",
+		`Directory to write containerd hosts.toml files to (required with --format "containerd")`)
+
+	return cmd
+}
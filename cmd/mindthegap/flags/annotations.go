@@ -0,0 +1,50 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Annotations are annotations in the key=value format, which can be specified multiple times.
+// Unlike pflag's StringToString, values may contain commas.
+type Annotations map[string]string
+
+func (v *Annotations) String() string {
+	pairs := make([]string, 0, len(*v))
+	for k, val := range *v {
+		pairs = append(pairs, k+"="+val)
+	}
+	sort.Strings(pairs)
+	return "[" + strings.Join(pairs, ",") + "]"
+}
+
+func (v *Annotations) Set(value string) error {
+	k, val, ok := strings.Cut(value, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("invalid annotation %q: must be in the format key=value", value)
+	}
+	if *v == nil {
+		*v = Annotations{}
+	}
+	(*v)[k] = val
+	return nil
+}
+
+func (*Annotations) Type() string {
+	return "key=value"
+}
+
+// AddAnnotationFlag adds the --annotation flag to the specified flag set.
+func AddAnnotationFlag(fs *pflag.FlagSet, annotations *Annotations) {
+	fs.Var(annotations, "annotation",
+		"Annotation to add to every bundled image, its index and its platform images, in the format key=value, "+
+			"e.g. org.opencontainers.image.vendor=Example (can be specified multiple times, overridden by "+
+			"annotations in v2 images files). Values are Go templates rendered with the source image as "+
+			"{{ .Image }} and the digest of the annotated manifest before annotating as {{ .Digest }}")
+}
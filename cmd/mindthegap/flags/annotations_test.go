@@ -0,0 +1,29 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotations(t *testing.T) {
+	t.Parallel()
+
+	var v Annotations
+	assert.Equal(t, "[]", v.String())
+
+	require.NoError(t, v.Set("org.opencontainers.image.vendor=Example"))
+	require.NoError(t, v.Set("com.example.sites=a,b=c"))
+	assert.Equal(t, Annotations{
+		"org.opencontainers.image.vendor": "Example",
+		"com.example.sites":               "a,b=c",
+	}, v)
+	assert.Equal(t, "[com.example.sites=a,b=c,org.opencontainers.image.vendor=Example]", v.String())
+
+	require.ErrorContains(t, v.Set("vendor"), "must be in the format key=value")
+	require.ErrorContains(t, v.Set("=Example"), "must be in the format key=value")
+}
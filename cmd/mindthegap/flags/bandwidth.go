@@ -0,0 +1,31 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import "github.com/mesosphere/mindthegap/config"
+
+// Bandwidth is a bandwidth in bits or bytes per second, e.g. 50Mbps or 5MBps, see
+// config.ParseBandwidth.
+type Bandwidth struct {
+	// BytesPerSecond is the parsed bandwidth, zero if not set.
+	BytesPerSecond int64
+	value          string
+}
+
+func (v *Bandwidth) String() string {
+	return v.value
+}
+
+func (v *Bandwidth) Set(value string) error {
+	bytesPerSecond, err := config.ParseBandwidth(value)
+	if err != nil {
+		return err
+	}
+	v.BytesPerSecond, v.value = bytesPerSecond, value
+	return nil
+}
+
+func (*Bandwidth) Type() string {
+	return "string"
+}
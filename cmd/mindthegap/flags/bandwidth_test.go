@@ -0,0 +1,25 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBandwidth(t *testing.T) {
+	t.Parallel()
+
+	var v Bandwidth
+	assert.Equal(t, "", v.String())
+
+	require.NoError(t, v.Set("50Mbps"))
+	assert.EqualValues(t, 6_250_000, v.BytesPerSecond)
+	assert.Equal(t, "50Mbps", v.String())
+
+	require.ErrorContains(t, v.Set("50"), "must be in bits or bytes per second")
+	assert.EqualValues(t, 6_250_000, v.BytesPerSecond)
+}
@@ -0,0 +1,29 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"github.com/spf13/pflag"
+
+	"github.com/mesosphere/mindthegap/signing"
+)
+
+// AddBundleSignKeyFlag adds the --sign-key flag to the specified flag set.
+func AddBundleSignKeyFlag(fs *pflag.FlagSet, signKey *string) {
+	fs.StringVar(signKey, "sign-key", "",
+		"Cosign private key to sign the bundle with, or \""+signing.Keyless+"\" to sign keylessly, writing a "+
+			"detached signature to <bundle>.sigstore.json (requires cosign)")
+}
+
+// AddBundleVerifyFlags adds the --verify-key, --certificate-identity and --certificate-oidc-issuer
+// flags to the specified flag set.
+func AddBundleVerifyFlags(fs *pflag.FlagSet, opts *signing.VerifyOptions) {
+	fs.StringVar(&opts.Key, "verify-key", "",
+		"Cosign public key to verify the detached signatures (<bundle>.sigstore.json) of the bundles with, "+
+			"refusing to use unsigned or modified bundles (requires cosign)")
+	fs.StringVar(&opts.CertificateIdentity, "certificate-identity", "",
+		"Identity of keyless signatures of the bundles to verify, instead of --verify-key")
+	fs.StringVar(&opts.CertificateOIDCIssuer, "certificate-oidc-issuer", "",
+		"OIDC issuer of the identity of keyless signatures of the bundles to verify")
+}
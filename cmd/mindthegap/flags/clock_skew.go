@@ -0,0 +1,17 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// AddClockSkewToleranceFlag adds the --clock-skew-tolerance flag to the specified flag set.
+func AddClockSkewToleranceFlag(fs *pflag.FlagSet, tolerance *time.Duration) {
+	fs.DurationVar(tolerance, "clock-skew-tolerance", 0,
+		"Accept registry TLS certificates that are not valid at the local time if they are valid within "+
+			"this duration of it, for hosts with a wrong clock (e.g. 24h, 0 to disable)")
+}
@@ -0,0 +1,44 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"github.com/spf13/pflag"
+	"github.com/thediveo/enumflag/v2"
+
+	"github.com/mesosphere/mindthegap/archive"
+)
+
+var compressions = map[archive.Compression][]string{
+	archive.None: {"none"},
+	archive.Gzip: {"gzip"},
+	archive.Zstd: {"zstd"},
+}
+
+// AddCompressionFlags adds the --compression and --compression-level flags to the specified flag
+// set.
+func AddCompressionFlags(fs *pflag.FlagSet, compression *archive.Compression, level *int) {
+	fs.Var(
+		enumflag.New(compression, "string", compressions, enumflag.EnumCaseSensitive),
+		"compression",
+		`compression of the bundle: one of "none", "gzip" or "zstd" `+
+			`(defaults to the compression implied by the output file extension, e.g. gzip for .tar.gz)`,
+	)
+	fs.IntVar(level, "compression-level", 0,
+		"Compression level (gzip: 1-9, zstd: 1-22), defaults to the default level of the compression")
+}
+
+// ResolveCompression defaults the compression to the compression implied by the output file
+// extension if --compression was not specified, and validates the compression level.
+func ResolveCompression(
+	fs *pflag.FlagSet,
+	outputFile string,
+	compression *archive.Compression,
+	level int,
+) error {
+	if !fs.Changed("compression") {
+		*compression = archive.CompressionForFile(outputFile)
+	}
+	return archive.ValidateCompressionLevel(*compression, level)
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/archive"
+)
+
+func TestResolveCompression(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		args            []string
+		outputFile      string
+		wantCompression archive.Compression
+		wantErr         string
+	}{{
+		name:            "default from plain tar extension",
+		outputFile:      "images.tar",
+		wantCompression: archive.None,
+	}, {
+		name:            "default from gzip extension",
+		outputFile:      "images.tar.gz",
+		wantCompression: archive.Gzip,
+	}, {
+		name:            "explicit compression overrides extension",
+		args:            []string{"--compression=zstd", "--compression-level=19"},
+		outputFile:      "images.tar.gz",
+		wantCompression: archive.Zstd,
+	}, {
+		name:       "invalid level",
+		args:       []string{"--compression=gzip", "--compression-level=10"},
+		outputFile: "images.tar",
+		wantErr:    "invalid compression level 10",
+	}, {
+		name:       "level without compression",
+		args:       []string{"--compression-level=3"},
+		outputFile: "images.tar",
+		wantErr:    "compression level is not supported",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				compression archive.Compression
+				level       int
+			)
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			AddCompressionFlags(fs, &compression, &level)
+			require.NoError(t, fs.Parse(tt.args))
+
+			err := ResolveCompression(fs, tt.outputFile, &compression, level)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCompression, compression)
+		})
+	}
+}
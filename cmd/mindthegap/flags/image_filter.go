@@ -0,0 +1,21 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"github.com/spf13/pflag"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+// AddImageFilterFlags adds the --include-image and --exclude-image flags to the specified flag set.
+func AddImageFilterFlags(fs *pflag.FlagSet, filter *config.ImageFilter) {
+	fs.StringSliceVar(&filter.Include, "include-image", nil,
+		"Only include bundled images matching this glob pattern, matched against <registry>/<image> and "+
+			"<registry>/<image>:<tag>, e.g. docker.io/library/* (can be specified multiple times)")
+	fs.StringSliceVar(&filter.Exclude, "exclude-image", nil,
+		"Exclude bundled images matching this glob pattern, matched against <registry>/<image> and "+
+			"<registry>/<image>:<tag>, e.g. nvcr.io/nvidia/* (can be specified multiple times, takes "+
+			"precedence over --include-image)")
+}
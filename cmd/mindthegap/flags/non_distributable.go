@@ -0,0 +1,13 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import "github.com/spf13/pflag"
+
+// AddIncludeNonDistributableFlag adds the --include-non-distributable flag to the specified flag set.
+func AddIncludeNonDistributableFlag(fs *pflag.FlagSet, include *bool) {
+	fs.BoolVar(include, "include-non-distributable", false,
+		"Include non-distributable (foreign) layers, e.g. the base layers of Windows images, in the bundle, "+
+			"which are otherwise left out and pulled from the URLs in their descriptors by the nodes")
+}
@@ -0,0 +1,16 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import "github.com/spf13/pflag"
+
+// AddNotationTrustPolicyFlags adds the --notation-trust-policy and --notation-trust-store flags to
+// the specified flag set.
+func AddNotationTrustPolicyFlags(fs *pflag.FlagSet, trustPolicyFile, trustStoreDir *string) {
+	fs.StringVar(trustPolicyFile, "notation-trust-policy", "",
+		"Notation trust policy file (trustpolicy.json) to verify Notation signatures of images with")
+	fs.StringVar(trustStoreDir, "notation-trust-store", "",
+		"Notation trust store directory containing the x509/<type>/<name> trust stores referenced by the "+
+			"Notation trust policy")
+}
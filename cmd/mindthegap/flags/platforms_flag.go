@@ -1,7 +1,7 @@
 // Copyright 2021 D2iQ, Inc. All rights reserved.
 // SPDX-License-Identifier: Apache-2.0
 
-package imagebundle
+package flags
 
 import (
 	"bytes"
@@ -10,50 +10,43 @@ import (
 	"strings"
 
 	"github.com/spf13/pflag"
-)
-
-type platform struct {
-	os      string
-	arch    string
-	variant string
-}
-
-func (p platform) OS() string {
-	return p.os
-}
-
-func (p platform) Arch() string {
-	return p.arch
-}
 
-func (p platform) Variant() string {
-	return p.variant
-}
+	"github.com/mesosphere/mindthegap/images/platform"
+)
 
-func (p platform) String() string {
-	s := p.os + "/" + p.arch
-	if p.variant != "" {
-		s += "/" + p.variant
-	}
-	return s
-}
+// AllPlatforms is the platforms flag value requesting all platforms of every image, represented by
+// an empty slice of platforms.
+const AllPlatforms = "all"
 
 // -- platformSlice Value.
 type platformSliceValue struct {
-	value   *[]platform
-	changed bool
+	value    *[]platform.Platform
+	changed  bool
+	allowAll bool
+	all      bool
 }
 
-func newPlatformSlicesValue(val []platform, p *[]platform) *platformSliceValue {
+// NewPlatformsValue returns a flag value holding a slice of platforms, initialized to val. The
+// flag can be specified multiple times and each value can be a comma-separated list of platforms.
+func NewPlatformsValue(val []platform.Platform, p *[]platform.Platform) pflag.Value {
 	psv := new(platformSliceValue)
 	psv.value = p
 	*psv.value = val
 	return psv
 }
 
-func readPlatformsAsCSV(val string) ([]platform, error) {
+// NewPlatformsOrAllValue returns a flag value like NewPlatformsValue that can also be set to
+// AllPlatforms, which sets the slice to an empty slice, requesting all platforms. AllPlatforms cannot
+// be combined with other platforms.
+func NewPlatformsOrAllValue(val []platform.Platform, p *[]platform.Platform) pflag.Value {
+	psv := NewPlatformsValue(val, p).(*platformSliceValue)
+	psv.allowAll = true
+	return psv
+}
+
+func readPlatformsAsCSV(val string) ([]platform.Platform, error) {
 	if val == "" {
-		return []platform{}, nil
+		return []platform.Platform{}, nil
 	}
 	stringReader := strings.NewReader(val)
 	csvReader := csv.NewReader(stringReader)
@@ -61,9 +54,9 @@ func readPlatformsAsCSV(val string) ([]platform, error) {
 	if err != nil {
 		return nil, err
 	}
-	platforms := make([]platform, 0, len(values))
+	platforms := make([]platform.Platform, 0, len(values))
 	for _, v := range values {
-		p, err := parsePlatformString(v)
+		p, err := platform.Parse(v)
 		if err != nil {
 			return nil, err
 		}
@@ -72,7 +65,7 @@ func readPlatformsAsCSV(val string) ([]platform, error) {
 	return platforms, nil
 }
 
-func writePlatformsAsCSV(vals []platform) (string, error) {
+func writePlatformsAsCSV(vals []platform.Platform) (string, error) {
 	b := &bytes.Buffer{}
 	w := csv.NewWriter(b)
 	strs := make([]string, 0, len(vals))
@@ -87,27 +80,24 @@ func writePlatformsAsCSV(vals []platform) (string, error) {
 	return strings.TrimSuffix(b.String(), "\n"), nil
 }
 
-func parsePlatformString(s string) (platform, error) {
-	splitVal := strings.Split(s, "/")
-	if len(splitVal) < 2 || len(splitVal) > 3 {
-		return platform{}, fmt.Errorf(
-			"invalid platform specification: %s (required format: <os>/<arch>[/<variant>]",
-			s,
-		)
-	}
-	p := platform{os: splitVal[0], arch: splitVal[1]}
-	if len(splitVal) == 3 {
-		p.variant = splitVal[2]
-	}
-	return p, nil
-}
-
 var (
 	_ pflag.Value      = &platformSliceValue{}
 	_ pflag.SliceValue = &platformSliceValue{}
 )
 
 func (s *platformSliceValue) Set(val string) error {
+	if s.allowAll && strings.TrimSpace(val) == AllPlatforms {
+		if s.changed && !s.all {
+			return fmt.Errorf("%q cannot be combined with other platforms", AllPlatforms)
+		}
+		*s.value = []platform.Platform{}
+		s.changed, s.all = true, true
+		return nil
+	}
+	if s.all {
+		return fmt.Errorf("%q cannot be combined with other platforms", AllPlatforms)
+	}
+
 	v, err := readPlatformsAsCSV(val)
 	if err != nil {
 		return err
@@ -126,12 +116,15 @@ func (s *platformSliceValue) Type() string {
 }
 
 func (s *platformSliceValue) String() string {
+	if s.all {
+		return "[" + AllPlatforms + "]"
+	}
 	str, _ := writePlatformsAsCSV(*s.value)
 	return "[" + str + "]"
 }
 
 func (s *platformSliceValue) Append(val string) error {
-	p, err := parsePlatformString(val)
+	p, err := platform.Parse(val)
 	if err != nil {
 		return err
 	}
@@ -140,9 +133,9 @@ func (s *platformSliceValue) Append(val string) error {
 }
 
 func (s *platformSliceValue) Replace(val []string) error {
-	ps := make([]platform, 0, len(val))
+	ps := make([]platform.Platform, 0, len(val))
 	for _, v := range val {
-		p, err := parsePlatformString(v)
+		p, err := platform.Parse(v)
 		if err != nil {
 			return err
 		}
@@ -1,7 +1,7 @@
 // Copyright 2021 D2iQ, Inc. All rights reserved.
 // SPDX-License-Identifier: Apache-2.0
 
-package imagebundle
+package flags
 
 import (
 	"fmt"
@@ -9,24 +9,26 @@ import (
 
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/images/platform"
 )
 
 const argfmt = "--ps=%s"
 
-func setUpPSFlagSet(psp *[]platform) *pflag.FlagSet {
+func setUpPSFlagSet(psp *[]platform.Platform) *pflag.FlagSet {
 	f := pflag.NewFlagSet("test", pflag.ContinueOnError)
-	f.Var(newPlatformSlicesValue(
-		[]platform{}, psp),
+	f.Var(NewPlatformsValue(
+		[]platform.Platform{}, psp),
 		"ps", "Command separated list!")
 	return f
 }
 
-func setUpPSFlagSetWithDefault(psp *[]platform) *pflag.FlagSet {
+func setUpPSFlagSetWithDefault(psp *[]platform.Platform) *pflag.FlagSet {
 	f := pflag.NewFlagSet("test", pflag.ContinueOnError)
-	f.Var(newPlatformSlicesValue(
-		[]platform{
-			{os: "defaultos1", arch: "defaultarch1"},
-			{os: "defaultos2", arch: "defaultarch2", variant: "defaultvariant2"},
+	f.Var(NewPlatformsValue(
+		[]platform.Platform{
+			platform.MustParse("defaultos1/defaultarch1"),
+			platform.MustParse("defaultos2/defaultarch2/defaultvariant2"),
 		}, psp),
 		"ps", "Command separated list!")
 	return f
@@ -34,7 +36,7 @@ func setUpPSFlagSetWithDefault(psp *[]platform) *pflag.FlagSet {
 
 func TestEmptyPS(t *testing.T) {
 	t.Parallel()
-	var ps []platform
+	var ps []platform.Platform
 	f := setUpPSFlagSet(&ps)
 	err := f.Parse([]string{})
 	if err != nil {
@@ -50,7 +52,7 @@ func TestEmptyPS(t *testing.T) {
 
 func TestEmptyPSValue(t *testing.T) {
 	t.Parallel()
-	var ps []platform
+	var ps []platform.Platform
 	f := setUpPSFlagSet(&ps)
 	err := f.Parse([]string{"--ps="})
 	if err != nil {
@@ -65,14 +67,14 @@ func TestEmptyPSValue(t *testing.T) {
 
 func TestPS(t *testing.T) {
 	t.Parallel()
-	var ps []platform
+	var ps []platform.Platform
 	f := setUpPSFlagSet(&ps)
 
-	vals := []platform{
-		{os: "linux", arch: "amd64"},
-		{os: "linux", arch: "arm64"},
-		{os: "windows", arch: "amd64"},
-		{os: "darwin", arch: "arm64", variant: "v8"},
+	vals := []platform.Platform{
+		platform.MustParse("linux/amd64"),
+		platform.MustParse("linux/arm64"),
+		platform.MustParse("windows/amd64"),
+		platform.MustParse("darwin/arm64/v8"),
 	}
 	s, err := writePlatformsAsCSV(vals)
 	if err != nil {
@@ -99,12 +101,12 @@ func TestPS(t *testing.T) {
 
 func TestPSDefault(t *testing.T) {
 	t.Parallel()
-	var ps []platform
+	var ps []platform.Platform
 	f := setUpPSFlagSetWithDefault(&ps)
 
-	vals := []platform{
-		{os: "defaultos1", arch: "defaultarch1"},
-		{os: "defaultos2", arch: "defaultarch2", variant: "defaultvariant2"},
+	vals := []platform.Platform{
+		platform.MustParse("defaultos1/defaultarch1"),
+		platform.MustParse("defaultos2/defaultarch2/defaultvariant2"),
 	}
 
 	err := f.Parse([]string{})
@@ -127,14 +129,14 @@ func TestPSDefault(t *testing.T) {
 
 func TestSSWithDefault(t *testing.T) {
 	t.Parallel()
-	var ps []platform
+	var ps []platform.Platform
 	f := setUpPSFlagSetWithDefault(&ps)
 
-	vals := []platform{
-		{os: "linux", arch: "amd64"},
-		{os: "linux", arch: "arm64"},
-		{os: "windows", arch: "amd64"},
-		{os: "darwin", arch: "arm64", variant: "v8"},
+	vals := []platform.Platform{
+		platform.MustParse("linux/amd64"),
+		platform.MustParse("linux/arm64"),
+		platform.MustParse("windows/amd64"),
+		platform.MustParse("darwin/arm64/v8"),
 	}
 	s, err := writePlatformsAsCSV(vals)
 	if err != nil {
@@ -161,14 +163,14 @@ func TestSSWithDefault(t *testing.T) {
 
 func TestSSCalledTwice(t *testing.T) {
 	t.Parallel()
-	var ps []platform
+	var ps []platform.Platform
 	f := setUpPSFlagSet(&ps)
 
 	in := []string{"linux/amd64", "darwin/arm64/v8,linux/arm/v7"}
-	expected := []platform{
-		{os: "linux", arch: "amd64"},
-		{os: "darwin", arch: "arm64", variant: "v8"},
-		{os: "linux", arch: "arm", variant: "v7"},
+	expected := []platform.Platform{
+		platform.MustParse("linux/amd64"),
+		platform.MustParse("darwin/arm64/v8"),
+		platform.MustParse("linux/arm/v7"),
 	}
 
 	arg1 := fmt.Sprintf(argfmt, in[0])
@@ -201,15 +203,15 @@ func TestSSCalledTwice(t *testing.T) {
 
 func TestSSWithComma(t *testing.T) {
 	t.Parallel()
-	var ps []platform
+	var ps []platform.Platform
 	f := setUpPSFlagSet(&ps)
 
 	in := []string{`"linux/amd64"`, `"windows/amd64"`, `"darwin/arm64/v8",linux/arm/v7`}
-	expected := []platform{
-		{os: "linux", arch: "amd64"},
-		{os: "windows", arch: "amd64"},
-		{os: "darwin", arch: "arm64", variant: "v8"},
-		{os: "linux", arch: "arm", variant: "v7"},
+	expected := []platform.Platform{
+		platform.MustParse("linux/amd64"),
+		platform.MustParse("windows/amd64"),
+		platform.MustParse("darwin/arm64/v8"),
+		platform.MustParse("linux/arm/v7"),
 	}
 	arg1 := fmt.Sprintf(argfmt, in[0])
 	arg2 := fmt.Sprintf(argfmt, in[1])
@@ -246,7 +248,7 @@ func TestSSWithComma(t *testing.T) {
 
 func TestPSAsSliceValue(t *testing.T) {
 	t.Parallel()
-	var ps []platform
+	var ps []platform.Platform
 	f := setUpPSFlagSet(&ps)
 
 	in := []string{"linux/amd64", "darwin/arm64/v8"}
@@ -259,10 +261,10 @@ func TestPSAsSliceValue(t *testing.T) {
 			_ = val.Replace([]string{"windows/arm/v7"})
 		}
 	})
-	expectedPlatform := platform{os: "windows", arch: "arm", variant: "v7"}
+	expectedPlatform := platform.MustParse("windows/arm/v7")
 	require.ElementsMatch(
 		t,
-		[]platform{expectedPlatform},
+		[]platform.Platform{expectedPlatform},
 		ps,
 		"Expected ps to be overwritten with 'windows/arm/v7'",
 	)
@@ -270,7 +272,7 @@ func TestPSAsSliceValue(t *testing.T) {
 
 func TestPSGetSlice(t *testing.T) {
 	t.Parallel()
-	var ps []platform
+	var ps []platform.Platform
 	f := setUpPSFlagSet(&ps)
 
 	in := []string{"linux/amd64", "darwin/arm64/v8"}
@@ -287,7 +289,7 @@ func TestPSGetSlice(t *testing.T) {
 
 func TestPSAppend(t *testing.T) {
 	t.Parallel()
-	var ps []platform
+	var ps []platform.Platform
 	f := setUpPSFlagSet(&ps)
 
 	in := []string{"linux/amd64", "darwin/arm64/v8"}
@@ -309,14 +311,46 @@ func TestPSAppend(t *testing.T) {
 
 func TestPSInvalidPlatform(t *testing.T) {
 	t.Parallel()
-	var ps []platform
+	var ps []platform.Platform
 	f := setUpPSFlagSet(&ps)
 
 	in := []string{"wibble"}
 	arg1 := fmt.Sprintf(argfmt, in[0])
 	require.EqualError(t, f.Parse([]string{arg1}),
 		`invalid argument "wibble" for "--ps" flag: invalid platform specification: `+
-			`wibble (required format: <os>/<arch>[/<variant>]`,
+			`wibble (required format: <os>/<arch>[/<variant>][:<os.version>]`,
 		"expected error parsing flags",
 	)
 }
+
+func TestPSAll(t *testing.T) {
+	t.Parallel()
+	ps := []platform.Platform{platform.MustParse("linux/amd64")}
+	f := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	f.Var(NewPlatformsOrAllValue(ps, &ps), "ps", "Command separated list!")
+
+	require.NoError(t, f.Parse([]string{fmt.Sprintf(argfmt, AllPlatforms)}))
+	require.Empty(t, ps)
+	require.NotNil(t, ps)
+	require.Equal(t, "[all]", f.Lookup("ps").Value.String())
+}
+
+func TestPSAllCombined(t *testing.T) {
+	t.Parallel()
+	var ps []platform.Platform
+	f := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	f.Var(NewPlatformsOrAllValue(nil, &ps), "ps", "Command separated list!")
+
+	require.EqualError(t,
+		f.Parse([]string{fmt.Sprintf(argfmt, "linux/amd64"), fmt.Sprintf(argfmt, AllPlatforms)}),
+		`invalid argument "all" for "--ps" flag: "all" cannot be combined with other platforms`,
+	)
+}
+
+func TestPSAllNotAllowed(t *testing.T) {
+	t.Parallel()
+	var ps []platform.Platform
+	f := setUpPSFlagSet(&ps)
+
+	require.Error(t, f.Parse([]string{fmt.Sprintf(argfmt, AllPlatforms)}))
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// PortRange is a range of ports in the format <first>-<last>, e.g. 5000-5100.
+type PortRange struct {
+	First uint16
+	Last  uint16
+}
+
+func (v *PortRange) String() string {
+	if v.First == 0 && v.Last == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", v.First, v.Last)
+}
+
+func (v *PortRange) Set(value string) error {
+	firstStr, lastStr, found := strings.Cut(value, "-")
+	if !found {
+		return fmt.Errorf("invalid port range %q: required format is <first>-<last>, e.g. 5000-5100", value)
+	}
+	first, err := strconv.ParseUint(firstStr, 10, 16)
+	if err != nil || first == 0 {
+		return fmt.Errorf("invalid first port %q in port range %q", firstStr, value)
+	}
+	last, err := strconv.ParseUint(lastStr, 10, 16)
+	if err != nil || last < first {
+		return fmt.Errorf("invalid last port %q in port range %q", lastStr, value)
+	}
+	v.First, v.Last = uint16(first), uint16(last)
+	return nil
+}
+
+func (*PortRange) Type() string {
+	return "string"
+}
+
+// AddTemporaryRegistryListenFlags adds the --listen-address and --listen-port-range flags for the
+// temporary registry that bundles are created with to the specified flag set.
+func AddTemporaryRegistryListenFlags(fs *pflag.FlagSet, listenAddress *string, portRange *PortRange) {
+	fs.StringVar(listenAddress, "listen-address", "127.0.0.1",
+		"Address for the temporary registry used to create the bundle to listen on")
+	fs.Var(portRange, "listen-port-range",
+		"Range of ports for the temporary registry used to create the bundle to listen on the first free port "+
+			"of, e.g. 5000-5100 (any free port if not set)")
+}
+
+// AddListenPortRangeFlag adds the --listen-port-range flag to the specified flag set.
+func AddListenPortRangeFlag(fs *pflag.FlagSet, portRange *PortRange) {
+	fs.Var(portRange, "listen-port-range",
+		"Range of ports to listen on the first free port of, e.g. 5000-5100")
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortRange(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in      string
+		want    PortRange
+		wantErr string
+	}{{
+		in:   "5000-5100",
+		want: PortRange{First: 5000, Last: 5100},
+	}, {
+		in:   "5000-5000",
+		want: PortRange{First: 5000, Last: 5000},
+	}, {
+		in:      "5000",
+		wantErr: "required format is <first>-<last>",
+	}, {
+		in:      "0-5000",
+		wantErr: `invalid first port "0"`,
+	}, {
+		in:      "5100-5000",
+		wantErr: `invalid last port "5000"`,
+	}, {
+		in:      "5000-70000",
+		wantErr: `invalid last port "70000"`,
+	}}
+	for ti := range tests {
+		tt := tests[ti]
+		t.Run(tt.in, func(t *testing.T) {
+			t.Parallel()
+
+			var v PortRange
+			err := v.Set(tt.in)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, v)
+			assert.Equal(t, tt.in, v.String())
+		})
+	}
+}
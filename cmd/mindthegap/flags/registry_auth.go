@@ -0,0 +1,30 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"github.com/spf13/pflag"
+
+	"github.com/mesosphere/mindthegap/images/authnhelpers"
+)
+
+// AddRegistryAuthFileFlag adds the --registry-auth-file flag to the specified flag set.
+func AddRegistryAuthFileFlag(fs *pflag.FlagSet, authFile *string) {
+	fs.StringVar(authFile, "registry-auth-file", "",
+		"File to read registry credentials from, in the format of the Docker config file (config.json) "+
+			"including credential helpers, or the containers auth file (auth.json) "+
+			"(defaults to $DOCKER_CONFIG/config.json or ~/.docker/config.json)")
+}
+
+// AddRegistryCredentialFlags adds the --prompt-credentials and --use-keyring flags to the specified
+// flag set.
+func AddRegistryCredentialFlags(fs *pflag.FlagSet, opts *authnhelpers.CredentialOptions) {
+	fs.BoolVar(&opts.Prompt, "prompt-credentials", false,
+		"Interactively prompt once per registry for credentials that are neither configured in the images "+
+			"config file nor in the registry auth file, so that they never appear in files or the shell history")
+	fs.BoolVar(&opts.UseKeyring, "use-keyring", false,
+		"Use registry credentials stored in the OS keyring by previous runs, storing the username and password "+
+			"prompted for via --prompt-credentials in it as entered once the registry has accepted them "+
+			"(the macOS keychain, the Windows credential manager or the Secret Service on Linux)")
+}
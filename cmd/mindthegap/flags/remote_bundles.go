@@ -0,0 +1,24 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"github.com/spf13/pflag"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+)
+
+// AddRemoteBundleFlags adds the flags configuring how bundles specified as HTTP(S) URLs are
+// downloaded to the specified flag set.
+func AddRemoteBundleFlags(fs *pflag.FlagSet, opts *utils.RemoteBundleOptions) {
+	fs.StringVar(&opts.CacheDir, "bundle-cache-dir", "",
+		"Directory to download bundles specified as HTTP(S) URLs to, reusing bundles downloaded by previous runs "+
+			"if they have not changed on the server (defaults to a temporary directory)")
+	fs.StringVar(&opts.CACertificateFile, "bundle-download-ca-cert-file", "",
+		"CA certificate file used to verify TLS certificates of servers to download bundles from")
+	fs.BoolVar(&opts.InsecureSkipTLSVerify, "bundle-download-insecure-skip-tls-verify", false,
+		"Skip TLS verification of servers to download bundles from")
+	fs.IntVar(&opts.Retries, "bundle-download-retries", 3,
+		"Number of times to resume downloading a bundle after transient errors")
+}
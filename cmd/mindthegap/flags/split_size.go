@@ -0,0 +1,50 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"fmt"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/pflag"
+)
+
+// minSplitSize is the smallest supported size of bundle parts, so that bundles are not split into
+// an unreasonable number of parts by mistake, e.g. when omitting the unit.
+const minSplitSize = 1 << 20
+
+// SplitSize is the size of bundle parts in bytes with an optional binary unit, e.g. 4GiB or 4G.
+type SplitSize struct {
+	// Bytes is the parsed size, zero if not set.
+	Bytes int64
+	value string
+}
+
+func (v *SplitSize) String() string {
+	return v.value
+}
+
+func (v *SplitSize) Set(value string) error {
+	bytes, err := units.RAMInBytes(value)
+	if err != nil {
+		return fmt.Errorf("invalid split size %q: must be a size such as 4GiB", value)
+	}
+	if bytes < minSplitSize {
+		return fmt.Errorf("invalid split size %q: must be at least 1MiB", value)
+	}
+	v.Bytes, v.value = bytes, value
+	return nil
+}
+
+func (*SplitSize) Type() string {
+	return "size"
+}
+
+// AddSplitSizeFlag adds the --split-size flag to the specified flag set.
+func AddSplitSizeFlag(fs *pflag.FlagSet, splitSize *SplitSize) {
+	fs.Var(splitSize, "split-size",
+		"Split the bundle into parts of at most this size, e.g. 4GiB, written next to the output file as "+
+			"<output-file>.part0001 onwards, with an index of the parts written to the output file itself, "+
+			"which serve, push and import accept like any other bundle")
+}
@@ -0,0 +1,29 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitSize(t *testing.T) {
+	t.Parallel()
+
+	var v SplitSize
+	assert.Equal(t, "", v.String())
+
+	require.NoError(t, v.Set("4GiB"))
+	assert.EqualValues(t, 4<<30, v.Bytes)
+	assert.Equal(t, "4GiB", v.String())
+
+	require.NoError(t, v.Set("512M"))
+	assert.EqualValues(t, 512<<20, v.Bytes)
+
+	require.ErrorContains(t, v.Set("4 gigabytes"), "must be a size such as 4GiB")
+	require.ErrorContains(t, v.Set("4096"), "must be at least 1MiB")
+	assert.EqualValues(t, 512<<20, v.Bytes)
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package flags
+
+import (
+	"context"
+	"errors"
+
+	"github.com/spf13/pflag"
+
+	"github.com/mesosphere/mindthegap/docker/registry"
+)
+
+// TokenAuthOptions configures token auth of served registries, see AddTokenAuthFlags.
+type TokenAuthOptions struct {
+	Realm          string
+	Service        string
+	Issuer         string
+	RootCertBundle string
+
+	UsersFile         string
+	OIDCIssuerURL     string
+	OIDCClientID      string
+	OIDCUsernameClaim string
+}
+
+// AddTokenAuthFlags adds the --token-auth-* flags to the specified flag set.
+func AddTokenAuthFlags(fs *pflag.FlagSet, opts *TokenAuthOptions) {
+	fs.StringVar(&opts.UsersFile, "token-auth-users-file", "",
+		"Users file in htpasswd format with bcrypt password hashes, e.g. created with htpasswd -B, to authenticate "+
+			"clients with via the built-in token issuer, which grants them pull access (requires bearer tokens for "+
+			"all registry requests)")
+	fs.StringVar(&opts.OIDCIssuerURL, "token-auth-oidc-issuer-url", "",
+		"URL of an OIDC issuer to authenticate clients presenting an ID token as password with via the built-in "+
+			"token issuer, which grants them pull access (requires bearer tokens for all registry requests)")
+	fs.StringVar(&opts.OIDCClientID, "token-auth-oidc-client-id", "",
+		"Client ID that ID tokens must be issued for (required with --token-auth-oidc-issuer-url)")
+	fs.StringVar(&opts.OIDCUsernameClaim, "token-auth-oidc-username-claim", "sub",
+		"Claim of ID tokens to use as the name of authenticated users")
+	fs.StringVar(&opts.RootCertBundle, "token-auth-root-cert-bundle", "",
+		"Certificates of the keys that tokens of an external token issuer are signed with, instead of the "+
+			"built-in token issuer (requires bearer tokens for all registry requests, requires --token-auth-realm and "+
+			"--token-auth-issuer)")
+	fs.StringVar(&opts.Realm, "token-auth-realm", "",
+		"URL of the token issuer that clients are directed to (defaults to "+registry.TokenPath+" on the mirror "+
+			"address for the built-in token issuer)")
+	fs.StringVar(&opts.Service, "token-auth-service", registry.DefaultTokenAuthService,
+		"Name of the registry that tokens are issued for")
+	fs.StringVar(&opts.Issuer, "token-auth-issuer", "",
+		"Name of the token issuer that tokens must be issued by (defaults to the service name for the built-in "+
+			"token issuer)")
+}
+
+// IsEmpty returns true if token auth is not enabled.
+func (o TokenAuthOptions) IsEmpty() bool {
+	return !o.builtInIssuer() && o.RootCertBundle == ""
+}
+
+func (o TokenAuthOptions) builtInIssuer() bool {
+	return o.UsersFile != "" || o.OIDCIssuerURL != ""
+}
+
+func (o TokenAuthOptions) Validate() error {
+	if (o.OIDCIssuerURL == "") != (o.OIDCClientID == "") {
+		return errors.New("--token-auth-oidc-issuer-url and --token-auth-oidc-client-id must be specified together")
+	}
+	if o.RootCertBundle != "" {
+		if o.builtInIssuer() {
+			return errors.New(
+				"--token-auth-root-cert-bundle cannot be combined with --token-auth-users-file or " +
+					"--token-auth-oidc-issuer-url",
+			)
+		}
+		if o.Realm == "" || o.Issuer == "" {
+			return errors.New("--token-auth-root-cert-bundle requires --token-auth-realm and --token-auth-issuer")
+		}
+		return nil
+	}
+	if !o.builtInIssuer() && (o.Realm != "" || o.Issuer != "") {
+		return errors.New(
+			"--token-auth-realm and --token-auth-issuer require --token-auth-root-cert-bundle, " +
+				"--token-auth-users-file or --token-auth-oidc-issuer-url",
+		)
+	}
+	return nil
+}
+
+// TokenAuth returns the token auth configuration of the registry, loading the users file and
+// discovering the OIDC issuer if set, or nil if token auth is not enabled.
+func (o TokenAuthOptions) TokenAuth(ctx context.Context) (*registry.TokenAuth, error) {
+	if o.IsEmpty() {
+		return nil, nil
+	}
+
+	tokenAuth := &registry.TokenAuth{
+		Realm:          o.Realm,
+		Service:        o.Service,
+		Issuer:         o.Issuer,
+		RootCertBundle: o.RootCertBundle,
+	}
+	if o.UsersFile != "" {
+		users, err := registry.NewUsersFileAuthenticator(o.UsersFile)
+		if err != nil {
+			return nil, err
+		}
+		tokenAuth.Authenticators = append(tokenAuth.Authenticators, users)
+	}
+	if o.OIDCIssuerURL != "" {
+		oidc, err := registry.NewOIDCAuthenticator(
+			ctx, o.OIDCIssuerURL, o.OIDCClientID, o.OIDCUsernameClaim, nil,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tokenAuth.Authenticators = append(tokenAuth.Authenticators, oidc)
+	}
+	return tokenAuth, nil
+}
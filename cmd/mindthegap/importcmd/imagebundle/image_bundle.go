@@ -5,10 +5,11 @@ package imagebundle
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -24,12 +25,15 @@ import (
 	"github.com/mesosphere/mindthegap/containerd"
 	"github.com/mesosphere/mindthegap/docker/registry"
 	"github.com/mesosphere/mindthegap/images/httputils"
+	"github.com/mesosphere/mindthegap/images/platform"
 )
 
 func NewCommand(out output.Output) *cobra.Command {
 	var (
-		imageBundleFiles    []string
-		containerdNamespace string
+		imageBundleFiles     []string
+		containerdNamespace  string
+		imageVerifiersDir    string
+		imageVerifierTimeout time.Duration
 	)
 
 	cmd := &cobra.Command{
@@ -46,7 +50,7 @@ func NewCommand(out output.Output) *cobra.Command {
 
 			return nil
 		},
-		RunE: func(cmd *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			cleaner := cleanup.NewCleaner()
 			defer cleaner.Cleanup()
 
@@ -76,10 +80,18 @@ func NewCommand(out output.Output) *cobra.Command {
 				out.EndOperationWithStatus(output.Failure())
 				return fmt.Errorf("failed to create local Docker registry: %w", err)
 			}
-			go func() {
-				if err := reg.ListenAndServe(); err != nil {
-					out.Error(err, "error serving Docker registry")
-					os.Exit(2)
+			regCtx, stopReg := context.WithCancel(cmd.Context())
+			regErrCh, err := reg.Start(regCtx)
+			if err != nil {
+				stopReg()
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to start local Docker registry: %w", err)
+			}
+			// Wait for the registry to stop before its storage is cleaned up.
+			defer func() {
+				stopReg()
+				for regErr := range regErrCh {
+					err = errors.Join(err, regErr)
 				}
 			}()
 			out.EndOperationWithStatus(output.Success())
@@ -90,7 +102,7 @@ func NewCommand(out output.Output) *cobra.Command {
 			}
 			cleaner.AddCleanupFn(func() { _ = os.RemoveAll(ociExportsTempDir) })
 
-			sourceTLSRoundTripper, err := httputils.InsecureTLSRoundTripper(remote.DefaultTransport)
+			sourceTLSRoundTripper, err := httputils.LocalRegistryRoundTripper(remote.DefaultTransport)
 			if err != nil {
 				out.Error(err, "error configuring TLS for source registry")
 				os.Exit(2)
@@ -111,12 +123,26 @@ func NewCommand(out output.Output) *cobra.Command {
 							return err
 						}
 
+						if imageVerifiersDir != "" {
+							desc, err := remote.Head(ref, remote.WithTransport(sourceTLSRoundTripper), remote.WithContext(cmd.Context()))
+							if err != nil {
+								out.EndOperationWithStatus(output.Failure())
+								return err
+							}
+
+							if err := containerd.VerifyImage(
+								cmd.Context(), imageVerifiersDir, imageVerifierTimeout, destImageName, *desc,
+							); err != nil {
+								out.EndOperationWithStatus(output.Failure())
+								return err
+							}
+						}
+
 						v1Image, err := remote.Image(
 							ref,
 							remote.WithTransport(sourceTLSRoundTripper),
-							remote.WithPlatform(
-								v1.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH},
-							),
+							remote.WithPlatform(platform.Current().ToV1()),
+							remote.WithContext(cmd.Context()),
 						)
 						if err != nil {
 							out.EndOperationWithStatus(output.Failure())
@@ -137,7 +163,7 @@ func NewCommand(out output.Output) *cobra.Command {
 						}
 
 						ctrOutput, err := containerd.ImportImageArchive(
-							context.TODO(), exportTarball, containerdNamespace,
+							cmd.Context(), exportTarball, containerdNamespace,
 						)
 						if err != nil {
 							out.Warn(string(ctrOutput))
@@ -163,6 +189,11 @@ func NewCommand(out output.Output) *cobra.Command {
 	_ = cmd.MarkFlagRequired("image-bundle")
 	cmd.Flags().StringVar(&containerdNamespace, "containerd-namespace", "k8s.io",
 		"Containerd namespace to import images into")
+	cmd.Flags().StringVar(&imageVerifiersDir, "image-verifiers-dir", "",
+		"Directory containing containerd image verifier plugins to run for each image before importing it, "+
+			"e.g. /opt/containerd/image-verifier/bin (all verifiers must accept an image for it to be imported)")
+	cmd.Flags().DurationVar(&imageVerifierTimeout, "image-verifier-timeout", containerd.DefaultImageVerifierTimeout,
+		"Time allowed for each image verifier to run")
 
 	return cmd
 }
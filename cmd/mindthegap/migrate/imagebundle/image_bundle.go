@@ -0,0 +1,132 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/cleanup"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+)
+
+func NewCommand(out output.Output) *cobra.Command {
+	var (
+		imageBundleFile  string
+		outputFile       string
+		overwrite        bool
+		compression      archive.Compression
+		compressionLevel int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "image-bundle",
+		Short: "Rewrite an image bundle in the current bundle format",
+		Long: "Rewrite an image bundle created by an older version of mindthegap in the current bundle format, " +
+			"adding the bundle metadata that records the format version and contents of the bundle",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := cmd.ValidateRequiredFlags(); err != nil {
+				return err
+			}
+
+			if err := flags.ValidateFlagsThatRequireValues(cmd, "image-bundle", "output-file"); err != nil {
+				return err
+			}
+
+			return flags.ResolveCompression(cmd.Flags(), outputFile, &compression, compressionLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !overwrite {
+				out.StartOperation("Checking if output file already exists")
+				_, err := os.Stat(outputFile)
+				switch {
+				case err == nil:
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf(
+						"%s already exists: specify --overwrite to overwrite existing file",
+						outputFile,
+					)
+				case !errors.Is(err, os.ErrNotExist):
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf(
+						"failed to check if output file %s already exists: %w",
+						outputFile,
+						err,
+					)
+				default:
+					out.EndOperationWithStatus(output.Success())
+				}
+			}
+
+			cleaner := cleanup.NewCleaner()
+			defer cleaner.Cleanup()
+
+			out.StartOperation("Creating temporary directory")
+			tempDir, err := os.MkdirTemp("", ".image-bundle-*")
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to create temporary directory: %w", err)
+			}
+			cleaner.AddCleanupFn(func() { _ = os.RemoveAll(tempDir) })
+			out.EndOperationWithStatus(output.Success())
+
+			out.StartOperation(fmt.Sprintf("Unarchiving image bundle %q", imageBundleFile))
+			if err := archive.UnarchiveToDirectory(imageBundleFile, tempDir); err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to unarchive image bundle: %w", err)
+			}
+			out.EndOperationWithStatus(output.Success())
+
+			out.StartOperation("Upgrading bundle metadata")
+			metadata, upgraded, err := utils.ReadBundleMetadata(tempDir)
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return err
+			}
+			if upgraded {
+				if err := utils.WriteBundleMetadata(tempDir, *metadata); err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return err
+				}
+			}
+			out.EndOperationWithStatus(output.Success())
+			if !upgraded {
+				out.Infof(
+					"Image bundle %s is already in bundle format version %d\n",
+					imageBundleFile, metadata.FormatVersion,
+				)
+			}
+
+			out.StartOperation(fmt.Sprintf("Archiving image bundle to %s", outputFile))
+			if err := archive.ArchiveDirectoryWithOptions(tempDir, outputFile, archive.Options{
+				Compression:         compression,
+				CompressionLevel:    compressionLevel,
+				RemoveArchivedFiles: true,
+			}); err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to create image bundle tarball: %w", err)
+			}
+			out.EndOperationWithStatus(output.Success())
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&imageBundleFile, "image-bundle", "", "Image bundle to migrate")
+	_ = cmd.MarkFlagRequired("image-bundle")
+	cmd.Flags().StringVar(&outputFile, "output-file", "", "Output file to write the migrated image bundle to")
+	_ = cmd.MarkFlagRequired("output-file")
+	cmd.Flags().
+		BoolVar(&overwrite, "overwrite", false, "Overwrite output file if it already exists")
+	flags.AddCompressionFlags(cmd.Flags(), &compression, &compressionLevel)
+
+	return cmd
+}
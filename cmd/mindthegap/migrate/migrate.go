@@ -0,0 +1,22 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package migrate
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/migrate/imagebundle"
+)
+
+func NewCommand(out output.Output) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate bundles to the current bundle format",
+	}
+
+	cmd.AddCommand(imagebundle.NewCommand(out))
+	return cmd
+}
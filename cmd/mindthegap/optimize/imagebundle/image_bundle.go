@@ -0,0 +1,282 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/go-units"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/cleanup"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/docker/registry"
+)
+
+func NewCommand(out output.Output) *cobra.Command {
+	var (
+		imageBundleFile   string
+		outputFile        string
+		overwrite         bool
+		deduplicateLayers bool
+		zstdLayers        bool
+		compression       archive.Compression
+		compressionLevel  int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "image-bundle",
+		Short: "Reduce the size of an image bundle",
+		Long: "Reduce the size of an image bundle by collecting garbage in the registry storage of the bundle, " +
+			"optionally deduplicating layers with identical contents and recompressing layers with zstd, and " +
+			"report the space saved",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := cmd.ValidateRequiredFlags(); err != nil {
+				return err
+			}
+
+			if err := flags.ValidateFlagsThatRequireValues(cmd, "image-bundle", "output-file"); err != nil {
+				return err
+			}
+
+			return flags.ResolveCompression(cmd.Flags(), outputFile, &compression, compressionLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !overwrite {
+				out.StartOperation("Checking if output file already exists")
+				_, err := os.Stat(outputFile)
+				switch {
+				case err == nil:
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf(
+						"%s already exists: specify --overwrite to overwrite existing file",
+						outputFile,
+					)
+				case !errors.Is(err, os.ErrNotExist):
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf(
+						"failed to check if output file %s already exists: %w",
+						outputFile,
+						err,
+					)
+				default:
+					out.EndOperationWithStatus(output.Success())
+				}
+			}
+
+			cleaner := cleanup.NewCleaner()
+			defer cleaner.Cleanup()
+
+			out.StartOperation("Creating temporary directory")
+			tempDir, err := os.MkdirTemp("", ".image-bundle-*")
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to create temporary directory: %w", err)
+			}
+			cleaner.AddCleanupFn(func() { _ = os.RemoveAll(tempDir) })
+			bundleDir := filepath.Join(tempDir, "bundle")
+			layersDir := filepath.Join(tempDir, "layers")
+			for _, dir := range []string{bundleDir, layersDir} {
+				if err := os.Mkdir(dir, 0o755); err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf("failed to create temporary directory: %w", err)
+				}
+			}
+			out.EndOperationWithStatus(output.Success())
+
+			out.StartOperation(fmt.Sprintf("Unarchiving image bundle %q", imageBundleFile))
+			if err := archive.UnarchiveToDirectory(imageBundleFile, bundleDir); err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to unarchive image bundle: %w", err)
+			}
+			out.EndOperationWithStatus(output.Success())
+
+			metadata, _, err := utils.ReadBundleMetadata(bundleDir)
+			if err != nil {
+				return err
+			}
+			if metadata.Contents.Layout != utils.RegistryBundleLayout {
+				return fmt.Errorf(
+					"only image bundles with the %q layout can be optimized, %s has the %q layout",
+					utils.RegistryBundleLayout, imageBundleFile, metadata.Contents.Layout,
+				)
+			}
+
+			usageBefore, err := registry.Usage(bundleDir)
+			if err != nil {
+				return err
+			}
+
+			optimizer, err := optimizeLayers(
+				cmd.Context(), out, bundleDir, layersDir, deduplicateLayers, zstdLayers,
+			)
+			if err != nil {
+				return err
+			}
+
+			out.StartOperation("Collecting garbage")
+			if err := registry.GarbageCollect(
+				cmd.Context(), bundleDir, optimizer.manifestsToDelete(),
+			); err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return err
+			}
+			out.EndOperationWithStatus(output.Success())
+
+			usageAfter, err := registry.Usage(bundleDir)
+			if err != nil {
+				return err
+			}
+
+			out.StartOperation(fmt.Sprintf("Archiving image bundle to %s", outputFile))
+			if err := archive.ArchiveDirectoryWithOptions(bundleDir, outputFile, archive.Options{
+				Context:             cmd.Context(),
+				Compression:         compression,
+				CompressionLevel:    compressionLevel,
+				RemoveArchivedFiles: true,
+			}); err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to create image bundle tarball: %w", err)
+			}
+			out.EndOperationWithStatus(output.Success())
+
+			return reportSavings(out, imageBundleFile, outputFile, usageBefore, usageAfter, optimizer)
+		},
+	}
+
+	cmd.Flags().StringVar(&imageBundleFile, "image-bundle", "", "Image bundle to optimize")
+	_ = cmd.MarkFlagRequired("image-bundle")
+	cmd.Flags().StringVar(&outputFile, "output-file", "", "Output file to write the optimized image bundle to")
+	_ = cmd.MarkFlagRequired("output-file")
+	cmd.Flags().
+		BoolVar(&overwrite, "overwrite", false, "Overwrite output file if it already exists")
+	cmd.Flags().BoolVar(&deduplicateLayers, "deduplicate-layers", false,
+		"Store layers with identical uncompressed contents only once, rewriting the manifests of images "+
+			"that reference duplicates (changes the digests of rewritten images)")
+	cmd.Flags().BoolVar(&zstdLayers, "recompress-layers-with-zstd", false,
+		"Recompress layers with zstd, converting the manifests of rewritten images to OCI manifests "+
+			"(changes the digests of rewritten images, requires containerd 1.5 or later to pull them)")
+	flags.AddCompressionFlags(cmd.Flags(), &compression, &compressionLevel)
+
+	return cmd
+}
+
+// optimizeLayers serves the registry storage in dir to deduplicate and recompress the layers of the
+// images in it. Duplicate layers are reported even if they are not deduplicated.
+func optimizeLayers(
+	ctx context.Context,
+	out output.Output,
+	dir, layersDir string,
+	deduplicate, recompress bool,
+) (optimizer *layerOptimizer, err error) {
+	reg, err := registry.NewRegistry(registry.Config{StorageDirectory: dir})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create local Docker registry: %w", err)
+	}
+	regCtx, stopReg := context.WithCancel(context.Background())
+	regErrCh, err := reg.Start(regCtx)
+	if err != nil {
+		stopReg()
+		return nil, fmt.Errorf("failed to start local Docker registry: %w", err)
+	}
+	defer func() {
+		stopReg()
+		for regErr := range regErrCh {
+			err = errors.Join(err, regErr)
+		}
+	}()
+
+	regName, err := name.NewRegistry(reg.Address(), name.Insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	operation := "Finding duplicate layers"
+	switch {
+	case deduplicate && recompress:
+		operation = "Deduplicating and recompressing layers"
+	case deduplicate:
+		operation = "Deduplicating layers"
+	case recompress:
+		operation = "Recompressing layers"
+	}
+	out.StartOperation(operation)
+	optimizer = newLayerOptimizer(
+		out, regName, layersDir, deduplicate, recompress, remote.WithContext(ctx),
+	)
+	if err := optimizer.optimize(ctx); err != nil {
+		out.EndOperationWithStatus(output.Failure())
+		return nil, err
+	}
+	out.EndOperationWithStatus(output.Success())
+
+	return optimizer, nil
+}
+
+func reportSavings(
+	out output.Output,
+	imageBundleFile, outputFile string,
+	usageBefore, usageAfter registry.StorageUsage,
+	optimizer *layerOptimizer,
+) error {
+	bundleBefore, err := os.Stat(imageBundleFile)
+	if err != nil {
+		return err
+	}
+	bundleAfter, err := os.Stat(outputFile)
+	if err != nil {
+		return err
+	}
+
+	if optimizer.rewrittenImages > 0 {
+		out.Infof(
+			"Rewrote %d images, recompressing %d layers with zstd\n",
+			optimizer.rewrittenImages, optimizer.recompressedLayers,
+		)
+	}
+	if count, size := optimizer.duplicates(); count > 0 && !optimizer.deduplicate {
+		out.Infof(
+			"Found %d duplicate layers with identical contents as other layers (%s): "+
+				"specify --deduplicate-layers to store them only once\n",
+			count, units.BytesSize(float64(size)),
+		)
+	}
+	out.Infof(
+		"Registry storage: %d blobs (%s) before, %d blobs (%s) after, %s\n",
+		usageBefore.Blobs, units.BytesSize(float64(usageBefore.Bytes)),
+		usageAfter.Blobs, units.BytesSize(float64(usageAfter.Bytes)),
+		savings(usageBefore.Bytes, usageAfter.Bytes),
+	)
+	out.Infof(
+		"Image bundle: %s before, %s after, %s\n",
+		units.BytesSize(float64(bundleBefore.Size())),
+		units.BytesSize(float64(bundleAfter.Size())),
+		savings(bundleBefore.Size(), bundleAfter.Size()),
+	)
+	return nil
+}
+
+func savings(before, after int64) string {
+	if after > before {
+		return fmt.Sprintf("grew by %s", units.BytesSize(float64(after-before)))
+	}
+	if before == 0 {
+		return "saved 0B"
+	}
+	return fmt.Sprintf(
+		"saved %s (%.1f%%)",
+		units.BytesSize(float64(before-after)),
+		float64(before-after)*100/float64(before),
+	)
+}
@@ -0,0 +1,607 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/compression"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/images"
+)
+
+// signatureTagRegexp matches the tags of signatures and referrers, which are named after the digest
+// of the manifest they refer to, e.g. `sha256-<hex>` or `sha256-<hex>.sig`.
+var signatureTagRegexp = regexp.MustCompile(`^sha256-[0-9a-f]{64}`)
+
+// layerKey identifies layers with identical contents: layers with the same uncompressed contents
+// and media type are interchangeable, no matter how they have been compressed.
+type layerKey struct {
+	diffID    v1.Hash
+	mediaType types.MediaType
+}
+
+// canonicalLayer is the layer that all layers with the same key are replaced with when
+// deduplicating layers.
+type canonicalLayer struct {
+	layer v1.Layer
+	desc  v1.Descriptor
+}
+
+// layerOptimizer rewrites the images in registry storage so that layers with identical contents
+// are stored only once and, optionally, recompressed with zstd.
+type layerOptimizer struct {
+	out        output.Output
+	registry   name.Registry
+	tempDir    string
+	remoteOpts []remote.Option
+
+	deduplicate bool
+	recompress  bool
+
+	// zstdLayers are the layers recompressed with zstd by the digest of their uncompressed contents,
+	// so that layers shared by multiple images are only recompressed once.
+	zstdLayers map[v1.Hash]v1.Layer
+	// canonicalLayers are the first layers seen with each contents.
+	canonicalLayers map[layerKey]canonicalLayer
+	// duplicateLayers are the sizes of layers that have the same contents as their canonical layer,
+	// by their digest.
+	duplicateLayers map[v1.Hash]int64
+	// uploadedLayers are the repositories layers have been written to, so that they are mounted
+	// from there into other repositories rather than uploaded again.
+	uploadedLayers map[v1.Hash]name.Repository
+
+	// replacedManifests are the manifests that have been replaced by rewritten manifests, by
+	// repository.
+	replacedManifests map[string]map[digest.Digest]struct{}
+	// keptManifests are the manifests that are still referenced by tags, by repository.
+	keptManifests map[string]map[digest.Digest]struct{}
+
+	rewrittenImages    int
+	recompressedLayers int
+}
+
+func newLayerOptimizer(
+	out output.Output,
+	registry name.Registry,
+	tempDir string,
+	deduplicate, recompress bool,
+	remoteOpts ...remote.Option,
+) *layerOptimizer {
+	return &layerOptimizer{
+		out:               out,
+		registry:          registry,
+		tempDir:           tempDir,
+		remoteOpts:        remoteOpts,
+		deduplicate:       deduplicate,
+		recompress:        recompress,
+		zstdLayers:        map[v1.Hash]v1.Layer{},
+		canonicalLayers:   map[layerKey]canonicalLayer{},
+		duplicateLayers:   map[v1.Hash]int64{},
+		uploadedLayers:    map[v1.Hash]name.Repository{},
+		replacedManifests: map[string]map[digest.Digest]struct{}{},
+		keptManifests:     map[string]map[digest.Digest]struct{}{},
+	}
+}
+
+// optimize rewrites the images of all repositories in sorted order, so that the same layers are
+// chosen as canonical layers every time.
+func (o *layerOptimizer) optimize(ctx context.Context) error {
+	repos, err := remote.Catalog(ctx, o.registry, o.remoteOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to list repositories: %w", err)
+	}
+	sort.Strings(repos)
+
+	for _, repoName := range repos {
+		repo := o.registry.Repo(repoName)
+		tags, err := remote.List(repo, o.remoteOpts...)
+		if err != nil {
+			return fmt.Errorf("failed to list tags of repository %s: %w", repoName, err)
+		}
+		sort.Strings(tags)
+
+		for _, tag := range tags {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := o.optimizeTag(repo, tag, tags); err != nil {
+				return fmt.Errorf("failed to optimize %s:%s: %w", repoName, tag, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// manifestsToDelete returns the manifests that have been replaced by rewritten manifests and are no
+// longer referenced by any tag, by repository.
+func (o *layerOptimizer) manifestsToDelete() map[string][]digest.Digest {
+	toDelete := make(map[string][]digest.Digest, len(o.replacedManifests))
+	for repo, replaced := range o.replacedManifests {
+		for dgst := range replaced {
+			if _, kept := o.keptManifests[repo][dgst]; !kept {
+				toDelete[repo] = append(toDelete[repo], dgst)
+			}
+		}
+	}
+	return toDelete
+}
+
+// rewrittenManifest is a manifest rewritten to reference deduplicated or recompressed layers.
+type rewrittenManifest struct {
+	raw       []byte
+	mediaType types.MediaType
+	digest    v1.Hash
+	// layers are the layers referenced by the manifest that may not exist in the repository yet.
+	layers []v1.Layer
+	// children are the rewritten manifests of an index.
+	children []*rewrittenManifest
+}
+
+func (m *rewrittenManifest) RawManifest() ([]byte, error) {
+	return m.raw, nil
+}
+
+func (m *rewrittenManifest) MediaType() (types.MediaType, error) {
+	return m.mediaType, nil
+}
+
+func (o *layerOptimizer) optimizeTag(repo name.Repository, tag string, allTags []string) error {
+	desc, err := remote.Get(repo.Tag(tag), o.remoteOpts...)
+	if err != nil {
+		return err
+	}
+
+	artifactType, err := images.ArtifactType(desc.MediaType, desc.Manifest)
+	if err != nil {
+		return err
+	}
+	// Signatures and OCI artifacts are kept exactly as they are.
+	if signatureTagRegexp.MatchString(tag) || artifactType != "" {
+		return o.keep(repo, desc.MediaType, desc.Digest, desc.Manifest)
+	}
+
+	// Signatures are bound to the digest of the manifest they sign, so rewriting signed images would
+	// invalidate their signatures.
+	signed := hasSignatureTag(allTags, desc.Digest)
+	if desc.MediaType.IsIndex() {
+		indexManifest, err := v1.ParseIndexManifest(bytes.NewReader(desc.Manifest))
+		if err != nil {
+			return err
+		}
+		for _, child := range indexManifest.Manifests {
+			signed = signed || hasSignatureTag(allTags, child.Digest)
+		}
+	}
+	if signed {
+		if o.deduplicate || o.recompress {
+			o.out.Warnf(
+				"WARNING: not optimizing %s:%s, as rewriting it would invalidate its bundled signatures\n",
+				repo.RepositoryStr(), tag,
+			)
+		}
+		return o.keep(repo, desc.MediaType, desc.Digest, desc.Manifest)
+	}
+
+	var rewritten *rewrittenManifest
+	switch {
+	case desc.MediaType.IsIndex():
+		rewritten, err = o.rewriteIndex(repo, desc.Manifest, desc.MediaType)
+	case desc.MediaType.IsImage():
+		rewritten, err = o.rewriteImage(repo, desc.Digest, desc.Manifest, desc.MediaType)
+	}
+	if err != nil {
+		return err
+	}
+	if rewritten == nil {
+		return o.keep(repo, desc.MediaType, desc.Digest, desc.Manifest)
+	}
+
+	if err := o.write(repo, rewritten); err != nil {
+		return err
+	}
+	if err := remote.Put(repo.Tag(tag), rewritten, o.remoteOpts...); err != nil {
+		return err
+	}
+
+	o.rewrittenImages++
+	if err := o.keep(repo, rewritten.mediaType, rewritten.digest, rewritten.raw); err != nil {
+		return err
+	}
+	return o.replace(repo, desc.MediaType, desc.Digest, desc.Manifest)
+}
+
+func hasSignatureTag(tags []string, dgst v1.Hash) bool {
+	prefix := dgst.Algorithm + "-" + dgst.Hex
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// keep records the manifest and the manifests of an index as referenced by a tag.
+func (o *layerOptimizer) keep(
+	repo name.Repository, mediaType types.MediaType, dgst v1.Hash, raw []byte,
+) error {
+	return addManifestAndChildren(o.keptManifests, repo, mediaType, dgst, raw)
+}
+
+// replace records the manifest and the manifests of an index as replaced by a rewritten manifest.
+func (o *layerOptimizer) replace(
+	repo name.Repository, mediaType types.MediaType, dgst v1.Hash, raw []byte,
+) error {
+	return addManifestAndChildren(o.replacedManifests, repo, mediaType, dgst, raw)
+}
+
+func addManifestAndChildren(
+	manifests map[string]map[digest.Digest]struct{},
+	repo name.Repository, mediaType types.MediaType, dgst v1.Hash, raw []byte,
+) error {
+	repoManifests, ok := manifests[repo.RepositoryStr()]
+	if !ok {
+		repoManifests = map[digest.Digest]struct{}{}
+		manifests[repo.RepositoryStr()] = repoManifests
+	}
+	repoManifests[digest.Digest(dgst.String())] = struct{}{}
+	if !mediaType.IsIndex() {
+		return nil
+	}
+	indexManifest, err := v1.ParseIndexManifest(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	for _, child := range indexManifest.Manifests {
+		repoManifests[digest.Digest(child.Digest.String())] = struct{}{}
+	}
+	return nil
+}
+
+// write writes the layers and manifests of an index referenced by the rewritten manifest.
+func (o *layerOptimizer) write(repo name.Repository, m *rewrittenManifest) error {
+	for _, child := range m.children {
+		if err := o.write(repo, child); err != nil {
+			return err
+		}
+		if err := remote.Put(repo.Digest(child.digest.String()), child, o.remoteOpts...); err != nil {
+			return err
+		}
+	}
+	for _, l := range m.layers {
+		dgst, err := l.Digest()
+		if err != nil {
+			return err
+		}
+		if uploadedTo, ok := o.uploadedLayers[dgst]; ok && uploadedTo != repo {
+			l = &remote.MountableLayer{Layer: l, Reference: uploadedTo.Digest(dgst.String())}
+		}
+		if err := remote.WriteLayer(repo, l, o.remoteOpts...); err != nil {
+			return err
+		}
+		if _, ok := o.uploadedLayers[dgst]; !ok {
+			o.uploadedLayers[dgst] = repo
+		}
+	}
+	return nil
+}
+
+// rewriteIndex rewrites the manifests of the index, returning nil if none of them changed.
+func (o *layerOptimizer) rewriteIndex(
+	repo name.Repository, raw []byte, mediaType types.MediaType,
+) (*rewrittenManifest, error) {
+	indexManifest, err := v1.ParseIndexManifest(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		children         []*rewrittenManifest
+		changedManifests = map[int]map[string]any{}
+		convertedToOCI   = false
+	)
+	for i, child := range indexManifest.Manifests {
+		if !child.MediaType.IsImage() {
+			continue
+		}
+		desc, err := remote.Get(repo.Digest(child.Digest.String()), o.remoteOpts...)
+		if err != nil {
+			return nil, err
+		}
+		artifactType, err := images.ArtifactType(desc.MediaType, desc.Manifest)
+		if err != nil {
+			return nil, err
+		}
+		if artifactType != "" {
+			continue
+		}
+		rewritten, err := o.rewriteImage(repo, child.Digest, desc.Manifest, desc.MediaType)
+		if err != nil {
+			return nil, err
+		}
+		if rewritten == nil {
+			continue
+		}
+		children = append(children, rewritten)
+		changedManifests[i] = map[string]any{
+			"mediaType": rewritten.mediaType,
+			"digest":    rewritten.digest,
+			"size":      len(rewritten.raw),
+		}
+		convertedToOCI = convertedToOCI || rewritten.mediaType != desc.MediaType
+	}
+	if len(children) == 0 {
+		return nil, nil
+	}
+
+	topLevelChanges := map[string]any{}
+	if convertedToOCI && mediaType == types.DockerManifestList {
+		mediaType = types.OCIImageIndex
+		topLevelChanges["mediaType"] = mediaType
+	}
+	rewrittenRaw, err := rewriteManifestJSON(raw, topLevelChanges, "manifests", changedManifests)
+	if err != nil {
+		return nil, err
+	}
+	return newRewrittenManifest(rewrittenRaw, mediaType, nil, children)
+}
+
+// rewriteImage replaces the layers of the image with their recompressed or canonical layers,
+// returning nil if no layer changed. Only layers that are tar archives are replaced.
+func (o *layerOptimizer) rewriteImage(
+	repo name.Repository, dgst v1.Hash, raw []byte, mediaType types.MediaType,
+) (*rewrittenManifest, error) {
+	manifest, err := v1.ParseManifest(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	img, err := remote.Image(repo.Digest(dgst.String()), o.remoteOpts...)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	if len(layers) != len(manifest.Layers) {
+		return nil, fmt.Errorf("image %s has %d layers, expected %d", dgst, len(layers), len(manifest.Layers))
+	}
+
+	// Images with layers that are not tar archives, e.g. foreign layers, are only deduplicated, as
+	// recompressing them would require changing the media types of layers that cannot be read.
+	recompress := o.recompress
+	for _, desc := range manifest.Layers {
+		recompress = recompress && isTarLayer(desc.MediaType)
+	}
+
+	var (
+		newLayers     []v1.Layer
+		changedLayers = map[int]map[string]any{}
+	)
+	for i, desc := range manifest.Layers {
+		if !isTarLayer(desc.MediaType) {
+			continue
+		}
+		diffID, err := layers[i].DiffID()
+		if err != nil {
+			return nil, err
+		}
+
+		layer, layerDesc := layers[i], desc
+		if recompress && desc.MediaType != types.OCILayerZStd {
+			layer, err = o.zstdLayer(diffID, layers[i])
+			if err != nil {
+				return nil, err
+			}
+			if layerDesc, err = layerDescriptor(layer); err != nil {
+				return nil, err
+			}
+		}
+
+		key := layerKey{diffID: diffID, mediaType: layerDesc.MediaType}
+		canonical, ok := o.canonicalLayers[key]
+		switch {
+		case !ok:
+			o.canonicalLayers[key] = canonicalLayer{layer: layer, desc: layerDesc}
+		case canonical.desc.Digest != layerDesc.Digest:
+			o.duplicateLayers[layerDesc.Digest] = layerDesc.Size
+			if o.deduplicate {
+				layer, layerDesc = canonical.layer, canonical.desc
+			}
+		}
+
+		if layerDesc.Digest != desc.Digest {
+			newLayers = append(newLayers, layer)
+			changedLayers[i] = map[string]any{
+				"mediaType": layerDesc.MediaType,
+				"digest":    layerDesc.Digest,
+				"size":      layerDesc.Size,
+			}
+		}
+	}
+	if len(changedLayers) == 0 {
+		return nil, nil
+	}
+
+	topLevelChanges := map[string]any{}
+	if recompress && mediaType == types.DockerManifestSchema2 {
+		// zstd compressed layers are only supported by OCI manifests.
+		mediaType = types.OCIManifestSchema1
+		topLevelChanges["mediaType"] = mediaType
+		configDesc := manifest.Config
+		configDesc.MediaType = types.OCIConfigJSON
+		topLevelChanges["config"] = configDesc
+	}
+	rewrittenRaw, err := rewriteManifestJSON(raw, topLevelChanges, "layers", changedLayers)
+	if err != nil {
+		return nil, err
+	}
+	return newRewrittenManifest(rewrittenRaw, mediaType, newLayers, nil)
+}
+
+func isTarLayer(mediaType types.MediaType) bool {
+	switch mediaType {
+	case types.DockerLayer, types.DockerUncompressedLayer,
+		types.OCILayer, types.OCILayerZStd, types.OCIUncompressedLayer:
+		return true
+	default:
+		return false
+	}
+}
+
+// zstdLayer recompresses the layer with zstd into a file in the temporary directory.
+func (o *layerOptimizer) zstdLayer(diffID v1.Hash, layer v1.Layer) (v1.Layer, error) {
+	if l, ok := o.zstdLayers[diffID]; ok {
+		return l, nil
+	}
+
+	zstdLayer, err := tarball.LayerFromOpener(
+		layer.Uncompressed,
+		tarball.WithCompression(compression.ZStd),
+		tarball.WithMediaType(types.OCILayerZStd),
+	)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := zstdLayer.Compressed()
+	if err != nil {
+		return nil, fmt.Errorf("failed to recompress layer %s: %w", diffID, err)
+	}
+	defer rc.Close()
+
+	path := filepath.Join(o.tempDir, diffID.Hex+".tar.zst")
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, rc); err != nil {
+		return nil, fmt.Errorf("failed to recompress layer %s: %w", diffID, err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	l, err := tarball.LayerFromFile(path, tarball.WithMediaType(types.OCILayerZStd))
+	if err != nil {
+		return nil, err
+	}
+	o.zstdLayers[diffID] = l
+	o.recompressedLayers++
+	return l, nil
+}
+
+func layerDescriptor(layer v1.Layer) (v1.Descriptor, error) {
+	mediaType, err := layer.MediaType()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	dgst, err := layer.Digest()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	size, err := layer.Size()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	return v1.Descriptor{MediaType: mediaType, Digest: dgst, Size: size}, nil
+}
+
+// rewriteManifestJSON applies the changes to the top-level fields of the raw manifest and to the
+// fields of the descriptors in its list field, e.g. layers or manifests. All other fields,
+// including annotations and fields unknown to this version of mindthegap, are kept as they are.
+func rewriteManifestJSON(
+	raw []byte,
+	topLevelChanges map[string]any,
+	listField string,
+	descriptorChanges map[int]map[string]any,
+) ([]byte, error) {
+	var manifest map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, err
+	}
+	var descriptors []map[string]json.RawMessage
+	if err := json.Unmarshal(manifest[listField], &descriptors); err != nil {
+		return nil, err
+	}
+
+	for i, changes := range descriptorChanges {
+		for field, value := range changes {
+			b, err := marshalJSON(value)
+			if err != nil {
+				return nil, err
+			}
+			descriptors[i][field] = b
+		}
+	}
+	b, err := marshalJSON(descriptors)
+	if err != nil {
+		return nil, err
+	}
+	manifest[listField] = b
+
+	for field, value := range topLevelChanges {
+		b, err := marshalJSON(value)
+		if err != nil {
+			return nil, err
+		}
+		manifest[field] = b
+	}
+	return marshalJSON(manifest)
+}
+
+// marshalJSON marshals v without escaping HTML characters, so that annotations are kept as they are.
+func marshalJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func newRewrittenManifest(
+	raw []byte, mediaType types.MediaType, layers []v1.Layer, children []*rewrittenManifest,
+) (*rewrittenManifest, error) {
+	dgst, _, err := v1.SHA256(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	return &rewrittenManifest{
+		raw:       raw,
+		mediaType: mediaType,
+		digest:    dgst,
+		layers:    layers,
+		children:  children,
+	}, nil
+}
+
+// duplicates returns the number and total size of the layers with identical contents as other
+// layers that are stored under different digests.
+func (o *layerOptimizer) duplicates() (int, int64) {
+	var size int64
+	for _, s := range o.duplicateLayers {
+		size += s
+	}
+	return len(o.duplicateLayers), size
+}
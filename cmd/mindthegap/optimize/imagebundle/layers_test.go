@@ -0,0 +1,167 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagebundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/docker/registry"
+)
+
+// gzipLayer returns a layer with the same uncompressed contents for every compression level.
+func gzipLayer(t *testing.T, level int) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	contents := strings.Repeat("mindthegap ", 10000)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "file", Mode: 0o644, Size: int64(len(contents))}))
+	_, err := tw.Write([]byte(contents))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	layer, err := tarball.LayerFromOpener(
+		func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(buf.Bytes())), nil },
+		tarball.WithCompressionLevel(level),
+	)
+	require.NoError(t, err)
+	return layer
+}
+
+func startRegistry(t *testing.T, dir string) name.Registry {
+	t.Helper()
+	reg, err := registry.NewRegistry(registry.Config{StorageDirectory: dir})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+	regName, err := name.NewRegistry(reg.Address(), name.Insecure)
+	require.NoError(t, err)
+	return regName
+}
+
+func TestLayerOptimizerDeduplicatesLayers(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	regName := startRegistry(t, dir)
+
+	fastLayer, bestLayer := gzipLayer(t, 1), gzipLayer(t, 9)
+	fastDigest, err := fastLayer.Digest()
+	require.NoError(t, err)
+	bestDigest, err := bestLayer.Digest()
+	require.NoError(t, err)
+	require.NotEqual(t, fastDigest, bestDigest)
+
+	imgA, err := mutate.AppendLayers(empty.Image, fastLayer)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(regName.Repo("a").Tag("v1"), imgA))
+	imgB, err := mutate.AppendLayers(empty.Image, bestLayer)
+	require.NoError(t, err)
+	idxB := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+		Add:        imgB,
+		Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+	})
+	require.NoError(t, remote.WriteIndex(regName.Repo("b").Tag("v1"), idxB))
+	idxBDigest, err := idxB.Digest()
+	require.NoError(t, err)
+
+	findOnly := newLayerOptimizer(output.NewDiscardingOutput(), regName, t.TempDir(), false, false)
+	require.NoError(t, findOnly.optimize(context.Background()))
+	count, size := findOnly.duplicates()
+	assert.Equal(t, 1, count)
+	bestSize, err := bestLayer.Size()
+	require.NoError(t, err)
+	assert.Equal(t, bestSize, size)
+	assert.Zero(t, findOnly.rewrittenImages)
+	assert.Empty(t, findOnly.manifestsToDelete())
+
+	optimizer := newLayerOptimizer(output.NewDiscardingOutput(), regName, t.TempDir(), true, false)
+	require.NoError(t, optimizer.optimize(context.Background()))
+	assert.Equal(t, 1, optimizer.rewrittenImages)
+
+	rewrittenIdx, err := remote.Index(regName.Repo("b").Tag("v1"))
+	require.NoError(t, err)
+	rewrittenIdxDigest, err := rewrittenIdx.Digest()
+	require.NoError(t, err)
+	assert.NotEqual(t, idxBDigest, rewrittenIdxDigest)
+	rewrittenIdxManifest, err := rewrittenIdx.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, rewrittenIdxManifest.Manifests, 1)
+	assert.Equal(t, "amd64", rewrittenIdxManifest.Manifests[0].Platform.Architecture)
+	rewrittenImg, err := rewrittenIdx.Image(rewrittenIdxManifest.Manifests[0].Digest)
+	require.NoError(t, err)
+	rewrittenLayers, err := rewrittenImg.Layers()
+	require.NoError(t, err)
+	require.Len(t, rewrittenLayers, 1)
+	rewrittenLayerDigest, err := rewrittenLayers[0].Digest()
+	require.NoError(t, err)
+	assert.Equal(t, fastDigest, rewrittenLayerDigest)
+
+	toDelete := optimizer.manifestsToDelete()
+	assert.Len(t, toDelete["b"], 2, "the replaced index and image manifests should be deleted")
+
+	usageBefore, err := registry.Usage(dir)
+	require.NoError(t, err)
+	require.NoError(t, registry.GarbageCollect(context.Background(), dir, toDelete))
+	usageAfter, err := registry.Usage(dir)
+	require.NoError(t, err)
+	assert.Less(t, usageAfter.Bytes, usageBefore.Bytes)
+}
+
+func TestLayerOptimizerRecompressesLayersWithZstd(t *testing.T) {
+	t.Parallel()
+	regName := startRegistry(t, t.TempDir())
+
+	img, err := mutate.AppendLayers(
+		mutate.MediaType(empty.Image, types.DockerManifestSchema2), gzipLayer(t, 1),
+	)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(regName.Repo("a").Tag("v1"), img))
+
+	optimizer := newLayerOptimizer(output.NewDiscardingOutput(), regName, t.TempDir(), false, true)
+	require.NoError(t, optimizer.optimize(context.Background()))
+	assert.Equal(t, 1, optimizer.rewrittenImages)
+	assert.Equal(t, 1, optimizer.recompressedLayers)
+
+	rewritten, err := remote.Image(regName.Repo("a").Tag("v1"))
+	require.NoError(t, err)
+	manifest, err := rewritten.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, types.OCIManifestSchema1, manifest.MediaType)
+	assert.Equal(t, types.OCIConfigJSON, manifest.Config.MediaType)
+	require.Len(t, manifest.Layers, 1)
+	assert.Equal(t, types.OCILayerZStd, manifest.Layers[0].MediaType)
+
+	// The recompressed layer has the same contents.
+	originalDiffIDs, err := img.ConfigFile()
+	require.NoError(t, err)
+	rewrittenDiffIDs, err := rewritten.ConfigFile()
+	require.NoError(t, err)
+	assert.Equal(t, originalDiffIDs.RootFS.DiffIDs, rewrittenDiffIDs.RootFS.DiffIDs)
+	layers, err := rewritten.Layers()
+	require.NoError(t, err)
+	rc, err := layers[0].Uncompressed()
+	require.NoError(t, err)
+	defer rc.Close()
+	diffID, _, err := v1.SHA256(rc)
+	require.NoError(t, err)
+	assert.Equal(t, originalDiffIDs.RootFS.DiffIDs[0], diffID)
+}
@@ -0,0 +1,22 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package optimize
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/optimize/imagebundle"
+)
+
+func NewCommand(out output.Output) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "optimize",
+		Short: "Reduce the size of bundles",
+	}
+
+	cmd.AddCommand(imagebundle.NewCommand(out))
+	return cmd
+}
@@ -0,0 +1,191 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package progress
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/pflag"
+	"github.com/thediveo/enumflag/v2"
+)
+
+type Mode enumflag.Flag
+
+const (
+	Human Mode = iota
+	JSON
+)
+
+var modes = map[Mode][]string{
+	Human: {"human"},
+	JSON:  {"json"},
+}
+
+// AddFlag adds the --progress flag to the specified flag set.
+func AddFlag(fs *pflag.FlagSet, mode *Mode) {
+	fs.Var(
+		enumflag.New(mode, "string", modes, enumflag.EnumCaseSensitive),
+		"progress",
+		`how to report progress: one of "human" or "json" (line-delimited JSON events written to stdout)`,
+	)
+}
+
+type EventType string
+
+const (
+	ImageStarted   EventType = "image-started"
+	BytesCopied    EventType = "bytes-copied"
+	ImageCompleted EventType = "image-completed"
+	ImageSkipped   EventType = "image-skipped"
+	ImageFailed    EventType = "image-failed"
+	// RegistryListening and RegistryReady report the address of a registry started by mindthegap,
+	// e.g. for wrappers to consume the address chosen from --listen-port-range.
+	RegistryListening EventType = "registry-listening"
+	RegistryReady     EventType = "registry-ready"
+)
+
+// Event is a single progress event, written as one line of JSON.
+type Event struct {
+	Time        time.Time `json:"time"`
+	Type        EventType `json:"type"`
+	Image       string    `json:"image,omitempty"`
+	Address     string    `json:"address,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	Complete    int64     `json:"complete,omitempty"`
+	Total       int64     `json:"total,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Reporter reports progress of copying images from a source to a destination, and the addresses of
+// registries started to do so.
+type Reporter interface {
+	ImageStarted(image, destination string)
+	BytesCopied(image, destination string, complete, total int64)
+	ImageCompleted(image, destination string)
+	ImageSkipped(image, destination string)
+	ImageFailed(image, destination string, err error)
+	RegistryListening(address string)
+	RegistryReady(address string)
+}
+
+// NewReporter returns a reporter for the specified mode. Human progress is already reported via
+// the output spinner and progress gauges, so the returned reporter discards all events in that mode.
+func NewReporter(mode Mode, w io.Writer) Reporter {
+	if mode == JSON {
+		return &jsonReporter{enc: json.NewEncoder(w), now: time.Now}
+	}
+	return noopReporter{}
+}
+
+type noopReporter struct{}
+
+func (noopReporter) ImageStarted(string, string)              {}
+func (noopReporter) BytesCopied(string, string, int64, int64) {}
+func (noopReporter) ImageCompleted(string, string)            {}
+func (noopReporter) ImageSkipped(string, string)              {}
+func (noopReporter) ImageFailed(string, string, error)        {}
+func (noopReporter) RegistryListening(string)                 {}
+func (noopReporter) RegistryReady(string)                     {}
+
+type jsonReporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	now func() time.Time
+}
+
+func (r *jsonReporter) emit(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e.Time = r.now().UTC()
+	// Progress reporting is best effort and must never fail the operation being reported on.
+	_ = r.enc.Encode(e) //nolint:errchkjson // Event only contains safe types.
+}
+
+func (r *jsonReporter) ImageStarted(image, destination string) {
+	r.emit(Event{Type: ImageStarted, Image: image, Destination: destination})
+}
+
+func (r *jsonReporter) BytesCopied(image, destination string, complete, total int64) {
+	r.emit(Event{
+		Type:        BytesCopied,
+		Image:       image,
+		Destination: destination,
+		Complete:    complete,
+		Total:       total,
+	})
+}
+
+func (r *jsonReporter) ImageCompleted(image, destination string) {
+	r.emit(Event{Type: ImageCompleted, Image: image, Destination: destination})
+}
+
+func (r *jsonReporter) ImageSkipped(image, destination string) {
+	r.emit(Event{Type: ImageSkipped, Image: image, Destination: destination})
+}
+
+func (r *jsonReporter) ImageFailed(image, destination string, err error) {
+	e := Event{Type: ImageFailed, Image: image, Destination: destination}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	r.emit(e)
+}
+
+func (r *jsonReporter) RegistryListening(address string) {
+	r.emit(Event{Type: RegistryListening, Address: address})
+}
+
+func (r *jsonReporter) RegistryReady(address string) {
+	r.emit(Event{Type: RegistryReady, Address: address})
+}
+
+// bytesCopiedInterval limits how often bytes-copied events are emitted for a single image.
+const bytesCopiedInterval = 500 * time.Millisecond
+
+// RemoteOptions returns remote options that report bytes copied while writing image to
+// destination. The returned wait func blocks until all updates have been reported and must be
+// called after the remote write has returned. No options are returned for the no-op reporter so
+// that human output is unaffected.
+func RemoteOptions(r Reporter, image, destination string) (opts []remote.Option, wait func()) {
+	if _, ok := r.(noopReporter); ok {
+		return nil, func() {}
+	}
+
+	// The remote write closes the updates channel once it returns.
+	updates := make(chan v1.Update, 100)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reportUpdates(r, image, destination, updates)
+	}()
+
+	return []remote.Option{remote.WithProgress(updates)}, func() { <-done }
+}
+
+func reportUpdates(r Reporter, image, destination string, updates <-chan v1.Update) {
+	var (
+		last, reported v1.Update
+		reportedAt     time.Time
+	)
+	for u := range updates {
+		if u.Error != nil {
+			continue
+		}
+		last = u
+		if time.Since(reportedAt) >= bytesCopiedInterval {
+			r.BytesCopied(image, destination, u.Complete, u.Total)
+			reported, reportedAt = u, time.Now()
+		}
+	}
+	// Always report the final state so that consumers see the total bytes copied.
+	if last != reported {
+		r.BytesCopied(image, destination, last.Complete, last.Total)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package progress
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONReporter(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	r := NewReporter(JSON, &buf)
+	r.(*jsonReporter).now = func() time.Time {
+		return time.Date(2023, 11, 8, 10, 15, 4, 0, time.UTC)
+	}
+
+	r.ImageStarted("docker.io/library/nginx:1.21.5", "localhost:5000/library/nginx:1.21.5")
+	r.BytesCopied("docker.io/library/nginx:1.21.5", "localhost:5000/library/nginx:1.21.5", 10, 100)
+	r.ImageCompleted("docker.io/library/nginx:1.21.5", "localhost:5000/library/nginx:1.21.5")
+	r.ImageSkipped("docker.io/library/nginx:1.21.6", "localhost:5000/library/nginx:1.21.6")
+	r.ImageFailed("docker.io/library/nginx:1.21.7", "localhost:5000/library/nginx:1.21.7", errors.New("boom"))
+	r.RegistryListening("0.0.0.0:5000")
+	r.RegistryReady("0.0.0.0:5000")
+
+	assert.Equal(
+		t,
+		`{"time":"2023-11-08T10:15:04Z","type":"image-started","image":"docker.io/library/nginx:1.21.5","destination":"localhost:5000/library/nginx:1.21.5"}
+{"time":"2023-11-08T10:15:04Z","type":"bytes-copied","image":"docker.io/library/nginx:1.21.5","destination":"localhost:5000/library/nginx:1.21.5","complete":10,"total":100}
+{"time":"2023-11-08T10:15:04Z","type":"image-completed","image":"docker.io/library/nginx:1.21.5","destination":"localhost:5000/library/nginx:1.21.5"}
+{"time":"2023-11-08T10:15:04Z","type":"image-skipped","image":"docker.io/library/nginx:1.21.6","destination":"localhost:5000/library/nginx:1.21.6"}
+{"time":"2023-11-08T10:15:04Z","type":"image-failed","image":"docker.io/library/nginx:1.21.7","destination":"localhost:5000/library/nginx:1.21.7","error":"boom"}
+{"time":"2023-11-08T10:15:04Z","type":"registry-listening","address":"0.0.0.0:5000"}
+{"time":"2023-11-08T10:15:04Z","type":"registry-ready","address":"0.0.0.0:5000"}
+`,
+		buf.String(),
+	)
+}
+
+func TestRemoteOptionsHumanMode(t *testing.T) {
+	t.Parallel()
+
+	opts, wait := RemoteOptions(NewReporter(Human, &bytes.Buffer{}), "src", "dest")
+	assert.Empty(t, opts)
+	wait()
+}
+
+type recordingReporter struct {
+	noopReporter
+	copied []v1.Update
+}
+
+func (r *recordingReporter) BytesCopied(_, _ string, complete, total int64) {
+	r.copied = append(r.copied, v1.Update{Complete: complete, Total: total})
+}
+
+func TestReportUpdatesThrottlesAndReportsFinalState(t *testing.T) {
+	t.Parallel()
+
+	updates := make(chan v1.Update, 4)
+	updates <- v1.Update{Complete: 10, Total: 100}
+	updates <- v1.Update{Complete: 50, Total: 100}
+	updates <- v1.Update{Error: errors.New("ignored")}
+	updates <- v1.Update{Complete: 100, Total: 100}
+	close(updates)
+
+	r := &recordingReporter{}
+	reportUpdates(r, "src", "dest", updates)
+
+	require.Equal(
+		t,
+		[]v1.Update{{Complete: 10, Total: 100}, {Complete: 100, Total: 100}},
+		r.copied,
+	)
+}
@@ -11,11 +11,13 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/containers/image/v5/types"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/logs"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"github.com/spf13/cobra"
@@ -24,14 +26,24 @@ import (
 
 	"github.com/mesosphere/dkp-cli-runtime/core/output"
 
+	"github.com/mesosphere/mindthegap/archive"
 	"github.com/mesosphere/mindthegap/cleanup"
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/progress"
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
 	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/docker/acr"
 	"github.com/mesosphere/mindthegap/docker/ecr"
+	"github.com/mesosphere/mindthegap/docker/gcp"
+	"github.com/mesosphere/mindthegap/docker/quay"
 	"github.com/mesosphere/mindthegap/docker/registry"
+	"github.com/mesosphere/mindthegap/images"
 	"github.com/mesosphere/mindthegap/images/authnhelpers"
 	"github.com/mesosphere/mindthegap/images/httputils"
+	"github.com/mesosphere/mindthegap/metrics"
+	"github.com/mesosphere/mindthegap/notation"
+	"github.com/mesosphere/mindthegap/signing"
+	"github.com/mesosphere/mindthegap/warnings"
 )
 
 type onExistingTagMode enumflag.Flag
@@ -59,6 +71,25 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 		ecrLifecyclePolicy            string
 		onExistingTag                 = Overwrite
 		imagePushConcurrency          int
+		stagingTagSuffix              string
+		promote                       bool
+		progressMode                  progress.Mode
+		quayAPIToken                  string
+		quayRepositoryVisibility      string
+		quayTagExpiresAfter           string
+		destRepositoryPrefix          string
+		repoRewriteRulesFile          string
+		verifySignatures              bool
+		trustPolicyFile               string
+		trustStoreDir                 string
+		registryAuthFile              string
+		credentialOpts                authnhelpers.CredentialOptions
+		clockSkewTolerance            time.Duration
+		imageFilter                   config.ImageFilter
+		bundleVerifyOpts              signing.VerifyOptions
+		remoteBundleOpts              utils.RemoteBundleOptions
+		includeNonDistributable       bool
+		blobInfoCacheDir              string
 	)
 
 	cmd := &cobra.Command{
@@ -73,9 +104,57 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 				return err
 			}
 
+			if err := imageFilter.Validate(); err != nil {
+				return err
+			}
+
+			if err := bundleVerifyOpts.Validate(); err != nil {
+				return err
+			}
+
+			if err := remoteBundleOpts.Validate(); err != nil {
+				return err
+			}
+
+			if promote && stagingTagSuffix == "" {
+				return fmt.Errorf("--promote requires --tag-suffix-while-pushing to be specified")
+			}
+			if stagingTagSuffix != "" && !stagingTagSuffixRegexp.MatchString(stagingTagSuffix) {
+				return fmt.Errorf(
+					"invalid --tag-suffix-while-pushing %q: must only contain alphanumerics, '.', '_' or '-'",
+					stagingTagSuffix,
+				)
+			}
+
+			if !verifySignatures && trustPolicyFile != "" {
+				return fmt.Errorf("--notation-trust-policy requires --verify-notation-signatures to be specified")
+			}
+
+			if quayRepositoryVisibility != "" {
+				if quayAPIToken == "" {
+					return fmt.Errorf("--quay-repository-visibility requires --quay-api-token to be specified")
+				}
+				switch quay.Visibility(quayRepositoryVisibility) {
+				case quay.Public, quay.Private:
+				default:
+					return fmt.Errorf(
+						`invalid --quay-repository-visibility %q: must be one of "public" or "private"`,
+						quayRepositoryVisibility,
+					)
+				}
+			}
+			if quayTagExpiresAfter != "" {
+				if quayAPIToken == "" {
+					return fmt.Errorf("--quay-tag-expires-after requires --quay-api-token to be specified")
+				}
+				if _, err := quay.ParseExpiresAfter(quayTagExpiresAfter); err != nil {
+					return err
+				}
+			}
+
 			return nil
 		},
-		RunE: func(cmd *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			cleaner := cleanup.NewCleaner()
 			defer cleaner.Cleanup()
 
@@ -88,15 +167,45 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 			cleaner.AddCleanupFn(func() { _ = os.RemoveAll(tempDir) })
 			out.EndOperationWithStatus(output.Success())
 
+			bundleFiles, err = utils.DownloadRemoteBundles(
+				cmd.Context(), out, remoteBundleOpts, !bundleVerifyOpts.IsEmpty(), cleaner, bundleFiles...,
+			)
+			if err != nil {
+				return err
+			}
 			bundleFiles, err = utils.FilesWithGlobs(bundleFiles)
 			if err != nil {
 				return err
 			}
+			if err := utils.VerifyBundleSignatures(
+				cmd.Context(), out, bundleVerifyOpts, bundleFiles...,
+			); err != nil {
+				return err
+			}
+			recorder := metrics.FromContext(cmd.Context())
+			for _, f := range bundleFiles {
+				if size, err := archive.Size(f); err == nil {
+					recorder.AddSize("bundles", size)
+				}
+			}
+
+			endExtractPhase := recorder.StartPhase("extract")
 			imagesCfg, chartsCfg, err := utils.ExtractBundles(tempDir, out, bundleFiles...)
+			endExtractPhase()
 			if err != nil {
 				return err
 			}
 
+			if imagesCfg != nil && !imageFilter.IsEmpty() {
+				filteredImagesCfg, _ := imagesCfg.Filter(imageFilter)
+				out.Infof(
+					"Pushing %d of %d bundled images",
+					filteredImagesCfg.TotalImages(),
+					imagesCfg.TotalImages(),
+				)
+				imagesCfg = &filteredImagesCfg
+			}
+
 			out.StartOperation("Starting temporary Docker registry")
 			reg, err := registry.NewRegistry(
 				registry.Config{StorageDirectory: tempDir, ReadOnly: true},
@@ -105,10 +214,18 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 				out.EndOperationWithStatus(output.Failure())
 				return fmt.Errorf("failed to create local Docker registry: %w", err)
 			}
-			go func() {
-				if err := reg.ListenAndServe(); err != nil {
-					out.Error(err, "error serving Docker registry")
-					os.Exit(2)
+			regCtx, stopReg := context.WithCancel(cmd.Context())
+			regErrCh, err := reg.Start(regCtx)
+			if err != nil {
+				stopReg()
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to start local Docker registry: %w", err)
+			}
+			// Wait for the registry to stop before its storage is cleaned up.
+			defer func() {
+				stopReg()
+				for regErr := range regErrCh {
+					err = errors.Join(err, regErr)
 				}
 			}()
 			out.EndOperationWithStatus(output.Success())
@@ -116,7 +233,7 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 			logs.Debug.SetOutput(out.V(4).InfoWriter())
 			logs.Warn.SetOutput(out.V(2).InfoWriter())
 
-			sourceTLSRoundTripper, err := httputils.InsecureTLSRoundTripper(remote.DefaultTransport)
+			sourceTLSRoundTripper, err := httputils.LocalRegistryRoundTripper(remote.DefaultTransport)
 			if err != nil {
 				out.Error(err, "error configuring TLS for source registry")
 				os.Exit(2)
@@ -124,6 +241,7 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 			sourceRemoteOpts := []remote.Option{
 				remote.WithTransport(sourceTLSRoundTripper),
 				remote.WithUserAgent(utils.Useragent()),
+				remote.WithContext(cmd.Context()),
 			}
 
 			destTLSRoundTripper, err := httputils.TLSConfiguredRoundTripper(
@@ -131,6 +249,7 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 				destRegistryURI.Host(),
 				flags.SkipTLSVerify(destRegistrySkipTLSVerify, &destRegistryURI),
 				destRegistryCACertificateFile,
+				clockSkewTolerance,
 			)
 			if err != nil {
 				out.Error(err, "error configuring TLS for destination registry")
@@ -139,6 +258,10 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 			destRemoteOpts := []remote.Option{
 				remote.WithTransport(destTLSRoundTripper),
 				remote.WithUserAgent(utils.Useragent()),
+				remote.WithContext(cmd.Context()),
+			}
+			if includeNonDistributable {
+				destRemoteOpts = append(destRemoteOpts, remote.WithNondistributable)
 			}
 
 			var destNameOpts []name.Option
@@ -147,7 +270,10 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 			}
 
 			// Determine type of destination registry.
-			var prePushFuncs []prePushFunc
+			var (
+				prePushFuncs  []prePushFunc
+				postPushFuncs []postPushFunc
+			)
 			if ecr.IsECRRegistry(destRegistryURI.Host()) {
 				ecrClient, err := ecr.ClientForRegistry(destRegistryURI.Host())
 				if err != nil {
@@ -176,7 +302,94 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 				}
 			}
 
-			keychain := authn.DefaultKeychain
+			// If a password hasn't been specified for Google Artifact Registry/GCR or ACR, then try to retrieve a token
+			// from the default cloud credentials unless already configured in the Docker config file.
+			var destRegistryAuthConfigured bool
+			if destRegistryPassword == "" {
+				destRegistryAuthConfigured, err = authnhelpers.HasRegistryCredentials(
+					registryAuthFile, destRegistryURI.Host(),
+				)
+				if err != nil {
+					return err
+				}
+			}
+			if destRegistryPassword == "" && !destRegistryAuthConfigured {
+				switch {
+				case gcp.IsGoogleRegistry(destRegistryURI.Host()):
+					out.StartOperation("Retrieving Google credentials")
+					ts, err := gcp.TokenSource(cmd.Context())
+					if err == nil {
+						destRegistryUsername, destRegistryPassword, err = gcp.RetrieveUsernameAndToken(ts)
+					}
+					if err != nil {
+						out.EndOperationWithStatus(output.Failure())
+						return fmt.Errorf(
+							"failed to retrieve Google credentials: %w\n\n"+
+								"Please ensure you have authenticated to Google Cloud (e.g. with "+
+								"`gcloud auth application-default login`) and try again",
+							err,
+						)
+					}
+					out.EndOperationWithStatus(output.Success())
+				case acr.IsACRRegistry(destRegistryURI.Host()):
+					out.StartOperation("Retrieving ACR credentials")
+					cred, err := acr.DefaultCredential()
+					if err == nil {
+						destRegistryUsername, destRegistryPassword, err = acr.RetrieveUsernameAndToken(
+							cmd.Context(), cred, destRegistryURI.Host(), destTLSRoundTripper,
+						)
+					}
+					if err != nil {
+						out.EndOperationWithStatus(output.Failure())
+						return fmt.Errorf(
+							"failed to retrieve ACR credentials: %w\n\n"+
+								"Please ensure you have authenticated to Azure (e.g. with `az login`) and try again",
+							err,
+						)
+					}
+					out.EndOperationWithStatus(output.Success())
+				}
+			}
+
+			// Quay on quay.io can be detected from its address, self-hosted Quay is assumed if an API token is
+			// specified.
+			if quay.IsQuayRegistry(destRegistryURI.Host()) || quayAPIToken != "" {
+				var quayClient *quay.Client
+				if quayAPIToken != "" {
+					quayScheme := "https"
+					if destRegistryURI.Scheme() == "http" {
+						quayScheme = "http"
+					}
+					quayClient = quay.NewClient(
+						quayScheme+"://"+destRegistryURI.Host(),
+						quayAPIToken,
+						destTLSRoundTripper,
+					)
+				}
+
+				prePushFuncs = append(
+					prePushFuncs,
+					quay.EnsureRepositoryFunc(quayClient, quay.Visibility(quayRepositoryVisibility)),
+				)
+
+				if quayTagExpiresAfter != "" {
+					// Already validated in PreRunE.
+					expiresAfter, _ := quay.ParseExpiresAfter(quayTagExpiresAfter)
+					postPushFuncs = append(
+						postPushFuncs,
+						quay.SetTagExpirationFunc(quayClient, expiresAfter),
+					)
+				}
+			}
+
+			keychain, err := authnhelpers.NewKeychain(registryAuthFile)
+			if err != nil {
+				return err
+			}
+			keychain, err = credentialOpts.Keychain(keychain)
+			if err != nil {
+				return err
+			}
 			if destRegistryUsername != "" && destRegistryPassword != "" {
 				keychain = authn.NewMultiKeychain(
 					authn.NewKeychainFromHelper(
@@ -209,21 +422,92 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 			}
 
 			if imagesCfg != nil {
-				err := pushImages(
+				rewriter := repositoryRewriter{prefix: destRepositoryPrefix}
+				if repoRewriteRulesFile != "" {
+					out.StartOperation("Parsing repository rewrite rules")
+					rewriter.rules, err = config.ParseRepoRewriteRulesFile(repoRewriteRulesFile)
+					if err != nil {
+						out.EndOperationWithStatus(output.Failure())
+						return err
+					}
+					out.EndOperationWithStatus(output.Success())
+				} else {
+					rewriter.rewrites, err = utils.ReadRepoRewrites(tempDir)
+					if err != nil {
+						return err
+					}
+				}
+
+				var verifier *notation.Verifier
+				if verifySignatures {
+					out.StartOperation("Parsing Notation trust policy")
+					verifier, err = notationVerifier(tempDir, trustPolicyFile, trustStoreDir)
+					if err != nil {
+						out.EndOperationWithStatus(output.Failure())
+						return err
+					}
+					out.EndOperationWithStatus(output.Success())
+				}
+				signatureWarnings := warnings.NewCollector(false)
+
+				blobs := images.NewBlobLocations()
+				if blobInfoCacheDir != "" {
+					blobs, err = images.LoadBlobLocations(blobInfoCacheDir)
+					if err != nil {
+						return err
+					}
+				}
+
+				// Images addressing content by digests that go-containerregistry cannot read, e.g. sha512,
+				// are copied via the distribution API instead.
+				copier := &images.DistributionCopier{
+					SourceTransport:         sourceTLSRoundTripper,
+					DestTransport:           destTLSRoundTripper,
+					DestKeychain:            keychain,
+					UserAgent:               utils.Useragent(),
+					IncludeNonDistributable: includeNonDistributable,
+				}
+
+				recorder.AddCount("images", imagesCfg.TotalImages())
+				endPushPhase := recorder.StartPhase("push-images")
+				staged, err := pushImages(
+					cmd.Context(),
 					*imagesCfg,
 					srcRegistry,
 					sourceRemoteOpts,
 					destRegistry,
 					destRegistryURI.Path(),
 					destRemoteOpts,
+					rewriter,
 					onExistingTag,
+					stagingTagSuffix,
 					imagePushConcurrency,
 					out,
-					prePushFuncs...,
+					progress.NewReporter(progressMode, cmd.OutOrStdout()),
+					prePushFuncs,
+					postPushFuncs,
+					verifier,
+					signatureWarnings,
+					blobs,
+					copier,
 				)
+				endPushPhase()
+				// Blob locations of images that have been pushed before a failure are saved as well.
+				if saveErr := blobs.Save(); saveErr != nil {
+					out.Warnf("failed to save blob locations to blob info cache: %v", saveErr)
+				}
+				for _, w := range signatureWarnings.Warnings() {
+					out.Warn(w.String())
+				}
 				if err != nil {
 					return err
 				}
+
+				if promote {
+					if err := promoteStagedImages(staged, destRemoteOpts, out, postPushFuncs...); err != nil {
+						return err
+					}
+				}
 			}
 
 			chartsSrcRegistry, err := name.NewRegistry(
@@ -244,7 +528,8 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 					destRegistryURI.Path(),
 					destRemoteOpts,
 					out,
-					prePushFuncs...,
+					prePushFuncs,
+					postPushFuncs,
 				)
 				if err != nil {
 					return err
@@ -256,7 +541,9 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 	}
 
 	cmd.Flags().StringSliceVar(&bundleFiles, bundleCmdName, nil,
-		"Tarball containing list of images to push. Can also be a glob pattern.")
+		"Tarball containing list of images to push. Can also be a glob pattern, or an HTTP(S) URL to download the "+
+			"bundle from, optionally with the expected checksum of the bundle, e.g. "+
+			"https://example.com/images.tar?checksum=sha256:<hex>")
 	_ = cmd.MarkFlagRequired(bundleCmdName)
 	cmd.Flags().Var(&destRegistryURI, "to-registry", "Registry to push images to. "+
 		"TLS verification will be skipped when using an http:// registry.")
@@ -277,6 +564,18 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 		"to-registry-username",
 		"to-registry-password",
 	)
+	flags.AddRegistryAuthFileFlag(cmd.Flags(), &registryAuthFile)
+	flags.AddRegistryCredentialFlags(cmd.Flags(), &credentialOpts)
+	flags.AddBundleVerifyFlags(cmd.Flags(), &bundleVerifyOpts)
+	flags.AddRemoteBundleFlags(cmd.Flags(), &remoteBundleOpts)
+	flags.AddClockSkewToleranceFlag(cmd.Flags(), &clockSkewTolerance)
+	flags.AddImageFilterFlags(cmd.Flags(), &imageFilter)
+	cmd.Flags().BoolVar(&includeNonDistributable, "include-non-distributable", false,
+		"Push non-distributable (foreign) layers, e.g. the base layers of Windows images, which requires "+
+			"bundles created with --include-non-distributable (skipped by default)")
+	cmd.Flags().StringVar(&blobInfoCacheDir, "blob-info-cache-dir", "",
+		"Directory to record the repositories that layers have been pushed to in, so that layers shared with "+
+			"images pushed by other runs are mounted from those repositories instead of being pushed again")
 	cmd.Flags().StringVar(&ecrLifecyclePolicy, "ecr-lifecycle-policy-file", "",
 		"File containing ECR lifecycle policy for newly created repositories "+
 			"(only applies if target registry is hosted on ECR, ignored otherwise)")
@@ -288,30 +587,79 @@ func NewCommand(out output.Output, bundleCmdName string) *cobra.Command {
 	)
 	cmd.Flags().
 		IntVar(&imagePushConcurrency, "image-push-concurrency", 1, "Image push concurrency")
+	cmd.Flags().StringVar(&stagingTagSuffix, "tag-suffix-while-pushing", "",
+		"Push images under staging tags with this suffix appended (e.g. .staging) instead of their final tags")
+	cmd.Flags().BoolVar(&promote, "promote", false,
+		"Once all images have been pushed under staging tags and verified, retag them to their final tags "+
+			"(requires --tag-suffix-while-pushing, staging tags are not deleted)")
+	progress.AddFlag(cmd.Flags(), &progressMode)
+	cmd.Flags().BoolVar(&verifySignatures, "verify-notation-signatures", false,
+		"Verify Notation signatures of images before pushing them, using the Notation trust policy and "+
+			"trust store in the bundle unless --notation-trust-policy is specified")
+	flags.AddNotationTrustPolicyFlags(cmd.Flags(), &trustPolicyFile, &trustStoreDir)
+	cmd.MarkFlagsRequiredTogether("notation-trust-policy", "notation-trust-store")
+	cmd.Flags().StringVar(&destRepositoryPrefix, "to-registry-prefix", "",
+		"Repository path prefix to push images under in the destination registry, e.g. com/mirror")
+	cmd.Flags().StringVar(&repoRewriteRulesFile, "repo-rewrite-rules", "",
+		"File containing rules to rewrite source image repositories to destination repositories, "+
+			"using prefix mapping or regular expressions (defaults to the repositories recorded in the bundles "+
+			"if rules were applied when creating them)")
+	cmd.Flags().StringVar(&quayAPIToken, "quay-api-token", "",
+		"OAuth access token for the Quay API, required to manage repository visibility and tag expiration "+
+			"(also enables Quay support for self-hosted Quay registries)")
+	cmd.Flags().StringVar(&quayRepositoryVisibility, "quay-repository-visibility", "",
+		`Visibility of Quay repositories pushed to: one of "public" or "private" `+
+			"(only applies if target registry is Quay, ignored otherwise)")
+	cmd.Flags().StringVar(&quayTagExpiresAfter, "quay-tag-expires-after", "",
+		"Expire pushed tags after the specified time, in the same format as the quay.expires-after label, e.g. 2w "+
+			"(only applies if target registry is Quay, ignored otherwise)")
 
 	return cmd
 }
 
-type prePushFunc func(destRepositoryName name.Repository, imageTags ...string) error
+type (
+	prePushFunc  func(destRepositoryName name.Repository, imageTags ...string) error
+	postPushFunc func(destImage name.Tag) error
+)
+
+func runPostPushFuncs(destImage name.Tag, postPushFuncs ...postPushFunc) error {
+	for _, postPush := range postPushFuncs {
+		if err := postPush(destImage); err != nil {
+			return fmt.Errorf("post-push func failed: %w", err)
+		}
+	}
+	return nil
+}
 
 func pushImages(
+	ctx context.Context,
 	cfg config.ImagesConfig,
 	sourceRegistry name.Registry, sourceRemoteOpts []remote.Option,
 	destRegistry name.Registry, destRegistryPath string, destRemoteOpts []remote.Option,
+	rewriter repositoryRewriter,
 	onExistingTag onExistingTagMode,
+	stagingTagSuffix string,
 	imagePushConcurrency int,
 	out output.Output,
-	prePushFuncs ...prePushFunc,
-) error {
+	reporter progress.Reporter,
+	prePushFuncs []prePushFunc,
+	postPushFuncs []postPushFunc,
+	verifier *notation.Verifier,
+	signatureWarnings *warnings.Collector,
+	blobs *images.BlobLocations,
+	copier *images.DistributionCopier,
+) ([]stagedImage, error) {
 	puller, err := remote.NewPuller(destRemoteOpts...)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
+	staged := &stagedImages{}
+
 	// Sort registries for deterministic ordering.
 	regNames := cfg.SortedRegistryNames()
 
-	eg, egCtx := errgroup.WithContext(context.Background())
+	eg, egCtx := errgroup.WithContext(ctx)
 	eg.SetLimit(imagePushConcurrency)
 
 	sourceRemoteOpts = append(sourceRemoteOpts, remote.WithContext(egCtx))
@@ -335,7 +683,16 @@ func pushImages(
 			imageName := imageNames[imageIdx]
 
 			srcRepository := sourceRegistry.Repo(imageName)
-			destRepository := destRegistry.Repo(strings.TrimLeft(destRegistryPath, "/"), imageName)
+			destRepository, err := rewriter.destRepository(
+				destRegistry,
+				destRegistryPath,
+				registryName,
+				imageName,
+			)
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return nil, err
+			}
 
 			imageTags := registryConfig.Images[imageName]
 
@@ -349,52 +706,93 @@ func pushImages(
 				imageTag := imageTags[tagIdx]
 
 				eg.Go(func() error {
-					imageTagPrePushSync.Do(func() {
-						for _, prePush := range prePushFuncs {
-							if err := prePush(destRepository, imageTags...); err != nil {
-								imageTagPrePushErr = fmt.Errorf("pre-push func failed: %w", err)
-							}
-						}
+					reportedImageName := fmt.Sprintf("%s/%s:%s", registryName, imageName, imageTag)
+					srcImage := srcRepository.Tag(imageTag)
+					destImage := destRepository.Tag(imageTag)
+
+					reporter.ImageStarted(reportedImageName, destImage.Name())
 
-						existingImageTags, imageTagPrePushErr = getExistingImages(
-							context.Background(),
+					imageTagPrePushSync.Do(func() {
+						existingImageTags, imageTagPrePushErr = prepareDestRepository(
+							egCtx,
+							prePushFuncs,
 							onExistingTag,
 							puller,
 							destRepository,
+							imageTags...,
 						)
 					})
 
 					if imageTagPrePushErr != nil {
+						reporter.ImageFailed(reportedImageName, destImage.Name(), imageTagPrePushErr)
 						return imageTagPrePushErr
 					}
 
-					srcImage := srcRepository.Tag(imageTag)
-					destImage := destRepository.Tag(imageTag)
-
-					pushFn := pushTag
-
 					switch onExistingTag {
 					case Overwrite:
 						// Do nothing, just attempt to overwrite
 					case Skip:
 						// If tag exists already then do nothing.
 						if _, exists := existingImageTags[imageTag]; exists {
-							pushFn = func(_ name.Reference, _ []remote.Option, _ name.Reference, _ []remote.Option) error {
-								return nil
-							}
+							reporter.ImageSkipped(reportedImageName, destImage.Name())
+							pushGauge.Inc()
+							return nil
 						}
 					case Error:
 						if _, exists := existingImageTags[imageTag]; exists {
-							return fmt.Errorf(
+							err := fmt.Errorf(
 								"image tag already exists in destination registry",
 							)
+							reporter.ImageFailed(reportedImageName, destImage.Name(), err)
+							return err
 						}
 					}
 
-					if err := pushFn(srcImage, sourceRemoteOpts, destImage, destRemoteOpts); err != nil {
+					if err := verifyNotationSignatures(
+						verifier,
+						srcImage,
+						fmt.Sprintf("%s/%s", registryName, imageName),
+						signatureWarnings,
+						sourceRemoteOpts...,
+					); err != nil {
+						reporter.ImageFailed(reportedImageName, destImage.Name(), err)
 						return err
 					}
 
+					pushDestImage := destImage
+					if stagingTagSuffix != "" {
+						pushDestImage = destRepository.Tag(imageTag + stagingTagSuffix)
+					}
+
+					digest, err := pushTag(
+						egCtx,
+						srcImage,
+						sourceRemoteOpts,
+						pushDestImage,
+						destRemoteOpts,
+						reporter,
+						reportedImageName,
+						blobs,
+						copier,
+					)
+					if err == nil {
+						err = pushNotationSignatures(
+							srcRepository, sourceRemoteOpts, destRepository, destRemoteOpts, digest,
+						)
+					}
+					if err == nil {
+						err = runPostPushFuncs(pushDestImage, postPushFuncs...)
+					}
+					if err != nil {
+						reporter.ImageFailed(reportedImageName, destImage.Name(), err)
+						return err
+					}
+
+					if stagingTagSuffix != "" {
+						staged.add(stagedImage{staging: pushDestImage, final: destImage, digest: digest})
+					}
+
+					reporter.ImageCompleted(reportedImageName, destImage.Name())
 					pushGauge.Inc()
 
 					return nil
@@ -405,26 +803,77 @@ func pushImages(
 
 	if err := eg.Wait(); err != nil {
 		out.EndOperationWithStatus(output.Failure())
-		return err
+		return nil, err
 	}
 
 	out.EndOperationWithStatus(output.Success())
 
-	return nil
+	return staged.sorted(), nil
 }
 
 func pushTag(
-	srcImage name.Reference,
+	ctx context.Context,
+	srcImage name.Tag,
 	sourceRemoteOpts []remote.Option,
-	destImage name.Reference,
+	destImage name.Tag,
 	destRemoteOpts []remote.Option,
-) error {
-	idx, err := remote.Index(srcImage, sourceRemoteOpts...)
+	reporter progress.Reporter,
+	reportedImageName string,
+	blobs *images.BlobLocations,
+	copier *images.DistributionCopier,
+) (v1.Hash, error) {
+	desc, err := remote.Get(srcImage, sourceRemoteOpts...)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	// The bundle addresses the manifests of tags by sha256 digests, but the manifests themselves
+	// may address content by other digests, in which case the image is copied as it is bundled.
+	err = images.ValidateImageDigests(srcImage, desc, sourceRemoteOpts...)
+	if errors.Is(err, images.ErrUnsupportedDigestAlgorithm) {
+		copied, err := copier.Copy(ctx, srcImage.Context(), srcImage.TagStr(), destImage, nil, nil)
+		if err != nil {
+			return v1.Hash{}, err
+		}
+		return v1.Hash{Algorithm: copied.Algorithm().String(), Hex: copied.Encoded()}, nil
+	}
 	if err != nil {
-		return err
+		return v1.Hash{}, err
 	}
 
-	return remote.WriteIndex(destImage, idx, destRemoteOpts...)
+	progressOpts, waitForProgress := progress.RemoteOptions(
+		reporter,
+		reportedImageName,
+		destImage.Name(),
+	)
+	defer waitForProgress()
+
+	// Images are bundled as indexes, only OCI artifacts are bundled as single manifests exactly as
+	// they are stored in the source registry. Layers that have been pushed to other repositories of
+	// the destination registry before are mounted from there instead of being pushed again.
+	if desc.MediaType.IsImage() {
+		img, err := desc.Image()
+		if err != nil {
+			return v1.Hash{}, err
+		}
+		img, recordLocations := blobs.Image(img, destImage.Context())
+		if err := remote.Write(destImage, img, append(progressOpts, destRemoteOpts...)...); err != nil {
+			return v1.Hash{}, err
+		}
+		recordLocations()
+		return desc.Digest, nil
+	}
+
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	idx, recordLocations := blobs.ImageIndex(idx, destImage.Context())
+	if err := remote.WriteIndex(destImage, idx, append(progressOpts, destRemoteOpts...)...); err != nil {
+		return v1.Hash{}, err
+	}
+	recordLocations()
+	return desc.Digest, nil
 }
 
 func pushOCIArtifacts(
@@ -432,7 +881,8 @@ func pushOCIArtifacts(
 	sourceRegistry name.Registry, sourceRegistryPath string, sourceRemoteOpts []remote.Option,
 	destRegistry name.Registry, destRegistryPath string, destRemoteOpts []remote.Option,
 	out output.Output,
-	prePushFuncs ...prePushFunc,
+	prePushFuncs []prePushFunc,
+	postPushFuncs []postPushFunc,
 ) error {
 	// Sort repositories for deterministic ordering.
 	repoNames := cfg.SortedRepositoryNames()
@@ -480,6 +930,11 @@ func pushOCIArtifacts(
 					return err
 				}
 
+				if err := runPostPushFuncs(destChart, postPushFuncs...); err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return err
+				}
+
 				out.EndOperationWithStatus(output.Success())
 			}
 		}
@@ -488,6 +943,25 @@ func pushOCIArtifacts(
 	return nil
 }
 
+// prepareDestRepository runs the pre-push funcs for the destination repository, failing on the first
+// error, and then lists the tags that already exist in it.
+func prepareDestRepository(
+	ctx context.Context,
+	prePushFuncs []prePushFunc,
+	onExistingTag onExistingTagMode,
+	puller *remote.Puller,
+	repo name.Repository,
+	imageTags ...string,
+) (map[string]struct{}, error) {
+	for _, prePush := range prePushFuncs {
+		if err := prePush(repo, imageTags...); err != nil {
+			return nil, fmt.Errorf("pre-push func failed: %w", err)
+		}
+	}
+
+	return getExistingImages(ctx, onExistingTag, puller, repo)
+}
+
 func getExistingImages(
 	ctx context.Context,
 	onExistingTag onExistingTagMode,
@@ -0,0 +1,223 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/imagebundle"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/progress"
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/docker/quay"
+	mtgregistry "github.com/mesosphere/mindthegap/docker/registry"
+	"github.com/mesosphere/mindthegap/images"
+	"github.com/mesosphere/mindthegap/images/platform"
+)
+
+func TestPrepareDestRepositoryPrePushFailure(t *testing.T) {
+	t.Parallel()
+
+	quaySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(quaySrv.Close)
+	quayClient := quay.NewClient(quaySrv.URL, "token", http.DefaultTransport)
+
+	var listRequests atomic.Int32
+	regHandler := registry.New()
+	regSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/tags/list") {
+			listRequests.Add(1)
+		}
+		regHandler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(regSrv.Close)
+	repo, err := name.NewRepository(strings.TrimPrefix(regSrv.URL, "http://") + "/mesosphere/nginx")
+	require.NoError(t, err)
+	puller, err := remote.NewPuller()
+	require.NoError(t, err)
+
+	succeeded := 0
+	prePushFuncs := []prePushFunc{
+		quay.EnsureRepositoryFunc(quayClient, quay.Public),
+		func(name.Repository, ...string) error {
+			succeeded++
+			return nil
+		},
+	}
+
+	_, err = prepareDestRepository(context.Background(), prePushFuncs, Skip, puller, repo, "1.21.5")
+	require.ErrorContains(t, err, "pre-push func failed")
+	assert.Zero(t, succeeded, "pre-push funcs should not run after a failed pre-push func")
+	assert.Zero(t, listRequests.Load(), "existing tags should not be listed after a failed pre-push func")
+
+	existing, err := prepareDestRepository(context.Background(), prePushFuncs[1:], Skip, puller, repo, "1.21.5")
+	require.NoError(t, err)
+	assert.Empty(t, existing)
+	assert.Equal(t, 1, succeeded)
+	assert.EqualValues(t, 1, listRequests.Load())
+}
+
+// pushSHA512Blob pushes the content to the repository of the embedded registry as a blob
+// addressed by its sha512 digest.
+func pushSHA512Blob(t *testing.T, repoURL, mediaType string, content []byte) ocispec.Descriptor {
+	t.Helper()
+
+	resp, err := http.Post(repoURL+"/blobs/uploads/", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	d := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.SHA512.FromBytes(content),
+		Size:      int64(len(content)),
+	}
+	query := location.Query()
+	query.Set("digest", d.Digest.String())
+	location.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodPut, location.String(), bytes.NewReader(content))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	return d
+}
+
+// pushSHA512Manifest pushes the manifest to the repository of the embedded registry as reference,
+// returning its descriptor addressing it by its sha512 digest.
+func pushSHA512Manifest(t *testing.T, repoURL, reference string, manifest any) ocispec.Descriptor {
+	t.Helper()
+
+	content, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	var mediaType struct {
+		MediaType string `json:"mediaType"`
+	}
+	require.NoError(t, json.Unmarshal(content, &mediaType))
+	d := ocispec.Descriptor{
+		MediaType: mediaType.MediaType,
+		Digest:    digest.SHA512.FromBytes(content),
+		Size:      int64(len(content)),
+	}
+	if reference == "" {
+		reference = d.Digest.String()
+	}
+	req, err := http.NewRequest(http.MethodPut, repoURL+"/manifests/"+reference, bytes.NewReader(content))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", d.MediaType)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	return d
+}
+
+func TestPushTagSHA512(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	startRegistry := func(cfg mtgregistry.Config) *mtgregistry.Registry {
+		t.Helper()
+		reg, err := mtgregistry.NewRegistry(cfg)
+		require.NoError(t, err)
+		_, err = reg.Start(ctx)
+		require.NoError(t, err)
+		return reg
+	}
+
+	srcReg := startRegistry(mtgregistry.Config{StorageDirectory: t.TempDir()})
+	srcRepoURL := fmt.Sprintf("http://%s/v2/library/image", srcReg.Address())
+	var platforms []ocispec.Descriptor
+	for _, arch := range []string{"amd64", "arm64"} {
+		p := &ocispec.Platform{OS: "linux", Architecture: arch}
+		config, err := json.Marshal(ocispec.Image{Platform: *p})
+		require.NoError(t, err)
+		manifest := pushSHA512Manifest(t, srcRepoURL, "", ocispec.Manifest{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: ocispec.MediaTypeImageManifest,
+			Config:    pushSHA512Blob(t, srcRepoURL, ocispec.MediaTypeImageConfig, config),
+			Layers: []ocispec.Descriptor{
+				pushSHA512Blob(t, srcRepoURL, ocispec.MediaTypeImageLayer, []byte(arch+" layer")),
+			},
+		})
+		manifest.Platform = p
+		platforms = append(platforms, manifest)
+	}
+	pushSHA512Manifest(t, srcRepoURL, "v1", ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: platforms,
+	})
+
+	// The image is bundled like any other image, and pushed from the bundle as it is bundled.
+	bundleFile := filepath.Join(t.TempDir(), "images.tar")
+	_, err := imagebundle.Create(ctx, output.NewDiscardingOutput(), imagebundle.Options{
+		OutputFile: bundleFile,
+		ImagesConfig: &config.ImagesConfig{
+			srcReg.Address(): {
+				Images: map[string][]string{"library/image": {"v1"}},
+				Proxy:  config.DirectProxy,
+			},
+		},
+		Platforms:            []platform.Platform{platform.MustParse("linux/arm64")},
+		ImagePullConcurrency: 1,
+	})
+	require.NoError(t, err)
+	bundleDir := t.TempDir()
+	require.NoError(t, archive.UnarchiveToDirectory(bundleFile, bundleDir))
+	bundleReg := startRegistry(mtgregistry.Config{StorageDirectory: bundleDir, ReadOnly: true})
+	destReg := startRegistry(mtgregistry.Config{StorageDirectory: t.TempDir()})
+
+	srcImage, err := name.NewTag(bundleReg.Address() + "/library/image:v1")
+	require.NoError(t, err)
+	destImage, err := name.NewTag(destReg.Address() + "/library/image:v1")
+	require.NoError(t, err)
+	bundled, err := remote.Get(srcImage)
+	require.NoError(t, err)
+	pushed, err := pushTag(
+		ctx, srcImage, nil, destImage, nil, progress.NewReporter(progress.Human, io.Discard), "library/image:v1",
+		images.NewBlobLocations(), &images.DistributionCopier{},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, bundled.Digest, pushed, "the index should be pushed as it is bundled")
+
+	req, err := http.NewRequest(
+		http.MethodGet,
+		fmt.Sprintf("http://%s/v2/library/image/manifests/%s", destReg.Address(), platforms[1].Digest),
+		http.NoBody,
+	)
+	require.NoError(t, err)
+	req.Header.Set("Accept", ocispec.MediaTypeImageManifest)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "the image should be pullable by its sha512 digest")
+}
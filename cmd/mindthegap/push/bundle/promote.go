@@ -0,0 +1,106 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package bundle
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+)
+
+// stagingTagSuffixRegexp matches valid suffixes for staging tags, i.e. characters that are valid
+// in any position of an image tag.
+var stagingTagSuffixRegexp = regexp.MustCompile(`^[\w.-]+$`)
+
+// stagedImage is an image that has been pushed under a staging tag and that will be promoted to
+// its final tag once all images have been pushed successfully.
+type stagedImage struct {
+	staging name.Tag
+	final   name.Tag
+	digest  v1.Hash
+}
+
+type stagedImages struct {
+	mu     sync.Mutex
+	images []stagedImage
+}
+
+func (s *stagedImages) add(img stagedImage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.images = append(s.images, img)
+}
+
+func (s *stagedImages) sorted() []stagedImage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sorted := append([]stagedImage{}, s.images...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].final.String() < sorted[j].final.String()
+	})
+	return sorted
+}
+
+// promoteStagedImages verifies that every staged image is present in the destination registry with
+// the expected digest before retagging any of them, so that the final tags are only updated once
+// the complete set of images is known to be available. If retagging fails, the images promoted
+// before keep their final tags, and promoting again retags the remaining ones.
+//
+// Staging tags are left in place: the registry API only supports deleting manifests by digest,
+// which would delete the manifests that the final tags point at as well.
+func promoteStagedImages(
+	staged []stagedImage,
+	destRemoteOpts []remote.Option,
+	out output.Output,
+	postPushFuncs ...postPushFunc,
+) error {
+	descriptors := make([]*remote.Descriptor, 0, len(staged))
+
+	out.StartOperation("Verifying staged images")
+	for _, img := range staged {
+		desc, err := remote.Get(img.staging, destRemoteOpts...)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return fmt.Errorf("failed to verify staged image %s: %w", img.staging, err)
+		}
+		if desc.Digest != img.digest {
+			out.EndOperationWithStatus(output.Failure())
+			return fmt.Errorf(
+				"staged image %s has digest %s, expected %s",
+				img.staging,
+				desc.Digest,
+				img.digest,
+			)
+		}
+		descriptors = append(descriptors, desc)
+	}
+	out.EndOperationWithStatus(output.Success())
+
+	promoteGauge := &output.ProgressGauge{}
+	promoteGauge.SetCapacity(len(staged))
+	promoteGauge.SetStatus("Promoting staged images to final tags")
+
+	out.StartOperationWithProgress(promoteGauge)
+	for i, img := range staged {
+		if err := remote.Tag(img.final, descriptors[i], destRemoteOpts...); err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return fmt.Errorf("failed to promote %s to %s: %w", img.staging, img.final, err)
+		}
+		if err := runPostPushFuncs(img.final, postPushFuncs...); err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return err
+		}
+		promoteGauge.Inc()
+	}
+	out.EndOperationWithStatus(output.Success())
+
+	return nil
+}
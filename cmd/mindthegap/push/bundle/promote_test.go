@@ -0,0 +1,132 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package bundle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPromoteTestRegistry starts a registry that denies pushing the manifests of the specified tags,
+// e.g. as they are immutable.
+func newPromoteTestRegistry(t *testing.T, failingTags ...string) name.Registry {
+	t.Helper()
+
+	handler := registry.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, tag := range failingTags {
+			if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/manifests/"+tag) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	reg, err := name.NewRegistry(strings.TrimPrefix(srv.URL, "http://"))
+	require.NoError(t, err)
+	return reg
+}
+
+// stage pushes a random image under the staging tag of the final tag.
+func stage(t *testing.T, reg name.Registry, repository, tag string) stagedImage {
+	t.Helper()
+
+	img, err := random.Image(128, 1)
+	require.NoError(t, err)
+	repo := reg.Repo(repository)
+	staging := repo.Tag(tag + ".staging")
+	require.NoError(t, remote.Write(staging, img))
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	return stagedImage{staging: staging, final: repo.Tag(tag), digest: digest}
+}
+
+func TestPromoteStagedImages(t *testing.T) {
+	t.Parallel()
+
+	reg := newPromoteTestRegistry(t)
+	staged := []stagedImage{
+		stage(t, reg, "library/nginx", "1.21.5"),
+		stage(t, reg, "library/redis", "7.0.0"),
+	}
+
+	var promoted []string
+	require.NoError(t, promoteStagedImages(
+		staged, nil, output.NewDiscardingOutput(),
+		func(destImage name.Tag) error {
+			promoted = append(promoted, destImage.String())
+			return nil
+		},
+	))
+
+	for _, img := range staged {
+		desc, err := remote.Head(img.final)
+		require.NoError(t, err)
+		assert.Equal(t, img.digest, desc.Digest, "final tag should point at the staged manifest")
+		_, err = remote.Head(img.staging)
+		require.NoError(t, err, "staging tags should be left in place")
+	}
+	assert.Equal(t, []string{staged[0].final.String(), staged[1].final.String()}, promoted)
+}
+
+func TestPromoteStagedImagesDigestMismatch(t *testing.T) {
+	t.Parallel()
+
+	reg := newPromoteTestRegistry(t)
+	staged := []stagedImage{
+		stage(t, reg, "library/nginx", "1.21.5"),
+		stage(t, reg, "library/redis", "7.0.0"),
+	}
+	// The staging tag has been overwritten since the image was pushed.
+	overwritten := stage(t, reg, "library/redis", "7.0.0")
+
+	err := promoteStagedImages(staged, nil, output.NewDiscardingOutput())
+	require.EqualError(t, err, "staged image "+staged[1].staging.String()+" has digest "+
+		overwritten.digest.String()+", expected "+staged[1].digest.String())
+
+	for _, img := range staged {
+		_, err := remote.Head(img.final)
+		require.Error(t, err, "no final tag should be updated if any staged image fails verification")
+	}
+}
+
+func TestPromoteStagedImagesPartialFailure(t *testing.T) {
+	t.Parallel()
+
+	reg := newPromoteTestRegistry(t, "7.0.0")
+	staged := []stagedImage{
+		stage(t, reg, "library/nginx", "1.21.5"),
+		stage(t, reg, "library/redis", "7.0.0"),
+	}
+
+	var promoted []string
+	err := promoteStagedImages(
+		staged, nil, output.NewDiscardingOutput(),
+		func(destImage name.Tag) error {
+			promoted = append(promoted, destImage.String())
+			return nil
+		},
+	)
+	require.ErrorContains(t, err, "failed to promote "+staged[1].staging.String()+" to "+staged[1].final.String())
+
+	desc, err := remote.Head(staged[0].final)
+	require.NoError(t, err, "images promoted before the failure should keep their final tags")
+	assert.Equal(t, staged[0].digest, desc.Digest)
+	_, err = remote.Head(staged[1].final)
+	require.Error(t, err)
+	assert.Equal(t, []string{staged[0].final.String()}, promoted,
+		"post-push funcs should only run for promoted images")
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package bundle
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+// repositoryRewriter determines the destination repository for bundled images. Without any rules the
+// repositories recorded in the bundles when applying rules on create are used, otherwise the source
+// registry is dropped, e.g. docker.io/library/nginx is pushed to <dest>/library/nginx.
+type repositoryRewriter struct {
+	prefix   string
+	rules    config.RepoRewriteRules
+	rewrites *config.RepoRewrites
+}
+
+// destRepository returns the destination repository for imageName from srcRegistryName. The same
+// repository is used for an image's manifest list and all of the manifests it references.
+func (r repositoryRewriter) destRepository(
+	destRegistry name.Registry, destRegistryPath string,
+	srcRegistryName, imageName string,
+) (name.Repository, error) {
+	repoPath := imageName
+	if rewritten, matched := r.rules.Rewrite(srcRegistryName + "/" + imageName); matched {
+		repoPath = rewritten
+	} else if r.rewrites != nil && len(r.rules.Rules) == 0 {
+		if rewritten, found := r.rewrites.Lookup(srcRegistryName + "/" + imageName); found {
+			repoPath = rewritten
+		}
+	}
+
+	repo := destRegistry.Repo(
+		strings.TrimLeft(destRegistryPath, "/"),
+		strings.Trim(r.prefix, "/"),
+		repoPath,
+	)
+
+	// Rewritten repositories are not guaranteed to be valid, so validate them before pushing.
+	if _, err := name.NewRepository(repo.Name(), name.StrictValidation); err != nil {
+		return name.Repository{}, fmt.Errorf(
+			"invalid destination repository for %s/%s: %w",
+			srcRegistryName,
+			imageName,
+			err,
+		)
+	}
+
+	return repo, nil
+}
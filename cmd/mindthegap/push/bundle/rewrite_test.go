@@ -0,0 +1,115 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+func TestRepositoryRewriter(t *testing.T) {
+	t.Parallel()
+
+	rulesFile := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(rulesFile, []byte(`rules:
+  - prefix: docker.io/library
+    replacement: com/mirror
+  - regex: quay\.io/(.+)
+    replacement: UPPER/$1
+`), 0o600))
+	rules, err := config.ParseRepoRewriteRulesFile(rulesFile)
+	require.NoError(t, err)
+
+	bundledRewrites := &config.RepoRewrites{Rewrites: []config.RepoRewrite{{
+		Source: "docker.io/library/nginx", Destination: "bundled/nginx",
+	}}}
+
+	destRegistry, err := name.NewRegistry("registry.corp")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		rewriter         repositoryRewriter
+		destRegistryPath string
+		srcRegistry      string
+		image            string
+		want             string
+		wantErr          string
+	}{{
+		name:        "no rules",
+		srcRegistry: "docker.io",
+		image:       "library/nginx",
+		want:        "registry.corp/library/nginx",
+	}, {
+		name:             "no rules with registry path",
+		destRegistryPath: "/some/path",
+		srcRegistry:      "docker.io",
+		image:            "library/nginx",
+		want:             "registry.corp/some/path/library/nginx",
+	}, {
+		name:        "prefix only",
+		rewriter:    repositoryRewriter{prefix: "mirror/"},
+		srcRegistry: "docker.io",
+		image:       "library/nginx",
+		want:        "registry.corp/mirror/library/nginx",
+	}, {
+		name:        "matching rule",
+		rewriter:    repositoryRewriter{rules: rules},
+		srcRegistry: "docker.io",
+		image:       "library/nginx",
+		want:        "registry.corp/com/mirror/nginx",
+	}, {
+		name:        "matching rule with prefix",
+		rewriter:    repositoryRewriter{prefix: "team", rules: rules},
+		srcRegistry: "docker.io",
+		image:       "library/nginx",
+		want:        "registry.corp/team/com/mirror/nginx",
+	}, {
+		name:        "non-matching rule",
+		rewriter:    repositoryRewriter{rules: rules},
+		srcRegistry: "gcr.io",
+		image:       "google-containers/pause",
+		want:        "registry.corp/google-containers/pause",
+	}, {
+		name:        "bundled rewrites",
+		rewriter:    repositoryRewriter{rewrites: bundledRewrites},
+		srcRegistry: "docker.io",
+		image:       "library/nginx",
+		want:        "registry.corp/bundled/nginx",
+	}, {
+		name:        "rules take precedence over bundled rewrites",
+		rewriter:    repositoryRewriter{rules: rules, rewrites: bundledRewrites},
+		srcRegistry: "docker.io",
+		image:       "library/nginx",
+		want:        "registry.corp/com/mirror/nginx",
+	}, {
+		name:        "invalid rewritten repository",
+		rewriter:    repositoryRewriter{rules: rules},
+		srcRegistry: "quay.io",
+		image:       "coreos/etcd",
+		wantErr:     "invalid destination repository for quay.io/coreos/etcd",
+	}}
+	for _, tt := range tests {
+		tt := tt // Capture range variable.
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := tt.rewriter.destRepository(
+				destRegistry, tt.destRegistryPath, tt.srcRegistry, tt.image,
+			)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.Name())
+		})
+	}
+}
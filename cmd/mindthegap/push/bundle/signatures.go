@@ -0,0 +1,113 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/images"
+	"github.com/mesosphere/mindthegap/notation"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+// notationVerifier creates a verifier for the specified trust policy and trust store, defaulting to
+// the trust policy and trust store in the extracted bundles.
+func notationVerifier(bundleDir, trustPolicyFile, trustStoreDir string) (*notation.Verifier, error) {
+	if trustPolicyFile == "" {
+		trustPolicyFile = filepath.Join(bundleDir, utils.NotationTrustPolicyFile)
+		trustStoreDir = filepath.Join(bundleDir, utils.NotationTrustStoreDir)
+		if _, err := os.Stat(trustPolicyFile); errors.Is(err, fs.ErrNotExist) {
+			return nil, errors.New(
+				"bundles do not contain a Notation trust policy: specify --notation-trust-policy and " +
+					"--notation-trust-store to verify signatures",
+			)
+		}
+	}
+
+	trustPolicy, err := notation.ParseTrustPolicyFile(trustPolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	return notation.NewVerifier(trustPolicy, trustStoreDir), nil
+}
+
+// verifyNotationSignatures verifies the Notation signatures of the bundled image with the trust
+// policy applying to scope. Nothing is verified if v is nil.
+func verifyNotationSignatures(
+	v *notation.Verifier,
+	srcImage name.Tag,
+	scope string,
+	w *warnings.Collector,
+	sourceRemoteOpts ...remote.Option,
+) error {
+	if v == nil {
+		return nil
+	}
+
+	desc, err := remote.Get(srcImage, sourceRemoteOpts...)
+	if err != nil {
+		return err
+	}
+	if !desc.MediaType.IsIndex() {
+		return fmt.Errorf(
+			"cannot verify Notation signatures of OCI artifact %q: only container images are supported",
+			srcImage,
+		)
+	}
+	if err := images.ValidateImageDigests(srcImage, desc, sourceRemoteOpts...); err != nil {
+		return fmt.Errorf("cannot verify Notation signatures: %w", err)
+	}
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return err
+	}
+	return v.VerifyImage(srcImage.Context().Digest(desc.Digest.String()), scope, idx, w, sourceRemoteOpts...)
+}
+
+// pushNotationSignatures pushes the bundled Notation signatures of the pushed image index and of
+// every manifest in it. Signatures of OCI artifacts bundled as single manifests are never bundled.
+func pushNotationSignatures(
+	srcRepository name.Repository, sourceRemoteOpts []remote.Option,
+	destRepository name.Repository, destRemoteOpts []remote.Option,
+	digest v1.Hash,
+) error {
+	desc, err := remote.Get(srcRepository.Digest(digest.String()), sourceRemoteOpts...)
+	if err != nil {
+		return err
+	}
+	if !desc.MediaType.IsIndex() {
+		return nil
+	}
+	// Signatures are never bundled for images addressing content by digests other than sha256.
+	err = images.ValidateImageDigests(srcRepository.Digest(digest.String()), desc, sourceRemoteOpts...)
+	if errors.Is(err, images.ErrUnsupportedDigestAlgorithm) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return err
+	}
+	subjects, err := notation.Subjects(idx)
+	if err != nil {
+		return err
+	}
+	if _, err := notation.CopySignatures(
+		srcRepository, sourceRemoteOpts, destRepository, destRemoteOpts, subjects...,
+	); err != nil {
+		return fmt.Errorf("failed to push Notation signatures: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package clusternodes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/enumflag/v2"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/cleanup"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/docker/registry"
+	"github.com/mesosphere/mindthegap/images/httputils"
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/nodeimport"
+)
+
+type importMode enumflag.Flag
+
+const (
+	DaemonSet importMode = iota
+	SSH
+)
+
+var importModes = map[importMode][]string{
+	DaemonSet: {"daemonset"},
+	SSH:       {"ssh"},
+}
+
+func NewCommand(out output.Output) *cobra.Command {
+	var (
+		imageBundleFiles    []string
+		mode                = DaemonSet
+		kubeconfig          string
+		kubeContext         string
+		containerdNamespace string
+		importerNamespace   string
+		importerImage       string
+		importerTimeout     time.Duration
+		sshConfig           nodeimport.SSHConfig
+		sshHosts            []string
+		platformStr         string
+		nodeConcurrency     int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "cluster-nodes",
+		Short: "Import images from image bundles directly into containerd on every cluster node",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := cmd.ValidateRequiredFlags(); err != nil {
+				return err
+			}
+
+			if err := flags.ValidateFlagsThatRequireValues(cmd, "image-bundle"); err != nil {
+				return err
+			}
+
+			switch mode {
+			case SSH:
+				if sshConfig.User == "" || sshConfig.KeyFile == "" {
+					return errors.New("--ssh-user and --ssh-key are required with --mode=ssh")
+				}
+			default:
+				if len(sshHosts) > 0 {
+					return errors.New("--ssh-hosts can only be specified with --mode=ssh")
+				}
+			}
+
+			if _, err := platform.Parse(platformStr); err != nil {
+				return err
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			ctx := cmd.Context()
+
+			cleaner := cleanup.NewCleaner()
+			defer cleaner.Cleanup()
+
+			var (
+				nodes      []nodeimport.Node
+				restConfig *rest.Config
+				clientset  kubernetes.Interface
+			)
+			if len(sshHosts) > 0 {
+				p := platform.MustParse(platformStr)
+				for _, h := range sshHosts {
+					nodes = append(nodes, nodeimport.Node{Name: h, Address: h, Platform: p})
+				}
+			} else {
+				out.StartOperation("Listing cluster nodes")
+				var err error
+				restConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+					&clientcmd.ClientConfigLoadingRules{
+						ExplicitPath: kubeconfig,
+						Precedence:   clientcmd.NewDefaultClientConfigLoadingRules().Precedence,
+					},
+					&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+				).ClientConfig()
+				if err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf("failed to load kubeconfig: %w", err)
+				}
+				clientset, err = kubernetes.NewForConfig(restConfig)
+				if err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf("failed to create Kubernetes client: %w", err)
+				}
+				nodes, err = nodeimport.ClusterNodes(ctx, clientset)
+				if err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return err
+				}
+				out.EndOperationWithStatus(output.Success())
+			}
+			if len(nodes) == 0 {
+				return errors.New("no nodes to import images into")
+			}
+
+			out.StartOperation("Creating temporary directory")
+			tempDir, err := os.MkdirTemp("", ".image-bundle-*")
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to create temporary directory: %w", err)
+			}
+			cleaner.AddCleanupFn(func() { _ = os.RemoveAll(tempDir) })
+			archivesDir, err := os.MkdirTemp("", ".docker-archives-*")
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to create temporary directory: %w", err)
+			}
+			cleaner.AddCleanupFn(func() { _ = os.RemoveAll(archivesDir) })
+			out.EndOperationWithStatus(output.Success())
+
+			imageBundleFiles, err = utils.FilesWithGlobs(imageBundleFiles)
+			if err != nil {
+				return err
+			}
+			cfg, _, err := utils.ExtractBundles(tempDir, out, imageBundleFiles...)
+			if err != nil {
+				return err
+			}
+
+			out.StartOperation("Starting temporary Docker registry")
+			reg, err := registry.NewRegistry(
+				registry.Config{StorageDirectory: tempDir, ReadOnly: true},
+			)
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to create local Docker registry: %w", err)
+			}
+			regCtx, stopReg := context.WithCancel(cmd.Context())
+			regErrCh, err := reg.Start(regCtx)
+			if err != nil {
+				stopReg()
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to start local Docker registry: %w", err)
+			}
+			// Wait for the registry to stop before its storage is cleaned up.
+			defer func() {
+				stopReg()
+				for regErr := range regErrCh {
+					err = errors.Join(err, regErr)
+				}
+			}()
+			out.EndOperationWithStatus(output.Success())
+
+			sourceTLSRoundTripper, err := httputils.LocalRegistryRoundTripper(remote.DefaultTransport)
+			if err != nil {
+				return fmt.Errorf("error configuring TLS for source registry: %w", err)
+			}
+
+			// Docker archives only support a single platform per image, so write one archive for
+			// every platform of the nodes.
+			archives := map[platform.Platform]string{}
+			for _, n := range nodes {
+				if _, ok := archives[n.Platform]; ok {
+					continue
+				}
+				archive := filepath.Join(
+					archivesDir,
+					strings.ReplaceAll(n.Platform.String(), "/", "-")+".tar",
+				)
+				out.StartOperation(fmt.Sprintf("Exporting images for platform %s", n.Platform))
+				if err := utils.WriteDockerArchive(
+					cmd.Context(), reg.Address(), *cfg, n.Platform, archive, sourceTLSRoundTripper,
+				); err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return err
+				}
+				out.EndOperationWithStatus(output.Success())
+				archives[n.Platform] = archive
+			}
+
+			var importer nodeimport.Importer
+			switch mode {
+			case SSH:
+				importer, err = nodeimport.NewSSHImporter(sshConfig, containerdNamespace)
+				if err != nil {
+					return err
+				}
+			default:
+				out.StartOperation("Deploying importer DaemonSet")
+				dsImporter := nodeimport.NewDaemonSetImporter(
+					clientset, restConfig, importerNamespace, importerImage, containerdNamespace,
+				)
+				defer func() {
+					if err := dsImporter.Stop(context.Background()); err != nil {
+						out.Error(err, "Failed to delete importer DaemonSet")
+					}
+				}()
+				if err := dsImporter.Start(ctx, importerTimeout); err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return err
+				}
+				out.EndOperationWithStatus(output.Success())
+				importer = dsImporter
+			}
+
+			importGauge := &output.ProgressGauge{}
+			importGauge.SetCapacity(len(nodes))
+			importGauge.SetStatus("Importing images into nodes")
+			out.StartOperationWithProgress(importGauge)
+
+			eg, egCtx := errgroup.WithContext(ctx)
+			eg.SetLimit(nodeConcurrency)
+			for i := range nodes {
+				node := nodes[i]
+				eg.Go(func() error {
+					f, err := os.Open(archives[node.Platform])
+					if err != nil {
+						return fmt.Errorf("failed to open docker archive: %w", err)
+					}
+					defer f.Close()
+
+					importOutput, err := importer.Import(egCtx, node, f)
+					if err != nil {
+						out.Warn(string(importOutput))
+						return err
+					}
+					out.V(4).Info(string(importOutput))
+					importGauge.Inc()
+
+					return nil
+				})
+			}
+			if err := eg.Wait(); err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return err
+			}
+			out.EndOperationWithStatus(output.Success())
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&imageBundleFiles, "image-bundle", nil,
+		"Tarball containing list of images to import. Can also be a glob pattern.")
+	_ = cmd.MarkFlagRequired("image-bundle")
+	cmd.Flags().Var(
+		enumflag.New(&mode, "string", importModes, enumflag.EnumCaseSensitive),
+		"mode",
+		`how to import images into nodes: one of "daemonset" (via a short-lived privileged DaemonSet) `+
+			`or "ssh" (via SSH to every node)`,
+	)
+	cmd.Flags().StringVar(&kubeconfig, "kubeconfig", "",
+		"Path to the kubeconfig file for the cluster (defaults to the KUBECONFIG environment variable or ~/.kube/config)")
+	cmd.Flags().StringVar(&kubeContext, "context", "", "Kubeconfig context to use")
+	cmd.Flags().StringVar(&containerdNamespace, "containerd-namespace", "k8s.io",
+		"Containerd namespace to import images into")
+	cmd.Flags().IntVar(&nodeConcurrency, "node-concurrency", 1,
+		"Number of nodes to import images into concurrently")
+	cmd.Flags().StringVar(&importerNamespace, "importer-namespace", "kube-system",
+		"Namespace to deploy the importer DaemonSet to (daemonset mode only)")
+	cmd.Flags().StringVar(&importerImage, "importer-image", "docker.io/library/busybox:1.36.1",
+		"Image to run the importer DaemonSet with, which must provide sleep and chroot and be available on "+
+			"all nodes (daemonset mode only)")
+	cmd.Flags().DurationVar(&importerTimeout, "importer-timeout", 5*time.Minute,
+		"Time to wait for the importer DaemonSet to be ready on all nodes (daemonset mode only)")
+	cmd.Flags().StringVar(&sshConfig.User, "ssh-user", "", "User to connect to nodes as (ssh mode only)")
+	cmd.Flags().StringVar(&sshConfig.KeyFile, "ssh-key", "",
+		"Private key file to connect to nodes with (ssh mode only)")
+	cmd.Flags().IntVar(&sshConfig.Port, "ssh-port", 22, "Port to connect to nodes on (ssh mode only)")
+	cmd.Flags().StringVar(&sshConfig.KnownHostsFile, "ssh-known-hosts",
+		filepath.Join(homeDir(), ".ssh", "known_hosts"),
+		"Known hosts file to verify node host keys with (ssh mode only)")
+	cmd.Flags().BoolVar(&sshConfig.InsecureIgnoreHostKey, "ssh-insecure-ignore-host-key", false,
+		"Do not verify node host keys (ssh mode only)")
+	cmd.Flags().BoolVar(&sshConfig.Sudo, "ssh-sudo", true,
+		"Import images via passwordless sudo (ssh mode only)")
+	cmd.Flags().StringSliceVar(&sshHosts, "ssh-hosts", nil,
+		"Hosts to import images into instead of discovering cluster nodes via the kubeconfig (ssh mode only)")
+	cmd.Flags().StringVar(&platformStr, "platform", "linux/amd64",
+		"Platform of the hosts specified via --ssh-hosts (required format: <os>/<arch>[/<variant>][:<os.version>])")
+
+	return cmd
+}
+
+func homeDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return home
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/mesosphere/dkp-cli-runtime/core/output"
 
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/push/bundle"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/push/clusternodes"
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
 )
 
@@ -31,5 +32,7 @@ func NewCommand(out output.Output) *cobra.Command {
 	bundleCmd := bundle.NewCommand(out, "bundle")
 	cmd.AddCommand(bundleCmd)
 
+	cmd.AddCommand(clusternodes.NewCommand(out))
+
 	return cmd
 }
@@ -4,23 +4,60 @@
 package root
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/mesosphere/dkp-cli-runtime/core/cmd/root"
+	"github.com/mesosphere/dkp-cli-runtime/core/cmd/version"
 	"github.com/mesosphere/dkp-cli-runtime/core/output"
 
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/batch"
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/create"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/export"
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/importcmd"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/migrate"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/optimize"
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/push"
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/serve"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/update"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/validate"
+	"github.com/mesosphere/mindthegap/logging"
+	"github.com/mesosphere/mindthegap/metrics"
 )
 
-func NewCommand(in io.Reader, out, errOut io.Writer) (*cobra.Command, output.Output) {
-	rootCmd, rootOpts := root.NewCommand(out, errOut)
+func NewCommand(in io.Reader, stdout, stderr io.Writer) (*cobra.Command, output.Output) {
+	rootCmd, rootOpts := root.NewCommand(stdout, stderr)
+
+	rootCmd.PersistentFlags().String(metricsFileFlag, "",
+		"Append anonymous usage and performance metrics of this run (command, durations, sizes, error category) "+
+			"as a line of JSON to this local file")
+	rootCmd.PersistentFlags().String(pushgatewayURLFlag, "",
+		"Push the metrics of this run to the Prometheus Pushgateway at this URL, e.g. to track bundle pipelines "+
+			"on ephemeral runners")
+	rootCmd.PersistentFlags().String(pushgatewayJobFlag, "mindthegap",
+		"Job to group metrics pushed to the Prometheus Pushgateway by")
+
+	rootCmd.PersistentFlags().Duration(timeoutFlag, 0,
+		"Timeout for the whole command, after which it is stopped and cleaned up like on interrupt, "+
+			"e.g. 2h. 0 disables the timeout")
+
+	logLevel, logFormat := logging.InfoLevel, logging.TextFormat
+	logging.AddFlags(rootCmd.PersistentFlags(), &logLevel, &logFormat)
+	out := rootOpts.Output
+	if logFlagsSet(rootCmd.PersistentFlags()) {
+		verbosity, _ := rootCmd.PersistentFlags().GetInt("verbose")
+		out = logging.NewOutput(stdout, stderr, logLevel, logFormat, verbosity)
+	}
 
 	originalPreRun := rootCmd.PersistentPreRunE
 	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
@@ -28,6 +65,23 @@ func NewCommand(in io.Reader, out, errOut io.Writer) (*cobra.Command, output.Out
 			return err
 		}
 
+		if timeout, _ := cmd.Flags().GetDuration(timeoutFlag); timeout > 0 {
+			ctx, cancel := context.WithCancelCause(cmd.Context())
+			time.AfterFunc(timeout, func() { cancel(fmt.Errorf("timed out after %v", timeout)) })
+			cmd.SetContext(ctx)
+		}
+
+		metricsFile, _ := cmd.Flags().GetString(metricsFileFlag)
+		pushgatewayURL, _ := cmd.Flags().GetString(pushgatewayURLFlag)
+		if metricsFile != "" || pushgatewayURL != "" {
+			recorder := metrics.NewRecorder(
+				strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" "),
+				version.GetVersion().GitVersion,
+			)
+			recorder.RecordFlags(cmd.Flags())
+			cmd.SetContext(metrics.NewContext(cmd.Context(), recorder))
+		}
+
 		for _, env := range os.Environ() {
 			envKey, _, _ := strings.Cut(env, "=")
 			if strings.HasPrefix(envKey, "REGISTRY_") {
@@ -40,12 +94,29 @@ func NewCommand(in io.Reader, out, errOut io.Writer) (*cobra.Command, output.Out
 		return nil
 	}
 
-	rootCmd.AddCommand(create.NewCommand(rootOpts.Output))
-	rootCmd.AddCommand(push.NewCommand(rootOpts.Output))
-	rootCmd.AddCommand(serve.NewCommand(rootOpts.Output))
-	rootCmd.AddCommand(importcmd.NewCommand(rootOpts.Output))
+	rootCmd.AddCommand(create.NewCommand(out))
+	rootCmd.AddCommand(push.NewCommand(out))
+	rootCmd.AddCommand(serve.NewCommand(out))
+	rootCmd.AddCommand(importcmd.NewCommand(out))
+	rootCmd.AddCommand(batch.NewCommand(out))
+	rootCmd.AddCommand(export.NewCommand(out))
+	rootCmd.AddCommand(update.NewCommand(out))
+	rootCmd.AddCommand(migrate.NewCommand(out))
+	rootCmd.AddCommand(optimize.NewCommand(out))
+	rootCmd.AddCommand(validate.NewCommand(out))
+
+	return rootCmd, out
+}
+
+// logFlagsSet parses the logging flags from the command line, ignoring all other flags, so that the
+// output can be configured before the command is run, returning true if any logging flag is set.
+func logFlagsSet(fs *pflag.FlagSet) bool {
+	origParseErrorsWhitelist := fs.ParseErrorsWhitelist
+	fs.ParseErrorsWhitelist = pflag.ParseErrorsWhitelist{UnknownFlags: true}
+	_ = fs.Parse(os.Args)
+	fs.ParseErrorsWhitelist = origParseErrorsWhitelist
 
-	return rootCmd, rootOpts.Output
+	return fs.Changed(logging.LevelFlag) || fs.Changed(logging.FormatFlag)
 }
 
 func Execute() {
@@ -53,8 +124,62 @@ func Execute() {
 	// disable cobra built-in error printing, we output the error with formatting.
 	rootCmd.SilenceErrors = true
 
-	if err := rootCmd.Execute(); err != nil {
+	// Cancel the context of the command on interrupt, so that it stops and cleans up, e.g. removes
+	// temporary directories and shuts down temporary registries. A second interrupt exits
+	// immediately.
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		signal.Stop(sigCh)
+		cancel(fmt.Errorf("received %v", sig))
+	}()
+
+	executedCmd, err := rootCmd.ExecuteContextC(ctx)
+	if err != nil && executedCmd != nil {
+		// Report why the command was stopped, e.g. it timed out, rather than only the error it
+		// was stopped with.
+		if cause := context.Cause(executedCmd.Context()); cause != nil && !errors.Is(err, cause) {
+			err = fmt.Errorf("%w: %w", cause, err)
+		}
+	}
+	writeMetrics(executedCmd, err, out)
+	if err != nil {
 		out.Error(err, "")
 		os.Exit(1)
 	}
 }
+
+const (
+	timeoutFlag = "timeout"
+
+	metricsFileFlag    = "metrics-file"
+	pushgatewayURLFlag = "pushgateway-url"
+	pushgatewayJobFlag = "pushgateway-job"
+)
+
+// writeMetrics appends the metrics recorded by the executed command to the metrics file and pushes
+// them to the Pushgateway, if requested. Failing to write metrics never fails the command.
+func writeMetrics(cmd *cobra.Command, err error, out output.Output) {
+	if cmd == nil {
+		return
+	}
+	recorder := metrics.FromContext(cmd.Context())
+	if recorder == nil {
+		return
+	}
+	record := recorder.Finish(err)
+	if metricsFile, _ := cmd.Flags().GetString(metricsFileFlag); metricsFile != "" {
+		if writeErr := metrics.AppendToFile(metricsFile, record); writeErr != nil {
+			out.Warnf("Failed to write metrics: %v", writeErr)
+		}
+	}
+	if pushgatewayURL, _ := cmd.Flags().GetString(pushgatewayURLFlag); pushgatewayURL != "" {
+		job, _ := cmd.Flags().GetString(pushgatewayJobFlag)
+		if pushErr := metrics.PushToGateway(context.Background(), pushgatewayURL, job, record); pushErr != nil {
+			out.Warnf("Failed to push metrics: %v", pushErr)
+		}
+	}
+}
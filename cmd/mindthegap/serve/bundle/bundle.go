@@ -4,20 +4,34 @@
 package bundle
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
 
 	"github.com/mesosphere/dkp-cli-runtime/core/output"
 
 	"github.com/mesosphere/mindthegap/cleanup"
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/progress"
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
 	"github.com/mesosphere/mindthegap/config"
 	"github.com/mesosphere/mindthegap/docker/registry"
+	"github.com/mesosphere/mindthegap/images/httputils"
+	"github.com/mesosphere/mindthegap/signing"
 )
 
 func NewCommand(
@@ -25,11 +39,33 @@ func NewCommand(
 	bundleCmdName string,
 ) (cmd *cobra.Command, stopCh chan struct{}) {
 	var (
-		bundleFiles    []string
-		listenAddress  string
-		listenPort     uint16
-		tlsCertificate string
-		tlsKey         string
+		bundleFiles          []string
+		listenAddress        string
+		listenPort           uint16
+		listenPortRange      flags.PortRange
+		tlsCertificate       string
+		tlsKey               string
+		pidFile              string
+		enableMetrics        bool
+		metricsListenAddress string
+		shutdownTimeout      time.Duration
+		blobCacheSize        resource.QuantityValue
+		repositoryPrefix     string
+		pathPrefix           string
+		publicURL            string
+		ignoreForwarded      bool
+		imageFilter          config.ImageFilter
+		progressMode         progress.Mode
+		storageDir           string
+		containerdConfigDir  string
+		dockerDaemonJSON     string
+		mirrorAddr           string
+		readOnly             bool
+		proxyFallback        registry.ProxyFallback
+		bundleVerifyOpts     signing.VerifyOptions
+		remoteBundleOpts     utils.RemoteBundleOptions
+
+		tokenAuthOpts flags.TokenAuthOptions
 	)
 
 	stopCh = make(chan struct{})
@@ -46,41 +82,141 @@ func NewCommand(
 				return err
 			}
 
+			if err := imageFilter.Validate(); err != nil {
+				return err
+			}
+
+			if err := bundleVerifyOpts.Validate(); err != nil {
+				return err
+			}
+
+			if err := remoteBundleOpts.Validate(); err != nil {
+				return err
+			}
+
+			if err := tokenAuthOpts.Validate(); err != nil {
+				return err
+			}
+
+			if prefix := strings.Trim(repositoryPrefix, "/"); prefix != "" {
+				if _, err := name.NewRepository(prefix, name.StrictValidation); err != nil {
+					return fmt.Errorf("invalid --repository-prefix %q: %w", repositoryPrefix, err)
+				}
+			}
+
+			if strings.ContainsAny(pathPrefix, "?#") {
+				return fmt.Errorf("invalid --path-prefix %q: must be a URL path", pathPrefix)
+			}
+			if publicURL != "" {
+				u, err := url.Parse(publicURL)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+					u.RawQuery != "" || u.Fragment != "" {
+					return fmt.Errorf(
+						"invalid --public-url %q: must be an http or https URL without query or fragment", publicURL,
+					)
+				}
+			}
+
+			if proxyFallback.RemoteURL != "" {
+				if readOnly {
+					return fmt.Errorf("--proxy-fallback-registry requires --read-only=false")
+				}
+				u, err := url.Parse(proxyFallback.RemoteURL)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf(
+						"invalid --proxy-fallback-registry %q: must be an http or https URL",
+						proxyFallback.RemoteURL,
+					)
+				}
+			}
+
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cleaner := cleanup.NewCleaner()
 			defer cleaner.Cleanup()
-			out.StartOperation("Creating temporary directory")
-			tempDir, err := os.MkdirTemp("", ".bundle-*")
-			if err != nil {
-				out.EndOperationWithStatus(output.Failure())
-				return fmt.Errorf("failed to create temporary directory: %w", err)
-			}
-			cleaner.AddCleanupFn(func() { _ = os.RemoveAll(tempDir) })
 
-			out.EndOperationWithStatus(output.Success())
+			// Handle SIGHUP from the start, so that it loads new bundles once the bundles have been
+			// loaded rather than terminating the process.
+			hupCh := make(chan os.Signal, 1)
+			signal.Notify(hupCh, syscall.SIGHUP)
+			defer signal.Stop(hupCh)
 
-			bundleFiles, err = utils.FilesWithGlobs(bundleFiles)
+			// Keep the globs to load bundles added to them later on SIGHUP. Remote bundles are only
+			// downloaded once, so the globs refer to their downloaded files.
+			bundlePatterns, err := utils.DownloadRemoteBundles(
+				cmd.Context(), out, remoteBundleOpts, !bundleVerifyOpts.IsEmpty(), cleaner, bundleFiles...,
+			)
 			if err != nil {
 				return err
 			}
-			imagesCfg, chartsCfg, err := utils.ExtractBundles(tempDir, out, bundleFiles...)
+			bundleFiles, err = utils.FilesWithGlobs(bundlePatterns)
 			if err != nil {
 				return err
 			}
+			if err := utils.VerifyBundleSignatures(
+				cmd.Context(), out, bundleVerifyOpts, bundleFiles...,
+			); err != nil {
+				return err
+			}
 
-			// Write out the merged image bundle config to the target directory for completeness.
-			if imagesCfg != nil {
-				if err := config.WriteSanitizedImagesConfig(*imagesCfg, filepath.Join(tempDir, "images.yaml")); err != nil {
+			var (
+				tempDir      string
+				storageState utils.StorageState
+				populated    bool
+			)
+			if storageDir != "" {
+				out.StartOperation("Checking storage directory")
+				storageState, err = utils.NewStorageState(bundleFiles, imageFilter)
+				if err != nil {
+					out.EndOperationWithStatus(output.Failure())
 					return err
 				}
-			}
-			// Write out the merged chart bundle config to the target directory for completeness.
-			if chartsCfg != nil {
-				if err := config.WriteSanitizedHelmChartsConfig(*chartsCfg, filepath.Join(tempDir, "charts.yaml")); err != nil {
+				populated, err = utils.PrepareStorageDir(storageDir, storageState)
+				if err != nil {
+					out.EndOperationWithStatus(output.Failure())
 					return err
 				}
+				out.EndOperationWithStatus(output.Success())
+				tempDir = storageDir
+			} else {
+				out.StartOperation("Creating temporary directory")
+				tempDir, err = os.MkdirTemp("", ".bundle-*")
+				if err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return fmt.Errorf("failed to create temporary directory: %w", err)
+				}
+				cleaner.AddCleanupFn(func() { _ = os.RemoveAll(tempDir) })
+
+				out.EndOperationWithStatus(output.Success())
+			}
+
+			if tlsCertificate != "" {
+				warnIfCertificateNotValid(out, tlsCertificate)
+			}
+
+			port, maxPort := listenPort, uint16(0)
+			if listenPortRange.First != 0 {
+				port, maxPort = listenPortRange.First, listenPortRange.Last
+			}
+
+			var regProxyFallback *registry.ProxyFallback
+			if proxyFallback.RemoteURL != "" {
+				regProxyFallback = &proxyFallback
+			}
+
+			tokenAuth, err := tokenAuthOpts.TokenAuth(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to configure token auth: %w", err)
+			}
+			// The realm is derived from the public URL by the registry if set.
+			if tokenAuth != nil && len(tokenAuth.Authenticators) > 0 && tokenAuth.Realm == "" &&
+				mirrorAddr != "" && publicURL == "" {
+				scheme := "http"
+				if tlsCertificate != "" {
+					scheme = "https"
+				}
+				tokenAuth.Realm = scheme + "://" + mirrorAddr + path.Join("/", pathPrefix, registry.TokenPath)
 			}
 
 			out.StartOperation("Creating Docker registry")
@@ -88,39 +224,349 @@ func NewCommand(
 				StorageDirectory: tempDir,
 				ReadOnly:         true,
 				Host:             listenAddress,
-				Port:             listenPort,
+				Port:             port,
+				MaxPort:          maxPort,
 				TLS: registry.TLS{
 					Certificate: tlsCertificate,
 					Key:         tlsKey,
 				},
+				// Report not ready until all bundles have been extracted into the registry storage.
+				StartNotReady:             true,
+				Metrics:                   enableMetrics || metricsListenAddress != "",
+				MetricsOnSeparateListener: metricsListenAddress != "",
+				BlobCacheSize:             blobCacheSize.Value(),
+				RepositoryPrefix:          repositoryPrefix,
+				ProxyFallback:             regProxyFallback,
+				TokenAuth:                 tokenAuth,
+				PathPrefix:                pathPrefix,
+				PublicURL:                 publicURL,
+				IgnoreForwardedHeaders:    ignoreForwarded,
 			})
 			if err != nil {
 				out.EndOperationWithStatus(output.Failure())
 				return fmt.Errorf("failed to create local Docker registry: %w", err)
 			}
 			out.EndOperationWithStatus(output.Success())
+
+			regCtx, stopReg := context.WithCancel(context.Background())
+			defer stopReg()
+			regErrCh, err := reg.Start(regCtx)
+			if err != nil {
+				return fmt.Errorf("failed to start local Docker registry: %w", err)
+			}
 			out.Infof("Listening on %s\n", reg.Address())
+			reporter := progress.NewReporter(progressMode, cmd.OutOrStdout())
+			reporter.RegistryListening(reg.Address())
 
-			go func() {
-				if err := reg.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-					out.Error(err, "error serving Docker registry")
-					os.Exit(2)
+			if metricsListenAddress != "" {
+				metricsSrv, err := startMetricsServer(metricsListenAddress)
+				if err != nil {
+					return err
 				}
-			}()
-			<-stopCh
+				defer func() { _ = metricsSrv.Close() }()
+				out.Infof("Serving metrics on %s%s\n", metricsListenAddress, registry.MetricsPath)
+			}
+
+			if populated {
+				out.Infof("Storage directory %s already contains the bundles, skipping extraction\n", storageDir)
+			} else {
+				if err := extractBundles(out, tempDir, bundleFiles, imageFilter); err != nil {
+					return err
+				}
+				if storageDir != "" {
+					if err := utils.WriteStorageState(storageDir, storageState); err != nil {
+						return err
+					}
+				}
+			}
+
+			updateMirrorConfigs := func() error {
+				if containerdConfigDir == "" && dockerDaemonJSON == "" {
+					return nil
+				}
+				m, err := mirror(reg.Address(), mirrorAddr, publicURL, pathPrefix, tlsCertificate != "")
+				if err != nil {
+					return err
+				}
+				m.RepositoryPrefix = repositoryPrefix
+				return writeMirrorConfigs(out, tempDir, m, containerdConfigDir, dockerDaemonJSON)
+			}
+			if err := updateMirrorConfigs(); err != nil {
+				return err
+			}
+
+			loader := newBundleLoader(
+				bundlePatterns, bundleFiles, tempDir, storageDir, imageFilter, bundleVerifyOpts,
+				updateMirrorConfigs,
+			)
+			reg.MarkReady()
+			out.Infof("Bundle contents loaded, registry is ready\n")
+			reporter.RegistryReady(reg.Address())
+
+			if pidFile != "" {
+				//nolint:gosec // PID files are meant to be world-readable.
+				if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
+					return fmt.Errorf("failed to write PID file: %w", err)
+				}
+				cleaner.AddCleanupFn(func() { _ = os.Remove(pidFile) })
+			}
+
+		serveLoop:
+			for {
+				select {
+				case <-stopCh:
+					break serveLoop
+				case <-cmd.Context().Done():
+					// Stopped by SIGTERM, interrupt or timeout.
+					out.Infof("Shutting down: %v\n", context.Cause(cmd.Context()))
+					break serveLoop
+				case <-hupCh:
+					out.Infof("Received SIGHUP, loading new bundles\n")
+					// Keep serving the bundles that have already been loaded if loading fails.
+					if err := loader.loadNewBundles(cmd.Context(), out); err != nil {
+						out.Error(err, "Failed to load new bundles")
+					}
+				case err := <-regErrCh:
+					if err != nil {
+						return fmt.Errorf("error serving Docker registry: %w", err)
+					}
+					return nil
+				}
+			}
+
+			// Wait for in-flight requests to complete before exiting.
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := reg.Shutdown(shutdownCtx); err != nil {
+				return fmt.Errorf("failed to shut down Docker registry gracefully: %w", err)
+			}
 
 			return nil
 		},
 	}
 
 	cmd.Flags().StringSliceVar(&bundleFiles, bundleCmdName, nil,
-		"Bundle to serve. Can also be a glob pattern.")
+		"Bundle to serve. Can also be a glob pattern, or an HTTP(S) URL to download the bundle from, optionally "+
+			"with the expected checksum of the bundle, e.g. https://example.com/images.tar?checksum=sha256:<hex>")
 	_ = cmd.MarkFlagRequired(bundleCmdName)
-	cmd.Flags().StringVar(&listenAddress, "listen-address", "127.0.0.1", "Address to listen on")
+	cmd.Flags().StringVar(&listenAddress, "listen-address", "0.0.0.0", "Address to listen on")
 	cmd.Flags().
 		Uint16Var(&listenPort, "listen-port", 0, "Port to listen on (0 means use any free port)")
+	flags.AddListenPortRangeFlag(cmd.Flags(), &listenPortRange)
+	cmd.MarkFlagsMutuallyExclusive("listen-port", "listen-port-range")
 	cmd.Flags().StringVar(&tlsCertificate, "tls-cert-file", "", "TLS certificate file")
 	cmd.Flags().StringVar(&tlsKey, "tls-private-key-file", "", "TLS private key file")
+	cmd.Flags().BoolVar(&enableMetrics, "enable-metrics", false,
+		"Serve Prometheus metrics on "+registry.MetricsPath+" of the registry listen address")
+	cmd.Flags().StringVar(&metricsListenAddress, "metrics-listen-address", "",
+		"Address (host:port) to serve Prometheus metrics on, separately from the registry "+
+			"(implies --enable-metrics)")
+	cmd.Flags().StringVar(&pidFile, "pid-file", "",
+		"File to write the process ID to once the registry is ready (removed on exit)")
+	cmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second,
+		"Time to wait for in-flight requests to complete when shutting down")
+	cmd.Flags().StringVar(&repositoryPrefix, "repository-prefix", "",
+		"Prefix to expose all repositories in the bundles under, e.g. platform/ to serve library/nginx as "+
+			"platform/library/nginx")
+	cmd.Flags().StringVar(&pathPrefix, "path-prefix", "",
+		"URL path to serve the registry API under, e.g. /bundle-registry/ behind a reverse proxy that does not "+
+			"strip the path (health and metrics endpoints are still served at the root)")
+	cmd.Flags().StringVar(&publicURL, "public-url", "",
+		"URL that clients reach the registry at, e.g. https://apps.example.com/bundle-registry/ behind a reverse "+
+			"proxy, used for URLs in Location headers and the token auth realm instead of URLs derived from requests")
+	cmd.Flags().BoolVar(&ignoreForwarded, "ignore-forwarded-headers", false,
+		"Ignore the Forwarded, X-Forwarded-Proto and X-Forwarded-Host headers that URLs in Location headers are "+
+			"derived from if --public-url is not set, so that clients that do not connect through a reverse proxy "+
+			"cannot spoof them")
+	flags.AddImageFilterFlags(cmd.Flags(), &imageFilter)
+	cmd.Flags().Var(&blobCacheSize, "blob-cache-size",
+		"Maximum total size of blobs to cache in memory, e.g. 512Mi, serving concurrent requests for the same "+
+			"blob from a single read (disabled if not set)")
+	cmd.Flags().StringVar(&storageDir, "storage-dir", "",
+		"Persistent directory to extract the bundles into and serve them from instead of a temporary directory. "+
+			"Extraction is skipped if the directory already contains the same bundles (must be empty or previously "+
+			"populated from bundles)")
+	cmd.Flags().StringVar(&containerdConfigDir, "generate-containerd-config-dir", "",
+		"Directory to write containerd hosts.toml files to that configure the registry as mirror for all registries "+
+			"of the served images, for use as the containerd registry config_path, e.g. /etc/containerd/certs.d")
+	cmd.Flags().StringVar(&dockerDaemonJSON, "generate-docker-daemon-json", "",
+		"Docker daemon.json file to configure the registry as Docker Hub mirror in, keeping other settings of the "+
+			"file if it exists")
+	cmd.Flags().StringVar(&mirrorAddr, "mirror-address", "",
+		"Address (host:port) that clients reach the registry at, used in generated mirror configs (defaults to the "+
+			"host of --public-url if set, otherwise to the listen address, or the hostname if listening on all "+
+			"interfaces)")
+	cmd.Flags().BoolVar(&readOnly, "read-only", true,
+		"Only serve the contents of the bundles, never writing to the registry storage (set to false to allow "+
+			"caching images pulled from --proxy-fallback-registry)")
+	cmd.Flags().StringVar(&proxyFallback.RemoteURL, "proxy-fallback-registry", "",
+		"URL of an upstream registry, e.g. https://registry-1.docker.io, to proxy requests for images that are not "+
+			"in the bundles to, caching pulled images in the registry storage (requires --read-only=false)")
+	cmd.Flags().StringVar(&proxyFallback.Username, "proxy-fallback-registry-username", "",
+		"Username to use to log in to the proxy fallback registry")
+	cmd.Flags().StringVar(&proxyFallback.Password, "proxy-fallback-registry-password", "",
+		"Password to use to log in to the proxy fallback registry")
+	cmd.MarkFlagsRequiredTogether(
+		"proxy-fallback-registry-username",
+		"proxy-fallback-registry-password",
+	)
+	cmd.Flags().DurationVar(&proxyFallback.TTL, "proxy-fallback-cache-ttl", 0,
+		"Time to cache images pulled from the proxy fallback registry for (0 means cache them forever)")
+	flags.AddTokenAuthFlags(cmd.Flags(), &tokenAuthOpts)
+	flags.AddBundleVerifyFlags(cmd.Flags(), &bundleVerifyOpts)
+	flags.AddRemoteBundleFlags(cmd.Flags(), &remoteBundleOpts)
+	progress.AddFlag(cmd.Flags(), &progressMode)
 
 	return cmd, stopCh
 }
+
+// extractBundles extracts the bundles into the registry storage in dir, removing images that are not
+// selected by the filter. The configs of the bundles are merged into the configs of the bundles that
+// have already been extracted into dir, if any.
+func extractBundles(out output.Output, dir string, bundleFiles []string, imageFilter config.ImageFilter) error {
+	loadedImagesCfg, loadedChartsCfg, loadedRepoRewrites, err := readExtractedConfigs(dir)
+	if err != nil {
+		return err
+	}
+
+	imagesCfg, chartsCfg, err := utils.ExtractBundles(dir, out, bundleFiles...)
+	if err != nil {
+		return err
+	}
+
+	if imagesCfg != nil && !imageFilter.IsEmpty() {
+		out.StartOperation("Filtering bundled images")
+		filteredImagesCfg, err := utils.FilterImagesInRegistryStorage(dir, *imagesCfg, imageFilter)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return err
+		}
+		out.EndOperationWithStatus(output.Success())
+		out.Infof(
+			"Serving %d of %d bundled images\n",
+			filteredImagesCfg.TotalImages(),
+			imagesCfg.TotalImages(),
+		)
+		imagesCfg = &filteredImagesCfg
+	}
+
+	if loadedImagesCfg != nil && imagesCfg != nil {
+		imagesCfg = loadedImagesCfg.Merge(*imagesCfg)
+	} else if loadedImagesCfg != nil {
+		imagesCfg = loadedImagesCfg
+	}
+	if loadedChartsCfg != nil && chartsCfg != nil {
+		chartsCfg = loadedChartsCfg.Merge(*chartsCfg)
+	} else if loadedChartsCfg != nil {
+		chartsCfg = loadedChartsCfg
+	}
+	if loadedRepoRewrites != nil {
+		repoRewrites, err := utils.ReadRepoRewrites(dir)
+		if err != nil {
+			return err
+		}
+		if repoRewrites != nil {
+			merged, err := loadedRepoRewrites.Merge(*repoRewrites)
+			if err != nil {
+				return fmt.Errorf("failed to merge repository rewrites of bundles: %w", err)
+			}
+			loadedRepoRewrites = &merged
+		}
+		if err := config.WriteRepoRewritesFile(
+			*loadedRepoRewrites, filepath.Join(dir, utils.RepoRewritesFileName),
+		); err != nil {
+			return err
+		}
+	}
+
+	// Write out the merged image bundle config to the target directory for completeness.
+	if imagesCfg != nil {
+		if err := config.WriteSanitizedImagesConfig(*imagesCfg, filepath.Join(dir, "images.yaml")); err != nil {
+			return err
+		}
+	}
+	// Write out the merged chart bundle config to the target directory for completeness.
+	if chartsCfg != nil {
+		if err := config.WriteSanitizedHelmChartsConfig(*chartsCfg, filepath.Join(dir, "charts.yaml")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readExtractedConfigs reads the merged configs of the bundles that have already been extracted into
+// dir, removing the repository rewrites so that they are not overwritten by extracting further
+// bundles. All configs are nil if no bundles have been extracted into dir yet.
+func readExtractedConfigs(
+	dir string,
+) (*config.ImagesConfig, *config.HelmChartsConfig, *config.RepoRewrites, error) {
+	var (
+		imagesCfg *config.ImagesConfig
+		chartsCfg *config.HelmChartsConfig
+	)
+	imagesCfgFile := filepath.Join(dir, "images.yaml")
+	if _, err := os.Stat(imagesCfgFile); err == nil {
+		cfg, err := config.ParseImagesConfigFile(imagesCfgFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		imagesCfg = &cfg
+	}
+	chartsCfgFile := filepath.Join(dir, "charts.yaml")
+	if _, err := os.Stat(chartsCfgFile); err == nil {
+		cfg, err := config.ParseHelmChartsConfigFile(chartsCfgFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		chartsCfg = &cfg
+	}
+
+	repoRewrites, err := utils.ReadRepoRewrites(dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if repoRewrites != nil {
+		if err := os.Remove(filepath.Join(dir, utils.RepoRewritesFileName)); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to remove repository rewrites: %w", err)
+		}
+	}
+
+	return imagesCfg, chartsCfg, repoRewrites, nil
+}
+
+func startMetricsServer(addr string) (*http.Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on metrics address %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(registry.MetricsPath, registry.MetricsHandler())
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 1 * time.Second,
+	}
+	go func() { _ = srv.Serve(l) }()
+
+	return srv, nil
+}
+
+// warnIfCertificateNotValid warns if the TLS certificate is not valid at the local time, which
+// on air-gapped hosts is frequently caused by a wrong local clock, so that clients fail to verify it
+// either way.
+func warnIfCertificateNotValid(out output.Output, certFile string) {
+	now := time.Now()
+	skew, notBefore, notAfter, err := httputils.CertificateFileClockSkew(certFile, now)
+	if err != nil || skew == 0 {
+		// Invalid certificate files are reported when starting the registry.
+		return
+	}
+	out.Warnf(
+		"TLS certificate %s is not valid at the local time %s (valid from %s to %s): "+
+			"clients will fail to verify it unless their clock differs, check the local clock",
+		certFile,
+		now.UTC().Format(time.RFC3339),
+		notBefore.UTC().Format(time.RFC3339),
+		notAfter.UTC().Format(time.RFC3339),
+	)
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/mirrorconfig"
+)
+
+// mirrorAddress returns the address that clients reach the registry listening on listenAddress at,
+// which is the hostname if the registry listens on all interfaces, unless overridden.
+func mirrorAddress(listenAddress, override string) (string, error) {
+	if override != "" {
+		return override, nil
+	}
+	host, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		if host, err = os.Hostname(); err != nil {
+			return "", fmt.Errorf("failed to determine hostname for mirror address: %w", err)
+		}
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// mirror returns the mirror that clients reach the registry listening on listenAddress at, which is
+// the public URL unless the mirror address is overridden, and the mirror address otherwise.
+func mirror(listenAddress, override, publicURL, pathPrefix string, tls bool) (mirrorconfig.Mirror, error) {
+	if publicURL != "" && override == "" {
+		u, err := url.Parse(publicURL)
+		if err != nil {
+			return mirrorconfig.Mirror{}, fmt.Errorf("invalid public URL: %w", err)
+		}
+		return mirrorconfig.Mirror{Address: u.Host, TLS: u.Scheme == "https", PathPrefix: u.Path}, nil
+	}
+	addr, err := mirrorAddress(listenAddress, override)
+	if err != nil {
+		return mirrorconfig.Mirror{}, err
+	}
+	return mirrorconfig.Mirror{Address: addr, TLS: tls, PathPrefix: pathPrefix}, nil
+}
+
+// writeMirrorConfigs writes the containerd hosts directory and Docker daemon.json, if set, that
+// configure the mirror for all registries of the images served from the registry storage in dir.
+func writeMirrorConfigs(
+	out output.Output,
+	dir string,
+	m mirrorconfig.Mirror,
+	containerdConfigDir, dockerDaemonJSON string,
+) error {
+	imagesCfgFile := filepath.Join(dir, "images.yaml")
+	if _, err := os.Stat(imagesCfgFile); errors.Is(err, os.ErrNotExist) {
+		out.Warnf("WARNING: bundles do not contain any images, not generating mirror configs")
+		return nil
+	}
+	imagesCfg, err := config.ParseImagesConfigFile(imagesCfgFile)
+	if err != nil {
+		return err
+	}
+	registryNames := imagesCfg.SortedRegistryNames()
+
+	if containerdConfigDir != "" {
+		if err := mirrorconfig.WriteContainerdHostsDir(containerdConfigDir, registryNames, m); err != nil {
+			return err
+		}
+		out.Infof("Wrote containerd mirror config for %d registries to %s\n", len(registryNames), containerdConfigDir)
+	}
+	if dockerDaemonJSON != "" {
+		unsupported, err := mirrorconfig.WriteDockerDaemonJSON(dockerDaemonJSON, registryNames, m)
+		if err != nil {
+			return err
+		}
+		out.Infof("Wrote Docker mirror config to %s\n", dockerDaemonJSON)
+		if len(unsupported) > 0 {
+			out.Warnf(
+				"WARNING: Docker only supports mirrors for Docker Hub, pull images from %s as %s/<image> instead",
+				strings.Join(unsupported, ", "), m.Address,
+			)
+		}
+	}
+	return nil
+}
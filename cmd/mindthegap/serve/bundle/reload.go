@@ -0,0 +1,229 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/signing"
+)
+
+// bundleLoader loads bundles into the storage of a running registry, e.g. on SIGHUP, so that bundles
+// can be added without restarting the registry and interrupting clients pulling from it.
+type bundleLoader struct {
+	// patterns are the bundle files and globs to serve, expanded again on every load so that new
+	// bundles matching a glob, e.g. added to a directory of bundles, are loaded.
+	patterns    []string
+	dir         string
+	storageDir  string
+	imageFilter config.ImageFilter
+	verifyOpts  signing.VerifyOptions
+	// afterLoad is called once new bundles have been loaded, e.g. to update generated mirror configs.
+	afterLoad func() error
+
+	loaded map[string]struct{}
+}
+
+func newBundleLoader(
+	patterns, loadedBundleFiles []string,
+	dir, storageDir string,
+	imageFilter config.ImageFilter,
+	verifyOpts signing.VerifyOptions,
+	afterLoad func() error,
+) *bundleLoader {
+	l := &bundleLoader{
+		patterns:    patterns,
+		dir:         dir,
+		storageDir:  storageDir,
+		imageFilter: imageFilter,
+		verifyOpts:  verifyOpts,
+		afterLoad:   afterLoad,
+		loaded:      make(map[string]struct{}, len(loadedBundleFiles)),
+	}
+	for _, f := range loadedBundleFiles {
+		l.loaded[filepath.Clean(f)] = struct{}{}
+	}
+	return l
+}
+
+// newBundles returns the bundle files matching the patterns that have not been loaded yet.
+func (l *bundleLoader) newBundles() ([]string, error) {
+	bundleFiles, err := utils.FilesWithGlobs(l.patterns)
+	if err != nil {
+		return nil, err
+	}
+	var newBundleFiles []string
+	for _, f := range bundleFiles {
+		if _, ok := l.loaded[filepath.Clean(f)]; !ok {
+			newBundleFiles = append(newBundleFiles, f)
+		}
+	}
+	return newBundleFiles, nil
+}
+
+// loadNewBundles extracts the bundles that have not been loaded yet into the registry storage while
+// the registry keeps serving the bundles that have already been loaded.
+func (l *bundleLoader) loadNewBundles(ctx context.Context, out output.Output) error {
+	newBundleFiles, err := l.newBundles()
+	if err != nil {
+		return err
+	}
+	if len(newBundleFiles) == 0 {
+		out.Infof("No new bundles to load\n")
+		return nil
+	}
+
+	if err := utils.VerifyBundleSignatures(ctx, out, l.verifyOpts, newBundleFiles...); err != nil {
+		return err
+	}
+	if err := l.extractNewBundles(out, newBundleFiles); err != nil {
+		return err
+	}
+	for _, f := range newBundleFiles {
+		l.loaded[filepath.Clean(f)] = struct{}{}
+	}
+
+	if l.storageDir != "" {
+		loadedBundleFiles := make([]string, 0, len(l.loaded))
+		for f := range l.loaded {
+			loadedBundleFiles = append(loadedBundleFiles, f)
+		}
+		state, err := utils.NewStorageState(loadedBundleFiles, l.imageFilter)
+		if err != nil {
+			return err
+		}
+		if err := utils.WriteStorageState(l.storageDir, state); err != nil {
+			return err
+		}
+	}
+
+	if l.afterLoad != nil {
+		if err := l.afterLoad(); err != nil {
+			return err
+		}
+	}
+
+	out.Infof("Loaded %d new bundles\n", len(newBundleFiles))
+	return nil
+}
+
+// stagingDirName is the directory in the registry storage directory that new bundles are extracted
+// into before their contents are moved into the registry storage. The registry only serves the
+// docker directory of its storage directory, so staged contents are never served.
+const stagingDirName = ".loading"
+
+// extractNewBundles extracts the bundles into a staging directory and then moves the extracted files
+// into the registry storage, so that the registry never serves partially extracted files, and never
+// serves tags before all content they reference has been moved. The configs of the loaded bundles are
+// copied to the staging directory first, so that they are merged with the configs of the new bundles
+// like when bundles are extracted into the registry storage directly.
+func (l *bundleLoader) extractNewBundles(out output.Output, bundleFiles []string) error {
+	stagingDir := filepath.Join(l.dir, stagingDirName)
+	// Remove files staged by loads that have been interrupted.
+	if err := os.RemoveAll(stagingDir); err != nil {
+		return fmt.Errorf("failed to remove staging directory: %w", err)
+	}
+	if err := os.Mkdir(stagingDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	for _, f := range []string{"images.yaml", "charts.yaml", utils.RepoRewritesFileName} {
+		if err := copyFile(filepath.Join(l.dir, f), filepath.Join(stagingDir, f)); err != nil {
+			return fmt.Errorf("failed to stage config of loaded bundles: %w", err)
+		}
+	}
+	if err := extractBundles(out, stagingDir, bundleFiles, l.imageFilter); err != nil {
+		return err
+	}
+
+	files, err := stagedFiles(stagingDir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		dest := filepath.Join(l.dir, f)
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return fmt.Errorf("failed to load %s: %w", f, err)
+		}
+		// Renaming replaces existing files atomically, so clients never read partially written files.
+		if err := os.Rename(filepath.Join(stagingDir, f), dest); err != nil {
+			return fmt.Errorf("failed to load %s: %w", f, err)
+		}
+	}
+	return nil
+}
+
+// stagedFiles returns the paths of the files in the staging directory relative to it, in the order
+// they are moved into the registry storage: blobs first, then the links of the repositories to
+// their layers and manifests, then the links of tags to manifests, and finally all other files such
+// as the bundle configs. Content is thereby always moved before anything referencing it.
+func stagedFiles(stagingDir string) ([]string, error) {
+	blobsDir := filepath.Join("docker", "registry", "v2", "blobs") + string(os.PathSeparator)
+	repositoriesDir := filepath.Join("docker", "registry", "v2", "repositories") + string(os.PathSeparator)
+	tagsDir := string(os.PathSeparator) + filepath.Join("_manifests", "tags") + string(os.PathSeparator)
+	order := func(f string) int {
+		switch {
+		case strings.HasPrefix(f, blobsDir):
+			return 0
+		case strings.HasPrefix(f, repositoriesDir) && strings.Contains(f, tagsDir):
+			return 2
+		case strings.HasPrefix(f, repositoriesDir):
+			return 1
+		default:
+			return 3
+		}
+	}
+
+	var files []string
+	err := filepath.WalkDir(stagingDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := filepath.Rel(stagingDir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read staging directory: %w", err)
+	}
+	sort.SliceStable(files, func(i, j int) bool { return order(files[i]) < order(files[j]) })
+	return files, nil
+}
+
+// copyFile copies the file src to dest, if src exists.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/signing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for f, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func TestStagedFilesOrder(t *testing.T) {
+	t.Parallel()
+
+	stagingDir := t.TempDir()
+	writeFiles(t, stagingDir, map[string]string{
+		"images.yaml": "",
+		"docker/registry/v2/repositories/app/_manifests/tags/v1/current/link":                "",
+		"docker/registry/v2/repositories/app/_manifests/revisions/sha256/aaaa/link":          "",
+		"docker/registry/v2/repositories/app/_layers/sha256/bbbb/link":                       "",
+		"docker/registry/v2/blobs/sha256/aa/aaaa/data":                                       "",
+		"docker/registry/v2/repositories/app/tags/_manifests/tags/v2/current/link":           "",
+		"docker/registry/v2/repositories/app/tags/_manifests/revisions/sha256/cccc/link":     "",
+		"docker/registry/v2/blobs/sha256/bb/bbbb/data":                                       "",
+		"docker/registry/v2/repositories/app/_manifests/tags/v1/index/sha256/aaaa/link":      "",
+		"docker/registry/v2/repositories/app/tags/_manifests/tags/v2/index/sha256/cccc/link": "",
+	})
+
+	files, err := stagedFiles(stagingDir)
+	require.NoError(t, err)
+	for i := range files {
+		files[i] = filepath.ToSlash(files[i])
+	}
+	assert.Equal(t, []string{
+		"docker/registry/v2/blobs/sha256/aa/aaaa/data",
+		"docker/registry/v2/blobs/sha256/bb/bbbb/data",
+		"docker/registry/v2/repositories/app/_layers/sha256/bbbb/link",
+		"docker/registry/v2/repositories/app/_manifests/revisions/sha256/aaaa/link",
+		"docker/registry/v2/repositories/app/tags/_manifests/revisions/sha256/cccc/link",
+		"docker/registry/v2/repositories/app/_manifests/tags/v1/current/link",
+		"docker/registry/v2/repositories/app/_manifests/tags/v1/index/sha256/aaaa/link",
+		"docker/registry/v2/repositories/app/tags/_manifests/tags/v2/current/link",
+		"docker/registry/v2/repositories/app/tags/_manifests/tags/v2/index/sha256/cccc/link",
+		"images.yaml",
+	}, files, "content should be moved before the tags referencing it")
+}
+
+func TestBundleLoaderExtractsViaStagingDirectory(t *testing.T) {
+	t.Parallel()
+
+	storageDir := t.TempDir()
+	writeFiles(t, storageDir, map[string]string{
+		"images.yaml": "docker.io:\n  images:\n    library/loaded:\n    - v1\n",
+		"docker/registry/v2/repositories/library/loaded/_manifests/tags/v1/current/link": "sha256:aaaa",
+	})
+
+	bundleDir := t.TempDir()
+	writeFiles(t, bundleDir, map[string]string{
+		"images.yaml": "docker.io:\n  images:\n    library/new:\n    - v1\n",
+		"docker/registry/v2/blobs/sha256/bb/bbbb/data":                                "manifest",
+		"docker/registry/v2/repositories/library/new/_manifests/tags/v1/current/link": "sha256:bbbb",
+	})
+	bundleFile := filepath.Join(t.TempDir(), "images.tar")
+	require.NoError(t, archive.ArchiveDirectory(bundleDir, bundleFile))
+
+	loader := newBundleLoader(
+		[]string{bundleFile}, nil, storageDir, "", config.ImageFilter{}, signing.VerifyOptions{}, nil,
+	)
+	require.NoError(t, loader.extractNewBundles(output.NewDiscardingOutput(), []string{bundleFile}))
+
+	assert.NoDirExists(t, filepath.Join(storageDir, stagingDirName), "the staging directory should be removed")
+	assert.FileExists(t, filepath.Join(storageDir, "docker/registry/v2/blobs/sha256/bb/bbbb/data"))
+	assert.FileExists(
+		t, filepath.Join(storageDir, "docker/registry/v2/repositories/library/new/_manifests/tags/v1/current/link"),
+	)
+	assert.FileExists(
+		t, filepath.Join(storageDir, "docker/registry/v2/repositories/library/loaded/_manifests/tags/v1/current/link"),
+		"loaded bundles should be kept",
+	)
+	imagesCfg, err := config.ParseImagesConfigFile(filepath.Join(storageDir, "images.yaml"))
+	require.NoError(t, err)
+	assert.Equal(
+		t, map[string][]string{"library/loaded": {"v1"}, "library/new": {"v1"}}, imagesCfg["docker.io"].Images,
+		"the configs of the loaded and new bundles should be merged",
+	)
+}
@@ -0,0 +1,222 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package filebundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/cleanup"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/filebundle"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
+	"github.com/mesosphere/mindthegap/config"
+)
+
+func NewCommand(out output.Output) (cmd *cobra.Command, stopCh chan struct{}) {
+	var (
+		bundleFiles     []string
+		listenAddress   string
+		listenPort      uint16
+		tlsCertificate  string
+		tlsKey          string
+		pidFile         string
+		shutdownTimeout time.Duration
+		verifyChecksums bool
+	)
+
+	stopCh = make(chan struct{})
+
+	cmd = &cobra.Command{
+		Use:   "file-bundle",
+		Short: "Serve files over HTTP from previously created file bundles",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := cmd.ValidateRequiredFlags(); err != nil {
+				return err
+			}
+
+			return flags.ValidateFlagsThatRequireValues(cmd, "file-bundle")
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cleaner := cleanup.NewCleaner()
+			defer cleaner.Cleanup()
+			out.StartOperation("Creating temporary directory")
+			tempDir, err := os.MkdirTemp("", ".file-bundle-*")
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return fmt.Errorf("failed to create temporary directory: %w", err)
+			}
+			cleaner.AddCleanupFn(func() { _ = os.RemoveAll(tempDir) })
+			out.EndOperationWithStatus(output.Success())
+
+			bundleFiles, err = utils.FilesWithGlobs(bundleFiles)
+			if err != nil {
+				return err
+			}
+
+			cfg, err := extractFileBundles(tempDir, out, bundleFiles...)
+			if err != nil {
+				return err
+			}
+
+			filesDir := filepath.Join(tempDir, filebundle.FilesDir)
+			if verifyChecksums {
+				out.StartOperation("Verifying checksums of bundled files")
+				if err := verifyFiles(filesDir, cfg); err != nil {
+					out.EndOperationWithStatus(output.Failure())
+					return err
+				}
+				out.EndOperationWithStatus(output.Success())
+			}
+
+			l, err := net.Listen("tcp", net.JoinHostPort(listenAddress, strconv.Itoa(int(listenPort))))
+			if err != nil {
+				return fmt.Errorf("failed to listen on %s:%d: %w", listenAddress, listenPort, err)
+			}
+			srv := &http.Server{
+				Handler:           http.FileServer(http.Dir(filesDir)),
+				ReadHeaderTimeout: 1 * time.Second,
+			}
+			srvErrCh := make(chan error, 1)
+			go func() {
+				var err error
+				if tlsCertificate != "" && tlsKey != "" {
+					err = srv.ServeTLS(l, tlsCertificate, tlsKey)
+				} else {
+					err = srv.Serve(l)
+				}
+				if errors.Is(err, http.ErrServerClosed) {
+					err = nil
+				}
+				srvErrCh <- err
+			}()
+			out.Infof("Serving %d files on %s\n", len(cfg.Files), l.Addr())
+
+			if pidFile != "" {
+				//nolint:gosec // PID files are meant to be world-readable.
+				if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
+					return fmt.Errorf("failed to write PID file: %w", err)
+				}
+				cleaner.AddCleanupFn(func() { _ = os.Remove(pidFile) })
+			}
+
+			select {
+			case <-stopCh:
+			case <-cmd.Context().Done():
+				// Stopped by SIGTERM, interrupt or timeout.
+				out.Infof("Shutting down: %v\n", context.Cause(cmd.Context()))
+			case err := <-srvErrCh:
+				if err != nil {
+					return fmt.Errorf("error serving files: %w", err)
+				}
+				return nil
+			}
+
+			// Wait for in-flight requests to complete before exiting.
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				return fmt.Errorf("failed to shut down file server gracefully: %w", err)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&bundleFiles, "file-bundle", nil,
+		"File bundle to serve. Can also be a glob pattern.")
+	_ = cmd.MarkFlagRequired("file-bundle")
+	cmd.Flags().StringVar(&listenAddress, "listen-address", "127.0.0.1", "Address to listen on")
+	cmd.Flags().
+		Uint16Var(&listenPort, "listen-port", 0, "Port to listen on (0 means use any free port)")
+	cmd.Flags().StringVar(&tlsCertificate, "tls-cert-file", "", "TLS certificate file")
+	cmd.Flags().StringVar(&tlsKey, "tls-private-key-file", "", "TLS private key file")
+	cmd.Flags().StringVar(&pidFile, "pid-file", "",
+		"File to write the process ID to once the files are served (removed on exit)")
+	cmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second,
+		"Time to wait for in-flight requests to complete when shutting down")
+	cmd.Flags().BoolVar(&verifyChecksums, "verify-checksums", false,
+		"Verify the checksums and sizes of all bundled files before serving them")
+
+	return cmd, stopCh
+}
+
+// extractFileBundles extracts the file bundles to dest, returning the merged config of all bundles.
+func extractFileBundles(
+	dest string,
+	out output.Output,
+	bundleFiles ...string,
+) (*config.FilesConfig, error) {
+	sort.Strings(bundleFiles)
+
+	var filesCfg *config.FilesConfig
+
+	// Just in case users specify the same bundle twice, keep a track of
+	// files that have been extracted already so we only extract each of them once.
+	extractedBundles := make(map[string]struct{}, len(bundleFiles))
+
+	for _, bundleFile := range bundleFiles {
+		if _, ok := extractedBundles[bundleFile]; ok {
+			continue
+		}
+		extractedBundles[bundleFile] = struct{}{}
+
+		out.StartOperation(fmt.Sprintf("Unarchiving file bundle %q", bundleFile))
+		if err := archive.UnarchiveToDirectory(bundleFile, dest); err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, fmt.Errorf("failed to unarchive file bundle: %w", err)
+		}
+		out.EndOperationWithStatus(output.Success())
+
+		out.StartOperation("Parsing file bundle config")
+		cfgFile := filepath.Join(dest, filebundle.FilesConfigFileName)
+		bundleCfg, err := config.ParseFilesConfigFile(cfgFile)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, fmt.Errorf("%q is not a file bundle: %w", bundleFile, err)
+		}
+		// Remove the config so that it is not mistaken for the config of other bundles.
+		if err := os.Remove(cfgFile); err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, fmt.Errorf("failed to remove file bundle config: %w", err)
+		}
+		filesCfg, err = filesCfg.Merge(bundleCfg)
+		if err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return nil, fmt.Errorf("failed to merge file bundle %q: %w", bundleFile, err)
+		}
+		out.EndOperationWithStatus(output.Success())
+	}
+
+	out.V(4).Infof("Merged files config: %+v", filesCfg)
+
+	return filesCfg, nil
+}
+
+// verifyFiles verifies the checksums and sizes of all files in the config, served from dir.
+func verifyFiles(dir string, cfg *config.FilesConfig) error {
+	for _, f := range cfg.Files {
+		servedPath, err := f.ServedPath()
+		if err != nil {
+			return err
+		}
+		if _, err := filebundle.VerifyFile(f, filepath.Join(dir, filepath.FromSlash(servedPath))); err != nil {
+			return fmt.Errorf("bundled file %q is corrupt: %w", servedPath, err)
+		}
+	}
+	return nil
+}
@@ -9,13 +9,14 @@ import (
 	"github.com/mesosphere/dkp-cli-runtime/core/output"
 
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/serve/bundle"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/serve/filebundle"
 	"github.com/mesosphere/mindthegap/cmd/mindthegap/utils"
 )
 
 func NewCommand(out output.Output) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "serve",
-		Short: "Serve image or Helm chart bundles from an OCI registry",
+		Short: "Serve image or Helm chart bundles from an OCI registry, or file bundles over HTTP",
 	}
 
 	imageBundleCmd, _ := bundle.NewCommand(out, "image-bundle")
@@ -31,5 +32,8 @@ func NewCommand(out output.Output) *cobra.Command {
 	bundleCmd, _ := bundle.NewCommand(out, "bundle")
 	cmd.AddCommand(bundleCmd)
 
+	fileBundleCmd, _ := filebundle.NewCommand(out)
+	cmd.AddCommand(fileBundleCmd)
+
 	return cmd
 }
@@ -0,0 +1,22 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package update
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/imagebundle"
+)
+
+func NewCommand(out output.Output) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Update existing bundles in place",
+	}
+
+	cmd.AddCommand(imagebundle.NewUpdateCommand(out))
+	return cmd
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+const (
+	// BundleManifestFileName is the name of the manifest written to the root of bundles containing
+	// multiple parts, e.g. both images and Helm charts.
+	BundleManifestFileName = "bundle.yaml"
+
+	bundleManifestVersion = "v1"
+)
+
+// BundlePartType is the type of contents of a bundle part.
+type BundlePartType string
+
+const (
+	ImagesBundlePart     BundlePartType = "images"
+	HelmChartsBundlePart BundlePartType = "helm-charts"
+)
+
+// BundleManifest describes the parts of a bundle.
+type BundleManifest struct {
+	Version string       `yaml:"version"`
+	Parts   []BundlePart `yaml:"parts"`
+}
+
+// BundlePart describes a part of a bundle: its type, the config file listing its contents and the
+// number of images or Helm chart versions it contains.
+type BundlePart struct {
+	Type   BundlePartType `yaml:"type"`
+	Config string         `yaml:"config"`
+	Count  int            `yaml:"count"`
+}
+
+// WriteBundleManifest writes the manifest describing the images and Helm charts parts of the bundle
+// to dir.
+func WriteBundleManifest(
+	dir string,
+	imagesCfg *config.ImagesConfig,
+	chartsCfg *config.HelmChartsConfig,
+) error {
+	manifest := BundleManifest{Version: bundleManifestVersion}
+	if imagesCfg != nil {
+		manifest.Parts = append(manifest.Parts, BundlePart{
+			Type:   ImagesBundlePart,
+			Config: "images.yaml",
+			Count:  imagesCfg.TotalImages(),
+		})
+	}
+	if chartsCfg != nil {
+		count := 0
+		for _, repoConfig := range chartsCfg.Repositories {
+			for _, versions := range repoConfig.Charts {
+				count += len(versions)
+			}
+		}
+		manifest.Parts = append(manifest.Parts, BundlePart{
+			Type:   HelmChartsBundlePart,
+			Config: "charts.yaml",
+			Count:  count,
+		})
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(manifest); err != nil {
+		return fmt.Errorf("failed to marshal bundle manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, BundleManifestFileName), buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write bundle manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadBundleManifest reads the manifest of the bundle extracted to dir, returning nil if the bundle
+// does not have a manifest.
+func ReadBundleManifest(dir string) (*BundleManifest, error) {
+	b, err := os.ReadFile(filepath.Join(dir, BundleManifestFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle manifest: %w", err)
+	}
+
+	var manifest BundleManifest
+	if err := yaml.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle manifest: %w", err)
+	}
+	if manifest.Version != bundleManifestVersion {
+		return nil, fmt.Errorf(
+			"unsupported bundle manifest version %q, upgrade mindthegap to use this bundle",
+			manifest.Version,
+		)
+	}
+	return &manifest, nil
+}
+
+// Validate checks that the configs of all parts of the bundle extracted to dir exist.
+func (m BundleManifest) Validate(dir string) error {
+	for _, part := range m.Parts {
+		if _, err := os.Stat(filepath.Join(dir, part.Config)); err != nil {
+			return fmt.Errorf("bundle is incomplete, %s config %s is missing: %w", part.Type, part.Config, err)
+		}
+	}
+	return nil
+}
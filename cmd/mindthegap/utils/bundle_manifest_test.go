@@ -0,0 +1,61 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+func TestBundleManifest(t *testing.T) {
+	t.Parallel()
+
+	imagesCfg := config.ImagesConfig{
+		"docker.io": config.RegistrySyncConfig{
+			Images: map[string][]string{"library/nginx": {"1.21.5", "1.25.3"}},
+		},
+	}
+	chartsCfg := config.HelmChartsConfig{
+		Repositories: map[string]config.HelmRepositorySyncConfig{
+			"podinfo": {Charts: map[string][]string{"podinfo": {"6.2.0"}}},
+		},
+	}
+
+	dir := t.TempDir()
+	manifest, err := ReadBundleManifest(dir)
+	require.NoError(t, err)
+	assert.Nil(t, manifest)
+
+	require.NoError(t, WriteBundleManifest(dir, &imagesCfg, &chartsCfg))
+	manifest, err = ReadBundleManifest(dir)
+	require.NoError(t, err)
+	assert.Equal(t, &BundleManifest{
+		Version: "v1",
+		Parts: []BundlePart{
+			{Type: ImagesBundlePart, Config: "images.yaml", Count: 2},
+			{Type: HelmChartsBundlePart, Config: "charts.yaml", Count: 1},
+		},
+	}, manifest)
+
+	require.ErrorContains(t, manifest.Validate(dir), "images config images.yaml is missing")
+	for _, f := range []string{"images.yaml", "charts.yaml"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, f), nil, 0o600))
+	}
+	require.NoError(t, manifest.Validate(dir))
+}
+
+func TestReadBundleManifestUnsupportedVersion(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, BundleManifestFileName), []byte("version: v2\n"), 0o600))
+	_, err := ReadBundleManifest(dir)
+	require.ErrorContains(t, err, `unsupported bundle manifest version "v2"`)
+}
@@ -0,0 +1,185 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/cmd/version"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+const (
+	// BundleMetadataFileName is the name of the metadata file written to the root of bundles, recording
+	// the format version of the bundle and what it contains.
+	BundleMetadataFileName = "bundle.json"
+
+	// BundleFormatVersion is the version of the bundle format written by this version of mindthegap.
+	// Bundles created before bundle.json was introduced are legacy bundles, which are upgraded when
+	// they are read.
+	BundleFormatVersion = 1
+
+	// RegistryBundleLayout is the layout of bundles containing registry storage.
+	RegistryBundleLayout = "registry"
+	// OCIBundleLayout is the layout of bundles containing an OCI image layout.
+	OCIBundleLayout = "oci"
+)
+
+// BundleMetadata describes a bundle.
+type BundleMetadata struct {
+	FormatVersion int                `json:"formatVersion"`
+	Created       BundleCreationInfo `json:"created"`
+	Contents      BundleContents     `json:"contents"`
+}
+
+// BundleCreationInfo records how a bundle was created. It is empty for upgraded legacy bundles.
+type BundleCreationInfo struct {
+	Time              *time.Time `json:"time,omitempty"`
+	MindthegapVersion string     `json:"mindthegapVersion,omitempty"`
+}
+
+// BundleContents is the index of the contents of a bundle.
+type BundleContents struct {
+	Layout string `json:"layout"`
+	// Images are the references of the bundled images, including their source registries.
+	Images []string `json:"images,omitempty"`
+	// HelmCharts are the bundled Helm charts as <repository>/<chart>:<version>, followed by the
+	// bundled chart URLs.
+	HelmCharts []string `json:"helmCharts,omitempty"`
+}
+
+// NewBundleMetadata returns the metadata for a bundle with the layout, created now by this version of
+// mindthegap, that contains the images and Helm charts.
+func NewBundleMetadata(
+	layout string,
+	imagesCfg *config.ImagesConfig,
+	chartsCfg *config.HelmChartsConfig,
+) BundleMetadata {
+	now := time.Now().UTC().Truncate(time.Second)
+	return BundleMetadata{
+		FormatVersion: BundleFormatVersion,
+		Created: BundleCreationInfo{
+			Time:              &now,
+			MindthegapVersion: version.GetVersion().GitVersion,
+		},
+		Contents: bundleContents(layout, imagesCfg, chartsCfg),
+	}
+}
+
+func bundleContents(
+	layout string,
+	imagesCfg *config.ImagesConfig,
+	chartsCfg *config.HelmChartsConfig,
+) BundleContents {
+	contents := BundleContents{Layout: layout}
+	if imagesCfg != nil {
+		for _, registryName := range imagesCfg.SortedRegistryNames() {
+			registryCfg := (*imagesCfg)[registryName]
+			for _, imageName := range registryCfg.SortedImageNames() {
+				for _, tag := range registryCfg.Images[imageName] {
+					separator := ":"
+					if strings.Contains(tag, ":") {
+						separator = "@"
+					}
+					contents.Images = append(
+						contents.Images, registryName+"/"+imageName+separator+tag,
+					)
+				}
+			}
+		}
+	}
+	if chartsCfg != nil {
+		for _, repoName := range chartsCfg.SortedRepositoryNames() {
+			repoCfg := chartsCfg.Repositories[repoName]
+			for _, chartName := range repoCfg.SortedChartNames() {
+				for _, chartVersion := range repoCfg.Charts[chartName] {
+					contents.HelmCharts = append(
+						contents.HelmCharts, fmt.Sprintf("%s/%s:%s", repoName, chartName, chartVersion),
+					)
+				}
+			}
+		}
+		contents.HelmCharts = append(contents.HelmCharts, chartsCfg.ChartURLs...)
+	}
+	return contents
+}
+
+// WriteBundleMetadata writes the metadata of the bundle to dir.
+func WriteBundleMetadata(dir string, metadata BundleMetadata) error {
+	b, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal bundle metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, BundleMetadataFileName), append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write bundle metadata: %w", err)
+	}
+	return nil
+}
+
+// ReadBundleMetadata reads the metadata of the bundle extracted to dir. Legacy bundles without metadata
+// are upgraded on the fly, deriving their metadata from the bundle contents, in which case upgraded is
+// true. Bundles in a newer format than this version of mindthegap supports are rejected.
+func ReadBundleMetadata(dir string) (metadata *BundleMetadata, upgraded bool, err error) {
+	b, err := os.ReadFile(filepath.Join(dir, BundleMetadataFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		metadata, err := legacyBundleMetadata(dir)
+		return metadata, err == nil, err
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read bundle metadata: %w", err)
+	}
+
+	metadata = &BundleMetadata{}
+	if err := json.Unmarshal(b, metadata); err != nil {
+		return nil, false, fmt.Errorf("failed to parse bundle metadata: %w", err)
+	}
+	if metadata.FormatVersion < 1 || metadata.FormatVersion > BundleFormatVersion {
+		return nil, false, fmt.Errorf(
+			"unsupported bundle format version %d, upgrade mindthegap to use this bundle",
+			metadata.FormatVersion,
+		)
+	}
+	return metadata, false, nil
+}
+
+// legacyBundleMetadata derives the metadata of the legacy bundle extracted to dir from its contents.
+func legacyBundleMetadata(dir string) (*BundleMetadata, error) {
+	layout := RegistryBundleLayout
+	if IsOCILayout(dir) {
+		layout = OCIBundleLayout
+	}
+
+	var (
+		imagesCfg *config.ImagesConfig
+		chartsCfg *config.HelmChartsConfig
+	)
+	imagesCfgFile := filepath.Join(dir, "images.yaml")
+	if _, err := os.Lstat(imagesCfgFile); err == nil {
+		cfg, err := config.ParseImagesConfigFile(imagesCfgFile)
+		if err != nil {
+			return nil, err
+		}
+		imagesCfg = &cfg
+	}
+	chartsCfgFile := filepath.Join(dir, "charts.yaml")
+	if _, err := os.Lstat(chartsCfgFile); err == nil {
+		cfg, err := config.ParseHelmChartsConfigFile(chartsCfgFile)
+		if err != nil {
+			return nil, err
+		}
+		chartsCfg = &cfg
+	}
+
+	return &BundleMetadata{
+		FormatVersion: BundleFormatVersion,
+		Contents:      bundleContents(layout, imagesCfg, chartsCfg),
+	}, nil
+}
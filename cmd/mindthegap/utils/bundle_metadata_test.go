@@ -0,0 +1,84 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+func TestBundleMetadata(t *testing.T) {
+	t.Parallel()
+
+	imagesCfg := config.ImagesConfig{
+		"docker.io": config.RegistrySyncConfig{
+			Images: map[string][]string{
+				"library/nginx": {"1.21.5", "sha256:0000000000000000000000000000000000000000000000000000000000000000"},
+			},
+		},
+	}
+	chartsCfg := config.HelmChartsConfig{
+		Repositories: map[string]config.HelmRepositorySyncConfig{
+			"podinfo": {Charts: map[string][]string{"podinfo": {"6.2.0"}}},
+		},
+		ChartURLs: []string{"https://example.com/chart-1.0.0.tgz"},
+	}
+
+	dir := t.TempDir()
+	metadata := NewBundleMetadata(RegistryBundleLayout, &imagesCfg, &chartsCfg)
+	require.NoError(t, WriteBundleMetadata(dir, metadata))
+
+	got, upgraded, err := ReadBundleMetadata(dir)
+	require.NoError(t, err)
+	assert.False(t, upgraded)
+	assert.Equal(t, &metadata, got)
+	assert.NotNil(t, got.Created.Time)
+	assert.Equal(t, BundleContents{
+		Layout: RegistryBundleLayout,
+		Images: []string{
+			"docker.io/library/nginx:1.21.5",
+			"docker.io/library/nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+		},
+		HelmCharts: []string{"podinfo/podinfo:6.2.0", "https://example.com/chart-1.0.0.tgz"},
+	}, got.Contents)
+}
+
+func TestReadBundleMetadataUpgradesLegacyBundles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, config.WriteSanitizedImagesConfig(config.ImagesConfig{
+		"docker.io": config.RegistrySyncConfig{Images: map[string][]string{"library/nginx": {"1.21.5"}}},
+	}, filepath.Join(dir, "images.yaml")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ocispec.ImageLayoutFile), nil, 0o600))
+
+	metadata, upgraded, err := ReadBundleMetadata(dir)
+	require.NoError(t, err)
+	assert.True(t, upgraded)
+	assert.Equal(t, &BundleMetadata{
+		FormatVersion: BundleFormatVersion,
+		Contents: BundleContents{
+			Layout: OCIBundleLayout,
+			Images: []string{"docker.io/library/nginx:1.21.5"},
+		},
+	}, metadata)
+}
+
+func TestReadBundleMetadataUnsupportedVersion(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, BundleMetadataFileName), []byte(`{"formatVersion": 2}`), 0o600,
+	))
+	_, _, err := ReadBundleMetadata(dir)
+	require.EqualError(t, err, "unsupported bundle format version 2, upgrade mindthegap to use this bundle")
+}
@@ -0,0 +1,40 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/signing"
+)
+
+// VerifyBundleSignatures verifies the detached signatures of all bundles, failing if any of them is
+// unsigned or has been modified since it was signed. Nothing is verified if opts is empty.
+func VerifyBundleSignatures(
+	ctx context.Context,
+	out output.Output,
+	opts signing.VerifyOptions,
+	bundleFiles ...string,
+) error {
+	if opts.IsEmpty() {
+		return nil
+	}
+
+	cosign, err := signing.NewCosign()
+	if err != nil {
+		return err
+	}
+	for _, bundleFile := range bundleFiles {
+		out.StartOperation(fmt.Sprintf("Verifying signature of bundle %q", bundleFile))
+		if err := cosign.VerifyBlob(ctx, bundleFile, opts); err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return err
+		}
+		out.EndOperationWithStatus(output.Success())
+	}
+	return nil
+}
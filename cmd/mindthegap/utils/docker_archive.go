@@ -0,0 +1,244 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/images/platform"
+)
+
+// WriteDockerArchive writes all images in cfg, served by the registry at regAddress, to a docker
+// archive at outputFile that can be loaded with `docker load` or `ctr images import`. Docker archives
+// only support a single platform per image, so images are written for the first platform of their
+// index that matches the specified platform, see platform.Platform.Matches. A failed write never
+// leaves a partial archive at outputFile.
+func WriteDockerArchive(
+	ctx context.Context,
+	regAddress string,
+	cfg config.ImagesConfig,
+	p platform.Platform,
+	outputFile string,
+	transport http.RoundTripper,
+) error {
+	archiveImages := map[name.Tag]v1.Image{}
+	err := forEachBundledImage(
+		ctx, regAddress, cfg, transport,
+		func(destImageName string, desc *remote.Descriptor) error {
+			img, err := imageForPlatform(desc, p)
+			if err != nil {
+				return fmt.Errorf("failed to read image %s for platform %s: %w", destImageName, p, err)
+			}
+
+			tag, err := name.NewTag(destImageName, name.StrictValidation)
+			if err != nil {
+				return err
+			}
+
+			archiveImages[tag] = img
+			return nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	tempOutputFile := filepath.Join(filepath.Dir(outputFile), "."+filepath.Base(outputFile))
+	defer os.Remove(tempOutputFile)
+	if err := tarball.MultiWriteToFile(tempOutputFile, archiveImages); err != nil {
+		return fmt.Errorf("failed to write docker archive: %w", err)
+	}
+	if err := os.Rename(tempOutputFile, outputFile); err != nil {
+		return fmt.Errorf("failed to rename temporary archive to output file: %w", err)
+	}
+
+	return nil
+}
+
+// BundlePlatform returns the platform of all images in cfg, served by the registry at regAddress,
+// failing if the images are bundled for more than one platform.
+func BundlePlatform(
+	ctx context.Context,
+	regAddress string,
+	cfg config.ImagesConfig,
+	transport http.RoundTripper,
+) (platform.Platform, error) {
+	platforms := map[string]platform.Platform{}
+	err := forEachBundledImage(
+		ctx, regAddress, cfg, transport,
+		func(destImageName string, desc *remote.Descriptor) error {
+			imagePlatforms, err := descriptorPlatforms(desc)
+			if err != nil {
+				return fmt.Errorf("failed to read platforms of image %s: %w", destImageName, err)
+			}
+			for _, p := range imagePlatforms {
+				platforms[p.Normalized().String()] = p
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return platform.Platform{}, err
+	}
+
+	switch len(platforms) {
+	case 0:
+		return platform.Platform{}, errors.New("no platform found for the images in the bundle")
+	case 1:
+		for _, p := range platforms {
+			return p, nil
+		}
+	}
+	names := make([]string, 0, len(platforms))
+	for n := range platforms {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return platform.Platform{}, fmt.Errorf(
+		"images in the bundle are bundled for multiple platforms (%s)", strings.Join(names, ", "),
+	)
+}
+
+// forEachBundledImage calls fn with the descriptor of every image in cfg, served by the registry at
+// regAddress, and the name the image has been bundled as.
+func forEachBundledImage(
+	ctx context.Context,
+	regAddress string,
+	cfg config.ImagesConfig,
+	transport http.RoundTripper,
+	fn func(destImageName string, desc *remote.Descriptor) error,
+) error {
+	for _, registryName := range cfg.SortedRegistryNames() {
+		registryConfig := cfg[registryName]
+		for _, imageName := range registryConfig.SortedImageNames() {
+			for _, imageTag := range registryConfig.Images[imageName] {
+				srcImageName := fmt.Sprintf("%s/%s:%s", regAddress, imageName, imageTag)
+				destImageName := fmt.Sprintf("%s/%s:%s", registryName, imageName, imageTag)
+
+				ref, err := name.ParseReference(srcImageName, name.StrictValidation)
+				if err != nil {
+					return err
+				}
+
+				desc, err := remote.Get(ref, remote.WithTransport(transport), remote.WithContext(ctx))
+				if err != nil {
+					return fmt.Errorf("failed to read image %s: %w", destImageName, err)
+				}
+				if err := fn(destImageName, desc); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// imageForPlatform returns the image of desc if it is an image for the platform, or the image of the
+// first manifest in its index that matches the platform.
+func imageForPlatform(desc *remote.Descriptor, p platform.Platform) (v1.Image, error) {
+	if !desc.MediaType.IsIndex() {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, err
+		}
+		imgPlatform, err := imagePlatform(img)
+		if err != nil {
+			return nil, err
+		}
+		if !p.Matches(imgPlatform) {
+			return nil, fmt.Errorf("image is for platform %s", platformString(imgPlatform))
+		}
+		return img, nil
+	}
+
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range im.Manifests {
+		if m.MediaType.IsImage() && m.Platform != nil && p.Matches(*m.Platform) {
+			return idx.Image(m.Digest)
+		}
+	}
+	return nil, errors.New("no image found for platform")
+}
+
+// descriptorPlatforms returns the platforms of the image or of the images in the index of desc,
+// ignoring manifests without platform or for the unknown platform, e.g. build attestations.
+func descriptorPlatforms(desc *remote.Descriptor) ([]platform.Platform, error) {
+	var v1Platforms []v1.Platform
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return nil, err
+		}
+		im, err := idx.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range im.Manifests {
+			if m.MediaType.IsImage() && m.Platform != nil {
+				v1Platforms = append(v1Platforms, *m.Platform)
+			}
+		}
+	} else {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, err
+		}
+		p, err := imagePlatform(img)
+		if err != nil {
+			return nil, err
+		}
+		v1Platforms = append(v1Platforms, p)
+	}
+
+	var platforms []platform.Platform
+	for _, v1p := range v1Platforms {
+		if v1p.OS == "" || v1p.OS == "unknown" {
+			continue
+		}
+		p, err := platform.FromV1(v1p)
+		if err != nil {
+			return nil, err
+		}
+		platforms = append(platforms, p)
+	}
+	return platforms, nil
+}
+
+func imagePlatform(img v1.Image) (v1.Platform, error) {
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return v1.Platform{}, err
+	}
+	if p := cf.Platform(); p != nil {
+		return *p, nil
+	}
+	return v1.Platform{}, nil
+}
+
+func platformString(p v1.Platform) string {
+	if fp, err := platform.FromV1(p); err == nil {
+		return fp.String()
+	}
+	return p.OS + "/" + p.Architecture
+}
@@ -4,6 +4,7 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -29,6 +30,9 @@ func ExtractBundles(
 		// This will hold the merged config from all the Helm chart bundles which will be used to import
 		// all the Helm charts from all the bundles.
 		helmChartsCfg *config.HelmChartsConfig
+		// This will hold the merged repository rewrites from all the image bundles, which are written
+		// to dest once all bundles have been extracted.
+		repoRewrites *config.RepoRewrites
 	)
 
 	// Just in case users specify the same bundle twice, keep a track of
@@ -52,6 +56,50 @@ func ExtractBundles(
 		}
 		out.EndOperationWithStatus(output.Success())
 
+		manifest, err := ReadBundleManifest(dest)
+		if err != nil {
+			return nil, nil, err
+		}
+		if manifest != nil {
+			if err := manifest.Validate(dest); err != nil {
+				return nil, nil, err
+			}
+			// Remove the manifest so that it is not mistaken for the manifest of other bundles.
+			if err := os.Remove(filepath.Join(dest, BundleManifestFileName)); err != nil {
+				return nil, nil, fmt.Errorf("failed to remove bundle manifest: %w", err)
+			}
+		}
+
+		metadata, upgraded, err := ReadBundleMetadata(dest)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read image bundle %q: %w", imageBundleFile, err)
+		}
+		if upgraded {
+			out.V(2).Infof(
+				"Image bundle %q has no metadata, upgrading it to format version %d\n",
+				imageBundleFile, BundleFormatVersion,
+			)
+		}
+		// Remove the metadata so that it is not mistaken for the metadata of other bundles.
+		if err := os.Remove(filepath.Join(dest, BundleMetadataFileName)); err != nil &&
+			!errors.Is(err, os.ErrNotExist) {
+			return nil, nil, fmt.Errorf("failed to remove bundle metadata: %w", err)
+		}
+
+		repoRewrites, err = mergeRepoRewrites(dest, repoRewrites)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if metadata.Contents.Layout == OCIBundleLayout {
+			out.StartOperation(fmt.Sprintf("Loading OCI layout from image bundle %q", imageBundleFile))
+			if err := ImportOCILayout(dest); err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return nil, nil, err
+			}
+			out.EndOperationWithStatus(output.Success())
+		}
+
 		imagesCfgFile := filepath.Join(dest, "images.yaml")
 		if _, err := os.Lstat(imagesCfgFile); err == nil {
 			out.StartOperation("Parsing image bundle config")
@@ -81,6 +129,14 @@ func ExtractBundles(
 		}
 	}
 
+	if repoRewrites != nil {
+		if err := config.WriteRepoRewritesFile(
+			*repoRewrites, filepath.Join(dest, RepoRewritesFileName),
+		); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	out.V(4).Infof("Merged images config: %+v", imagesCfg)
 	out.V(4).Infof("Merged Helm charts config: %+v", helmChartsCfg)
 
@@ -0,0 +1,69 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+// registryRepositoriesDir is the directory containing all repositories in registry storage.
+var registryRepositoriesDir = filepath.Join("docker", "registry", "v2", "repositories")
+
+// FilterImagesInRegistryStorage removes the tags of all images that are not selected by the filter
+// from the registry storage in dir, so that they are no longer served, and returns the config of
+// the remaining images. Repositories without any remaining tags are removed entirely, so that none
+// of their manifests or blobs can be pulled by digest either.
+func FilterImagesInRegistryStorage(
+	dir string,
+	cfg config.ImagesConfig,
+	filter config.ImageFilter,
+) (config.ImagesConfig, error) {
+	included, excluded := cfg.Filter(filter)
+
+	// Images from different source registries are stored in the same repository if they have the
+	// same name, so tags are only removed if not included from any source registry.
+	includedTags := map[string]map[string]struct{}{}
+	for _, rsc := range included {
+		for imageName, imageTags := range rsc.Images {
+			if includedTags[imageName] == nil {
+				includedTags[imageName] = map[string]struct{}{}
+			}
+			for _, imageTag := range imageTags {
+				includedTags[imageName][imageTag] = struct{}{}
+			}
+		}
+	}
+
+	for _, rsc := range excluded {
+		for imageName, imageTags := range rsc.Images {
+			repoDir := filepath.Join(dir, registryRepositoriesDir, filepath.FromSlash(imageName))
+			tagsDir := filepath.Join(repoDir, "_manifests", "tags")
+			for _, imageTag := range imageTags {
+				if _, ok := includedTags[imageName][imageTag]; ok {
+					continue
+				}
+				if err := os.RemoveAll(filepath.Join(tagsDir, imageTag)); err != nil {
+					return nil, fmt.Errorf("failed to remove excluded image %s:%s: %w", imageName, imageTag, err)
+				}
+			}
+
+			if len(includedTags[imageName]) > 0 {
+				continue
+			}
+			// Only remove the contents of the repository itself, as nested repositories are stored
+			// in subdirectories of it.
+			for _, d := range []string{"_manifests", "_layers", "_uploads"} {
+				if err := os.RemoveAll(filepath.Join(repoDir, d)); err != nil {
+					return nil, fmt.Errorf("failed to remove excluded repository %s: %w", imageName, err)
+				}
+			}
+		}
+	}
+
+	return included, nil
+}
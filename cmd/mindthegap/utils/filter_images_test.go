@@ -0,0 +1,105 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/docker/registry"
+)
+
+func TestFilterImagesInRegistryStorage(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cfg := config.ImagesConfig{
+		"docker.io": config.RegistrySyncConfig{
+			Images: map[string][]string{
+				"library/nginx":        {"1", "2"},
+				"library/nginx/nested": {"1"},
+			},
+		},
+		"nvcr.io": config.RegistrySyncConfig{
+			Images: map[string][]string{
+				"nvidia/cuda": {"12"},
+			},
+		},
+	}
+
+	startRegistry := func(readOnly bool) (string, context.CancelFunc) {
+		reg, err := registry.NewRegistry(registry.Config{StorageDirectory: dir, ReadOnly: readOnly})
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		_, err = reg.Start(ctx)
+		require.NoError(t, err)
+		return reg.Address(), cancel
+	}
+
+	addr, stopReg := startRegistry(false)
+	cudaImg, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	for _, rsc := range cfg {
+		for imageName, imageTags := range rsc.Images {
+			for _, imageTag := range imageTags {
+				img := cudaImg
+				if imageName != "nvidia/cuda" {
+					img, err = random.Image(1024, 1)
+					require.NoError(t, err)
+				}
+				ref, err := name.NewTag(fmt.Sprintf("%s/%s:%s", addr, imageName, imageTag))
+				require.NoError(t, err)
+				require.NoError(t, remote.Write(ref, img))
+			}
+		}
+	}
+	stopReg()
+
+	remaining, err := FilterImagesInRegistryStorage(dir, cfg, config.ImageFilter{
+		Exclude: []string{"nvcr.io/*/*", "docker.io/library/nginx:2"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, config.ImagesConfig{
+		"docker.io": config.RegistrySyncConfig{
+			Images: map[string][]string{
+				"library/nginx":        {"1"},
+				"library/nginx/nested": {"1"},
+			},
+		},
+	}, remaining)
+
+	addr, _ = startRegistry(true)
+	for image, wantFound := range map[string]bool{
+		"library/nginx:1":        true,
+		"library/nginx:2":        false,
+		"library/nginx/nested:1": true,
+		"nvidia/cuda:12":         false,
+	} {
+		ref, err := name.ParseReference(fmt.Sprintf("%s/%s", addr, image))
+		require.NoError(t, err)
+		_, err = remote.Head(ref)
+		if wantFound {
+			assert.NoError(t, err, image)
+		} else {
+			assert.Error(t, err, image)
+		}
+	}
+
+	// Excluded repositories are removed entirely, so that their images cannot be pulled by digest.
+	cudaDigest, err := cudaImg.Digest()
+	require.NoError(t, err)
+	ref, err := name.ParseReference(fmt.Sprintf("%s/nvidia/cuda@%s", addr, cudaDigest))
+	require.NoError(t, err)
+	_, err = remote.Head(ref)
+	assert.Error(t, err)
+}
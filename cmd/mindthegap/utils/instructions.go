@@ -0,0 +1,169 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+// InstructionsFileName is the name of the file written to the root of every bundle, describing how
+// to use the bundle for anyone who only receives the bundle tarball.
+const InstructionsFileName = "INSTRUCTIONS.txt"
+
+var instructionsTemplate = template.Must(template.New("").Parse(
+	`This is a mindthegap bundle ({{ .BundleFile }}) for use in air-gapped environments.
+{{- if .Images }}
+
+It contains {{ .TotalImages }} container image(s) from the following registries:
+{{ range .Images }}
+  {{ .Registry }}
+{{- range .Images }}
+    {{ . }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- if .Charts }}
+
+It contains {{ .TotalCharts }} Helm chart version(s):
+{{ range .Charts }}
+  {{ . }}
+{{- end }}
+{{- end }}
+
+Serving the bundle
+==================
+
+Start a read-only OCI registry serving the contents of the bundle on port 5000:
+
+  mindthegap serve bundle --bundle {{ .BundleFile }} --listen-address 0.0.0.0 --listen-port 5000
+{{- if .ExampleImage }}
+
+Images are served without their source registry, e.g.
+
+  {{ .ExampleImage.Source }} is served as <host>:5000/{{ .ExampleImage.Path }}
+{{- end }}
+{{- if .ExampleChart }}
+
+Helm charts are served under the charts repository, e.g.
+
+  helm pull oci://<host>:5000/charts/{{ .ExampleChart.Name }} --version {{ .ExampleChart.Version }}
+{{- end }}
+
+Pushing the bundle to an existing registry
+==========================================
+
+  mindthegap push bundle --bundle {{ .BundleFile }} --to-registry <registry.address>
+{{- if .ExampleImage }}
+
+Images are pushed without their source registry, e.g.
+
+  {{ .ExampleImage.Source }} is pushed to <registry.address>/{{ .ExampleImage.Path }}
+{{- end }}
+{{- if .ExampleChart }}
+
+Helm charts are pushed to the root of the registry, e.g.
+
+  helm pull oci://<registry.address>/{{ .ExampleChart.Name }} --version {{ .ExampleChart.Version }}
+{{- end }}
+{{- if .Images }}
+
+Importing the images into containerd
+====================================
+
+  mindthegap import image-bundle --image-bundle {{ .BundleFile }} --containerd-namespace k8s.io
+{{- end }}
+
+Run any of these commands with --help for all available options.
+`,
+))
+
+type instructionsRegistry struct {
+	Registry string
+	Images   []string
+}
+
+type instructionsExampleImage struct {
+	Source string
+	Path   string
+}
+
+type instructionsExampleChart struct {
+	Name    string
+	Version string
+}
+
+// WriteBundleInstructions writes instructions on how to serve, push and import the bundle, with
+// examples derived from the bundle contents, to dir.
+func WriteBundleInstructions(
+	dir, bundleFile string,
+	imagesCfg *config.ImagesConfig,
+	chartsCfg *config.HelmChartsConfig,
+) error {
+	data := struct {
+		BundleFile   string
+		Images       []instructionsRegistry
+		TotalImages  int
+		Charts       []string
+		TotalCharts  int
+		ExampleImage *instructionsExampleImage
+		ExampleChart *instructionsExampleChart
+	}{
+		BundleFile: filepath.Base(bundleFile),
+	}
+
+	if imagesCfg != nil {
+		for _, registryName := range imagesCfg.SortedRegistryNames() {
+			registryConfig := (*imagesCfg)[registryName]
+			reg := instructionsRegistry{Registry: registryName}
+			for _, imageName := range registryConfig.SortedImageNames() {
+				for _, tag := range registryConfig.Images[imageName] {
+					reg.Images = append(reg.Images, fmt.Sprintf("%s:%s", imageName, tag))
+					if data.ExampleImage == nil {
+						data.ExampleImage = &instructionsExampleImage{
+							Source: fmt.Sprintf("%s/%s:%s", registryName, imageName, tag),
+							Path:   fmt.Sprintf("%s:%s", imageName, tag),
+						}
+					}
+				}
+			}
+			if len(reg.Images) == 0 {
+				continue
+			}
+			data.TotalImages += len(reg.Images)
+			data.Images = append(data.Images, reg)
+		}
+	}
+
+	if chartsCfg != nil {
+		for _, repoName := range chartsCfg.SortedRepositoryNames() {
+			repoConfig := chartsCfg.Repositories[repoName]
+			for _, chartName := range repoConfig.SortedChartNames() {
+				for _, version := range repoConfig.Charts[chartName] {
+					data.Charts = append(data.Charts, fmt.Sprintf("%s:%s", chartName, version))
+					if data.ExampleChart == nil {
+						data.ExampleChart = &instructionsExampleChart{Name: chartName, Version: version}
+					}
+				}
+			}
+		}
+		data.TotalCharts = len(data.Charts)
+	}
+
+	f, err := os.Create(filepath.Join(dir, InstructionsFileName))
+	if err != nil {
+		return fmt.Errorf("failed to create bundle instructions file: %w", err)
+	}
+	defer f.Close()
+
+	if err := instructionsTemplate.Execute(f, data); err != nil {
+		return fmt.Errorf("failed to write bundle instructions: %w", err)
+	}
+
+	return nil
+}
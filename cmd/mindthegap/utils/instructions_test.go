@@ -0,0 +1,71 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+func TestWriteBundleInstructions(t *testing.T) {
+	t.Parallel()
+
+	imagesCfg := config.ImagesConfig{
+		"docker.io": config.RegistrySyncConfig{
+			Images: map[string][]string{
+				"library/nginx":   {"1.21.5"},
+				"library/busybox": {"1.36"},
+			},
+		},
+	}
+
+	dir := t.TempDir()
+	require.NoError(
+		t,
+		WriteBundleInstructions(dir, filepath.Join("some", "dir", "images.tar"), &imagesCfg, nil),
+	)
+
+	b, err := os.ReadFile(filepath.Join(dir, InstructionsFileName))
+	require.NoError(t, err)
+	instructions := string(b)
+
+	assert.Contains(t, instructions, "It contains 2 container image(s)")
+	assert.Contains(t, instructions, "    library/busybox:1.36\n    library/nginx:1.21.5\n")
+	assert.Contains(t, instructions, "mindthegap serve bundle --bundle images.tar")
+	assert.Contains(
+		t,
+		instructions,
+		"docker.io/library/busybox:1.36 is pushed to <registry.address>/library/busybox:1.36",
+	)
+	assert.Contains(t, instructions, "mindthegap import image-bundle --image-bundle images.tar")
+	assert.NotContains(t, instructions, "Helm chart")
+}
+
+func TestWriteBundleInstructionsHelmCharts(t *testing.T) {
+	t.Parallel()
+
+	chartsCfg := config.HelmChartsConfig{
+		Repositories: map[string]config.HelmRepositorySyncConfig{
+			"podinfo": {Charts: map[string][]string{"podinfo": {"6.2.0"}}},
+		},
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, WriteBundleInstructions(dir, "charts.tar", nil, &chartsCfg))
+
+	b, err := os.ReadFile(filepath.Join(dir, InstructionsFileName))
+	require.NoError(t, err)
+	instructions := string(b)
+
+	assert.Contains(t, instructions, "It contains 1 Helm chart version(s)")
+	assert.Contains(t, instructions, "helm pull oci://<host>:5000/charts/podinfo --version 6.2.0")
+	assert.NotContains(t, instructions, "container image")
+	assert.NotContains(t, instructions, "import image-bundle")
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// NotationTrustPolicyFile is the path of the Notation trust policy in a bundle.
+	NotationTrustPolicyFile = "notation/trustpolicy.json"
+	// NotationTrustStoreDir is the path of the Notation trust store in a bundle.
+	NotationTrustStoreDir = "notation/truststore"
+)
+
+// WriteNotationTrustPolicy copies the Notation trust policy and trust store into the bundle
+// directory, so that signatures can be verified with the same trust policy when pushing the bundle.
+func WriteNotationTrustPolicy(bundleDir, trustPolicyFile, trustStoreDir string) error {
+	policyDest := filepath.Join(bundleDir, NotationTrustPolicyFile)
+	if err := os.MkdirAll(filepath.Dir(policyDest), 0o755); err != nil {
+		return fmt.Errorf("failed to create Notation directory in bundle: %w", err)
+	}
+	if err := CopyFile(trustPolicyFile, policyDest); err != nil {
+		return fmt.Errorf("failed to copy Notation trust policy to bundle: %w", err)
+	}
+
+	storeDest := filepath.Join(bundleDir, NotationTrustStoreDir)
+	err := filepath.WalkDir(trustStoreDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(trustStoreDir, path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(filepath.Join(storeDest, rel), 0o755)
+		case d.Type().IsRegular():
+			return CopyFile(path, filepath.Join(storeDest, rel))
+		default:
+			// Certificates are only read from regular files, so nothing else needs to be bundled.
+			return nil
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy Notation trust store to bundle: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/mesosphere/mindthegap/docker/registry"
+)
+
+// ociLayoutFiles are the files and directories that make up an OCI image layout.
+var ociLayoutFiles = []string{ocispec.ImageLayoutFile, "index.json", ocispec.ImageBlobsDir}
+
+// IsOCILayout returns true if dir contains an OCI image layout.
+func IsOCILayout(dir string) bool {
+	_, err := os.Lstat(filepath.Join(dir, ocispec.ImageLayoutFile))
+	return err == nil
+}
+
+// OCILayoutRefName returns the value of the ref name annotation for an image in an OCI layout
+// bundle. The full image name, including source registry, is used so that bundles can be loaded
+// without any other metadata.
+func OCILayoutRefName(registryName, imageName, imageTag string) string {
+	return fmt.Sprintf("%s/%s:%s", registryName, imageName, imageTag)
+}
+
+func parseOCILayoutRefName(refName string) (imageName, imageTag string, err error) {
+	_, imageRef, found := strings.Cut(refName, "/")
+	if found {
+		idx := strings.LastIndex(imageRef, ":")
+		if idx > 0 {
+			return imageRef[:idx], imageRef[idx+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf(
+		"invalid image reference %q in OCI layout (required format: <registry>/<image>:<tag>)",
+		refName,
+	)
+}
+
+// ImportOCILayout loads all images from the OCI image layout in dir into registry storage in the
+// same directory, so that bundles in the portable OCI layout are served and pushed in exactly the
+// same way as bundles containing registry storage. The OCI layout is removed once imported.
+func ImportOCILayout(dir string) (err error) {
+	p, err := layout.FromPath(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read OCI layout: %w", err)
+	}
+	index, err := p.ImageIndex()
+	if err != nil {
+		return fmt.Errorf("failed to read OCI layout index: %w", err)
+	}
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return fmt.Errorf("failed to read OCI layout index: %w", err)
+	}
+
+	reg, err := registry.NewRegistry(registry.Config{StorageDirectory: dir})
+	if err != nil {
+		return fmt.Errorf("failed to create local Docker registry: %w", err)
+	}
+	regCtx, stopReg := context.WithCancel(context.Background())
+	regErrCh, err := reg.Start(regCtx)
+	if err != nil {
+		stopReg()
+		return fmt.Errorf("failed to start local Docker registry: %w", err)
+	}
+	defer func() {
+		stopReg()
+		for regErr := range regErrCh {
+			err = errors.Join(err, regErr)
+		}
+	}()
+
+	for _, desc := range indexManifest.Manifests {
+		refName := desc.Annotations[ocispec.AnnotationRefName]
+		imageName, imageTag, err := parseOCILayoutRefName(refName)
+		if err != nil {
+			return err
+		}
+		ref, err := name.NewTag(
+			fmt.Sprintf("%s/%s:%s", reg.Address(), imageName, imageTag),
+			name.StrictValidation,
+		)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case desc.MediaType.IsIndex():
+			ii, err := index.ImageIndex(desc.Digest)
+			if err != nil {
+				return fmt.Errorf("failed to read %s from OCI layout: %w", refName, err)
+			}
+			if err := remote.WriteIndex(ref, ii); err != nil {
+				return fmt.Errorf("failed to load %s from OCI layout: %w", refName, err)
+			}
+		case desc.MediaType.IsImage():
+			img, err := index.Image(desc.Digest)
+			if err != nil {
+				return fmt.Errorf("failed to read %s from OCI layout: %w", refName, err)
+			}
+			if err := remote.Write(ref, img); err != nil {
+				return fmt.Errorf("failed to load %s from OCI layout: %w", refName, err)
+			}
+		default:
+			return fmt.Errorf("unexpected media type %q for %s in OCI layout", desc.MediaType, refName)
+		}
+	}
+
+	for _, f := range ociLayoutFiles {
+		if err := os.RemoveAll(filepath.Join(dir, f)); err != nil {
+			return fmt.Errorf("failed to remove imported OCI layout: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/docker/registry"
+)
+
+func TestImportOCILayout(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img})
+
+	p, err := layout.Write(dir, empty.Index)
+	require.NoError(t, err)
+	require.NoError(t, p.AppendIndex(idx, layout.WithAnnotations(map[string]string{
+		ocispec.AnnotationRefName: OCILayoutRefName("docker.io", "library/nginx", "1.21.5"),
+	})))
+	require.True(t, IsOCILayout(dir))
+
+	require.NoError(t, ImportOCILayout(dir))
+
+	assert.False(t, IsOCILayout(dir))
+	for _, f := range ociLayoutFiles {
+		assert.NoFileExists(t, filepath.Join(dir, f))
+	}
+	_, err = os.Stat(filepath.Join(dir, "docker", "registry", "v2"))
+	require.NoError(t, err)
+
+	reg, err := registry.NewRegistry(registry.Config{StorageDirectory: dir, ReadOnly: true})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+
+	ref, err := name.ParseReference(fmt.Sprintf("%s/library/nginx:1.21.5", reg.Address()))
+	require.NoError(t, err)
+	desc, err := remote.Get(ref)
+	require.NoError(t, err)
+
+	wantDigest, err := idx.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, wantDigest, desc.Digest)
+}
+
+func TestParseOCILayoutRefName(t *testing.T) {
+	t.Parallel()
+
+	imageName, imageTag, err := parseOCILayoutRefName("localhost:5000/library/nginx:1.21.5")
+	require.NoError(t, err)
+	assert.Equal(t, "library/nginx", imageName)
+	assert.Equal(t, "1.21.5", imageTag)
+
+	_, _, err = parseOCILayoutRefName("1.21.5")
+	require.ErrorContains(t, err, "invalid image reference")
+}
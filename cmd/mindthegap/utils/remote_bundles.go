@@ -0,0 +1,214 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/cleanup"
+	"github.com/mesosphere/mindthegap/download"
+	"github.com/mesosphere/mindthegap/images/httputils"
+	"github.com/mesosphere/mindthegap/signing"
+)
+
+// remoteBundleChecksumParam is the query parameter of remote bundle URLs specifying the expected
+// checksum of the bundle, in the format <algorithm>:<hex>, which is not sent to the server.
+const remoteBundleChecksumParam = "checksum"
+
+// RemoteBundleOptions configures how bundles specified as HTTP(S) URLs are downloaded.
+type RemoteBundleOptions struct {
+	// CacheDir is the directory to download bundles to, reusing bundles downloaded by previous runs
+	// if they have not changed. Bundles are downloaded to a temporary directory if not set.
+	CacheDir              string
+	CACertificateFile     string
+	InsecureSkipTLSVerify bool
+	// Retries is the number of times to resume downloads after transient errors.
+	Retries int
+}
+
+// Validate checks that the options are consistent.
+func (o RemoteBundleOptions) Validate() error {
+	if o.CACertificateFile != "" && o.InsecureSkipTLSVerify {
+		return errors.New(
+			"--bundle-download-ca-cert-file cannot be combined with --bundle-download-insecure-skip-tls-verify",
+		)
+	}
+	if o.Retries < 0 {
+		return fmt.Errorf("invalid --bundle-download-retries %d: must not be negative", o.Retries)
+	}
+	return nil
+}
+
+// IsRemoteBundle returns true if the bundle is specified as an HTTP(S) URL rather than a file.
+func IsRemoteBundle(bundle string) bool {
+	return strings.HasPrefix(bundle, "http://") || strings.HasPrefix(bundle, "https://")
+}
+
+// DownloadRemoteBundles downloads the bundles specified as HTTP(S) URLs, returning the bundles with
+// the URLs replaced by the downloaded files. Other bundles, e.g. files and globs, are returned as is.
+//
+// Downloads are resumed after transient errors and across runs if the bundle has not changed on the
+// server. Bundles are verified against the checksum in the checksum query parameter of their URL, if
+// set, e.g. https://example.com/images.tar?checksum=sha256:<hex>. The parts of bundles split into
+// parts are downloaded from next to the bundle and verified against the digests in the bundle. The
+// detached signatures of bundles are downloaded from <URL>.sigstore.json if withSignatures is true.
+func DownloadRemoteBundles(
+	ctx context.Context,
+	out output.Output,
+	opts RemoteBundleOptions,
+	withSignatures bool,
+	cleaner cleanup.Cleaner,
+	bundles ...string,
+) ([]string, error) {
+	var (
+		resolved = make([]string, 0, len(bundles))
+		cacheDir = opts.CacheDir
+	)
+	for _, bundle := range bundles {
+		if !IsRemoteBundle(bundle) {
+			resolved = append(resolved, bundle)
+			continue
+		}
+
+		if cacheDir == "" {
+			tempDir, err := os.MkdirTemp("", ".bundle-downloads-*")
+			if err != nil {
+				return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+			}
+			cleaner.AddCleanupFn(func() { _ = os.RemoveAll(tempDir) })
+			cacheDir = tempDir
+		}
+
+		bundleFile, err := downloadRemoteBundle(ctx, out, opts, cacheDir, bundle, withSignatures)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, bundleFile)
+	}
+	return resolved, nil
+}
+
+// downloadRemoteBundle downloads the bundle to a directory in cacheDir that is unique to its URL,
+// keeping the file name of the bundle so that the names of its parts and signature match.
+func downloadRemoteBundle(
+	ctx context.Context,
+	out output.Output,
+	opts RemoteBundleOptions,
+	cacheDir, bundle string,
+	withSignatures bool,
+) (string, error) {
+	u, checksum, err := parseRemoteBundleURL(bundle)
+	if err != nil {
+		return "", err
+	}
+	client, err := downloadClient(u.Host, opts)
+	if err != nil {
+		return "", err
+	}
+	fetchFile := func(u *url.URL, dst, checksum string) error {
+		_, err := download.File(ctx, u, dst, download.Options{
+			Checksum:  checksum,
+			Retries:   opts.Retries,
+			Client:    client,
+			UserAgent: Useragent(),
+		})
+		return err
+	}
+
+	// Credentials in the URL do not identify the bundle.
+	key := *u
+	key.User = nil
+	keyHash := sha256.Sum256([]byte(key.String()))
+	dir := filepath.Join(cacheDir, hex.EncodeToString(keyHash[:8]))
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		name = "bundle.tar"
+	}
+	bundleFile := filepath.Join(dir, name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create bundle download directory: %w", err)
+	}
+
+	out.StartOperation(fmt.Sprintf("Downloading bundle %q", u.Redacted()))
+	if err := fetchFile(u, bundleFile, checksum); err != nil {
+		out.EndOperationWithStatus(output.Failure())
+		return "", err
+	}
+
+	index, err := archive.ReadSplitIndex(bundleFile)
+	if err != nil {
+		out.EndOperationWithStatus(output.Failure())
+		return "", err
+	}
+	if index != nil {
+		for _, part := range index.Parts {
+			partFile := filepath.Join(dir, part.Name)
+			if filepath.Dir(partFile) != dir || partFile == bundleFile {
+				out.EndOperationWithStatus(output.Failure())
+				return "", fmt.Errorf("illegal part name %q in split archive index of bundle", part.Name)
+			}
+			partURL := u.ResolveReference(&url.URL{Path: part.Name})
+			partURL.RawQuery = u.RawQuery
+			if err := fetchFile(partURL, partFile, part.Digest); err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return "", err
+			}
+		}
+	}
+
+	if withSignatures {
+		sigURL := *u
+		sigURL.Path, sigURL.RawPath = signing.SignatureFile(u.Path), ""
+		if err := fetchFile(&sigURL, signing.SignatureFile(bundleFile), ""); err != nil {
+			out.EndOperationWithStatus(output.Failure())
+			return "", fmt.Errorf("failed to download signature of bundle: %w", err)
+		}
+	}
+	out.EndOperationWithStatus(output.Success())
+
+	return bundleFile, nil
+}
+
+// parseRemoteBundleURL parses the URL of a remote bundle, returning the URL without the checksum
+// query parameter and the checksum.
+func parseRemoteBundleURL(bundle string) (*url.URL, string, error) {
+	u, err := url.Parse(bundle)
+	if err != nil || u.Host == "" {
+		return nil, "", fmt.Errorf("invalid bundle URL %q", bundle)
+	}
+	q := u.Query()
+	checksum := q.Get(remoteBundleChecksumParam)
+	if checksum != "" {
+		q.Del(remoteBundleChecksumParam)
+		u.RawQuery = q.Encode()
+		if err := download.ValidateChecksum(checksum); err != nil {
+			return nil, "", fmt.Errorf("invalid checksum of bundle %q: %w", u.Redacted(), err)
+		}
+	}
+	return u, checksum, nil
+}
+
+func downloadClient(host string, opts RemoteBundleOptions) (*http.Client, error) {
+	tr, err := httputils.TLSConfiguredRoundTripper(
+		remote.DefaultTransport, host, opts.InsecureSkipTLSVerify, opts.CACertificateFile, 0,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure TLS for downloading bundles: %w", err)
+	}
+	return &http.Client{Transport: tr}, nil
+}
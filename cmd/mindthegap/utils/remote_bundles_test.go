@@ -0,0 +1,115 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/cleanup"
+)
+
+func TestDownloadRemoteBundles(t *testing.T) {
+	t.Parallel()
+
+	contentDir := t.TempDir()
+	content := make([]byte, 3000)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(contentDir, "content"), content, 0o644))
+
+	serverDir := t.TempDir()
+	require.NoError(t, archive.ArchiveDirectoryWithOptions(
+		contentDir, filepath.Join(serverDir, "images.tar"), archive.Options{SplitSize: 1024},
+	))
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "images.tar.sigstore.json"), []byte("{}"), 0o644))
+	index, err := os.ReadFile(filepath.Join(serverDir, "images.tar"))
+	require.NoError(t, err)
+	checksum := sha256.Sum256(index)
+
+	var requests atomic.Int32
+	fileServer := http.FileServer(http.Dir(serverDir))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fileServer.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	cacheDir := t.TempDir()
+	bundles := []string{
+		"local/*.tar",
+		srv.URL + "/images.tar?checksum=sha256:" + hex.EncodeToString(checksum[:]),
+	}
+	opts := RemoteBundleOptions{CacheDir: cacheDir}
+	cleaner := cleanup.NewCleaner()
+	defer cleaner.Cleanup()
+
+	resolved, err := DownloadRemoteBundles(
+		context.Background(), output.NewDiscardingOutput(), opts, true, cleaner, bundles...,
+	)
+	require.NoError(t, err)
+	require.Len(t, resolved, 2)
+	assert.Equal(t, "local/*.tar", resolved[0])
+	assert.True(t, strings.HasPrefix(resolved[1], cacheDir))
+	assert.Equal(t, "images.tar", filepath.Base(resolved[1]))
+	assert.FileExists(t, resolved[1]+".sigstore.json")
+
+	untarDir := t.TempDir()
+	require.NoError(t, archive.UnarchiveToDirectory(resolved[1], untarDir))
+	untarred, err := os.ReadFile(filepath.Join(untarDir, "content"))
+	require.NoError(t, err)
+	assert.Equal(t, content, untarred)
+
+	// Bundles and parts that match their checksums are reused without requests to the server.
+	requests.Store(0)
+	cachedResolved, err := DownloadRemoteBundles(
+		context.Background(), output.NewDiscardingOutput(), opts, false, cleaner, bundles...,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, resolved, cachedResolved)
+	assert.Zero(t, requests.Load())
+
+	_, err = DownloadRemoteBundles(
+		context.Background(), output.NewDiscardingOutput(), opts, false, cleaner,
+		srv.URL+"/images.tar?checksum=sha256:"+strings.Repeat("0", 64),
+	)
+	require.ErrorContains(t, err, "does not match")
+}
+
+func TestDownloadRemoteBundlesIllegalPartName(t *testing.T) {
+	t.Parallel()
+
+	var partRequests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bundles/images.tar" {
+			partRequests.Add(1)
+		}
+		_, _ = w.Write([]byte("kind: SplitArchive\nversion: v1\nsize: 1\nparts:\n- name: ..\n  size: 1\n"))
+	}))
+	defer srv.Close()
+
+	cacheDir := t.TempDir()
+	cleaner := cleanup.NewCleaner()
+	defer cleaner.Cleanup()
+	_, err := DownloadRemoteBundles(
+		context.Background(), output.NewDiscardingOutput(), RemoteBundleOptions{CacheDir: cacheDir}, false, cleaner,
+		srv.URL+"/bundles/images.tar",
+	)
+	require.ErrorContains(t, err, `illegal part name ".."`)
+	assert.Zero(t, partRequests.Load(), "parts should not be downloaded")
+}
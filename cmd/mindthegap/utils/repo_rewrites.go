@@ -0,0 +1,52 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+// RepoRewritesFileName is the name of the file in a bundle recording the repositories its images are
+// pushed to, if repository rewrite rules were applied when creating the bundle.
+const RepoRewritesFileName = "repo-rewrites.yaml"
+
+// ReadRepoRewrites returns the repository rewrites in the bundle directory, or nil if the bundle does
+// not contain any.
+func ReadRepoRewrites(bundleDir string) (*config.RepoRewrites, error) {
+	rewrites, err := config.ParseRepoRewritesFile(filepath.Join(bundleDir, RepoRewritesFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rewrites, nil
+}
+
+// mergeRepoRewrites merges the repository rewrites of the bundle just extracted to dest into merged,
+// removing them from dest so that they are not mistaken for the rewrites of other bundles.
+func mergeRepoRewrites(dest string, merged *config.RepoRewrites) (*config.RepoRewrites, error) {
+	rewrites, err := ReadRepoRewrites(dest)
+	if err != nil || rewrites == nil {
+		return merged, err
+	}
+	if err := os.Remove(filepath.Join(dest, RepoRewritesFileName)); err != nil {
+		return nil, fmt.Errorf("failed to remove repository rewrites: %w", err)
+	}
+	if merged == nil {
+		return rewrites, nil
+	}
+
+	m, err := merged.Merge(*rewrites)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge repository rewrites of bundles: %w", err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+// storageStateFileName is the name of the file recording which bundles have been extracted into a
+// persistent storage directory.
+const storageStateFileName = ".mindthegap-storage.yaml"
+
+// StorageState describes the contents of a persistent storage directory: the checksums of the
+// bundles extracted into it and the filter that was applied to their images.
+type StorageState struct {
+	BundleChecksums []string           `yaml:"bundleChecksums"`
+	ImageFilter     config.ImageFilter `yaml:"imageFilter,omitempty"`
+}
+
+// NewStorageState returns the state of a storage directory that the bundles have been extracted
+// into and filtered with the filter, calculating the checksums of the bundles.
+func NewStorageState(bundleFiles []string, filter config.ImageFilter) (StorageState, error) {
+	state := StorageState{ImageFilter: filter}
+	seen := make(map[string]struct{}, len(bundleFiles))
+	for _, bundleFile := range bundleFiles {
+		checksum, err := fileChecksum(bundleFile)
+		if err != nil {
+			return StorageState{}, fmt.Errorf("failed to calculate checksum of bundle %s: %w", bundleFile, err)
+		}
+		if _, ok := seen[checksum]; ok {
+			continue
+		}
+		seen[checksum] = struct{}{}
+		state.BundleChecksums = append(state.BundleChecksums, checksum)
+	}
+	sort.Strings(state.BundleChecksums)
+	return state, nil
+}
+
+func fileChecksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// PrepareStorageDir returns true if the persistent storage directory already contains the
+// extracted bundles described by the state. Otherwise the contents of the directory are removed so
+// that the bundles can be extracted into it, which is only allowed if the directory is empty or has
+// previously been populated from bundles, so that other directories are never emptied by mistake.
+func PrepareStorageDir(dir string, state StorageState) (bool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return false, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, fmt.Errorf("failed to read storage directory: %w", err)
+	}
+	if len(entries) == 0 {
+		return false, nil
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, storageStateFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf(
+			"storage directory %s is not empty and has not been populated from bundles, specify an empty directory",
+			dir,
+		)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read storage directory state: %w", err)
+	}
+	var existing StorageState
+	if err := yaml.Unmarshal(b, &existing); err == nil && reflect.DeepEqual(existing, state) {
+		return true, nil
+	}
+
+	// Remove the state first, so that the directory is not considered to be populated if removing
+	// its contents or extracting the bundles is interrupted.
+	if err := os.Remove(filepath.Join(dir, storageStateFileName)); err != nil {
+		return false, fmt.Errorf("failed to remove storage directory state: %w", err)
+	}
+	for _, e := range entries {
+		if e.Name() == storageStateFileName {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return false, fmt.Errorf("failed to clear storage directory: %w", err)
+		}
+	}
+	return false, nil
+}
+
+// WriteStorageState records that the persistent storage directory has been populated as described
+// by the state.
+func WriteStorageState(dir string, state StorageState) error {
+	b, err := yaml.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal storage directory state: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, storageStateFileName), b, 0o644); err != nil {
+		return fmt.Errorf("failed to write storage directory state: %w", err)
+	}
+	return nil
+}
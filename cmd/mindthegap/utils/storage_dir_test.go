@@ -0,0 +1,65 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+func TestStorageDir(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	bundleA := filepath.Join(tmpDir, "a.tar")
+	bundleB := filepath.Join(tmpDir, "b.tar")
+	require.NoError(t, os.WriteFile(bundleA, []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(bundleB, []byte("b"), 0o644))
+
+	state, err := NewStorageState([]string{bundleB, bundleA, bundleA}, config.ImageFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"sha256:3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d",
+		"sha256:ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb",
+	}, state.BundleChecksums)
+
+	storageDir := filepath.Join(tmpDir, "storage")
+	populated, err := PrepareStorageDir(storageDir, state)
+	require.NoError(t, err)
+	assert.False(t, populated)
+	require.NoError(t, os.WriteFile(filepath.Join(storageDir, "images.yaml"), []byte("{}"), 0o644))
+	require.NoError(t, WriteStorageState(storageDir, state))
+
+	populated, err = PrepareStorageDir(storageDir, state)
+	require.NoError(t, err)
+	assert.True(t, populated)
+	assert.FileExists(t, filepath.Join(storageDir, "images.yaml"))
+
+	// A different filter requires extracting the bundles again.
+	filtered, err := NewStorageState([]string{bundleA, bundleB}, config.ImageFilter{Exclude: []string{"docker.io/*"}})
+	require.NoError(t, err)
+	populated, err = PrepareStorageDir(storageDir, filtered)
+	require.NoError(t, err)
+	assert.False(t, populated)
+	entries, err := os.ReadDir(storageDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestPrepareStorageDirNotPopulatedFromBundles(t *testing.T) {
+	t.Parallel()
+
+	storageDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(storageDir, "data"), []byte("data"), 0o644))
+
+	_, err := PrepareStorageDir(storageDir, StorageState{})
+	require.ErrorContains(t, err, "has not been populated from bundles")
+	assert.FileExists(t, filepath.Join(storageDir, "data"))
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package imagesfile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/thediveo/enumflag/v2"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/create/imagebundle"
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/flags"
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/images/authnhelpers"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+type outputFormat enumflag.Flag
+
+const (
+	Table outputFormat = iota
+	JSON
+)
+
+var outputFormats = map[outputFormat][]string{
+	Table: {"table"},
+	JSON:  {"json"},
+}
+
+func NewCommand(out output.Output) *cobra.Command {
+	var (
+		configFile         string
+		format             = Table
+		concurrency        int
+		checkTimeout       time.Duration
+		registryAuthFile   string
+		credentialOpts     authnhelpers.CredentialOptions
+		clockSkewTolerance time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "images-file",
+		Short: "Check that the images of an images file can be pulled, without pulling them",
+		Long: "Parse an images file and check that every source registry resolves, accepts connections and " +
+			"TLS, and accepts its credentials, and that every image exists, reporting the results as a table or " +
+			"JSON. No temporary registry is started and no images are pulled, so that typos and expired " +
+			"credentials are caught before creating a bundle",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := cmd.ValidateRequiredFlags(); err != nil {
+				return err
+			}
+
+			if err := flags.ValidateFlagsThatRequireValues(cmd, "images-file"); err != nil {
+				return err
+			}
+
+			if concurrency < 1 {
+				return errors.New("--concurrency must be at least 1")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := warnings.NewCollector(false)
+
+			out.StartOperation("Parsing image bundle config")
+			cfg, err := config.ParseImagesConfigFileWithWarnings(configFile, w)
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return err
+			}
+			out.EndOperationWithStatus(output.Success())
+			for _, warning := range w.Warnings() {
+				out.Warn(warning.String())
+			}
+
+			out.StartOperation(fmt.Sprintf(
+				"Checking %d registries and %d images", len(cfg), cfg.TotalImages(),
+			))
+			checks, err := imagebundle.Preflight(cmd.Context(), cfg, imagebundle.PreflightOptions{
+				RegistryAuthFile:   registryAuthFile,
+				Credentials:        credentialOpts,
+				ClockSkewTolerance: clockSkewTolerance,
+				Concurrency:        concurrency,
+				Timeout:            checkTimeout,
+			})
+			if err != nil {
+				out.EndOperationWithStatus(output.Failure())
+				return err
+			}
+			failed := 0
+			for _, check := range checks {
+				if check.Status == imagebundle.PreflightFailed {
+					failed++
+				}
+			}
+			if failed > 0 {
+				out.EndOperationWithStatus(output.Failure())
+			} else {
+				out.EndOperationWithStatus(output.Success())
+			}
+
+			switch format {
+			case JSON:
+				err = writeJSON(cmd.OutOrStdout(), checks)
+			default:
+				err = writeTable(cmd.OutOrStdout(), checks)
+			}
+			if err != nil {
+				return err
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d pre-flight checks failed", failed, len(checks))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&configFile, "images-file", "",
+		"File containing list of images to check, either as YAML configuration or a simple list of images")
+	_ = cmd.MarkFlagRequired("images-file")
+	cmd.Flags().Var(
+		enumflag.New(&format, "string", outputFormats, enumflag.EnumCaseSensitive),
+		"output",
+		`format to report the results of the checks in: one of "table" or "json"`,
+	)
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "Number of images to check concurrently")
+	cmd.Flags().DurationVar(&checkTimeout, "check-timeout", 30*time.Second,
+		"Timeout for every single check, e.g. connecting to a registry (0 means no timeout)")
+	flags.AddRegistryAuthFileFlag(cmd.Flags(), &registryAuthFile)
+	flags.AddRegistryCredentialFlags(cmd.Flags(), &credentialOpts)
+	flags.AddClockSkewToleranceFlag(cmd.Flags(), &clockSkewTolerance)
+
+	return cmd
+}
+
+func writeJSON(w io.Writer, checks []imagebundle.PreflightCheck) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(checks)
+}
+
+func writeTable(w io.Writer, checks []imagebundle.PreflightCheck) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REGISTRY\tIMAGE\tCHECK\tSTATUS\tMESSAGE")
+	for _, check := range checks {
+		image := check.Image
+		if image == "" {
+			image = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", check.Registry, image, check.Check, check.Status, check.Message)
+	}
+	return tw.Flush()
+}
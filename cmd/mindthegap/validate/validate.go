@@ -0,0 +1,23 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package validate
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+
+	"github.com/mesosphere/mindthegap/cmd/mindthegap/validate/imagesfile"
+)
+
+func NewCommand(out output.Output) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "validate",
+		Aliases: []string{"preflight"},
+		Short:   "Check configuration before running long operations",
+	}
+
+	cmd.AddCommand(imagesfile.NewCommand(out))
+	return cmd
+}
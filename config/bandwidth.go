@@ -0,0 +1,53 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var bandwidthPrefixes = map[string]float64{
+	"K": 1e3,
+	"k": 1e3,
+	"M": 1e6,
+	"G": 1e9,
+}
+
+// ParseBandwidth parses a bandwidth in bits per second, e.g. 50Mbps, or bytes per second, e.g.
+// 5MBps, with an optional decimal K, M or G prefix, returning the bandwidth in bytes per second.
+func ParseBandwidth(s string) (int64, error) {
+	var (
+		number      string
+		bitsPerUnit float64
+	)
+	switch {
+	case strings.HasSuffix(s, "bps"):
+		number, bitsPerUnit = strings.TrimSuffix(s, "bps"), 1
+	case strings.HasSuffix(s, "Bps"):
+		number, bitsPerUnit = strings.TrimSuffix(s, "Bps"), 8
+	default:
+		return 0, fmt.Errorf(
+			"invalid bandwidth %q: must be in bits or bytes per second, e.g. 50Mbps or 5MBps", s,
+		)
+	}
+
+	multiplier := 1.0
+	if n := len(number); n > 0 {
+		if m, ok := bandwidthPrefixes[number[n-1:]]; ok {
+			number, multiplier = number[:n-1], m
+		}
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q: must be a positive number, e.g. 50Mbps or 5MBps", s)
+	}
+
+	bytesPerSecond := int64(value * multiplier * bitsPerUnit / 8)
+	if bytesPerSecond < 1 {
+		return 0, fmt.Errorf("invalid bandwidth %q: must be at least 1 byte per second", s)
+	}
+	return bytesPerSecond, nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr string
+	}{{
+		in:   "50Mbps",
+		want: 6_250_000,
+	}, {
+		in:   "5MBps",
+		want: 5_000_000,
+	}, {
+		in:   "1.5Gbps",
+		want: 187_500_000,
+	}, {
+		in:   "800kbps",
+		want: 100_000,
+	}, {
+		in:   "1024Bps",
+		want: 1024,
+	}, {
+		in:      "50M",
+		wantErr: "must be in bits or bytes per second",
+	}, {
+		in:      "-5Mbps",
+		wantErr: "must be a positive number",
+	}, {
+		in:      "Mbps",
+		wantErr: "must be a positive number",
+	}, {
+		in:      "4bps",
+		wantErr: "must be at least 1 byte per second",
+	}}
+	for ti := range tests {
+		tt := tests[ti]
+		t.Run(tt.in, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseBandwidth(tt.in)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
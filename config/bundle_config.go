@@ -0,0 +1,74 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+// BundleConfig contains images and Helm charts to bundle together, read from the source YAML file.
+type BundleConfig struct {
+	// Images to bundle, in any of the YAML images config formats, if set.
+	Images *ImagesConfig
+	// HelmCharts to bundle, if set.
+	HelmCharts *HelmChartsConfig
+}
+
+type bundleConfigFile struct {
+	Images     yaml.Node         `yaml:"images,omitempty"`
+	HelmCharts *HelmChartsConfig `yaml:"helmCharts,omitempty"`
+}
+
+// ParseBundleConfigFileWithWarnings parses a bundle config file, containing an images config under
+// `images` and a Helm charts config under `helmCharts`, see ParseImagesConfigFileWithWarnings and
+// ParseHelmChartsConfigFile.
+func ParseBundleConfigFileWithWarnings(configFile string, w *warnings.Collector) (BundleConfig, error) {
+	b, err := os.ReadFile(configFile)
+	if err != nil {
+		return BundleConfig{}, fmt.Errorf("failed to read bundle config file: %w", err)
+	}
+
+	var cfgFile bundleConfigFile
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfgFile); err != nil {
+		return BundleConfig{}, fmt.Errorf("failed to parse bundle config file: %w", err)
+	}
+
+	var cfg BundleConfig
+	if !cfgFile.Images.IsZero() {
+		if cfgFile.Images.Kind != yaml.MappingNode {
+			return BundleConfig{}, errors.New("failed to parse bundle config file: images must be a mapping")
+		}
+		imagesYAML, err := yaml.Marshal(&cfgFile.Images)
+		if err != nil {
+			return BundleConfig{}, fmt.Errorf("failed to parse bundle config file: %w", err)
+		}
+		imagesCfg, err := parseImagesConfig(imagesYAML, filepath.Dir(configFile), w)
+		if err != nil {
+			return BundleConfig{}, fmt.Errorf("invalid images: %w", err)
+		}
+		cfg.Images = &imagesCfg
+	}
+	if cfgFile.HelmCharts != nil {
+		cfg.HelmCharts = cfgFile.HelmCharts
+		if cfg.HelmCharts.Repositories == nil {
+			cfg.HelmCharts.Repositories = map[string]HelmRepositorySyncConfig{}
+		}
+	}
+
+	if cfg.Images == nil && cfg.HelmCharts == nil {
+		return BundleConfig{}, errors.New("bundle config file does not contain any images or Helm charts")
+	}
+
+	return cfg, nil
+}
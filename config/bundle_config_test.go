@@ -0,0 +1,77 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/images/platform"
+)
+
+func TestParseBundleConfigFile(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseBundleConfigFileWithWarnings(filepath.Join("testdata", "bundle", "bundle.yaml"), nil)
+	require.NoError(t, err)
+	require.NotNil(t, cfg.Images)
+	assert.Equal(t, ImagesConfig{
+		"docker.io": RegistrySyncConfig{
+			Images:    map[string][]string{"library/nginx": {"1.21.5"}},
+			Platforms: []platform.Platform{platform.MustParse("linux/amd64")},
+		},
+	}, *cfg.Images)
+	require.NotNil(t, cfg.HelmCharts)
+	assert.Equal(t, HelmChartsConfig{
+		Repositories: map[string]HelmRepositorySyncConfig{
+			"podinfo": {
+				RepoURL: "https://stefanprodan.github.io/podinfo",
+				Charts:  map[string][]string{"podinfo": {"6.2.0"}},
+			},
+		},
+	}, *cfg.HelmCharts)
+
+	cfg, err = ParseBundleConfigFileWithWarnings(filepath.Join("testdata", "bundle", "images_only.yaml"), nil)
+	require.NoError(t, err)
+	require.NotNil(t, cfg.Images)
+	assert.Equal(t, 1, cfg.Images.TotalImages())
+	assert.Nil(t, cfg.HelmCharts)
+}
+
+func TestParseBundleConfigFileInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{{
+		name:    "empty",
+		content: "helmCharts: null\n",
+		wantErr: "does not contain any images or Helm charts",
+	}, {
+		name:    "unknown field",
+		content: "charts: {}\n",
+		wantErr: "field charts not found",
+	}, {
+		name:    "images list",
+		content: "images:\n  - nginx\n",
+		wantErr: "images must be a mapping",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			configFile := filepath.Join(t.TempDir(), "bundle.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(tt.content), 0o600))
+			_, err := ParseBundleConfigFileWithWarnings(configFile, nil)
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
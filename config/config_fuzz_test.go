@@ -0,0 +1,114 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addTestdataSeeds adds the contents of all files in the testdata directory to the seed corpus.
+func addTestdataSeeds(f *testing.F, dir string) {
+	f.Helper()
+	entries, err := os.ReadDir(filepath.Join("testdata", dir))
+	require.NoError(f, err)
+	for _, e := range entries {
+		b, err := os.ReadFile(filepath.Join("testdata", dir, e.Name()))
+		require.NoError(f, err)
+		f.Add(b)
+	}
+}
+
+// FuzzParseImagesConfig checks that arbitrary images config files in any format either fail to parse
+// or parse to a config that round-trips through the sanitized config written to bundles.
+func FuzzParseImagesConfig(f *testing.F) {
+	addTestdataSeeds(f, "images")
+	addTestdataSeeds(f, "imagesv2")
+	f.Add([]byte("version: v2\nregistries: {a: {images: {b: {tags: [c], platforms: [linux/amd64]}}}}"))
+	f.Add([]byte("nginx\nnginx@sha256:" + strings.Repeat("a", 64) + "\n"))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		if bytes.Contains(b, []byte("credentialsFile")) {
+			// Credentials files are read from the local filesystem, which is out of scope.
+			t.Skip()
+		}
+
+		cfg, err := parseImagesConfig(b, t.TempDir(), nil)
+		if err != nil {
+			return
+		}
+
+		dir := t.TempDir()
+		written := filepath.Join(dir, "images.yaml")
+		require.NoError(t, WriteSanitizedImagesConfig(cfg, written))
+		reparsed, err := ParseImagesConfigFile(written)
+		require.NoError(t, err, "sanitized config cannot be parsed")
+
+		rewritten := filepath.Join(dir, "images2.yaml")
+		require.NoError(t, WriteSanitizedImagesConfig(reparsed, rewritten))
+		writtenBytes, err := os.ReadFile(written)
+		require.NoError(t, err)
+		rewrittenBytes, err := os.ReadFile(rewritten)
+		require.NoError(t, err)
+		assert.Equal(t, string(writtenBytes), string(rewrittenBytes), "sanitized config does not round-trip")
+		assert.Equal(t, cfg.TotalImages(), reparsed.TotalImages())
+	})
+}
+
+// FuzzParseHelmChartsConfigFile checks that arbitrary Helm charts config files either fail to parse
+// or parse to a config that can be merged and written.
+func FuzzParseHelmChartsConfigFile(f *testing.F) {
+	addTestdataSeeds(f, "helmcharts")
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		configFile := filepath.Join(t.TempDir(), "charts.yaml")
+		require.NoError(t, os.WriteFile(configFile, b, 0o600))
+
+		cfg, err := ParseHelmChartsConfigFile(configFile)
+		if err != nil {
+			return
+		}
+		merged := (&HelmChartsConfig{}).Merge(cfg)
+		require.NoError(t, WriteSanitizedHelmChartsConfig(*merged, configFile))
+		_, err = ParseHelmChartsConfigFile(configFile)
+		require.NoError(t, err, "sanitized config cannot be parsed")
+	})
+}
+
+// FuzzParseFilesConfigFile checks that files in valid files configs are always served at relative
+// paths within the served directory.
+func FuzzParseFilesConfigFile(f *testing.F) {
+	addTestdataSeeds(f, "files")
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		configFile := filepath.Join(t.TempDir(), "files.yaml")
+		require.NoError(t, os.WriteFile(configFile, b, 0o600))
+
+		cfg, err := ParseFilesConfigFile(configFile)
+		if err != nil {
+			return
+		}
+		for _, file := range cfg.Files {
+			p, err := file.ServedPath()
+			require.NoError(t, err)
+			assert.NotEmpty(t, p)
+			assert.False(t, path.IsAbs(p), "file %q served at absolute path %q", file.URL, p)
+			for _, elem := range strings.Split(p, "/") {
+				assert.NotEqual(t, "..", elem, "file %q served outside of served directory at %q", file.URL, p)
+			}
+		}
+
+		require.NoError(t, WriteFilesConfig(cfg, configFile))
+		reparsed, err := ParseFilesConfigFile(configFile)
+		require.NoError(t, err, "written config cannot be parsed")
+		assert.Len(t, reparsed.Files, len(cfg.Files))
+	})
+}
@@ -0,0 +1,181 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// supportedFileChecksumLengths maps the supported checksum algorithms to the length of their hex
+// encoded checksums.
+var supportedFileChecksumLengths = map[string]int{
+	"sha256": 64,
+	"sha512": 128,
+}
+
+// FileConfig contains information about a single file to bundle, read from the source YAML file.
+type FileConfig struct {
+	// URL is the http(s) URL to download the file from.
+	URL string `yaml:"url"`
+	// Checksum is the expected checksum of the file, in the format <algorithm>:<hex>, e.g.
+	// sha256:0123...
+	Checksum string `yaml:"checksum"`
+	// Path is the path to serve the file at. Defaults to the path of the URL, so that the original
+	// path layout is preserved.
+	Path string `yaml:"path,omitempty"`
+	// Size is the expected size of the file in bytes, verified when downloading the file if set. It
+	// is always recorded in file bundles, so that consumers can verify files without downloading them
+	// completely.
+	Size int64 `yaml:"size,omitempty"`
+}
+
+// ServedPath returns the cleaned path, without leading slash, to serve the file at.
+func (c FileConfig) ServedPath() (string, error) {
+	p := c.Path
+	if p == "" {
+		u, err := url.Parse(c.URL)
+		if err != nil {
+			return "", fmt.Errorf("invalid file URL %q: %w", c.URL, err)
+		}
+		p = u.Path
+	}
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return "", fmt.Errorf("no path to serve file %q at: specify path", c.URL)
+	}
+	return p, nil
+}
+
+func (c FileConfig) validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid file URL %q: %w", c.URL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid file URL %q: must be an http or https URL", c.URL)
+	}
+
+	algorithm, checksum, _ := strings.Cut(c.Checksum, ":")
+	length, ok := supportedFileChecksumLengths[algorithm]
+	if !ok {
+		return fmt.Errorf(
+			"invalid checksum %q for file %q: must be in the format sha256:<hex> or sha512:<hex>",
+			c.Checksum,
+			c.URL,
+		)
+	}
+	if _, err := hex.DecodeString(checksum); err != nil || len(checksum) != length {
+		return fmt.Errorf("invalid %s checksum %q for file %q", algorithm, checksum, c.URL)
+	}
+
+	if c.Size < 0 {
+		return fmt.Errorf("invalid size %d for file %q: must not be negative", c.Size, c.URL)
+	}
+
+	_, err = c.ServedPath()
+	return err
+}
+
+// FilesConfig contains all files information read from the source YAML file.
+type FilesConfig struct {
+	Files []FileConfig `yaml:"files"`
+}
+
+// Validate checks that all files have a valid URL and checksum and are served at distinct paths.
+func (c FilesConfig) Validate() error {
+	paths := make(map[string]string, len(c.Files))
+	for _, f := range c.Files {
+		if err := f.validate(); err != nil {
+			return err
+		}
+		p, _ := f.ServedPath()
+		if otherURL, ok := paths[p]; ok {
+			return fmt.Errorf("files %q and %q are both served at path %q: specify path", otherURL, f.URL, p)
+		}
+		paths[p] = f.URL
+	}
+	return nil
+}
+
+// Merge merges the files of cfg into c, returning an error if different files are served at the same
+// path.
+func (c *FilesConfig) Merge(cfg FilesConfig) (*FilesConfig, error) {
+	if c == nil {
+		return &cfg, nil
+	}
+
+	byPath := make(map[string]FileConfig, len(c.Files)+len(cfg.Files))
+	for _, f := range append(append([]FileConfig{}, c.Files...), cfg.Files...) {
+		p, err := f.ServedPath()
+		if err != nil {
+			return nil, err
+		}
+		if existing, ok := byPath[p]; ok {
+			if existing.Checksum != f.Checksum {
+				return nil, fmt.Errorf("different files are served at path %q", p)
+			}
+			if f.Size == 0 {
+				f.Size = existing.Size
+			}
+		}
+		byPath[p] = f
+	}
+
+	merged := &FilesConfig{Files: make([]FileConfig, 0, len(byPath))}
+	for _, f := range byPath {
+		merged.Files = append(merged.Files, f)
+	}
+	sort.Slice(merged.Files, func(i, j int) bool {
+		pi, _ := merged.Files[i].ServedPath()
+		pj, _ := merged.Files[j].ServedPath()
+		return pi < pj
+	})
+	return merged, nil
+}
+
+func ParseFilesConfigFile(configFile string) (FilesConfig, error) {
+	f, err := os.Open(configFile)
+	if err != nil {
+		return FilesConfig{}, fmt.Errorf("failed to read files config file: %w", err)
+	}
+	defer f.Close()
+
+	var (
+		config FilesConfig
+		dec    = yaml.NewDecoder(f)
+	)
+	dec.KnownFields(true)
+	if err := dec.Decode(&config); err != nil {
+		return FilesConfig{}, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return FilesConfig{}, fmt.Errorf("invalid files config: %w", err)
+	}
+
+	return config, nil
+}
+
+// WriteFilesConfig writes the config with the path each file is served at set explicitly.
+func WriteFilesConfig(cfg FilesConfig, fileName string) error {
+	files := make([]FileConfig, 0, len(cfg.Files))
+	for _, f := range cfg.Files {
+		p, err := f.ServedPath()
+		if err != nil {
+			return err
+		}
+		f.Path = p
+		files = append(files, f)
+	}
+	cfg.Files = files
+
+	return writeYAMLToFile(cfg, fileName)
+}
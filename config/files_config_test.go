@@ -0,0 +1,115 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testChecksum = "sha256:" + strings.Repeat("a", 64)
+
+func TestParseFilesConfigFile(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		want    FilesConfig
+		wantErr string
+	}{{
+		name: "valid",
+		want: FilesConfig{Files: []FileConfig{{
+			URL:      "https://dl.k8s.io/release/v1.28.0/bin/linux/amd64/kubeadm",
+			Checksum: testChecksum,
+		}, {
+			URL:      "https://example.com/download?file=install.sh",
+			Checksum: "sha512:" + strings.Repeat("a", 128),
+			Path:     "scripts/install.sh",
+			Size:     1024,
+		}}},
+	}, {
+		name:    "duplicate paths",
+		wantErr: `both served at path "v1/install.sh"`,
+	}, {
+		name:    "invalid checksum",
+		wantErr: "must be in the format sha256:<hex> or sha512:<hex>",
+	}, {
+		name:    "invalid url",
+		wantErr: "must be an http or https URL",
+	}, {
+		name:    "no path",
+		wantErr: "no path to serve file",
+	}, {
+		name:    "negative size",
+		wantErr: "must not be negative",
+	}}
+	for ti := range tests {
+		tt := tests[ti]
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseFilesConfigFile(
+				filepath.Join("testdata", "files", strings.ReplaceAll(tt.name, " ", "_")+".yaml"),
+			)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFileConfigServedPath(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		cfg  FileConfig
+		want string
+	}{{
+		name: "URL path",
+		cfg:  FileConfig{URL: "https://example.com/a/b/c.tar.gz?x=y"},
+		want: "a/b/c.tar.gz",
+	}, {
+		name: "explicit path",
+		cfg:  FileConfig{URL: "https://example.com/a/b/c.tar.gz", Path: "/d/./e.tar.gz"},
+		want: "d/e.tar.gz",
+	}, {
+		name: "path outside of root",
+		cfg:  FileConfig{URL: "https://example.com/a", Path: "../../etc/passwd"},
+		want: "etc/passwd",
+	}}
+	for ti := range tests {
+		tt := tests[ti]
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := tt.cfg.ServedPath()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMergeFilesConfig(t *testing.T) {
+	t.Parallel()
+
+	a := FileConfig{URL: "https://example.com/a", Checksum: testChecksum}
+	b := FileConfig{URL: "https://example.com/b", Checksum: testChecksum}
+
+	var nilCfg *FilesConfig
+	merged, err := nilCfg.Merge(FilesConfig{Files: []FileConfig{b}})
+	require.NoError(t, err)
+	merged, err = merged.Merge(FilesConfig{Files: []FileConfig{b, a}})
+	require.NoError(t, err)
+	assert.Equal(t, &FilesConfig{Files: []FileConfig{a, b}}, merged)
+
+	_, err = merged.Merge(FilesConfig{Files: []FileConfig{{
+		URL:      "https://example.org/a",
+		Checksum: "sha256:" + strings.Repeat("b", 64),
+	}}})
+	require.ErrorContains(t, err, `different files are served at path "a"`)
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"path"
+)
+
+// ImageFilter selects images by glob patterns, see path.Match. Patterns are matched against both
+// <registry>/<image> and <registry>/<image>:<tag>, so that e.g. `nvcr.io/nvidia/*` matches all tags
+// of all images in the nvcr.io/nvidia namespace. Note that `*` does not match `/`.
+type ImageFilter struct {
+	// Include selects only images matching any of the patterns if not empty.
+	Include []string
+	// Exclude deselects images matching any of the patterns, taking precedence over Include.
+	Exclude []string
+}
+
+// Validate returns an error if any pattern is malformed.
+func (f ImageFilter) Validate() error {
+	for _, pattern := range append(append([]string(nil), f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid image pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// IsEmpty returns true if the filter selects all images.
+func (f ImageFilter) IsEmpty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0
+}
+
+// Matches returns true if the filter selects the image.
+func (f ImageFilter) Matches(registryName, imageName, imageTag string) bool {
+	repository := registryName + "/" + imageName
+	image := repository + ":" + imageTag
+	if len(f.Include) > 0 && !matchesAny(f.Include, repository, image) {
+		return false
+	}
+	return !matchesAny(f.Exclude, repository, image)
+}
+
+func matchesAny(patterns []string, names ...string) bool {
+	for _, pattern := range patterns {
+		for _, name := range names {
+			// Patterns have already been validated.
+			if matched, _ := path.Match(pattern, name); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Filter splits the config into the images that are selected by the filter and those that are not.
+// Registries without any images are omitted from either config.
+func (ic ImagesConfig) Filter(f ImageFilter) (included, excluded ImagesConfig) {
+	included, excluded = ImagesConfig{}, ImagesConfig{}
+	for registryName, rsc := range ic {
+		includedImages := map[string][]string{}
+		excludedImages := map[string][]string{}
+		for imageName, imageTags := range rsc.Images {
+			for _, imageTag := range imageTags {
+				if f.Matches(registryName, imageName, imageTag) {
+					includedImages[imageName] = append(includedImages[imageName], imageTag)
+				} else {
+					excludedImages[imageName] = append(excludedImages[imageName], imageTag)
+				}
+			}
+		}
+
+		if len(includedImages) > 0 {
+			includedRSC := rsc.Clone()
+			includedRSC.Images = includedImages
+			included[registryName] = includedRSC
+		}
+		if len(excludedImages) > 0 {
+			excludedRSC := rsc.Clone()
+			excludedRSC.Images = excludedImages
+			excluded[registryName] = excludedRSC
+		}
+	}
+	return included, excluded
+}
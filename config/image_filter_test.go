@@ -0,0 +1,114 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageFilterMatches(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		filter ImageFilter
+		image  [3]string
+		want   bool
+	}{{
+		name:  "empty filter",
+		image: [3]string{"docker.io", "library/nginx", "1.21.5"},
+		want:  true,
+	}, {
+		name:   "included repository",
+		filter: ImageFilter{Include: []string{"docker.io/library/*"}},
+		image:  [3]string{"docker.io", "library/nginx", "1.21.5"},
+		want:   true,
+	}, {
+		name:   "not included",
+		filter: ImageFilter{Include: []string{"quay.io/*/*"}},
+		image:  [3]string{"docker.io", "library/nginx", "1.21.5"},
+		want:   false,
+	}, {
+		name:   "included tag",
+		filter: ImageFilter{Include: []string{"docker.io/library/nginx:1.21.*"}},
+		image:  [3]string{"docker.io", "library/nginx", "1.21.5"},
+		want:   true,
+	}, {
+		name:   "star does not match slash",
+		filter: ImageFilter{Include: []string{"docker.io/*"}},
+		image:  [3]string{"docker.io", "library/nginx", "1.21.5"},
+		want:   false,
+	}, {
+		name:   "excluded",
+		filter: ImageFilter{Exclude: []string{"nvcr.io/nvidia/*"}},
+		image:  [3]string{"nvcr.io", "nvidia/cuda", "12.2.0"},
+		want:   false,
+	}, {
+		name: "exclude takes precedence over include",
+		filter: ImageFilter{
+			Include: []string{"nvcr.io/nvidia/*"},
+			Exclude: []string{"nvcr.io/nvidia/cuda:*"},
+		},
+		image: [3]string{"nvcr.io", "nvidia/cuda", "12.2.0"},
+		want:  false,
+	}}
+	for ti := range tests {
+		tt := tests[ti]
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.NoError(t, tt.filter.Validate())
+			assert.Equal(t, tt.want, tt.filter.Matches(tt.image[0], tt.image[1], tt.image[2]))
+		})
+	}
+}
+
+func TestImageFilterValidate(t *testing.T) {
+	t.Parallel()
+	assert.ErrorContains(
+		t,
+		ImageFilter{Exclude: []string{"docker.io/[nginx"}}.Validate(),
+		`invalid image pattern "docker.io/[nginx"`,
+	)
+}
+
+func TestImagesConfigFilter(t *testing.T) {
+	t.Parallel()
+	cfg := ImagesConfig{
+		"docker.io": RegistrySyncConfig{
+			Images: map[string][]string{
+				"library/nginx": {"1.21.5", "1.22.0"},
+			},
+		},
+		"nvcr.io": RegistrySyncConfig{
+			Images: map[string][]string{
+				"nvidia/cuda": {"12.2.0"},
+			},
+		},
+	}
+
+	included, excluded := cfg.Filter(ImageFilter{
+		Exclude: []string{"nvcr.io/*/*", "docker.io/library/nginx:1.22.0"},
+	})
+	assert.Equal(t, ImagesConfig{
+		"docker.io": RegistrySyncConfig{
+			Images: map[string][]string{
+				"library/nginx": {"1.21.5"},
+			},
+		},
+	}, included)
+	assert.Equal(t, ImagesConfig{
+		"docker.io": RegistrySyncConfig{
+			Images: map[string][]string{
+				"library/nginx": {"1.22.0"},
+			},
+		},
+		"nvcr.io": RegistrySyncConfig{
+			Images: map[string][]string{
+				"nvidia/cuda": {"12.2.0"},
+			},
+		},
+	}, excluded)
+}
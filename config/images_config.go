@@ -5,9 +5,10 @@ package config
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
-	"io"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -15,6 +16,9 @@ import (
 	"github.com/distribution/distribution/v3/reference"
 	"gopkg.in/yaml.v3"
 	"k8s.io/utils/ptr"
+
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/warnings"
 )
 
 // RegistrySyncConfig contains information about a single registry, read from
@@ -26,6 +30,71 @@ type RegistrySyncConfig struct {
 	TLSVerify *bool `yaml:"tlsVerify,omitempty"`
 	// Username and password used to authenticate with the registry
 	Credentials *types.DockerAuthConfig `yaml:"credentials,omitempty"`
+	// Proxy is the URL of the proxy to pull images from the registry via, or DirectProxy to bypass the
+	// proxies configured by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables, which are
+	// used otherwise
+	Proxy string `yaml:"proxy,omitempty"`
+	// Platforms to bundle images from this registry for, from the registry or global defaults
+	// (only supported in v2 config files)
+	Platforms []platform.Platform `yaml:"-"`
+	// ImagePlatforms overrides the platforms to bundle for individual images, keyed by image name
+	// (only supported in v2 config files)
+	ImagePlatforms map[string][]platform.Platform `yaml:"-"`
+	// ImageMaxSizes limits the size in bytes of every tag of individual images, keyed by image name
+	// (only supported in v2 config files)
+	ImageMaxSizes map[string]int64 `yaml:"-"`
+	// ImageArtifacts marks individual images, keyed by image name, as OCI artifacts that are copied
+	// exactly as stored in the registry, with all of their platforms. OCI artifacts are otherwise
+	// detected by their media types (only supported in v2 config files)
+	ImageArtifacts map[string]bool `yaml:"-"`
+	// MaxRequestsPerSecond limits the rate of requests to the registry instead of the global limit
+	// if set (only supported in v2 config files)
+	MaxRequestsPerSecond float64 `yaml:"-"`
+	// MaxBandwidth limits the bandwidth of pulling from the registry in bytes per second instead of
+	// the global limit if set (only supported in v2 config files)
+	MaxBandwidth int64 `yaml:"-"`
+	// Annotations to add to every image from this registry, from the registry or global defaults
+	// (only supported in v2 config files)
+	Annotations map[string]string `yaml:"-"`
+	// ImageAnnotations adds to and overrides Annotations for individual images, keyed by image name
+	// (only supported in v2 config files)
+	ImageAnnotations map[string]map[string]string `yaml:"-"`
+}
+
+// PlatformsForImage returns the platforms to bundle for the image. Platforms configured for the
+// image itself always take precedence, followed by explicitly requested platforms, then platforms
+// configured for the registry, falling back to the (default) requested platforms.
+func (rsc RegistrySyncConfig) PlatformsForImage(
+	imageName string,
+	requested []platform.Platform,
+	requestedExplicitly bool,
+) []platform.Platform {
+	if imagePlatforms, ok := rsc.ImagePlatforms[imageName]; ok {
+		return imagePlatforms
+	}
+	if !requestedExplicitly && len(rsc.Platforms) > 0 {
+		return rsc.Platforms
+	}
+	return requested
+}
+
+// AnnotationsForImage returns the annotations to add to the image: the requested annotations,
+// overridden by the annotations configured for the registry, overridden in turn by the annotations
+// configured for the image itself. Nil is returned if there are no annotations.
+func (rsc RegistrySyncConfig) AnnotationsForImage(
+	imageName string,
+	requested map[string]string,
+) map[string]string {
+	var annotations map[string]string
+	for _, m := range []map[string]string{requested, rsc.Annotations, rsc.ImageAnnotations[imageName]} {
+		for k, v := range m {
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[k] = v
+		}
+	}
+	return annotations
 }
 
 func (rsc RegistrySyncConfig) SortedImageNames() []string {
@@ -65,11 +134,70 @@ func (rsc RegistrySyncConfig) Clone() RegistrySyncConfig {
 		}
 	}
 
+	var imagePlatforms map[string][]platform.Platform
+	if rsc.ImagePlatforms != nil {
+		imagePlatforms = make(map[string][]platform.Platform, len(rsc.ImagePlatforms))
+		for k, v := range rsc.ImagePlatforms {
+			imagePlatforms[k] = append([]platform.Platform{}, v...)
+		}
+	}
+
+	var imageMaxSizes map[string]int64
+	if rsc.ImageMaxSizes != nil {
+		imageMaxSizes = make(map[string]int64, len(rsc.ImageMaxSizes))
+		for k, v := range rsc.ImageMaxSizes {
+			imageMaxSizes[k] = v
+		}
+	}
+
+	var imageArtifacts map[string]bool
+	if rsc.ImageArtifacts != nil {
+		imageArtifacts = make(map[string]bool, len(rsc.ImageArtifacts))
+		for k, v := range rsc.ImageArtifacts {
+			imageArtifacts[k] = v
+		}
+	}
+
+	var imageAnnotations map[string]map[string]string
+	if rsc.ImageAnnotations != nil {
+		imageAnnotations = make(map[string]map[string]string, len(rsc.ImageAnnotations))
+		for k, v := range rsc.ImageAnnotations {
+			imageAnnotations[k] = cloneAnnotations(v)
+		}
+	}
+
+	var platforms []platform.Platform
+	if rsc.Platforms != nil {
+		platforms = append([]platform.Platform{}, rsc.Platforms...)
+	}
+
 	return RegistrySyncConfig{
-		Images:      images,
-		TLSVerify:   tlsVerify,
-		Credentials: creds,
+		Images:         images,
+		TLSVerify:      tlsVerify,
+		Credentials:    creds,
+		Proxy:          rsc.Proxy,
+		Platforms:      platforms,
+		ImagePlatforms: imagePlatforms,
+		ImageMaxSizes:  imageMaxSizes,
+		ImageArtifacts: imageArtifacts,
+
+		MaxRequestsPerSecond: rsc.MaxRequestsPerSecond,
+		MaxBandwidth:         rsc.MaxBandwidth,
+
+		Annotations:      cloneAnnotations(rsc.Annotations),
+		ImageAnnotations: imageAnnotations,
+	}
+}
+
+func cloneAnnotations(annotations map[string]string) map[string]string {
+	if annotations == nil {
+		return nil
+	}
+	cloned := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		cloned[k] = v
 	}
+	return cloned
 }
 
 // ImagesConfig contains all registries information read from the source YAML file.
@@ -102,6 +230,38 @@ func (ic *ImagesConfig) Merge(cfg ImagesConfig) *ImagesConfig {
 
 		f.Credentials = cloned.Credentials
 		f.TLSVerify = cloned.TLSVerify
+		f.Proxy = cloned.Proxy
+		f.Platforms = cloned.Platforms
+		f.MaxRequestsPerSecond = cloned.MaxRequestsPerSecond
+		f.MaxBandwidth = cloned.MaxBandwidth
+		f.Annotations = cloned.Annotations
+		for img, platforms := range cloned.ImagePlatforms {
+			if f.ImagePlatforms == nil {
+				f.ImagePlatforms = map[string][]platform.Platform{}
+			}
+			f.ImagePlatforms[img] = platforms
+		}
+
+		for img, maxSize := range cloned.ImageMaxSizes {
+			if f.ImageMaxSizes == nil {
+				f.ImageMaxSizes = map[string]int64{}
+			}
+			f.ImageMaxSizes[img] = maxSize
+		}
+
+		for img, artifact := range cloned.ImageArtifacts {
+			if f.ImageArtifacts == nil {
+				f.ImageArtifacts = map[string]bool{}
+			}
+			f.ImageArtifacts[img] = artifact
+		}
+
+		for img, annotations := range cloned.ImageAnnotations {
+			if f.ImageAnnotations == nil {
+				f.ImageAnnotations = map[string]map[string]string{}
+			}
+			f.ImageAnnotations[img] = annotations
+		}
 
 		for img, tags := range cloned.Images {
 			fImg, ok := f.Images[img]
@@ -120,11 +280,26 @@ func (ic *ImagesConfig) Merge(cfg ImagesConfig) *ImagesConfig {
 			sort.Strings(fImg)
 			f.Images[img] = fImg
 		}
+
+		merged[k] = f
 	}
 
 	return &merged
 }
 
+// AddImage adds the image tag to the config, creating the registry and image entries if necessary.
+func (ic ImagesConfig) AddImage(registryName, imageName, tag string) {
+	rsc := ic[registryName]
+	if rsc.Images == nil {
+		rsc.Images = map[string][]string{}
+	}
+	if !sliceContains(rsc.Images[imageName], tag) {
+		rsc.Images[imageName] = append(rsc.Images[imageName], tag)
+		sort.Strings(rsc.Images[imageName])
+	}
+	ic[registryName] = rsc
+}
+
 func sliceContains(sl []string, s string) bool {
 	for _, v := range sl {
 		if v == s {
@@ -152,30 +327,77 @@ func (ic ImagesConfig) TotalImages() int {
 	return n
 }
 
+// HasImageMaxSizes returns true if the maxSize of any image is configured.
+func (ic ImagesConfig) HasImageMaxSizes() bool {
+	for _, rsc := range ic {
+		if len(rsc.ImageMaxSizes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func ParseImagesConfigFile(configFile string) (ImagesConfig, error) {
-	f, yamlParseErr := os.Open(configFile)
-	if yamlParseErr != nil {
-		return ImagesConfig{}, fmt.Errorf("failed to read images config file: %w", yamlParseErr)
+	return ParseImagesConfigFileWithWarnings(configFile, nil)
+}
+
+// ParseImagesConfigFileWithWarnings parses the images config file, reporting any image references in
+// plain text files that are changed by normalization, e.g. nginx to docker.io/library/nginx:latest.
+// References to environment variables in credentials, proxies and annotations, e.g. ${REGISTRY_USER},
+// are expanded.
+func ParseImagesConfigFileWithWarnings(configFile string, w *warnings.Collector) (ImagesConfig, error) {
+	b, err := os.ReadFile(configFile)
+	if err != nil {
+		return ImagesConfig{}, fmt.Errorf("failed to read images config file: %w", err)
+	}
+	return parseImagesConfig(b, filepath.Dir(configFile), w)
+}
+
+// parseImagesConfig parses an images config in any of the supported formats, resolving files
+// referenced in the config relative to configDir.
+func parseImagesConfig(b []byte, configDir string, w *warnings.Collector) (ImagesConfig, error) {
+	if isImagesConfigV2(b) {
+		config, err := parseImagesConfigV2(b, configDir)
+		if err != nil {
+			return ImagesConfig{}, err
+		}
+		if err := expandCredentialsEnv(config); err != nil {
+			return ImagesConfig{}, err
+		}
+		if err := expandProxiesEnv(config); err != nil {
+			return ImagesConfig{}, err
+		}
+		if err := expandAnnotationsEnv(config); err != nil {
+			return ImagesConfig{}, err
+		}
+		if err := validateProxies(config); err != nil {
+			return ImagesConfig{}, err
+		}
+		return config, nil
 	}
-	defer f.Close()
 
 	var (
 		config ImagesConfig
-		dec    = yaml.NewDecoder(f)
+		dec    = yaml.NewDecoder(bytes.NewReader(b))
 	)
 	dec.KnownFields(true)
-	yamlParseErr = dec.Decode(&config)
+	yamlParseErr := dec.Decode(&config)
 	if yamlParseErr == nil {
+		if err := expandCredentialsEnv(config); err != nil {
+			return ImagesConfig{}, err
+		}
+		if err := expandProxiesEnv(config); err != nil {
+			return ImagesConfig{}, err
+		}
+		if err := validateProxies(config); err != nil {
+			return ImagesConfig{}, err
+		}
 		return config, nil
 	}
 
 	config = ImagesConfig{}
 
-	if _, seekErr := f.Seek(0, io.SeekStart); seekErr != nil {
-		return ImagesConfig{}, fmt.Errorf("failed to reset file reader for parsing: %w", seekErr)
-	}
-
-	fileScanner := bufio.NewScanner(f)
+	fileScanner := bufio.NewScanner(bytes.NewReader(b))
 	fileScanner.Split(bufio.ScanLines)
 	for fileScanner.Scan() {
 		trimmedLine := strings.TrimSpace(fileScanner.Text())
@@ -194,6 +416,14 @@ func ParseImagesConfigFile(configFile string) (ImagesConfig, error) {
 			}
 			namedTagged = tagged
 		}
+		if normalized := namedTagged.String(); normalized != trimmedLine {
+			if err := w.Warnf(
+				warnings.Normalization,
+				"image %q normalized to %q", trimmedLine, normalized,
+			); err != nil {
+				return ImagesConfig{}, err
+			}
+		}
 
 		registry := reference.Domain(namedTagged)
 		name := reference.Path(named)
@@ -212,6 +442,7 @@ func WriteSanitizedImagesConfig(cfg ImagesConfig, fileName string) error {
 	for regName, regConfig := range cfg {
 		regConfig.Credentials = nil
 		regConfig.TLSVerify = nil
+		regConfig.Proxy = ""
 		cfg[regName] = regConfig
 	}
 
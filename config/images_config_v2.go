@@ -0,0 +1,271 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/image/v5/types"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/mesosphere/mindthegap/images/platform"
+)
+
+// ImagesConfigV2Version is the value of the version field that identifies v2 images config files.
+// Files without this field are parsed as v1 config files.
+const ImagesConfigV2Version = "v2"
+
+// imagesConfigV2 is the v2 images config file format, which adds support for global defaults,
+// credentials files and per-image settings to the v1 format.
+type imagesConfigV2 struct {
+	Version    string                      `yaml:"version"`
+	Defaults   imagesConfigV2Defaults      `yaml:"defaults,omitempty"`
+	Registries map[string]registryConfigV2 `yaml:"registries,omitempty"`
+}
+
+type imagesConfigV2Defaults struct {
+	// Platforms to bundle all images for, unless overridden for a registry or image
+	Platforms []string `yaml:"platforms,omitempty"`
+	// TLS verification mode for all registries, unless overridden for a registry
+	TLSVerify *bool `yaml:"tlsVerify,omitempty"`
+	// Annotations to add to all images, which registries and images can add to or override
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type registryConfigV2 struct {
+	TLSVerify   *bool                   `yaml:"tlsVerify,omitempty"`
+	Credentials *types.DockerAuthConfig `yaml:"credentials,omitempty"`
+	// CredentialsFile is a file containing credentials in the same format as Credentials, relative
+	// to the config file
+	CredentialsFile string `yaml:"credentialsFile,omitempty"`
+	// Proxy is the URL of the proxy to pull images from the registry via, or "direct" to bypass
+	// proxies configured by environment variables
+	Proxy string `yaml:"proxy,omitempty"`
+	// MaxRequestsPerSecond limits the rate of requests to the registry, e.g. 10
+	MaxRequestsPerSecond float64 `yaml:"maxRequestsPerSecond,omitempty"`
+	// MaxBandwidth limits the bandwidth of pulling from the registry, e.g. 50Mbps
+	MaxBandwidth string                   `yaml:"maxBandwidth,omitempty"`
+	Platforms    []string                 `yaml:"platforms,omitempty"`
+	Annotations  map[string]string        `yaml:"annotations,omitempty"`
+	Images       map[string]imageConfigV2 `yaml:"images,omitempty"`
+}
+
+type imageConfigV2 struct {
+	Tags      []string `yaml:"tags,omitempty"`
+	Platforms []string `yaml:"platforms,omitempty"`
+	// MaxSize is the maximum size of every tag of the image for the bundled platforms, e.g. 500Mi
+	MaxSize string `yaml:"maxSize,omitempty"`
+	// Artifact copies the image as OCI artifact, exactly as stored in the registry with all of its
+	// platforms, e.g. for artifacts that are not detected as such by their media types
+	Artifact bool `yaml:"artifact,omitempty"`
+	// Annotations to add to the image, in addition to and overriding the annotations of the registry
+	// and defaults
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// UnmarshalYAML allows images to be specified as a plain list of tags when no other settings are
+// needed, as in v1 config files.
+func (i *imageConfigV2) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		return value.Decode(&i.Tags)
+	}
+
+	type plain imageConfigV2
+	return value.Decode((*plain)(i))
+}
+
+func isImagesConfigV2(b []byte) bool {
+	var versioned struct {
+		Version string `yaml:"version"`
+	}
+	// Plain text config files and v1 config files will either fail to parse or have no version.
+	if err := yaml.Unmarshal(b, &versioned); err != nil {
+		return false
+	}
+
+	return versioned.Version == ImagesConfigV2Version
+}
+
+func parseImagesConfigV2(b []byte, configDir string) (ImagesConfig, error) {
+	var cfgV2 imagesConfigV2
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfgV2); err != nil {
+		return ImagesConfig{}, fmt.Errorf("failed to parse images config file: %w", err)
+	}
+
+	defaultPlatforms, err := parsePlatforms(cfgV2.Defaults.Platforms)
+	if err != nil {
+		return ImagesConfig{}, fmt.Errorf("invalid default platforms: %w", err)
+	}
+
+	cfg := make(ImagesConfig, len(cfgV2.Registries))
+	for registryName, regV2 := range cfgV2.Registries {
+		rsc := RegistrySyncConfig{
+			Images:      make(map[string][]string, len(regV2.Images)),
+			TLSVerify:   regV2.TLSVerify,
+			Credentials: regV2.Credentials,
+			Proxy:       regV2.Proxy,
+			Platforms:   defaultPlatforms,
+		}
+		if rsc.TLSVerify == nil {
+			rsc.TLSVerify = cfgV2.Defaults.TLSVerify
+		}
+		for _, annotations := range []map[string]string{cfgV2.Defaults.Annotations, regV2.Annotations} {
+			for k, v := range annotations {
+				if rsc.Annotations == nil {
+					rsc.Annotations = map[string]string{}
+				}
+				rsc.Annotations[k] = v
+			}
+		}
+
+		if regV2.CredentialsFile != "" {
+			if regV2.Credentials != nil {
+				return ImagesConfig{}, fmt.Errorf(
+					"registry %q: only one of credentials or credentialsFile can be specified",
+					registryName,
+				)
+			}
+			credentialsFile := regV2.CredentialsFile
+			if !filepath.IsAbs(credentialsFile) {
+				credentialsFile = filepath.Join(configDir, credentialsFile)
+			}
+			rsc.Credentials, err = parseCredentialsFile(credentialsFile)
+			if err != nil {
+				return ImagesConfig{}, fmt.Errorf("registry %q: %w", registryName, err)
+			}
+		}
+
+		if regV2.MaxRequestsPerSecond < 0 {
+			return ImagesConfig{}, fmt.Errorf(
+				"registry %q: invalid maxRequestsPerSecond %v: must not be negative",
+				registryName,
+				regV2.MaxRequestsPerSecond,
+			)
+		}
+		rsc.MaxRequestsPerSecond = regV2.MaxRequestsPerSecond
+		if regV2.MaxBandwidth != "" {
+			rsc.MaxBandwidth, err = ParseBandwidth(regV2.MaxBandwidth)
+			if err != nil {
+				return ImagesConfig{}, fmt.Errorf("registry %q: %w", registryName, err)
+			}
+		}
+
+		if len(regV2.Platforms) > 0 {
+			rsc.Platforms, err = parsePlatforms(regV2.Platforms)
+			if err != nil {
+				return ImagesConfig{}, fmt.Errorf("registry %q: invalid platforms: %w", registryName, err)
+			}
+		}
+
+		for imageName, imgV2 := range regV2.Images {
+			rsc.Images[imageName] = imgV2.Tags
+
+			if imgV2.MaxSize != "" {
+				maxSize, err := resource.ParseQuantity(imgV2.MaxSize)
+				if err != nil || maxSize.Sign() <= 0 {
+					return ImagesConfig{}, fmt.Errorf(
+						"registry %q: image %q: invalid maxSize %q: must be a positive size, e.g. 500Mi",
+						registryName,
+						imageName,
+						imgV2.MaxSize,
+					)
+				}
+				if rsc.ImageMaxSizes == nil {
+					rsc.ImageMaxSizes = map[string]int64{}
+				}
+				rsc.ImageMaxSizes[imageName] = maxSize.Value()
+			}
+
+			if len(imgV2.Annotations) > 0 {
+				if rsc.ImageAnnotations == nil {
+					rsc.ImageAnnotations = map[string]map[string]string{}
+				}
+				rsc.ImageAnnotations[imageName] = imgV2.Annotations
+			}
+
+			if imgV2.Artifact {
+				if len(imgV2.Platforms) > 0 {
+					return ImagesConfig{}, fmt.Errorf(
+						"registry %q: image %q: platforms cannot be specified for artifacts, "+
+							"which are copied with all of their platforms",
+						registryName,
+						imageName,
+					)
+				}
+				if len(imgV2.Annotations) > 0 {
+					return ImagesConfig{}, fmt.Errorf(
+						"registry %q: image %q: annotations cannot be specified for artifacts, "+
+							"which are copied exactly as stored in the registry",
+						registryName,
+						imageName,
+					)
+				}
+				if rsc.ImageArtifacts == nil {
+					rsc.ImageArtifacts = map[string]bool{}
+				}
+				rsc.ImageArtifacts[imageName] = true
+			}
+
+			if len(imgV2.Platforms) == 0 {
+				continue
+			}
+			imagePlatforms, err := parsePlatforms(imgV2.Platforms)
+			if err != nil {
+				return ImagesConfig{}, fmt.Errorf(
+					"registry %q: image %q: invalid platforms: %w",
+					registryName,
+					imageName,
+					err,
+				)
+			}
+			if rsc.ImagePlatforms == nil {
+				rsc.ImagePlatforms = map[string][]platform.Platform{}
+			}
+			rsc.ImagePlatforms[imageName] = imagePlatforms
+		}
+
+		cfg[registryName] = rsc
+	}
+
+	return cfg, nil
+}
+
+func parsePlatforms(platformStrs []string) ([]platform.Platform, error) {
+	if len(platformStrs) == 0 {
+		return nil, nil
+	}
+
+	platforms := make([]platform.Platform, 0, len(platformStrs))
+	for _, s := range platformStrs {
+		p, err := platform.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		platforms = append(platforms, p)
+	}
+	return platforms, nil
+}
+
+func parseCredentialsFile(credentialsFile string) (*types.DockerAuthConfig, error) {
+	f, err := os.Open(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+	defer f.Close()
+
+	var creds types.DockerAuthConfig
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&creds); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials file %q: %w", credentialsFile, err)
+	}
+
+	return &creds, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// DirectProxy is the proxy of registries that are connected to directly, bypassing the proxies
+// configured by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+const DirectProxy = "direct"
+
+// ParseProxy parses the proxy of a registry, returning nil for DirectProxy.
+func ParseProxy(proxy string) (*url.URL, error) {
+	if proxy == DirectProxy {
+		return nil, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf(
+			`invalid proxy URL %q: must be an http, https or socks5 URL, or %q`, u.Redacted(), DirectProxy,
+		)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", u.Redacted())
+	}
+	return u, nil
+}
+
+// validateProxies checks that the proxy of every registry is valid.
+func validateProxies(cfg ImagesConfig) error {
+	for registryName, rsc := range cfg {
+		if rsc.Proxy == "" {
+			continue
+		}
+		if _, err := ParseProxy(rsc.Proxy); err != nil {
+			return fmt.Errorf("registry %q: %w", registryName, err)
+		}
+	}
+	return nil
+}
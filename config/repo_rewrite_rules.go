@@ -0,0 +1,106 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RepoRewriteRule rewrites source repositories, e.g. docker.io/library/nginx, to repository paths in
+// the destination registry. Exactly one of Prefix or Regex must be specified.
+type RepoRewriteRule struct {
+	// Prefix matches source repositories starting with the specified path, replacing the prefix with
+	// Replacement, e.g. prefix docker.io/library with replacement mirror rewrites
+	// docker.io/library/nginx to mirror/nginx.
+	Prefix string `yaml:"prefix,omitempty"`
+	// Regex matches source repositories against the specified regular expression, which is anchored
+	// to match the whole repository. Replacement can reference capture groups, e.g. $1.
+	Regex string `yaml:"regex,omitempty"`
+	// Replacement is the destination repository path, relative to the destination registry.
+	Replacement string `yaml:"replacement"`
+
+	compiledRegex *regexp.Regexp
+}
+
+// RepoRewriteRules contains all repository rewrite rules read from the source YAML file. Rules are
+// applied in order and the first matching rule wins.
+type RepoRewriteRules struct {
+	Rules []RepoRewriteRule `yaml:"rules"`
+}
+
+func (r *RepoRewriteRules) validate() error {
+	for i := range r.Rules {
+		rule := &r.Rules[i]
+		switch {
+		case (rule.Prefix == "") == (rule.Regex == ""):
+			return fmt.Errorf("rule %d: exactly one of prefix or regex must be specified", i)
+		case rule.Regex != "":
+			re, err := regexp.Compile("^(?:" + rule.Regex + ")$")
+			if err != nil {
+				return fmt.Errorf("rule %d: invalid regex: %w", i, err)
+			}
+			rule.compiledRegex = re
+		default:
+			rule.Prefix = strings.TrimSuffix(rule.Prefix, "/")
+		}
+	}
+
+	return nil
+}
+
+// Rewrite returns the destination repository path for the source repository, which must include the
+// source registry, e.g. docker.io/library/nginx. The second return value is false if no rule matched.
+func (r RepoRewriteRules) Rewrite(srcRepository string) (string, bool) {
+	for _, rule := range r.Rules {
+		if rule.compiledRegex != nil {
+			if rule.compiledRegex.MatchString(srcRepository) {
+				return strings.Trim(
+					rule.compiledRegex.ReplaceAllString(srcRepository, rule.Replacement),
+					"/",
+				), true
+			}
+			continue
+		}
+
+		if srcRepository == rule.Prefix {
+			return strings.Trim(rule.Replacement, "/"), true
+		}
+		if rest, found := strings.CutPrefix(srcRepository, rule.Prefix+"/"); found {
+			return strings.Trim(strings.TrimSuffix(rule.Replacement, "/")+"/"+rest, "/"), true
+		}
+	}
+
+	return "", false
+}
+
+func ParseRepoRewriteRulesFile(rulesFile string) (RepoRewriteRules, error) {
+	f, err := os.Open(rulesFile)
+	if err != nil {
+		return RepoRewriteRules{}, fmt.Errorf("failed to read repository rewrite rules file: %w", err)
+	}
+	defer f.Close()
+
+	var (
+		rules RepoRewriteRules
+		dec   = yaml.NewDecoder(f)
+	)
+	dec.KnownFields(true)
+	if err := dec.Decode(&rules); err != nil {
+		return RepoRewriteRules{}, fmt.Errorf(
+			"failed to parse repository rewrite rules file: %w",
+			err,
+		)
+	}
+
+	if err := rules.validate(); err != nil {
+		return RepoRewriteRules{}, fmt.Errorf("invalid repository rewrite rules: %w", err)
+	}
+
+	return rules, nil
+}
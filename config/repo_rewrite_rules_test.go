@@ -0,0 +1,51 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoRewriteRules(t *testing.T) {
+	t.Parallel()
+
+	rules, err := ParseRepoRewriteRulesFile(
+		filepath.Join("testdata", "reporewriterules", "rules.yaml"),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		src       string
+		want      string
+		wantMatch bool
+	}{
+		{src: "docker.io/library/nginx", want: "com/mirror/nginx", wantMatch: true},
+		{src: "docker.io/library", want: "com/mirror", wantMatch: true},
+		{src: "docker.io/libraryx/nginx", want: "dockerhub/libraryx/nginx", wantMatch: true},
+		{src: "quay.io/coreos/etcd", want: "quay/coreos-etcd", wantMatch: true},
+		{src: "gcr.io/google-containers/pause", wantMatch: false},
+	}
+	for _, tt := range tests {
+		tt := tt // Capture range variable.
+		t.Run(tt.src, func(t *testing.T) {
+			t.Parallel()
+			got, matched := rules.Rewrite(tt.src)
+			assert.Equal(t, tt.wantMatch, matched)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseRepoRewriteRulesFileInvalidRule(t *testing.T) {
+	t.Parallel()
+
+	_, err := ParseRepoRewriteRulesFile(
+		filepath.Join("testdata", "reporewriterules", "invalid_rule.yaml"),
+	)
+	require.ErrorContains(t, err, "rule 0: exactly one of prefix or regex must be specified")
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RepoRewrite records the repository path that a source repository is pushed to, relative to the
+// destination registry and any repository prefix.
+type RepoRewrite struct {
+	// Source is the source repository, including the source registry, e.g. docker.io/library/nginx.
+	Source string `yaml:"source"`
+	// Destination is the destination repository path, e.g. mirror/nginx.
+	Destination string `yaml:"destination"`
+	// Tags are the bundled tags of the repository.
+	Tags []string `yaml:"tags,omitempty"`
+}
+
+// Registry returns the source registry of the repository, e.g. docker.io.
+func (r RepoRewrite) Registry() string {
+	registryName, _, _ := strings.Cut(r.Source, "/")
+	return registryName
+}
+
+// ImageName returns the source repository without its registry, e.g. library/nginx.
+func (r RepoRewrite) ImageName() string {
+	_, imageName, _ := strings.Cut(r.Source, "/")
+	return imageName
+}
+
+// RepoRewrites is the machine-readable mapping of all bundled repositories to the repositories they
+// are pushed to, sorted by source repository.
+type RepoRewrites struct {
+	Rewrites []RepoRewrite `yaml:"rewrites"`
+}
+
+// RewritesFor returns the destination repository of every repository in the images config. Images
+// that are not matched by any rule are pushed without their source registry, e.g.
+// docker.io/library/nginx to library/nginx.
+func (r RepoRewriteRules) RewritesFor(cfg ImagesConfig) RepoRewrites {
+	var rewrites RepoRewrites
+	for _, registryName := range cfg.SortedRegistryNames() {
+		rsc := cfg[registryName]
+		for _, imageName := range rsc.SortedImageNames() {
+			src := registryName + "/" + imageName
+			dest, matched := r.Rewrite(src)
+			if !matched {
+				dest = imageName
+			}
+			tags := append([]string{}, rsc.Images[imageName]...)
+			sort.Strings(tags)
+			rewrites.Rewrites = append(rewrites.Rewrites, RepoRewrite{
+				Source:      src,
+				Destination: dest,
+				Tags:        tags,
+			})
+		}
+	}
+	return rewrites
+}
+
+// Lookup returns the destination repository path for the source repository. The second return value
+// is false if the source repository is not in the mapping.
+func (r RepoRewrites) Lookup(srcRepository string) (string, bool) {
+	for _, rewrite := range r.Rewrites {
+		if rewrite.Source == srcRepository {
+			return rewrite.Destination, true
+		}
+	}
+	return "", false
+}
+
+// Merge merges the rewrites of another bundle, merging the tags of repositories in both. An error is
+// returned if a repository is rewritten to different destinations.
+func (r RepoRewrites) Merge(other RepoRewrites) (RepoRewrites, error) {
+	bySource := make(map[string]RepoRewrite, len(r.Rewrites)+len(other.Rewrites))
+	for _, rewrite := range append(append([]RepoRewrite{}, r.Rewrites...), other.Rewrites...) {
+		existing, ok := bySource[rewrite.Source]
+		if !ok {
+			rewrite.Tags = append([]string{}, rewrite.Tags...)
+			bySource[rewrite.Source] = rewrite
+			continue
+		}
+		if existing.Destination != rewrite.Destination {
+			return RepoRewrites{}, fmt.Errorf(
+				"repository %s is rewritten to both %s and %s",
+				rewrite.Source,
+				existing.Destination,
+				rewrite.Destination,
+			)
+		}
+		for _, tag := range rewrite.Tags {
+			if !sliceContains(existing.Tags, tag) {
+				existing.Tags = append(existing.Tags, tag)
+			}
+		}
+		sort.Strings(existing.Tags)
+		bySource[rewrite.Source] = existing
+	}
+
+	var merged RepoRewrites
+	for _, rewrite := range bySource {
+		merged.Rewrites = append(merged.Rewrites, rewrite)
+	}
+	sort.Slice(merged.Rewrites, func(i, j int) bool {
+		return merged.Rewrites[i].Source < merged.Rewrites[j].Source
+	})
+	return merged, nil
+}
+
+func ParseRepoRewritesFile(rewritesFile string) (RepoRewrites, error) {
+	f, err := os.Open(rewritesFile)
+	if err != nil {
+		return RepoRewrites{}, fmt.Errorf("failed to read repository rewrites file: %w", err)
+	}
+	defer f.Close()
+
+	var (
+		rewrites RepoRewrites
+		dec      = yaml.NewDecoder(f)
+	)
+	dec.KnownFields(true)
+	if err := dec.Decode(&rewrites); err != nil {
+		return RepoRewrites{}, fmt.Errorf("failed to parse repository rewrites file: %w", err)
+	}
+	return rewrites, nil
+}
+
+func WriteRepoRewritesFile(rewrites RepoRewrites, fileName string) error {
+	return writeYAMLToFile(rewrites, fileName)
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoRewritesFor(t *testing.T) {
+	t.Parallel()
+
+	rules, err := ParseRepoRewriteRulesFile(
+		filepath.Join("testdata", "reporewriterules", "rules.yaml"),
+	)
+	require.NoError(t, err)
+
+	rewrites := rules.RewritesFor(ImagesConfig{
+		"docker.io": RegistrySyncConfig{
+			Images: map[string][]string{"library/nginx": {"1.25", "1.21"}},
+		},
+		"gcr.io": RegistrySyncConfig{
+			Images: map[string][]string{"google-containers/pause": {"3.9"}},
+		},
+	})
+	assert.Equal(t, RepoRewrites{Rewrites: []RepoRewrite{{
+		Source:      "docker.io/library/nginx",
+		Destination: "com/mirror/nginx",
+		Tags:        []string{"1.21", "1.25"},
+	}, {
+		Source:      "gcr.io/google-containers/pause",
+		Destination: "google-containers/pause",
+		Tags:        []string{"3.9"},
+	}}}, rewrites)
+
+	rewritesFile := filepath.Join(t.TempDir(), "repo-rewrites.yaml")
+	require.NoError(t, WriteRepoRewritesFile(rewrites, rewritesFile))
+	parsed, err := ParseRepoRewritesFile(rewritesFile)
+	require.NoError(t, err)
+	assert.Equal(t, rewrites, parsed)
+
+	dest, ok := parsed.Lookup("docker.io/library/nginx")
+	assert.True(t, ok)
+	assert.Equal(t, "com/mirror/nginx", dest)
+}
+
+func TestRepoRewritesMerge(t *testing.T) {
+	t.Parallel()
+
+	rewrites := RepoRewrites{Rewrites: []RepoRewrite{{
+		Source: "quay.io/coreos/etcd", Destination: "quay/coreos-etcd", Tags: []string{"v3.5"},
+	}}}
+	merged, err := rewrites.Merge(RepoRewrites{Rewrites: []RepoRewrite{{
+		Source: "quay.io/coreos/etcd", Destination: "quay/coreos-etcd", Tags: []string{"v3.4"},
+	}, {
+		Source: "docker.io/library/nginx", Destination: "com/mirror/nginx", Tags: []string{"1.21"},
+	}}})
+	require.NoError(t, err)
+	assert.Equal(t, RepoRewrites{Rewrites: []RepoRewrite{{
+		Source: "docker.io/library/nginx", Destination: "com/mirror/nginx", Tags: []string{"1.21"},
+	}, {
+		Source: "quay.io/coreos/etcd", Destination: "quay/coreos-etcd", Tags: []string{"v3.4", "v3.5"},
+	}}}, merged)
+
+	_, err = rewrites.Merge(RepoRewrites{Rewrites: []RepoRewrite{{
+		Source: "quay.io/coreos/etcd", Destination: "coreos/etcd",
+	}}})
+	require.ErrorContains(t, err, "repository quay.io/coreos/etcd is rewritten to both quay/coreos-etcd and coreos/etcd")
+}
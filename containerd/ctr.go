@@ -4,9 +4,12 @@
 package containerd
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os/exec"
+
+	"github.com/mesosphere/mindthegap/logging"
 )
 
 type CtrOption func() string
@@ -15,25 +18,65 @@ func ImportImageArchive(
 	ctx context.Context,
 	archivePath, containerdNamespace string,
 ) ([]byte, error) {
-	baseArgs := []string{"-n", containerdNamespace}
 	//nolint:gosec // Args are fine.
-	cmd := exec.CommandContext(
-		ctx,
-		"ctr",
-		append(
-			baseArgs,
-			[]string{
-				"images",
-				"import",
-				"--no-unpack",
-				"--all-platforms",
-				"--digests",
-				archivePath,
-			}...)...)
-	cmdOutput, err := cmd.CombinedOutput()
+	cmd := exec.CommandContext(ctx, "ctr", ImportImageArchiveArgs(archivePath, containerdNamespace)...)
+	cmdOutput, err := ctrCombinedOutput(cmd)
 	if err != nil {
 		return cmdOutput, fmt.Errorf("failed to import image(s) from image archive: %w", err)
 	}
 
 	return cmdOutput, nil
 }
+
+// ImportImageArchiveArgs returns the ctr args to import the image archive at archivePath, which can
+// be `-` to read the archive from stdin.
+func ImportImageArchiveArgs(archivePath, containerdNamespace string) []string {
+	return []string{
+		"-n",
+		containerdNamespace,
+		"images",
+		"import",
+		"--no-unpack",
+		"--all-platforms",
+		"--digests",
+		archivePath,
+	}
+}
+
+// ExportImageArchive exports the image from containerd to an OCI image archive at archivePath,
+// including only the specified platforms, or all platforms if none are specified.
+func ExportImageArchive(
+	ctx context.Context,
+	imageName, archivePath, containerdNamespace string,
+	platforms ...string,
+) ([]byte, error) {
+	args := []string{"-n", containerdNamespace, "images", "export"}
+	if len(platforms) == 0 {
+		args = append(args, "--all-platforms")
+	}
+	for _, p := range platforms {
+		args = append(args, "--platform", p)
+	}
+	args = append(args, archivePath, imageName)
+
+	//nolint:gosec // Args are fine.
+	cmd := exec.CommandContext(ctx, "ctr", args...)
+	cmdOutput, err := ctrCombinedOutput(cmd)
+	if err != nil {
+		return cmdOutput, fmt.Errorf("failed to export image %s to image archive: %w", imageName, err)
+	}
+
+	return cmdOutput, nil
+}
+
+// ctrCombinedOutput runs the ctr command and returns its combined stdout and stderr, like
+// exec.Cmd.CombinedOutput, logging the output as it is written.
+func ctrCombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	var b bytes.Buffer
+	outputLog := logging.SubprocessOutput("ctr", &b)
+	cmd.Stdout = outputLog
+	cmd.Stderr = outputLog
+	err := cmd.Run()
+	_ = outputLog.Close()
+	return b.Bytes(), err
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/mesosphere/mindthegap/logging"
+)
+
+const (
+	// DefaultImageVerifierTimeout is the default time allowed for each image verifier to run, as
+	// used by containerd.
+	DefaultImageVerifierTimeout = 10 * time.Second
+
+	descriptorMediaType = "application/vnd.oci.descriptor.v1+json"
+
+	// maxVerifierOutput limits how much of a verifier's output is included in errors.
+	maxVerifierOutput = 1 << 10
+)
+
+// VerifyImage runs every executable in verifiersDir as an image verifier for the image, using the
+// same protocol as containerd image verifier plugins: each verifier is invoked with the `-name`,
+// `-digest` and `-stdin-media-type` flags, is passed the image descriptor as JSON on stdin, and must
+// exit with a zero exit code for the image to be accepted. Verifiers run in lexical order and the
+// first rejection is returned as an error.
+func VerifyImage(
+	ctx context.Context,
+	verifiersDir string,
+	perVerifierTimeout time.Duration,
+	imageName string,
+	desc v1.Descriptor,
+) error {
+	entries, err := os.ReadDir(verifiersDir)
+	if err != nil {
+		return fmt.Errorf("failed to read image verifiers directory: %w", err)
+	}
+
+	descJSON, err := json.Marshal(desc)
+	if err != nil {
+		return fmt.Errorf("failed to encode image descriptor: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to read image verifier %q: %w", entry.Name(), err)
+		}
+		if info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+
+		if err := runVerifier(
+			ctx,
+			filepath.Join(verifiersDir, entry.Name()),
+			perVerifierTimeout,
+			imageName,
+			desc.Digest.String(),
+			descJSON,
+		); err != nil {
+			return fmt.Errorf("image %s rejected by verifier %q: %w", imageName, entry.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+func runVerifier(
+	ctx context.Context,
+	verifier string,
+	timeout time.Duration,
+	imageName, digest string,
+	descJSON []byte,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	//nolint:gosec // Verifiers are explicitly configured by the user.
+	cmd := exec.CommandContext(
+		ctx,
+		verifier,
+		"-name", imageName,
+		"-digest", digest,
+		"-stdin-media-type", descriptorMediaType,
+	)
+	cmd.Stdin = bytes.NewReader(descJSON)
+	var output bytes.Buffer
+	outputLog := logging.SubprocessOutput(verifier, &output)
+	cmd.Stdout = outputLog
+	cmd.Stderr = outputLog
+	err := cmd.Run()
+	_ = outputLog.Close()
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		reason := strings.TrimSpace(string(output.Bytes()[:min(output.Len(), maxVerifierOutput)]))
+		if reason == "" {
+			return err
+		}
+		return fmt.Errorf("%w: %s", err, reason)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package containerd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeVerifier(t *testing.T, dir, name, script string) {
+	t.Helper()
+	//nolint:gosec // Verifiers must be executable.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o755))
+}
+
+func TestVerifyImage(t *testing.T) {
+	t.Parallel()
+
+	desc := v1.Descriptor{
+		MediaType: types.OCIImageIndex,
+		Size:      528,
+		Digest: v1.Hash{
+			Algorithm: "sha256",
+			Hex:       "907ca53d7e2947e849b839b1cd258c98fd3916c60f2e6e70c30edbf741ab6754",
+		},
+	}
+
+	t.Run("accepted", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		argsFile := filepath.Join(dir, "args")
+		stdinFile := filepath.Join(dir, "stdin")
+		writeVerifier(t, dir, "accept", `echo "$@" > `+argsFile+`; cat > `+stdinFile+`; exit 0`)
+		// Non-executable files are ignored.
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("exit 1"), 0o600))
+
+		require.NoError(
+			t,
+			VerifyImage(context.Background(), dir, time.Minute, "docker.io/library/nginx:1.21.5", desc),
+		)
+
+		args, err := os.ReadFile(argsFile)
+		require.NoError(t, err)
+		assert.Equal(
+			t,
+			"-name docker.io/library/nginx:1.21.5 -digest "+desc.Digest.String()+
+				" -stdin-media-type application/vnd.oci.descriptor.v1+json\n",
+			string(args),
+		)
+		stdin, err := os.ReadFile(stdinFile)
+		require.NoError(t, err)
+		assert.JSONEq(
+			t,
+			`{"mediaType":"application/vnd.oci.image.index.v1+json","size":528,"digest":"`+
+				desc.Digest.String()+`"}`,
+			string(stdin),
+		)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		writeVerifier(t, dir, "a-accept", "exit 0")
+		writeVerifier(t, dir, "b-reject", "echo missing signature; exit 1")
+
+		err := VerifyImage(context.Background(), dir, time.Minute, "docker.io/library/nginx:1.21.5", desc)
+		require.ErrorContains(t, err, `image docker.io/library/nginx:1.21.5 rejected by verifier "b-reject"`)
+		require.ErrorContains(t, err, "missing signature")
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		writeVerifier(t, dir, "slow", "exec sleep 5")
+
+		err := VerifyImage(context.Background(), dir, 100*time.Millisecond, "nginx", desc)
+		require.ErrorContains(t, err, "timed out after 100ms")
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		t.Parallel()
+		err := VerifyImage(
+			context.Background(), filepath.Join(t.TempDir(), "missing"), time.Minute, "nginx", desc,
+		)
+		require.ErrorContains(t, err, "failed to read image verifiers directory")
+	})
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package acr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// regular expression to represent all Azure Container Registry endpoints, including sovereign clouds.
+var acrRegistryRegexp = regexp.MustCompile(
+	`^(?:https://)?[a-zA-Z0-9]+\.azurecr\.(?:io|cn|us|de)/?$`,
+)
+
+// username to authenticate to ACR with when using a refresh token as the password, as used by `az acr login`.
+const refreshTokenUsername = "00000000-0000-0000-0000-000000000000"
+
+const armScope = "https://management.azure.com/.default"
+
+func IsACRRegistry(registryAddress string) bool {
+	return acrRegistryRegexp.MatchString(registryAddress)
+}
+
+// DefaultCredential returns the Azure credential to authenticate to ACR with, from environment variables,
+// workload identity, managed identity or the Azure CLI.
+func DefaultCredential() (azcore.TokenCredential, error) {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find Azure credentials: %w", err)
+	}
+	return cred, nil
+}
+
+// RetrieveUsernameAndToken exchanges an Azure AD access token of the credential for an ACR refresh token to
+// authenticate to the registry with.
+func RetrieveUsernameAndToken(
+	ctx context.Context,
+	cred azcore.TokenCredential,
+	registryAddress string,
+	rt http.RoundTripper,
+) (username, token string, err error) {
+	aadToken, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{armScope}})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to retrieve Azure access token: %w", err)
+	}
+
+	host := strings.TrimSuffix(strings.TrimPrefix(registryAddress, "https://"), "/")
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {host},
+		"access_token": {aadToken.Token},
+	}
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		"https://"+host+"/oauth2/exchange",
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create ACR token exchange request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := (&http.Client{Transport: rt}).Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to exchange Azure access token for ACR refresh token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf(
+			"failed to exchange Azure access token for ACR refresh token: unexpected status %s",
+			resp.Status,
+		)
+	}
+
+	var exchanged struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&exchanged); err != nil {
+		return "", "", fmt.Errorf("failed to decode ACR token exchange response: %w", err)
+	}
+	if exchanged.RefreshToken == "" {
+		return "", "", fmt.Errorf("ACR token exchange response does not contain a refresh token")
+	}
+	return refreshTokenUsername, exchanged.RefreshToken, nil
+}
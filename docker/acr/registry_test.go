@@ -0,0 +1,94 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package acr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsACRRegistry(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name            string
+		registryAddress string
+		want            bool
+	}{{
+		name:            "ACR",
+		registryAddress: "myregistry.azurecr.io",
+		want:            true,
+	}, {
+		name:            "ACR with https protocol",
+		registryAddress: "https://myregistry.azurecr.io",
+		want:            true,
+	}, {
+		name:            "ACR in China cloud",
+		registryAddress: "myregistry.azurecr.cn",
+		want:            true,
+	}, {
+		name:            "ACR with http protocol",
+		registryAddress: "http://myregistry.azurecr.io",
+		want:            false,
+	}, {
+		name:            "non-ACR",
+		registryAddress: "gcr.io",
+		want:            false,
+	}}
+	for _, tt := range tests {
+		tt := tt // Capture range variable.
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, IsACRRegistry(tt.registryAddress))
+		})
+	}
+}
+
+type staticCredential string
+
+func (c staticCredential) GetToken(
+	_ context.Context, _ policy.TokenRequestOptions,
+) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: string(c), ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func TestRetrieveUsernameAndToken(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth2/exchange" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		require.NoError(t, r.ParseForm())
+		if r.PostForm.Get("grant_type") != "access_token" || r.PostForm.Get("access_token") != "aad-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"refresh_token":"refresh-token"}`))
+	}))
+	t.Cleanup(srv.Close)
+	srvURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	username, token, err := RetrieveUsernameAndToken(
+		context.Background(), staticCredential("aad-token"), srvURL.Host, srv.Client().Transport,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000000", username)
+	assert.Equal(t, "refresh-token", token)
+
+	_, _, err = RetrieveUsernameAndToken(
+		context.Background(), staticCredential("wrong"), srvURL.Host, srv.Client().Transport,
+	)
+	require.ErrorContains(t, err, "401")
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// regular expression to represent Google Container Registry (gcr.io, <region>.gcr.io) and Artifact Registry
+// (<location>-docker.pkg.dev) endpoints.
+var googleRegistryRegexp = regexp.MustCompile(
+	`^(?:https://)?(?:(?:[a-z]+\.)?gcr\.io|[a-z0-9-]+-docker\.pkg\.dev)/?$`,
+)
+
+// username to authenticate to Google registries with when using an OAuth2 access token as the password.
+const accessTokenUsername = "oauth2accesstoken"
+
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+func IsGoogleRegistry(registryAddress string) bool {
+	return googleRegistryRegexp.MatchString(registryAddress)
+}
+
+// TokenSource returns a token source for access tokens to Google registries using the application
+// default credentials, refreshing tokens when they expire.
+func TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	ts, err := google.DefaultTokenSource(ctx, cloudPlatformScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find Google application default credentials: %w", err)
+	}
+	return ts, nil
+}
+
+// RetrieveUsernameAndToken returns credentials to authenticate to Google registries with from the token
+// source.
+func RetrieveUsernameAndToken(ts oauth2.TokenSource) (username, token string, err error) {
+	t, err := ts.Token()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to retrieve Google access token: %w", err)
+	}
+	return accessTokenUsername, t.AccessToken, nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package gcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestIsGoogleRegistry(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name            string
+		registryAddress string
+		want            bool
+	}{{
+		name:            "GCR",
+		registryAddress: "gcr.io",
+		want:            true,
+	}, {
+		name:            "regional GCR with https protocol",
+		registryAddress: "https://eu.gcr.io",
+		want:            true,
+	}, {
+		name:            "Artifact Registry",
+		registryAddress: "europe-west1-docker.pkg.dev",
+		want:            true,
+	}, {
+		name:            "Artifact Registry with http protocol",
+		registryAddress: "http://europe-west1-docker.pkg.dev",
+		want:            false,
+	}, {
+		name:            "non-Google",
+		registryAddress: "123456789.dkr.ecr.us-east-1.amazonaws.com",
+		want:            false,
+	}, {
+		name:            "non-Google with gcr.io suffix",
+		registryAddress: "notgcr.io",
+		want:            false,
+	}}
+	for _, tt := range tests {
+		tt := tt // Capture range variable.
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, IsGoogleRegistry(tt.registryAddress))
+		})
+	}
+}
+
+func TestRetrieveUsernameAndToken(t *testing.T) {
+	t.Parallel()
+
+	username, token, err := RetrieveUsernameAndToken(
+		oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "oauth2accesstoken", username)
+	assert.Equal(t, "token", token)
+}
@@ -0,0 +1,186 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package quay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type Visibility string
+
+const (
+	Public  Visibility = "public"
+	Private Visibility = "private"
+)
+
+// Client is a minimal client for the Quay API, covering the repository and tag operations that
+// cannot be performed via the registry API.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient returns a client for the Quay API served at baseURL, e.g. https://quay.io, that
+// authenticates using the specified OAuth access token.
+func NewClient(baseURL, token string, transport http.RoundTripper) *Client {
+	return &Client{
+		baseURL:    baseURL,
+		token:      token,
+		httpClient: &http.Client{Transport: transport},
+	}
+}
+
+type repository struct {
+	IsPublic bool `json:"is_public"`
+}
+
+// RepositoryVisibility returns the visibility of the repository, or false if the repository does
+// not exist.
+func (c *Client) RepositoryVisibility(
+	ctx context.Context,
+	namespace, repositoryName string,
+) (Visibility, bool, error) {
+	var repo repository
+	status, err := c.do(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf("/api/v1/repository/%s/%s", namespace, repositoryName),
+		nil,
+		&repo,
+		http.StatusOK, http.StatusNotFound,
+	)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get Quay repository: %w", err)
+	}
+	if status == http.StatusNotFound {
+		return "", false, nil
+	}
+	if repo.IsPublic {
+		return Public, true, nil
+	}
+	return Private, true, nil
+}
+
+// CreateRepository creates an image repository with the specified visibility.
+func (c *Client) CreateRepository(
+	ctx context.Context,
+	namespace, repositoryName string,
+	visibility Visibility,
+) error {
+	_, err := c.do(
+		ctx,
+		http.MethodPost,
+		"/api/v1/repository",
+		map[string]string{
+			"namespace":   namespace,
+			"repository":  repositoryName,
+			"visibility":  string(visibility),
+			"description": "",
+			"repo_kind":   "image",
+		},
+		nil,
+		http.StatusOK, http.StatusCreated,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create Quay repository: %w", err)
+	}
+	return nil
+}
+
+// SetRepositoryVisibility changes the visibility of an existing repository.
+func (c *Client) SetRepositoryVisibility(
+	ctx context.Context,
+	namespace, repositoryName string,
+	visibility Visibility,
+) error {
+	_, err := c.do(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf("/api/v1/repository/%s/%s/changevisibility", namespace, repositoryName),
+		map[string]string{"visibility": string(visibility)},
+		nil,
+		http.StatusOK, http.StatusCreated,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to change Quay repository visibility: %w", err)
+	}
+	return nil
+}
+
+// SetTagExpiration sets the time at which the tag expires. This has the same effect as the
+// `quay.expires-after` label, without having to modify the pushed image and so its digest.
+func (c *Client) SetTagExpiration(
+	ctx context.Context,
+	namespace, repositoryName, tag string,
+	expiration time.Time,
+) error {
+	_, err := c.do(
+		ctx,
+		http.MethodPut,
+		fmt.Sprintf("/api/v1/repository/%s/%s/tag/%s", namespace, repositoryName, tag),
+		map[string]int64{"expiration": expiration.Unix()},
+		nil,
+		http.StatusOK, http.StatusCreated,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set Quay tag expiration: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) do(
+	ctx context.Context,
+	method, path string,
+	reqBody, respBody any,
+	expectedStatusCodes ...int,
+) (int, error) {
+	var body io.Reader
+	if reqBody != nil {
+		b, err := json.Marshal(reqBody)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	for _, code := range expectedStatusCodes {
+		if resp.StatusCode != code {
+			continue
+		}
+		if respBody != nil && resp.StatusCode < http.StatusMultipleChoices {
+			if err := json.NewDecoder(resp.Body).Decode(respBody); err != nil {
+				return resp.StatusCode, fmt.Errorf("failed to decode response: %w", err)
+			}
+		}
+		return resp.StatusCode, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return resp.StatusCode, fmt.Errorf(
+		"unexpected response %s from %s %s: %s",
+		resp.Status, method, path, bytes.TrimSpace(msg),
+	)
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package quay
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var quayRegistryRegexp = regexp.MustCompile(`^(?:https://)?quay\.io(?:/|$)`)
+
+// IsQuayRegistry returns true if the registry address is hosted on quay.io. Self-hosted Quay
+// registries cannot be detected from their address alone.
+func IsQuayRegistry(registryAddress string) bool {
+	return quayRegistryRegexp.MatchString(registryAddress)
+}
+
+// SplitRepository splits a repository path into its Quay namespace (organization or user) and
+// repository name. Quay requires every repository to live in a namespace, while everything after
+// the namespace is the, possibly nested, repository name, e.g. `org/team/app` is the repository
+// `team/app` in the `org` namespace.
+func SplitRepository(repositoryPath string) (namespace, repository string, err error) {
+	namespace, repository, _ = strings.Cut(strings.Trim(repositoryPath, "/"), "/")
+	if namespace == "" || repository == "" {
+		return "", "", fmt.Errorf(
+			"%q is not a valid Quay repository: repositories must be in a namespace, "+
+				"e.g. specify the destination registry as <quay.host>/<namespace>",
+			repositoryPath,
+		)
+	}
+	return namespace, repository, nil
+}
+
+var expiresAfterRegexp = regexp.MustCompile(`^([1-9][0-9]*)([smhdw])$`)
+
+// ParseExpiresAfter parses a tag expiration in the same format as the Quay `quay.expires-after`
+// label, i.e. a number followed by one of `s`, `m`, `h`, `d` or `w`, e.g. `2w`.
+func ParseExpiresAfter(s string) (time.Duration, error) {
+	matches := expiresAfterRegexp.FindStringSubmatch(s)
+	if matches == nil {
+		return 0, fmt.Errorf(
+			"invalid tag expiration %q (required format: <number><s|m|h|d|w>, e.g. 2w)",
+			s,
+		)
+	}
+
+	n, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid tag expiration %q: %w", s, err)
+	}
+
+	unit := map[string]time.Duration{
+		"s": time.Second,
+		"m": time.Minute,
+		"h": time.Hour,
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}[matches[2]]
+
+	return time.Duration(n) * unit, nil
+}
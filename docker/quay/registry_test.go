@@ -0,0 +1,121 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package quay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsQuayRegistry(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name            string
+		registryAddress string
+		want            bool
+	}{{
+		name:            "Quay",
+		registryAddress: "quay.io",
+		want:            true,
+	}, {
+		name:            "Quay with https protocol",
+		registryAddress: "https://quay.io",
+		want:            true,
+	}, {
+		name:            "Quay with namespace",
+		registryAddress: "quay.io/mesosphere",
+		want:            true,
+	}, {
+		name:            "non-Quay with Quay prefix",
+		registryAddress: "quay.io.example.com",
+		want:            false,
+	}, {
+		name:            "non-Quay",
+		registryAddress: "gcr.io",
+		want:            false,
+	}}
+	for _, tt := range tests {
+		tt := tt // Capture range variable.
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := IsQuayRegistry(tt.registryAddress); got != tt.want {
+				t.Errorf("IsQuayRegistry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitRepository(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		repositoryPath string
+		wantError      string
+		wantNamespace  string
+		wantRepository string
+	}{{
+		name:           "namespaced repository",
+		repositoryPath: "mesosphere/nginx",
+		wantNamespace:  "mesosphere",
+		wantRepository: "nginx",
+	}, {
+		name:           "nested repository",
+		repositoryPath: "mesosphere/library/nginx",
+		wantNamespace:  "mesosphere",
+		wantRepository: "library/nginx",
+	}, {
+		name:           "repository without namespace",
+		repositoryPath: "nginx",
+		wantError:      `"nginx" is not a valid Quay repository`,
+	}}
+	for _, tt := range tests {
+		tt := tt // Capture range variable.
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			gotNamespace, gotRepository, gotErr := SplitRepository(tt.repositoryPath)
+
+			if tt.wantError != "" {
+				require.ErrorContains(t, gotErr, tt.wantError)
+			} else {
+				require.NoError(t, gotErr)
+				assert.Equal(t, tt.wantNamespace, gotNamespace)
+				assert.Equal(t, tt.wantRepository, gotRepository)
+			}
+		})
+	}
+}
+
+func TestParseExpiresAfter(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in        string
+		want      time.Duration
+		wantError bool
+	}{
+		{in: "30s", want: 30 * time.Second},
+		{in: "90m", want: 90 * time.Minute},
+		{in: "12h", want: 12 * time.Hour},
+		{in: "7d", want: 7 * 24 * time.Hour},
+		{in: "2w", want: 14 * 24 * time.Hour},
+		{in: "0d", wantError: true},
+		{in: "2y", wantError: true},
+		{in: "w", wantError: true},
+	}
+	for _, tt := range tests {
+		tt := tt // Capture range variable.
+		t.Run(tt.in, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseExpiresAfter(tt.in)
+			if tt.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package quay
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// EnsureRepositoryFunc returns a func that validates that the destination repository is a valid
+// Quay repository and, if visibility is specified, creates the repository with that visibility or
+// updates the visibility of an existing repository. Quay creates repositories as private on first
+// push otherwise. A nil client only validates the repository.
+func EnsureRepositoryFunc(client *Client, visibility Visibility) func(
+	destRepositoryName name.Repository, _ ...string,
+) error {
+	return func(
+		destRepositoryName name.Repository, _ ...string,
+	) error {
+		namespace, repositoryName, err := SplitRepository(destRepositoryName.RepositoryStr())
+		if err != nil {
+			return err
+		}
+
+		if client == nil || visibility == "" {
+			return nil
+		}
+
+		existingVisibility, exists, err := client.RepositoryVisibility(
+			context.TODO(),
+			namespace,
+			repositoryName,
+		)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case !exists:
+			return client.CreateRepository(context.TODO(), namespace, repositoryName, visibility)
+		case existingVisibility != visibility:
+			return client.SetRepositoryVisibility(
+				context.TODO(),
+				namespace,
+				repositoryName,
+				visibility,
+			)
+		default:
+			return nil
+		}
+	}
+}
+
+// SetTagExpirationFunc returns a func that sets pushed tags to expire after the specified duration.
+func SetTagExpirationFunc(client *Client, expiresAfter time.Duration) func(destImage name.Tag) error {
+	return func(destImage name.Tag) error {
+		namespace, repositoryName, err := SplitRepository(destImage.RepositoryStr())
+		if err != nil {
+			return err
+		}
+
+		if err := client.SetTagExpiration(
+			context.TODO(),
+			namespace,
+			repositoryName,
+			destImage.TagStr(),
+			time.Now().Add(expiresAfter),
+		); err != nil {
+			return fmt.Errorf("failed to set expiration for %s: %w", destImage, err)
+		}
+
+		return nil
+	}
+}
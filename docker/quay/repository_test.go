@@ -0,0 +1,131 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package quay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeQuay struct {
+	mu       sync.Mutex
+	repos    map[string]Visibility
+	expiries map[string]int64
+	requests []string
+}
+
+func newFakeQuay(t *testing.T) (*fakeQuay, *Client) {
+	t.Helper()
+
+	f := &fakeQuay{repos: map[string]Visibility{}, expiries: map[string]int64{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	return f, NewClient(srv.URL, "token", http.DefaultTransport)
+}
+
+func (f *fakeQuay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var body map[string]any
+	if r.Body != nil {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/repository")
+	switch {
+	case r.Method == http.MethodPost && path == "":
+		f.repos[fmt.Sprintf("%s/%s", body["namespace"], body["repository"])] = Visibility(
+			body["visibility"].(string),
+		)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/changevisibility"):
+		repo := strings.Trim(strings.TrimSuffix(path, "/changevisibility"), "/")
+		f.repos[repo] = Visibility(body["visibility"].(string))
+	case r.Method == http.MethodPut && strings.Contains(path, "/tag/"):
+		f.expiries[strings.Trim(path, "/")] = int64(body["expiration"].(float64))
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet:
+		visibility, ok := f.repos[strings.Trim(path, "/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]bool{"is_public": visibility == Public})
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestEnsureRepositoryFuncCreatesRepository(t *testing.T) {
+	t.Parallel()
+
+	f, client := newFakeQuay(t)
+
+	repo := name.MustParseReference("quay.io/mesosphere/library/nginx:latest").Context()
+	require.NoError(t, EnsureRepositoryFunc(client, Public)(repo))
+
+	assert.Equal(t, map[string]Visibility{"mesosphere/library/nginx": Public}, f.repos)
+}
+
+func TestEnsureRepositoryFuncChangesVisibility(t *testing.T) {
+	t.Parallel()
+
+	f, client := newFakeQuay(t)
+	f.repos["mesosphere/nginx"] = Private
+
+	repo := name.MustParseReference("quay.io/mesosphere/nginx:latest").Context()
+	require.NoError(t, EnsureRepositoryFunc(client, Public)(repo))
+
+	assert.Equal(t, map[string]Visibility{"mesosphere/nginx": Public}, f.repos)
+
+	// Visibility is already correct so no further change is made.
+	f.requests = nil
+	require.NoError(t, EnsureRepositoryFunc(client, Public)(repo))
+	assert.Equal(t, []string{"GET /api/v1/repository/mesosphere/nginx"}, f.requests)
+}
+
+func TestEnsureRepositoryFuncRequiresNamespace(t *testing.T) {
+	t.Parallel()
+
+	repo := name.MustParseReference("quay.io/nginx:latest").Context()
+	require.ErrorContains(
+		t,
+		EnsureRepositoryFunc(nil, "")(repo),
+		`"nginx" is not a valid Quay repository`,
+	)
+}
+
+func TestSetTagExpirationFunc(t *testing.T) {
+	t.Parallel()
+
+	f, client := newFakeQuay(t)
+
+	before := time.Now()
+	tag := name.MustParseReference("quay.io/mesosphere/library/nginx:1.21.5").(name.Tag)
+	require.NoError(t, SetTagExpirationFunc(client, 2*time.Hour)(tag))
+
+	expiry, ok := f.expiries["mesosphere/library/nginx/tag/1.21.5"]
+	require.True(t, ok)
+	assert.GreaterOrEqual(t, expiry, before.Add(2*time.Hour).Unix())
+	assert.LessOrEqual(t, expiry, time.Now().Add(2*time.Hour).Unix())
+}
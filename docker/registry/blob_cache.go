@@ -0,0 +1,161 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// blobPathRegexp matches requests to get blobs: /v2/<name>/blobs/<digest>.
+var blobPathRegexp = regexp.MustCompile(`^/v2/.+/blobs/[a-z0-9]+:[a-f0-9]+$`)
+
+// blobCache is an in-memory LRU cache of blobs, bounded by the total size of the cached blobs.
+type blobCache struct {
+	maxSize int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+
+	group singleflight.Group
+}
+
+type cachedBlob struct {
+	key     string
+	header  http.Header
+	content []byte
+}
+
+// withBlobCache serves blobs from an in-memory LRU cache of up to maxSize bytes, so that many clients
+// pulling the same images do not multiply disk reads. Concurrent requests for the same blob are
+// coalesced into a single read from the registry storage. Blobs that do not fit into the cache are
+// served by the registry directly. If authorize is set, e.g. if the registry requires tokens, blobs
+// are only served from the cache to requests the registry authorizes to get them.
+func withBlobCache(regHandler http.Handler, maxSize int64, authorize bool) http.Handler {
+	c := &blobCache{
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet || !blobPathRegexp.MatchString(req.URL.Path) {
+			regHandler.ServeHTTP(w, req)
+			return
+		}
+		// Blobs are only accessible via repositories they are linked to, so cache them per repository.
+		key := req.URL.Path
+
+		if authorize && !authorized(regHandler, req) {
+			regHandler.ServeHTTP(w, req)
+			return
+		}
+
+		blob, ok := c.get(key)
+		if !ok {
+			v, _, _ := c.group.Do(key, func() (any, error) {
+				// The blob may have been cached while waiting to read it.
+				if blob, ok := c.get(key); ok {
+					return blob, nil
+				}
+				blob := readBlob(regHandler, req, c.maxSize)
+				if blob != nil {
+					blob.key = key
+					c.add(blob)
+				}
+				return blob, nil
+			})
+			blob, _ = v.(*cachedBlob)
+			ok = blob != nil
+		}
+		if !ok {
+			regHandler.ServeHTTP(w, req)
+			return
+		}
+
+		for k, v := range blob.header {
+			w.Header()[k] = v
+		}
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(blob.content))
+	})
+}
+
+// readBlob reads the blob of the request from the registry, returning nil if it does not exist or is
+// larger than maxSize.
+func readBlob(regHandler http.Handler, req *http.Request, maxSize int64) *cachedBlob {
+	// Other requests may be waiting for the blob, so do not abort reading it if this request is
+	// cancelled.
+	ctx := context.WithoutCancel(req.Context())
+
+	headReq := req.Clone(ctx)
+	headReq.Method = http.MethodHead
+	headReq.Header.Del("Range")
+	rec := httptest.NewRecorder()
+	regHandler.ServeHTTP(rec, headReq)
+	size, err := strconv.ParseInt(rec.Header().Get("Content-Length"), 10, 64)
+	if rec.Code != http.StatusOK || err != nil || size > maxSize {
+		return nil
+	}
+
+	getReq := req.Clone(ctx)
+	getReq.Header.Del("Range")
+	rec = httptest.NewRecorder()
+	regHandler.ServeHTTP(rec, getReq)
+	if rec.Code != http.StatusOK || int64(rec.Body.Len()) != size {
+		return nil
+	}
+
+	header := rec.Header().Clone()
+	// Set by http.ServeContent when serving the blob.
+	header.Del("Content-Length")
+	return &cachedBlob{header: header, content: rec.Body.Bytes()}
+}
+
+// authorized returns true if the registry serves the blob of the request, checked with a HEAD
+// request.
+func authorized(regHandler http.Handler, req *http.Request) bool {
+	headReq := req.Clone(req.Context())
+	headReq.Method = http.MethodHead
+	headReq.Header.Del("Range")
+	rec := httptest.NewRecorder()
+	regHandler.ServeHTTP(rec, headReq)
+	return rec.Code == http.StatusOK
+}
+
+func (c *blobCache) get(key string) (*cachedBlob, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*cachedBlob), true
+}
+
+func (c *blobCache) add(blob *cachedBlob) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[blob.key]; ok {
+		return
+	}
+	for c.size+int64(len(blob.content)) > c.maxSize && c.lru.Len() > 0 {
+		evicted := c.lru.Remove(c.lru.Back()).(*cachedBlob)
+		delete(c.entries, evicted.key)
+		c.size -= int64(len(evicted.content))
+	}
+	c.entries[blob.key] = c.lru.PushFront(blob)
+	c.size += int64(len(blob.content))
+}
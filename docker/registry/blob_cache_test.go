@@ -0,0 +1,128 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBlobHandler serves blobs named by their digest hex, counting GET requests per blob.
+type fakeBlobHandler struct {
+	blobs   map[string][]byte
+	release chan struct{}
+	gets    sync.Map
+}
+
+func (h *fakeBlobHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	hex := req.URL.Path[strings.LastIndex(req.URL.Path, ":")+1:]
+	blob, ok := h.blobs[hex]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method == http.MethodGet {
+		n, _ := h.gets.LoadOrStore(hex, &atomic.Int32{})
+		n.(*atomic.Int32).Add(1)
+		if h.release != nil {
+			<-h.release
+		}
+	}
+	w.Header().Set("Docker-Content-Digest", "sha256:"+hex)
+	http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(blob))
+}
+
+func (h *fakeBlobHandler) getCount(hex string) int32 {
+	n, ok := h.gets.Load(hex)
+	if !ok {
+		return 0
+	}
+	return n.(*atomic.Int32).Load()
+}
+
+func TestBlobCacheCoalescesConcurrentRequests(t *testing.T) {
+	t.Parallel()
+	inner := &fakeBlobHandler{
+		blobs:   map[string][]byte{"aa": []byte("some blob")},
+		release: make(chan struct{}),
+	}
+	h := withBlobCache(inner, 1024, false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/some/image/blobs/sha256:aa", nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "some blob", rec.Body.String())
+			assert.Equal(t, "sha256:aa", rec.Header().Get("Docker-Content-Digest"))
+		}()
+	}
+	// Requests arriving after the blob has been read are served from the cache.
+	time.Sleep(50 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), inner.getCount("aa"))
+}
+
+func TestBlobCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+	inner := &fakeBlobHandler{blobs: map[string][]byte{
+		"aa": bytes.Repeat([]byte("a"), 40),
+		"bb": bytes.Repeat([]byte("b"), 40),
+		"cc": bytes.Repeat([]byte("c"), 40),
+		"dd": bytes.Repeat([]byte("d"), 200),
+	}}
+	h := withBlobCache(inner, 100, false)
+
+	get := func(hex, rangeHeader string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/v2/some/image/blobs/sha256:"+hex, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	get("aa", "")
+	get("bb", "")
+	get("aa", "")
+	// Evicts bb, the least recently used blob.
+	get("cc", "")
+	get("aa", "")
+	get("bb", "")
+	assert.Equal(t, int32(1), inner.getCount("aa"))
+	assert.Equal(t, int32(2), inner.getCount("bb"))
+	assert.Equal(t, int32(1), inner.getCount("cc"))
+
+	// Range requests are served from the cache.
+	rec := get("bb", "bytes=0-9")
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("b"), 10), body)
+	assert.Equal(t, int32(2), inner.getCount("bb"))
+
+	// Blobs larger than the cache are not cached.
+	assert.Equal(t, 200, get("dd", "").Body.Len())
+	assert.Equal(t, 200, get("dd", "").Body.Len())
+	assert.Equal(t, int32(2), inner.getCount("dd"))
+
+	assert.Equal(t, http.StatusNotFound, get("ee", "").Code)
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// maxManifestSize is the maximum size of manifests accepted by the registry.
+const maxManifestSize = 4 << 20
+
+// manifestPathRegexp matches requests to manifests: /v2/<name>/manifests/<reference>.
+var manifestPathRegexp = regexp.MustCompile(`^/v2/(.+)/manifests/([^/]+)$`)
+
+// withDigestAlgorithms accepts manifests pushed by digests using algorithms other than sha256, e.g.
+// sha512, which the embedded registry rejects as it addresses manifests by their sha256 digest
+// only. Such manifests are pushed to the registry by their sha256 digest and then linked under the
+// pushed digest in the storage directory, the same way the registry links blobs pushed by other
+// algorithms, so that they can be pulled, and referenced by indexes, by either digest.
+func withDigestAlgorithms(regHandler http.Handler, storageDirectory string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		matches := manifestPathRegexp.FindStringSubmatch(req.URL.Path)
+		if matches == nil || req.Method != http.MethodPut {
+			regHandler.ServeHTTP(w, req)
+			return
+		}
+		repository, pushed := matches[1], digest.Digest(matches[2])
+		if pushed.Validate() != nil || pushed.Algorithm() == digest.Canonical {
+			// Tags and sha256 digests are handled by the registry, which also rejects invalid
+			// digests.
+			regHandler.ServeHTTP(w, req)
+			return
+		}
+
+		manifest, err := io.ReadAll(io.LimitReader(req.Body, maxManifestSize+1))
+		if err != nil {
+			writeRegistryError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		if len(manifest) > maxManifestSize {
+			writeRegistryError(w, http.StatusRequestEntityTooLarge, "SIZE_INVALID", "manifest too large")
+			return
+		}
+		if pushed.Algorithm().FromBytes(manifest) != pushed {
+			writeRegistryError(w, http.StatusBadRequest, "DIGEST_INVALID", "manifest does not match digest")
+			return
+		}
+
+		canonical := digest.Canonical.FromBytes(manifest)
+		canonicalReq := req.Clone(req.Context())
+		canonicalReq.URL.Path = "/v2/" + repository + "/manifests/" + canonical.String()
+		canonicalReq.URL.RawPath = ""
+		canonicalReq.Body = io.NopCloser(bytes.NewReader(manifest))
+		canonicalReq.ContentLength = int64(len(manifest))
+		rec := httptest.NewRecorder()
+		regHandler.ServeHTTP(rec, canonicalReq)
+		if rec.Code != http.StatusCreated {
+			copyResponse(w, rec)
+			return
+		}
+
+		if err := linkManifest(storageDirectory, repository, pushed, canonical); err != nil {
+			writeRegistryError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+			return
+		}
+
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Docker-Content-Digest", pushed.String())
+		if location := rec.Header().Get("Location"); location != "" {
+			w.Header().Set("Location", strings.TrimSuffix(location, canonical.String())+pushed.String())
+		}
+		w.WriteHeader(rec.Code)
+		_, _ = w.Write(rec.Body.Bytes())
+	})
+}
+
+// linkManifest links the manifest stored by its canonical digest under its digest using another
+// algorithm, in the storage layout of the registry.
+func linkManifest(storageDirectory, repository string, dgst, canonical digest.Digest) error {
+	linkDir := filepath.Join(
+		storageDirectory, "docker", "registry", "v2", "repositories", filepath.FromSlash(repository),
+		"_manifests", "revisions", dgst.Algorithm().String(), dgst.Encoded(),
+	)
+	if err := os.MkdirAll(linkDir, 0o755); err != nil {
+		return fmt.Errorf("failed to link manifest %s: %w", dgst, err)
+	}
+	// Write via a temporary file so that the link is never read partially written.
+	f, err := os.CreateTemp(linkDir, ".link-*")
+	if err != nil {
+		return fmt.Errorf("failed to link manifest %s: %w", dgst, err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(canonical.String())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(linkDir, "link"))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to link manifest %s: %w", dgst, err)
+	}
+	return nil
+}
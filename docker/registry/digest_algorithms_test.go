@@ -0,0 +1,123 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pushSHA512Blob pushes the content as a blob addressed by its sha512 digest.
+func pushSHA512Blob(t *testing.T, repoURL, mediaType string, content []byte) ocispec.Descriptor {
+	t.Helper()
+
+	resp, err := http.Post(repoURL+"/blobs/uploads/", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	d := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.SHA512.FromBytes(content),
+		Size:      int64(len(content)),
+	}
+	query := location.Query()
+	query.Set("digest", d.Digest.String())
+	location.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodPut, location.String(), bytes.NewReader(content))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	return d
+}
+
+func putManifest(t *testing.T, repoURL, reference, mediaType string, manifest []byte) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(
+		http.MethodPut, repoURL+"/manifests/"+url.PathEscape(reference), bytes.NewReader(manifest),
+	)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", mediaType)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp
+}
+
+func TestRegistryDigestAlgorithms(t *testing.T) {
+	t.Parallel()
+	storageDir := t.TempDir()
+	reg, err := NewRegistry(Config{StorageDirectory: storageDir})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+	repoURL := fmt.Sprintf("http://%s/v2/some/image", reg.Address())
+
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    pushSHA512Blob(t, repoURL, ocispec.MediaTypeImageConfig, []byte(`{}`)),
+		Layers:    []ocispec.Descriptor{pushSHA512Blob(t, repoURL, ocispec.MediaTypeImageLayer, []byte("layer"))},
+	})
+	require.NoError(t, err)
+	manifestDigest := digest.SHA512.FromBytes(manifest)
+
+	resp := putManifest(
+		t, repoURL, digest.SHA512.FromString("other").String(), ocispec.MediaTypeImageManifest, manifest,
+	)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "manifests not matching the digest should be rejected")
+
+	resp = putManifest(t, repoURL, manifestDigest.String(), ocispec.MediaTypeImageManifest, manifest)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, manifestDigest.String(), resp.Header.Get("Docker-Content-Digest"))
+	assert.True(
+		t,
+		strings.HasSuffix(resp.Header.Get("Location"), "/v2/some/image/manifests/"+manifestDigest.String()),
+		"the location should refer to the pushed digest",
+	)
+
+	// The manifest is served by either digest by read-only registries, e.g. when pushing bundles.
+	readOnlyReg, err := NewRegistry(Config{StorageDirectory: storageDir, ReadOnly: true})
+	require.NoError(t, err)
+	_, err = readOnlyReg.Start(ctx)
+	require.NoError(t, err)
+	for _, dgst := range []digest.Digest{manifestDigest, digest.Canonical.FromBytes(manifest)} {
+		req, err := http.NewRequest(
+			http.MethodGet,
+			fmt.Sprintf("http://%s/v2/some/image/manifests/%s", readOnlyReg.Address(), dgst),
+			http.NoBody,
+		)
+		require.NoError(t, err)
+		req.Header.Set("Accept", ocispec.MediaTypeImageManifest)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, dgst)
+		assert.Equal(t, manifest, body, dgst)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/filesystem"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// StorageUsage is the number and total size of the blobs in registry storage.
+type StorageUsage struct {
+	Blobs int
+	Bytes int64
+}
+
+// Usage returns the number and total size of the blobs in the registry storage in dir. Blobs are
+// stored once per registry, no matter how many repositories they are part of.
+func Usage(dir string) (StorageUsage, error) {
+	var usage StorageUsage
+	err := filepath.WalkDir(
+		filepath.Join(dir, "docker", "registry", "v2", "blobs"),
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || d.Name() != "data" {
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			usage.Blobs++
+			usage.Bytes += fi.Size()
+			return nil
+		},
+	)
+	if err != nil {
+		return StorageUsage{}, fmt.Errorf("failed to read registry storage usage: %w", err)
+	}
+	return usage, nil
+}
+
+// GarbageCollect runs the garbage collection of distribution on the registry storage in dir, which
+// must not be served while collecting garbage. The manifests with the specified digests are deleted
+// from their repositories first, e.g. manifests that have been replaced by rewritten manifests, so
+// that their blobs are deleted unless referenced by other manifests. Untagged manifests are
+// otherwise kept, as the platform manifests of image indexes and signatures are never tagged.
+func GarbageCollect(ctx context.Context, dir string, deleteManifests map[string][]digest.Digest) error {
+	// The storage logs every deleted path at info level, which is not useful to users.
+	logrus.SetLevel(logrus.FatalLevel)
+
+	fsDriver := filesystem.New(filesystem.DriverParameters{
+		RootDirectory: dir,
+		MaxThreads:    100,
+	})
+	namespace, err := storage.NewRegistry(ctx, fsDriver, storage.EnableDelete)
+	if err != nil {
+		return fmt.Errorf("failed to open registry storage: %w", err)
+	}
+
+	vacuum := storage.NewVacuum(ctx, fsDriver)
+	for repo, digests := range deleteManifests {
+		for _, dgst := range digests {
+			err := vacuum.RemoveManifest(repo, dgst, nil)
+			if err != nil && !errors.As(err, &driver.PathNotFoundError{}) {
+				return fmt.Errorf("failed to delete manifest %s from repository %s: %w", dgst, repo, err)
+			}
+		}
+	}
+
+	// MarkAndSweep reports every marked and deleted blob on stdout, so discard stdout while it runs.
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", os.DevNull, err)
+	}
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+
+	if err := storage.MarkAndSweep(ctx, fsDriver, namespace, storage.GCOpts{}); err != nil {
+		return fmt.Errorf("failed to collect garbage in registry storage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"net/http"
+)
+
+const (
+	// HealthzPath is the path of the liveness endpoint, which reports healthy whenever the registry
+	// is serving requests.
+	HealthzPath = "/healthz"
+	// ReadyzPath is the path of the readiness endpoint, which reports ready once the registry
+	// content has been fully loaded, see Config.StartNotReady and Registry.MarkReady.
+	ReadyzPath = "/readyz"
+)
+
+// MarkReady marks the registry content as fully loaded, after which the readiness endpoint reports
+// ready and registry API requests are served.
+func (r *Registry) MarkReady() {
+	r.contentReady.Store(true)
+}
+
+// IsReady returns true if the registry content has been fully loaded.
+func (r *Registry) IsReady() bool {
+	return r.contentReady.Load()
+}
+
+func (r *Registry) withHealthEndpoints(regHandler http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(HealthzPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc(ReadyzPath, func(w http.ResponseWriter, _ *http.Request) {
+		if !r.IsReady() {
+			http.Error(w, "registry content is not loaded yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !r.IsReady() {
+			http.Error(w, "registry content is not loaded yet", http.StatusServiceUnavailable)
+			return
+		}
+		regHandler.ServeHTTP(w, req)
+	}))
+	return mux
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsPath is the path of the Prometheus metrics endpoint, served when Config.Metrics is enabled.
+const MetricsPath = "/metrics"
+
+const metricsNamespace = "mindthegap_registry"
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Total number of HTTP requests handled by the registry, by method and status code.",
+	}, []string{"method", "code"})
+	imagePullsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "image_pulls_total",
+		Help:      "Total number of successful manifest pulls, by repository.",
+	}, []string{"repository"})
+	blobBytesServedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "blob_bytes_served_total",
+		Help:      "Total number of blob bytes served, by repository.",
+	}, []string{"repository"})
+	errorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_errors_total",
+		Help:      "Total number of HTTP requests that resulted in an error response, by status code.",
+	}, []string{"code"})
+
+	registerMetricsOnce sync.Once
+
+	// registryAPIPathRegexp extracts the repository name and API resource from registry API paths.
+	registryAPIPathRegexp = regexp.MustCompile(`^/v2/(.+)/(manifests|blobs)/[^/]+$`)
+)
+
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		prometheus.MustRegister(requestsTotal, imagePullsTotal, blobBytesServedTotal, errorsTotal)
+	})
+}
+
+// MetricsHandler returns a handler serving all registered Prometheus metrics, including those
+// of the distribution registry instrumentation.
+func MetricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+func withMetrics(h http.Handler) http.Handler {
+	registerMetrics()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rw := &statusRecordingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		h.ServeHTTP(rw, req)
+
+		code := strconv.Itoa(rw.statusCode)
+		requestsTotal.WithLabelValues(req.Method, code).Inc()
+		if rw.statusCode >= http.StatusBadRequest {
+			errorsTotal.WithLabelValues(code).Inc()
+			return
+		}
+
+		if req.Method != http.MethodGet {
+			return
+		}
+		matches := registryAPIPathRegexp.FindStringSubmatch(req.URL.Path)
+		if matches == nil {
+			return
+		}
+		switch matches[2] {
+		case "manifests":
+			imagePullsTotal.WithLabelValues(matches[1]).Inc()
+		case "blobs":
+			blobBytesServedTotal.WithLabelValues(matches[1]).Add(float64(rw.bytesWritten))
+		}
+	})
+}
+
+type statusRecordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode   int
+	bytesWritten int64
+	wroteHeader  bool
+}
+
+func (w *statusRecordingResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.statusCode = statusCode
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusRecordingResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytesWritten += int64(n)
+	return n, err
+}
+
+func (w *statusRecordingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
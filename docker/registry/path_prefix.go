@@ -0,0 +1,69 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"net/http"
+	"strings"
+)
+
+// forwardedHeaders are the headers that reverse proxies describe the URL that clients requested with,
+// which the registry derives URLs in Location headers from.
+var forwardedHeaders = []string{"Forwarded", "X-Forwarded-Proto", "X-Forwarded-Host"}
+
+// normalizePathPrefix returns the path prefix with a leading and trailing slash, as used for the
+// distribution http.prefix, or an empty string if the prefix is empty.
+func normalizePathPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix + "/"
+}
+
+// withPathPrefix serves the handler under the path prefix, stripping the prefix from request paths
+// so that the handler routes requests by their registry API paths. Requests for paths without the
+// prefix are not found.
+func withPathPrefix(handler http.Handler, prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path, ok := strings.CutPrefix(req.URL.Path, prefix)
+		if !ok || !strings.HasPrefix(path, "/") {
+			http.NotFound(w, req)
+			return
+		}
+		req = req.Clone(req.Context())
+		req.URL.Path, req.URL.RawPath = path, ""
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// withRestoredPathPrefix adds the path prefix stripped by withPathPrefix back to request paths for
+// the distribution registry handlers, which are configured with the prefix to route requests and
+// derive URLs in Location headers from request paths.
+func withRestoredPathPrefix(regHandler http.Handler, prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req = req.Clone(req.Context())
+		req.URL.Path, req.URL.RawPath = prefix+req.URL.Path, ""
+		regHandler.ServeHTTP(w, req)
+	})
+}
+
+// withoutForwardedHeaders removes the headers set by reverse proxies from requests, so that clients
+// cannot make the registry derive URLs in Location headers from spoofed headers.
+func withoutForwardedHeaders(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for _, h := range forwardedHeaders {
+			if _, ok := req.Header[h]; ok {
+				req = req.Clone(req.Context())
+				for _, h := range forwardedHeaders {
+					req.Header.Del(h)
+				}
+				break
+			}
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func Test_registryConfiguration_withPathPrefixAndPublicURL(t *testing.T) {
+	t.Parallel()
+	c := Config{
+		StorageDirectory: "/tmp",
+		Host:             "0.0.0.0",
+		Port:             5000,
+		ReadOnly:         true,
+		PathPrefix:       "bundle-registry",
+		PublicURL:        "https://apps.example.com/bundle-registry",
+	}
+
+	config, err := registryConfiguration(c)
+	require.NoError(t, err)
+	assert.Contains(t, config, `
+http:
+  net: tcp
+  addr: 0.0.0.0:5000
+  prefix: /bundle-registry/
+  host: https://apps.example.com/bundle-registry/
+`)
+}
+
+func TestRegistryPathPrefix(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		config       Config
+		headers      map[string]string
+		wantLocation string
+	}{{
+		name:         "location derived from request",
+		config:       Config{PathPrefix: "/bundle-registry/"},
+		wantLocation: "http://{addr}/bundle-registry/v2/library/image/blobs/uploads/",
+	}, {
+		name:         "forwarded headers",
+		config:       Config{PathPrefix: "/bundle-registry/"},
+		headers:      map[string]string{"X-Forwarded-Host": "apps.example.com", "X-Forwarded-Proto": "https"},
+		wantLocation: "https://apps.example.com/bundle-registry/v2/library/image/blobs/uploads/",
+	}, {
+		name:         "ignored forwarded headers",
+		config:       Config{PathPrefix: "/bundle-registry/", IgnoreForwardedHeaders: true},
+		headers:      map[string]string{"X-Forwarded-Host": "spoofed.example.com"},
+		wantLocation: "http://{addr}/bundle-registry/v2/library/image/blobs/uploads/",
+	}, {
+		name: "public URL",
+		config: Config{
+			PathPrefix: "/bundle-registry/",
+			PublicURL:  "https://apps.example.com/bundle-registry",
+		},
+		headers:      map[string]string{"X-Forwarded-Host": "other.example.com"},
+		wantLocation: "https://apps.example.com/bundle-registry/v2/library/image/blobs/uploads/",
+	}, {
+		name: "public URL of reverse proxy stripping the prefix",
+		config: Config{
+			PublicURL: "https://apps.example.com/bundle-registry/",
+		},
+		wantLocation: "https://apps.example.com/bundle-registry/v2/library/image/blobs/uploads/",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := tt.config
+			cfg.StorageDirectory = t.TempDir()
+			reg, err := NewRegistry(cfg)
+			require.NoError(t, err)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			_, err = reg.Start(ctx)
+			require.NoError(t, err)
+
+			pathPrefix := normalizePathPrefix(cfg.PathPrefix)
+			root := pathPrefix
+			if root == "" {
+				root = "/"
+			}
+			uploadURL := fmt.Sprintf("http://%s%sv2/library/image/blobs/uploads/", reg.Address(), root)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, http.NoBody)
+			require.NoError(t, err)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			require.Equal(t, http.StatusAccepted, resp.StatusCode)
+			assert.Contains(
+				t, resp.Header.Get("Location"), strings.ReplaceAll(tt.wantLocation, "{addr}", reg.Address()),
+			)
+
+			// Health endpoints are always served at the root.
+			resp, err = http.Get(fmt.Sprintf("http://%s%s", reg.Address(), HealthzPath))
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			if pathPrefix != "" {
+				resp, err = http.Get(fmt.Sprintf("http://%s/v2/", reg.Address()))
+				require.NoError(t, err)
+				_ = resp.Body.Close()
+				assert.Equal(
+					t, http.StatusNotFound, resp.StatusCode, "registry API should only be served under the prefix",
+				)
+			}
+		})
+	}
+}
+
+func TestRegistryPathPrefixTokenAuth(t *testing.T) {
+	t.Parallel()
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("s3cr3t"), bcrypt.MinCost)
+	require.NoError(t, err)
+	usersFile := filepath.Join(t.TempDir(), "htpasswd")
+	require.NoError(t, os.WriteFile(usersFile, []byte("ci:"+string(passwordHash)+"\n"), 0o600))
+	users, err := NewUsersFileAuthenticator(usersFile)
+	require.NoError(t, err)
+
+	reg, err := NewRegistry(Config{
+		StorageDirectory: t.TempDir(),
+		ReadOnly:         true,
+		PathPrefix:       "bundle-registry",
+		TokenAuth:        &TokenAuth{Authenticators: []Authenticator{users}},
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/bundle-registry/v2/", reg.Address()))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	realm := fmt.Sprintf("http://%s/bundle-registry%s", reg.Address(), TokenPath)
+	assert.Contains(t, resp.Header.Get("WWW-Authenticate"), fmt.Sprintf("realm=%q", realm))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?service="+DefaultTokenAuthService, http.NoBody)
+	require.NoError(t, err)
+	req.SetBasicAuth("ci", "s3cr3t")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
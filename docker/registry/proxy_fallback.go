@@ -0,0 +1,88 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ProxyFallback configures an upstream registry to proxy requests for content that is not in the
+// registry storage to.
+type ProxyFallback struct {
+	// RemoteURL is the URL of the upstream registry, e.g. https://registry-1.docker.io.
+	RemoteURL string
+	Username  string
+	Password  string
+	// TTL is the time content pulled from the upstream registry is cached in the registry storage
+	// for, or forever if zero.
+	TTL time.Duration
+}
+
+// withProxyFallback serves reads from local and only proxies them to the pull-through cache proxy if
+// local does not have the requested content. Unlike serving all requests from the pull-through cache,
+// content in local is always served as is, even if tags have since been moved in the upstream registry.
+func withProxyFallback(local, proxy http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if (req.Method != http.MethodGet && req.Method != http.MethodHead) ||
+			!strings.HasPrefix(req.URL.Path, "/v2/") || req.URL.Path == "/v2/" || req.URL.Path == catalogPath {
+			local.ServeHTTP(w, req)
+			return
+		}
+
+		fw := &fallbackResponseWriter{ResponseWriter: w, header: http.Header{}}
+		local.ServeHTTP(fw, req)
+		if fw.notFound {
+			proxy.ServeHTTP(w, req)
+		}
+	})
+}
+
+// fallbackResponseWriter passes a response through unless it is a not found response, which is
+// discarded so that the request can be served by another handler instead.
+type fallbackResponseWriter struct {
+	http.ResponseWriter
+	header      http.Header
+	wroteHeader bool
+	notFound    bool
+}
+
+func (w *fallbackResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *fallbackResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if statusCode == http.StatusNotFound {
+		w.notFound = true
+		return
+	}
+	for k, v := range w.header {
+		w.ResponseWriter.Header()[k] = v
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *fallbackResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.notFound {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *fallbackResponseWriter) Flush() {
+	if w.notFound {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryProxyFallback(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	storageDir := t.TempDir()
+	localReg, err := NewRegistry(Config{StorageDirectory: storageDir})
+	require.NoError(t, err)
+	_, err = localReg.Start(ctx)
+	require.NoError(t, err)
+	upstreamReg, err := NewRegistry(Config{StorageDirectory: t.TempDir()})
+	require.NoError(t, err)
+	_, err = upstreamReg.Start(ctx)
+	require.NoError(t, err)
+
+	localImg, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	upstreamImg, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	for reg, img := range map[*Registry]v1.Image{localReg: localImg, upstreamReg: upstreamImg} {
+		ref, err := name.ParseReference(reg.Address()+"/library/nginx:v1", name.Insecure)
+		require.NoError(t, err)
+		require.NoError(t, remote.Write(ref, img))
+	}
+	upstreamRef, err := name.ParseReference(upstreamReg.Address()+"/other:v1", name.Insecure)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(upstreamRef, upstreamImg))
+
+	reg, err := NewRegistry(Config{
+		StorageDirectory: storageDir,
+		ReadOnly:         true,
+		ProxyFallback:    &ProxyFallback{RemoteURL: "http://" + upstreamReg.Address()},
+	})
+	require.NoError(t, err)
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+
+	registry, err := name.NewRegistry(reg.Address(), name.Insecure)
+	require.NoError(t, err)
+
+	// Images in the registry storage are served as is, even though the tag points elsewhere upstream.
+	img, err := remote.Image(registry.Repo("library", "nginx").Tag("v1"))
+	require.NoError(t, err)
+	gotDigest, err := img.Digest()
+	require.NoError(t, err)
+	wantDigest, err := localImg.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, wantDigest, gotDigest)
+
+	// Images that are not in the registry storage are proxied from upstream.
+	img, err = remote.Image(registry.Repo("other").Tag("v1"))
+	require.NoError(t, err)
+	gotDigest, err = img.Digest()
+	require.NoError(t, err)
+	wantDigest, err = upstreamImg.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, wantDigest, gotDigest)
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	_, err = layers[0].Compressed()
+	require.NoError(t, err)
+
+	// Pushes are still rejected.
+	pushRef, err := name.ParseReference(reg.Address()+"/pushed:v1", name.Insecure)
+	require.NoError(t, err)
+	require.Error(t, remote.Write(pushRef, localImg))
+}
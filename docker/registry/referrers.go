@@ -0,0 +1,110 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// referrersPathRegexp matches requests to the OCI 1.1 referrers API: /v2/<name>/referrers/<digest>.
+var referrersPathRegexp = regexp.MustCompile(`^/v2/(.+)/referrers/([^/]+)$`)
+
+// withReferrers serves the OCI 1.1 referrers API, which the embedded registry does not support, from
+// the referrers tag schema: clients that push artifacts with a subject to a registry that does not
+// support the referrers API maintain an index of the referrers of every manifest in the tag
+// `<alg>-<hex>` of its digest. This makes signatures and attestations in bundles discoverable via
+// the referrers API when serving them. Clients stop maintaining the referrers tag once the
+// referrers API is supported, so this must only be used for read-only registries.
+func withReferrers(regHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		matches := referrersPathRegexp.FindStringSubmatch(req.URL.Path)
+		if matches == nil || req.Method != http.MethodGet {
+			regHandler.ServeHTTP(w, req)
+			return
+		}
+		repository, digest := matches[1], matches[2]
+
+		hash, err := v1.NewHash(digest)
+		if err != nil {
+			writeRegistryError(w, http.StatusBadRequest, "DIGEST_INVALID", "invalid digest")
+			return
+		}
+
+		// Get the referrers tag from the registry, which returns an error if the repository does
+		// not exist.
+		tagReq := req.Clone(req.Context())
+		tagReq.URL.Path = "/v2/" + repository + "/manifests/" + hash.Algorithm + "-" + hash.Hex
+		tagReq.URL.RawPath = ""
+		tagReq.URL.RawQuery = ""
+		tagReq.Header.Set("Accept", string(types.OCIImageIndex))
+		rec := httptest.NewRecorder()
+		regHandler.ServeHTTP(rec, tagReq)
+
+		index := v1.IndexManifest{
+			SchemaVersion: 2,
+			MediaType:     types.OCIImageIndex,
+			Manifests:     []v1.Descriptor{},
+		}
+		switch {
+		case rec.Code == http.StatusOK:
+			var tagIndex v1.IndexManifest
+			if err := json.Unmarshal(rec.Body.Bytes(), &tagIndex); err != nil {
+				writeRegistryError(w, http.StatusInternalServerError, "UNKNOWN", "invalid referrers index")
+				return
+			}
+			index.Manifests = append(index.Manifests, tagIndex.Manifests...)
+		case rec.Code == http.StatusNotFound && strings.Contains(rec.Body.String(), "MANIFEST_UNKNOWN"):
+			// No referrers.
+		default:
+			copyResponse(w, rec)
+			return
+		}
+
+		if artifactType := req.URL.Query().Get("artifactType"); artifactType != "" {
+			filtered := index.Manifests[:0]
+			for _, desc := range index.Manifests {
+				if desc.ArtifactType == artifactType {
+					filtered = append(filtered, desc)
+				}
+			}
+			index.Manifests = filtered
+			w.Header().Set("OCI-Filters-Applied", "artifactType")
+		}
+
+		b, err := json.Marshal(index)
+		if err != nil {
+			writeRegistryError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", string(types.OCIImageIndex))
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(b)
+	})
+}
+
+// writeRegistryError writes an error response in the format of the distribution spec.
+func writeRegistryError(w http.ResponseWriter, statusCode int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+func copyResponse(w http.ResponseWriter, rec *httptest.ResponseRecorder) {
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+	_, _ = w.Write(rec.Body.Bytes())
+}
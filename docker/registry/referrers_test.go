@@ -0,0 +1,93 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryReferrers(t *testing.T) {
+	t.Parallel()
+	storageDir := t.TempDir()
+	reg, err := NewRegistry(Config{StorageDirectory: storageDir})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(reg.Address()+"/some/image:v1", name.Insecure)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	imgDigest, err := img.Digest()
+	require.NoError(t, err)
+	imgDesc, err := remote.Head(ref)
+	require.NoError(t, err)
+
+	// Push an artifact referring to the image, which updates the referrers tag.
+	artifact := mutate.ConfigMediaType(
+		mutate.MediaType(empty.Image, types.OCIManifestSchema1),
+		"application/vnd.example.signature",
+	)
+	artifact = mutate.Subject(artifact, *imgDesc).(v1.Image)
+	artifactDigest, err := artifact.Digest()
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref.Context().Digest(artifactDigest.String()), artifact))
+
+	// The referrers API is only served by read-only registries.
+	readOnlyReg, err := NewRegistry(Config{StorageDirectory: storageDir, ReadOnly: true})
+	require.NoError(t, err)
+	_, err = readOnlyReg.Start(ctx)
+	require.NoError(t, err)
+
+	getReferrers := func(digest, query string) (int, http.Header, v1.IndexManifest) {
+		t.Helper()
+		resp, err := http.Get(
+			fmt.Sprintf("http://%s/v2/some/image/referrers/%s%s", readOnlyReg.Address(), digest, query),
+		)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var index v1.IndexManifest
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&index))
+		}
+		return resp.StatusCode, resp.Header, index
+	}
+
+	code, header, index := getReferrers(imgDigest.String(), "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, string(types.OCIImageIndex), header.Get("Content-Type"))
+	require.Len(t, index.Manifests, 1)
+	assert.Equal(t, artifactDigest, index.Manifests[0].Digest)
+	assert.Equal(t, "application/vnd.example.signature", index.Manifests[0].ArtifactType)
+
+	code, header, index = getReferrers(imgDigest.String(), "?artifactType=application/vnd.other")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "artifactType", header.Get("OCI-Filters-Applied"))
+	assert.Empty(t, index.Manifests)
+
+	code, _, index = getReferrers(artifactDigest.String(), "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, index.Manifests)
+
+	code, _, _ = getReferrers("invalid", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -8,8 +8,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
@@ -20,12 +24,50 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// defaultShutdownGracePeriod is the time allowed for in-flight requests to complete when the
+// registry is shut down because the context passed to ListenAndServe is done.
+const defaultShutdownGracePeriod = 5 * time.Second
+
 type Config struct {
 	StorageDirectory string
 	Host             string
 	Port             uint16
-	ReadOnly         bool
-	TLS              TLS
+	// MaxPort listens on the first free port from Port to MaxPort, inclusive, if set.
+	MaxPort  uint16
+	ReadOnly bool
+	TLS      TLS
+	// StartNotReady makes the registry report not ready and reject registry API requests until
+	// MarkReady is called, e.g. while the registry storage is still being populated.
+	StartNotReady bool
+	// Metrics enables Prometheus instrumentation of the registry, served on MetricsPath unless
+	// MetricsOnSeparateListener is set, in which case use MetricsHandler to serve them elsewhere.
+	Metrics                   bool
+	MetricsOnSeparateListener bool
+	// BlobCacheSize is the maximum total size in bytes of blobs to cache in memory, coalescing
+	// concurrent requests for the same blob, if set. Only use for read-only registries.
+	BlobCacheSize int64
+	// RepositoryPrefix exposes all repositories under the prefix if set, e.g. `platform/` exposes
+	// repository `library/nginx` as `platform/library/nginx`.
+	RepositoryPrefix string
+	// ProxyFallback proxies requests for content that is not in the registry storage to an upstream
+	// registry if set, caching the proxied content in the registry storage. Content in the registry
+	// storage is always served as is, and pushes are still rejected if ReadOnly is set.
+	ProxyFallback *ProxyFallback
+	// TokenAuth requires clients to authenticate with bearer tokens of the distribution token auth
+	// scheme if set.
+	TokenAuth *TokenAuth
+	// PathPrefix serves the registry API and the built-in token issuer under the path prefix if set,
+	// e.g. `/bundle-registry/` behind a reverse proxy that does not strip the prefix, configuring the
+	// distribution `http.prefix`. Health and metrics endpoints are still served at the root.
+	PathPrefix string
+	// PublicURL is the URL that clients reach the registry at if set, e.g. the URL of a reverse proxy
+	// such as https://apps.example.com/bundle-registry/, which URLs in Location headers and the token
+	// auth realm are derived from instead of from requests, configuring the distribution `http.host`.
+	PublicURL string
+	// IgnoreForwardedHeaders removes the Forwarded, X-Forwarded-Proto and X-Forwarded-Host headers
+	// from requests, so that clients cannot spoof the URLs in Location headers that are otherwise
+	// derived from these headers if PublicURL is not set.
+	IgnoreForwardedHeaders bool
 }
 
 type TLS struct {
@@ -60,11 +102,22 @@ storage:
 http:
   net: tcp
   addr: {{ .Host }}:{{ .Port }}
+  {{- if .PathPrefix }}
+  prefix: {{ .PathPrefix }}
+  {{- end }}
+  {{- if .PublicURL }}
+  host: {{ .PublicURL }}
+  {{- end }}
   {{- if .TLSCertificate }}
   tls:
     certificate: {{ .TLSCertificate }}
     key: {{ .TLSKey }}
   {{- end }}
+  {{- if .Metrics }}
+  debug:
+    prometheus:
+      enabled: true
+  {{- end }}
 log:
   accesslog:
     disabled: true
@@ -79,10 +132,7 @@ log:
 		port = uint16(freePort)
 	}
 
-	host := "127.0.0.1"
-	if c.Host != "" {
-		host = c.Host
-	}
+	host := c.host()
 
 	tmpl := template.New("registryConfig")
 	template.Must(tmpl.Parse(configTmpl))
@@ -94,60 +144,255 @@ log:
 		ReadOnly         bool
 		TLSCertificate   string
 		TLSKey           string
-	}{c.StorageDirectory, host, port, c.ReadOnly, c.TLS.Certificate, c.TLS.Key}); err != nil {
+		Metrics          bool
+		PathPrefix       string
+		PublicURL        string
+	}{
+		c.StorageDirectory, host, port, c.ReadOnly, c.TLS.Certificate, c.TLS.Key, c.Metrics,
+		normalizePathPrefix(c.PathPrefix), c.publicURL(),
+	}); err != nil {
 		return "", fmt.Errorf("failed to render registry configuration: %w", err)
 	}
 
 	return buf.String(), nil
 }
 
+// publicURL returns the public URL with a trailing slash, so that URLs of the registry API are
+// resolved below its path.
+func (c Config) publicURL() string {
+	if c.PublicURL == "" || strings.HasSuffix(c.PublicURL, "/") {
+		return c.PublicURL
+	}
+	return c.PublicURL + "/"
+}
+
+func (c Config) host() string {
+	if c.Host != "" {
+		return c.Host
+	}
+	return "127.0.0.1"
+}
+
 type Registry struct {
-	config   *configuration.Configuration
-	delegate *http.Server
-	address  string
+	config    *configuration.Configuration
+	delegate  *http.Server
+	address   string
+	listener  net.Listener
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	contentReady atomic.Bool
 }
 
-func NewRegistry(cfg Config) (*Registry, error) {
+// NewRegistry creates a registry from the configuration. If a port range is configured, the
+// registry already listens on the first free port of the range, so that the port cannot be taken
+// before the registry is started; the listener is released by Shutdown if the registry is never
+// started.
+func NewRegistry(cfg Config) (_ *Registry, err error) {
+	var l net.Listener
+	if cfg.MaxPort != 0 {
+		l, err = listenOnFirstFreePort(cfg.host(), cfg.Port, cfg.MaxPort)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err != nil {
+				_ = l.Close()
+			}
+		}()
+		cfg.Port = uint16(l.Addr().(*net.TCPAddr).Port)
+	}
+
 	registryConfig, err := cfg.ToRegistryConfiguration()
 	if err != nil {
 		return nil, err
 	}
 
+	var issuer *tokenIssuer
+	if cfg.TokenAuth != nil {
+		var cleanupTokenAuth func()
+		issuer, cleanupTokenAuth, err = configureTokenAuth(
+			registryConfig, *cfg.TokenAuth, cfg.TLS.Certificate != "", cfg.RepositoryPrefix,
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanupTokenAuth()
+	}
+
 	logrus.SetLevel(logrus.FatalLevel)
 	regHandler := handlers.NewApp(context.Background(), registryConfig)
 
-	reg := &http.Server{
+	r := &Registry{
+		config:   registryConfig,
+		address:  registryConfig.HTTP.Addr,
+		listener: l,
+		ready:    make(chan struct{}),
+	}
+	r.contentReady.Store(!cfg.StartNotReady)
+
+	pathPrefix := normalizePathPrefix(cfg.PathPrefix)
+	var handler http.Handler = regHandler
+	if pathPrefix != "" {
+		handler = withRestoredPathPrefix(handler, pathPrefix)
+	}
+	if !cfg.ReadOnly {
+		handler = withDigestAlgorithms(handler, cfg.StorageDirectory)
+	}
+	if cfg.ProxyFallback != nil {
+		proxyConfig := *registryConfig
+		proxyConfig.Proxy = configuration.Proxy{
+			RemoteURL: cfg.ProxyFallback.RemoteURL,
+			Username:  cfg.ProxyFallback.Username,
+			Password:  cfg.ProxyFallback.Password,
+			TTL:       &cfg.ProxyFallback.TTL,
+		}
+		var proxyHandler http.Handler = handlers.NewApp(context.Background(), &proxyConfig)
+		if pathPrefix != "" {
+			proxyHandler = withRestoredPathPrefix(proxyHandler, pathPrefix)
+		}
+		handler = withProxyFallback(handler, proxyHandler)
+	}
+	if cfg.ReadOnly {
+		// Clients only maintain the referrers tag schema that the referrers API is served from if
+		// the registry does not support the referrers API, so only serve it if nothing can be pushed.
+		handler = withReferrers(handler)
+	}
+	if cfg.BlobCacheSize > 0 {
+		handler = withBlobCache(handler, cfg.BlobCacheSize, cfg.TokenAuth != nil)
+	}
+	if strings.Trim(cfg.RepositoryPrefix, "/") != "" {
+		handler = withRepositoryPrefix(handler, cfg.RepositoryPrefix)
+	}
+	if cfg.Metrics {
+		handler = withMetrics(handler)
+	}
+	if issuer != nil {
+		handler = withTokenIssuer(handler, issuer)
+	}
+	if pathPrefix != "" {
+		handler = withPathPrefix(handler, pathPrefix)
+	}
+	handler = r.withHealthEndpoints(handler)
+	if cfg.Metrics && !cfg.MetricsOnSeparateListener {
+		mux := http.NewServeMux()
+		mux.Handle(MetricsPath, MetricsHandler())
+		mux.Handle("/", handler)
+		handler = mux
+	}
+	if cfg.IgnoreForwardedHeaders {
+		handler = withoutForwardedHeaders(handler)
+	}
+
+	r.delegate = &http.Server{
 		Addr:              registryConfig.HTTP.Addr,
-		Handler:           regHandler,
+		Handler:           handler,
 		ReadHeaderTimeout: 1 * time.Second,
 	}
 
-	return &Registry{
-		config:   registryConfig,
-		delegate: reg,
-		address:  registryConfig.HTTP.Addr,
-	}, nil
+	return r, nil
 }
 
-func (r Registry) Address() string {
+func (r *Registry) Address() string {
 	return r.address
 }
 
-func (r Registry) Shutdown(ctx context.Context) error {
-	return r.delegate.Shutdown(ctx)
+// Ready returns a channel that is closed once the registry is listening for connections.
+func (r *Registry) Ready() <-chan struct{} {
+	return r.ready
+}
+
+// Shutdown gracefully shuts down the registry, waiting for in-flight requests to complete
+// until ctx is done.
+func (r *Registry) Shutdown(ctx context.Context) error {
+	err := r.delegate.Shutdown(ctx)
+	if r.listener != nil {
+		// Release the port of a registry that has never been started, which is a no-op otherwise
+		// as the listener is then closed by the server.
+		_ = r.listener.Close()
+	}
+	return err
 }
 
-func (r Registry) ListenAndServe() error {
+// ListenAndServe listens on the configured address and serves the registry until either
+// Shutdown is called or ctx is done (e.g. cancelled or its deadline exceeded), in which case the
+// registry is shut down gracefully.
+func (r *Registry) ListenAndServe(ctx context.Context) error {
+	l := r.listener
+	if l == nil {
+		var err error
+		l, err = net.Listen("tcp", r.address)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", r.address, err)
+		}
+	}
+	r.readyOnce.Do(func() { close(r.ready) })
+
+	shutdownErrCh := make(chan error, 1)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// ctx is already done so give in-flight requests a grace period to complete.
+			shutdownCtx, cancel := context.WithTimeout(
+				context.WithoutCancel(ctx), defaultShutdownGracePeriod,
+			)
+			defer cancel()
+			shutdownErrCh <- r.Shutdown(shutdownCtx)
+		case <-stopCh:
+			shutdownErrCh <- nil
+		}
+	}()
+
 	var err error
 	if r.config.HTTP.TLS.Certificate != "" && r.config.HTTP.TLS.Key != "" {
-		err = r.delegate.ListenAndServeTLS(r.config.HTTP.TLS.Certificate, r.config.HTTP.TLS.Key)
+		err = r.delegate.ServeTLS(l, r.config.HTTP.TLS.Certificate, r.config.HTTP.TLS.Key)
 	} else {
-		err = r.delegate.ListenAndServe()
+		err = r.delegate.Serve(l)
 	}
 
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 
+	if ctx.Err() != nil {
+		return <-shutdownErrCh
+	}
+
 	return nil
 }
+
+// Start starts the registry in the background and blocks until it is listening for connections.
+// Any error that occurs while serving is sent on the returned channel, which is closed once the
+// registry has stopped. The registry is shut down gracefully when ctx is done.
+func (r *Registry) Start(ctx context.Context) (<-chan error, error) {
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		if err := r.ListenAndServe(ctx); err != nil {
+			errCh <- err
+		}
+	}()
+
+	select {
+	case <-r.ready:
+		return errCh, nil
+	case err := <-errCh:
+		return nil, err
+	}
+}
+
+// listenOnFirstFreePort listens on the first port from first to last, inclusive, that is free.
+func listenOnFirstFreePort(host string, first, last uint16) (net.Listener, error) {
+	if first == 0 || last < first {
+		return nil, fmt.Errorf("invalid port range %d-%d", first, last)
+	}
+	for port := int(first); port <= int(last); port++ {
+		l, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err == nil {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("no free port to listen on %s in port range %d-%d", host, first, last)
+}
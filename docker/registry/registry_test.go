@@ -4,7 +4,14 @@
 package registry
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -83,3 +90,176 @@ func Test_registryConfiguration_withTLS(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, configWithTLS, config)
 }
+
+func TestRegistryStartAndShutdownOnContextDone(t *testing.T) {
+	t.Parallel()
+	reg, err := NewRegistry(Config{StorageDirectory: t.TempDir()})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh, err := reg.Start(ctx)
+	require.NoError(t, err)
+
+	select {
+	case <-reg.Ready():
+	default:
+		t.Fatal("expected registry to be ready after Start returns")
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/v2/", reg.Address()))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cancel()
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for registry to shut down")
+	}
+
+	_, err = http.Get(fmt.Sprintf("http://%s/v2/", reg.Address()))
+	require.Error(t, err)
+}
+
+func TestRegistryStartReturnsListenError(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	reg, err := NewRegistry(Config{
+		StorageDirectory: t.TempDir(),
+		Port:             uint16(l.Addr().(*net.TCPAddr).Port),
+	})
+	require.NoError(t, err)
+
+	_, err = reg.Start(context.Background())
+	require.ErrorContains(t, err, "failed to listen on")
+}
+
+func TestRegistryListensOnFirstFreePortInRange(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	usedPort := uint16(l.Addr().(*net.TCPAddr).Port)
+
+	_, err = NewRegistry(Config{StorageDirectory: t.TempDir(), Port: usedPort, MaxPort: usedPort})
+	require.ErrorContains(
+		t, err, fmt.Sprintf("no free port to listen on 127.0.0.1 in port range %d-%d", usedPort, usedPort),
+	)
+
+	// Ephemeral ports are never at the top of the port range.
+	maxPort := usedPort + 20
+	reg, err := NewRegistry(Config{StorageDirectory: t.TempDir(), Port: usedPort, MaxPort: maxPort})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+
+	_, portStr, err := net.SplitHostPort(reg.Address())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+	require.Greater(t, port, int(usedPort))
+	require.LessOrEqual(t, port, int(maxPort))
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/v2/", reg.Address()))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRegistryHealthEndpoints(t *testing.T) {
+	t.Parallel()
+	reg, err := NewRegistry(Config{StorageDirectory: t.TempDir(), StartNotReady: true})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+
+	statusCode := func(path string) int {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("http://%s%s", reg.Address(), path))
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	require.Equal(t, http.StatusOK, statusCode(HealthzPath))
+	require.Equal(t, http.StatusServiceUnavailable, statusCode(ReadyzPath))
+	require.Equal(t, http.StatusServiceUnavailable, statusCode("/v2/"))
+
+	reg.MarkReady()
+
+	require.Equal(t, http.StatusOK, statusCode(HealthzPath))
+	require.Equal(t, http.StatusOK, statusCode(ReadyzPath))
+	require.Equal(t, http.StatusOK, statusCode("/v2/"))
+}
+
+func TestRegistryMetrics(t *testing.T) {
+	t.Parallel()
+	reg, err := NewRegistry(Config{StorageDirectory: t.TempDir(), Metrics: true})
+	require.NoError(t, err)
+	require.True(t, reg.config.HTTP.Debug.Prometheus.Enabled)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("http://%s%s", reg.Address(), path))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	code, _ := get("/v2/")
+	require.Equal(t, http.StatusOK, code)
+	code, _ = get("/v2/some/image/manifests/latest")
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, body := get(MetricsPath)
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, `mindthegap_registry_http_requests_total{code="200",method="GET"}`)
+	require.Contains(t, body, `mindthegap_registry_http_errors_total{code="404"}`)
+	require.Contains(t, body, "registry_http_requests_total")
+}
+
+func TestRegistryShutdownReleasesPortRangeListener(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := uint16(l.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, l.Close())
+
+	// A registry that fails to be created does not keep listening.
+	_, err = NewRegistry(Config{
+		StorageDirectory: t.TempDir(),
+		Port:             port,
+		MaxPort:          port,
+		TokenAuth:        &TokenAuth{RootCertBundle: "missing.pem"},
+	})
+	require.ErrorContains(t, err, "invalid token auth configuration")
+	l, err = net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))))
+	require.NoError(t, err, "port should be released if the registry cannot be created")
+	require.NoError(t, l.Close())
+
+	// A registry that is never started does not keep listening once shut down.
+	reg, err := NewRegistry(Config{StorageDirectory: t.TempDir(), Port: port, MaxPort: port})
+	require.NoError(t, err)
+	require.NoError(t, reg.Shutdown(context.Background()))
+	l, err = net.Listen("tcp", reg.Address())
+	require.NoError(t, err, "port should be released if the registry is shut down without being started")
+	require.NoError(t, l.Close())
+}
@@ -0,0 +1,170 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const catalogPath = "/v2/_catalog"
+
+// tagsListPathRegexp matches requests to list tags: /v2/<name>/tags/list.
+var tagsListPathRegexp = regexp.MustCompile(`^/v2/.+/tags/list$`)
+
+// linkHeaderRegexp extracts the URL of a Link header used for pagination.
+var linkHeaderRegexp = regexp.MustCompile(`^<([^>]*)>(.*)$`)
+
+// withRepositoryPrefix exposes all repositories of the registry under the prefix, without changing the
+// registry storage, so that e.g. repository `library/nginx` is exposed as `<prefix>/library/nginx`.
+// Repositories without the prefix are not found.
+func withRepositoryPrefix(regHandler http.Handler, prefix string) http.Handler {
+	prefix = strings.Trim(prefix, "/")
+	prefixPath := "/v2/" + prefix + "/"
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/v2/" || req.URL.Path == "/v2":
+			regHandler.ServeHTTP(w, req)
+		case req.URL.Path == catalogPath:
+			serveCatalogWithPrefix(w, req, regHandler, prefix)
+		case strings.HasPrefix(req.URL.Path, prefixPath):
+			req = req.Clone(req.Context())
+			req.URL.Path = "/v2/" + strings.TrimPrefix(req.URL.Path, prefixPath)
+			req.URL.RawPath = ""
+			if !tagsListPathRegexp.MatchString(req.URL.Path) {
+				regHandler.ServeHTTP(&prefixingResponseWriter{ResponseWriter: w, prefix: prefix}, req)
+				return
+			}
+			serveTagsListWithPrefix(w, req, regHandler, prefix)
+		default:
+			writeRegistryError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		}
+	})
+}
+
+func serveCatalogWithPrefix(
+	w http.ResponseWriter, req *http.Request, regHandler http.Handler, prefix string,
+) {
+	req = req.Clone(req.Context())
+	query := req.URL.Query()
+	if last := query.Get("last"); last != "" {
+		query.Set("last", strings.TrimPrefix(last, prefix+"/"))
+		req.URL.RawQuery = query.Encode()
+	}
+
+	rec := httptest.NewRecorder()
+	regHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		copyResponse(w, rec)
+		return
+	}
+
+	var catalog struct {
+		Repositories []string `json:"repositories"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &catalog); err != nil {
+		writeRegistryError(w, http.StatusInternalServerError, "UNKNOWN", "invalid catalog")
+		return
+	}
+	for i, repo := range catalog.Repositories {
+		catalog.Repositories[i] = prefix + "/" + repo
+	}
+	if link := rec.Header().Get("Link"); link != "" {
+		rec.Header().Set("Link", prefixLinkHeader(link, prefix))
+	}
+	writeJSON(w, rec.Header(), catalog)
+}
+
+func serveTagsListWithPrefix(
+	w http.ResponseWriter, req *http.Request, regHandler http.Handler, prefix string,
+) {
+	rec := httptest.NewRecorder()
+	regHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		copyResponse(w, rec)
+		return
+	}
+
+	var tags struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &tags); err != nil {
+		writeRegistryError(w, http.StatusInternalServerError, "UNKNOWN", "invalid tags list")
+		return
+	}
+	tags.Name = prefix + "/" + tags.Name
+	if link := rec.Header().Get("Link"); link != "" {
+		rec.Header().Set("Link", prefixLinkHeader(link, prefix))
+	}
+	writeJSON(w, rec.Header(), tags)
+}
+
+// prefixLinkHeader adds the prefix to the repository in the URL of a pagination Link header.
+func prefixLinkHeader(link, prefix string) string {
+	matches := linkHeaderRegexp.FindStringSubmatch(link)
+	if matches == nil {
+		return link
+	}
+	u, err := url.Parse(matches[1])
+	if err != nil {
+		return link
+	}
+	if u.Path == catalogPath {
+		query := u.Query()
+		if last := query.Get("last"); last != "" {
+			query.Set("last", prefix+"/"+last)
+			u.RawQuery = query.Encode()
+		}
+	} else if strings.HasPrefix(u.Path, "/v2/") {
+		u.Path = "/v2/" + prefix + "/" + strings.TrimPrefix(u.Path, "/v2/")
+		u.RawPath = ""
+	}
+	return "<" + u.String() + ">" + matches[2]
+}
+
+func writeJSON(w http.ResponseWriter, header http.Header, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeRegistryError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+// prefixingResponseWriter adds the prefix to registry API URLs in Location headers, e.g. of redirects,
+// which are served under the path prefix of the registry, if any.
+type prefixingResponseWriter struct {
+	http.ResponseWriter
+	prefix string
+}
+
+func (w *prefixingResponseWriter) WriteHeader(statusCode int) {
+	if location := w.Header().Get("Location"); location != "" {
+		if u, err := url.Parse(location); err == nil && strings.Contains(u.Path, "/v2/") {
+			pathPrefix, repository, _ := strings.Cut(u.Path, "/v2/")
+			u.Path = pathPrefix + "/v2/" + w.prefix + "/" + repository
+			u.RawPath = ""
+			w.Header().Set("Location", u.String())
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *prefixingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
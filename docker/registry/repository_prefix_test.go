@@ -0,0 +1,76 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryRepositoryPrefix(t *testing.T) {
+	t.Parallel()
+	storageDir := t.TempDir()
+	reg, err := NewRegistry(Config{StorageDirectory: storageDir})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	for _, ref := range []string{"library/nginx:v1", "library/nginx:v2", "other:v1"} {
+		ref, err := name.ParseReference(reg.Address()+"/"+ref, name.Insecure)
+		require.NoError(t, err)
+		require.NoError(t, remote.Write(ref, img))
+	}
+
+	prefixedReg, err := NewRegistry(Config{
+		StorageDirectory: storageDir,
+		ReadOnly:         true,
+		RepositoryPrefix: "platform/",
+	})
+	require.NoError(t, err)
+	_, err = prefixedReg.Start(ctx)
+	require.NoError(t, err)
+
+	registry, err := name.NewRegistry(prefixedReg.Address(), name.Insecure)
+	require.NoError(t, err)
+
+	prefixedImg, err := remote.Image(registry.Repo("platform", "library", "nginx").Tag("v1"))
+	require.NoError(t, err)
+	layers, err := prefixedImg.Layers()
+	require.NoError(t, err)
+	_, err = layers[0].Compressed()
+	require.NoError(t, err)
+
+	_, err = remote.Image(registry.Repo("library", "nginx").Tag("v1"))
+	var transportErr *transport.Error
+	require.ErrorAs(t, err, &transportErr)
+	assert.Equal(t, transport.NameUnknownErrorCode, transportErr.Errors[0].Code)
+
+	tags, err := remote.List(registry.Repo("platform", "library", "nginx"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1", "v2"}, tags)
+
+	// Paginates through the catalog one repository at a time.
+	repos, err := remote.CatalogPage(registry, "", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"platform/library/nginx"}, repos)
+	repos, err = remote.CatalogPage(registry, repos[0], 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"platform/other"}, repos)
+
+	repos, err = remote.Catalog(ctx, registry)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"platform/library/nginx", "platform/other"}, repos)
+}
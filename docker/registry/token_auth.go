@@ -0,0 +1,391 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/auth/token"
+	"github.com/docker/libtrust"
+)
+
+const (
+	// TokenPath is the path of the built-in token issuer, see TokenAuth.Authenticators.
+	TokenPath = "/auth/token"
+
+	// DefaultTokenAuthService is the service name of the registry used if TokenAuth.Service is not set.
+	DefaultTokenAuthService = "mindthegap"
+
+	// tokenExpiration is the lifetime of tokens issued by the built-in token issuer, which clients
+	// renew as needed.
+	tokenExpiration = 5 * time.Minute
+)
+
+// ErrInvalidCredentials is returned by authenticators if the credentials are not valid.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator authenticates the credentials presented to the built-in token issuer.
+type Authenticator interface {
+	// Authenticate returns the name of the user authenticated by the credentials, or
+	// ErrInvalidCredentials if the credentials are not valid.
+	Authenticate(ctx context.Context, username, password string) (string, error)
+}
+
+// TokenAuth configures the registry to require bearer tokens of the distribution token auth scheme,
+// issued either by an external token issuer or by the built-in token issuer if Authenticators is
+// set.
+type TokenAuth struct {
+	// Realm is the URL of the token issuer that clients are directed to. Defaults to TokenPath on the
+	// address clients reach the registry at for the built-in token issuer.
+	Realm string
+	// Service is the name of the registry that tokens are issued for.
+	Service string
+	// Issuer is the name of the token issuer that tokens must be issued by.
+	Issuer string
+	// RootCertBundle is the file containing the certificates of the keys that tokens of the
+	// external token issuer are signed with.
+	RootCertBundle string
+	// Authenticators serves the built-in token issuer on TokenPath, which signs tokens with a key
+	// generated on startup and grants pull access to every client that any of the authenticators
+	// authenticates.
+	Authenticators []Authenticator
+}
+
+func (a TokenAuth) service() string {
+	if a.Service != "" {
+		return a.Service
+	}
+	return DefaultTokenAuthService
+}
+
+func (a TokenAuth) issuer() string {
+	if a.Issuer != "" {
+		return a.Issuer
+	}
+	return a.service()
+}
+
+// configureTokenAuth configures token auth in the registry configuration, returning the built-in
+// token issuer if enabled. The returned cleanup function must be called once the registry handlers
+// have been created, which read the root certificate bundle.
+func configureTokenAuth(
+	registryConfig *configuration.Configuration, a TokenAuth, tls bool, repositoryPrefix string,
+) (issuer *tokenIssuer, cleanup func(), err error) {
+	params := configuration.Parameters{
+		"realm":          a.Realm,
+		"service":        a.service(),
+		"issuer":         a.issuer(),
+		"rootcertbundle": a.RootCertBundle,
+	}
+	cleanup = func() {}
+
+	if len(a.Authenticators) > 0 {
+		issuer, err = newTokenIssuer(a.service(), a.issuer(), a.Authenticators, repositoryPrefix)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rootCertBundle, err := os.CreateTemp("", ".token-auth-*.pem")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to write token auth root certificate: %w", err)
+		}
+		cleanup = func() { _ = os.Remove(rootCertBundle.Name()) }
+		err = pem.Encode(rootCertBundle, &pem.Block{Type: "CERTIFICATE", Bytes: issuer.certificate})
+		if closeErr := rootCertBundle.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to write token auth root certificate: %w", err)
+		}
+		params["rootcertbundle"] = rootCertBundle.Name()
+
+		if a.Realm == "" {
+			pathPrefix := strings.TrimSuffix(registryConfig.HTTP.Prefix, "/")
+			switch {
+			case registryConfig.HTTP.Host != "":
+				// Direct clients to the token issuer at the public URL of the registry.
+				params["realm"] = strings.TrimSuffix(registryConfig.HTTP.Host, "/") + TokenPath
+			case tls && pathPrefix == "":
+				// Direct clients to the token issuer on the host they reached the registry at, which
+				// the distribution registry only supports for the token issuer at the root.
+				params["realm"] = "https://" + registryConfig.HTTP.Addr + TokenPath
+				params["autoredirect"] = true
+			default:
+				host, err := realmHost(registryConfig.HTTP.Addr)
+				if err != nil {
+					cleanup()
+					return nil, nil, err
+				}
+				scheme := "http"
+				if tls {
+					scheme = "https"
+				}
+				params["realm"] = scheme + "://" + host + pathPrefix + TokenPath
+			}
+		}
+	}
+
+	// Fail on invalid parameters here, as creating the registry handlers panics on them.
+	if _, err := auth.GetAccessController("token", params); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("invalid token auth configuration: %w", err)
+	}
+
+	registryConfig.Auth = configuration.Auth{"token": params}
+	return issuer, cleanup, nil
+}
+
+// realmHost returns the address that clients reach the registry listening on addr at, using the
+// hostname if listening on all interfaces.
+func realmHost(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		if host, err = os.Hostname(); err != nil {
+			return "", fmt.Errorf("failed to determine hostname for token auth realm: %w", err)
+		}
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func withTokenIssuer(regHandler http.Handler, issuer *tokenIssuer) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(TokenPath, issuer)
+	mux.Handle("/", regHandler)
+	return mux
+}
+
+// tokenIssuer is a minimal token issuer implementing the distribution token auth scheme, granting
+// pull access to repositories to authenticated clients.
+type tokenIssuer struct {
+	service          string
+	issuer           string
+	authenticators   []Authenticator
+	signingKey       libtrust.PrivateKey
+	certificate      []byte
+	repositoryPrefix string
+}
+
+func newTokenIssuer(
+	service, issuer string, authenticators []Authenticator, repositoryPrefix string,
+) (*tokenIssuer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token signing key: %w", err)
+	}
+	signingKey, err := libtrust.FromCryptoPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token signing key: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(now.UnixNano()),
+		Subject:               pkix.Name{CommonName: issuer},
+		NotBefore:             now.Add(-token.Leeway),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token signing certificate: %w", err)
+	}
+
+	return &tokenIssuer{
+		service:          service,
+		issuer:           issuer,
+		authenticators:   authenticators,
+		signingKey:       signingKey,
+		certificate:      certificate,
+		repositoryPrefix: strings.Trim(repositoryPrefix, "/"),
+	}, nil
+}
+
+// ServeHTTP issues tokens for credentials presented via basic auth to GET requests, as used by
+// Docker, or via the OAuth2 password grant of POST requests, as preferred by containerd.
+func (i *tokenIssuer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var (
+		username, password string
+		scopes             []string
+		ok                 bool
+	)
+	switch req.Method {
+	case http.MethodGet:
+		username, password, ok = req.BasicAuth()
+		if !ok {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", i.service))
+			writeTokenError(w, http.StatusUnauthorized, "unauthorized", "credentials required")
+			return
+		}
+		scopes = req.URL.Query()["scope"]
+	case http.MethodPost:
+		if err := req.ParseForm(); err != nil {
+			writeTokenError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if grantType := req.PostForm.Get("grant_type"); grantType != "password" {
+			writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type",
+				fmt.Sprintf("unsupported grant type %q", grantType))
+			return
+		}
+		username, password = req.PostForm.Get("username"), req.PostForm.Get("password")
+		scopes = req.PostForm["scope"]
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeTokenError(w, http.StatusMethodNotAllowed, "invalid_request", "method not allowed")
+		return
+	}
+
+	if service := requestParam(req, "service"); service != "" && service != i.service {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request",
+			fmt.Sprintf("tokens are not issued for service %q", service))
+		return
+	}
+
+	subject, err := i.authenticate(req.Context(), username, password)
+	if err != nil {
+		status := http.StatusUnauthorized
+		if !errors.Is(err, ErrInvalidCredentials) {
+			status = http.StatusInternalServerError
+		}
+		writeTokenError(w, status, "invalid_grant", err.Error())
+		return
+	}
+
+	now := time.Now()
+	rawToken, err := i.issueToken(subject, grantedAccess(scopes, i.repositoryPrefix), now)
+	if err != nil {
+		writeTokenError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"token":        rawToken,
+		"access_token": rawToken,
+		"expires_in":   int(tokenExpiration.Seconds()),
+		"issued_at":    now.UTC().Format(time.RFC3339),
+	})
+}
+
+func (i *tokenIssuer) authenticate(ctx context.Context, username, password string) (string, error) {
+	for _, a := range i.authenticators {
+		subject, err := a.Authenticate(ctx, username, password)
+		if !errors.Is(err, ErrInvalidCredentials) {
+			return subject, err
+		}
+	}
+	return "", ErrInvalidCredentials
+}
+
+// issueToken returns a token granting access, signed with a JWS header containing the signing
+// certificate, which the registry verifies against the root certificate bundle.
+func (i *tokenIssuer) issueToken(
+	subject string, access []*token.ResourceActions, now time.Time,
+) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(token.Header{
+		Type:       "JWT",
+		SigningAlg: "ES256",
+		X5c:        []string{base64.StdEncoding.EncodeToString(i.certificate)},
+	})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(token.ClaimSet{
+		Issuer:     i.issuer,
+		Subject:    subject,
+		Audience:   token.AudienceList{i.service},
+		Expiration: now.Add(tokenExpiration).Unix(),
+		NotBefore:  now.Unix(),
+		IssuedAt:   now.Unix(),
+		JWTID:      base64.RawURLEncoding.EncodeToString(jti),
+		Access:     access,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(header) + token.TokenSeparator +
+		base64.RawURLEncoding.EncodeToString(claims)
+	signature, _, err := i.signingKey.Sign(strings.NewReader(payload), crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return payload + token.TokenSeparator + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// grantedAccess returns the access granted for the requested scopes, which is pull access to any
+// requested repository. Scopes can be requested via multiple parameters or space-separated. Access
+// is granted to repositories without the repository prefix, which the registry sees them as.
+func grantedAccess(scopes []string, repositoryPrefix string) []*token.ResourceActions {
+	access := []*token.ResourceActions{}
+	for _, scope := range strings.Fields(strings.Join(scopes, " ")) {
+		resourceType, rest, ok := strings.Cut(scope, ":")
+		separator := strings.LastIndex(rest, ":")
+		if !ok || separator < 0 || resourceType != "repository" {
+			continue
+		}
+		name, actions := rest[:separator], strings.Split(rest[separator+1:], ",")
+		if repositoryPrefix != "" {
+			name = strings.TrimPrefix(name, repositoryPrefix+"/")
+		}
+		for _, action := range actions {
+			if action == "pull" {
+				access = append(access, &token.ResourceActions{
+					Type:    resourceType,
+					Name:    name,
+					Actions: []string{"pull"},
+				})
+				break
+			}
+		}
+	}
+	return access
+}
+
+func requestParam(req *http.Request, key string) string {
+	if req.Method == http.MethodPost {
+		return req.PostForm.Get(key)
+	}
+	return req.URL.Query().Get(key)
+}
+
+// writeTokenError writes an error response in the format of OAuth2 token endpoints.
+func writeTokenError(w http.ResponseWriter, statusCode int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
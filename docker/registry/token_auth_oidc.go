@@ -0,0 +1,219 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksRefreshInterval is the minimum time between refreshes of the keys of the OIDC issuer, which are
+// refreshed when a token is signed with an unknown key, e.g. after the issuer rotated its keys.
+const jwksRefreshInterval = time.Minute
+
+// OIDCAuthenticator authenticates clients presenting an ID token issued by an OIDC issuer for the
+// client ID as password, with any username.
+type OIDCAuthenticator struct {
+	issuerURL     string
+	clientID      string
+	usernameClaim string
+	jwksURI       string
+	client        *http.Client
+
+	mu            sync.Mutex
+	keys          map[string]crypto.PublicKey
+	keysRefreshed time.Time
+}
+
+// NewOIDCAuthenticator discovers the keys of the OIDC issuer. The name of authenticated users is read
+// from the usernameClaim of the ID tokens, defaulting to the `sub` claim.
+func NewOIDCAuthenticator(
+	ctx context.Context, issuerURL, clientID, usernameClaim string, client *http.Client,
+) (*OIDCAuthenticator, error) {
+	if usernameClaim == "" {
+		usernameClaim = "sub"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	discoveryURL := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, client, discoveryURL, &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC issuer %s: %w", issuerURL, err)
+	}
+	if discovery.Issuer != issuerURL {
+		return nil, fmt.Errorf(
+			"OIDC issuer %s reports a different issuer %q in its discovery document", issuerURL, discovery.Issuer,
+		)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC issuer %s does not report its keys in its discovery document", issuerURL)
+	}
+
+	a := &OIDCAuthenticator{
+		issuerURL:     issuerURL,
+		clientID:      clientID,
+		usernameClaim: usernameClaim,
+		jwksURI:       discovery.JWKSURI,
+		client:        client,
+	}
+	if err := a.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *OIDCAuthenticator) Authenticate(ctx context.Context, _, password string) (string, error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(
+		password,
+		claims,
+		func(t *jwt.Token) (any, error) { return a.key(ctx, t) },
+		jwt.WithIssuer(a.issuerURL),
+		jwt.WithAudience(a.clientID),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+	); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if exp, err := claims.GetExpirationTime(); err != nil || exp == nil {
+		return "", fmt.Errorf("%w: ID token does not expire", ErrInvalidCredentials)
+	}
+
+	username, _ := claims[a.usernameClaim].(string)
+	if username == "" {
+		return "", fmt.Errorf("%w: ID token has no %s claim", ErrInvalidCredentials, a.usernameClaim)
+	}
+	return username, nil
+}
+
+// key returns the key the token is signed with, refreshing the keys of the issuer if it is unknown.
+func (a *OIDCAuthenticator) key(ctx context.Context, t *jwt.Token) (crypto.PublicKey, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(a.keysRefreshed) >= jwksRefreshInterval {
+		if err := a.refreshKeys(ctx); err != nil {
+			return nil, err
+		}
+		if key, ok := a.keys[kid]; ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (a *OIDCAuthenticator) refreshKeys(ctx context.Context) error {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, a.client, a.jwksURI, &jwks); err != nil {
+		return fmt.Errorf("failed to get keys of OIDC issuer %s: %w", a.issuerURL, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Skip keys of unsupported types rather than failing to use the other keys.
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	a.keys = keys
+	a.keysRefreshed = time.Now()
+	return nil
+}
+
+// jsonWebKey is an RSA or EC public JSON Web Key as served by OIDC issuers.
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response from %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", url, err)
+	}
+	return nil
+}
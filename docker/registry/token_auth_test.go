@@ -0,0 +1,207 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/auth/token"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRegistryTokenAuthWithUsersFile(t *testing.T) {
+	t.Parallel()
+	storageDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Populate the registry storage without auth, as the built-in token issuer only grants pull access.
+	reg, err := NewRegistry(Config{StorageDirectory: storageDir})
+	require.NoError(t, err)
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(reg.Address()+"/some/image:v1", name.Insecure)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("s3cr3t"), bcrypt.MinCost)
+	require.NoError(t, err)
+	usersFile := filepath.Join(t.TempDir(), "htpasswd")
+	require.NoError(t, os.WriteFile(usersFile, []byte("# users\nci:"+string(passwordHash)+"\n"), 0o600))
+	users, err := NewUsersFileAuthenticator(usersFile)
+	require.NoError(t, err)
+
+	authReg, err := NewRegistry(Config{
+		StorageDirectory: storageDir,
+		ReadOnly:         true,
+		BlobCacheSize:    1 << 20,
+		RepositoryPrefix: "platform",
+		TokenAuth:        &TokenAuth{Authenticators: []Authenticator{users}},
+	})
+	require.NoError(t, err)
+	_, err = authReg.Start(ctx)
+	require.NoError(t, err)
+	authRef, err := name.ParseReference(authReg.Address()+"/platform/some/image:v1", name.Insecure)
+	require.NoError(t, err)
+
+	// Caching a blob must not make it available to clients that are not authorized.
+	authImg, err := remote.Image(authRef, remote.WithAuth(&authn.Basic{Username: "ci", Password: "s3cr3t"}))
+	require.NoError(t, err)
+	layers, err := authImg.Layers()
+	require.NoError(t, err)
+	layerDigest, err := layers[0].Digest()
+	require.NoError(t, err)
+	_, err = remote.Layer(authRef.Context().Digest(layerDigest.String()),
+		remote.WithAuth(&authn.Basic{Username: "ci", Password: "s3cr3t"}))
+	require.NoError(t, err)
+	resp, err := http.Get("http://" + authReg.Address() + "/v2/platform/some/image/blobs/" + layerDigest.String())
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_, err = remote.Image(authRef)
+	assert.ErrorContains(t, err, "401 Unauthorized")
+	_, err = remote.Image(authRef, remote.WithAuth(&authn.Basic{Username: "ci", Password: "wrong"}))
+	assert.Error(t, err)
+}
+
+func TestTokenIssuerPasswordGrant(t *testing.T) {
+	t.Parallel()
+	users := staticAuthenticator{"ci": "s3cr3t"}
+	issuer, err := newTokenIssuer("mindthegap", "mindthegap", []Authenticator{users}, "")
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, TokenPath, nil)
+	req.PostForm = map[string][]string{
+		"grant_type": {"password"},
+		"username":   {"ci"},
+		"password":   {"s3cr3t"},
+		"service":    {"mindthegap"},
+		"scope":      {"repository:some/image:pull,push repository:other/image:push registry:catalog:*"},
+	}
+	issuer.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	tok, err := token.NewToken(resp.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "ci", tok.Claims.Subject)
+	assert.Equal(t, []*token.ResourceActions{
+		{Type: "repository", Name: "some/image", Actions: []string{"pull"}},
+	}, tok.Claims.Access)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, TokenPath, nil)
+	req.PostForm = map[string][]string{
+		"grant_type": {"password"},
+		"username":   {"ci"},
+		"password":   {"wrong"},
+	}
+	issuer.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestGrantedAccessWithRepositoryPrefix(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, []*token.ResourceActions{
+		{Type: "repository", Name: "library/nginx", Actions: []string{"pull"}},
+		{Type: "repository", Name: "library/redis", Actions: []string{"pull"}},
+	}, grantedAccess(
+		[]string{"repository:platform/library/nginx:pull", "repository:library/redis:pull"}, "platform",
+	))
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	t.Parallel()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	idp := httptest.NewServer(mux)
+	defer idp.Close()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": idp.URL, "jwks_uri": idp.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []jsonWebKey{{
+			KeyType: "RSA",
+			KeyID:   "key-1",
+			Use:     "sig",
+			N:       base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+
+	a, err := NewOIDCAuthenticator(context.Background(), idp.URL, "mindthegap", "email", idp.Client())
+	require.NoError(t, err)
+
+	idToken := func(claims jwt.MapClaims) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = "key-1"
+		signed, err := tok.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   idp.URL,
+			"aud":   "mindthegap",
+			"sub":   "1234",
+			"email": "ci@example.com",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	username, err := a.Authenticate(context.Background(), "oidc", idToken(validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, "ci@example.com", username)
+
+	for name, mutate := range map[string]func(jwt.MapClaims){
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "other" },
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://other.example.com" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no expiry":      func(c jwt.MapClaims) { delete(c, "exp") },
+		"no username":    func(c jwt.MapClaims) { delete(c, "email") },
+	} {
+		claims := validClaims()
+		mutate(claims)
+		_, err := a.Authenticate(context.Background(), "oidc", idToken(claims))
+		assert.ErrorIs(t, err, ErrInvalidCredentials, name)
+	}
+	_, err = a.Authenticate(context.Background(), "oidc", "not-a-token")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+type staticAuthenticator map[string]string
+
+func (a staticAuthenticator) Authenticate(_ context.Context, username, password string) (string, error) {
+	if p, ok := a[username]; !ok || p != password {
+		return "", ErrInvalidCredentials
+	}
+	return username, nil
+}
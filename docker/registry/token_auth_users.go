@@ -0,0 +1,61 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UsersFileAuthenticator authenticates users with the bcrypt password hashes of a static users file
+// in htpasswd format, e.g. as created by `htpasswd -B`.
+type UsersFileAuthenticator struct {
+	passwordHashes map[string][]byte
+}
+
+func NewUsersFileAuthenticator(usersFile string) (*UsersFileAuthenticator, error) {
+	f, err := os.Open(usersFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+	defer f.Close()
+
+	passwordHashes := map[string][]byte{}
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		username, passwordHash, ok := strings.Cut(line, ":")
+		if !ok || username == "" {
+			return nil, fmt.Errorf("invalid entry in users file %s on line %d", usersFile, lineNumber)
+		}
+		if _, err := bcrypt.Cost([]byte(passwordHash)); err != nil {
+			return nil, fmt.Errorf(
+				"invalid password hash of user %q in users file %s (only bcrypt is supported): %w",
+				username, usersFile, err,
+			)
+		}
+		passwordHashes[username] = []byte(passwordHash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+
+	return &UsersFileAuthenticator{passwordHashes: passwordHashes}, nil
+}
+
+func (a *UsersFileAuthenticator) Authenticate(_ context.Context, username, password string) (string, error) {
+	passwordHash, ok := a.passwordHashes[username]
+	if !ok || bcrypt.CompareHashAndPassword(passwordHash, []byte(password)) != nil {
+		return "", ErrInvalidCredentials
+	}
+	return username, nil
+}
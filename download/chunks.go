@@ -0,0 +1,117 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// downloadInChunks downloads the file in chunks via HTTP range requests, appending to the partially
+// downloaded file if it exists and retrying every chunk up to opts.Retries times. It returns false
+// without downloading the file if the file is no larger than a single chunk or the server does not
+// support range requests.
+func downloadInChunks(ctx context.Context, u *url.URL, dst string, opts Options) (bool, error) {
+	req, err := newRequest(ctx, http.MethodHead, u, opts)
+	if err != nil {
+		return false, err
+	}
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Accept-Ranges") != "bytes" ||
+		resp.ContentLength <= opts.ChunkSize {
+		return false, nil
+	}
+	size := resp.ContentLength
+	if opts.Size > 0 && size != opts.Size {
+		return false, fmt.Errorf("size of file is %d bytes, expected %d bytes", size, opts.Size)
+	}
+
+	partialFile := dst + partialFileSuffix
+	pf, err := os.OpenFile(partialFile, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return false, err
+	}
+	defer pf.Close()
+
+	offset, err := pf.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+	if offset > size {
+		// The file has changed since it was partially downloaded, the checksum of the complete file
+		// is verified once it has been downloaded.
+		if err := pf.Truncate(0); err != nil {
+			return false, err
+		}
+		offset = 0
+	}
+
+	for offset < size {
+		end := min(offset+opts.ChunkSize, size) - 1
+		for attempt := 0; ; attempt++ {
+			err = downloadChunk(ctx, u, pf, offset, end, opts)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil || attempt >= opts.Retries {
+				return false, fmt.Errorf(
+					"failed to download bytes %d-%d after %d attempts: %w", offset, end, attempt+1, err,
+				)
+			}
+			// Discard anything written by the failed attempt.
+			if err := pf.Truncate(offset); err != nil {
+				return false, err
+			}
+			if _, err := pf.Seek(offset, io.SeekStart); err != nil {
+				return false, err
+			}
+		}
+		offset = end + 1
+	}
+
+	if err := pf.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Rename(partialFile, dst); err != nil {
+		return false, err
+	}
+	// Validators recorded for a previous download of the file do not apply to this one.
+	_ = os.Remove(dst + stateFileSuffix)
+	return true, nil
+}
+
+// downloadChunk downloads the bytes from start to end, inclusive, appending them to w.
+func downloadChunk(ctx context.Context, u *url.URL, w io.Writer, start, end int64, opts Options) error {
+	req, err := newRequest(ctx, http.MethodGet, u, opts)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("unexpected response status for range request: %s", resp.Status)
+	}
+
+	n, err := io.Copy(w, io.LimitReader(resp.Body, end-start+1))
+	if err != nil {
+		return err
+	}
+	if n != end-start+1 {
+		return errors.New("incomplete chunk")
+	}
+	return nil
+}
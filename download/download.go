@@ -0,0 +1,238 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package download downloads files via HTTP(S), resuming interrupted downloads and verifying the
+// downloaded files against their checksums.
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// partialFileSuffix is appended to the name of files while they are downloaded, so that
+	// interrupted downloads can be resumed from the downloaded size.
+	partialFileSuffix = ".partial"
+	// stateFileSuffix is appended to the name of downloaded files to record the validators the
+	// server returned for them, to resume and revalidate downloads.
+	stateFileSuffix = ".download-state"
+)
+
+// Options configures how files are downloaded.
+type Options struct {
+	// Checksum is the expected checksum of the file, in the format <algorithm>:<hex>. Files that
+	// have already been downloaded are reused if they match the checksum.
+	Checksum string
+	// Size is the expected size of the file in bytes, if known.
+	Size int64
+	// Retries is the number of times to resume downloads, or to retry chunks if ChunkSize is set,
+	// after transient errors.
+	Retries int
+	// ChunkSize downloads files larger than the chunk size in chunks of that size via HTTP range
+	// requests, if supported by the server.
+	ChunkSize int64
+	// Client is the HTTP client to download files with, defaulting to http.DefaultClient.
+	Client *http.Client
+	// UserAgent is sent with every request if set.
+	UserAgent string
+}
+
+// File downloads the file from the URL to dst, returning the size of the file. Interrupted
+// downloads are resumed after transient errors and across runs if the file has not changed on the
+// server. Files that have already been downloaded are reused if they match the checksum, or
+// otherwise if the server reports that they have not changed.
+func File(ctx context.Context, u *url.URL, dst string, opts Options) (int64, error) {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	if opts.Checksum != "" {
+		if size, err := Verify(dst, opts.Checksum, opts.Size); err == nil {
+			return size, nil
+		}
+		// Download files that do not match again rather than revalidating them.
+		_ = os.Remove(dst + stateFileSuffix)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return 0, err
+	}
+
+	downloaded := false
+	if opts.ChunkSize > 0 {
+		var err error
+		downloaded, err = downloadInChunks(ctx, u, dst, opts)
+		if err != nil {
+			return 0, fmt.Errorf("failed to download %s: %w", u.Redacted(), err)
+		}
+	}
+	for attempt := 0; !downloaded; attempt++ {
+		err := downloadAttempt(ctx, u, dst, opts)
+		if err == nil {
+			break
+		}
+		var statusErr *statusError
+		if ctx.Err() != nil || attempt >= opts.Retries ||
+			(errors.As(err, &statusErr) && statusErr.code < http.StatusInternalServerError) {
+			return 0, fmt.Errorf("failed to download %s after %d attempts: %w", u.Redacted(), attempt+1, err)
+		}
+	}
+
+	if opts.Checksum == "" {
+		fi, err := os.Stat(dst)
+		if err != nil {
+			return 0, err
+		}
+		return fi.Size(), nil
+	}
+	size, err := Verify(dst, opts.Checksum, opts.Size)
+	if err != nil {
+		_ = os.Remove(dst)
+		_ = os.Remove(dst + stateFileSuffix)
+		return 0, fmt.Errorf("downloaded %s does not match: %w", u.Redacted(), err)
+	}
+	return size, nil
+}
+
+// statusError is returned for unexpected response statuses.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "unexpected response status: " + e.status
+}
+
+// state records the validators the server returned for a downloaded file, which are used to only
+// resume partial downloads of files that have not changed and to revalidate downloaded files.
+type state struct {
+	ETag         string `yaml:"etag,omitempty"`
+	LastModified string `yaml:"lastModified,omitempty"`
+}
+
+// rangeValidator returns the validator for If-Range headers, which requires a strong ETag.
+func (s state) rangeValidator() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+	return s.LastModified
+}
+
+func readState(file string) (state, error) {
+	var s state
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return s, err
+	}
+	return s, yaml.Unmarshal(b, &s)
+}
+
+func writeState(file string, s state) error {
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, b, 0o644)
+}
+
+func newRequest(ctx context.Context, method string, u *url.URL, opts Options) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if opts.UserAgent != "" {
+		req.Header.Set("User-Agent", opts.UserAgent)
+	}
+	return req, nil
+}
+
+// downloadAttempt downloads the file to a partial file that is renamed to dst once it has been
+// downloaded completely. A partial file left by a previous attempt is resumed via a range request if
+// the file has not changed on the server, and a file that has been downloaded completely is only
+// downloaded again if it has changed on the server.
+func downloadAttempt(ctx context.Context, u *url.URL, dst string, opts Options) error {
+	partialFile := dst + partialFileSuffix
+
+	req, err := newRequest(ctx, http.MethodGet, u, opts)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	partialState, partialStateErr := readState(partialFile + stateFileSuffix)
+	fi, partialErr := os.Stat(partialFile)
+	switch {
+	case partialErr == nil && partialStateErr == nil && fi.Size() > 0 && partialState.rangeValidator() != "":
+		offset = fi.Size()
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", partialState.rangeValidator())
+	default:
+		if _, err := os.Stat(dst); err != nil {
+			break
+		}
+		if s, err := readState(dst + stateFileSuffix); err == nil {
+			if s.ETag != "" {
+				req.Header.Set("If-None-Match", s.ETag)
+			} else if s.LastModified != "" {
+				req.Header.Set("If-Modified-Since", s.LastModified)
+			}
+		}
+	}
+
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+	case http.StatusPartialContent:
+		var start int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); err != nil ||
+			start != offset {
+			// Start over rather than appending the wrong range.
+			_ = os.Remove(partialFile)
+			return fmt.Errorf("unexpected content range %q", resp.Header.Get("Content-Range"))
+		}
+		flags |= os.O_APPEND
+	default:
+		return &statusError{code: resp.StatusCode, status: resp.Status}
+	}
+
+	// Record the validators before downloading, so that the download can be resumed if interrupted.
+	s := state{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	if err := writeState(partialFile+stateFileSuffix, s); err != nil {
+		return fmt.Errorf("failed to write download state: %w", err)
+	}
+	pf, err := os.OpenFile(partialFile, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(pf, resp.Body); err != nil {
+		_ = pf.Close()
+		return err
+	}
+	if err := pf.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(partialFile, dst); err != nil {
+		return err
+	}
+	return os.Rename(partialFile+stateFileSuffix, dst+stateFileSuffix)
+}
@@ -0,0 +1,241 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fileServer serves content, failing the first range request for every failing range.
+type fileServer struct {
+	content []byte
+
+	mu            sync.Mutex
+	failingRanges map[string]bool
+	rangeRequests []string
+	disableRanges bool
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	rng := req.Header.Get("Range")
+	if req.Method == http.MethodGet && rng != "" {
+		s.rangeRequests = append(s.rangeRequests, rng)
+	}
+	fail := s.failingRanges[rng]
+	delete(s.failingRanges, rng)
+	s.mu.Unlock()
+
+	if fail {
+		http.Error(w, "injected failure", http.StatusServiceUnavailable)
+		return
+	}
+	if s.disableRanges {
+		_, _ = w.Write(s.content)
+		return
+	}
+	http.ServeContent(w, req, "model.bin", time.Time{}, bytes.NewReader(s.content))
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	require.NoError(t, err)
+	return u
+}
+
+func TestFileInChunks(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	srv := &fileServer{
+		content:       content,
+		failingRanges: map[string]bool{"bytes=32-63": true},
+	}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	dst := filepath.Join(t.TempDir(), "models", "model.bin")
+	size, err := File(
+		context.Background(), mustParseURL(t, ts.URL), dst,
+		Options{Checksum: checksum(content), ChunkSize: 32, Retries: 1},
+	)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), size)
+
+	got, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+	assert.NoFileExists(t, dst+partialFileSuffix)
+	assert.Equal(t, []string{
+		"bytes=0-31", "bytes=32-63", "bytes=32-63", "bytes=64-95", "bytes=96-99",
+	}, srv.rangeRequests)
+}
+
+func TestFileInChunksResume(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	srv := &fileServer{content: content, failingRanges: map[string]bool{}}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	dst := filepath.Join(t.TempDir(), "models", "model.bin")
+	require.NoError(t, os.MkdirAll(filepath.Dir(dst), 0o755))
+	require.NoError(t, os.WriteFile(dst+partialFileSuffix, content[:40], 0o644))
+
+	opts := Options{Checksum: checksum(content), ChunkSize: 32}
+	_, err := File(context.Background(), mustParseURL(t, ts.URL), dst, opts)
+	require.NoError(t, err)
+	got, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+	assert.Equal(t, []string{"bytes=40-71", "bytes=72-99"}, srv.rangeRequests)
+
+	// Completely downloaded files are not downloaded again.
+	srv.rangeRequests = nil
+	_, err = File(context.Background(), mustParseURL(t, ts.URL), dst, opts)
+	require.NoError(t, err)
+	assert.Empty(t, srv.rangeRequests)
+}
+
+func TestFileInChunksExhaustedRetries(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	srv := &fileServer{content: content, failingRanges: map[string]bool{"bytes=32-63": true}}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	dst := filepath.Join(t.TempDir(), "model.bin")
+	_, err := File(
+		context.Background(), mustParseURL(t, ts.URL), dst, Options{Checksum: checksum(content), ChunkSize: 32},
+	)
+	require.ErrorContains(t, err, "failed to download bytes 32-63 after 1 attempts")
+
+	// Progress is kept to resume from.
+	partial, err := os.ReadFile(dst + partialFileSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, content[:32], partial)
+}
+
+func TestFileWithoutRangeSupport(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	srv := &fileServer{content: content, disableRanges: true}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	size, err := File(
+		context.Background(), mustParseURL(t, ts.URL), filepath.Join(t.TempDir(), "model.bin"),
+		Options{Checksum: checksum(content), Size: int64(len(content)), ChunkSize: 32},
+	)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), size)
+	assert.Empty(t, srv.rangeRequests)
+}
+
+func TestFileChecksumMismatch(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(&fileServer{content: []byte("content")})
+	t.Cleanup(ts.Close)
+
+	dst := filepath.Join(t.TempDir(), "model.bin")
+	_, err := File(context.Background(), mustParseURL(t, ts.URL), dst, Options{Checksum: checksum([]byte("other"))})
+	require.ErrorContains(t, err, "does not match")
+	assert.NoFileExists(t, dst)
+}
+
+func TestFileResume(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	etag := `"v1"`
+	var rangeRequests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			rangeRequests.Add(1)
+		}
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "images.tar", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name        string
+		partialETag string
+		partial     []byte
+	}{{
+		name:        "unchanged file is resumed",
+		partialETag: etag,
+		partial:     content[:400],
+	}, {
+		name:        "changed file is downloaded again",
+		partialETag: `"v0"`,
+		partial:     bytes.Repeat([]byte("x"), 400),
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), "images.tar")
+			require.NoError(t, os.WriteFile(dst+partialFileSuffix, tt.partial, 0o644))
+			require.NoError(t, writeState(dst+partialFileSuffix+stateFileSuffix, state{ETag: tt.partialETag}))
+
+			_, err := File(context.Background(), mustParseURL(t, srv.URL+"/images.tar"), dst, Options{})
+			require.NoError(t, err)
+
+			downloaded, err := os.ReadFile(dst)
+			require.NoError(t, err)
+			assert.Equal(t, content, downloaded)
+			assert.NoFileExists(t, dst+partialFileSuffix)
+			s, err := readState(dst + stateFileSuffix)
+			require.NoError(t, err)
+			assert.Equal(t, etag, s.ETag)
+		})
+	}
+	assert.EqualValues(t, 2, rangeRequests.Load())
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("content")
+	p := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(p, content, 0o644))
+
+	size, err := Verify(p, checksum(content), 0)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), size)
+
+	_, err = Verify(p, checksum(content), 1)
+	require.ErrorContains(t, err, "expected 1 bytes")
+
+	_, err = Verify(p, checksum([]byte("other")), 0)
+	require.ErrorContains(t, err, "checksum of file")
+
+	_, err = Verify(p, "md5:abc", 0)
+	require.ErrorContains(t, err, "unsupported checksum algorithm")
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package download
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// ValidateChecksum checks that the checksum is in the format <algorithm>:<hex> with a supported
+// algorithm.
+func ValidateChecksum(checksum string) error {
+	_, err := checksumHash(checksum)
+	return err
+}
+
+func checksumHash(checksum string) (hash.Hash, error) {
+	algorithm, _, _ := strings.Cut(checksum, ":")
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %q: must be one of sha256 or sha512", algorithm)
+	}
+}
+
+// Verify verifies that the file at path has the checksum, in the format <algorithm>:<hex>, and
+// size if set, returning the size of the file.
+func Verify(path, checksum string, size int64) (int64, error) {
+	h, err := checksumHash(checksum)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	if size > 0 && n != size {
+		return 0, fmt.Errorf("size of file %s is %d bytes, expected %d bytes", path, n, size)
+	}
+	algorithm, want, _ := strings.Cut(checksum, ":")
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+		return 0, fmt.Errorf("checksum of file %s is %s:%s, expected %s", path, algorithm, got, checksum)
+	}
+	return n, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package helm
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+// RenderChart renders the templates of the local chart, either a chart directory or packaged chart,
+// with the values files and --set style values, like `helm template` does. The rendered manifests are
+// returned in the order of their template names, skipping templates that do not render manifests,
+// e.g. NOTES.txt.
+func RenderChart(chartPath string, valueFiles, setValues []string) ([]string, error) {
+	chrt, err := LoadChart(chartPath)
+	if err != nil {
+		return nil, err
+	}
+
+	valueOpts := values.Options{ValueFiles: valueFiles, Values: setValues}
+	vals, err := valueOpts.MergeValues(getter.All(cli.New()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values for chart %s: %w", chartPath, err)
+	}
+	if err := chartutil.ProcessDependencies(chrt, vals); err != nil {
+		return nil, fmt.Errorf("failed to process dependencies of chart %s: %w", chartPath, err)
+	}
+	renderVals, err := chartutil.ToRenderValues(
+		chrt,
+		vals,
+		chartutil.ReleaseOptions{Name: chrt.Name(), Namespace: "default", IsInstall: true},
+		chartutil.DefaultCapabilities,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare values for chart %s: %w", chartPath, err)
+	}
+
+	rendered, err := engine.Render(chrt, renderVals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render chart %s: %w", chartPath, err)
+	}
+
+	templateNames := make([]string, 0, len(rendered))
+	for templateName, manifest := range rendered {
+		ext := filepath.Ext(templateName)
+		if (ext != ".yaml" && ext != ".yml") || strings.TrimSpace(manifest) == "" {
+			continue
+		}
+		templateNames = append(templateNames, templateName)
+	}
+	sort.Strings(templateNames)
+	manifests := make([]string, 0, len(templateNames))
+	for _, templateName := range templateNames {
+		manifests = append(manifests, rendered[templateName])
+	}
+	return manifests, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// Annotator adds annotations to images. Annotation values are templates that are rendered for every
+// annotated manifest with AnnotationData, e.g. `{{ .Digest }}`.
+type Annotator struct {
+	templates map[string]*template.Template
+}
+
+// AnnotationData is the data that annotation values are rendered with.
+type AnnotationData struct {
+	// Image is the name of the source image, e.g. docker.io/library/nginx:1.21.5.
+	Image string
+	// Digest is the digest of the annotated manifest before it is annotated, i.e. the digest of the
+	// image in the source registry for images. Indexes that only retain some of the platforms of
+	// the source image have a different digest than in the source registry.
+	Digest string
+}
+
+// NewAnnotator parses the annotation values, keyed by annotation key, returning nil if there are no
+// annotations.
+func NewAnnotator(annotations map[string]string) (*Annotator, error) {
+	if len(annotations) == 0 {
+		return nil, nil
+	}
+
+	a := &Annotator{templates: make(map[string]*template.Template, len(annotations))}
+	for k, v := range annotations {
+		if k == "" {
+			return nil, fmt.Errorf("invalid annotation with value %q: key must not be empty", v)
+		}
+		tmpl, err := template.New(k).Option("missingkey=error").Parse(v)
+		if err == nil {
+			// Fail on references to unknown fields before any image is annotated.
+			err = tmpl.Execute(io.Discard, AnnotationData{})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of annotation %q: %w", k, err)
+		}
+		a.templates[k] = tmpl
+	}
+	return a, nil
+}
+
+// AnnotateIndex returns the index with the annotations added to the index itself and to all of its
+// images, recursing into nested indexes, overriding existing annotations with the same keys. The
+// index is returned unchanged if a is nil.
+func (a *Annotator) AnnotateIndex(index v1.ImageIndex, img string) (v1.ImageIndex, error) {
+	if a == nil {
+		return index, nil
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index manifest for %q: %w", img, err)
+	}
+
+	annotated := mutate.IndexMediaType(empty.Index, indexManifest.MediaType)
+	for _, desc := range indexManifest.Manifests {
+		addendum := mutate.IndexAddendum{
+			Descriptor: v1.Descriptor{
+				MediaType:   desc.MediaType,
+				Platform:    desc.Platform,
+				URLs:        desc.URLs,
+				Annotations: desc.Annotations,
+			},
+		}
+		switch {
+		case desc.MediaType.IsIndex():
+			child, err := index.ImageIndex(desc.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read image index %s of %q: %w", desc.Digest, img, err)
+			}
+			if addendum.Add, err = a.AnnotateIndex(child, img); err != nil {
+				return nil, err
+			}
+		case desc.MediaType.IsImage():
+			child, err := index.Image(desc.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read image %s of %q: %w", desc.Digest, img, err)
+			}
+			annotations, err := a.render(img, desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+			addendum.Add = mutate.Annotations(child, annotations).(v1.Image)
+		default:
+			// Other manifests, e.g. of attestations, are kept as they are.
+			child, err := index.Image(desc.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read manifest %s of %q: %w", desc.Digest, img, err)
+			}
+			addendum.Add = child
+			addendum.Descriptor.Digest, addendum.Descriptor.Size = desc.Digest, desc.Size
+		}
+		annotated = mutate.AppendManifests(annotated, addendum)
+	}
+
+	digest, err := index.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read digest of %q: %w", img, err)
+	}
+	annotations, err := a.render(img, digest)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]string, len(indexManifest.Annotations)+len(annotations))
+	for k, v := range indexManifest.Annotations {
+		merged[k] = v
+	}
+	for k, v := range annotations {
+		merged[k] = v
+	}
+	return mutate.Annotations(annotated, merged).(v1.ImageIndex), nil
+}
+
+func (a *Annotator) render(img string, digest v1.Hash) (map[string]string, error) {
+	data := AnnotationData{Image: img, Digest: digest.String()}
+	annotations := make(map[string]string, len(a.templates))
+	for k, tmpl := range a.templates {
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, data); err != nil {
+			return nil, fmt.Errorf("failed to render annotation %q for %q: %w", k, img, err)
+		}
+		annotations[k] = sb.String()
+	}
+	return annotations, nil
+}
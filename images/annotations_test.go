@@ -0,0 +1,90 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotatorAnnotateIndex(t *testing.T) {
+	t.Parallel()
+
+	img, err := random.Image(128, 1)
+	require.NoError(t, err)
+	imgDigest, err := img.Digest()
+	require.NoError(t, err)
+	platform := &v1.Platform{OS: "linux", Architecture: "amd64"}
+	index := mutate.Annotations(mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+		Add:        img,
+		Descriptor: v1.Descriptor{Platform: platform},
+	}), map[string]string{"existing": "kept", "org.opencontainers.image.vendor": "upstream"}).(v1.ImageIndex)
+	indexDigest, err := index.Digest()
+	require.NoError(t, err)
+
+	a, err := NewAnnotator(map[string]string{
+		"org.opencontainers.image.vendor": "Example",
+		"com.example.source":              "{{ .Image }}@{{ .Digest }}",
+	})
+	require.NoError(t, err)
+
+	annotated, err := a.AnnotateIndex(index, "example.com/image:v1")
+	require.NoError(t, err)
+
+	indexManifest, err := annotated.IndexManifest()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"existing":                        "kept",
+		"org.opencontainers.image.vendor": "Example",
+		"com.example.source":              "example.com/image:v1@" + indexDigest.String(),
+	}, indexManifest.Annotations)
+	require.Len(t, indexManifest.Manifests, 1)
+	assert.Equal(t, platform, indexManifest.Manifests[0].Platform)
+
+	annotatedImg, err := annotated.Image(indexManifest.Manifests[0].Digest)
+	require.NoError(t, err)
+	manifest, err := annotatedImg.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"org.opencontainers.image.vendor": "Example",
+		"com.example.source":              "example.com/image:v1@" + imgDigest.String(),
+	}, manifest.Annotations)
+
+	// Layers are not changed by annotating.
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	annotatedLayers, err := annotatedImg.Layers()
+	require.NoError(t, err)
+	require.Len(t, annotatedLayers, len(layers))
+	wantDigest, err := layers[0].Digest()
+	require.NoError(t, err)
+	gotDigest, err := annotatedLayers[0].Digest()
+	require.NoError(t, err)
+	assert.Equal(t, wantDigest, gotDigest)
+}
+
+func TestNewAnnotator(t *testing.T) {
+	t.Parallel()
+
+	a, err := NewAnnotator(nil)
+	require.NoError(t, err)
+	assert.Nil(t, a)
+	index, err := random.Index(128, 1, 1)
+	require.NoError(t, err)
+	got, err := a.AnnotateIndex(index, "example.com/image:v1")
+	require.NoError(t, err)
+	assert.Same(t, index, got)
+
+	_, err = NewAnnotator(map[string]string{"com.example.source": "{{ .Digets }}"})
+	require.ErrorContains(t, err, `invalid value of annotation "com.example.source"`)
+
+	_, err = NewAnnotator(map[string]string{"com.example.source": "{{ .Digest"})
+	require.ErrorContains(t, err, `invalid value of annotation "com.example.source"`)
+}
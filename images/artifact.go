@@ -0,0 +1,159 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+// artifactManifest contains the fields of manifests and indexes that identify OCI artifacts, which
+// are not all part of the manifest types of go-containerregistry.
+type artifactManifest struct {
+	ArtifactType string `json:"artifactType,omitempty"`
+	// Config only contains the media type, so that manifests addressing their config by digests
+	// that go-containerregistry does not support are parsed as well.
+	Config struct {
+		MediaType types.MediaType `json:"mediaType"`
+	} `json:"config"`
+	Manifests []struct {
+		ArtifactType string `json:"artifactType,omitempty"`
+	} `json:"manifests"`
+}
+
+// ArtifactType returns the type of the OCI artifact, e.g. a WASM module, policy bundle or Flux
+// OCIRepository artifact, described by the raw manifest with the media type, or "" if it describes
+// a container image or an index of container images. Manifests are artifacts if they specify an
+// artifactType or their config is not an image config, and indexes are artifacts if they specify
+// an artifactType or all of their manifests do.
+func ArtifactType(mediaType types.MediaType, rawManifest []byte) (string, error) {
+	var m artifactManifest
+	if err := json.Unmarshal(rawManifest, &m); err != nil {
+		return "", fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if m.ArtifactType != "" {
+		return m.ArtifactType, nil
+	}
+
+	switch {
+	case mediaType.IsIndex():
+		if len(m.Manifests) == 0 {
+			return "", nil
+		}
+		for _, desc := range m.Manifests {
+			if desc.ArtifactType == "" {
+				return "", nil
+			}
+		}
+		return m.Manifests[0].ArtifactType, nil
+	case mediaType.IsImage():
+		switch m.Config.MediaType {
+		case types.DockerConfigJSON, types.OCIConfigJSON:
+			return "", nil
+		default:
+			return string(m.Config.MediaType), nil
+		}
+	default:
+		return "", nil
+	}
+}
+
+// ImageOrArtifactForImage reads img from the registry. Container images are returned as index
+// containing only the requested platforms like ManifestListForImage does. OCI artifacts, detected by
+// their media types or if artifact is true, are returned instead as v1.Image or v1.ImageIndex exactly
+// as they are stored in the registry, so that they are copied faithfully with their artifactType and
+// annotations.
+//
+// The digest of the manifest read from the registry is returned as well, which signatures of img
+// have to be verified for so that exactly the content that is copied is verified, or a zero hash if
+// img is not found in the registry and has been read from the local Docker daemon instead.
+func ImageOrArtifactForImage(
+	img string,
+	platforms []platform.Platform,
+	artifact bool,
+	w *warnings.Collector,
+	opts ...remote.Option,
+) (v1.ImageIndex, remote.Taggable, v1.Hash, error) {
+	if err := ValidateDigestAlgorithm(img); err != nil {
+		return nil, nil, v1.Hash{}, err
+	}
+	ref, err := name.ParseReference(img)
+	if err != nil {
+		return nil, nil, v1.Hash{}, fmt.Errorf("invalid image reference %q: %w", img, err)
+	}
+	desc, err := remote.Get(ref, opts...)
+	if err != nil {
+		if artifact {
+			return nil, nil, v1.Hash{}, fmt.Errorf(
+				"failed to read artifact descriptor for %q from registry: %w",
+				img,
+				err,
+			)
+		}
+		localImage, localErr := daemon.Image(ref)
+		if localErr != nil {
+			return nil, nil, v1.Hash{}, fmt.Errorf(
+				"failed to read image descriptor for %q from registry: %w",
+				img,
+				err,
+			)
+		}
+
+		index, err := indexForSinglePlatformImage(ref, localImage, w, platforms...)
+		return index, nil, v1.Hash{}, err
+	}
+
+	if !artifact {
+		artifactType, err := ArtifactType(desc.MediaType, desc.Manifest)
+		if err != nil {
+			return nil, nil, v1.Hash{}, fmt.Errorf("failed to read manifest for %q: %w", img, err)
+		}
+		artifact = artifactType != ""
+	}
+	if !artifact {
+		index, err := manifestListForDescriptor(img, ref, desc, platforms, w)
+		return index, nil, desc.Digest, err
+	}
+
+	if err := validateManifestDigests(img, desc.Manifest); err != nil {
+		return nil, nil, v1.Hash{}, err
+	}
+	switch {
+	case desc.MediaType.IsIndex():
+		index, err := desc.ImageIndex()
+		if err != nil {
+			return nil, nil, v1.Hash{}, fmt.Errorf(
+				"failed to read artifact index for %q: %w",
+				img,
+				err,
+			)
+		}
+		return nil, index, desc.Digest, nil
+	case desc.MediaType.IsImage():
+		image, err := desc.Image()
+		if err != nil {
+			return nil, nil, v1.Hash{}, fmt.Errorf(
+				"failed to read artifact for %q: %w",
+				img,
+				err,
+			)
+		}
+		return nil, image, desc.Digest, nil
+	default:
+		return nil, nil, v1.Hash{}, fmt.Errorf(
+			"unexpected media type in descriptor for artifact %q: %v",
+			img,
+			desc.MediaType,
+		)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtifactType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		mediaType types.MediaType
+		manifest  string
+		want      string
+	}{{
+		name:      "docker image",
+		mediaType: types.DockerManifestSchema2,
+		manifest:  `{"config":{"mediaType":"application/vnd.docker.container.image.v1+json"}}`,
+	}, {
+		name:      "oci image",
+		mediaType: types.OCIManifestSchema1,
+		manifest:  `{"config":{"mediaType":"application/vnd.oci.image.config.v1+json"}}`,
+	}, {
+		name:      "artifact with artifactType",
+		mediaType: types.OCIManifestSchema1,
+		manifest: `{"artifactType":"application/vnd.wasm.content.layer.v1+wasm",` +
+			`"config":{"mediaType":"application/vnd.oci.empty.v1+json"}}`,
+		want: "application/vnd.wasm.content.layer.v1+wasm",
+	}, {
+		name:      "artifact with custom config",
+		mediaType: types.OCIManifestSchema1,
+		manifest:  `{"config":{"mediaType":"application/vnd.cncf.flux.config.v1+json"}}`,
+		want:      "application/vnd.cncf.flux.config.v1+json",
+	}, {
+		name:      "index of images",
+		mediaType: types.OCIImageIndex,
+		manifest:  `{"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json"}]}`,
+	}, {
+		name:      "index of artifacts",
+		mediaType: types.OCIImageIndex,
+		manifest: `{"manifests":[{"artifactType":"application/vnd.wasm.content.layer.v1+wasm"},` +
+			`{"artifactType":"application/vnd.wasm.content.layer.v1+wasm"}]}`,
+		want: "application/vnd.wasm.content.layer.v1+wasm",
+	}, {
+		name:      "index of images and artifacts",
+		mediaType: types.OCIImageIndex,
+		manifest: `{"manifests":[{"artifactType":"application/vnd.wasm.content.layer.v1+wasm"},` +
+			`{"mediaType":"application/vnd.oci.image.manifest.v1+json"}]}`,
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ArtifactType(tt.mediaType, []byte(tt.manifest))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package authnhelpers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/logs"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/oauth2"
+
+	"github.com/mesosphere/mindthegap/docker/acr"
+	"github.com/mesosphere/mindthegap/docker/gcp"
+)
+
+// acrTokenLifetime is how long ACR refresh tokens are reused for, well within their 3 hour validity.
+const acrTokenLifetime = time.Hour
+
+// cloudKeychain mints short-lived credentials for Google Artifact Registry/GCR from the application default
+// credentials and for Azure Container Registry from the default Azure credentials, so that users do not have
+// to log in to these registries first. Registries that credentials cannot be found for are accessed
+// anonymously.
+type cloudKeychain struct {
+	googleOnce        sync.Once
+	googleTokenSource oauth2.TokenSource
+
+	azureOnce       sync.Once
+	azureCredential azcore.TokenCredential
+
+	mu        sync.Mutex
+	acrTokens map[string]acrToken
+}
+
+type acrToken struct {
+	username, token string
+	expiresAt       time.Time
+}
+
+var _ authn.Keychain = &cloudKeychain{}
+
+func (k *cloudKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	registry := target.RegistryStr()
+
+	var (
+		username, token string
+		err             error
+	)
+	switch {
+	case gcp.IsGoogleRegistry(registry):
+		username, token, err = k.resolveGoogle()
+	case acr.IsACRRegistry(registry):
+		username, token, err = k.resolveACR(registry)
+	default:
+		return authn.Anonymous, nil
+	}
+	if err != nil {
+		logs.Debug.Printf("not using cloud credentials for %s: %v", registry, err)
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(authn.AuthConfig{Username: username, Password: token}), nil
+}
+
+func (k *cloudKeychain) resolveGoogle() (username, token string, err error) {
+	k.googleOnce.Do(func() {
+		ts, err := gcp.TokenSource(context.Background())
+		if err != nil {
+			logs.Debug.Print(err)
+			return
+		}
+		k.googleTokenSource = ts
+	})
+	if k.googleTokenSource == nil {
+		return "", "", errNoCloudCredentials
+	}
+	return gcp.RetrieveUsernameAndToken(k.googleTokenSource)
+}
+
+func (k *cloudKeychain) resolveACR(registry string) (username, token string, err error) {
+	k.azureOnce.Do(func() {
+		cred, err := acr.DefaultCredential()
+		if err != nil {
+			logs.Debug.Print(err)
+			return
+		}
+		k.azureCredential = cred
+	})
+	if k.azureCredential == nil {
+		return "", "", errNoCloudCredentials
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if t, ok := k.acrTokens[registry]; ok && time.Now().Before(t.expiresAt) {
+		return t.username, t.token, nil
+	}
+	username, token, err = acr.RetrieveUsernameAndToken(
+		context.Background(), k.azureCredential, registry, remote.DefaultTransport,
+	)
+	if err != nil {
+		return "", "", err
+	}
+	if k.acrTokens == nil {
+		k.acrTokens = map[string]acrToken{}
+	}
+	k.acrTokens[registry] = acrToken{
+		username:  username,
+		token:     token,
+		expiresAt: time.Now().Add(acrTokenLifetime),
+	}
+	return username, token, nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package authnhelpers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/mesosphere/mindthegap/docker/ecr"
+)
+
+// ecrLoginHelper is the name of the Amazon ECR credential helper, which is built in so that it does
+// not need to be installed to authenticate with ECR.
+const ecrLoginHelper = "ecr-login"
+
+var errNoCloudCredentials = errors.New("no cloud credentials found")
+
+// dockerConfigKeychain resolves credentials from a Docker config file, including credentials of
+// credential helpers such as ecr-login, gcloud or acr-env configured via credHelpers or credsStore.
+type dockerConfigKeychain struct {
+	cf *configfile.ConfigFile
+}
+
+var _ authn.Keychain = dockerConfigKeychain{}
+
+// NewKeychain returns the keychain to resolve registry credentials with. If authFile is specified,
+// credentials are only read from that file, in the format of the Docker config file
+// (~/.docker/config.json) or the containers auth file (auth.json) used by podman and skopeo.
+// Otherwise credentials are read from the Docker config file in $DOCKER_CONFIG or ~/.docker, falling
+// back to the containers auth file. Credentials for Google Artifact Registry/GCR and Azure Container
+// Registry that are not configured in either file are minted from the cloud's default credentials.
+func NewKeychain(authFile string) (authn.Keychain, error) {
+	cf, err := loadConfigFile(authFile)
+	if err != nil {
+		return nil, err
+	}
+	if authFile == "" {
+		return authn.NewMultiKeychain(
+			dockerConfigKeychain{cf: cf},
+			authn.DefaultKeychain,
+			&cloudKeychain{},
+		), nil
+	}
+	return authn.NewMultiKeychain(dockerConfigKeychain{cf: cf}, &cloudKeychain{}), nil
+}
+
+// HasRegistryCredentials returns whether credentials or a credential helper for the registry are
+// configured in the registry auth file, see NewKeychain.
+func HasRegistryCredentials(authFile, registry string) (bool, error) {
+	cf, err := loadConfigFile(authFile)
+	if err != nil {
+		return false, err
+	}
+	key := registry
+	if key == name.DefaultRegistry {
+		key = authn.DefaultAuthKey
+	}
+	if _, ok := cf.CredentialHelpers[key]; ok {
+		return true, nil
+	}
+	_, ok := cf.AuthConfigs[key]
+	return ok, nil
+}
+
+func loadConfigFile(authFile string) (*configfile.ConfigFile, error) {
+	if authFile == "" {
+		cf, err := config.Load(config.Dir())
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Docker config file: %w", err)
+		}
+		return cf, nil
+	}
+
+	f, err := os.Open(authFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry auth file: %w", err)
+	}
+	defer f.Close()
+	cf, err := config.LoadFromReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse registry auth file %q: %w", authFile, err)
+	}
+	cf.Filename = authFile
+	return cf, nil
+}
+
+func (k dockerConfigKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	registry := target.RegistryStr()
+	key := registry
+	if key == name.DefaultRegistry {
+		key = authn.DefaultAuthKey
+	}
+
+	if k.credentialHelper(key) == ecrLoginHelper && ecr.IsECRRegistry(registry) {
+		if _, err := exec.LookPath("docker-credential-" + ecrLoginHelper); err != nil {
+			return resolveECR(registry)
+		}
+	}
+
+	cfg, err := k.cf.GetAuthConfig(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials for %s: %w", registry, err)
+	}
+	authCfg := authn.AuthConfig{
+		Username:      cfg.Username,
+		Password:      cfg.Password,
+		Auth:          cfg.Auth,
+		IdentityToken: cfg.IdentityToken,
+		RegistryToken: cfg.RegistryToken,
+	}
+	if authCfg == (authn.AuthConfig{}) {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(authCfg), nil
+}
+
+// credentialHelper returns the credential helper configured for the registry, if any.
+func (k dockerConfigKeychain) credentialHelper(registry string) string {
+	if helper, ok := k.cf.CredentialHelpers[registry]; ok {
+		return helper
+	}
+	return k.cf.CredentialsStore
+}
+
+// resolveECR retrieves a token for the ECR registry using the default AWS credentials, in the same
+// way as the ecr-login credential helper.
+func resolveECR(registry string) (authn.Authenticator, error) {
+	client, err := ecr.ClientForRegistry(registry)
+	if err != nil {
+		return nil, err
+	}
+	username, token, err := ecr.RetrieveUsernameAndToken(client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve ECR credentials for %s: %w", registry, err)
+	}
+	return authn.FromConfig(authn.AuthConfig{Username: username, Password: token}), nil
+}
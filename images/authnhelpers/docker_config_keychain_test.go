@@ -0,0 +1,89 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package authnhelpers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKeychainFromAuthFile(t *testing.T) {
+	t.Parallel()
+
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	require.NoError(t, os.WriteFile(authFile, []byte(`{
+  "auths": {
+    "https://index.docker.io/v1/": {"auth": "aHViOnNlY3JldA=="},
+    "registry.example.com": {"username": "user", "password": "pass"}
+  }
+}`), 0o600))
+
+	keychain, err := NewKeychain(authFile)
+	require.NoError(t, err)
+
+	tests := []struct {
+		registry string
+		want     authn.AuthConfig
+	}{{
+		registry: "docker.io",
+		want:     authn.AuthConfig{Username: "hub", Password: "secret"},
+	}, {
+		registry: "registry.example.com",
+		want:     authn.AuthConfig{Username: "user", Password: "pass"},
+	}, {
+		registry: "other.example.com",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.registry, func(t *testing.T) {
+			t.Parallel()
+
+			reg, err := name.NewRegistry(tt.registry)
+			require.NoError(t, err)
+			auth, err := keychain.Resolve(reg)
+			require.NoError(t, err)
+			if tt.want == (authn.AuthConfig{}) {
+				assert.Equal(t, authn.Anonymous, auth)
+				return
+			}
+			got, err := auth.Authorization()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want.Username, got.Username)
+			assert.Equal(t, tt.want.Password, got.Password)
+		})
+	}
+}
+
+func TestNewKeychainMissingAuthFile(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewKeychain(filepath.Join(t.TempDir(), "missing.json"))
+	require.ErrorContains(t, err, "failed to read registry auth file")
+}
+
+func TestHasRegistryCredentials(t *testing.T) {
+	t.Parallel()
+
+	authFile := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(authFile, []byte(`{
+  "auths": {"myregistry.azurecr.io": {"auth": "dXNlcjpwYXNz"}},
+  "credHelpers": {"europe-west1-docker.pkg.dev": "gcloud"}
+}`), 0o600))
+
+	for registry, want := range map[string]bool{
+		"myregistry.azurecr.io":       true,
+		"europe-west1-docker.pkg.dev": true,
+		"gcr.io":                      false,
+	} {
+		got, err := HasRegistryCredentials(authFile, registry)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, registry)
+	}
+}
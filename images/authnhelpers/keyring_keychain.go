@@ -0,0 +1,76 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package authnhelpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/zalando/go-keyring"
+)
+
+// keyringService is the service that registry credentials are stored under in the OS keyring, one
+// entry per registry, so that they neither overwrite nor are mistaken for the credentials of other
+// applications, e.g. those stored by docker login.
+const keyringService = "mindthegap-registry-credentials"
+
+// keyringCredentials are the credentials stored in the OS keyring for a registry. The password is
+// stored as prompted, it is not exchanged for a token.
+type keyringCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Keyring stores registry credentials in the OS keyring, i.e. the macOS keychain, the Windows
+// credential manager or the Secret Service on Linux.
+type Keyring struct {
+	get func(service, user string) (string, error)
+	set func(service, user, secret string) error
+}
+
+var _ authn.Keychain = &Keyring{}
+
+// NewKeyring returns the OS keyring, failing if it is not available, e.g. on Linux without a
+// Secret Service provider such as GNOME Keyring or KWallet.
+func NewKeyring() (*Keyring, error) {
+	k := &Keyring{get: keyring.Get, set: keyring.Set}
+	// Credentials of the empty registry are never stored, so this only fails if the keyring is not
+	// available.
+	if _, err := k.get(keyringService, ""); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return nil, fmt.Errorf("no OS keyring available: %w", err)
+	}
+	return k, nil
+}
+
+// Resolve implements authn.Keychain, returning the credentials stored for the registry of the
+// target, or anonymous if none are stored.
+func (k *Keyring) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	registry := target.RegistryStr()
+	secret, err := k.get(keyringService, registry)
+	if err != nil {
+		if errors.Is(err, keyring.ErrNotFound) {
+			return authn.Anonymous, nil
+		}
+		return nil, fmt.Errorf("failed to get credentials for %s from OS keyring: %w", registry, err)
+	}
+	var creds keyringCredentials
+	if err := json.Unmarshal([]byte(secret), &creds); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials for %s from OS keyring: %w", registry, err)
+	}
+	return authn.FromConfig(authn.AuthConfig{Username: creds.Username, Password: creds.Password}), nil
+}
+
+// Store stores the credentials for the registry, replacing credentials stored before.
+func (k *Keyring) Store(registry string, cfg authn.AuthConfig) error {
+	secret, err := json.Marshal(keyringCredentials{Username: cfg.Username, Password: cfg.Password})
+	if err != nil {
+		return err
+	}
+	if err := k.set(keyringService, registry, string(secret)); err != nil {
+		return fmt.Errorf("failed to store credentials for %s in OS keyring: %w", registry, err)
+	}
+	return nil
+}
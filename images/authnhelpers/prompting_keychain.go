@@ -0,0 +1,227 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package authnhelpers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"golang.org/x/term"
+)
+
+// ErrCredentialsRejected is returned when a registry rejects prompted credentials.
+var ErrCredentialsRejected = errors.New("registry rejected credentials")
+
+// verifyCredentialsTimeout bounds verifying prompted credentials before storing them.
+const verifyCredentialsTimeout = 30 * time.Second
+
+// CredentialOptions configures resolving registry credentials that are neither configured in the
+// images config file nor in the registry auth file.
+type CredentialOptions struct {
+	// UseKeyring resolves credentials stored in the OS keyring, storing prompted credentials in it.
+	UseKeyring bool
+	// Prompt prompts for credentials of registries that no credentials are found for, once per
+	// registry.
+	Prompt bool
+}
+
+// Keychain returns kc extended with the credentials in the OS keyring and prompting for
+// credentials, as configured by the options.
+func (o CredentialOptions) Keychain(kc authn.Keychain) (authn.Keychain, error) {
+	var keyring *Keyring
+	if o.UseKeyring {
+		var err error
+		keyring, err = NewKeyring()
+		if err != nil {
+			return nil, err
+		}
+		kc = authn.NewMultiKeychain(keyring, kc)
+	}
+	if o.Prompt {
+		prompt, err := TerminalPrompt(os.Stdin, os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		var store StoreFunc
+		if keyring != nil {
+			store = VerifiedStore(keyring.Store, VerifyCredentials)
+		}
+		kc = newPromptingKeychain(kc, prompt, store, processPromptedCredentials)
+	}
+	return kc, nil
+}
+
+// PromptFunc prompts for the credentials of the registry, returning empty credentials to access the
+// registry anonymously.
+type PromptFunc func(registry string) (authn.AuthConfig, error)
+
+// StoreFunc stores prompted credentials of the registry, e.g. in the OS keyring.
+type StoreFunc func(registry string, cfg authn.AuthConfig) error
+
+// VerifyFunc verifies credentials of the registry with an authenticated request, returning
+// ErrCredentialsRejected if the registry rejects them.
+type VerifyFunc func(registry string, cfg authn.AuthConfig) error
+
+// VerifiedStore returns a StoreFunc that only stores credentials with store once verify has
+// verified them, so that mistyped credentials are never stored. Credentials that the registry
+// rejects fail with ErrCredentialsRejected, and credentials that cannot be verified, e.g. as the
+// registry is unreachable or uses a TLS configuration of the images config file, are not stored
+// but used as prompted.
+func VerifiedStore(store StoreFunc, verify VerifyFunc) StoreFunc {
+	return func(registry string, cfg authn.AuthConfig) error {
+		if err := verify(registry, cfg); err != nil {
+			if errors.Is(err, ErrCredentialsRejected) {
+				return err
+			}
+			return nil
+		}
+		return store(registry, cfg)
+	}
+}
+
+// VerifyCredentials verifies credentials by authenticating to the registry API, exchanging them for
+// a token if the registry uses token authentication.
+func VerifyCredentials(registry string, cfg authn.AuthConfig) error {
+	reg, err := name.NewRegistry(registry)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), verifyCredentialsTimeout)
+	defer cancel()
+
+	tr, err := transport.NewWithContext(ctx, reg, authn.FromConfig(cfg), remote.DefaultTransport, nil)
+	if err != nil {
+		return wrapRejectedCredentials(registry, err)
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet, fmt.Sprintf("%s://%s/v2/", reg.Scheme(), reg.RegistryStr()), http.NoBody,
+	)
+	if err != nil {
+		return err
+	}
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return wrapRejectedCredentials(registry, transport.CheckError(resp, http.StatusOK))
+}
+
+func wrapRejectedCredentials(registry string, err error) error {
+	var terr *transport.Error
+	if errors.As(err, &terr) &&
+		(terr.StatusCode == http.StatusUnauthorized || terr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w of %s: %w", ErrCredentialsRejected, registry, err)
+	}
+	return err
+}
+
+// TerminalPrompt returns a PromptFunc that reads the username and password from the terminal in,
+// writing prompts to out. The password is not echoed.
+func TerminalPrompt(in *os.File, out io.Writer) (PromptFunc, error) {
+	if !term.IsTerminal(int(in.Fd())) {
+		return nil, errors.New("prompting for registry credentials requires an interactive terminal")
+	}
+	r := bufio.NewReader(in)
+	return func(registry string) (authn.AuthConfig, error) {
+		fmt.Fprintf(out, "Username for %s (leave empty to access it anonymously): ", registry)
+		username, err := r.ReadString('\n')
+		if err != nil {
+			return authn.AuthConfig{}, fmt.Errorf("failed to read username: %w", err)
+		}
+		username = strings.TrimSpace(username)
+		if username == "" {
+			return authn.AuthConfig{}, nil
+		}
+		fmt.Fprintf(out, "Password for %s@%s: ", username, registry)
+		password, err := term.ReadPassword(int(in.Fd()))
+		fmt.Fprintln(out)
+		if err != nil {
+			return authn.AuthConfig{}, fmt.Errorf("failed to read password: %w", err)
+		}
+		return authn.AuthConfig{Username: username, Password: string(password)}, nil
+	}, nil
+}
+
+// promptedCredentials caches prompted credentials by registry.
+type promptedCredentials struct {
+	mu    sync.Mutex
+	creds map[string]authn.AuthConfig
+}
+
+// processPromptedCredentials caches credentials prompted for by all keychains of the process, so
+// that commands creating several bundles only prompt once per registry.
+var processPromptedCredentials = &promptedCredentials{}
+
+// promptingKeychain prompts for the credentials of registries that the wrapped keychain does not
+// resolve any credentials for.
+type promptingKeychain struct {
+	inner  authn.Keychain
+	prompt PromptFunc
+	store  StoreFunc
+	cache  *promptedCredentials
+}
+
+var _ authn.Keychain = &promptingKeychain{}
+
+// NewPromptingKeychain returns a keychain that prompts for the credentials of registries that kc
+// does not resolve any credentials for, storing the credentials with store if not nil. Every
+// registry is only prompted for once, unless store fails with ErrCredentialsRejected, in which case
+// the registry is prompted for again.
+func NewPromptingKeychain(kc authn.Keychain, prompt PromptFunc, store StoreFunc) authn.Keychain {
+	return newPromptingKeychain(kc, prompt, store, &promptedCredentials{})
+}
+
+func newPromptingKeychain(
+	kc authn.Keychain,
+	prompt PromptFunc,
+	store StoreFunc,
+	cache *promptedCredentials,
+) authn.Keychain {
+	return &promptingKeychain{inner: kc, prompt: prompt, store: store, cache: cache}
+}
+
+func (k *promptingKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	auth, err := k.inner.Resolve(target)
+	if err != nil || auth != authn.Anonymous {
+		return auth, err
+	}
+
+	registry := target.RegistryStr()
+	// Serialize prompts, so that images pulled concurrently do not prompt at the same time.
+	k.cache.mu.Lock()
+	defer k.cache.mu.Unlock()
+	cfg, ok := k.cache.creds[registry]
+	if !ok {
+		cfg, err = k.prompt(registry)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Username != "" && k.store != nil {
+			if err := k.store(registry, cfg); err != nil {
+				return nil, err
+			}
+		}
+		if k.cache.creds == nil {
+			k.cache.creds = make(map[string]authn.AuthConfig)
+		}
+		k.cache.creds[registry] = cfg
+	}
+	if cfg.Username == "" {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(cfg), nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package authnhelpers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+)
+
+// fakeKeyring is an in-memory OS keyring, storing secrets by service and user.
+type fakeKeyring map[[2]string]string
+
+func (k fakeKeyring) get(service, user string) (string, error) {
+	secret, ok := k[[2]string{service, user}]
+	if !ok {
+		return "", keyring.ErrNotFound
+	}
+	return secret, nil
+}
+
+func (k fakeKeyring) set(service, user, secret string) error {
+	k[[2]string{service, user}] = secret
+	return nil
+}
+
+func (k fakeKeyring) keyring() *Keyring {
+	return &Keyring{get: k.get, set: k.set}
+}
+
+func TestPromptingKeychainWithKeyring(t *testing.T) {
+	t.Parallel()
+
+	store := fakeKeyring{}
+	keyring := store.keyring()
+
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	require.NoError(t, os.WriteFile(authFile, []byte(`{
+  "auths": {
+    "registry.example.com": {"username": "user", "password": "pass"}
+  }
+}`), 0o600))
+	configured, err := NewKeychain(authFile)
+	require.NoError(t, err)
+
+	var prompted []string
+	prompt := func(registry string) (authn.AuthConfig, error) {
+		prompted = append(prompted, registry)
+		if registry == "public.example.com" {
+			return authn.AuthConfig{}, nil
+		}
+		return authn.AuthConfig{Username: "prompted", Password: "secret"}, nil
+	}
+	keychain := NewPromptingKeychain(authn.NewMultiKeychain(keyring, configured), prompt, keyring.Store)
+
+	resolve := func(registry string) authn.AuthConfig {
+		t.Helper()
+		reg, err := name.NewRegistry(registry)
+		require.NoError(t, err)
+		auth, err := keychain.Resolve(reg)
+		require.NoError(t, err)
+		cfg, err := auth.Authorization()
+		require.NoError(t, err)
+		return *cfg
+	}
+
+	assert.Equal(t, authn.AuthConfig{Username: "user", Password: "pass"}, resolve("registry.example.com"))
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, authn.AuthConfig{Username: "prompted", Password: "secret"}, resolve("private.example.com"))
+		assert.Equal(t, authn.AuthConfig{}, resolve("public.example.com"))
+	}
+	assert.Equal(t, []string{"private.example.com", "public.example.com"}, prompted,
+		"every registry without credentials should be prompted for once")
+
+	assert.Equal(t, fakeKeyring{
+		{"mindthegap-registry-credentials", "private.example.com"}: `{"username":"prompted","password":"secret"}`,
+	}, store, "only prompted credentials should be stored in the keyring under a namespaced service")
+
+	// Subsequent runs reuse the credentials stored in the keyring without prompting.
+	reg, err := name.NewRegistry("private.example.com")
+	require.NoError(t, err)
+	auth, err := keyring.Resolve(reg)
+	require.NoError(t, err)
+	cfg, err := auth.Authorization()
+	require.NoError(t, err)
+	assert.Equal(t, &authn.AuthConfig{Username: "prompted", Password: "secret"}, cfg)
+}
+
+func TestPromptingKeychainVerifiesBeforeStoring(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	reg, err := name.NewRegistry(strings.TrimPrefix(srv.URL, "http://"))
+	require.NoError(t, err)
+
+	store := fakeKeyring{}
+	keyring := store.keyring()
+
+	passwords := []string{"mistyped", "secret"}
+	prompt := func(string) (authn.AuthConfig, error) {
+		password := passwords[0]
+		passwords = passwords[1:]
+		return authn.AuthConfig{Username: "user", Password: password}, nil
+	}
+	keychain := NewPromptingKeychain(keyring, prompt, VerifiedStore(keyring.Store, VerifyCredentials))
+
+	_, err = keychain.Resolve(reg)
+	require.ErrorIs(t, err, ErrCredentialsRejected)
+	assert.Empty(t, store, "rejected credentials should not be stored")
+
+	auth, err := keychain.Resolve(reg)
+	require.NoError(t, err, "the registry should be prompted for again after rejecting credentials")
+	cfg, err := auth.Authorization()
+	require.NoError(t, err)
+	assert.Equal(t, &authn.AuthConfig{Username: "user", Password: "secret"}, cfg)
+	assert.Contains(t, store[[2]string{keyringService, reg.RegistryStr()}], `"password":"secret"`)
+}
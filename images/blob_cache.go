@@ -0,0 +1,119 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/cache"
+)
+
+// NewBlobCache returns a filesystem cache of image blobs in dir. Unlike the filesystem cache it is
+// based on, blobs are written to temporary files and only moved into the cache once they have been
+// read completely, so that concurrent pulls of the same blob and interrupted pulls never leave
+// partial blobs in the cache.
+func NewBlobCache(dir string) cache.Cache {
+	return &blobCache{Cache: cache.NewFilesystemCache(dir), dir: dir}
+}
+
+type blobCache struct {
+	cache.Cache
+	dir string
+}
+
+func (c *blobCache) Put(l v1.Layer) (v1.Layer, error) {
+	return &cachingLayer{Layer: l, dir: c.dir}, nil
+}
+
+type cachingLayer struct {
+	v1.Layer
+	dir string
+}
+
+func (l *cachingLayer) Compressed() (io.ReadCloser, error) {
+	digest, err := l.Digest()
+	if err != nil {
+		return nil, err
+	}
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	return l.cacheWhileReading(rc, digest)
+}
+
+func (l *cachingLayer) Uncompressed() (io.ReadCloser, error) {
+	diffID, err := l.DiffID()
+	if err != nil {
+		return nil, err
+	}
+	rc, err := l.Layer.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	return l.cacheWhileReading(rc, diffID)
+}
+
+func (l *cachingLayer) cacheWhileReading(rc io.ReadCloser, h v1.Hash) (io.ReadCloser, error) {
+	if err := os.MkdirAll(l.dir, 0o700); err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	f, err := os.CreateTemp(l.dir, ".tmp-*")
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return &cachingReadCloser{rc: rc, f: f, dest: blobCachePath(l.dir, h)}, nil
+}
+
+// cachingReadCloser copies everything read to a temporary file, which is moved to dest on close if
+// everything was read successfully.
+type cachingReadCloser struct {
+	rc       io.ReadCloser
+	f        *os.File
+	dest     string
+	complete bool
+	writeErr error
+}
+
+func (c *cachingReadCloser) Read(b []byte) (int, error) {
+	n, err := c.rc.Read(b)
+	if n > 0 && c.writeErr == nil {
+		// Failing to cache the blob must not fail reading it.
+		_, c.writeErr = c.f.Write(b[:n])
+	}
+	if errors.Is(err, io.EOF) {
+		c.complete = true
+	}
+	return n, err
+}
+
+func (c *cachingReadCloser) Close() error {
+	err := c.rc.Close()
+	closeErr := c.f.Close()
+	if err != nil || closeErr != nil || !c.complete || c.writeErr != nil {
+		_ = os.Remove(c.f.Name())
+		return err
+	}
+	if renameErr := os.Rename(c.f.Name(), c.dest); renameErr != nil {
+		_ = os.Remove(c.f.Name())
+	}
+	return nil
+}
+
+// blobCachePath returns the same path as used by the filesystem cache so that cached blobs are found.
+func blobCachePath(dir string, h v1.Hash) string {
+	file := h.String()
+	if runtime.GOOS == "windows" {
+		file = strings.ReplaceAll(file, ":", "-")
+	}
+	return filepath.Join(dir, file)
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/cache"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobCache(t *testing.T) {
+	t.Parallel()
+
+	layer, err := random.Layer(1024, "")
+	require.NoError(t, err)
+	digest, err := layer.Digest()
+	require.NoError(t, err)
+
+	t.Run("partially read blob is not cached", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		c := NewBlobCache(dir)
+		cached, err := c.Put(layer)
+		require.NoError(t, err)
+
+		rc, err := cached.Compressed()
+		require.NoError(t, err)
+		_, err = rc.Read(make([]byte, 10))
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+
+		_, err = c.Get(digest)
+		require.ErrorIs(t, err, cache.ErrNotFound)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("completely read blob is cached", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		c := NewBlobCache(dir)
+		cached, err := c.Put(layer)
+		require.NoError(t, err)
+
+		rc, err := cached.Compressed()
+		require.NoError(t, err)
+		want, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+
+		fromCache, err := c.Get(digest)
+		require.NoError(t, err)
+		fromCacheDigest, err := fromCache.Digest()
+		require.NoError(t, err)
+		assert.Equal(t, digest, fromCacheDigest)
+		fromCacheRC, err := fromCache.Compressed()
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = fromCacheRC.Close() })
+		got, err := io.ReadAll(fromCacheRC)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+}
@@ -0,0 +1,276 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// blobLocationsFile is the file in the blob info cache directory that blob locations are persisted
+// to, see LoadBlobLocations.
+const blobLocationsFile = "blob-locations.json"
+
+// BlobLocations records the repositories of registries that blobs have been written to, like the
+// blob info cache of containers/image, so that images sharing layers with images written before
+// mount the layers from those repositories instead of transferring them again. Locations are only
+// known within a run unless they are loaded from and saved to a blob info cache directory, blobs
+// themselves are cached across runs by NewBlobCache.
+type BlobLocations struct {
+	// locations maps blobLocationKeys to the name of the repository the blob has been written to.
+	locations sync.Map
+	// file is the file the locations are saved to, if any.
+	file string
+}
+
+type blobLocationKey struct {
+	registry string
+	digest   v1.Hash
+}
+
+// blobLocationsJSON is the format blob locations are persisted in, mapping registries to blob digests
+// to the repositories of the registry that the blobs have been written to.
+type blobLocationsJSON struct {
+	Registries map[string]map[string]string `json:"registries"`
+}
+
+// NewBlobLocations returns empty blob locations.
+func NewBlobLocations() *BlobLocations {
+	return &BlobLocations{}
+}
+
+// LoadBlobLocations returns the blob locations persisted in the blob info cache directory dir, which
+// are saved back to dir by Save. Blobs may have been deleted from the recorded repositories since,
+// in which case they are transferred again when mounting them fails.
+func LoadBlobLocations(dir string) (*BlobLocations, error) {
+	b := &BlobLocations{file: filepath.Join(dir, blobLocationsFile)}
+	persisted, err := readBlobLocations(b.file)
+	if err != nil {
+		return nil, err
+	}
+	for registry, digests := range persisted.Registries {
+		for digest, repository := range digests {
+			h, err := v1.NewHash(digest)
+			if err != nil {
+				continue
+			}
+			repo, err := name.NewRepository(registry+"/"+repository, name.StrictValidation)
+			if err != nil {
+				continue
+			}
+			b.locations.Store(blobLocationKey{registry: registry, digest: h}, repo)
+		}
+	}
+	return b, nil
+}
+
+// Save persists the blob locations to the blob info cache directory they have been loaded from, if
+// any, merging them with the locations that other runs have persisted in the meantime.
+func (b *BlobLocations) Save() error {
+	if b.file == "" {
+		return nil
+	}
+	persisted, err := readBlobLocations(b.file)
+	if err != nil {
+		return err
+	}
+	b.locations.Range(func(k, v any) bool {
+		key, repo := k.(blobLocationKey), v.(name.Repository)
+		if persisted.Registries[key.registry] == nil {
+			persisted.Registries[key.registry] = map[string]string{}
+		}
+		persisted.Registries[key.registry][key.digest.String()] = repo.RepositoryStr()
+		return true
+	})
+
+	data, err := json.Marshal(persisted)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(b.file), 0o755); err != nil {
+		return fmt.Errorf("failed to create blob info cache directory: %w", err)
+	}
+	// Write to a temporary file first so that concurrent runs never read partially written files.
+	tmp, err := os.CreateTemp(filepath.Dir(b.file), "."+blobLocationsFile+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to write blob info cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), b.file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write blob info cache: %w", err)
+	}
+	return nil
+}
+
+func readBlobLocations(file string) (*blobLocationsJSON, error) {
+	persisted := &blobLocationsJSON{}
+	data, err := os.ReadFile(file)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read blob info cache: %w", err)
+	default:
+		if err := json.Unmarshal(data, persisted); err != nil {
+			return nil, fmt.Errorf("failed to parse blob info cache %s: %w", file, err)
+		}
+	}
+	if persisted.Registries == nil {
+		persisted.Registries = map[string]map[string]string{}
+	}
+	return persisted, nil
+}
+
+// ImageIndex returns idx with the blobs of its images that have been written to the registry of repo
+// before mountable from the repositories they have been written to, see remote.MountableLayer, and a
+// function to call once idx has been written to repo, recording where its blobs have been written
+// to.
+func (b *BlobLocations) ImageIndex(idx v1.ImageIndex, repo name.Repository) (v1.ImageIndex, func()) {
+	written := &writtenLayers{}
+	return &mountingIndex{inner: idx, locations: b, registry: repo.RegistryStr(), written: written},
+		b.recordFunc(repo, written)
+}
+
+// Image is like ImageIndex for images that are written on their own.
+func (b *BlobLocations) Image(img v1.Image, repo name.Repository) (v1.Image, func()) {
+	written := &writtenLayers{}
+	return &mountingImage{Image: img, locations: b, registry: repo.RegistryStr(), written: written},
+		b.recordFunc(repo, written)
+}
+
+func (b *BlobLocations) recordFunc(repo name.Repository, written *writtenLayers) func() {
+	return func() {
+		written.mu.Lock()
+		defer written.mu.Unlock()
+		for _, digest := range written.digests {
+			b.locations.Store(blobLocationKey{registry: repo.RegistryStr(), digest: digest}, repo)
+		}
+	}
+}
+
+// layer returns l mountable from the repository of the registry it has been written to, if any,
+// adding its digest to written.
+func (b *BlobLocations) layer(l v1.Layer, registry string, written *writtenLayers) (v1.Layer, error) {
+	digest, err := l.Digest()
+	if err != nil {
+		return nil, err
+	}
+	written.add(digest)
+	repo, ok := b.locations.Load(blobLocationKey{registry: registry, digest: digest})
+	if !ok {
+		return l, nil
+	}
+	return &remote.MountableLayer{
+		Layer:     l,
+		Reference: repo.(name.Repository).Digest(digest.String()),
+	}, nil
+}
+
+// writtenLayers collects the digests of the layers of an index as they are written, as images of an
+// index are written concurrently.
+type writtenLayers struct {
+	mu      sync.Mutex
+	digests []v1.Hash
+}
+
+func (w *writtenLayers) add(digest v1.Hash) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.digests = append(w.digests, digest)
+}
+
+// mountingIndex wraps the images of an index in mountingImage. Like the index of the cache package,
+// it does not embed the wrapped index so that its children are always looked up via Image and
+// ImageIndex.
+type mountingIndex struct {
+	inner     v1.ImageIndex
+	locations *BlobLocations
+	registry  string
+	written   *writtenLayers
+}
+
+func (ii *mountingIndex) MediaType() (types.MediaType, error)       { return ii.inner.MediaType() }
+func (ii *mountingIndex) Digest() (v1.Hash, error)                  { return ii.inner.Digest() }
+func (ii *mountingIndex) Size() (int64, error)                      { return ii.inner.Size() }
+func (ii *mountingIndex) IndexManifest() (*v1.IndexManifest, error) { return ii.inner.IndexManifest() }
+func (ii *mountingIndex) RawManifest() ([]byte, error)              { return ii.inner.RawManifest() }
+
+func (ii *mountingIndex) Image(h v1.Hash) (v1.Image, error) {
+	img, err := ii.inner.Image(h)
+	if err != nil {
+		return nil, err
+	}
+	return &mountingImage{Image: img, locations: ii.locations, registry: ii.registry, written: ii.written}, nil
+}
+
+func (ii *mountingIndex) ImageIndex(h v1.Hash) (v1.ImageIndex, error) {
+	idx, err := ii.inner.ImageIndex(h)
+	if err != nil {
+		return nil, err
+	}
+	return &mountingIndex{inner: idx, locations: ii.locations, registry: ii.registry, written: ii.written}, nil
+}
+
+// mountingImage makes the layers and config of an image mountable from the repositories they have been
+// written to.
+type mountingImage struct {
+	v1.Image
+	locations *BlobLocations
+	registry  string
+	written   *writtenLayers
+}
+
+func (i *mountingImage) Layers() ([]v1.Layer, error) {
+	ls, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	mls := make([]v1.Layer, 0, len(ls))
+	for _, l := range ls {
+		ml, err := i.locations.layer(l, i.registry, i.written)
+		if err != nil {
+			return nil, err
+		}
+		mls = append(mls, ml)
+	}
+	return mls, nil
+}
+
+func (i *mountingImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	l, err := i.Image.LayerByDigest(h)
+	if err != nil {
+		return nil, err
+	}
+	return i.locations.layer(l, i.registry, i.written)
+}
+
+// Descriptor retains the descriptor of the image in the index, see partial.Descriptor.
+func (i *mountingImage) Descriptor() (*v1.Descriptor, error) {
+	return partial.Descriptor(i.Image)
+}
+
+// ConfigLayer makes the config blob mountable like the layers, see partial.ConfigLayer.
+func (i *mountingImage) ConfigLayer() (v1.Layer, error) {
+	l, err := partial.ConfigLayer(i.Image)
+	if err != nil {
+		return nil, err
+	}
+	return i.locations.layer(l, i.registry, i.written)
+}
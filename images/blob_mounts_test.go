@@ -0,0 +1,124 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/docker/registry"
+)
+
+// uploadCountingTransport counts the blob uploads sent to the registry.
+type uploadCountingTransport struct {
+	uploads atomic.Int32
+}
+
+func (t *uploadCountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodPatch {
+		t.uploads.Add(1)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestBlobLocationsMountLayers(t *testing.T) {
+	t.Parallel()
+
+	reg, err := registry.NewRegistry(registry.Config{StorageDirectory: t.TempDir()})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+
+	idx, err := random.Index(1024, 2, 2)
+	require.NoError(t, err)
+
+	locations := NewBlobLocations()
+	write := func(repository string) int32 {
+		t.Helper()
+		repo, err := name.NewRepository(reg.Address()+"/"+repository, name.Insecure)
+		require.NoError(t, err)
+		tr := &uploadCountingTransport{}
+		wrapped, recordLocations := locations.ImageIndex(idx, repo)
+		require.NoError(t, remote.WriteIndex(repo.Tag("v1"), wrapped, remote.WithTransport(tr)))
+		recordLocations()
+		return tr.uploads.Load()
+	}
+
+	assert.NotZero(t, write("library/a"), "layers should be uploaded to the first repository")
+	assert.Zero(t, write("library/b"), "layers should be mounted from the first repository")
+
+	ref, err := name.ParseReference(reg.Address()+"/library/b:v1", name.Insecure)
+	require.NoError(t, err)
+	written, err := remote.Index(ref)
+	require.NoError(t, err)
+	require.NoError(t, validate.Index(written), "mounted layers should be readable from the second repository")
+}
+
+func TestBlobLocationsPersistedAcrossRuns(t *testing.T) {
+	t.Parallel()
+
+	reg, err := registry.NewRegistry(registry.Config{StorageDirectory: t.TempDir()})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+
+	img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+
+	cacheDir := t.TempDir()
+	// Every write is a separate run, loading the blob locations saved by the previous runs.
+	write := func(repository string) int32 {
+		t.Helper()
+		locations, err := LoadBlobLocations(cacheDir)
+		require.NoError(t, err)
+		repo, err := name.NewRepository(reg.Address()+"/"+repository, name.Insecure)
+		require.NoError(t, err)
+		tr := &uploadCountingTransport{}
+		wrapped, recordLocations := locations.Image(img, repo)
+		require.NoError(t, remote.Write(repo.Tag("v1"), wrapped, remote.WithTransport(tr)))
+		recordLocations()
+		require.NoError(t, locations.Save())
+		return tr.uploads.Load()
+	}
+
+	assert.NotZero(t, write("library/a"), "layers should be uploaded to the first repository")
+	assert.Zero(t, write("library/b"), "layers should be mounted from the repository of the previous run")
+
+	// Locations are only used for the registry they have been recorded for.
+	other, err := LoadBlobLocations(cacheDir)
+	require.NoError(t, err)
+	otherRepo, err := name.NewRepository("other.example.com/library/c")
+	require.NoError(t, err)
+	wrapped, _ := other.Image(img, otherRepo)
+	layers, err := wrapped.Layers()
+	require.NoError(t, err)
+	for _, l := range layers {
+		_, mountable := l.(*remote.MountableLayer)
+		assert.False(t, mountable, "layers should not be mounted from other registries")
+	}
+}
+
+func TestLoadBlobLocationsCorruptCache(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, blobLocationsFile), []byte("{"), 0o600))
+	_, err := LoadBlobLocations(cacheDir)
+	require.ErrorContains(t, err, "failed to parse blob info cache")
+}
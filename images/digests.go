@@ -0,0 +1,118 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/opencontainers/go-digest"
+)
+
+// ErrUnsupportedDigestAlgorithm is returned for images that are referenced by, or whose content is
+// addressed by, digests using an algorithm other than sha256, which go-containerregistry, used to
+// copy images, cannot read. Such images can be copied with DistributionCopier instead.
+var ErrUnsupportedDigestAlgorithm = errors.New("unsupported digest algorithm")
+
+// ValidateDigestAlgorithm returns an error wrapping ErrUnsupportedDigestAlgorithm if the image is
+// referenced by a digest using an algorithm other than sha256, e.g. nginx@sha512:<hex>.
+func ValidateDigestAlgorithm(img string) error {
+	ref, err := reference.Parse(img)
+	if err != nil {
+		// Invalid references are reported when the reference is parsed for copying.
+		return nil //nolint:nilerr // See above.
+	}
+	digested, ok := ref.(reference.Digested)
+	if !ok {
+		return nil
+	}
+	if algorithm := digested.Digest().Algorithm(); algorithm != digest.SHA256 {
+		return fmt.Errorf(
+			"image %q is referenced by a %s digest: %w",
+			img,
+			algorithm,
+			ErrUnsupportedDigestAlgorithm,
+		)
+	}
+	return nil
+}
+
+// digestDescriptor is a descriptor in a manifest, of which only the fields required to copy the
+// content it describes are read.
+type digestDescriptor struct {
+	MediaType string        `json:"mediaType"`
+	Digest    digest.Digest `json:"digest"`
+	Size      int64         `json:"size"`
+}
+
+// manifestDescriptors are the descriptors of the content referenced by image manifests, image
+// indexes and artifact manifests.
+type manifestDescriptors struct {
+	Config    *digestDescriptor  `json:"config"`
+	Layers    []digestDescriptor `json:"layers"`
+	Manifests []digestDescriptor `json:"manifests"`
+	Blobs     []digestDescriptor `json:"blobs"`
+	Subject   *digestDescriptor  `json:"subject"`
+}
+
+// validateManifestDigests returns an error wrapping ErrUnsupportedDigestAlgorithm if the manifest
+// of the image references content by digests using an algorithm other than sha256, before the
+// manifest is parsed for copying, which would fail with an opaque parsing error.
+func validateManifestDigests(img string, manifest []byte) error {
+	var m manifestDescriptors
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		// Invalid manifests are reported when the manifest is parsed for copying.
+		return nil //nolint:nilerr // See above.
+	}
+	descriptors := append(append(m.Layers, m.Manifests...), m.Blobs...)
+	if m.Config != nil {
+		descriptors = append(descriptors, *m.Config)
+	}
+	if m.Subject != nil {
+		descriptors = append(descriptors, *m.Subject)
+	}
+	for _, d := range descriptors {
+		if algorithm := d.Digest.Algorithm(); algorithm != digest.SHA256 {
+			return fmt.Errorf(
+				"image %q references content by a %s digest: %w",
+				img,
+				algorithm,
+				ErrUnsupportedDigestAlgorithm,
+			)
+		}
+	}
+	return nil
+}
+
+// ValidateImageDigests returns an error wrapping ErrUnsupportedDigestAlgorithm if the manifest
+// described by desc, or any manifest of the index it describes, references content by digests
+// using an algorithm other than sha256. Unlike the validation of images when they are read for
+// copying, the manifests of indexes are read as well, e.g. for single platform images that have
+// been copied in an index by DistributionCopier.
+func ValidateImageDigests(ref name.Reference, desc *remote.Descriptor, opts ...remote.Option) error {
+	if err := validateManifestDigests(ref.String(), desc.Manifest); err != nil {
+		return err
+	}
+	if !desc.MediaType.IsIndex() {
+		return nil
+	}
+	var index manifestDescriptors
+	if err := json.Unmarshal(desc.Manifest, &index); err != nil {
+		return fmt.Errorf("failed to read image index for %q: %w", ref, err)
+	}
+	for _, d := range index.Manifests {
+		child, err := remote.Get(ref.Context().Digest(d.Digest.String()), opts...)
+		if err != nil {
+			return fmt.Errorf("failed to read manifest %s of %q: %w", d.Digest, ref, err)
+		}
+		if err := validateManifestDigests(ref.String(), child.Manifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDigestAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		img     string
+		wantErr bool
+	}{{
+		name: "tag",
+		img:  "docker.io/library/nginx:1.21.5",
+	}, {
+		name: "sha256 digest",
+		img:  "docker.io/library/nginx@sha256:" + strings.Repeat("a", 64),
+	}, {
+		name:    "sha512 digest",
+		img:     "docker.io/library/nginx@sha512:" + strings.Repeat("a", 128),
+		wantErr: true,
+	}, {
+		name: "invalid reference",
+		img:  "docker.io/library/NGINX",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateDigestAlgorithm(tt.img)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrUnsupportedDigestAlgorithm)
+				assert.ErrorContains(t, err, "sha512 digest")
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestValidateManifestDigests(t *testing.T) {
+	t.Parallel()
+
+	sha256Digest := "sha256:" + strings.Repeat("a", 64)
+	sha512Digest := "sha512:" + strings.Repeat("a", 128)
+
+	tests := []struct {
+		name     string
+		manifest string
+		wantErr  bool
+	}{{
+		name: "sha256 image manifest",
+		manifest: `{"config": {"digest": "` + sha256Digest + `"}, "layers": [{"digest": "` + sha256Digest +
+			`"}]}`,
+	}, {
+		name:     "sha512 layer",
+		manifest: `{"config": {"digest": "` + sha256Digest + `"}, "layers": [{"digest": "` + sha512Digest + `"}]}`,
+		wantErr:  true,
+	}, {
+		name:     "sha512 config",
+		manifest: `{"config": {"digest": "` + sha512Digest + `"}}`,
+		wantErr:  true,
+	}, {
+		name:     "sha512 manifest in index",
+		manifest: `{"manifests": [{"digest": "` + sha256Digest + `"}, {"digest": "` + sha512Digest + `"}]}`,
+		wantErr:  true,
+	}, {
+		name:     "sha512 subject",
+		manifest: `{"config": {"digest": "` + sha256Digest + `"}, "subject": {"digest": "` + sha512Digest + `"}}`,
+		wantErr:  true,
+	}, {
+		name:     "invalid manifest is reported when parsed for copying",
+		manifest: `not json`,
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateManifestDigests("img", []byte(tt.manifest))
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrUnsupportedDigestAlgorithm)
+				assert.ErrorContains(t, err, "sha512 digest")
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,515 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+// manifestLimit is the maximum size of manifests that are read.
+const manifestLimit = 4 << 20
+
+// manifestMediaTypes are the media types of manifests that are accepted when reading manifests.
+var manifestMediaTypes = []types.MediaType{
+	types.OCIImageIndex,
+	types.OCIManifestSchema1,
+	types.DockerManifestList,
+	types.DockerManifestSchema2,
+}
+
+// DistributionCopier copies images directly via the distribution API, addressing all content by
+// the digests it is referenced by, which go-containerregistry can only do for sha256 digests. It
+// is used to copy images that are addressed by digests using other algorithms supported by
+// go-digest, e.g. sha512, see ErrUnsupportedDigestAlgorithm. Manifests are copied exactly as they
+// are stored, except for removing unrequested platforms from indexes.
+type DistributionCopier struct {
+	// SourceTransport and SourceKeychain are the transport and credentials to read from the
+	// source registry with. Anonymous access is used if SourceKeychain is nil.
+	SourceTransport http.RoundTripper
+	SourceKeychain  authn.Keychain
+	// DestTransport and DestKeychain are the transport and credentials to write to the
+	// destination registry with. Anonymous access is used if DestKeychain is nil.
+	DestTransport http.RoundTripper
+	DestKeychain  authn.Keychain
+	// UserAgent is sent with all requests.
+	UserAgent string
+	// IncludeNonDistributable copies non-distributable (foreign) layers as well.
+	IncludeNonDistributable bool
+}
+
+// Copy copies the manifest srcReference, a tag or digest, of the source repository and all content
+// it references to dest. Container images are copied with only the requested platforms like
+// ManifestListForImage does, single platform images are copied in an index containing only them,
+// and OCI artifacts are copied exactly as they are stored. The digest of the manifest written to
+// dest is returned, using the digest algorithm the source registry addresses the manifest by.
+func (c *DistributionCopier) Copy(
+	ctx context.Context,
+	src name.Repository,
+	srcReference string,
+	dest name.Tag,
+	platforms []platform.Platform,
+	w *warnings.Collector,
+) (digest.Digest, error) {
+	srcClient, err := newDistributionClient(
+		ctx, src, c.SourceTransport, c.SourceKeychain, c.UserAgent, transport.PullScope,
+	)
+	if err != nil {
+		return "", err
+	}
+	destClient, err := newDistributionClient(
+		ctx, dest.Context(), c.DestTransport, c.DestKeychain, c.UserAgent, transport.PushScope,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	img := src.String() + referenceSeparator(srcReference) + srcReference
+	m, err := srcClient.getManifest(ctx, srcReference)
+	if err != nil {
+		return "", fmt.Errorf("failed to read manifest for %q: %w", img, err)
+	}
+	artifactType, err := ArtifactType(m.mediaType, m.body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read manifest for %q: %w", img, err)
+	}
+
+	switch {
+	case artifactType != "":
+	case m.mediaType.IsIndex():
+		if m, err = retainOnlyRequestedPlatforms(img, m, w, platforms...); err != nil {
+			return "", err
+		}
+	case m.mediaType.IsImage():
+		if err := c.copyManifest(ctx, srcClient, destClient, m, m.digest.String()); err != nil {
+			return "", err
+		}
+		if m, err = indexForSinglePlatformManifest(ctx, img, srcClient, m, w, platforms...); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unexpected media type in descriptor for image %q: %v", img, m.mediaType)
+	}
+
+	if err := c.copyManifest(ctx, srcClient, destClient, m, dest.TagStr()); err != nil {
+		return "", err
+	}
+	return m.digest, nil
+}
+
+// copyManifest copies the content referenced by the manifest to the destination, followed by the
+// manifest itself as destReference.
+func (c *DistributionCopier) copyManifest(
+	ctx context.Context,
+	src, dest *distributionClient,
+	m *rawManifest,
+	destReference string,
+) error {
+	var descriptors manifestDescriptors
+	if err := json.Unmarshal(m.body, &descriptors); err != nil {
+		return fmt.Errorf("failed to parse manifest %s: %w", m.digest, err)
+	}
+
+	for _, d := range descriptors.Manifests {
+		child, err := src.getManifest(ctx, d.Digest.String())
+		if err != nil {
+			return fmt.Errorf("failed to read manifest %s: %w", d.Digest, err)
+		}
+		if err := c.copyManifest(ctx, src, dest, child, d.Digest.String()); err != nil {
+			return err
+		}
+	}
+
+	blobs := append(descriptors.Layers, descriptors.Blobs...)
+	if descriptors.Config != nil {
+		blobs = append(blobs, *descriptors.Config)
+	}
+	for _, d := range blobs {
+		if !c.IncludeNonDistributable && !types.MediaType(d.MediaType).IsDistributable() {
+			continue
+		}
+		if err := copyBlob(ctx, src, dest, d); err != nil {
+			return fmt.Errorf("failed to copy blob %s: %w", d.Digest, err)
+		}
+	}
+
+	return dest.putManifest(ctx, destReference, m)
+}
+
+// copyBlob copies the blob to the destination unless it exists there already, verifying its
+// content against its digest.
+func copyBlob(ctx context.Context, src, dest *distributionClient, d digestDescriptor) error {
+	if exists, err := dest.blobExists(ctx, d.Digest); err != nil || exists {
+		return err
+	}
+	blob, err := src.getBlob(ctx, d.Digest)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	verifier := d.Digest.Verifier()
+	if err := dest.putBlob(ctx, d.Digest, d.Size, io.TeeReader(blob, verifier)); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("content does not match digest %s", d.Digest)
+	}
+	return nil
+}
+
+// retainOnlyRequestedPlatforms returns the index m containing only the requested platforms,
+// recording a warning for every requested platform that the index does not provide.
+func retainOnlyRequestedPlatforms(
+	img string,
+	m *rawManifest,
+	w *warnings.Collector,
+	platforms ...platform.Platform,
+) (*rawManifest, error) {
+	if len(platforms) == 0 {
+		return m, nil
+	}
+
+	var index ocispec.Index
+	if err := json.Unmarshal(m.body, &index); err != nil {
+		return nil, fmt.Errorf("failed to read index manifest for %q: %w", img, err)
+	}
+	for _, p := range platforms {
+		found := false
+		for _, desc := range index.Manifests {
+			if desc.Platform != nil && p.Matches(v1Platform(desc.Platform)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			if err := w.Warnf(
+				warnings.MissingPlatform,
+				"image %q does not provide requested platform %q", img, p,
+			); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	retained := index.Manifests[:0]
+	for _, desc := range index.Manifests {
+		if desc.Platform == nil {
+			continue
+		}
+		for _, p := range platforms {
+			if p.Matches(v1Platform(desc.Platform)) {
+				retained = append(retained, desc)
+				break
+			}
+		}
+	}
+	if len(retained) == len(index.Manifests) {
+		return m, nil
+	}
+	index.Manifests = retained
+
+	body, err := json.Marshal(index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write index manifest for %q: %w", img, err)
+	}
+	return &rawManifest{mediaType: m.mediaType, body: body, digest: m.digest.Algorithm().FromBytes(body)}, nil
+}
+
+// indexForSinglePlatformManifest returns an index containing the single platform image manifest m,
+// which must match any of the requested platforms, like indexForSinglePlatformImage does.
+func indexForSinglePlatformManifest(
+	ctx context.Context,
+	img string,
+	src *distributionClient,
+	m *rawManifest,
+	w *warnings.Collector,
+	platforms ...platform.Platform,
+) (*rawManifest, error) {
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(m.body, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to read image manifest for %q: %w", img, err)
+	}
+	configBlob, err := src.getBlob(ctx, manifest.Config.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image config for image %q: %w", img, err)
+	}
+	defer configBlob.Close()
+	var imgConfig ocispec.Image
+	if err := json.NewDecoder(configBlob).Decode(&imgConfig); err != nil {
+		return nil, fmt.Errorf("failed to get image config for image %q: %w", img, err)
+	}
+	imgPlatform := ocispec.Platform{
+		OS:           imgConfig.OS,
+		OSVersion:    imgConfig.OSVersion,
+		Architecture: imgConfig.Architecture,
+		Variant:      imgConfig.Variant,
+	}
+
+	if len(platforms) > 0 {
+		if imgConfig.OS == "" || imgConfig.Architecture == "" {
+			return nil, fmt.Errorf(
+				"single platform image %q does not specify its platform in its config, "+
+					"cannot verify that it matches the requested platforms",
+				img,
+			)
+		}
+		var missing []platform.Platform
+		for _, p := range platforms {
+			if !p.Matches(v1Platform(&imgPlatform)) {
+				missing = append(missing, p)
+			}
+		}
+		if len(missing) == len(platforms) {
+			return nil, fmt.Errorf(
+				"single platform image %q for platform %q does not provide any of the requested platforms %v",
+				img,
+				v1Platform(&imgPlatform).String(),
+				platforms,
+			)
+		}
+		for _, p := range missing {
+			if err := w.Warnf(
+				warnings.MissingPlatform,
+				"image %q does not provide requested platform %q (single platform image for %q)",
+				img, p, v1Platform(&imgPlatform).String(),
+			); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	body, err := json.Marshal(ocispec.Index{
+		Versioned: manifest.Versioned,
+		MediaType: string(types.DockerManifestList),
+		Manifests: []ocispec.Descriptor{{
+			MediaType: string(m.mediaType),
+			Digest:    m.digest,
+			Size:      int64(len(m.body)),
+			Platform:  &imgPlatform,
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write index manifest for %q: %w", img, err)
+	}
+	return &rawManifest{
+		mediaType: types.DockerManifestList,
+		body:      body,
+		digest:    m.digest.Algorithm().FromBytes(body),
+	}, nil
+}
+
+func v1Platform(p *ocispec.Platform) v1.Platform {
+	return v1.Platform{
+		OS:           p.OS,
+		OSVersion:    p.OSVersion,
+		Architecture: p.Architecture,
+		Variant:      p.Variant,
+		OSFeatures:   p.OSFeatures,
+	}
+}
+
+// referenceSeparator returns the separator of a repository and the reference, which is a digest if
+// it contains a colon.
+func referenceSeparator(reference string) string {
+	if strings.Contains(reference, ":") {
+		return "@"
+	}
+	return ":"
+}
+
+// rawManifest is a manifest exactly as it is stored in a registry.
+type rawManifest struct {
+	mediaType types.MediaType
+	body      []byte
+	// digest is the digest the manifest is addressed by in the registry.
+	digest digest.Digest
+}
+
+// distributionClient accesses a repository via the distribution API.
+type distributionClient struct {
+	repo   name.Repository
+	client *http.Client
+}
+
+func newDistributionClient(
+	ctx context.Context,
+	repo name.Repository,
+	rt http.RoundTripper,
+	keychain authn.Keychain,
+	userAgent string,
+	scope string,
+) (*distributionClient, error) {
+	auth := authn.Anonymous
+	if keychain != nil {
+		var err error
+		if auth, err = keychain.Resolve(repo); err != nil {
+			return nil, fmt.Errorf("failed to resolve credentials for %s: %w", repo, err)
+		}
+	}
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	rt, err := transport.NewWithContext(
+		ctx, repo.Registry, auth, transport.NewUserAgent(rt, userAgent), []string{repo.Scope(scope)},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &distributionClient{repo: repo, client: &http.Client{Transport: rt}}, nil
+}
+
+func (c *distributionClient) url(kind, reference string) string {
+	return fmt.Sprintf(
+		"%s://%s/v2/%s/%s/%s",
+		c.repo.Registry.Scheme(), c.repo.RegistryStr(), c.repo.RepositoryStr(), kind, reference,
+	)
+}
+
+func (c *distributionClient) do(
+	ctx context.Context,
+	method, u string,
+	body io.Reader,
+	header http.Header,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return c.client.Do(req)
+}
+
+// getManifest reads the manifest reference, a tag or digest, verifying manifests read by digest.
+// Manifests read by tag are addressed by the digest reported by the registry if it uses an
+// algorithm other than sha256, or else by their sha256 digest.
+func (c *distributionClient) getManifest(ctx context.Context, reference string) (*rawManifest, error) {
+	accept := make([]string, 0, len(manifestMediaTypes))
+	for _, mt := range manifestMediaTypes {
+		accept = append(accept, string(mt))
+	}
+	resp, err := c.do(
+		ctx, http.MethodGet, c.url("manifests", reference), http.NoBody,
+		http.Header{"Accept": {strings.Join(accept, ",")}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := transport.CheckError(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, manifestLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	dgst, err := digest.Parse(reference)
+	if err != nil {
+		dgst = digest.Canonical.FromBytes(body)
+		if reported, err := digest.Parse(resp.Header.Get("Docker-Content-Digest")); err == nil {
+			dgst = reported.Algorithm().FromBytes(body)
+		}
+	}
+	if dgst.Algorithm().FromBytes(body) != dgst {
+		return nil, fmt.Errorf("manifest does not match digest %s", dgst)
+	}
+
+	return &rawManifest{
+		mediaType: types.MediaType(resp.Header.Get("Content-Type")),
+		body:      body,
+		digest:    dgst,
+	}, nil
+}
+
+func (c *distributionClient) putManifest(ctx context.Context, reference string, m *rawManifest) error {
+	resp, err := c.do(
+		ctx, http.MethodPut, c.url("manifests", reference), bytes.NewReader(m.body),
+		http.Header{"Content-Type": {string(m.mediaType)}},
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return transport.CheckError(resp, http.StatusOK, http.StatusCreated, http.StatusAccepted)
+}
+
+func (c *distributionClient) blobExists(ctx context.Context, dgst digest.Digest) (bool, error) {
+	resp, err := c.do(ctx, http.MethodHead, c.url("blobs", dgst.String()), http.NoBody, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err := transport.CheckError(resp, http.StatusOK); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *distributionClient) getBlob(ctx context.Context, dgst digest.Digest) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, c.url("blobs", dgst.String()), http.NoBody, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := transport.CheckError(resp, http.StatusOK); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// putBlob uploads the blob in a single request.
+func (c *distributionClient) putBlob(ctx context.Context, dgst digest.Digest, size int64, r io.Reader) error {
+	resp, err := c.do(ctx, http.MethodPost, c.url("blobs", "uploads/"), http.NoBody, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if err := transport.CheckError(resp, http.StatusAccepted); err != nil {
+		return err
+	}
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid upload location: %w", err)
+	}
+	query := location.Query()
+	query.Set("digest", dgst.String())
+	location.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, location.String(), r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+	resp, err = c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return transport.CheckError(resp, http.StatusCreated)
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/docker/registry"
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+func startRegistry(t *testing.T) *registry.Registry {
+	t.Helper()
+
+	reg, err := registry.NewRegistry(registry.Config{StorageDirectory: t.TempDir()})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+	return reg
+}
+
+// pushSHA512Image pushes an image for the platform whose manifest and content are addressed by
+// sha512 digests, returning its manifest.
+func pushSHA512Image(t *testing.T, c *distributionClient, p ocispec.Platform) *rawManifest {
+	t.Helper()
+
+	pushBlob := func(mediaType string, content []byte) ocispec.Descriptor {
+		t.Helper()
+		d := ocispec.Descriptor{
+			MediaType: mediaType,
+			Digest:    digest.SHA512.FromBytes(content),
+			Size:      int64(len(content)),
+		}
+		require.NoError(t, c.putBlob(context.Background(), d.Digest, d.Size, bytes.NewReader(content)))
+		return d
+	}
+	config, err := json.Marshal(ocispec.Image{Platform: p})
+	require.NoError(t, err)
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    pushBlob(ocispec.MediaTypeImageConfig, config),
+		Layers:    []ocispec.Descriptor{pushBlob(ocispec.MediaTypeImageLayer, []byte(p.Architecture+" layer"))},
+	})
+	require.NoError(t, err)
+	m := &rawManifest{
+		mediaType: types.OCIManifestSchema1,
+		body:      manifest,
+		digest:    digest.SHA512.FromBytes(manifest),
+	}
+	require.NoError(t, c.putManifest(context.Background(), m.digest.String(), m))
+	return m
+}
+
+func TestDistributionCopierSHA512(t *testing.T) {
+	t.Parallel()
+
+	srcReg, destReg := startRegistry(t), startRegistry(t)
+	srcRepo, err := name.NewRepository(srcReg.Address() + "/library/app")
+	require.NoError(t, err)
+	src, err := newDistributionClient(context.Background(), srcRepo, nil, nil, "", "push,pull")
+	require.NoError(t, err)
+
+	amd64 := pushSHA512Image(t, src, ocispec.Platform{OS: "linux", Architecture: "amd64"})
+	arm64 := pushSHA512Image(t, src, ocispec.Platform{OS: "linux", Architecture: "arm64"})
+	index, err := json.Marshal(ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{{
+			MediaType: ocispec.MediaTypeImageManifest,
+			Digest:    amd64.digest,
+			Size:      int64(len(amd64.body)),
+			Platform:  &ocispec.Platform{OS: "linux", Architecture: "amd64"},
+		}, {
+			MediaType: ocispec.MediaTypeImageManifest,
+			Digest:    arm64.digest,
+			Size:      int64(len(arm64.body)),
+			Platform:  &ocispec.Platform{OS: "linux", Architecture: "arm64"},
+		}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, src.putManifest(context.Background(), "v1", &rawManifest{
+		mediaType: types.OCIImageIndex,
+		body:      index,
+		digest:    digest.SHA512.FromBytes(index),
+	}))
+
+	// Images addressing content by sha512 digests cannot be copied with go-containerregistry.
+	_, err = ManifestListForImage(srcRepo.Tag("v1").String(), nil, warnings.NewCollector(false))
+	require.ErrorIs(t, err, ErrUnsupportedDigestAlgorithm)
+
+	destTag, err := name.NewTag(destReg.Address() + "/library/app:v1")
+	require.NoError(t, err)
+	copier := &DistributionCopier{}
+	copied, err := copier.Copy(
+		context.Background(), srcRepo, "v1", destTag,
+		[]platform.Platform{platform.MustParse("linux/arm64")}, warnings.NewCollector(false),
+	)
+	require.NoError(t, err)
+
+	dest, err := newDistributionClient(context.Background(), destTag.Context(), nil, nil, "", "pull")
+	require.NoError(t, err)
+	copiedIndex, err := dest.getManifest(context.Background(), "v1")
+	require.NoError(t, err)
+	// The index is addressed by the sha256 digest that the source registry reports for the tag.
+	assert.Equal(t, digest.Canonical.FromBytes(copiedIndex.body), copied)
+	var idx ocispec.Index
+	require.NoError(t, json.Unmarshal(copiedIndex.body, &idx))
+	require.Len(t, idx.Manifests, 1, "only the requested platform should be copied")
+	assert.Equal(t, arm64.digest, idx.Manifests[0].Digest)
+
+	copiedImage, err := dest.getManifest(context.Background(), arm64.digest.String())
+	require.NoError(t, err, "the image should be pullable by its sha512 digest")
+	assert.Equal(t, arm64.body, copiedImage.body, "the image manifest should be copied as is")
+	var manifest ocispec.Manifest
+	require.NoError(t, json.Unmarshal(copiedImage.body, &manifest))
+	for _, d := range append(manifest.Layers, manifest.Config) {
+		exists, err := dest.blobExists(context.Background(), d.Digest)
+		require.NoError(t, err)
+		assert.True(t, exists, "blob %s should be copied", d.Digest)
+	}
+	_, err = dest.getManifest(context.Background(), amd64.digest.String())
+	require.Error(t, err, "unrequested platforms should not be copied")
+
+	// Single platform images are copied in an index, referencing them by their sha512 digest.
+	singleTag, err := name.NewTag(destReg.Address() + "/library/single:v1")
+	require.NoError(t, err)
+	_, err = copier.Copy(
+		context.Background(), srcRepo, amd64.digest.String(), singleTag,
+		[]platform.Platform{platform.MustParse("linux/amd64")}, warnings.NewCollector(false),
+	)
+	require.NoError(t, err)
+	single, err := newDistributionClient(context.Background(), singleTag.Context(), nil, nil, "", "pull")
+	require.NoError(t, err)
+	singleIndex, err := single.getManifest(context.Background(), "v1")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(singleIndex.body, &idx))
+	require.Len(t, idx.Manifests, 1)
+	assert.Equal(t, amd64.digest, idx.Manifests[0].Digest)
+
+	_, err = copier.Copy(
+		context.Background(), srcRepo, amd64.digest.String(), singleTag,
+		[]platform.Platform{platform.MustParse("linux/s390x")}, warnings.NewCollector(false),
+	)
+	require.ErrorContains(t, err, "does not provide any of the requested platforms")
+}
+
+func TestDistributionCopierRejectsModifiedContent(t *testing.T) {
+	t.Parallel()
+
+	srcReg := startRegistry(t)
+	srcRepo, err := name.NewRepository(srcReg.Address() + "/library/app")
+	require.NoError(t, err)
+	src, err := newDistributionClient(context.Background(), srcRepo, nil, nil, "", "push,pull")
+	require.NoError(t, err)
+	m := pushSHA512Image(t, src, ocispec.Platform{OS: "linux", Architecture: "amd64"})
+
+	// The manifest is read by a digest it does not match.
+	_, err = src.getManifest(context.Background(), digest.SHA512.FromString("other").String())
+	require.Error(t, err)
+	_, err = src.getManifest(context.Background(), m.digest.String())
+	require.NoError(t, err)
+}
@@ -0,0 +1,209 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package httputils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/logs"
+)
+
+// ClockSkewError is returned when the TLS certificate of a host is not valid at the local time,
+// which on air-gapped hosts is frequently caused by a wrong local clock rather than by an invalid
+// certificate.
+type ClockSkewError struct {
+	Host      string
+	LocalTime time.Time
+	NotBefore time.Time
+	NotAfter  time.Time
+	// Skew is the minimum amount the local clock would have to be wrong by for the certificate to be
+	// valid, negative if the local clock is behind.
+	Skew time.Duration
+	Err  error
+}
+
+func (e *ClockSkewError) Error() string {
+	direction := "ahead"
+	skew := e.Skew
+	if skew < 0 {
+		direction, skew = "behind", -skew
+	}
+	return fmt.Sprintf(
+		"TLS certificate of %s is not valid at the local time %s (valid from %s to %s): "+
+			"either the certificate is invalid or the local clock is at least %s %s, "+
+			"correct the local clock or specify --clock-skew-tolerance: %v",
+		e.Host,
+		e.LocalTime.UTC().Format(time.RFC3339),
+		e.NotBefore.UTC().Format(time.RFC3339),
+		e.NotAfter.UTC().Format(time.RFC3339),
+		skew.Round(time.Second),
+		direction,
+		e.Err,
+	)
+}
+
+func (e *ClockSkewError) Unwrap() error {
+	return e.Err
+}
+
+// CertificateClockSkew returns how far the local time is outside of the validity period of the
+// certificates, negative if the local time is before the certificates are valid, or zero if the
+// local time is within the validity period.
+func CertificateClockSkew(now time.Time, certs ...*x509.Certificate) time.Duration {
+	notBefore, notAfter := validityPeriod(certs...)
+	switch {
+	case now.Before(notBefore):
+		return now.Sub(notBefore)
+	case now.After(notAfter):
+		return now.Sub(notAfter)
+	default:
+		return 0
+	}
+}
+
+// CertificateFileClockSkew returns the clock skew of the local time to the validity period of the
+// PEM encoded certificates in the file, see CertificateClockSkew, along with the validity period.
+func CertificateFileClockSkew(
+	certFile string,
+	now time.Time,
+) (skew time.Duration, notBefore, notAfter time.Time, err error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return 0, time.Time{}, time.Time{}, fmt.Errorf("failed to read TLS certificate file: %w", err)
+	}
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return 0, time.Time{}, time.Time{}, fmt.Errorf(
+				"failed to parse TLS certificate file %q: %w", certFile, err,
+			)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return 0, time.Time{}, time.Time{}, fmt.Errorf("no certificates found in %q", certFile)
+	}
+	notBefore, notAfter = validityPeriod(certs...)
+	return CertificateClockSkew(now, certs...), notBefore, notAfter, nil
+}
+
+// validityPeriod returns the period during which all certificates are valid.
+func validityPeriod(certs ...*x509.Certificate) (notBefore, notAfter time.Time) {
+	for i, cert := range certs {
+		if i == 0 || cert.NotBefore.After(notBefore) {
+			notBefore = cert.NotBefore
+		}
+		if i == 0 || cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
+		}
+	}
+	return notBefore, notAfter
+}
+
+// verifyConnectionWithClockSkewTolerance returns a function that verifies the certificate chain of
+// a TLS connection in the same way as the standard library, but accepting certificates that are
+// not valid at the local time if they are valid within the tolerance of the local time. It must be
+// used with InsecureSkipVerify, which only disables the default verification.
+//
+// The certificate is verified for the server name of the connection, which is empty for hosts
+// addressed by IP as IPs are never sent as server name, in which case it is verified for host
+// instead, i.e. for the host the transport has been configured for.
+func verifyConnectionWithClockSkewTolerance(
+	host string,
+	roots *x509.CertPool,
+	tolerance time.Duration,
+	now func() time.Time,
+) func(tls.ConnectionState) error {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("tls: server did not provide a certificate")
+		}
+		serverName := cs.ServerName
+		if serverName == "" {
+			serverName = host
+		}
+		if serverName == "" {
+			return errors.New("tls: no server name to verify the certificate for")
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			DNSName:       serverName,
+			CurrentTime:   now(),
+		}
+
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		var invalidErr x509.CertificateInvalidError
+		if !errors.As(err, &invalidErr) || invalidErr.Reason != x509.Expired {
+			return err
+		}
+
+		skew := CertificateClockSkew(opts.CurrentTime, cs.PeerCertificates...)
+		if skew == 0 || skew.Abs() > tolerance {
+			return err
+		}
+		// Verify as if the local clock was correct, i.e. at the nearest time the chain is valid.
+		opts.CurrentTime = opts.CurrentTime.Add(-skew)
+		if _, verifyErr := cs.PeerCertificates[0].Verify(opts); verifyErr != nil {
+			return err
+		}
+
+		logs.Warn.Printf(
+			"accepting TLS certificate of %s that is not valid at the local time, "+
+				"the local clock is wrong by at least %s (within the clock skew tolerance of %s)",
+			serverName, skew.Abs().Round(time.Second), tolerance,
+		)
+		return nil
+	}
+}
+
+// clockSkewDiagnosingTransport explains TLS certificate validity errors that may be caused by a
+// wrong local clock.
+type clockSkewDiagnosingTransport struct {
+	inner http.RoundTripper
+	now   func() time.Time
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *clockSkewDiagnosingTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	resp, err := t.inner.RoundTrip(in)
+
+	var invalidErr x509.CertificateInvalidError
+	if err != nil && errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired &&
+		invalidErr.Cert != nil {
+		now := t.now()
+		return resp, &ClockSkewError{
+			Host:      in.URL.Host,
+			LocalTime: now,
+			NotBefore: invalidErr.Cert.NotBefore,
+			NotAfter:  invalidErr.Cert.NotAfter,
+			Skew:      CertificateClockSkew(now, invalidErr.Cert),
+			Err:       err,
+		}
+	}
+	return resp, err
+}
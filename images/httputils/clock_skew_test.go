@@ -0,0 +1,168 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package httputils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSConfiguredRoundTripperClockSkew(t *testing.T) {
+	t.Parallel()
+
+	// The certificate only becomes valid in 2 hours, as if the local clock was 2 hours behind.
+	notBefore := time.Now().Add(2 * time.Hour)
+	certFile, cert := notYetValidCertificate(t, notBefore)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name               string
+		clockSkewTolerance time.Duration
+		wantClockSkewErr   bool
+	}{{
+		name:             "no tolerance",
+		wantClockSkewErr: true,
+	}, {
+		name:               "skew exceeds tolerance",
+		clockSkewTolerance: time.Hour,
+		wantClockSkewErr:   true,
+	}, {
+		name:               "skew within tolerance",
+		clockSkewTolerance: 3 * time.Hour,
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rt, err := TLSConfiguredRoundTripper(
+				remote.DefaultTransport,
+				srv.Listener.Addr().String(),
+				false,
+				certFile,
+				tt.clockSkewTolerance,
+			)
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL, http.NoBody)
+			require.NoError(t, err)
+			resp, err := rt.RoundTrip(req)
+			if !tt.wantClockSkewErr {
+				require.NoError(t, err)
+				_ = resp.Body.Close()
+				return
+			}
+
+			var clockSkewErr *ClockSkewError
+			require.ErrorAs(t, err, &clockSkewErr)
+			assert.Equal(t, srv.Listener.Addr().String(), clockSkewErr.Host)
+			assert.InDelta(t, -2*time.Hour, clockSkewErr.Skew, float64(time.Minute))
+			assert.Contains(t, err.Error(), "--clock-skew-tolerance")
+		})
+	}
+}
+
+func TestTLSConfiguredRoundTripperClockSkewVerifiesIPHost(t *testing.T) {
+	t.Parallel()
+
+	// The certificate is trusted and valid, but only for another host.
+	certFile, cert := certificate(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "other.example.com"},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(time.Hour),
+		DNSNames:  []string{"other.example.com"},
+	})
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	for _, tolerance := range []time.Duration{0, time.Hour} {
+		rt, err := TLSConfiguredRoundTripper(
+			remote.DefaultTransport, srv.Listener.Addr().String(), false, certFile, tolerance,
+		)
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodGet, srv.URL, http.NoBody)
+		require.NoError(t, err)
+		_, err = rt.RoundTrip(req)
+		var hostnameErr x509.HostnameError
+		require.ErrorAs(t, err, &hostnameErr, "clock skew tolerance %s", tolerance)
+		assert.Contains(t, err.Error(), "doesn't contain any IP SANs")
+	}
+}
+
+func TestCertificateFileClockSkew(t *testing.T) {
+	t.Parallel()
+
+	notBefore := time.Now().Add(time.Hour).Truncate(time.Second)
+	certFile, _ := notYetValidCertificate(t, notBefore)
+
+	skew, gotNotBefore, _, err := CertificateFileClockSkew(certFile, notBefore.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, -time.Hour, skew)
+	assert.True(t, notBefore.Equal(gotNotBefore))
+
+	skew, _, _, err = CertificateFileClockSkew(certFile, notBefore.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, skew)
+}
+
+// notYetValidCertificate writes a self-signed certificate for 127.0.0.1 that is valid for a day
+// from notBefore to a file, returning the file and the certificate to serve.
+func notYetValidCertificate(t *testing.T, notBefore time.Time) (string, tls.Certificate) {
+	t.Helper()
+
+	return certificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:   notBefore,
+		NotAfter:    notBefore.Add(24 * time.Hour),
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	})
+}
+
+// certificate writes a self-signed certificate with the subject, validity period and names of tmpl
+// to a file, returning the file and the certificate to serve.
+func certificate(t *testing.T, tmpl *x509.Certificate) (string, tls.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl.SerialNumber = big.NewInt(1)
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	tmpl.BasicConstraintsValid = true
+	tmpl.IsCA = true
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(
+		t,
+		os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600),
+	)
+	return certFile, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/docker/cli/cli/config"
 	"github.com/docker/docker/registry"
@@ -16,11 +17,16 @@ import (
 	"github.com/google/go-containerregistry/pkg/logs"
 )
 
+// TLSConfiguredRoundTripper returns a round tripper that verifies TLS certificates of the host using
+// the system CAs, the CAs in the Docker certs.d directory of the host and the CA certificate file.
+// Certificates that are not valid at the local time are accepted if they are valid within the clock
+// skew tolerance of the local time, to allow for wrong clocks on air-gapped hosts.
 func TLSConfiguredRoundTripper(
 	rt http.RoundTripper,
 	host string,
 	insecureTLSSkipVerify bool,
 	caCertificateFile string,
+	clockSkewTolerance time.Duration,
 ) (http.RoundTripper, error) {
 	tr := rt.(*http.Transport).Clone()
 
@@ -61,7 +67,14 @@ func TLSConfiguredRoundTripper(
 		_ = tr.TLSClientConfig.RootCAs.AppendCertsFromPEM(b)
 	}
 
-	rt = tr
+	if clockSkewTolerance > 0 {
+		tr.TLSClientConfig.InsecureSkipVerify = true
+		tr.TLSClientConfig.VerifyConnection = verifyConnectionWithClockSkewTolerance(
+			host, tr.TLSClientConfig.RootCAs, clockSkewTolerance, time.Now,
+		)
+	}
+
+	rt = &clockSkewDiagnosingTransport{inner: tr, now: time.Now}
 
 	// Add any http headers if they are set in the config file.
 	cf, err := config.Load(os.Getenv("DOCKER_CONFIG"))
@@ -69,7 +82,7 @@ func TLSConfiguredRoundTripper(
 		logs.Debug.Printf("failed to read config file: %v", err)
 	} else if len(cf.HTTPHeaders) != 0 {
 		rt = &headerTransport{
-			inner:       tr,
+			inner:       rt,
 			httpHeaders: cf.HTTPHeaders,
 		}
 	}
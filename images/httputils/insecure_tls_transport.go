@@ -6,5 +6,5 @@ package httputils
 import "net/http"
 
 func InsecureTLSRoundTripper(rt http.RoundTripper) (http.RoundTripper, error) {
-	return TLSConfiguredRoundTripper(rt, "", true, "")
+	return TLSConfiguredRoundTripper(rt, "", true, "", 0)
 }
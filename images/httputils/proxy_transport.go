@@ -0,0 +1,28 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package httputils
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// ProxiedRoundTripper returns a round tripper that sends requests via the proxy instead of the
+// proxies configured by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables, or directly
+// if proxy is nil.
+func ProxiedRoundTripper(rt http.RoundTripper, proxy *url.URL) http.RoundTripper {
+	tr := rt.(*http.Transport).Clone()
+	if proxy == nil {
+		tr.Proxy = nil
+	} else {
+		tr.Proxy = http.ProxyURL(proxy)
+	}
+	return tr
+}
+
+// LocalRegistryRoundTripper returns a round tripper for the temporary registries that mindthegap
+// runs itself, which never sends requests via a proxy and does not verify TLS certificates.
+func LocalRegistryRoundTripper(rt http.RoundTripper) (http.RoundTripper, error) {
+	return InsecureTLSRoundTripper(ProxiedRoundTripper(rt, nil))
+}
@@ -0,0 +1,34 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package httputils
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxiedRoundTripper(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest(http.MethodGet, "https://registry.example.com/v2/", http.NoBody)
+	require.NoError(t, err)
+
+	base := &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: "env-proxy:3128"})}
+	proxy := &url.URL{Scheme: "http", Host: "proxy.example.com:3128"}
+
+	tr := ProxiedRoundTripper(base, proxy).(*http.Transport)
+	got, err := tr.Proxy(req)
+	require.NoError(t, err)
+	assert.Equal(t, proxy, got)
+
+	assert.Nil(t, ProxiedRoundTripper(base, nil).(*http.Transport).Proxy)
+
+	got, err = base.Proxy(req)
+	require.NoError(t, err)
+	assert.Equal(t, "env-proxy:3128", got.Host, "base transport must not be modified")
+}
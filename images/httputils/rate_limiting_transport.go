@@ -0,0 +1,164 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package httputils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// maxTooManyRequestsRetries limits how many times requests are retried after 429 Too Many
+	// Requests responses.
+	maxTooManyRequestsRetries = 5
+	// maxRetryAfter caps how long to wait before retrying requests after 429 Too Many Requests
+	// responses, regardless of the Retry-After header.
+	maxRetryAfter = 5 * time.Minute
+	// maxBandwidthBurst limits how many bytes can be read at once with a bandwidth limit.
+	maxBandwidthBurst = 256 * 1024
+)
+
+// RateLimiter limits the rate of requests and the bandwidth of response bodies of all round
+// trippers created from it, e.g. to share limits across all images pulled from a registry.
+type RateLimiter struct {
+	requests  *rate.Limiter
+	bandwidth *rate.Limiter
+}
+
+// NewRateLimiter returns a rate limiter for the maximum requests and bytes per second, both of
+// which are unlimited if zero.
+func NewRateLimiter(requestsPerSecond float64, bytesPerSecond int64) *RateLimiter {
+	l := &RateLimiter{}
+	if requestsPerSecond > 0 {
+		l.requests = rate.NewLimiter(rate.Limit(requestsPerSecond), 1)
+	}
+	if bytesPerSecond > 0 {
+		l.bandwidth = rate.NewLimiter(rate.Limit(bytesPerSecond), int(min(bytesPerSecond, maxBandwidthBurst)))
+	}
+	return l
+}
+
+// WithLimits returns a rate limiter that limits requests and bytes per second to the specified
+// limits if they are not zero, sharing the limits of l otherwise.
+func (l *RateLimiter) WithLimits(requestsPerSecond float64, bytesPerSecond int64) *RateLimiter {
+	limits := NewRateLimiter(requestsPerSecond, bytesPerSecond)
+	if limits.requests == nil {
+		limits.requests = l.requests
+	}
+	if limits.bandwidth == nil {
+		limits.bandwidth = l.bandwidth
+	}
+	return limits
+}
+
+// RoundTripper returns a round tripper that makes requests within the limits of the rate limiter.
+// Requests that receive a 429 Too Many Requests response are retried after the delay specified by
+// the Retry-After header of the response, or after an exponential backoff if not specified.
+func (l *RateLimiter) RoundTripper(rt http.RoundTripper) http.RoundTripper {
+	return &rateLimitingRoundTripper{inner: rt, limiter: l}
+}
+
+type rateLimitingRoundTripper struct {
+	inner   http.RoundTripper
+	limiter *RateLimiter
+}
+
+func (r *rateLimitingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		if r.limiter.requests != nil {
+			if err := r.limiter.requests.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := r.inner.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt == maxTooManyRequestsRetries {
+			if r.limiter.bandwidth != nil {
+				resp.Body = &rateLimitedBody{ReadCloser: resp.Body, ctx: ctx, limiter: r.limiter.bandwidth}
+			}
+			return resp, nil
+		}
+
+		// Only requests without a body or with a body that can be read again can be retried.
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, nil
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+
+		delay, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			delay = backoff
+			backoff *= 2
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		timer := time.NewTimer(min(delay, maxRetryAfter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// CloseIdleConnections closes the idle connections of the inner round tripper if supported.
+func (r *rateLimitingRoundTripper) CloseIdleConnections() {
+	if tr, ok := r.inner.(interface{ CloseIdleConnections() }); ok {
+		tr.CloseIdleConnections()
+	}
+}
+
+// retryAfter parses the value of a Retry-After header, either in seconds or an HTTP date, into the
+// delay after now to retry after.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// rateLimitedBody limits the bandwidth of reading a response body.
+type rateLimitedBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+func (b *rateLimitedBody) Read(p []byte) (int, error) {
+	if len(p) > b.limiter.Burst() {
+		p = p[:b.limiter.Burst()]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if waitErr := b.limiter.WaitN(b.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package httputils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterRetriesTooManyRequests(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := &http.Client{Transport: NewRateLimiter(0, 0).RoundTripper(http.DefaultTransport)}
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ok", string(body))
+	assert.EqualValues(t, 3, requests.Load())
+}
+
+func TestRateLimiterGivesUpAfterMaxRetries(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := &http.Client{Transport: NewRateLimiter(0, 0).RoundTripper(http.DefaultTransport)}
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.EqualValues(t, maxTooManyRequestsRetries+1, requests.Load())
+}
+
+func TestRateLimiterLimitsRequestsAndBandwidth(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 1000)))
+	}))
+	t.Cleanup(srv.Close)
+
+	// The first request and the first 500 bytes are allowed immediately by the bursts of the limiters.
+	client := &http.Client{Transport: NewRateLimiter(10, 500).RoundTripper(http.DefaultTransport)}
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, resp.Body)
+		require.NoError(t, resp.Body.Close())
+		require.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 2*time.Second)
+}
+
+func TestRateLimiterWithLimits(t *testing.T) {
+	t.Parallel()
+
+	shared := NewRateLimiter(10, 500)
+
+	limiter := shared.WithLimits(5, 0)
+	assert.NotSame(t, shared.requests, limiter.requests)
+	assert.InDelta(t, 5, float64(limiter.requests.Limit()), 0)
+	assert.Same(t, shared.bandwidth, limiter.bandwidth)
+
+	limiter = shared.WithLimits(0, 0)
+	assert.Same(t, shared.requests, limiter.requests)
+	assert.Same(t, shared.bandwidth, limiter.bandwidth)
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	delay, ok := retryAfter("30", now)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, delay)
+
+	delay, ok = retryAfter(now.Add(time.Minute).Format(http.TimeFormat), now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, delay)
+
+	_, ok = retryAfter("soon", now)
+	assert.False(t, ok)
+	_, ok = retryAfter("", now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,98 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package httputils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTransferStalled is returned for requests that did not receive any bytes for longer than the
+// stall timeout.
+var ErrTransferStalled = errors.New("transfer stalled")
+
+// StallDetectingRoundTripper cancels requests that do not receive any response bytes, neither
+// headers nor body, for longer than the stall timeout, e.g. hung layer downloads.
+type StallDetectingRoundTripper struct {
+	inner        http.RoundTripper
+	stallTimeout time.Duration
+	stalled      atomic.Bool
+}
+
+func NewStallDetectingRoundTripper(
+	rt http.RoundTripper,
+	stallTimeout time.Duration,
+) *StallDetectingRoundTripper {
+	return &StallDetectingRoundTripper{inner: rt, stallTimeout: stallTimeout}
+}
+
+// Stalled returns true if any request made via the round tripper stalled.
+func (s *StallDetectingRoundTripper) Stalled() bool {
+	return s.stalled.Load()
+}
+
+func (s *StallDetectingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if s.stallTimeout <= 0 {
+		return s.inner.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	w := &watchdog{timeout: s.stallTimeout}
+	w.timer = time.AfterFunc(s.stallTimeout, func() {
+		w.stalled.Store(true)
+		s.stalled.Store(true)
+		cancel()
+	})
+
+	resp, err := s.inner.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		w.timer.Stop()
+		cancel()
+		return nil, w.wrap(err)
+	}
+	w.timer.Reset(s.stallTimeout)
+	resp.Body = &stallDetectingBody{ReadCloser: resp.Body, watchdog: w, cancel: cancel}
+	return resp, nil
+}
+
+type watchdog struct {
+	timeout time.Duration
+	timer   *time.Timer
+	stalled atomic.Bool
+}
+
+func (w *watchdog) wrap(err error) error {
+	if !w.stalled.Load() {
+		return err
+	}
+	return fmt.Errorf("%w: no bytes received for %s: %v", ErrTransferStalled, w.timeout, err)
+}
+
+type stallDetectingBody struct {
+	io.ReadCloser
+	watchdog *watchdog
+	cancel   context.CancelFunc
+}
+
+func (b *stallDetectingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.watchdog.timer.Reset(b.watchdog.timeout)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return n, b.watchdog.wrap(err)
+	}
+	return n, err
+}
+
+func (b *stallDetectingBody) Close() error {
+	b.watchdog.timer.Stop()
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package httputils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStallDetectingRoundTripper(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("some bytes"))
+		w.(http.Flusher).Flush()
+		if r.URL.Path == "/stall" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name        string
+		path        string
+		wantStalled bool
+	}{{
+		name: "complete",
+		path: "/",
+	}, {
+		name:        "stalled",
+		path:        "/stall",
+		wantStalled: true,
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rt := NewStallDetectingRoundTripper(http.DefaultTransport, 200*time.Millisecond)
+			client := &http.Client{Transport: rt}
+
+			resp, err := client.Get(srv.URL + tt.path)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			assert.Equal(t, "some bytes", string(body))
+			assert.Equal(t, tt.wantStalled, rt.Stalled())
+			if tt.wantStalled {
+				require.ErrorIs(t, err, ErrTransferStalled)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/containerd"
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+// LocalImageSource is where an image that has not been pushed to any registry is read from.
+type LocalImageSource string
+
+const (
+	DockerDaemon LocalImageSource = "docker-daemon"
+	Containerd   LocalImageSource = "containerd"
+)
+
+// LocalImage is an image that is only available locally, e.g. an image built in CI that has never
+// been pushed to a registry.
+type LocalImage struct {
+	Source LocalImageSource
+	Name   reference.NamedTagged
+}
+
+// ParseLocalImage parses a local image in the format `[<source>://]<image>[:<tag>]`, where source is
+// one of `docker-daemon` (the default) or `containerd`. Image names are normalized in the same way as
+// in plain text images files, and images without a tag default to the `latest` tag.
+func ParseLocalImage(s string) (LocalImage, error) {
+	source, img, found := strings.Cut(s, "://")
+	if !found {
+		source, img = string(DockerDaemon), s
+	}
+	switch LocalImageSource(source) {
+	case DockerDaemon, Containerd:
+	default:
+		return LocalImage{}, fmt.Errorf(
+			"invalid local image %q: unsupported source %q (must be one of %q or %q)",
+			s, source, DockerDaemon, Containerd,
+		)
+	}
+
+	named, err := reference.ParseNormalizedNamed(img)
+	if err != nil {
+		return LocalImage{}, fmt.Errorf("invalid local image %q: %w", s, err)
+	}
+	tagged, ok := reference.TagNameOnly(named).(reference.NamedTagged)
+	if !ok {
+		return LocalImage{}, fmt.Errorf("invalid local image %q: must be referenced by tag", s)
+	}
+
+	return LocalImage{Source: LocalImageSource(source), Name: tagged}, nil
+}
+
+func (i LocalImage) String() string {
+	return fmt.Sprintf("%s://%s", i.Source, i.Name)
+}
+
+// Registry returns the registry the image is bundled under.
+func (i LocalImage) Registry() string {
+	return reference.Domain(i.Name)
+}
+
+// Repository returns the repository the image is bundled under.
+func (i LocalImage) Repository() string {
+	return reference.Path(i.Name)
+}
+
+// LocalImageOptions configures how local images are read.
+type LocalImageOptions struct {
+	// ContainerdNamespace is the containerd namespace to read containerd images from.
+	ContainerdNamespace string
+	// ScratchDir is used to export containerd images to and must exist until the returned index
+	// has been written.
+	ScratchDir string
+}
+
+// ManifestListForLocalImage returns an index for the local image, containing only the requested
+// platforms. Requested platforms that the image does not provide are reported as warnings.
+func ManifestListForLocalImage(
+	ctx context.Context,
+	img LocalImage,
+	platforms []platform.Platform,
+	w *warnings.Collector,
+	opts LocalImageOptions,
+) (v1.ImageIndex, error) {
+	var (
+		index v1.ImageIndex
+		err   error
+	)
+	switch img.Source {
+	case DockerDaemon:
+		index, err = indexFromDockerDaemon(ctx, img)
+	case Containerd:
+		index, err = indexFromContainerd(ctx, img, platforms, opts)
+	default:
+		return nil, fmt.Errorf("unsupported local image source %q", img.Source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index, err = retainOnlyRequestedPlatformsInIndex(img.String(), index, w, platforms...)
+	if err != nil {
+		return nil, err
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index manifest for %q: %w", img, err)
+	}
+	if len(indexManifest.Manifests) == 0 {
+		return nil, fmt.Errorf("local image %q does not provide any requested platform", img)
+	}
+
+	return index, nil
+}
+
+func indexFromDockerDaemon(ctx context.Context, img LocalImage) (v1.ImageIndex, error) {
+	ref, err := name.NewTag(img.Name.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference %q: %w", img.Name, err)
+	}
+	image, err := daemon.Image(ref, daemon.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image %q from Docker daemon: %w", img.Name, err)
+	}
+
+	return indexForImage(img, image)
+}
+
+func indexFromContainerd(
+	ctx context.Context,
+	img LocalImage,
+	platforms []platform.Platform,
+	opts LocalImageOptions,
+) (v1.ImageIndex, error) {
+	platformStrs := make([]string, 0, len(platforms))
+	for _, p := range platforms {
+		platformStrs = append(platformStrs, p.String())
+	}
+
+	archivePath := filepath.Join(opts.ScratchDir, "image.tar")
+	if out, err := containerd.ExportImageArchive(
+		ctx, img.Name.String(), archivePath, opts.ContainerdNamespace, platformStrs...,
+	); err != nil {
+		return nil, errors.Join(err, errors.New(string(out)))
+	}
+
+	layoutDir := filepath.Join(opts.ScratchDir, "layout")
+	if err := archive.UnarchiveToDirectory(archivePath, layoutDir); err != nil {
+		return nil, fmt.Errorf("failed to read image %q exported from containerd: %w", img.Name, err)
+	}
+	layoutIndex, err := layout.ImageIndexFromPath(layoutDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image %q exported from containerd: %w", img.Name, err)
+	}
+	layoutManifest, err := layoutIndex.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image %q exported from containerd: %w", img.Name, err)
+	}
+	if len(layoutManifest.Manifests) != 1 {
+		return nil, fmt.Errorf(
+			"expected a single image exported from containerd for %q, found %d",
+			img.Name, len(layoutManifest.Manifests),
+		)
+	}
+
+	desc := layoutManifest.Manifests[0]
+	switch {
+	case desc.MediaType.IsIndex():
+		return layoutIndex.ImageIndex(desc.Digest)
+	case desc.MediaType.IsImage():
+		image, err := layoutIndex.Image(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image %q exported from containerd: %w", img.Name, err)
+		}
+		return indexForImage(img, image)
+	default:
+		return nil, fmt.Errorf(
+			"unexpected media type in descriptor for image %q: %v",
+			img.Name,
+			desc.MediaType,
+		)
+	}
+}
+
+// indexForImage wraps a single image in an index, using the platform from the image config.
+func indexForImage(img LocalImage, image v1.Image) (v1.ImageIndex, error) {
+	imgConfig, err := image.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image config for image %q: %w", img, err)
+	}
+
+	index := mutate.AppendManifests(
+		empty.Index,
+		mutate.IndexAddendum{
+			Add: image,
+			Descriptor: v1.Descriptor{
+				Platform: &v1.Platform{
+					OS:           imgConfig.OS,
+					OSVersion:    imgConfig.OSVersion,
+					Architecture: imgConfig.Architecture,
+					Variant:      imgConfig.Variant,
+				},
+			},
+		},
+	)
+	return mutate.IndexMediaType(index, types.DockerManifestList), nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/archive"
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+func TestParseLocalImage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in             string
+		wantSource     LocalImageSource
+		wantRegistry   string
+		wantRepository string
+		wantTag        string
+		wantErr        bool
+	}{{
+		in:             "myapp:dev",
+		wantSource:     DockerDaemon,
+		wantRegistry:   "docker.io",
+		wantRepository: "library/myapp",
+		wantTag:        "dev",
+	}, {
+		in:             "docker-daemon://registry.example.com/team/myapp",
+		wantSource:     DockerDaemon,
+		wantRegistry:   "registry.example.com",
+		wantRepository: "team/myapp",
+		wantTag:        "latest",
+	}, {
+		in:             "containerd://registry.example.com:5000/myapp:v1.0.0",
+		wantSource:     Containerd,
+		wantRegistry:   "registry.example.com:5000",
+		wantRepository: "myapp",
+		wantTag:        "v1.0.0",
+	}, {
+		in:      "podman://myapp:dev",
+		wantErr: true,
+	}, {
+		in:      "docker-daemon://MyApp:dev",
+		wantErr: true,
+	}, {
+		in:      "myapp@sha256:907ca53d7e2947e849b839b1cd258c98fd3916c60f2e6e70c30edbf741ab6754",
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.in, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseLocalImage(tt.in)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSource, got.Source)
+			assert.Equal(t, tt.wantRegistry, got.Registry())
+			assert.Equal(t, tt.wantRepository, got.Repository())
+			assert.Equal(t, tt.wantTag, got.Name.Tag())
+		})
+	}
+}
+
+// writeFakeCtr writes a fake ctr binary to a new directory added to PATH that exports the
+// specified archive to the archive path it is called with.
+func writeFakeCtr(t *testing.T, exportedArchive string) {
+	t.Helper()
+
+	binDir := t.TempDir()
+	script := `#!/bin/sh
+eval archive=\${$(($# - 1))}
+cp "` + exportedArchive + `" "$archive"
+`
+	//nolint:gosec // Fake ctr must be executable.
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "ctr"), []byte(script), 0o755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestManifestListForLocalImage_Containerd(t *testing.T) {
+	var index v1.ImageIndex = empty.Index
+	for _, p := range []v1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64"},
+	} {
+		p := p
+		img, err := random.Image(64, 1)
+		require.NoError(t, err)
+		index = mutate.AppendManifests(index, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &p},
+		})
+	}
+
+	layoutDir := t.TempDir()
+	p, err := layout.Write(layoutDir, empty.Index)
+	require.NoError(t, err)
+	require.NoError(t, p.AppendIndex(index))
+	exportedArchive := filepath.Join(t.TempDir(), "exported.tar")
+	require.NoError(t, archive.ArchiveDirectory(layoutDir, exportedArchive))
+	writeFakeCtr(t, exportedArchive)
+
+	img, err := ParseLocalImage("containerd://myapp:dev")
+	require.NoError(t, err)
+
+	w := warnings.NewCollector(false)
+	got, err := ManifestListForLocalImage(
+		context.Background(),
+		img,
+		[]platform.Platform{platform.MustParse("linux/arm64"), platform.MustParse("linux/s390x")},
+		w,
+		LocalImageOptions{ContainerdNamespace: "k8s.io", ScratchDir: t.TempDir()},
+	)
+	require.NoError(t, err)
+
+	gotManifest, err := got.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, gotManifest.Manifests, 1)
+	assert.Equal(t, "arm64", gotManifest.Manifests[0].Platform.Architecture)
+	assert.Len(t, w.Warnings(), 1)
+
+	_, err = ManifestListForLocalImage(
+		context.Background(),
+		img,
+		[]platform.Platform{platform.MustParse("linux/s390x")},
+		nil,
+		LocalImageOptions{ContainerdNamespace: "k8s.io", ScratchDir: t.TempDir()},
+	)
+	require.ErrorContains(t, err, "does not provide any requested platform")
+}
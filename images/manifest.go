@@ -14,13 +14,20 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/warnings"
 )
 
 func ManifestListForImage(
 	img string,
-	platforms []string,
+	platforms []platform.Platform,
+	w *warnings.Collector,
 	opts ...remote.Option,
 ) (v1.ImageIndex, error) {
+	if err := ValidateDigestAlgorithm(img); err != nil {
+		return nil, err
+	}
 	ref, err := name.ParseReference(img)
 	if err != nil {
 		return nil, fmt.Errorf("invalid image reference %q: %w", img, err)
@@ -36,22 +43,52 @@ func ManifestListForImage(
 			)
 		}
 
-		return indexForSinglePlatformImage(ref, localImage, platforms...)
+		return indexForSinglePlatformImage(ref, localImage, w, platforms...)
 	}
 
+	return manifestListForDescriptor(img, ref, desc, platforms, w)
+}
+
+// manifestListForDescriptor returns the index containing only the requested platforms of the image
+// described by desc.
+func manifestListForDescriptor(
+	img string,
+	ref name.Reference,
+	desc *remote.Descriptor,
+	platforms []platform.Platform,
+	w *warnings.Collector,
+) (v1.ImageIndex, error) {
+	if err := validateManifestDigests(img, desc.Manifest); err != nil {
+		return nil, err
+	}
 	switch {
 	case desc.MediaType.IsIndex():
 		index, err := desc.ImageIndex()
 		if err != nil {
-			return nil, fmt.Errorf("failed to read image index for %q: %w", img, err)
+			return nil, fmt.Errorf(
+				"failed to read image index for %q: %w",
+				img,
+				err,
+			)
 		}
-		return retainOnlyRequestedPlatformsInIndex(index, platforms...)
+		index, err = retainOnlyRequestedPlatformsInIndex(img, index, w, platforms...)
+		if err != nil {
+			return nil, err
+		}
+		if err := warnIfDigestChanged(ref, index, w); err != nil {
+			return nil, err
+		}
+		return index, nil
 	case desc.MediaType.IsImage():
 		image, err := desc.Image()
 		if err != nil {
-			return nil, fmt.Errorf("failed to read image for %q: %w", img, err)
+			return nil, fmt.Errorf(
+				"failed to read image for %q: %w",
+				img,
+				err,
+			)
 		}
-		return indexForSinglePlatformImage(ref, image, platforms...)
+		return indexForSinglePlatformImage(ref, image, w, platforms...)
 	default:
 		return nil, fmt.Errorf(
 			"unexpected media type in descriptor for image %q: %v",
@@ -62,26 +99,63 @@ func ManifestListForImage(
 }
 
 func retainOnlyRequestedPlatformsInIndex(
+	img string,
 	index v1.ImageIndex,
-	platforms ...string,
+	w *warnings.Collector,
+	platforms ...platform.Platform,
 ) (v1.ImageIndex, error) {
-	v1Platforms := make([]v1.Platform, 0, len(platforms))
+	if len(platforms) == 0 {
+		return index, nil
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index manifest for %q: %w", img, err)
+	}
 	for _, p := range platforms {
-		v1P, err := v1.ParsePlatform(p)
-		if err != nil {
-			return nil, fmt.Errorf("invalid platform %q: %w", p, err)
+		found := false
+		for i := range indexManifest.Manifests {
+			if desc := indexManifest.Manifests[i]; desc.Platform != nil && p.Matches(*desc.Platform) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			if err := w.Warnf(
+				warnings.MissingPlatform,
+				"image %q does not provide requested platform %q", img, p,
+			); err != nil {
+				return nil, err
+			}
 		}
-		v1Platforms = append(v1Platforms, *v1P)
 	}
 
-	if len(platforms) == 0 {
-		return index, nil
+	return mutate.RemoveManifests(index, notMatcher(platform.Matcher(platforms...))), nil
+}
+
+// warnIfDigestChanged warns if an image requested by digest will not be available under that
+// digest, because removing unrequested platforms changed the digest of its manifest list.
+func warnIfDigestChanged(ref name.Reference, index v1.ImageIndex, w *warnings.Collector) error {
+	digestRef, ok := ref.(name.Digest)
+	if !ok {
+		return nil
 	}
 
-	return mutate.RemoveManifests(
-		index,
-		notMatcher(platformsIgnoringVariantIfNotSpecified(v1Platforms...)),
-	), nil
+	digest, err := index.Digest()
+	if err != nil {
+		return fmt.Errorf("failed to calculate digest for %q: %w", ref, err)
+	}
+	if digest.String() == digestRef.DigestStr() {
+		return nil
+	}
+
+	return w.Warnf(
+		warnings.DigestNotFound,
+		"image %q will not be available by its requested digest, "+
+			"removing unrequested platforms changed its digest to %s",
+		ref,
+		digest,
+	)
 }
 
 func notMatcher(matcher match.Matcher) match.Matcher {
@@ -90,39 +164,16 @@ func notMatcher(matcher match.Matcher) match.Matcher {
 	}
 }
 
-func platformsIgnoringVariantIfNotSpecified(platforms ...v1.Platform) match.Matcher {
-	return func(desc v1.Descriptor) bool {
-		if desc.Platform == nil {
-			return false
-		}
-		for _, platform := range platforms {
-			if desc.Platform.Equals(platform) {
-				return true
-			}
-			if platform.Variant == "" &&
-				platform.OS == desc.Platform.OS &&
-				platform.Architecture == desc.Platform.Architecture {
-				return true
-			}
-		}
-		return false
-	}
-}
-
+// indexForSinglePlatformImage returns an index containing the single platform image if it matches
+// any of the requested platforms, recording a warning for every other requested platform. The
+// platform of the image is read from its config, so images that do not specify their platform are
+// rejected if platforms are requested rather than risking bundling images for the wrong platform.
 func indexForSinglePlatformImage(
 	ref name.Reference,
 	img v1.Image,
-	platforms ...string,
+	w *warnings.Collector,
+	platforms ...platform.Platform,
 ) (v1.ImageIndex, error) {
-	if len(platforms) > 1 {
-		return nil,
-			fmt.Errorf(
-				"reference %q is a single platform image, cannot create an index with multiple platforms (%v) as requested",
-				ref,
-				platforms,
-			)
-	}
-
 	imgConfig, err := img.ConfigFile()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get image config for image %q: %w", ref, err)
@@ -150,25 +201,37 @@ func indexForSinglePlatformImage(
 	if len(platforms) == 0 {
 		return index, nil
 	}
-
-	v1Platform, err := v1.ParsePlatform(platforms[0])
-	if err != nil {
-		return nil, fmt.Errorf("invalid platform %q: %w", platforms[0], err)
+	if imgConfig.OS == "" || imgConfig.Architecture == "" {
+		return nil, fmt.Errorf(
+			"single platform image %q does not specify its platform in its config, "+
+				"cannot verify that it matches the requested platforms",
+			ref,
+		)
 	}
 
-	imgPlatformForComparison := imgPlatform
-	if v1Platform.Variant == "" {
-		imgPlatformForComparison.Variant = ""
+	var missing []platform.Platform
+	for _, p := range platforms {
+		if !p.Matches(imgPlatform) {
+			missing = append(missing, p)
+		}
 	}
-
-	if !imgPlatformForComparison.Equals(*v1Platform) {
+	if len(missing) == len(platforms) {
 		return nil, fmt.Errorf(
-			"requested image %q does not match requested platform %q (image is for %q)",
+			"single platform image %q for platform %q does not provide any of the requested platforms %v",
 			ref,
-			v1Platform,
-			imgPlatform,
+			imgPlatform.String(),
+			platforms,
 		)
 	}
+	for _, p := range missing {
+		if err := w.Warnf(
+			warnings.MissingPlatform,
+			"image %q does not provide requested platform %q (single platform image for %q)",
+			ref, p, imgPlatform.String(),
+		); err != nil {
+			return nil, err
+		}
+	}
 
 	return index, nil
 }
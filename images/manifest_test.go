@@ -15,9 +15,13 @@ import (
 
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/images/platform"
+	"github.com/mesosphere/mindthegap/warnings"
 )
 
 var busyboxIndexManifest = v1.IndexManifest{
@@ -217,7 +221,8 @@ func TestManifestListForImage_RemoteIndex(t *testing.T) {
 
 			got, err := ManifestListForImage(
 				fmt.Sprintf("%s/%s", svr.Listener.Addr(), tt.args.img),
-				tt.args.platforms,
+				parsePlatforms(t, tt.args.platforms...),
+				nil,
 			)
 			require.ErrorIs(t, err, tt.wantErr)
 			if tt.wantErr == nil {
@@ -230,6 +235,35 @@ func TestManifestListForImage_RemoteIndex(t *testing.T) {
 	}
 }
 
+func TestManifestListForImage_MissingPlatformWarnings(t *testing.T) {
+	t.Parallel()
+
+	svr := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", string(types.DockerManifestList))
+			json.NewEncoder(w).Encode(busyboxIndexManifest)
+		}),
+	)
+	defer svr.Close()
+
+	img := fmt.Sprintf("%s/%s", svr.Listener.Addr(), "library/busybox:latest")
+	platforms := parsePlatforms(t, "linux/amd64", "windows/amd64")
+
+	w := warnings.NewCollector(false)
+	got, err := ManifestListForImage(img, platforms, w)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, []warnings.Warning{{
+		Kind:    warnings.MissingPlatform,
+		Message: fmt.Sprintf("image %q does not provide requested platform %q", img, "windows/amd64"),
+	}}, w.Warnings())
+
+	_, err = ManifestListForImage(img, platforms, warnings.NewCollector(true))
+	var werr *warnings.Error
+	require.ErrorAs(t, err, &werr)
+	assert.Equal(t, warnings.MissingPlatform, werr.Warning.Kind)
+}
+
 var (
 	fipsImageManifest = v1.Manifest{
 		SchemaVersion: 2,
@@ -353,10 +387,11 @@ func TestManifestListForImage_RemoteImage(t *testing.T) {
 		platforms []string
 	}
 	tests := []struct {
-		name              string
-		args              args
-		wantIndexManifest v1.IndexManifest
-		wantErr           string
+		name                 string
+		args                 args
+		wantIndexManifest    v1.IndexManifest
+		wantMissingPlatforms []string
+		wantErr              string
 	}{{
 		name: "valid image name, all platforms",
 		args: args{img: "mesosphere/kube-apiserver:v1.24.4_fips.0"},
@@ -376,7 +411,24 @@ func TestManifestListForImage_RemoteImage(t *testing.T) {
 			img:       "mesosphere/kube-apiserver:v1.24.4_fips.0",
 			platforms: []string{"linux/amd64", "linux/riscv64"},
 		},
-		wantErr: "is a single platform image, cannot create an index with multiple platforms",
+		wantIndexManifest: v1.IndexManifest{
+			Manifests: []v1.Descriptor{{
+				Digest:    v1.Hash{Algorithm: "sha256", Hex: digestFIPSImageManifest},
+				MediaType: types.DockerManifestSchema2,
+				Platform:  &v1.Platform{OS: "linux", Architecture: "amd64", Variant: "v1"},
+				Size:      int64(sizeFIPSImageManifest),
+			}},
+			MediaType:     types.DockerManifestList,
+			SchemaVersion: 2,
+		},
+		wantMissingPlatforms: []string{"linux/riscv64"},
+	}, {
+		name: "valid image name, no matching platform",
+		args: args{
+			img:       "mesosphere/kube-apiserver:v1.24.4_fips.0",
+			platforms: []string{"linux/arm64", "linux/riscv64"},
+		},
+		wantErr: `for platform "linux/amd64/v1" does not provide any of the requested platforms`,
 	}, {
 		name: "valid image name, single platform with variant",
 		args: args{
@@ -436,10 +488,9 @@ func TestManifestListForImage_RemoteImage(t *testing.T) {
 			svr := httptest.NewServer(mux)
 			defer svr.Close()
 
-			got, err := ManifestListForImage(
-				fmt.Sprintf("%s/%s", svr.Listener.Addr(), tt.args.img),
-				tt.args.platforms,
-			)
+			img := fmt.Sprintf("%s/%s", svr.Listener.Addr(), tt.args.img)
+			w := warnings.NewCollector(false)
+			got, err := ManifestListForImage(img, parsePlatforms(t, tt.args.platforms...), w)
 			if tt.wantErr != "" {
 				require.ErrorContains(t, err, tt.wantErr)
 			} else {
@@ -449,6 +500,41 @@ func TestManifestListForImage_RemoteImage(t *testing.T) {
 				require.NoError(t, err)
 				assert.Equal(t, tt.wantIndexManifest, *gotIndexManifest)
 			}
+
+			var wantWarnings []warnings.Warning
+			for _, p := range tt.wantMissingPlatforms {
+				wantWarnings = append(wantWarnings, warnings.Warning{
+					Kind: warnings.MissingPlatform,
+					Message: fmt.Sprintf(
+						"image %q does not provide requested platform %q (single platform image for %q)",
+						img, p, "linux/amd64/v1",
+					),
+				})
+			}
+			assert.ElementsMatch(t, wantWarnings, w.Warnings())
 		})
 	}
 }
+
+func TestIndexForSinglePlatformImage_NoPlatformInConfig(t *testing.T) {
+	t.Parallel()
+
+	img, err := random.Image(128, 1)
+	require.NoError(t, err)
+	ref, err := name.ParseReference("example.com/image:v1")
+	require.NoError(t, err)
+
+	_, err = indexForSinglePlatformImage(ref, img, nil, parsePlatforms(t, "linux/amd64")...)
+	require.ErrorContains(t, err, "does not specify its platform in its config")
+}
+
+func parsePlatforms(t *testing.T, platforms ...string) []platform.Platform {
+	t.Helper()
+	parsed := make([]platform.Platform, 0, len(platforms))
+	for _, p := range platforms {
+		parsedPlatform, err := platform.Parse(p)
+		require.NoError(t, err)
+		parsed = append(parsed, parsedPlatform)
+	}
+	return parsed
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package images
+
+import (
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// WithoutNonDistributableLayers returns the index with the non-distributable (foreign) layers, e.g.
+// the base layers of Windows images, left out of the layers of all of its images, like they are
+// when pushing images to a registry. The manifests are not changed, so the layers are still pulled
+// from the URLs in their descriptors.
+func WithoutNonDistributableLayers(index v1.ImageIndex) v1.ImageIndex {
+	return withoutNonDistributableIndex{index: index}
+}
+
+// ImageWithoutNonDistributableLayers is like WithoutNonDistributableLayers for a single image.
+func ImageWithoutNonDistributableLayers(img v1.Image) v1.Image {
+	return withoutNonDistributableImage{Image: img}
+}
+
+// withoutNonDistributableIndex cannot embed v1.ImageIndex, as it overrides its ImageIndex method.
+type withoutNonDistributableIndex struct {
+	index v1.ImageIndex
+}
+
+func (i withoutNonDistributableIndex) MediaType() (types.MediaType, error) {
+	return i.index.MediaType()
+}
+
+func (i withoutNonDistributableIndex) Digest() (v1.Hash, error) {
+	return i.index.Digest()
+}
+
+func (i withoutNonDistributableIndex) Size() (int64, error) {
+	return i.index.Size()
+}
+
+func (i withoutNonDistributableIndex) IndexManifest() (*v1.IndexManifest, error) {
+	return i.index.IndexManifest()
+}
+
+func (i withoutNonDistributableIndex) RawManifest() ([]byte, error) {
+	return i.index.RawManifest()
+}
+
+func (i withoutNonDistributableIndex) Image(h v1.Hash) (v1.Image, error) {
+	img, err := i.index.Image(h)
+	if err != nil {
+		return nil, err
+	}
+	return ImageWithoutNonDistributableLayers(img), nil
+}
+
+func (i withoutNonDistributableIndex) ImageIndex(h v1.Hash) (v1.ImageIndex, error) {
+	index, err := i.index.ImageIndex(h)
+	if err != nil {
+		return nil, err
+	}
+	return WithoutNonDistributableLayers(index), nil
+}
+
+type withoutNonDistributableImage struct {
+	v1.Image
+}
+
+func (i withoutNonDistributableImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	distributable := make([]v1.Layer, 0, len(layers))
+	for _, l := range layers {
+		mediaType, err := l.MediaType()
+		if err != nil {
+			return nil, err
+		}
+		if mediaType.IsDistributable() {
+			distributable = append(distributable, l)
+		}
+	}
+	return distributable, nil
+}
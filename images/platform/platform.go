@@ -0,0 +1,229 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package platform
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+)
+
+// componentRegexp matches valid os, architecture and variant components of a platform.
+var componentRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+// osVersionRegexp matches valid os versions of a platform, e.g. the Windows build 10.0.17763.
+var osVersionRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Platform is a validated image platform, in the format <os>/<arch>[/<variant>][:<os.version>].
+// The zero value is not a valid platform: use New or Parse to create a Platform.
+type Platform struct {
+	os      string
+	arch    string
+	variant string
+	// osVersion is the version of the os required by images, which is only used by Windows images:
+	// Windows containers only run on hosts with the same Windows build.
+	osVersion string
+}
+
+// New returns a validated Platform for the specified os, architecture and optional variant.
+func New(os, arch, variant string) (Platform, error) {
+	p := Platform{os: os, arch: arch, variant: variant}
+	if err := p.Validate(); err != nil {
+		return Platform{}, err
+	}
+	return p, nil
+}
+
+// WithOSVersion returns a copy of the platform requiring the specified os version, e.g. the Windows
+// build 10.0.17763.
+func (p Platform) WithOSVersion(osVersion string) (Platform, error) {
+	if osVersion == "" {
+		return Platform{}, fmt.Errorf("invalid os version %q", osVersion)
+	}
+	p.osVersion = osVersion
+	if err := p.Validate(); err != nil {
+		return Platform{}, err
+	}
+	return p, nil
+}
+
+// Parse parses a platform specification in the format <os>/<arch>[/<variant>][:<os.version>].
+func Parse(s string) (Platform, error) {
+	platformSpec, osVersion, hasOSVersion := strings.Cut(s, ":")
+	splitVal := strings.Split(platformSpec, "/")
+	if len(splitVal) < 2 || len(splitVal) > 3 {
+		return Platform{}, fmt.Errorf(
+			"invalid platform specification: %s (required format: <os>/<arch>[/<variant>][:<os.version>]",
+			s,
+		)
+	}
+	variant := ""
+	if len(splitVal) == 3 {
+		variant = splitVal[2]
+	}
+	p, err := New(splitVal[0], splitVal[1], variant)
+	if err == nil && hasOSVersion {
+		p, err = p.WithOSVersion(osVersion)
+	}
+	if err != nil {
+		return Platform{}, fmt.Errorf("invalid platform specification: %s: %w", s, err)
+	}
+	return p, nil
+}
+
+// MustParse is like Parse but panics if the platform specification cannot be parsed.
+func MustParse(s string) Platform {
+	p, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// FromV1 converts a go-containerregistry platform to a validated Platform.
+func FromV1(p v1.Platform) (Platform, error) {
+	platform, err := New(p.OS, p.Architecture, p.Variant)
+	if err != nil || p.OSVersion == "" {
+		return platform, err
+	}
+	return platform.WithOSVersion(p.OSVersion)
+}
+
+// Current returns the platform of the running binary.
+func Current() Platform {
+	return Platform{os: runtime.GOOS, arch: runtime.GOARCH}
+}
+
+// Validate checks that the platform has a valid os, architecture and (optional) variant.
+func (p Platform) Validate() error {
+	if !componentRegexp.MatchString(p.os) {
+		return fmt.Errorf("invalid os %q", p.os)
+	}
+	if !componentRegexp.MatchString(p.arch) {
+		return fmt.Errorf("invalid architecture %q", p.arch)
+	}
+	if p.variant != "" && !componentRegexp.MatchString(p.variant) {
+		return fmt.Errorf("invalid variant %q", p.variant)
+	}
+	if p.osVersion != "" && !osVersionRegexp.MatchString(p.osVersion) {
+		return fmt.Errorf("invalid os version %q", p.osVersion)
+	}
+	return nil
+}
+
+func (p Platform) OS() string {
+	return p.os
+}
+
+func (p Platform) Arch() string {
+	return p.arch
+}
+
+func (p Platform) Variant() string {
+	return p.variant
+}
+
+func (p Platform) OSVersion() string {
+	return p.osVersion
+}
+
+func (p Platform) String() string {
+	s := p.os + "/" + p.arch
+	if p.variant != "" {
+		s += "/" + p.variant
+	}
+	if p.osVersion != "" {
+		s += ":" + p.osVersion
+	}
+	return s
+}
+
+// ToV1 converts the platform to a go-containerregistry platform.
+func (p Platform) ToV1() v1.Platform {
+	return v1.Platform{OS: p.os, Architecture: p.arch, Variant: p.variant, OSVersion: p.osVersion}
+}
+
+// Normalized returns the platform with architecture aliases resolved and default variants
+// applied, e.g. linux/aarch64 and linux/arm64/v8 both normalize to linux/arm64, and linux/arm
+// normalizes to linux/arm/v7.
+func (p Platform) Normalized() Platform {
+	arch, variant := normalizeArchAndVariant(p.arch, p.variant)
+	return Platform{os: p.os, arch: arch, variant: variant, osVersion: p.osVersion}
+}
+
+// Matches returns true if the given descriptor platform satisfies p. If p does not specify a
+// variant then any variant of the same os and architecture matches. Default variants are
+// considered equal to no variant, so linux/arm64/v8 matches an image for linux/arm64 and vice
+// versa. If p specifies an os version then only candidates for that os version match, where an os
+// version matches all more specific versions, so windows/amd64:10.0.17763 matches images for every
+// revision of the Windows build 10.0.17763, e.g. 10.0.17763.4010.
+func (p Platform) Matches(candidate v1.Platform) bool {
+	if p.os != candidate.OS {
+		return false
+	}
+	if p.osVersion != "" && candidate.OSVersion != p.osVersion &&
+		!strings.HasPrefix(candidate.OSVersion, p.osVersion+".") {
+		return false
+	}
+
+	requestedArch, requestedVariant := normalizeArchAndVariant(p.arch, p.variant)
+	candidateArch, candidateVariant := normalizeArchAndVariant(
+		candidate.Architecture,
+		candidate.Variant,
+	)
+	if requestedArch != candidateArch {
+		return false
+	}
+
+	return p.variant == "" || requestedVariant == candidateVariant
+}
+
+// Matcher returns a matcher that matches descriptors whose platform matches any of platforms.
+func Matcher(platforms ...Platform) match.Matcher {
+	return func(desc v1.Descriptor) bool {
+		if desc.Platform == nil {
+			return false
+		}
+		for _, p := range platforms {
+			if p.Matches(*desc.Platform) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func normalizeArchAndVariant(arch, variant string) (normalizedArch, normalizedVariant string) {
+	switch arch {
+	case "x86_64", "x86-64", "amd64":
+		arch = "amd64"
+		if variant == "v1" {
+			variant = ""
+		}
+	case "aarch64", "arm64":
+		arch = "arm64"
+		switch variant {
+		case "8", "v8":
+			variant = ""
+		}
+	case "armhf":
+		arch, variant = "arm", "v7"
+	case "armel":
+		arch, variant = "arm", "v6"
+	case "arm":
+		switch variant {
+		case "", "7":
+			variant = "v7"
+		case "5", "6", "8":
+			variant = "v" + variant
+		}
+	case "i386":
+		arch = "386"
+	}
+	return arch, variant
+}
@@ -0,0 +1,220 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package platform
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		in      string
+		want    Platform
+		wantErr string
+	}{{
+		name: "os and arch",
+		in:   "linux/amd64",
+		want: Platform{os: "linux", arch: "amd64"},
+	}, {
+		name: "os, arch and variant",
+		in:   "linux/arm/v7",
+		want: Platform{os: "linux", arch: "arm", variant: "v7"},
+	}, {
+		name: "os, arch and os version",
+		in:   "windows/amd64:10.0.17763.4010",
+		want: Platform{os: "windows", arch: "amd64", osVersion: "10.0.17763.4010"},
+	}, {
+		name:    "empty os version",
+		in:      "windows/amd64:",
+		wantErr: `invalid platform specification: windows/amd64:: invalid os version ""`,
+	}, {
+		name:    "invalid os version",
+		in:      "windows/amd64:10.0 17763",
+		wantErr: `invalid platform specification: windows/amd64:10.0 17763: invalid os version "10.0 17763"`,
+	}, {
+		name:    "missing arch",
+		in:      "linux",
+		wantErr: "invalid platform specification: linux (required format: <os>/<arch>[/<variant>]",
+	}, {
+		name:    "too many components",
+		in:      "linux/arm/v7/extra",
+		wantErr: "invalid platform specification: linux/arm/v7/extra",
+	}, {
+		name:    "empty os",
+		in:      "/amd64",
+		wantErr: `invalid platform specification: /amd64: invalid os ""`,
+	}, {
+		name:    "empty arch",
+		in:      "linux/",
+		wantErr: `invalid platform specification: linux/: invalid architecture ""`,
+	}, {
+		name:    "invalid variant",
+		in:      "linux/arm/V 7",
+		wantErr: `invalid platform specification: linux/arm/V 7: invalid variant "V 7"`,
+	}}
+	for _, tt := range tests {
+		tt := tt // Capture range variable.
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := Parse(tt.in)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.in, got.String())
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		requested string
+		candidate v1.Platform
+		want      bool
+	}{{
+		name:      "exact match",
+		requested: "linux/amd64",
+		candidate: v1.Platform{OS: "linux", Architecture: "amd64"},
+		want:      true,
+	}, {
+		name:      "different os",
+		requested: "linux/amd64",
+		candidate: v1.Platform{OS: "windows", Architecture: "amd64"},
+		want:      false,
+	}, {
+		name:      "different arch",
+		requested: "linux/amd64",
+		candidate: v1.Platform{OS: "linux", Architecture: "arm64"},
+		want:      false,
+	}, {
+		name:      "no requested variant matches any variant",
+		requested: "linux/arm",
+		candidate: v1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"},
+		want:      true,
+	}, {
+		name:      "different variant",
+		requested: "linux/arm/v7",
+		candidate: v1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"},
+		want:      false,
+	}, {
+		name:      "default arm64 variant falls back to no variant",
+		requested: "linux/arm64/v8",
+		candidate: v1.Platform{OS: "linux", Architecture: "arm64"},
+		want:      true,
+	}, {
+		name:      "default arm variant falls back to no variant",
+		requested: "linux/arm/v7",
+		candidate: v1.Platform{OS: "linux", Architecture: "arm"},
+		want:      true,
+	}, {
+		name:      "default amd64 variant falls back to no variant",
+		requested: "linux/amd64/v1",
+		candidate: v1.Platform{OS: "linux", Architecture: "amd64"},
+		want:      true,
+	}, {
+		name:      "architecture alias",
+		requested: "linux/arm64",
+		candidate: v1.Platform{OS: "linux", Architecture: "aarch64"},
+		want:      true,
+	}, {
+		name:      "any os version",
+		requested: "windows/amd64",
+		candidate: v1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.4010"},
+		want:      true,
+	}, {
+		name:      "build matches every revision",
+		requested: "windows/amd64:10.0.17763",
+		candidate: v1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.4010"},
+		want:      true,
+	}, {
+		name:      "different build",
+		requested: "windows/amd64:10.0.17763",
+		candidate: v1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.1607"},
+		want:      false,
+	}, {
+		name:      "build is not a prefix match",
+		requested: "windows/amd64:10.0.1776",
+		candidate: v1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.4010"},
+		want:      false,
+	}, {
+		name:      "exact os version",
+		requested: "windows/amd64:10.0.17763.4010",
+		candidate: v1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.4010"},
+		want:      true,
+	}, {
+		name:      "different revision",
+		requested: "windows/amd64:10.0.17763.4010",
+		candidate: v1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.4131"},
+		want:      false,
+	}, {
+		name:      "missing os version",
+		requested: "windows/amd64:10.0.17763",
+		candidate: v1.Platform{OS: "windows", Architecture: "amd64"},
+		want:      false,
+	}}
+	for _, tt := range tests {
+		tt := tt // Capture range variable.
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, MustParse(tt.requested).Matches(tt.candidate))
+		})
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	t.Parallel()
+	m := Matcher(MustParse("linux/amd64"), MustParse("linux/arm64/v8"))
+	assert.True(t, m(v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}}))
+	assert.True(
+		t,
+		m(v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}}),
+	)
+	assert.False(t, m(v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "s390x"}}))
+	assert.False(t, m(v1.Descriptor{}))
+}
+
+func TestNormalized(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, MustParse("linux/arm64"), MustParse("linux/aarch64/v8").Normalized())
+	assert.Equal(t, MustParse("linux/arm/v7"), MustParse("linux/arm").Normalized())
+	assert.Equal(t, MustParse("linux/amd64"), MustParse("linux/x86_64").Normalized())
+}
+
+// FuzzParse checks that platforms parsed from arbitrary user input are valid and round-trip.
+func FuzzParse(f *testing.F) {
+	for _, s := range []string{
+		"linux/amd64", "linux/arm/v7", "linux/arm64/v8", "linux/aarch64", "windows/amd64",
+		"windows/amd64:10.0.17763.4010", "windows/amd64:", "linux/amd64:1:2",
+		"linux", "linux/amd64/v1/extra", "/amd64", "linux//v7", "Linux/AMD64", "linux/amd64\n",
+	} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		p, err := Parse(s)
+		if err != nil {
+			return
+		}
+		require.NoError(t, p.Validate())
+
+		reparsed, err := Parse(p.String())
+		require.NoError(t, err)
+		assert.Equal(t, p, reparsed)
+
+		assert.True(t, p.Matches(p.ToV1()), "platform %s does not match itself", p)
+		normalized := p.Normalized()
+		assert.Equal(t, normalized, normalized.Normalized(), "normalization of %s is not idempotent", p)
+		assert.True(t, normalized.Matches(p.ToV1()), "normalized platform %s does not match %s", normalized, p)
+	})
+}
@@ -0,0 +1,299 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+)
+
+// Event is a single log message, written as one line of JSON. Key-value pairs logged with the
+// message are added as further fields.
+type Event struct {
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"`
+	// Verbosity is the verbosity of debug messages.
+	Verbosity int    `json:"v,omitempty"`
+	Message   string `json:"msg"`
+	Error     string `json:"error,omitempty"`
+	// Operation is the status of the operation that the message is logged for, e.g. pulling images,
+	// with OperationStatus one of "started", "succeeded", "failed" or "skipped".
+	Operation       string  `json:"operation,omitempty"`
+	OperationStatus string  `json:"operationStatus,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+}
+
+// jsonWriter writes events to the underlying writer, shared by all outputs derived from the same
+// JSON output.
+type jsonWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+
+	// operation is the running operation, with its start time, gauge if started with progress and
+	// status otherwise.
+	operation      string
+	operationGauge *output.ProgressGauge
+	operationStart time.Time
+}
+
+func (w *jsonWriter) write(e Event, keysAndValues []interface{}) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if len(keysAndValues) > 0 {
+		fields := make(map[string]interface{}, len(keysAndValues)/2)
+		for i := 1; i < len(keysAndValues); i += 2 {
+			fields[fmt.Sprint(keysAndValues[i-1])] = jsonValue(keysAndValues[i])
+		}
+		extra, err := json.Marshal(fields)
+		if err == nil && len(extra) > 2 {
+			b = append(append(b[:len(b)-1], ','), extra[1:]...)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, _ = w.w.Write(append(b, '\n'))
+}
+
+// jsonValue returns the value to marshal for a logged value, formatting errors and other values
+// that cannot be marshaled as strings.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return v
+}
+
+// jsonOutput logs messages as line-delimited JSON events. Operations are logged as events when they
+// start and end instead of as spinners and progress bars.
+type jsonOutput struct {
+	out           io.Writer
+	w             *jsonWriter
+	level         Level
+	verbosity     int
+	v             int
+	keysAndValues []interface{}
+}
+
+func newJSONOutput(out, errOut io.Writer, level Level, verbosity int) *jsonOutput {
+	return &jsonOutput{out: out, w: &jsonWriter{w: errOut}, level: level, verbosity: verbosity}
+}
+
+func (o *jsonOutput) event(level, msg string) Event {
+	e := Event{Time: time.Now().UTC(), Level: level, Message: msg}
+	if o.v > 0 && level == InfoLevel.String() {
+		e.Level, e.Verbosity = DebugLevel.String(), o.v
+	}
+	return e
+}
+
+func (o *jsonOutput) Info(msg string) {
+	if o.level > InfoLevel {
+		return
+	}
+	o.w.write(o.event(InfoLevel.String(), msg), o.keysAndValues)
+}
+
+func (o *jsonOutput) Infof(format string, args ...interface{}) {
+	o.Info(fmt.Sprintf(format, args...))
+}
+
+func (o *jsonOutput) InfoWriter() io.Writer {
+	return messageWriter(o.Info)
+}
+
+func (o *jsonOutput) Warn(msg string) {
+	if o.level > WarnLevel {
+		return
+	}
+	o.w.write(o.event(WarnLevel.String(), msg), o.keysAndValues)
+}
+
+func (o *jsonOutput) Warnf(format string, args ...interface{}) {
+	o.Warn(fmt.Sprintf(format, args...))
+}
+
+func (o *jsonOutput) WarnWriter() io.Writer {
+	return messageWriter(o.Warn)
+}
+
+func (o *jsonOutput) Error(err error, msg string) {
+	e := o.event(ErrorLevel.String(), msg)
+	if err != nil {
+		e.Error = err.Error()
+		if e.Message == "" {
+			e.Message = e.Error
+		}
+	}
+	o.w.write(e, o.keysAndValues)
+}
+
+func (o *jsonOutput) Errorf(err error, format string, args ...interface{}) {
+	o.Error(err, fmt.Sprintf(format, args...))
+}
+
+func (o *jsonOutput) ErrorWriter() io.Writer {
+	return messageWriter(func(msg string) { o.Error(nil, msg) })
+}
+
+func (o *jsonOutput) StartOperation(status string) {
+	o.startOperation(status, nil)
+}
+
+func (o *jsonOutput) StartOperationWithProgress(gauge *output.ProgressGauge) {
+	o.startOperation("", gauge)
+}
+
+func (o *jsonOutput) startOperation(status string, gauge *output.ProgressGauge) {
+	o.endOperation("succeeded")
+
+	o.w.mu.Lock()
+	o.w.operation, o.w.operationGauge, o.w.operationStart = status, gauge, time.Now()
+	o.w.mu.Unlock()
+
+	if gauge != nil {
+		status = gaugeOperation(gauge)
+	}
+	e := o.event(InfoLevel.String(), status)
+	e.Operation, e.OperationStatus = status, "started"
+	if o.level <= InfoLevel {
+		o.w.write(e, o.keysAndValues)
+	}
+}
+
+func (o *jsonOutput) EndOperation(success bool) {
+	if success {
+		o.endOperation("succeeded")
+	} else {
+		o.endOperation("failed")
+	}
+}
+
+func (o *jsonOutput) EndOperationWithStatus(endStatus output.EndOperationStatus) {
+	o.endOperation(operationStatus(endStatus))
+}
+
+func (o *jsonOutput) endOperation(status string) {
+	o.w.mu.Lock()
+	operation, gauge, start := o.w.operation, o.w.operationGauge, o.w.operationStart
+	o.w.operation, o.w.operationGauge = "", nil
+	o.w.mu.Unlock()
+
+	if gauge != nil {
+		operation = gaugeOperation(gauge)
+	}
+	if operation == "" {
+		return
+	}
+
+	level := InfoLevel
+	if status == "failed" {
+		level = ErrorLevel
+	}
+	if o.level > level {
+		return
+	}
+	e := o.event(level.String(), operation)
+	e.Operation, e.OperationStatus = operation, status
+	e.DurationSeconds = time.Since(start).Seconds()
+	o.w.write(e, o.keysAndValues)
+}
+
+// gaugeOperation returns the status of the gauge without its progress bar as the operation.
+func gaugeOperation(gauge *output.ProgressGauge) string {
+	operation, _, _ := strings.Cut(strings.TrimSpace(gauge.String()), " [")
+	return operation
+}
+
+// operationStatus returns the status of an ended operation, which is only identified by the
+// character it is printed with.
+func operationStatus(endStatus output.EndOperationStatus) string {
+	var b bytes.Buffer
+	_, _ = endStatus.Fprintln(&b, "")
+	switch s := b.String(); {
+	case strings.Contains(s, "✗"):
+		return "failed"
+	case strings.Contains(s, "∅"):
+		return "skipped"
+	default:
+		return "succeeded"
+	}
+}
+
+func (o *jsonOutput) Result(result string) {
+	fmt.Fprintln(o.out, result)
+}
+
+func (o *jsonOutput) ResultWriter() io.Writer {
+	return o.out
+}
+
+func (o *jsonOutput) Enabled(level int) bool {
+	return level <= o.verbosity
+}
+
+func (o *jsonOutput) V(level int) output.Output {
+	if !o.Enabled(level) {
+		return discardingOutput{}
+	}
+	v := *o
+	v.v = level
+	return &v
+}
+
+func (o *jsonOutput) WithValues(keysAndValues ...interface{}) output.Output {
+	v := *o
+	v.keysAndValues = append(append([]interface{}{}, o.keysAndValues...), keysAndValues...)
+	return &v
+}
+
+// messageWriter logs every write as a message, without trailing newlines.
+type messageWriter func(msg string)
+
+func (w messageWriter) Write(p []byte) (int, error) {
+	w(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
+// discardingOutput discards all messages of verbosities that are not logged.
+type discardingOutput struct {
+	output.Output
+}
+
+func (discardingOutput) Info(msg string)                                         {}
+func (discardingOutput) Infof(format string, args ...interface{})                {}
+func (discardingOutput) InfoWriter() io.Writer                                   { return io.Discard }
+func (discardingOutput) Warn(msg string)                                         {}
+func (discardingOutput) Warnf(format string, args ...interface{})                {}
+func (discardingOutput) WarnWriter() io.Writer                                   { return io.Discard }
+func (discardingOutput) Error(err error, msg string)                             {}
+func (discardingOutput) Errorf(err error, format string, args ...interface{})    {}
+func (discardingOutput) ErrorWriter() io.Writer                                  { return io.Discard }
+func (discardingOutput) StartOperation(status string)                            {}
+func (discardingOutput) StartOperationWithProgress(gauge *output.ProgressGauge)  {}
+func (discardingOutput) EndOperation(success bool)                               {}
+func (discardingOutput) EndOperationWithStatus(status output.EndOperationStatus) {}
+func (discardingOutput) Result(result string)                                    {}
+func (discardingOutput) ResultWriter() io.Writer                                 { return io.Discard }
+func (discardingOutput) V(level int) output.Output                               { return discardingOutput{} }
+func (discardingOutput) Enabled(level int) bool                                  { return false }
+
+func (discardingOutput) WithValues(keysAndValues ...interface{}) output.Output {
+	return discardingOutput{}
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+)
+
+func decodeEvents(t *testing.T, b *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var events []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var e map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &e), line)
+		require.NotEmpty(t, e["time"])
+		delete(e, "time")
+		delete(e, "durationSeconds")
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestJSONOutput(t *testing.T) {
+	t.Parallel()
+
+	var stdout, stderr bytes.Buffer
+	o := newJSONOutput(&stdout, &stderr, InfoLevel, 1)
+
+	o.Info("plain message")
+	o.WithValues("image", "docker.io/library/nginx:1.21.5", "count", 2).Warnf("warning %d", 1)
+	o.V(1).Info("verbose message")
+	o.V(2).Info("too verbose message")
+	o.StartOperation("Pulling images")
+	o.EndOperationWithStatus(output.Failure())
+	gauge := &output.ProgressGauge{}
+	gauge.SetStatus("Pulling requested images")
+	gauge.SetCapacity(2)
+	o.StartOperationWithProgress(gauge)
+	gauge.Inc()
+	gauge.Inc()
+	o.EndOperationWithStatus(output.Success())
+	o.Error(errors.New("boom"), "")
+	o.Result("result")
+
+	assert.Equal(t, "result\n", stdout.String())
+	assert.Equal(t, []map[string]interface{}{{
+		"level": "info", "msg": "plain message",
+	}, {
+		"level": "warn", "msg": "warning 1", "image": "docker.io/library/nginx:1.21.5", "count": float64(2),
+	}, {
+		"level": "debug", "v": float64(1), "msg": "verbose message",
+	}, {
+		"level": "info", "msg": "Pulling images", "operation": "Pulling images", "operationStatus": "started",
+	}, {
+		"level": "error", "msg": "Pulling images", "operation": "Pulling images", "operationStatus": "failed",
+	}, {
+		"level":     "info",
+		"msg":       "Pulling requested images",
+		"operation": "Pulling requested images", "operationStatus": "started",
+	}, {
+		"level":     "info",
+		"msg":       "Pulling requested images",
+		"operation": "Pulling requested images", "operationStatus": "succeeded",
+	}, {
+		"level": "error", "msg": "boom", "error": "boom",
+	}}, decodeEvents(t, &stderr))
+}
+
+func TestJSONOutputLevel(t *testing.T) {
+	t.Parallel()
+
+	var stderr bytes.Buffer
+	o := newJSONOutput(&stderr, &stderr, WarnLevel, 0)
+
+	o.Info("info message")
+	o.StartOperation("Pulling images")
+	o.EndOperationWithStatus(output.Success())
+	o.Warn("warning")
+
+	assert.Equal(t, []map[string]interface{}{{
+		"level": "warn", "msg": "warning",
+	}}, decodeEvents(t, &stderr))
+}
+
+func TestLevelOutput(t *testing.T) {
+	t.Parallel()
+
+	var stderr bytes.Buffer
+	o := withLevel(output.NewNonInteractiveShell(&stderr, &stderr, 0), ErrorLevel)
+
+	o.Info("info message")
+	o.StartOperation("Pulling images")
+	o.EndOperationWithStatus(output.Success())
+	o.Warn("warning")
+	o.Error(errors.New("boom"), "failed")
+
+	assert.NotContains(t, stderr.String(), "info message")
+	assert.NotContains(t, stderr.String(), "Pulling images")
+	assert.NotContains(t, stderr.String(), "warning")
+	assert.Contains(t, stderr.String(), "failed")
+}
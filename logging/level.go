@@ -0,0 +1,59 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logging
+
+import (
+	"io"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+)
+
+// withLevel returns the output discarding messages below the level. Operations are logged at the
+// info level.
+func withLevel(o output.Output, level Level) output.Output {
+	if level <= InfoLevel {
+		return o
+	}
+	return &levelOutput{Output: o, level: level}
+}
+
+type levelOutput struct {
+	output.Output
+	level Level
+}
+
+func (o *levelOutput) Info(msg string)                                         {}
+func (o *levelOutput) Infof(format string, args ...interface{})                {}
+func (o *levelOutput) InfoWriter() io.Writer                                   { return io.Discard }
+func (o *levelOutput) StartOperation(status string)                            {}
+func (o *levelOutput) StartOperationWithProgress(gauge *output.ProgressGauge)  {}
+func (o *levelOutput) EndOperation(success bool)                               {}
+func (o *levelOutput) EndOperationWithStatus(status output.EndOperationStatus) {}
+
+func (o *levelOutput) Warn(msg string) {
+	if o.level <= WarnLevel {
+		o.Output.Warn(msg)
+	}
+}
+
+func (o *levelOutput) Warnf(format string, args ...interface{}) {
+	if o.level <= WarnLevel {
+		o.Output.Warnf(format, args...)
+	}
+}
+
+func (o *levelOutput) WarnWriter() io.Writer {
+	if o.level <= WarnLevel {
+		return o.Output.WarnWriter()
+	}
+	return io.Discard
+}
+
+func (o *levelOutput) V(level int) output.Output {
+	return &levelOutput{Output: o.Output.V(level), level: o.level}
+}
+
+func (o *levelOutput) WithValues(keysAndValues ...interface{}) output.Output {
+	return &levelOutput{Output: o.Output.WithValues(keysAndValues...), level: o.level}
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package logging configures how mindthegap logs: the minimum level of messages that are logged and
+// whether they are logged as human readable text or as line-delimited JSON events, e.g. for log
+// aggregation systems.
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/spf13/pflag"
+	"github.com/thediveo/enumflag/v2"
+	"k8s.io/klog/v2"
+
+	"github.com/mesosphere/dkp-cli-runtime/core/output"
+	"github.com/mesosphere/dkp-cli-runtime/core/term"
+)
+
+type Level enumflag.Flag
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levels = map[Level][]string{
+	DebugLevel: {"debug"},
+	InfoLevel:  {"info"},
+	WarnLevel:  {"warn"},
+	ErrorLevel: {"error"},
+}
+
+func (l Level) String() string {
+	return levels[l][0]
+}
+
+type Format enumflag.Flag
+
+const (
+	TextFormat Format = iota
+	JSONFormat
+)
+
+var formats = map[Format][]string{
+	TextFormat: {"text"},
+	JSONFormat: {"json"},
+}
+
+// DebugVerbosity is the verbosity of the debug level, which logs all messages up to this verbosity,
+// including the output of subprocesses.
+const DebugVerbosity = 4
+
+const (
+	LevelFlag  = "log-level"
+	FormatFlag = "log-format"
+)
+
+// AddFlags adds the --log-level and --log-format flags to the specified flag set.
+func AddFlags(fs *pflag.FlagSet, level *Level, format *Format) {
+	fs.Var(
+		enumflag.New(level, "string", levels, enumflag.EnumCaseInsensitive),
+		LevelFlag,
+		`minimum level of messages to log: one of "debug" (equivalent to --verbose=4), "info", "warn" or "error"`,
+	)
+	fs.Var(
+		enumflag.New(format, "string", formats, enumflag.EnumCaseSensitive),
+		FormatFlag,
+		`how to log messages: one of "text" or "json" (line-delimited JSON events without progress spinners, `+
+			"written to stderr)",
+	)
+}
+
+// NewOutput returns the output to log messages at or above the level in the format with, logging
+// verbose messages up to the verbosity. Results are written to out, all other messages to errOut.
+// Messages logged via klog and the standard logger are sent to the returned output as well.
+func NewOutput(out, errOut io.Writer, level Level, format Format, verbosity int) output.Output {
+	if level == DebugLevel {
+		verbosity = max(verbosity, DebugVerbosity)
+	}
+
+	var o output.Output
+	switch {
+	case format == JSONFormat:
+		o = newJSONOutput(out, errOut, level, verbosity)
+	case term.IsSmartTerminal(errOut):
+		o = withLevel(output.NewInteractiveShell(out, errOut, verbosity), level)
+	default:
+		o = withLevel(output.NewNonInteractiveShell(out, errOut, verbosity), level)
+	}
+
+	log.SetFlags(0)
+	log.SetOutput(o.V(1).InfoWriter())
+
+	klogFlags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(klogFlags)
+	_ = klogFlags.Parse([]string{"--v", fmt.Sprint(verbosity)})
+	klog.SetLogger(output.NewOutputLogr(o))
+
+	return o
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logging
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// SubprocessOutput returns a writer for the output of a subprocess that writes to w, e.g. to
+// capture the output for error messages, and logs every line of the output as a debug message
+// with the command, so that the output of subprocesses is logged in the configured format.
+func SubprocessOutput(command string, w io.Writer) io.WriteCloser {
+	return &subprocessOutput{command: command, w: w}
+}
+
+type subprocessOutput struct {
+	command string
+	w       io.Writer
+
+	mu   sync.Mutex
+	line []byte
+}
+
+func (s *subprocessOutput) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.line = append(s.line, p...)
+	for {
+		i := bytes.IndexByte(s.line, '\n')
+		if i < 0 {
+			break
+		}
+		s.log(s.line[:i])
+		s.line = s.line[i+1:]
+	}
+	return s.w.Write(p)
+}
+
+// Close logs the last line of the output if it does not end with a newline.
+func (s *subprocessOutput) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.line) > 0 {
+		s.log(s.line)
+		s.line = nil
+	}
+	return nil
+}
+
+func (s *subprocessOutput) log(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) == 0 {
+		return
+	}
+	klog.V(DebugVerbosity).InfoS(string(line), "command", s.command)
+}
@@ -0,0 +1,35 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logging
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubprocessOutput(t *testing.T) {
+	var logs bytes.Buffer
+	NewOutput(io.Discard, &logs, DebugLevel, JSONFormat, 0)
+
+	var captured bytes.Buffer
+	w := SubprocessOutput("trivy", &captured)
+	_, err := io.WriteString(w, "first line\nsecond ")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "line\r\nunterminated")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, "first line\nsecond line\r\nunterminated", captured.String())
+	assert.Equal(t, []map[string]interface{}{{
+		"level": "debug", "v": float64(DebugVerbosity), "msg": "first line", "command": "trivy",
+	}, {
+		"level": "debug", "v": float64(DebugVerbosity), "msg": "second line", "command": "trivy",
+	}, {
+		"level": "debug", "v": float64(DebugVerbosity), "msg": "unterminated", "command": "trivy",
+	}}, decodeEvents(t, &logs))
+}
@@ -72,6 +72,17 @@ bench.%: ## Runs go benchmarks for a specific module
 bench.%: ; $(info $(M) running benchmarks$(if $(GOTEST_RUN), matching "$(GOTEST_RUN)") for $* module)
 	$(if $(filter-out root,$*),cd $* && )go test $(if $(GOTEST_RUN),-run "$(GOTEST_RUN)") -race -cover -v ./...
 
+FUZZ_TIME ?= 30s
+
+.PHONY: fuzz
+fuzz: ## Runs every go fuzz target in the root module for FUZZ_TIME each
+fuzz: ; $(info $(M) running fuzz targets for $(FUZZ_TIME) each)
+	for pkg in $$(go list ./...); do \
+	  for target in $$(go test -list '^Fuzz' $$pkg | grep '^Fuzz'); do \
+	    go test -run '^$$' -fuzz "^$$target\$$" -fuzztime $(FUZZ_TIME) $$pkg || exit 1; \
+	  done; \
+	done
+
 E2E_PARALLEL_NODES ?= $(shell nproc --ignore=1)
 E2E_FLAKE_ATTEMPTS ?= 1
 
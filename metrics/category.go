@@ -0,0 +1,84 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/mesosphere/mindthegap/images/httputils"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+// Category is an anonymous category of an error, recorded instead of the error message which may
+// contain image names, hosts or paths.
+type Category string
+
+const (
+	Canceled      Category = "canceled"
+	Timeout       Category = "timeout"
+	Stalled       Category = "stalled"
+	Unauthorized  Category = "unauthorized"
+	NotFound      Category = "not-found"
+	RegistryError Category = "registry-error"
+	TLS           Category = "tls"
+	Network       Category = "network"
+	Filesystem    Category = "filesystem"
+	Warning       Category = "warning"
+	Other         Category = "other"
+)
+
+// Categorize returns the category of the error, or an empty category if err is nil.
+func Categorize(err error) Category {
+	if err == nil {
+		return ""
+	}
+
+	var (
+		transportErr   *transport.Error
+		unknownAuthErr x509.UnknownAuthorityError
+		hostnameErr    x509.HostnameError
+		certInvalidErr x509.CertificateInvalidError
+		warningErr     *warnings.Error
+		pathErr        *fs.PathError
+		netErr         net.Error
+	)
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	case errors.Is(err, httputils.ErrTransferStalled):
+		return Stalled
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	case errors.As(err, &transportErr):
+		switch transportErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return Unauthorized
+		case http.StatusNotFound:
+			return NotFound
+		default:
+			return RegistryError
+		}
+	case errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr), errors.As(err, &certInvalidErr):
+		return TLS
+	case errors.As(err, &warningErr):
+		return Warning
+	case errors.As(err, &pathErr):
+		return Filesystem
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return Timeout
+		}
+		return Network
+	default:
+		return Other
+	}
+}
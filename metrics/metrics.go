@@ -0,0 +1,182 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Record is the metrics of a single command run, written as one line of JSON.
+type Record struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	Version string    `json:"version,omitempty"`
+	OS      string    `json:"os"`
+	Arch    string    `json:"arch"`
+	NumCPU  int       `json:"numCPU"`
+	// Flags contains the values of numeric, boolean and duration flags, e.g. concurrency settings.
+	Flags           map[string]string  `json:"flags,omitempty"`
+	DurationSeconds float64            `json:"durationSeconds"`
+	PhaseSeconds    map[string]float64 `json:"phaseSeconds,omitempty"`
+	Counts          map[string]int     `json:"counts,omitempty"`
+	SizeBytes       map[string]int64   `json:"sizeBytes,omitempty"`
+	Success         bool               `json:"success"`
+	ErrorCategory   Category           `json:"errorCategory,omitempty"`
+}
+
+// Recorder records anonymous usage and performance metrics of a single command run, which are only
+// written to a local file, or pushed to a Pushgateway, if requested. Recorded metrics must not
+// include image names, registry hosts, file paths or any other potentially identifying values. A
+// nil recorder ignores all metrics, so commands can record metrics unconditionally. It is safe for
+// concurrent use.
+type Recorder struct {
+	mu     sync.Mutex
+	start  time.Time
+	record Record
+}
+
+func NewRecorder(command, version string) *Recorder {
+	now := time.Now()
+	return &Recorder{
+		start: now,
+		record: Record{
+			Time:         now.UTC(),
+			Command:      command,
+			Version:      version,
+			OS:           runtime.GOOS,
+			Arch:         runtime.GOARCH,
+			NumCPU:       runtime.NumCPU(),
+			Flags:        map[string]string{},
+			PhaseSeconds: map[string]float64{},
+			Counts:       map[string]int{},
+			SizeBytes:    map[string]int64{},
+		},
+	}
+}
+
+// anonymousFlagTypes are the types of flags whose values are recorded. Values of other flags, e.g.
+// strings, may contain image names, hosts or paths so are never recorded.
+var anonymousFlagTypes = map[string]struct{}{
+	"bool": {}, "int": {}, "int64": {}, "uint": {}, "uint64": {}, "float64": {}, "duration": {},
+}
+
+// RecordFlags records the values of numeric, boolean and duration flags.
+func (r *Recorder) RecordFlags(fs *pflag.FlagSet) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fs.VisitAll(func(f *pflag.Flag) {
+		if _, ok := anonymousFlagTypes[f.Value.Type()]; ok && f.Name != "help" {
+			r.record.Flags[f.Name] = f.Value.String()
+		}
+	})
+}
+
+// StartPhase starts timing a phase of the command, e.g. pulling images, returning a function that
+// ends the phase. Durations of phases with the same name are summed.
+func (r *Recorder) StartPhase(name string) (end func()) {
+	if r == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.record.PhaseSeconds[name] += time.Since(start).Seconds()
+	}
+}
+
+// AddCount adds n to the named count, e.g. the number of images pulled.
+func (r *Recorder) AddCount(name string, n int) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record.Counts[name] += n
+}
+
+// AddSize adds the size in bytes to the named size, e.g. the size of created bundles.
+func (r *Recorder) AddSize(name string, bytes int64) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record.SizeBytes[name] += bytes
+}
+
+// AddFileSize adds the size of the file to the named size, ignoring files that cannot be read.
+func (r *Recorder) AddFileSize(name, file string) {
+	if r == nil {
+		return
+	}
+
+	if fi, err := os.Stat(file); err == nil {
+		r.AddSize(name, fi.Size())
+	}
+}
+
+// Finish completes the record with the total duration and the result of the command.
+func (r *Recorder) Finish(err error) Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.record.DurationSeconds = time.Since(r.start).Seconds()
+	r.record.Success = err == nil
+	r.record.ErrorCategory = Categorize(err)
+	return r.record
+}
+
+// AppendToFile appends the record as a line of JSON to the file, creating it if necessary, so that
+// a single file collects the metrics of all runs.
+func AppendToFile(file string, record Record) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %w", err)
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open metrics file: %w", err)
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of the context carrying the recorder.
+func NewContext(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+// FromContext returns the recorder carried by the context, or nil if metrics are not recorded.
+func FromContext(ctx context.Context) *Recorder {
+	if ctx == nil {
+		return nil
+	}
+	r, _ := ctx.Value(contextKey{}).(*Recorder)
+	return r
+}
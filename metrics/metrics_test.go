@@ -0,0 +1,115 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/images/httputils"
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Int("image-pull-concurrency", 4, "")
+	fs.Duration("stall-timeout", time.Minute, "")
+	fs.String("images-file", "secret/images.yaml", "")
+	require.NoError(t, fs.Parse(nil))
+
+	r := NewRecorder("create image-bundle", "v1.0.0")
+	r.RecordFlags(fs)
+	endPhase := r.StartPhase("pull-images")
+	endPhase()
+	r.AddCount("images", 2)
+	r.AddCount("images", 3)
+	r.AddSize("bundle", 1024)
+
+	record := r.Finish(errors.New("failed"))
+	assert.Equal(t, "create image-bundle", record.Command)
+	assert.Equal(t, map[string]string{
+		"image-pull-concurrency": "4",
+		"stall-timeout":          "1m0s",
+	}, record.Flags, "string flag values must not be recorded")
+	assert.Contains(t, record.PhaseSeconds, "pull-images")
+	assert.Equal(t, map[string]int{"images": 5}, record.Counts)
+	assert.Equal(t, map[string]int64{"bundle": 1024}, record.SizeBytes)
+	assert.False(t, record.Success)
+	assert.Equal(t, Other, record.ErrorCategory)
+}
+
+func TestNilRecorder(t *testing.T) {
+	t.Parallel()
+
+	var r *Recorder
+	r.RecordFlags(pflag.NewFlagSet("test", pflag.ContinueOnError))
+	r.StartPhase("pull-images")()
+	r.AddCount("images", 1)
+	r.AddSize("bundle", 1)
+	r.AddFileSize("bundle", "nonexistent")
+
+	assert.Nil(t, FromContext(context.Background()))
+	assert.Equal(t, r, FromContext(NewContext(context.Background(), r)))
+}
+
+func TestAppendToFile(t *testing.T) {
+	t.Parallel()
+
+	metricsFile := filepath.Join(t.TempDir(), "metrics.jsonl")
+	for _, cmd := range []string{"create image-bundle", "push bundle"} {
+		require.NoError(t, AppendToFile(metricsFile, NewRecorder(cmd, "v1.0.0").Finish(nil)))
+	}
+
+	f, err := os.Open(metricsFile)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var commands []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		assert.True(t, record.Success)
+		commands = append(commands, record.Command)
+	}
+	assert.Equal(t, []string{"create image-bundle", "push bundle"}, commands)
+}
+
+func TestCategorize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		err  error
+		want Category
+	}{
+		{err: nil, want: ""},
+		{err: fmt.Errorf("wrapped: %w", context.Canceled), want: Canceled},
+		{err: fmt.Errorf("wrapped: %w", context.DeadlineExceeded), want: Timeout},
+		{err: fmt.Errorf("wrapped: %w", httputils.ErrTransferStalled), want: Stalled},
+		{err: &transport.Error{StatusCode: http.StatusUnauthorized}, want: Unauthorized},
+		{err: &transport.Error{StatusCode: http.StatusNotFound}, want: NotFound},
+		{err: &transport.Error{StatusCode: http.StatusBadGateway}, want: RegistryError},
+		{err: &warnings.Error{Warning: warnings.Warning{Kind: warnings.MissingPlatform}}, want: Warning},
+		{err: &os.PathError{Op: "open", Path: "images.yaml", Err: os.ErrNotExist}, want: Filesystem},
+		{err: errors.New("something else"), want: Other},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Categorize(tt.err), "%v", tt.err)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// pushTimeout bounds pushing metrics, so that an unreachable Pushgateway never blocks commands from
+// exiting for long.
+const pushTimeout = 10 * time.Second
+
+// PushToGateway pushes the record as gauges to the Prometheus Pushgateway at url, grouped by job and
+// command, e.g. command="create-image-bundle". Metrics previously pushed for the same job and command are replaced, so that the
+// Pushgateway always exposes the last run of every command, e.g. for tracking the health of bundle
+// pipelines on ephemeral runners over time.
+func PushToGateway(ctx context.Context, url, job string, record Record) error {
+	reg := prometheus.NewRegistry()
+	newGauge := func(name, help string) prometheus.Gauge {
+		g := prometheus.NewGauge(prometheus.GaugeOpts{Namespace: "mindthegap", Name: name, Help: help})
+		reg.MustRegister(g)
+		return g
+	}
+	newGaugeVec := func(name, help string, labels ...string) *prometheus.GaugeVec {
+		g := prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{Namespace: "mindthegap", Name: name, Help: help}, labels,
+		)
+		reg.MustRegister(g)
+		return g
+	}
+
+	newGaugeVec("build_info", "Version of mindthegap that ran the command.", "version").
+		WithLabelValues(record.Version).Set(1)
+	newGauge("last_run_timestamp_seconds", "Time the command was run at.").
+		Set(float64(record.Time.Unix()))
+	newGauge("duration_seconds", "Total duration of the command.").Set(record.DurationSeconds)
+
+	success := newGauge("success", "Whether the command succeeded (1) or failed (0).")
+	if record.Success {
+		success.Set(1)
+	} else {
+		newGaugeVec("error", "Anonymous category of the error the command failed with.", "category").
+			WithLabelValues(string(record.ErrorCategory)).Set(1)
+	}
+
+	phases := newGaugeVec("phase_duration_seconds", "Duration of phases of the command.", "phase")
+	for phase, seconds := range record.PhaseSeconds {
+		phases.WithLabelValues(phase).Set(seconds)
+	}
+	counts := newGaugeVec("count", "Counts recorded by the command, e.g. of images and failed images.", "name")
+	for name, n := range record.Counts {
+		counts.WithLabelValues(name).Set(float64(n))
+	}
+	sizes := newGaugeVec("size_bytes", "Sizes recorded by the command, e.g. of the created bundle.", "name")
+	for name, bytes := range record.SizeBytes {
+		sizes.WithLabelValues(name).Set(float64(bytes))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	if err := push.New(url, job).
+		Gatherer(reg).
+		Grouping("command", strings.ReplaceAll(record.Command, " ", "-")).
+		PushContext(ctx); err != nil {
+		return fmt.Errorf("failed to push metrics to Pushgateway: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushToGateway(t *testing.T) {
+	t.Parallel()
+
+	var (
+		gotMethod, gotPath string
+		gotValues          = map[string]float64{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotMethod, gotPath = req.Method, req.URL.EscapedPath()
+		dec := expfmt.NewDecoder(req.Body, expfmt.ResponseFormat(req.Header))
+		for {
+			var mf dto.MetricFamily
+			if err := dec.Decode(&mf); err != nil {
+				if !errors.Is(err, io.EOF) {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				break
+			}
+			for _, m := range mf.GetMetric() {
+				key := mf.GetName()
+				for _, l := range m.GetLabel() {
+					key += "{" + l.GetName() + "=" + l.GetValue() + "}"
+				}
+				gotValues[key] = m.GetGauge().GetValue()
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	record := Record{
+		Time:            time.Unix(1700000000, 0),
+		Command:         "create image-bundle",
+		Version:         "v1.0.0",
+		DurationSeconds: 93.2,
+		PhaseSeconds:    map[string]float64{"pull-images": 80.9},
+		Counts:          map[string]int{"images": 42, "failed-images": 2},
+		SizeBytes:       map[string]int64{"bundle": 2048},
+		ErrorCategory:   Timeout,
+	}
+	require.NoError(t, PushToGateway(context.Background(), srv.URL, "bundles", record))
+
+	assert.Equal(t, http.MethodPut, gotMethod)
+	assert.Equal(t, "/metrics/job/bundles/command/create-image-bundle", gotPath)
+	assert.Equal(t, map[string]float64{
+		"mindthegap_build_info{version=v1.0.0}":                1,
+		"mindthegap_last_run_timestamp_seconds":                1700000000,
+		"mindthegap_duration_seconds":                          93.2,
+		"mindthegap_success":                                   0,
+		"mindthegap_error{category=timeout}":                   1,
+		"mindthegap_phase_duration_seconds{phase=pull-images}": 80.9,
+		"mindthegap_count{name=failed-images}":                 2,
+		"mindthegap_count{name=images}":                        42,
+		"mindthegap_size_bytes{name=bundle}":                   2048,
+	}, gotValues)
+}
+
+func TestPushToGatewayError(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+
+	err := PushToGateway(context.Background(), srv.URL, "mindthegap", Record{Command: "push bundle", Success: true})
+	require.ErrorContains(t, err, "failed to push metrics to Pushgateway")
+}
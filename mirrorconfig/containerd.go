@@ -0,0 +1,57 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package mirrorconfig
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WriteContainerdHostsDir writes a containerd hosts.toml for every registry to <dir>/<registry>,
+// configuring the mirror as the host to pull and resolve images from, falling back to the registry
+// itself. dir is meant to be used as the containerd registry config_path, e.g.
+// /etc/containerd/certs.d.
+func WriteContainerdHostsDir(dir string, registryNames []string, m Mirror) error {
+	for _, registryName := range registryNames {
+		registryDir := filepath.Join(dir, registryName)
+		if err := os.MkdirAll(registryDir, 0o755); err != nil {
+			return fmt.Errorf("failed to create containerd hosts directory for %s: %w", registryName, err)
+		}
+		if err := os.WriteFile(
+			filepath.Join(registryDir, "hosts.toml"), containerdHostsTOML(registryName, m), 0o644,
+		); err != nil {
+			return fmt.Errorf("failed to write containerd hosts config for %s: %w", registryName, err)
+		}
+	}
+	return nil
+}
+
+func containerdHostsTOML(registryName string, m Mirror) []byte {
+	server := "https://" + registryName
+	if IsDockerHub(registryName) {
+		server = "https://registry-1.docker.io"
+	}
+
+	host := m.URL()
+	prefix := strings.Trim(m.RepositoryPrefix, "/")
+	pathPrefix := strings.Trim(m.PathPrefix, "/")
+	overridePath := prefix != "" || pathPrefix != ""
+	if overridePath {
+		// Paths of hosts are only used as is with override_path, otherwise /v2 is appended.
+		host += path.Join("/", pathPrefix, "v2", prefix)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "server = %q\n\n", server)
+	fmt.Fprintf(&buf, "[host.%q]\n", host)
+	fmt.Fprintln(&buf, `  capabilities = ["pull", "resolve"]`)
+	if overridePath {
+		fmt.Fprintln(&buf, "  override_path = true")
+	}
+	return buf.Bytes()
+}
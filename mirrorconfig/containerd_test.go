@@ -0,0 +1,65 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package mirrorconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteContainerdHostsDir(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		registry string
+		mirror   Mirror
+		want     string
+	}{{
+		name:     "Docker Hub over HTTP",
+		registry: "docker.io",
+		mirror:   Mirror{Address: "10.0.0.1:5000"},
+		want: `server = "https://registry-1.docker.io"
+
+[host."http://10.0.0.1:5000"]
+  capabilities = ["pull", "resolve"]
+`,
+	}, {
+		name:     "registry with port over HTTPS with repository prefix",
+		registry: "registry.example.com:8443",
+		mirror:   Mirror{Address: "mirror.local:5000", TLS: true, RepositoryPrefix: "/platform/"},
+		want: `server = "https://registry.example.com:8443"
+
+[host."https://mirror.local:5000/v2/platform"]
+  capabilities = ["pull", "resolve"]
+  override_path = true
+`,
+	}, {
+		name:     "registry behind reverse proxy with path prefix",
+		registry: "quay.io",
+		mirror:   Mirror{Address: "apps.example.com", TLS: true, PathPrefix: "/bundle-registry/"},
+		want: `server = "https://quay.io"
+
+[host."https://apps.example.com/bundle-registry/v2"]
+  capabilities = ["pull", "resolve"]
+  override_path = true
+`,
+	}}
+	for ti := range tests {
+		tt := tests[ti]
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			require.NoError(t, WriteContainerdHostsDir(dir, []string{tt.registry}, tt.mirror))
+			got, err := os.ReadFile(filepath.Join(dir, tt.registry, "hosts.toml"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
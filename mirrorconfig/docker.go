@@ -0,0 +1,90 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package mirrorconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// WriteDockerDaemonJSON configures the mirror in the Docker daemon.json file, keeping all other
+// settings of the file if it exists. Docker only supports mirrors for Docker Hub, so the mirror is
+// only configured if images from Docker Hub are served. Mirrors served over HTTP are configured as
+// insecure registries. The registries that cannot be mirrored by Docker are returned.
+func WriteDockerDaemonJSON(file string, registryNames []string, m Mirror) (unsupported []string, err error) {
+	if strings.Trim(m.RepositoryPrefix, "/") != "" {
+		return nil, errors.New("repository prefixes are not supported by Docker registry mirrors")
+	}
+	if strings.Trim(m.PathPrefix, "/") != "" {
+		return nil, errors.New("path prefixes are not supported by Docker registry mirrors")
+	}
+
+	daemonConfig := map[string]any{}
+	b, err := os.ReadFile(file)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, &daemonConfig); err != nil {
+			return nil, fmt.Errorf("failed to parse existing Docker daemon config %s: %w", file, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("failed to read existing Docker daemon config: %w", err)
+	}
+
+	mirrorsDockerHub := false
+	for _, registryName := range registryNames {
+		if IsDockerHub(registryName) {
+			mirrorsDockerHub = true
+		} else {
+			unsupported = append(unsupported, registryName)
+		}
+	}
+
+	if mirrorsDockerHub {
+		if err := addToStringList(daemonConfig, "registry-mirrors", m.URL()); err != nil {
+			return nil, err
+		}
+		if !m.TLS {
+			if err := addToStringList(daemonConfig, "insecure-registries", m.Address); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	b, err = json.MarshalIndent(daemonConfig, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Docker daemon config: %w", err)
+	}
+	if err := os.WriteFile(file, append(b, '\n'), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write Docker daemon config: %w", err)
+	}
+	return unsupported, nil
+}
+
+// addToStringList adds the value to the list of strings at key in the config, unless it already
+// contains the value.
+func addToStringList(daemonConfig map[string]any, key, value string) error {
+	var list []string
+	if existing, ok := daemonConfig[key]; ok {
+		items, ok := existing.([]any)
+		if !ok {
+			return fmt.Errorf("invalid %q in existing Docker daemon config: expected a list", key)
+		}
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("invalid %q in existing Docker daemon config: expected a list of strings", key)
+			}
+			list = append(list, s)
+		}
+	}
+	if !slices.Contains(list, value) {
+		list = append(list, value)
+	}
+	daemonConfig[key] = list
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package mirrorconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDockerDaemonJSON(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "daemon.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"log-driver": "journald", "insecure-registries": ["other:5000"]}`), 0o644))
+
+	m := Mirror{Address: "10.0.0.1:5000"}
+	unsupported, err := WriteDockerDaemonJSON(file, []string{"docker.io", "quay.io"}, m)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"quay.io"}, unsupported)
+
+	// Writing the config again does not add duplicate entries.
+	_, err = WriteDockerDaemonJSON(file, []string{"docker.io"}, m)
+	require.NoError(t, err)
+
+	got, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "log-driver": "journald",
+  "insecure-registries": ["other:5000", "10.0.0.1:5000"],
+  "registry-mirrors": ["http://10.0.0.1:5000"]
+}`, string(got))
+}
+
+func TestWriteDockerDaemonJSONRepositoryPrefix(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "daemon.json")
+	_, err := WriteDockerDaemonJSON(file, []string{"docker.io"}, Mirror{Address: "a:5000", RepositoryPrefix: "p"})
+	require.ErrorContains(t, err, "repository prefixes are not supported")
+	assert.NoFileExists(t, file)
+}
+
+func TestWriteDockerDaemonJSONPathPrefix(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "daemon.json")
+	_, err := WriteDockerDaemonJSON(file, []string{"docker.io"}, Mirror{Address: "a:5000", PathPrefix: "/p/"})
+	require.ErrorContains(t, err, "path prefixes are not supported")
+}
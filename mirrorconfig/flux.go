@@ -0,0 +1,97 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package mirrorconfig
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+const (
+	fluxImageAPIVersion = "image.toolkit.fluxcd.io/v1beta2"
+	// fluxScanInterval is how often Flux scans the mirror for tags. Tags only change when bundles are
+	// pushed, so scanning frequently is not needed.
+	fluxScanInterval = "1h"
+)
+
+type fluxObjectMeta struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+type fluxImageRepository struct {
+	APIVersion string         `yaml:"apiVersion"`
+	Kind       string         `yaml:"kind"`
+	Metadata   fluxObjectMeta `yaml:"metadata"`
+	Spec       struct {
+		Image    string `yaml:"image"`
+		Interval string `yaml:"interval"`
+	} `yaml:"spec"`
+}
+
+type fluxImagePolicy struct {
+	APIVersion string         `yaml:"apiVersion"`
+	Kind       string         `yaml:"kind"`
+	Metadata   fluxObjectMeta `yaml:"metadata"`
+	Spec       struct {
+		ImageRepositoryRef struct {
+			Name string `yaml:"name"`
+		} `yaml:"imageRepositoryRef"`
+		FilterTags struct {
+			Pattern string `yaml:"pattern"`
+		} `yaml:"filterTags"`
+		Policy struct {
+			Alphabetical struct {
+				Order string `yaml:"order"`
+			} `yaml:"alphabetical"`
+		} `yaml:"policy"`
+	} `yaml:"spec"`
+}
+
+// FluxImagePolicies returns a Flux ImageRepository and ImagePolicy for every rewritten repository
+// with bundled tags, scanning the repository served by the mirror and only selecting the bundled
+// tags, so that image automation never selects tags that are not available in the mirror.
+func FluxImagePolicies(rewrites config.RepoRewrites, m Mirror, namespace string) ([]byte, error) {
+	var docs []any
+	for _, rewrite := range rewrites.Rewrites {
+		var tags []string
+		for _, tag := range rewrite.Tags {
+			// Images bundled by digest cannot be selected by image policies.
+			if !strings.Contains(tag, ":") {
+				tags = append(tags, regexp.QuoteMeta(tag))
+			}
+		}
+		if len(tags) == 0 {
+			continue
+		}
+
+		meta := fluxObjectMeta{Name: fluxObjectName(rewrite.Destination), Namespace: namespace}
+
+		repo := fluxImageRepository{APIVersion: fluxImageAPIVersion, Kind: "ImageRepository", Metadata: meta}
+		repo.Spec.Image = m.Repository(rewrite)
+		repo.Spec.Interval = fluxScanInterval
+
+		policy := fluxImagePolicy{APIVersion: fluxImageAPIVersion, Kind: "ImagePolicy", Metadata: meta}
+		policy.Spec.ImageRepositoryRef.Name = meta.Name
+		policy.Spec.FilterTags.Pattern = "^(" + strings.Join(tags, "|") + ")$"
+		policy.Spec.Policy.Alphabetical.Order = "asc"
+
+		docs = append(docs, repo, policy)
+	}
+	return encodeYAML(docs...)
+}
+
+var invalidObjectNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// fluxObjectName returns a valid Kubernetes object name for the repository, e.g. mirror-nginx for
+// mirror/nginx.
+func fluxObjectName(repository string) string {
+	name := strings.Trim(invalidObjectNameChars.ReplaceAllString(strings.ToLower(repository), "-"), "-")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	return name
+}
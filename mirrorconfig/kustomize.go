@@ -0,0 +1,44 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package mirrorconfig
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+type kustomizeImage struct {
+	Name    string `yaml:"name"`
+	NewName string `yaml:"newName"`
+}
+
+// KustomizeImages returns a kustomization snippet that replaces the source repositories of the
+// rewrites with the repositories served by the mirror, for use in the images field of
+// kustomization.yaml files.
+func KustomizeImages(rewrites config.RepoRewrites, m Mirror) ([]byte, error) {
+	images := make([]kustomizeImage, 0, len(rewrites.Rewrites))
+	for _, rewrite := range rewrites.Rewrites {
+		images = append(images, kustomizeImage{Name: rewrite.Source, NewName: m.Repository(rewrite)})
+	}
+	return encodeYAML(map[string][]kustomizeImage{"images": images})
+}
+
+func encodeYAML(docs ...any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return nil, fmt.Errorf("failed to encode YAML: %w", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
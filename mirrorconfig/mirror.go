@@ -0,0 +1,47 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package mirrorconfig generates container runtime configs that pull images from a registry
+// serving bundles instead of from the registries the images were bundled from.
+package mirrorconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Mirror is a registry serving images without their source registry, e.g. docker.io/library/nginx
+// as <address>/library/nginx.
+type Mirror struct {
+	// Address is the host:port that clients reach the mirror at.
+	Address string
+	// TLS is true if the mirror is served over HTTPS.
+	TLS bool
+	// RepositoryPrefix is the prefix that all repositories are served under, if any.
+	RepositoryPrefix string
+	// PathPrefix is the path that the registry API is served under, if any, e.g. behind a reverse
+	// proxy, such as /bundle-registry/ for /bundle-registry/v2/.
+	PathPrefix string
+}
+
+// URL returns the base URL of the mirror.
+func (m Mirror) URL() string {
+	scheme := "http"
+	if m.TLS {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, m.Address)
+}
+
+// dockerHubRegistries are the names that images from Docker Hub can be bundled with.
+var dockerHubRegistries = map[string]struct{}{
+	"docker.io":            {},
+	"index.docker.io":      {},
+	"registry-1.docker.io": {},
+}
+
+// IsDockerHub returns true if the registry is Docker Hub.
+func IsDockerHub(registryName string) bool {
+	_, ok := dockerHubRegistries[strings.ToLower(registryName)]
+	return ok
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package mirrorconfig
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+// Repository returns the full repository that the rewritten repository is served as by the mirror,
+// e.g. <address>/<prefix>/mirror/nginx.
+func (m Mirror) Repository(rewrite config.RepoRewrite) string {
+	return path.Join(m.Address, strings.Trim(m.RepositoryPrefix, "/"), rewrite.Destination)
+}
+
+// WriteContainerdHostsDirForRewrites writes a containerd hosts.toml for every source registry of the
+// rewrites, like WriteContainerdHostsDir. containerd can only mirror registries whose repositories
+// are all served under the same prefix, e.g. docker.io/library/nginx as mirror/library/nginx, so
+// registries with repositories that are rewritten otherwise are returned as unsupported instead.
+func WriteContainerdHostsDirForRewrites(
+	dir string, rewrites config.RepoRewrites, m Mirror,
+) (unsupported []string, err error) {
+	prefixes := map[string]string{}
+	unsupportedRegistries := map[string]struct{}{}
+	for _, rewrite := range rewrites.Rewrites {
+		registryName := rewrite.Registry()
+		prefix, ok := repositoryPrefix(rewrite)
+		if existing, seen := prefixes[registryName]; !ok || (seen && existing != prefix) {
+			unsupportedRegistries[registryName] = struct{}{}
+			continue
+		}
+		prefixes[registryName] = prefix
+	}
+
+	for registryName := range unsupportedRegistries {
+		delete(prefixes, registryName)
+		unsupported = append(unsupported, registryName)
+	}
+	sort.Strings(unsupported)
+
+	for registryName, prefix := range prefixes {
+		registryMirror := m
+		registryMirror.RepositoryPrefix = path.Join(strings.Trim(m.RepositoryPrefix, "/"), prefix)
+		if err := WriteContainerdHostsDir(dir, []string{registryName}, registryMirror); err != nil {
+			return nil, fmt.Errorf("failed to write containerd hosts config for %s: %w", registryName, err)
+		}
+	}
+	return unsupported, nil
+}
+
+// repositoryPrefix returns the prefix that the repository is served under, or false if the
+// repository is not served under its own name, e.g. docker.io/library/nginx as mirror/nginx.
+func repositoryPrefix(rewrite config.RepoRewrite) (string, bool) {
+	imageName := rewrite.ImageName()
+	if rewrite.Destination == imageName {
+		return "", true
+	}
+	prefix, found := strings.CutSuffix(rewrite.Destination, "/"+imageName)
+	return prefix, found
+}
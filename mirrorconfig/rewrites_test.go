@@ -0,0 +1,97 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package mirrorconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/config"
+)
+
+var testRewrites = config.RepoRewrites{Rewrites: []config.RepoRewrite{{
+	Source:      "docker.io/library/nginx",
+	Destination: "mirror/nginx",
+	Tags:        []string{"1.21.5", "1.25"},
+}, {
+	Source:      "quay.io/coreos/etcd",
+	Destination: "quay/coreos/etcd",
+	Tags:        []string{"sha256:4b3c5d9e0a1f2e3d4c5b6a7980f1e2d3c4b5a6978f0e1d2c3b4a5968f7e6d5c4b"},
+}}}
+
+func TestKustomizeImages(t *testing.T) {
+	t.Parallel()
+
+	got, err := KustomizeImages(testRewrites, Mirror{Address: "registry.corp:5000", RepositoryPrefix: "team"})
+	require.NoError(t, err)
+	assert.Equal(t, `images:
+  - name: docker.io/library/nginx
+    newName: registry.corp:5000/team/mirror/nginx
+  - name: quay.io/coreos/etcd
+    newName: registry.corp:5000/team/quay/coreos/etcd
+`, string(got))
+}
+
+func TestFluxImagePolicies(t *testing.T) {
+	t.Parallel()
+
+	got, err := FluxImagePolicies(testRewrites, Mirror{Address: "registry.corp"}, "flux-system")
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: image.toolkit.fluxcd.io/v1beta2
+kind: ImageRepository
+metadata:
+  name: mirror-nginx
+  namespace: flux-system
+spec:
+  image: registry.corp/mirror/nginx
+  interval: 1h
+---
+apiVersion: image.toolkit.fluxcd.io/v1beta2
+kind: ImagePolicy
+metadata:
+  name: mirror-nginx
+  namespace: flux-system
+spec:
+  imageRepositoryRef:
+    name: mirror-nginx
+  filterTags:
+    pattern: ^(1\.21\.5|1\.25)$
+  policy:
+    alphabetical:
+      order: asc
+`, string(got))
+}
+
+func TestWriteContainerdHostsDirForRewrites(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	unsupported, err := WriteContainerdHostsDirForRewrites(dir, config.RepoRewrites{
+		Rewrites: append([]config.RepoRewrite{{
+			Source: "quay.io/coreos/flannel", Destination: "flannel",
+		}}, testRewrites.Rewrites...),
+	}, Mirror{Address: "registry.corp", TLS: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docker.io", "quay.io"}, unsupported)
+	assert.NoDirExists(t, filepath.Join(dir, "docker.io"))
+
+	dir = t.TempDir()
+	unsupported, err = WriteContainerdHostsDirForRewrites(
+		dir, config.RepoRewrites{Rewrites: testRewrites.Rewrites[1:]}, Mirror{Address: "registry.corp", TLS: true},
+	)
+	require.NoError(t, err)
+	assert.Empty(t, unsupported)
+	got, err := os.ReadFile(filepath.Join(dir, "quay.io", "hosts.toml"))
+	require.NoError(t, err)
+	assert.Equal(t, `server = "https://quay.io"
+
+[host."https://registry.corp/v2/quay"]
+  capabilities = ["pull", "resolve"]
+  override_path = true
+`, string(got))
+}
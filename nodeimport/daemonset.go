@@ -0,0 +1,202 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package nodeimport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/utils/ptr"
+
+	"github.com/mesosphere/mindthegap/containerd"
+)
+
+const (
+	importerContainerName = "importer"
+	hostRootMountPath     = "/host"
+
+	// importerPollInterval is how often the importer DaemonSet is checked for readiness.
+	importerPollInterval = 2 * time.Second
+)
+
+// DaemonSetImporter imports images into nodes via a short-lived privileged DaemonSet. Archives
+// are streamed to the DaemonSet pods via the Kubernetes API and imported with the node's own `ctr`,
+// so nodes do not need any network access to the machine running the import.
+type DaemonSetImporter struct {
+	client              kubernetes.Interface
+	restConfig          *rest.Config
+	namespace           string
+	image               string
+	containerdNamespace string
+
+	name string
+	// podsByNode maps node names to the names of the importer pods running on them.
+	podsByNode map[string]string
+}
+
+// NewDaemonSetImporter returns an importer that runs the specified image as a DaemonSet in the
+// namespace. The image must be available on all nodes, e.g. preloaded in air-gapped clusters, and
+// must provide `sleep` and `chroot`.
+func NewDaemonSetImporter(
+	client kubernetes.Interface,
+	restConfig *rest.Config,
+	namespace, image, containerdNamespace string,
+) *DaemonSetImporter {
+	return &DaemonSetImporter{
+		client:              client,
+		restConfig:          restConfig,
+		namespace:           namespace,
+		image:               image,
+		containerdNamespace: containerdNamespace,
+		name:                "mindthegap-node-importer-" + utilrand.String(5),
+	}
+}
+
+// Start deploys the importer DaemonSet and waits until it is ready on all nodes.
+func (i *DaemonSetImporter) Start(ctx context.Context, timeout time.Duration) error {
+	ds := importerDaemonSet(i.name, i.namespace, i.image)
+	if _, err := i.client.AppsV1().DaemonSets(i.namespace).Create(
+		ctx, ds, metav1.CreateOptions{},
+	); err != nil {
+		return fmt.Errorf("failed to create importer DaemonSet: %w", err)
+	}
+
+	if err := wait.PollUntilContextTimeout(
+		ctx, importerPollInterval, timeout, true, i.ready,
+	); err != nil {
+		return fmt.Errorf("importer DaemonSet did not become ready: %w", err)
+	}
+
+	pods, err := i.client.CoreV1().Pods(i.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(ds.Spec.Selector.MatchLabels).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list importer pods: %w", err)
+	}
+	i.podsByNode = make(map[string]string, len(pods.Items))
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			i.podsByNode[pod.Spec.NodeName] = pod.Name
+		}
+	}
+
+	return nil
+}
+
+func (i *DaemonSetImporter) ready(ctx context.Context) (bool, error) {
+	ds, err := i.client.AppsV1().DaemonSets(i.namespace).Get(ctx, i.name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	return ds.Status.ObservedGeneration >= ds.Generation &&
+		ds.Status.DesiredNumberScheduled > 0 &&
+		ds.Status.NumberReady == ds.Status.DesiredNumberScheduled, nil
+}
+
+// Stop deletes the importer DaemonSet.
+func (i *DaemonSetImporter) Stop(ctx context.Context) error {
+	err := i.client.AppsV1().DaemonSets(i.namespace).Delete(ctx, i.name, metav1.DeleteOptions{
+		PropagationPolicy: ptr.To(metav1.DeletePropagationForeground),
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete importer DaemonSet: %w", err)
+	}
+	return nil
+}
+
+func (i *DaemonSetImporter) Import(ctx context.Context, node Node, archive io.Reader) ([]byte, error) {
+	podName, ok := i.podsByNode[node.Name]
+	if !ok {
+		return nil, fmt.Errorf("no importer pod is running on node %q", node.Name)
+	}
+
+	req := i.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(i.namespace).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: importerContainerName,
+			Command: append(
+				[]string{"chroot", hostRootMountPath, "ctr"},
+				containerd.ImportImageArchiveArgs("-", i.containerdNamespace)...,
+			),
+			Stdin:  true,
+			Stdout: true,
+			Stderr: true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(i.restConfig, "POST", req.URL())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec for importer pod %q: %w", podName, err)
+	}
+
+	var output bytes.Buffer
+	if err := exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  archive,
+		Stdout: &output,
+		Stderr: &output,
+	}); err != nil {
+		return output.Bytes(), fmt.Errorf("failed to import images into node %q: %w", node.Name, err)
+	}
+
+	return output.Bytes(), nil
+}
+
+func importerDaemonSet(name, namespace, image string) *appsv1.DaemonSet {
+	podLabels := map[string]string{
+		"app.kubernetes.io/name":     "mindthegap-node-importer",
+		"app.kubernetes.io/instance": name,
+	}
+
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    podLabels,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: podLabels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				Spec: corev1.PodSpec{
+					// Import into every node, including control plane and tainted nodes.
+					Tolerations:                   []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+					TerminationGracePeriodSeconds: ptr.To[int64](0),
+					Containers: []corev1.Container{{
+						Name:            importerContainerName,
+						Image:           image,
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Command:         []string{"sleep", "86400"},
+						SecurityContext: &corev1.SecurityContext{Privileged: ptr.To(true)},
+						VolumeMounts: []corev1.VolumeMount{{
+							Name:      "host-root",
+							MountPath: hostRootMountPath,
+						}},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: "host-root",
+						VolumeSource: corev1.VolumeSource{
+							HostPath: &corev1.HostPathVolumeSource{Path: "/"},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package nodeimport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestDaemonSetImporterStartStop(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset()
+	importer := NewDaemonSetImporter(client, nil, "kube-system", "busybox:1.36.1", "k8s.io")
+
+	// Simulate the DaemonSet controller: report the DaemonSet as ready and create its pods.
+	client.PrependReactor("create", "daemonsets",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			ds := action.(k8stesting.CreateAction).GetObject().(*appsv1.DaemonSet)
+			ds.Status = appsv1.DaemonSetStatus{DesiredNumberScheduled: 2, NumberReady: 2}
+			for _, node := range []string{"node-1", "node-2"} {
+				err := client.Tracker().Add(&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      ds.Name + "-" + node,
+						Namespace: ds.Namespace,
+						Labels:    ds.Spec.Template.Labels,
+					},
+					Spec:   corev1.PodSpec{NodeName: node},
+					Status: corev1.PodStatus{Phase: corev1.PodRunning},
+				})
+				if err != nil {
+					return true, nil, err
+				}
+			}
+			return false, nil, nil
+		})
+
+	require.NoError(t, importer.Start(context.Background(), time.Second))
+	assert.Equal(t, map[string]string{
+		"node-1": importer.name + "-node-1",
+		"node-2": importer.name + "-node-2",
+	}, importer.podsByNode)
+
+	ds, err := client.AppsV1().DaemonSets("kube-system").Get(
+		context.Background(), importer.name, metav1.GetOptions{},
+	)
+	require.NoError(t, err)
+	container := ds.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "busybox:1.36.1", container.Image)
+	assert.True(t, *container.SecurityContext.Privileged)
+	assert.Equal(t, "/", ds.Spec.Template.Spec.Volumes[0].HostPath.Path)
+
+	require.NoError(t, importer.Stop(context.Background()))
+	// Stopping again is a no-op as the DaemonSet no longer exists.
+	require.NoError(t, importer.Stop(context.Background()))
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package nodeimport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/mesosphere/mindthegap/images/platform"
+)
+
+// Node is a node to import images into.
+type Node struct {
+	Name string
+	// Address is used to connect to the node via SSH.
+	Address  string
+	Platform platform.Platform
+}
+
+// Importer imports docker archives into containerd on nodes.
+type Importer interface {
+	// Import imports the docker archive read from archive into containerd on the node, returning
+	// the output of the import.
+	Import(ctx context.Context, node Node, archive io.Reader) ([]byte, error)
+}
+
+// ClusterNodes returns all nodes in the cluster, sorted by name. Nodes are addressed by their
+// internal IP, falling back to their external IP and hostname.
+func ClusterNodes(ctx context.Context, client kubernetes.Interface) ([]Node, error) {
+	nodeList, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cluster nodes: %w", err)
+	}
+
+	nodes := make([]Node, 0, len(nodeList.Items))
+	for i := range nodeList.Items {
+		n := &nodeList.Items[i]
+
+		p, err := platform.New(
+			n.Status.NodeInfo.OperatingSystem,
+			n.Status.NodeInfo.Architecture,
+			"",
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine platform of node %q: %w", n.Name, err)
+		}
+		// Windows containers only run on nodes with the same Windows build as the image.
+		if build := n.Labels[corev1.LabelWindowsBuild]; build != "" && p.OS() == "windows" {
+			p, err = p.WithOSVersion(build)
+			if err != nil {
+				return nil, fmt.Errorf("failed to determine platform of node %q: %w", n.Name, err)
+			}
+		}
+
+		nodes = append(nodes, Node{Name: n.Name, Address: nodeAddress(n), Platform: p})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	return nodes, nil
+}
+
+func nodeAddress(n *corev1.Node) string {
+	for _, addrType := range []corev1.NodeAddressType{
+		corev1.NodeInternalIP, corev1.NodeExternalIP, corev1.NodeHostName,
+	} {
+		for _, addr := range n.Status.Addresses {
+			if addr.Type == addrType {
+				return addr.Address
+			}
+		}
+	}
+	return n.Name
+}
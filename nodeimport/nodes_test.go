@@ -0,0 +1,71 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package nodeimport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/mesosphere/mindthegap/images/platform"
+)
+
+func TestClusterNodes(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset(
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "worker-1"},
+			Status: corev1.NodeStatus{
+				NodeInfo: corev1.NodeSystemInfo{OperatingSystem: "linux", Architecture: "arm64"},
+				Addresses: []corev1.NodeAddress{
+					{Type: corev1.NodeHostName, Address: "worker-1.example.com"},
+					{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+				},
+			},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "control-plane-1"},
+			Status: corev1.NodeStatus{
+				NodeInfo: corev1.NodeSystemInfo{OperatingSystem: "linux", Architecture: "amd64"},
+				Addresses: []corev1.NodeAddress{
+					{Type: corev1.NodeHostName, Address: "control-plane-1.example.com"},
+				},
+			},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "worker-windows-1",
+				Labels: map[string]string{corev1.LabelWindowsBuild: "10.0.17763"},
+			},
+			Status: corev1.NodeStatus{
+				NodeInfo: corev1.NodeSystemInfo{OperatingSystem: "windows", Architecture: "amd64"},
+				Addresses: []corev1.NodeAddress{
+					{Type: corev1.NodeInternalIP, Address: "10.0.0.3"},
+				},
+			},
+		},
+	)
+
+	nodes, err := ClusterNodes(context.Background(), client)
+	require.NoError(t, err)
+	assert.Equal(t, []Node{{
+		Name:     "control-plane-1",
+		Address:  "control-plane-1.example.com",
+		Platform: platform.MustParse("linux/amd64"),
+	}, {
+		Name:     "worker-1",
+		Address:  "10.0.0.2",
+		Platform: platform.MustParse("linux/arm64"),
+	}, {
+		Name:     "worker-windows-1",
+		Address:  "10.0.0.3",
+		Platform: platform.MustParse("windows/amd64:10.0.17763"),
+	}}, nodes)
+}
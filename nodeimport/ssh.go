@@ -0,0 +1,122 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package nodeimport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/mesosphere/mindthegap/containerd"
+)
+
+// SSHConfig configures how to connect to nodes via SSH.
+type SSHConfig struct {
+	User    string
+	KeyFile string
+	Port    int
+	// KnownHostsFile is used to verify node host keys.
+	KnownHostsFile string
+	// InsecureIgnoreHostKey disables host key verification.
+	InsecureIgnoreHostKey bool
+	// Sudo runs the import via sudo, for users other than root.
+	Sudo bool
+}
+
+// SSHImporter imports images into nodes via SSH, streaming archives to the node's own `ctr`.
+type SSHImporter struct {
+	clientConfig        *ssh.ClientConfig
+	port                int
+	sudo                bool
+	containerdNamespace string
+}
+
+func NewSSHImporter(cfg SSHConfig, containerdNamespace string) (*SSHImporter, error) {
+	key, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH key: %w", err)
+	}
+
+	//nolint:gosec // Ignoring host keys is explicitly requested.
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if !cfg.InsecureIgnoreHostKey {
+		hostKeyCallback, err = knownhosts.New(cfg.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSH known hosts: %w", err)
+		}
+	}
+
+	return &SSHImporter{
+		clientConfig: &ssh.ClientConfig{
+			User:            cfg.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+		},
+		port:                cfg.Port,
+		sudo:                cfg.Sudo,
+		containerdNamespace: containerdNamespace,
+	}, nil
+}
+
+func (i *SSHImporter) Import(ctx context.Context, node Node, archive io.Reader) ([]byte, error) {
+	addr := net.JoinHostPort(node.Address, strconv.Itoa(i.port))
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to node %q via SSH: %w", node.Name, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, i.clientConfig)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to connect to node %q via SSH: %w", node.Name, err)
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	defer client.Close()
+
+	// Close the connection if the context is cancelled, which aborts the running import.
+	stop := context.AfterFunc(ctx, func() { _ = client.Close() })
+	defer stop()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session on node %q: %w", node.Name, err)
+	}
+	defer session.Close()
+
+	var output bytes.Buffer
+	session.Stdin = archive
+	session.Stdout = &output
+	session.Stderr = &output
+
+	if err := session.Run(i.importCommand()); err != nil {
+		return output.Bytes(), fmt.Errorf("failed to import images into node %q: %w", node.Name, err)
+	}
+
+	return output.Bytes(), nil
+}
+
+func (i *SSHImporter) importCommand() string {
+	args := append([]string{"ctr"}, containerd.ImportImageArchiveArgs("-", i.containerdNamespace)...)
+	if i.sudo {
+		args = append([]string{"sudo", "-n"}, args...)
+	}
+	quoted := make([]string, 0, len(args))
+	for _, a := range args {
+		quoted = append(quoted, "'"+strings.ReplaceAll(a, "'", `'\''`)+"'")
+	}
+	return strings.Join(quoted, " ")
+}
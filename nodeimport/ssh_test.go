@@ -0,0 +1,172 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package nodeimport
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+type execResult struct {
+	command string
+	stdin   string
+}
+
+// startSSHServer starts an SSH server that accepts the client key, records every exec request
+// and its stdin, and exits with the specified exit status.
+func startSSHServer(
+	t *testing.T,
+	clientKey ssh.PublicKey,
+	exitStatus uint32,
+) (addr string, results <-chan execResult) {
+	t.Helper()
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, assert.AnError
+			}
+			return nil, nil
+		},
+	}
+	cfg.AddHostKey(hostSigner)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	resultsCh := make(chan execResult, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+
+		for newCh := range chans {
+			ch, chReqs, err := newCh.Accept()
+			if err != nil {
+				return
+			}
+			for req := range chReqs {
+				if req.Type != "exec" {
+					_ = req.Reply(false, nil)
+					continue
+				}
+				_ = req.Reply(true, nil)
+				commandLen := binary.BigEndian.Uint32(req.Payload)
+				command := string(req.Payload[4 : 4+commandLen])
+				stdin, _ := io.ReadAll(ch)
+				_, _ = ch.Write([]byte("imported"))
+				status := make([]byte, 4)
+				binary.BigEndian.PutUint32(status, exitStatus)
+				_, _ = ch.SendRequest("exit-status", false, status)
+				_ = ch.Close()
+				resultsCh <- execResult{command: command, stdin: string(stdin)}
+			}
+		}
+	}()
+
+	return l.Addr().String(), resultsCh
+}
+
+func writeClientKey(t *testing.T) (keyFile string, pub ssh.PublicKey) {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.NoError(t, err)
+	keyFile = filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600))
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return keyFile, signer.PublicKey()
+}
+
+func TestSSHImporter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		sudo        bool
+		exitStatus  uint32
+		wantCommand string
+		wantErr     bool
+	}{{
+		name:        "sudo",
+		sudo:        true,
+		wantCommand: "'sudo' '-n' 'ctr' '-n' 'k8s.io' 'images' 'import' '--no-unpack' '--all-platforms' '--digests' '-'",
+	}, {
+		name:        "no sudo",
+		wantCommand: "'ctr' '-n' 'k8s.io' 'images' 'import' '--no-unpack' '--all-platforms' '--digests' '-'",
+	}, {
+		name:        "import fails",
+		exitStatus:  1,
+		wantCommand: "'ctr' '-n' 'k8s.io' 'images' 'import' '--no-unpack' '--all-platforms' '--digests' '-'",
+		wantErr:     true,
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			keyFile, pub := writeClientKey(t)
+			addr, results := startSSHServer(t, pub, tt.exitStatus)
+			host, port, err := net.SplitHostPort(addr)
+			require.NoError(t, err)
+			portNum, err := strconv.Atoi(port)
+			require.NoError(t, err)
+
+			importer, err := NewSSHImporter(SSHConfig{
+				User:                  "core",
+				KeyFile:               keyFile,
+				Port:                  portNum,
+				InsecureIgnoreHostKey: true,
+				Sudo:                  tt.sudo,
+			}, "k8s.io")
+			require.NoError(t, err)
+
+			importOutput, err := importer.Import(
+				context.Background(),
+				Node{Name: "node-1", Address: host},
+				strings.NewReader("docker archive"),
+			)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, "imported", string(importOutput))
+
+			result := <-results
+			assert.Equal(t, tt.wantCommand, result.command)
+			assert.Equal(t, "docker archive", result.stdin)
+		})
+	}
+}
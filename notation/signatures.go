@@ -0,0 +1,92 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package notation
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// ArtifactType is the artifact type of Notation signatures, attached to the signed manifests as
+// OCI referrers.
+const ArtifactType = "application/vnd.cncf.notary.signature"
+
+// Signatures returns the descriptors of the Notation signatures of the subject manifest, discovered
+// via the referrers API or the referrers tag schema for registries that do not support the referrers
+// API yet.
+func Signatures(subject name.Digest, opts ...remote.Option) ([]v1.Descriptor, error) {
+	idx, err := remote.Referrers(subject, append(
+		opts, remote.WithFilter("artifactType", ArtifactType),
+	)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover signatures of %s: %w", subject, err)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signatures of %s: %w", subject, err)
+	}
+
+	// Registries do not all apply the artifact type filter, so filter again.
+	sigs := make([]v1.Descriptor, 0, len(im.Manifests))
+	for _, desc := range im.Manifests {
+		if desc.ArtifactType == ArtifactType {
+			sigs = append(sigs, desc)
+		}
+	}
+	return sigs, nil
+}
+
+// Subjects returns the digests of the manifests in an image that can be signed: the image index
+// itself and every manifest it references.
+func Subjects(idx v1.ImageIndex) ([]v1.Hash, error) {
+	digest, err := idx.Digest()
+	if err != nil {
+		return nil, err
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	subjects := make([]v1.Hash, 0, len(im.Manifests)+1)
+	subjects = append(subjects, digest)
+	for _, desc := range im.Manifests {
+		subjects = append(subjects, desc.Digest)
+	}
+	return subjects, nil
+}
+
+// CopySignatures copies the Notation signatures of the subject manifests from the source repository
+// to the destination repository, returning the number of signatures copied. Destination registries
+// that do not support the referrers API yet are updated via the referrers tag schema.
+func CopySignatures(
+	src name.Repository, srcOpts []remote.Option,
+	dst name.Repository, dstOpts []remote.Option,
+	subjects ...v1.Hash,
+) (int, error) {
+	copied := 0
+	for _, subject := range subjects {
+		sigs, err := Signatures(src.Digest(subject.String()), srcOpts...)
+		if err != nil {
+			return copied, err
+		}
+
+		// Signatures of the same subject are copied sequentially, as every copy updates the same
+		// referrers tag in registries that do not support the referrers API.
+		for _, desc := range sigs {
+			sig, err := remote.Image(src.Digest(desc.Digest.String()), srcOpts...)
+			if err != nil {
+				return copied, fmt.Errorf("failed to read signature %s: %w", desc.Digest, err)
+			}
+			if err := remote.Write(dst.Digest(desc.Digest.String()), sig, dstOpts...); err != nil {
+				return copied, fmt.Errorf("failed to copy signature %s: %w", desc.Digest, err)
+			}
+			copied++
+		}
+	}
+	return copied, nil
+}
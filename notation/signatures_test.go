@@ -0,0 +1,61 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package notation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/docker/registry"
+)
+
+func TestCopySignatures(t *testing.T) {
+	t.Parallel()
+
+	signer := newTestSigner(t, "example.com")
+	trustStoreDir := t.TempDir()
+	signer.writeTrustStore(t, trustStoreDir, "test")
+
+	src := newTestRepository(t)
+	idx, desc := pushTestIndex(t, src)
+	signer.sign(t, src, desc)
+
+	sigs, err := Signatures(src.Digest(desc.Digest.String()))
+	require.NoError(t, err)
+	require.Len(t, sigs, 1)
+
+	// Copy to the registry used for bundles, which does not support the referrers API.
+	reg, err := registry.NewRegistry(registry.Config{StorageDirectory: t.TempDir()})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	_, err = reg.Start(ctx)
+	require.NoError(t, err)
+	dst, err := name.NewRepository(reg.Address()+"/library/nginx", name.Insecure)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(dst.Tag("1.21.5"), idx))
+
+	subjects, err := Subjects(idx)
+	require.NoError(t, err)
+	require.Len(t, subjects, 2)
+
+	copied, err := CopySignatures(src, nil, dst, nil, subjects...)
+	require.NoError(t, err)
+	assert.Equal(t, 1, copied)
+
+	copiedSigs, err := Signatures(dst.Digest(desc.Digest.String()))
+	require.NoError(t, err)
+	assert.Equal(t, sigs[0].Digest, copiedSigs[0].Digest)
+
+	v := NewVerifier(testPolicy(Strict, "*"), trustStoreDir)
+	require.NoError(
+		t,
+		v.VerifyImage(dst.Digest(desc.Digest.String()), "docker.io/library/nginx", idx, nil),
+	)
+}
@@ -0,0 +1,249 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package notation
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// VerificationLevel is the signature verification level of a trust policy.
+type VerificationLevel string
+
+const (
+	// Strict rejects images without a valid signature.
+	Strict VerificationLevel = "strict"
+	// Permissive rejects images without a valid signature. Notation additionally only logs
+	// revocation check failures at this level, which are not checked here.
+	Permissive VerificationLevel = "permissive"
+	// Audit only reports images without a valid signature.
+	Audit VerificationLevel = "audit"
+	// Skip does not verify signatures.
+	Skip VerificationLevel = "skip"
+)
+
+// TrustPolicyDocument is a Notation trust policy document, see
+// https://github.com/notaryproject/specifications/blob/main/specs/trust-store-trust-policy.md.
+type TrustPolicyDocument struct {
+	Version       string        `json:"version"`
+	TrustPolicies []TrustPolicy `json:"trustPolicies"`
+}
+
+type TrustPolicy struct {
+	Name                  string                `json:"name"`
+	RegistryScopes        []string              `json:"registryScopes"`
+	SignatureVerification SignatureVerification `json:"signatureVerification"`
+	TrustStores           []string              `json:"trustStores,omitempty"`
+	TrustedIdentities     []string              `json:"trustedIdentities,omitempty"`
+}
+
+type SignatureVerification struct {
+	Level VerificationLevel `json:"level"`
+}
+
+const wildcardScope = "*"
+
+// ParseTrustPolicyFile parses and validates a Notation trust policy document.
+func ParseTrustPolicyFile(file string) (*TrustPolicyDocument, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Notation trust policy: %w", err)
+	}
+
+	var doc TrustPolicyDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse Notation trust policy %s: %w", file, err)
+	}
+	if err := doc.validate(); err != nil {
+		return nil, fmt.Errorf("invalid Notation trust policy %s: %w", file, err)
+	}
+	return &doc, nil
+}
+
+func (d *TrustPolicyDocument) validate() error {
+	if d.Version != "1.0" {
+		return fmt.Errorf("unsupported version %q: only version 1.0 is supported", d.Version)
+	}
+	if len(d.TrustPolicies) == 0 {
+		return errors.New("no trust policies defined")
+	}
+
+	names := map[string]struct{}{}
+	scopes := map[string]string{}
+	for _, p := range d.TrustPolicies {
+		if p.Name == "" {
+			return errors.New("trust policy without name")
+		}
+		if _, ok := names[p.Name]; ok {
+			return fmt.Errorf("multiple trust policies named %q", p.Name)
+		}
+		names[p.Name] = struct{}{}
+
+		switch p.SignatureVerification.Level {
+		case Strict, Permissive, Audit:
+			if len(p.TrustStores) == 0 || len(p.TrustedIdentities) == 0 {
+				return fmt.Errorf(
+					"trust policy %q must specify trust stores and trusted identities", p.Name,
+				)
+			}
+		case Skip:
+		default:
+			return fmt.Errorf(
+				"trust policy %q has unsupported signature verification level %q",
+				p.Name, p.SignatureVerification.Level,
+			)
+		}
+
+		if len(p.RegistryScopes) == 0 {
+			return fmt.Errorf("trust policy %q has no registry scopes", p.Name)
+		}
+		for _, scope := range p.RegistryScopes {
+			if scope == wildcardScope && len(p.RegistryScopes) > 1 {
+				return fmt.Errorf(
+					"trust policy %q cannot combine the wildcard registry scope with other scopes", p.Name,
+				)
+			}
+			if other, ok := scopes[scope]; ok {
+				return fmt.Errorf(
+					"registry scope %q is used by trust policies %q and %q", scope, other, p.Name,
+				)
+			}
+			scopes[scope] = p.Name
+		}
+
+		for _, store := range p.TrustStores {
+			if _, _, err := parseTrustStoreName(store); err != nil {
+				return fmt.Errorf("trust policy %q: %w", p.Name, err)
+			}
+		}
+		for _, identity := range p.TrustedIdentities {
+			if identity == wildcardScope {
+				continue
+			}
+			if _, err := parseTrustedIdentity(identity); err != nil {
+				return fmt.Errorf("trust policy %q: %w", p.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// PolicyFor returns the trust policy applying to the repository, e.g. docker.io/library/nginx. A
+// policy with the repository as registry scope takes precedence over a policy with the wildcard
+// scope.
+func (d *TrustPolicyDocument) PolicyFor(repository string) (*TrustPolicy, error) {
+	var wildcard *TrustPolicy
+	for i := range d.TrustPolicies {
+		p := &d.TrustPolicies[i]
+		if slices.Contains(p.RegistryScopes, repository) {
+			return p, nil
+		}
+		if slices.Contains(p.RegistryScopes, wildcardScope) {
+			wildcard = p
+		}
+	}
+	if wildcard == nil {
+		return nil, fmt.Errorf("no Notation trust policy applies to %s", repository)
+	}
+	return wildcard, nil
+}
+
+// Trust store types, named as the directories of a trust store.
+const (
+	caTrustStore               = "ca"
+	signingAuthorityTrustStore = "signingAuthority"
+	tsaTrustStore              = "tsa"
+)
+
+func parseTrustStoreName(s string) (storeType, name string, err error) {
+	storeType, name, ok := strings.Cut(s, ":")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("invalid trust store %q: must be in the format <type>:<name>", s)
+	}
+	switch storeType {
+	case caTrustStore, signingAuthorityTrustStore, tsaTrustStore:
+	default:
+		return "", "", fmt.Errorf("invalid trust store %q: unsupported type %q", s, storeType)
+	}
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return "", "", fmt.Errorf("invalid trust store %q: invalid name %q", s, name)
+	}
+	return storeType, name, nil
+}
+
+// loadTrustStores loads the certificates of the named trust stores of the specified type from a
+// Notation trust store directory, laid out as x509/<type>/<name>/<certificate files>.
+func loadTrustStores(dir, storeType string, stores []string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	found := false
+	for _, s := range stores {
+		t, name, err := parseTrustStoreName(s)
+		if err != nil {
+			return nil, err
+		}
+		if t != storeType {
+			continue
+		}
+
+		storeDir := filepath.Join(dir, "x509", t, name)
+		entries, err := os.ReadDir(storeDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Notation trust store %q: %w", s, err)
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			certs, err := readCertificates(filepath.Join(storeDir, entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Notation trust store %q: %w", s, err)
+			}
+			for _, cert := range certs {
+				pool.AddCert(cert)
+				found = true
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no certificates found in trust stores of type %q", storeType)
+	}
+	return pool, nil
+}
+
+// readCertificates reads PEM or DER encoded certificates from the file.
+func readCertificates(file string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(b); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate in %s: %w", file, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) > 0 {
+		return certs, nil
+	}
+
+	certs, err = x509.ParseCertificates(b)
+	if err != nil || len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return certs, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package notation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrustPolicyFile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr string
+	}{{
+		name: "valid",
+		policy: `{
+  "version": "1.0",
+  "trustPolicies": [{
+    "name": "nginx",
+    "registryScopes": ["docker.io/library/nginx"],
+    "signatureVerification": {"level": "strict"},
+    "trustStores": ["ca:acme"],
+    "trustedIdentities": ["x509.subject: C=US, ST=WA, O=acme.io"]
+  }, {
+    "name": "default",
+    "registryScopes": ["*"],
+    "signatureVerification": {"level": "skip"}
+  }]
+}`,
+	}, {
+		name:    "unsupported version",
+		policy:  `{"version": "2.0", "trustPolicies": []}`,
+		wantErr: `unsupported version "2.0"`,
+	}, {
+		name: "duplicate scope",
+		policy: `{"version": "1.0", "trustPolicies": [
+  {"name": "a", "registryScopes": ["*"], "signatureVerification": {"level": "skip"}},
+  {"name": "b", "registryScopes": ["*"], "signatureVerification": {"level": "skip"}}
+]}`,
+		wantErr: `registry scope "*" is used by trust policies "a" and "b"`,
+	}, {
+		name: "missing trust stores",
+		policy: `{"version": "1.0", "trustPolicies": [
+  {"name": "a", "registryScopes": ["*"], "signatureVerification": {"level": "strict"}}
+]}`,
+		wantErr: `trust policy "a" must specify trust stores and trusted identities`,
+	}, {
+		name: "invalid trust store",
+		policy: `{"version": "1.0", "trustPolicies": [
+  {"name": "a", "registryScopes": ["*"], "signatureVerification": {"level": "audit"},
+   "trustStores": ["acme"], "trustedIdentities": ["*"]}
+]}`,
+		wantErr: `invalid trust store "acme"`,
+	}, {
+		name: "invalid trusted identity",
+		policy: `{"version": "1.0", "trustPolicies": [
+  {"name": "a", "registryScopes": ["*"], "signatureVerification": {"level": "audit"},
+   "trustStores": ["ca:acme"], "trustedIdentities": ["acme"]}
+]}`,
+		wantErr: `invalid trusted identity "acme"`,
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := filepath.Join(t.TempDir(), "trustpolicy.json")
+			require.NoError(t, os.WriteFile(f, []byte(tt.policy), 0o644))
+
+			_, err := ParseTrustPolicyFile(f)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestPolicyFor(t *testing.T) {
+	t.Parallel()
+
+	doc := &TrustPolicyDocument{TrustPolicies: []TrustPolicy{
+		{Name: "default", RegistryScopes: []string{"*"}},
+		{Name: "nginx", RegistryScopes: []string{"docker.io/library/nginx"}},
+	}}
+
+	p, err := doc.PolicyFor("docker.io/library/nginx")
+	require.NoError(t, err)
+	assert.Equal(t, "nginx", p.Name)
+
+	p, err = doc.PolicyFor("docker.io/library/busybox")
+	require.NoError(t, err)
+	assert.Equal(t, "default", p.Name)
+
+	doc.TrustPolicies = doc.TrustPolicies[1:]
+	_, err = doc.PolicyFor("docker.io/library/busybox")
+	require.ErrorContains(t, err, "no Notation trust policy applies to docker.io/library/busybox")
+}
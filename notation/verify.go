@@ -0,0 +1,410 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package notation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+var (
+	// ErrNoSignatures is returned when an image has no Notation signatures.
+	ErrNoSignatures = errors.New("no Notation signatures found")
+	// ErrVerificationFailed is returned when none of the Notation signatures of an image is valid.
+	ErrVerificationFailed = errors.New("failed to verify Notation signatures")
+)
+
+const (
+	jwsEnvelopeMediaType  = "application/jose+json"
+	coseEnvelopeMediaType = "application/cose"
+	payloadContentType    = "application/vnd.cncf.notary.payload.v1+json"
+
+	headerSigningScheme        = "io.cncf.notary.signingScheme"
+	headerAuthenticSigningTime = "io.cncf.notary.authenticSigningTime"
+	headerExpiry               = "io.cncf.notary.expiry"
+
+	signingSchemeX509                 = "notary.x509"
+	signingSchemeX509SigningAuthority = "notary.x509.signingAuthority"
+)
+
+// Verifier verifies Notation signatures against a trust policy and trust store. Only signatures in
+// the JWS envelope format are supported, verification plugins and revocation checks are not.
+type Verifier struct {
+	policy        *TrustPolicyDocument
+	trustStoreDir string
+	now           func() time.Time
+}
+
+// NewVerifier creates a verifier for the trust policy document and the trust store directory
+// containing the x509/<type>/<name> trust stores that the trust policies refer to.
+func NewVerifier(policy *TrustPolicyDocument, trustStoreDir string) *Verifier {
+	return &Verifier{policy: policy, trustStoreDir: trustStoreDir, now: time.Now}
+}
+
+// VerifyImage verifies the Notation signatures of an image in the repository, applying the trust
+// policy for scope, e.g. docker.io/library/nginx. The image is verified if the manifest referenced
+// by signed has a valid signature or, if it has no signatures, if every manifest in idx has a valid
+// signature. Failed verifications are recorded as warnings for policies with the audit level.
+func (v *Verifier) VerifyImage(
+	signed name.Digest,
+	scope string,
+	idx v1.ImageIndex,
+	w *warnings.Collector,
+	opts ...remote.Option,
+) error {
+	policy, err := v.policy.PolicyFor(scope)
+	if err != nil {
+		return err
+	}
+	if policy.SignatureVerification.Level == Skip {
+		return nil
+	}
+
+	err = v.verify(signed, policy, opts...)
+	if errors.Is(err, ErrNoSignatures) {
+		var im *v1.IndexManifest
+		im, err = idx.IndexManifest()
+		if err != nil {
+			return err
+		}
+		for _, desc := range im.Manifests {
+			if err = v.verify(signed.Context().Digest(desc.Digest.String()), policy, opts...); err != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil && policy.SignatureVerification.Level == Audit {
+		return w.Warnf(warnings.SignatureVerification, "%s: %v", signed, err)
+	}
+	return err
+}
+
+// verify verifies that at least one Notation signature of the subject manifest is valid.
+func (v *Verifier) verify(subject name.Digest, policy *TrustPolicy, opts ...remote.Option) error {
+	sigs, err := Signatures(subject, opts...)
+	if err != nil {
+		return err
+	}
+	if len(sigs) == 0 {
+		return fmt.Errorf("%w for %s", ErrNoSignatures, subject)
+	}
+
+	var errs []error
+	for _, desc := range sigs {
+		err := v.verifySignature(subject, desc, policy, opts...)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("signature %s: %w", desc.Digest, err))
+	}
+	return fmt.Errorf("%w for %s: %w", ErrVerificationFailed, subject, errors.Join(errs...))
+}
+
+func (v *Verifier) verifySignature(
+	subject name.Digest,
+	desc v1.Descriptor,
+	policy *TrustPolicy,
+	opts ...remote.Option,
+) error {
+	sig, err := remote.Image(subject.Context().Digest(desc.Digest.String()), opts...)
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %w", err)
+	}
+	layers, err := sig.Layers()
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %w", err)
+	}
+	if len(layers) != 1 {
+		return fmt.Errorf("expected a single signature envelope, found %d", len(layers))
+	}
+	mt, err := layers[0].MediaType()
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %w", err)
+	}
+	switch mt {
+	case jwsEnvelopeMediaType:
+	case coseEnvelopeMediaType:
+		return errors.New("COSE signature envelopes are not supported, sign with --signature-format jws")
+	default:
+		return fmt.Errorf("unsupported signature envelope media type %q", mt)
+	}
+
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		return fmt.Errorf("failed to read signature envelope: %w", err)
+	}
+	defer rc.Close()
+	envelope, err := io.ReadAll(rc)
+	if err != nil {
+		return fmt.Errorf("failed to read signature envelope: %w", err)
+	}
+
+	subjectDigest, err := v1.NewHash(subject.DigestStr())
+	if err != nil {
+		return err
+	}
+	return v.verifyEnvelope(envelope, subjectDigest, policy)
+}
+
+// jwsEnvelope is a JWS envelope in flattened JSON serialization, as created by Notation.
+type jwsEnvelope struct {
+	Payload     string `json:"payload"`
+	Protected   string `json:"protected"`
+	Signature   string `json:"signature"`
+	Unprotected struct {
+		CertChain [][]byte `json:"x5c"`
+	} `json:"header"`
+}
+
+type jwsProtectedHeader struct {
+	Algorithm            string     `json:"alg"`
+	ContentType          string     `json:"cty"`
+	Critical             []string   `json:"crit"`
+	SigningScheme        string     `json:"io.cncf.notary.signingScheme"`
+	SigningTime          *time.Time `json:"io.cncf.notary.signingTime"`
+	AuthenticSigningTime *time.Time `json:"io.cncf.notary.authenticSigningTime"`
+	Expiry               *time.Time `json:"io.cncf.notary.expiry"`
+	VerificationPlugin   string     `json:"io.cncf.notary.verificationPlugin"`
+}
+
+type signaturePayload struct {
+	TargetArtifact v1.Descriptor `json:"targetArtifact"`
+}
+
+func (v *Verifier) verifyEnvelope(envelope []byte, subject v1.Hash, policy *TrustPolicy) error {
+	var env jwsEnvelope
+	if err := json.Unmarshal(envelope, &env); err != nil {
+		return fmt.Errorf("failed to parse signature envelope: %w", err)
+	}
+
+	protectedJSON, err := base64.RawURLEncoding.DecodeString(env.Protected)
+	if err != nil {
+		return fmt.Errorf("failed to decode protected header: %w", err)
+	}
+	var protected jwsProtectedHeader
+	if err := json.Unmarshal(protectedJSON, &protected); err != nil {
+		return fmt.Errorf("failed to parse protected header: %w", err)
+	}
+	if protected.ContentType != payloadContentType {
+		return fmt.Errorf("unsupported payload content type %q", protected.ContentType)
+	}
+	if protected.VerificationPlugin != "" {
+		return fmt.Errorf("verification plugin %q is not supported", protected.VerificationPlugin)
+	}
+	for _, h := range protected.Critical {
+		switch h {
+		case headerSigningScheme, headerExpiry, headerAuthenticSigningTime:
+		default:
+			return fmt.Errorf("unsupported critical header %q", h)
+		}
+	}
+
+	// Verify integrity first, so that no values of a tampered envelope are trusted.
+	if len(env.Unprotected.CertChain) == 0 {
+		return errors.New("signature envelope contains no certificates")
+	}
+	certs := make([]*x509.Certificate, 0, len(env.Unprotected.CertChain))
+	for _, der := range env.Unprotected.CertChain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("failed to parse certificate chain: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(env.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+	if err := verifyJWS(
+		protected.Algorithm, certs[0], []byte(env.Protected+"."+env.Payload), sig,
+	); err != nil {
+		return err
+	}
+
+	payloadJSON, err := base64.RawURLEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to decode payload: %w", err)
+	}
+	var payload signaturePayload
+	if err := json.Unmarshal(payloadJSON, &payload); err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+	if payload.TargetArtifact.Digest != subject {
+		return fmt.Errorf(
+			"signature is for %s, not %s", payload.TargetArtifact.Digest, subject,
+		)
+	}
+
+	// Verify authenticity against the trust stores.
+	var (
+		storeType   string
+		signingTime *time.Time
+	)
+	switch protected.SigningScheme {
+	case signingSchemeX509:
+		storeType, signingTime = caTrustStore, protected.SigningTime
+	case signingSchemeX509SigningAuthority:
+		storeType, signingTime = signingAuthorityTrustStore, protected.AuthenticSigningTime
+	default:
+		return fmt.Errorf("unsupported signing scheme %q", protected.SigningScheme)
+	}
+	if signingTime == nil {
+		return errors.New("signature does not specify the signing time")
+	}
+	roots, err := loadTrustStores(v.trustStoreDir, storeType, policy.TrustStores)
+	if err != nil {
+		return err
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	verifyTime := v.now()
+	if protected.SigningScheme == signingSchemeX509SigningAuthority {
+		verifyTime = *signingTime
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   verifyTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return fmt.Errorf("signing certificate is not trusted: %w", err)
+	}
+
+	if !trustedIdentity(certs[0], policy.TrustedIdentities) {
+		return fmt.Errorf("signing identity %q is not trusted", certs[0].Subject)
+	}
+
+	// Expired signatures are only rejected at the strict level, as Notation only logs them at the
+	// permissive level.
+	if protected.Expiry != nil && v.now().After(*protected.Expiry) &&
+		policy.SignatureVerification.Level == Strict {
+		return fmt.Errorf("signature expired at %s", protected.Expiry)
+	}
+
+	return nil
+}
+
+// verifyJWS verifies a JWS signature using one of the algorithms supported by Notation.
+func verifyJWS(alg string, cert *x509.Certificate, signingInput, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "PS256", "ES256":
+		hash = crypto.SHA256
+	case "PS384", "ES384":
+		hash = crypto.SHA384
+	case "PS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signingInput)
+	digest := h.Sum(nil)
+
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "PS") {
+			return fmt.Errorf("signature algorithm %q does not match RSA signing key", alg)
+		}
+		if err := rsa.VerifyPSS(key, hash, digest, sig, &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+		}); err != nil {
+			return errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return fmt.Errorf("signature algorithm %q does not match ECDSA signing key", alg)
+		}
+		if len(sig)%2 != 0 {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(sig[:len(sig)/2])
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported signing key type %T", cert.PublicKey)
+	}
+	return nil
+}
+
+const x509SubjectIdentityPrefix = "x509.subject:"
+
+// parseTrustedIdentity parses a trusted identity in the format
+// "x509.subject: C=US, ST=WA, O=example.com", returning the distinguished name attributes.
+func parseTrustedIdentity(identity string) (map[string]string, error) {
+	dn, ok := strings.CutPrefix(identity, x509SubjectIdentityPrefix)
+	if !ok {
+		return nil, fmt.Errorf(
+			"invalid trusted identity %q: must be %q or start with %q",
+			identity, wildcardScope, x509SubjectIdentityPrefix,
+		)
+	}
+
+	attrs := map[string]string{}
+	for _, rdn := range strings.Split(dn, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(rdn), "=")
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("invalid trusted identity %q: invalid attribute %q", identity, rdn)
+		}
+		attrs[strings.ToUpper(k)] = v
+	}
+	return attrs, nil
+}
+
+// trustedIdentity returns true if the subject of the certificate matches one of the trusted
+// identities, i.e. it contains all attributes of the trusted identity.
+func trustedIdentity(cert *x509.Certificate, identities []string) bool {
+	if slices.Contains(identities, wildcardScope) {
+		return true
+	}
+
+	subject := map[string][]string{
+		"C":            cert.Subject.Country,
+		"ST":           cert.Subject.Province,
+		"L":            cert.Subject.Locality,
+		"O":            cert.Subject.Organization,
+		"OU":           cert.Subject.OrganizationalUnit,
+		"CN":           {cert.Subject.CommonName},
+		"SERIALNUMBER": {cert.Subject.SerialNumber},
+	}
+	for _, identity := range identities {
+		attrs, err := parseTrustedIdentity(identity)
+		if err != nil {
+			continue
+		}
+		matches := true
+		for k, v := range attrs {
+			if !slices.Contains(subject[k], v) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
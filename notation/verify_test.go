@@ -0,0 +1,336 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package notation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mesosphere/mindthegap/warnings"
+)
+
+type testSigner struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+	ca   *x509.Certificate
+}
+
+func newTestSigner(t *testing.T, org string) testSigner {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA", Organization: []string{org}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	certDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject: pkix.Name{
+			CommonName:   "Test Signer",
+			Country:      []string{"US"},
+			Province:     []string{"WA"},
+			Organization: []string{org},
+		},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(certDER)
+	require.NoError(t, err)
+
+	return testSigner{key: key, cert: cert, ca: ca}
+}
+
+// writeTrustStore writes the CA certificate to a ca trust store with the specified name.
+func (s testSigner) writeTrustStore(t *testing.T, dir, storeName string) {
+	t.Helper()
+
+	storeDir := filepath.Join(dir, "x509", "ca", storeName)
+	require.NoError(t, os.MkdirAll(storeDir, 0o755))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(storeDir, "ca.pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.ca.Raw}),
+		0o644,
+	))
+}
+
+// envelope creates a JWS signature envelope for the target in the same format as Notation.
+func (s testSigner) envelope(t *testing.T, target v1.Descriptor) []byte {
+	t.Helper()
+
+	protected, err := json.Marshal(map[string]any{
+		"alg":                          "ES256",
+		"cty":                          payloadContentType,
+		"crit":                         []string{headerSigningScheme},
+		"io.cncf.notary.signingScheme": signingSchemeX509,
+		"io.cncf.notary.signingTime":   time.Now().Format(time.RFC3339),
+	})
+	require.NoError(t, err)
+	payload, err := json.Marshal(signaturePayload{TargetArtifact: target})
+	require.NoError(t, err)
+
+	protectedB64 := base64.RawURLEncoding.EncodeToString(protected)
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(protectedB64 + "." + payloadB64))
+	r, sVal, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	require.NoError(t, err)
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	sVal.FillBytes(sig[32:])
+
+	b, err := json.Marshal(map[string]any{
+		"payload":   payloadB64,
+		"protected": protectedB64,
+		"header":    map[string]any{"x5c": [][]byte{s.cert.Raw}},
+		"signature": base64.RawURLEncoding.EncodeToString(sig),
+	})
+	require.NoError(t, err)
+	return b
+}
+
+// sign attaches a Notation signature of the subject to the repository.
+func (s testSigner) sign(t *testing.T, repo name.Repository, subject v1.Descriptor) {
+	t.Helper()
+	pushSignature(t, repo, subject, s.envelope(t, subject))
+}
+
+func pushSignature(t *testing.T, repo name.Repository, subject v1.Descriptor, envelope []byte) {
+	t.Helper()
+
+	sig, err := mutate.Append(
+		mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), ArtifactType),
+		mutate.Addendum{Layer: static.NewLayer(envelope, jwsEnvelopeMediaType)},
+	)
+	require.NoError(t, err)
+	sigWithSubject := mutate.Subject(sig, subject).(v1.Image)
+	digest, err := sigWithSubject.Digest()
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(repo.Digest(digest.String()), sigWithSubject))
+}
+
+func newTestRepository(t *testing.T) name.Repository {
+	t.Helper()
+
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(srv.Close)
+	repo, err := name.NewRepository(strings.TrimPrefix(srv.URL, "http://") + "/library/nginx")
+	require.NoError(t, err)
+	return repo
+}
+
+// pushTestIndex pushes an image index with a single image to the repository.
+func pushTestIndex(t *testing.T, repo name.Repository) (v1.ImageIndex, v1.Descriptor) {
+	t.Helper()
+
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img})
+	require.NoError(t, remote.WriteIndex(repo.Tag("1.21.5"), idx))
+	desc, err := remote.Head(repo.Tag("1.21.5"))
+	require.NoError(t, err)
+	return idx, *desc
+}
+
+func testPolicy(level VerificationLevel, identities ...string) *TrustPolicyDocument {
+	return &TrustPolicyDocument{
+		Version: "1.0",
+		TrustPolicies: []TrustPolicy{{
+			Name:                  "test",
+			RegistryScopes:        []string{"*"},
+			SignatureVerification: SignatureVerification{Level: level},
+			TrustStores:           []string{"ca:test"},
+			TrustedIdentities:     identities,
+		}},
+	}
+}
+
+func TestVerifyImage(t *testing.T) {
+	t.Parallel()
+
+	signer := newTestSigner(t, "example.com")
+	trustStoreDir := t.TempDir()
+	signer.writeTrustStore(t, trustStoreDir, "test")
+
+	repo := newTestRepository(t)
+	idx, desc := pushTestIndex(t, repo)
+	signer.sign(t, repo, desc)
+
+	tests := []struct {
+		name       string
+		identities []string
+		wantErr    string
+	}{{
+		name:       "wildcard identity",
+		identities: []string{"*"},
+	}, {
+		name:       "matching identity",
+		identities: []string{"x509.subject: C=US, ST=WA, O=example.com"},
+	}, {
+		name:       "untrusted identity",
+		identities: []string{"x509.subject: C=US, ST=WA, O=other.com"},
+		wantErr:    "is not trusted",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			v := NewVerifier(testPolicy(Strict, tt.identities...), trustStoreDir)
+			err := v.VerifyImage(repo.Digest(desc.Digest.String()), "docker.io/library/nginx", idx, nil)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrVerificationFailed)
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestVerifyImageUntrustedSigner(t *testing.T) {
+	t.Parallel()
+
+	trustedSigner := newTestSigner(t, "example.com")
+	trustStoreDir := t.TempDir()
+	trustedSigner.writeTrustStore(t, trustStoreDir, "test")
+
+	repo := newTestRepository(t)
+	idx, desc := pushTestIndex(t, repo)
+	newTestSigner(t, "example.com").sign(t, repo, desc)
+
+	v := NewVerifier(testPolicy(Strict, "*"), trustStoreDir)
+	err := v.VerifyImage(repo.Digest(desc.Digest.String()), "docker.io/library/nginx", idx, nil)
+	require.ErrorIs(t, err, ErrVerificationFailed)
+	require.ErrorContains(t, err, "signing certificate is not trusted")
+}
+
+func TestVerifyImageTamperedSignature(t *testing.T) {
+	t.Parallel()
+
+	signer := newTestSigner(t, "example.com")
+	trustStoreDir := t.TempDir()
+	signer.writeTrustStore(t, trustStoreDir, "test")
+
+	repo := newTestRepository(t)
+	idx, desc := pushTestIndex(t, repo)
+
+	var env map[string]any
+	require.NoError(t, json.Unmarshal(signer.envelope(t, desc), &env))
+	otherDesc := desc
+	otherDesc.Size++
+	payload, err := json.Marshal(signaturePayload{TargetArtifact: otherDesc})
+	require.NoError(t, err)
+	env["payload"] = base64.RawURLEncoding.EncodeToString(payload)
+	tampered, err := json.Marshal(env)
+	require.NoError(t, err)
+	pushSignature(t, repo, desc, tampered)
+
+	v := NewVerifier(testPolicy(Strict, "*"), trustStoreDir)
+	err = v.VerifyImage(repo.Digest(desc.Digest.String()), "docker.io/library/nginx", idx, nil)
+	require.ErrorIs(t, err, ErrVerificationFailed)
+	require.ErrorContains(t, err, "invalid signature")
+}
+
+func TestVerifyImageSignedManifests(t *testing.T) {
+	t.Parallel()
+
+	signer := newTestSigner(t, "example.com")
+	trustStoreDir := t.TempDir()
+	signer.writeTrustStore(t, trustStoreDir, "test")
+
+	repo := newTestRepository(t)
+	idx, desc := pushTestIndex(t, repo)
+	im, err := idx.IndexManifest()
+	require.NoError(t, err)
+	for _, m := range im.Manifests {
+		signer.sign(t, repo, m)
+	}
+
+	// The index itself is not signed, so every manifest in it must be.
+	v := NewVerifier(testPolicy(Strict, "*"), trustStoreDir)
+	require.NoError(
+		t,
+		v.VerifyImage(repo.Digest(desc.Digest.String()), "docker.io/library/nginx", idx, nil),
+	)
+}
+
+func TestVerifyImageNoSignatures(t *testing.T) {
+	t.Parallel()
+
+	trustStoreDir := t.TempDir()
+	newTestSigner(t, "example.com").writeTrustStore(t, trustStoreDir, "test")
+
+	repo := newTestRepository(t)
+	idx, desc := pushTestIndex(t, repo)
+	signed := repo.Digest(desc.Digest.String())
+
+	v := NewVerifier(testPolicy(Strict, "*"), trustStoreDir)
+	require.ErrorIs(t, v.VerifyImage(signed, "docker.io/library/nginx", idx, nil), ErrNoSignatures)
+
+	w := warnings.NewCollector(false)
+	v = NewVerifier(testPolicy(Audit, "*"), trustStoreDir)
+	require.NoError(t, v.VerifyImage(signed, "docker.io/library/nginx", idx, w))
+	require.Len(t, w.Warnings(), 1)
+	assert.Equal(t, warnings.SignatureVerification, w.Warnings()[0].Kind)
+
+	v = NewVerifier(testPolicy(Skip), trustStoreDir)
+	require.NoError(t, v.VerifyImage(signed, "docker.io/library/nginx", idx, nil))
+}
+
+func TestVerifyJWSRejectsMismatchedAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	signer := newTestSigner(t, "example.com")
+	h := crypto.SHA256.New()
+	h.Write([]byte("input"))
+	require.ErrorContains(
+		t,
+		verifyJWS("PS256", signer.cert, []byte("input"), h.Sum(nil)),
+		"does not match ECDSA signing key",
+	)
+}
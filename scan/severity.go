@@ -0,0 +1,51 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package scan scans images for vulnerabilities before they are bundled.
+package scan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity is the severity of a vulnerability, ordered from least to most severe.
+type Severity int
+
+const (
+	SeverityUnknown Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+func (s Severity) String() string {
+	if s < SeverityUnknown || int(s) >= len(severityNames) {
+		return severityNames[SeverityUnknown]
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity parses a severity case-insensitively, e.g. high or CRITICAL.
+func ParseSeverity(s string) (Severity, error) {
+	for i, name := range severityNames {
+		if strings.EqualFold(s, name) {
+			return Severity(i), nil
+		}
+	}
+	return SeverityUnknown, fmt.Errorf(
+		"invalid severity %q: must be one of %s", s, strings.Join(severityNames, ", "),
+	)
+}
+
+// AtOrAbove returns all severities at or above s, e.g. HIGH and CRITICAL for HIGH.
+func (s Severity) AtOrAbove() []Severity {
+	var severities []Severity
+	for sev := s; int(sev) < len(severityNames); sev++ {
+		severities = append(severities, sev)
+	}
+	return severities
+}
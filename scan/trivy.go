@@ -0,0 +1,145 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mesosphere/mindthegap/config"
+	"github.com/mesosphere/mindthegap/logging"
+)
+
+// maxTrivyOutput limits how much of the output of failed scans is included in errors.
+const maxTrivyOutput = 4096
+
+// Vulnerability is a vulnerability found in a package of an image.
+type Vulnerability struct {
+	ID               string
+	Package          string
+	InstalledVersion string
+	FixedVersion     string
+	Severity         Severity
+}
+
+// Credentials authenticate with the registry of scanned images, in addition to the credentials
+// configured for the scanner itself, e.g. in the Docker config file.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Trivy scans images with the trivy binary, which pulls the images from their registry itself.
+type Trivy struct {
+	// Binary is the path of the trivy binary.
+	Binary string
+}
+
+// NewTrivy returns a scanner running the trivy binary from the PATH.
+func NewTrivy() (*Trivy, error) {
+	binary, err := exec.LookPath("trivy")
+	if err != nil {
+		return nil, fmt.Errorf("trivy is required to scan images: %w", err)
+	}
+	return &Trivy{Binary: binary}, nil
+}
+
+type trivyReport struct {
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID  string
+			PkgName          string
+			InstalledVersion string
+			FixedVersion     string
+			Severity         string
+		}
+	}
+}
+
+// Scan returns the vulnerabilities of the image at or above the threshold severity. insecure allows
+// pulling the image from registries with invalid TLS certificates or over HTTP. proxy is the proxy
+// of the registry as configured in the images config, see config.RegistrySyncConfig, overriding the
+// proxies configured by the environment if not empty.
+func (t *Trivy) Scan(
+	ctx context.Context,
+	image string,
+	threshold Severity,
+	insecure bool,
+	creds *Credentials,
+	proxy string,
+) ([]Vulnerability, error) {
+	severities := make([]string, 0, len(severityNames))
+	for _, s := range threshold.AtOrAbove() {
+		severities = append(severities, s.String())
+	}
+	args := []string{
+		"image",
+		"--quiet",
+		"--format", "json",
+		"--scanners", "vuln",
+		"--severity", strings.Join(severities, ","),
+	}
+	if insecure {
+		args = append(args, "--insecure")
+	}
+	args = append(args, image)
+
+	//nolint:gosec // The trivy binary is looked up from the PATH or explicitly configured.
+	cmd := exec.CommandContext(ctx, t.Binary, args...)
+	cmd.Env = os.Environ()
+	if creds != nil {
+		cmd.Env = append(cmd.Env, "TRIVY_USERNAME="+creds.Username, "TRIVY_PASSWORD="+creds.Password)
+	}
+	switch proxy {
+	case "":
+	case config.DirectProxy:
+		cmd.Env = append(cmd.Env, "NO_PROXY=*")
+	default:
+		cmd.Env = append(cmd.Env, "HTTP_PROXY="+proxy, "HTTPS_PROXY="+proxy)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	stderrLog := logging.SubprocessOutput("trivy", &stderr)
+	cmd.Stderr = stderrLog
+	err := cmd.Run()
+	_ = stderrLog.Close()
+	if err != nil {
+		reason := strings.TrimSpace(string(stderr.Bytes()[:min(stderr.Len(), maxTrivyOutput)]))
+		if reason == "" {
+			return nil, fmt.Errorf("failed to scan image %s: %w", image, err)
+		}
+		return nil, fmt.Errorf("failed to scan image %s: %w: %s", image, err, reason)
+	}
+
+	var report trivyReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		return nil, fmt.Errorf("failed to parse trivy report for image %s: %w", image, err)
+	}
+
+	var vulns []Vulnerability
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			severity, err := ParseSeverity(v.Severity)
+			if err != nil {
+				severity = SeverityUnknown
+			}
+			if severity < threshold {
+				continue
+			}
+			vulns = append(vulns, Vulnerability{
+				ID:               v.VulnerabilityID,
+				Package:          v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				FixedVersion:     v.FixedVersion,
+				Severity:         severity,
+			})
+		}
+	}
+	return vulns, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package scan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTrivy writes a script that records its arguments and environment to argsFile and prints
+// output, exiting with exitCode.
+func fakeTrivy(t *testing.T, output string, exitCode int) (binary, argsFile string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	argsFile = filepath.Join(dir, "args")
+	outputFile := filepath.Join(dir, "output")
+	require.NoError(t, os.WriteFile(outputFile, []byte(output), 0o600))
+	binary = filepath.Join(dir, "trivy")
+	require.NoError(t, os.WriteFile(binary, []byte(`#!/bin/sh
+echo "$@" "user=${TRIVY_USERNAME}" "proxy=${HTTPS_PROXY}" > `+argsFile+`
+cat `+outputFile+`
+echo "scan failed" >&2
+exit `+strconv.Itoa(exitCode)+`
+`), 0o700))
+	return binary, argsFile
+}
+
+func TestTrivyScan(t *testing.T) {
+	t.Parallel()
+
+	binary, argsFile := fakeTrivy(t, `{
+  "SchemaVersion": 2,
+  "Results": [{
+    "Target": "nginx (debian 11.2)",
+    "Vulnerabilities": [{
+      "VulnerabilityID": "CVE-2022-0001",
+      "PkgName": "openssl",
+      "InstalledVersion": "1.1.1k",
+      "FixedVersion": "1.1.1n",
+      "Severity": "CRITICAL"
+    }, {
+      "VulnerabilityID": "CVE-2022-0002",
+      "PkgName": "zlib",
+      "InstalledVersion": "1.2.11",
+      "Severity": "MEDIUM"
+    }]
+  }, {
+    "Target": "usr/bin/app"
+  }]
+}`, 0)
+
+	vulns, err := (&Trivy{Binary: binary}).Scan(
+		context.Background(), "registry.example.com/nginx@sha256:abc", SeverityHigh, true,
+		&Credentials{Username: "user", Password: "pass"}, "http://proxy.example.com:3128",
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []Vulnerability{{
+		ID:               "CVE-2022-0001",
+		Package:          "openssl",
+		InstalledVersion: "1.1.1k",
+		FixedVersion:     "1.1.1n",
+		Severity:         SeverityCritical,
+	}}, vulns)
+
+	args, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		"image --quiet --format json --scanners vuln --severity HIGH,CRITICAL --insecure "+
+			"registry.example.com/nginx@sha256:abc user=user proxy=http://proxy.example.com:3128\n",
+		string(args),
+	)
+}
+
+func TestTrivyScanFailure(t *testing.T) {
+	t.Parallel()
+
+	binary, _ := fakeTrivy(t, "", 1)
+	_, err := (&Trivy{Binary: binary}).Scan(
+		context.Background(), "registry.example.com/nginx:1.21", SeverityLow, false, nil, "",
+	)
+	require.ErrorContains(t, err, "failed to scan image registry.example.com/nginx:1.21: exit status 1: scan failed")
+}
+
+func TestParseSeverity(t *testing.T) {
+	t.Parallel()
+
+	s, err := ParseSeverity("high")
+	require.NoError(t, err)
+	assert.Equal(t, SeverityHigh, s)
+	assert.Equal(t, []Severity{SeverityHigh, SeverityCritical}, s.AtOrAbove())
+
+	_, err = ParseSeverity("severe")
+	require.ErrorContains(t, err, `invalid severity "severe": must be one of UNKNOWN, LOW, MEDIUM, HIGH, CRITICAL`)
+}
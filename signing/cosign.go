@@ -0,0 +1,138 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package signing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mesosphere/mindthegap/logging"
+)
+
+const (
+	// Keyless signs with a short-lived certificate issued for the OIDC identity of the signer
+	// instead of a private key.
+	Keyless = "keyless"
+
+	// maxCosignOutput limits how much of the output of failed cosign runs is included in errors.
+	maxCosignOutput = 4096
+)
+
+// SignatureFile returns the file the detached signature of file is written to, as a Sigstore bundle
+// containing the signature and, for keyless signatures, the signing certificate.
+func SignatureFile(file string) string {
+	return file + ".sigstore.json"
+}
+
+// VerifyOptions configure how detached signatures are verified, either with the public key of the
+// signer or with the identity of keyless signatures.
+type VerifyOptions struct {
+	Key                   string
+	CertificateIdentity   string
+	CertificateOIDCIssuer string
+}
+
+// IsEmpty returns true if signatures should not be verified.
+func (o VerifyOptions) IsEmpty() bool {
+	return o.Key == "" && o.CertificateIdentity == "" && o.CertificateOIDCIssuer == ""
+}
+
+// Validate checks that either a key or the identity and OIDC issuer of keyless signatures are set.
+func (o VerifyOptions) Validate() error {
+	if o.IsEmpty() {
+		return nil
+	}
+	if o.Key != "" {
+		if o.CertificateIdentity != "" || o.CertificateOIDCIssuer != "" {
+			return errors.New("--verify-key cannot be combined with --certificate-identity or --certificate-oidc-issuer")
+		}
+		return nil
+	}
+	if o.CertificateIdentity == "" || o.CertificateOIDCIssuer == "" {
+		return errors.New("--certificate-identity and --certificate-oidc-issuer must be specified together")
+	}
+	return nil
+}
+
+// Cosign signs and verifies files with the cosign binary.
+type Cosign struct {
+	// Binary is the path of the cosign binary.
+	Binary string
+}
+
+// NewCosign returns a signer running the cosign binary from the PATH.
+func NewCosign() (*Cosign, error) {
+	binary, err := exec.LookPath("cosign")
+	if err != nil {
+		return nil, fmt.Errorf("cosign is required to sign and verify bundles: %w", err)
+	}
+	return &Cosign{Binary: binary}, nil
+}
+
+// SignBlob writes a detached signature of file to SignatureFile(file), signing with the private key
+// or keylessly if key is Keyless. The password of the private key is read from COSIGN_PASSWORD.
+func (c *Cosign) SignBlob(ctx context.Context, file, key string) error {
+	args := []string{"sign-blob", "--yes", "--bundle", SignatureFile(file)}
+	if key != Keyless {
+		args = append(args, "--key", key)
+	}
+	args = append(args, file)
+
+	if err := c.run(ctx, args...); err != nil {
+		return fmt.Errorf("failed to sign %s: %w", file, err)
+	}
+	return nil
+}
+
+// VerifyBlob verifies the detached signature of file, failing if file is not signed or has been
+// modified since it was signed. Verification works offline, so that it can be performed in
+// air-gapped environments.
+func (c *Cosign) VerifyBlob(ctx context.Context, file string, opts VerifyOptions) error {
+	signatureFile := SignatureFile(file)
+	if _, err := os.Stat(signatureFile); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%s is not signed: signature %s not found", file, signatureFile)
+		}
+		return fmt.Errorf("failed to read signature of %s: %w", file, err)
+	}
+
+	args := []string{"verify-blob", "--offline", "--bundle", signatureFile}
+	if opts.Key != "" {
+		args = append(args, "--key", opts.Key)
+	} else {
+		args = append(args,
+			"--certificate-identity", opts.CertificateIdentity,
+			"--certificate-oidc-issuer", opts.CertificateOIDCIssuer,
+		)
+	}
+	args = append(args, file)
+
+	if err := c.run(ctx, args...); err != nil {
+		return fmt.Errorf("failed to verify signature of %s: %w", file, err)
+	}
+	return nil
+}
+
+func (c *Cosign) run(ctx context.Context, args ...string) error {
+	//nolint:gosec // The cosign binary is looked up from the PATH or explicitly configured.
+	cmd := exec.CommandContext(ctx, c.Binary, args...)
+	var stderr bytes.Buffer
+	stderrLog := logging.SubprocessOutput("cosign", &stderr)
+	cmd.Stderr = stderrLog
+	err := cmd.Run()
+	_ = stderrLog.Close()
+	if err != nil {
+		reason := strings.TrimSpace(string(stderr.Bytes()[:min(stderr.Len(), maxCosignOutput)]))
+		if reason == "" {
+			return err
+		}
+		return fmt.Errorf("%w: %s", err, reason)
+	}
+	return nil
+}
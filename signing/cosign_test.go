@@ -0,0 +1,130 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package signing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCosign writes a script that records its arguments to argsFile and exits with exitCode.
+func fakeCosign(t *testing.T, exitCode int) (binary, argsFile string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	argsFile = filepath.Join(dir, "args")
+	binary = filepath.Join(dir, "cosign")
+	require.NoError(t, os.WriteFile(binary, []byte(`#!/bin/sh
+echo "$@" > `+argsFile+`
+echo "invalid signature" >&2
+exit `+strconv.Itoa(exitCode)+`
+`), 0o700))
+	return binary, argsFile
+}
+
+func TestCosignSignBlob(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		key      string
+		wantArgs string
+	}{{
+		name:     "key",
+		key:      "cosign.key",
+		wantArgs: "sign-blob --yes --bundle bundle.tar.sigstore.json --key cosign.key bundle.tar",
+	}, {
+		name:     "keyless",
+		key:      Keyless,
+		wantArgs: "sign-blob --yes --bundle bundle.tar.sigstore.json bundle.tar",
+	}}
+	for ti := range tests {
+		tt := tests[ti]
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			binary, argsFile := fakeCosign(t, 0)
+			require.NoError(t, (&Cosign{Binary: binary}).SignBlob(context.Background(), "bundle.tar", tt.key))
+			args, err := os.ReadFile(argsFile)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantArgs, strings.TrimSpace(string(args)))
+		})
+	}
+}
+
+func TestCosignVerifyBlob(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	signedFile := filepath.Join(dir, "signed.tar")
+	require.NoError(t, os.WriteFile(SignatureFile(signedFile), []byte("{}"), 0o600))
+	unsignedFile := filepath.Join(dir, "unsigned.tar")
+
+	tests := []struct {
+		name     string
+		file     string
+		opts     VerifyOptions
+		exitCode int
+		wantArgs string
+		wantErr  string
+	}{{
+		name:     "key",
+		file:     signedFile,
+		opts:     VerifyOptions{Key: "cosign.pub"},
+		wantArgs: "verify-blob --offline --bundle " + signedFile + ".sigstore.json --key cosign.pub " + signedFile,
+	}, {
+		name: "keyless",
+		file: signedFile,
+		opts: VerifyOptions{CertificateIdentity: "me@example.com", CertificateOIDCIssuer: "https://issuer"},
+		wantArgs: "verify-blob --offline --bundle " + signedFile + ".sigstore.json " +
+			"--certificate-identity me@example.com --certificate-oidc-issuer https://issuer " + signedFile,
+	}, {
+		name:    "unsigned",
+		file:    unsignedFile,
+		opts:    VerifyOptions{Key: "cosign.pub"},
+		wantErr: unsignedFile + " is not signed: signature " + unsignedFile + ".sigstore.json not found",
+	}, {
+		name:     "tampered",
+		file:     signedFile,
+		opts:     VerifyOptions{Key: "cosign.pub"},
+		exitCode: 1,
+		wantErr:  "failed to verify signature of " + signedFile + ": exit status 1: invalid signature",
+	}}
+	for ti := range tests {
+		tt := tests[ti]
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			binary, argsFile := fakeCosign(t, tt.exitCode)
+			err := (&Cosign{Binary: binary}).VerifyBlob(context.Background(), tt.file, tt.opts)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			args, err := os.ReadFile(argsFile)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantArgs, strings.TrimSpace(string(args)))
+		})
+	}
+}
+
+func TestVerifyOptionsValidate(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, VerifyOptions{}.Validate())
+	require.NoError(t, VerifyOptions{Key: "cosign.pub"}.Validate())
+	require.NoError(t, VerifyOptions{CertificateIdentity: "me", CertificateOIDCIssuer: "https://issuer"}.Validate())
+	require.EqualError(t, VerifyOptions{CertificateIdentity: "me"}.Validate(),
+		"--certificate-identity and --certificate-oidc-issuer must be specified together")
+	require.EqualError(t, VerifyOptions{Key: "cosign.pub", CertificateIdentity: "me"}.Validate(),
+		"--verify-key cannot be combined with --certificate-identity or --certificate-oidc-issuer")
+}
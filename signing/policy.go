@@ -0,0 +1,329 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Requirement types of a containers signature verification policy.
+const (
+	InsecureAcceptAnything = "insecureAcceptAnything"
+	Reject                 = "reject"
+	SignedBy               = "signedBy"
+	SigstoreSigned         = "sigstoreSigned"
+)
+
+// Signed identity types of sigstoreSigned requirements.
+const (
+	MatchExact             = "matchExact"
+	MatchRepoDigestOrExact = "matchRepoDigestOrExact"
+	MatchRepository        = "matchRepository"
+	ExactReference         = "exactReference"
+	ExactRepository        = "exactRepository"
+	RemapIdentity          = "remapIdentity"
+)
+
+// dockerTransport is the only transport of a policy that applies to images pulled from registries.
+const dockerTransport = "docker"
+
+// ErrRejected is returned when the policy rejects an image.
+var ErrRejected = errors.New("rejected by signature policy")
+
+// Policy is a containers signature verification policy (policy.json), see
+// https://github.com/containers/image/blob/main/docs/containers-policy.json.5.md. Only the scopes of
+// the docker transport are used. Requirements of the insecureAcceptAnything and reject types and
+// sigstoreSigned requirements with public keys are supported, signedBy (GPG) requirements and
+// sigstoreSigned requirements with Fulcio certificates or Rekor are not.
+type Policy struct {
+	Default    []PolicyRequirement                       `json:"default"`
+	Transports map[string]map[string][]PolicyRequirement `json:"transports,omitempty"`
+}
+
+type PolicyRequirement struct {
+	Type               string          `json:"type"`
+	KeyPath            string          `json:"keyPath,omitempty"`
+	KeyPaths           []string        `json:"keyPaths,omitempty"`
+	KeyData            []byte          `json:"keyData,omitempty"`
+	KeyDatas           [][]byte        `json:"keyDatas,omitempty"`
+	Fulcio             json.RawMessage `json:"fulcio,omitempty"`
+	RekorPublicKeyPath string          `json:"rekorPublicKeyPath,omitempty"`
+	RekorPublicKeyData []byte          `json:"rekorPublicKeyData,omitempty"`
+	SignedIdentity     *SignedIdentity `json:"signedIdentity,omitempty"`
+
+	// keys are the public keys loaded from KeyPath, KeyPaths, KeyData or KeyDatas.
+	keys []crypto.PublicKey
+}
+
+type SignedIdentity struct {
+	Type             string `json:"type"`
+	DockerReference  string `json:"dockerReference,omitempty"`
+	DockerRepository string `json:"dockerRepository,omitempty"`
+}
+
+// ParsePolicyFile parses and validates a containers signature verification policy, loading the
+// public keys of its sigstoreSigned requirements.
+func ParsePolicyFile(file string) (*Policy, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature policy: %w", err)
+	}
+
+	var p Policy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse signature policy %s: %w", file, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid signature policy %s: %w", file, err)
+	}
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	if len(p.Default) == 0 {
+		return errors.New("no default requirements defined")
+	}
+	if err := validateRequirements(p.Default); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for scope, reqs := range p.Transports[dockerTransport] {
+		if len(reqs) == 0 {
+			return fmt.Errorf("scope %q of transport %q has no requirements", scope, dockerTransport)
+		}
+		if err := validateRequirements(reqs); err != nil {
+			return fmt.Errorf("scope %q of transport %q: %w", scope, dockerTransport, err)
+		}
+	}
+	return nil
+}
+
+func validateRequirements(reqs []PolicyRequirement) error {
+	for i := range reqs {
+		r := &reqs[i]
+		switch r.Type {
+		case InsecureAcceptAnything, Reject:
+		case SignedBy:
+			return errors.New("signedBy requirements (GPG signatures) are not supported")
+		case SigstoreSigned:
+			if err := r.loadSigstoreSigned(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported requirement type %q", r.Type)
+		}
+	}
+	return nil
+}
+
+func (r *PolicyRequirement) loadSigstoreSigned() error {
+	if len(r.Fulcio) > 0 || r.RekorPublicKeyPath != "" || len(r.RekorPublicKeyData) > 0 {
+		return errors.New("sigstoreSigned requirements with Fulcio certificates or Rekor are not supported")
+	}
+
+	keyData := r.KeyDatas
+	if len(r.KeyData) > 0 {
+		keyData = append(keyData, r.KeyData)
+	}
+	keyPaths := r.KeyPaths
+	if r.KeyPath != "" {
+		keyPaths = append(keyPaths, r.KeyPath)
+	}
+	sources := 0
+	for _, set := range []bool{r.KeyPath != "", len(r.KeyPaths) > 0, len(r.KeyData) > 0, len(r.KeyDatas) > 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.New(
+			"sigstoreSigned requirements must specify exactly one of keyPath, keyPaths, keyData or keyDatas",
+		)
+	}
+
+	for _, path := range keyPaths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read public key: %w", err)
+		}
+		keyData = append(keyData, b)
+	}
+	for _, b := range keyData {
+		key, err := parsePublicKey(b)
+		if err != nil {
+			return err
+		}
+		r.keys = append(r.keys, key)
+	}
+
+	if r.SignedIdentity == nil {
+		r.SignedIdentity = &SignedIdentity{Type: MatchRepoDigestOrExact}
+	}
+	return r.SignedIdentity.validate()
+}
+
+func (i *SignedIdentity) validate() error {
+	switch i.Type {
+	case MatchExact, MatchRepoDigestOrExact, MatchRepository:
+	case ExactReference:
+		ref, err := name.ParseReference(i.DockerReference)
+		if err != nil {
+			return fmt.Errorf("invalid dockerReference of signed identity: %w", err)
+		}
+		if isRepository(i.DockerReference) {
+			return fmt.Errorf("dockerReference %q of signed identity has no tag or digest", i.DockerReference)
+		}
+		i.DockerReference = ref.Name()
+	case ExactRepository:
+		repo, err := name.NewRepository(i.DockerRepository)
+		if err != nil {
+			return fmt.Errorf("invalid dockerRepository of signed identity: %w", err)
+		}
+		i.DockerRepository = repo.Name()
+	case RemapIdentity:
+		return errors.New("remapIdentity signed identities are not supported")
+	default:
+		return fmt.Errorf("unsupported signed identity type %q", i.Type)
+	}
+	return nil
+}
+
+// parsePublicKey parses a PEM encoded ECDSA, RSA or Ed25519 public key, as generated by cosign.
+func parsePublicKey(b []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("failed to parse public key: no PEM block found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+// verifySignature verifies the signature of payload with any of the public keys of the requirement.
+// Payloads are hashed with SHA-256, like cosign does, except for Ed25519 keys.
+func (r *PolicyRequirement) verifySignature(payload, sig []byte) bool {
+	digest := sha256.Sum256(payload)
+	for _, key := range r.keys {
+		switch key := key.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(key, digest[:], sig) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil {
+				return true
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, payload, sig) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches returns whether the docker reference a signature was created for matches the reference of
+// the image, as configured by the signed identity.
+func (i *SignedIdentity) matches(image name.Reference, signed string) bool {
+	signedRef, err := name.ParseReference(signed)
+	if err != nil {
+		return false
+	}
+	// References without tag or digest only match repositories, even though they are parsed with the
+	// default tag.
+	exact := !isRepository(signed) && signedRef.Name() == image.Name()
+	sameRepository := signedRef.Context().Name() == image.Context().Name()
+
+	switch i.Type {
+	case MatchExact:
+		return exact
+	case MatchRepoDigestOrExact:
+		if _, isDigest := image.(name.Digest); isDigest {
+			return sameRepository
+		}
+		return exact
+	case MatchRepository:
+		return sameRepository
+	case ExactReference:
+		return !isRepository(signed) && signedRef.Name() == i.DockerReference
+	case ExactRepository:
+		return signedRef.Context().Name() == i.DockerRepository
+	default:
+		return false
+	}
+}
+
+// isRepository returns whether the reference has neither a tag nor a digest.
+func isRepository(ref string) bool {
+	_, err := name.NewRepository(ref)
+	return err == nil
+}
+
+// RequirementsFor returns the requirements of the most specific scope of the docker transport that
+// applies to the image, falling back to the default requirements. Scopes are, from most to least
+// specific, the image reference itself, its repository, the namespaces and the host of the
+// repository, wildcard subdomains of the host, e.g. *.example.com, and the empty scope.
+func (p *Policy) RequirementsFor(ref name.Reference) []PolicyRequirement {
+	scopes := p.Transports[dockerTransport]
+	for _, scope := range policyScopes(ref) {
+		if reqs, ok := scopes[scope]; ok {
+			return reqs
+		}
+	}
+	if reqs, ok := scopes[""]; ok {
+		return reqs
+	}
+	return p.Default
+}
+
+// policyScopes returns the scopes that apply to the reference, from most to least specific, with
+// the Docker Hub registry named docker.io like containers/image does.
+func policyScopes(ref name.Reference) []string {
+	host := ref.Context().RegistryStr()
+	if host == name.DefaultRegistry {
+		host = "docker.io"
+	}
+	repository := host + "/" + ref.Context().RepositoryStr()
+
+	var scopes []string
+	switch ref := ref.(type) {
+	case name.Digest:
+		scopes = append(scopes, repository+"@"+ref.DigestStr())
+	case name.Tag:
+		scopes = append(scopes, repository+":"+ref.TagStr())
+	}
+	for ns := repository; strings.Contains(ns, "/"); ns = ns[:strings.LastIndex(ns, "/")] {
+		scopes = append(scopes, ns)
+	}
+	scopes = append(scopes, host)
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for domain := host; strings.Contains(domain, "."); {
+		domain = domain[strings.Index(domain, ".")+1:]
+		scopes = append(scopes, "*."+domain)
+	}
+	return scopes
+}
@@ -0,0 +1,276 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePublicKey generates an ECDSA key pair like cosign generate-key-pair does, writing the public
+// key to a file.
+func writePublicKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "cosign.pub")
+	require.NoError(
+		t,
+		os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600),
+	)
+	return key, file
+}
+
+func writePolicy(t *testing.T, policy string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(file, []byte(policy), 0o600))
+	return file
+}
+
+// sign pushes a sigstore signature of the manifest with the identity, like cosign sign does.
+func sign(t *testing.T, key *ecdsa.PrivateKey, repo name.Repository, manifest v1.Hash, identity string) {
+	t.Helper()
+	signPayload(t, key, repo, manifest, manifest, identity)
+}
+
+// signPayload pushes a sigstore signature of the manifest that signs signedManifest in its payload.
+func signPayload(
+	t *testing.T,
+	key *ecdsa.PrivateKey,
+	repo name.Repository,
+	manifest, signedManifest v1.Hash,
+	identity string,
+) {
+	t.Helper()
+	payload := []byte(fmt.Sprintf(
+		`{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},`+
+			`"type":"cosign container image signature"},"optional":null}`,
+		identity, signedManifest,
+	))
+	digest := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(payload, types.MediaType(sigstoreSignatureMediaType)),
+		Annotations: map[string]string{sigstoreSignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+	})
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(repo.Tag(fmt.Sprintf("sha256-%s.sig", manifest.Hex)), img))
+}
+
+func TestParsePolicyFile(t *testing.T) {
+	t.Parallel()
+
+	_, keyFile := writePublicKey(t)
+
+	tests := []struct {
+		name        string
+		policy      string
+		expectedErr string
+	}{{
+		name:   "valid",
+		policy: `{"default": [{"type": "reject"}], "transports": {"docker": {"": [{"type": "insecureAcceptAnything"}]}}}`,
+	}, {
+		name: "sigstoreSigned with key",
+		policy: fmt.Sprintf(
+			`{"default": [{"type": "sigstoreSigned", "keyPath": %q, "signedIdentity": {"type": "matchRepository"}}]}`,
+			keyFile,
+		),
+	}, {
+		name:        "no default",
+		policy:      `{"default": []}`,
+		expectedErr: "no default requirements defined",
+	}, {
+		name:        "signedBy",
+		policy:      `{"default": [{"type": "signedBy", "keyType": "GPGKeys", "keyPath": "key.gpg"}]}`,
+		expectedErr: "signedBy requirements (GPG signatures) are not supported",
+	}, {
+		name:        "fulcio",
+		policy:      `{"default": [{"type": "sigstoreSigned", "fulcio": {"caPath": "ca.pem"}}]}`,
+		expectedErr: "sigstoreSigned requirements with Fulcio certificates or Rekor are not supported",
+	}, {
+		name:        "sigstoreSigned without key",
+		policy:      `{"default": [{"type": "sigstoreSigned"}]}`,
+		expectedErr: "must specify exactly one of keyPath, keyPaths, keyData or keyDatas",
+	}, {
+		name: "remapIdentity",
+		policy: fmt.Sprintf(
+			`{"default": [{"type": "sigstoreSigned", "keyPath": %q, "signedIdentity": {"type": "remapIdentity"}}]}`,
+			keyFile,
+		),
+		expectedErr: "remapIdentity signed identities are not supported",
+	}, {
+		name:        "empty scope",
+		policy:      `{"default": [{"type": "reject"}], "transports": {"docker": {"quay.io": []}}}`,
+		expectedErr: `scope "quay.io" of transport "docker" has no requirements`,
+	}, {
+		name:        "unknown type",
+		policy:      `{"default": [{"type": "acceptEverything"}]}`,
+		expectedErr: `unsupported requirement type "acceptEverything"`,
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParsePolicyFile(writePolicy(t, tt.policy))
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestPolicyRequirementsFor(t *testing.T) {
+	t.Parallel()
+
+	p, err := ParsePolicyFile(writePolicy(t, `{
+  "default": [{"type": "reject"}],
+  "transports": {
+    "docker": {
+      "docker.io/library/nginx:1.21.5": [{"type": "insecureAcceptAnything"}],
+      "docker.io/library": [{"type": "reject"}, {"type": "insecureAcceptAnything"}],
+      "*.example.com": [{"type": "insecureAcceptAnything"}, {"type": "insecureAcceptAnything"}, {"type": "reject"}],
+      "localhost:5000": [{"type": "reject"}, {"type": "reject"}]
+    }
+  }
+}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		ref      string
+		expected int
+	}{
+		{ref: "nginx:1.21.5", expected: 1},
+		{ref: "nginx:1.22.0", expected: 2},
+		{ref: "registry.example.com/app:v1", expected: 3},
+		{ref: "localhost:5000/app:v1", expected: 2},
+		{ref: "quay.io/app:v1", expected: 1},
+	}
+	for _, tt := range tests {
+		ref, err := name.ParseReference(tt.ref)
+		require.NoError(t, err)
+		assert.Len(t, p.RequirementsFor(ref), tt.expected, tt.ref)
+	}
+}
+
+func TestPolicyVerifyImage(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(registry.New())
+	t.Cleanup(srv.Close)
+	reg := strings.TrimPrefix(srv.URL, "http://")
+
+	key, keyFile := writePublicKey(t)
+	otherKey, _ := writePublicKey(t)
+
+	push := func(repository string) (name.Reference, v1.Hash) {
+		t.Helper()
+		img, err := random.Image(128, 1)
+		require.NoError(t, err)
+		ref, err := name.ParseReference(reg + "/" + repository + ":v1")
+		require.NoError(t, err)
+		require.NoError(t, remote.Write(ref, img))
+		digest, err := img.Digest()
+		require.NoError(t, err)
+		return ref, digest
+	}
+
+	signed, signedDigest := push("library/signed")
+	sign(t, key, signed.Context(), signedDigest, signed.Name())
+	unsigned, unsignedDigest := push("library/unsigned")
+	wrongKey, wrongKeyDigest := push("library/wrong-key")
+	sign(t, otherKey, wrongKey.Context(), wrongKeyDigest, wrongKey.Name())
+	wrongIdentity, wrongIdentityDigest := push("library/wrong-identity")
+	sign(t, key, wrongIdentity.Context(), wrongIdentityDigest, reg+"/library/other:v1")
+	wrongDigest, wrongDigestDigest := push("library/wrong-digest")
+	signPayload(t, key, wrongDigest.Context(), wrongDigestDigest, signedDigest, wrongDigest.Name())
+	rejected, err := name.ParseReference(reg + "/library/rejected:v1")
+	require.NoError(t, err)
+
+	p, err := ParsePolicyFile(writePolicy(t, fmt.Sprintf(`{
+  "default": [{"type": "sigstoreSigned", "keyPath": %q}],
+  "transports": {"docker": {%q: [{"type": "reject"}]}}
+}`, keyFile, reg+"/library/rejected")))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		ref         name.Reference
+		digest      v1.Hash
+		expectedErr string
+	}{{
+		name:   "signed",
+		ref:    signed,
+		digest: signedDigest,
+	}, {
+		name:        "unsigned",
+		ref:         unsigned,
+		digest:      unsignedDigest,
+		expectedErr: "no sigstore signatures found",
+	}, {
+		name:        "signed with other key",
+		ref:         wrongKey,
+		digest:      wrongKeyDigest,
+		expectedErr: "signature does not match any of the public keys",
+	}, {
+		name:        "signed for other image",
+		ref:         wrongIdentity,
+		digest:      wrongIdentityDigest,
+		expectedErr: "does not match " + wrongIdentity.Name(),
+	}, {
+		name:        "signature of other manifest",
+		ref:         wrongDigest,
+		digest:      wrongDigestDigest,
+		expectedErr: "signed manifest digest " + signedDigest.String() + " does not match",
+	}, {
+		name:        "rejected",
+		ref:         rejected,
+		digest:      signedDigest,
+		expectedErr: "rejected by signature policy",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := p.VerifyImage(tt.ref, tt.digest)
+			if tt.expectedErr != "" {
+				require.ErrorIs(t, err, ErrRejected)
+				require.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package signing
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+const (
+	sigstoreSignatureMediaType  = "application/vnd.dev.cosign.simplesigning.v1+json"
+	sigstoreSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	sigstoreSignatureType       = "cosign container image signature"
+
+	// maxSigstorePayloadSize limits the size of signature payloads that are read.
+	maxSigstorePayloadSize = 4 << 20
+)
+
+// sigstorePayload is the simple signing payload signed by cosign.
+type sigstorePayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// VerifyImage verifies that the image, whose manifest as referenced by ref has the digest manifest,
+// is accepted by every requirement of the policy applying to ref. Sigstore signatures are read from
+// the sha256-<digest>.sig tag of the repository of ref, where cosign stores them.
+func (p *Policy) VerifyImage(ref name.Reference, manifest v1.Hash, opts ...remote.Option) error {
+	reqs := p.RequirementsFor(ref)
+	for i := range reqs {
+		r := &reqs[i]
+		switch r.Type {
+		case InsecureAcceptAnything:
+		case SigstoreSigned:
+			if err := r.verifySigstoreSigned(ref, manifest, opts...); err != nil {
+				return fmt.Errorf("%s: %w", ref, err)
+			}
+		default:
+			return fmt.Errorf("%s: %w", ref, ErrRejected)
+		}
+	}
+	return nil
+}
+
+// verifySigstoreSigned verifies that at least one sigstore signature of the manifest is valid.
+func (r *PolicyRequirement) verifySigstoreSigned(
+	ref name.Reference,
+	manifest v1.Hash,
+	opts ...remote.Option,
+) error {
+	sigRef := ref.Context().Tag(fmt.Sprintf("%s-%s.sig", manifest.Algorithm, manifest.Hex))
+	sigImage, err := remote.Image(sigRef, opts...)
+	if err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: no sigstore signatures found", ErrRejected)
+		}
+		return fmt.Errorf("failed to read sigstore signatures %s: %w", sigRef, err)
+	}
+	m, err := sigImage.Manifest()
+	if err != nil {
+		return fmt.Errorf("failed to read sigstore signatures %s: %w", sigRef, err)
+	}
+
+	var errs []error
+	for _, desc := range m.Layers {
+		if desc.MediaType != sigstoreSignatureMediaType {
+			continue
+		}
+		err := r.verifySigstoreSignature(ref, manifest, sigImage, desc)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("signature %s: %w", desc.Digest, err))
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("%w: no sigstore signatures found", ErrRejected)
+	}
+	return fmt.Errorf("%w: no valid sigstore signature found: %w", ErrRejected, errors.Join(errs...))
+}
+
+func (r *PolicyRequirement) verifySigstoreSignature(
+	ref name.Reference,
+	manifest v1.Hash,
+	sigImage v1.Image,
+	desc v1.Descriptor,
+) error {
+	sig, err := base64.StdEncoding.DecodeString(desc.Annotations[sigstoreSignatureAnnotation])
+	if err != nil || len(sig) == 0 {
+		return errors.New("missing or invalid signature annotation")
+	}
+	layer, err := sigImage.LayerByDigest(desc.Digest)
+	if err != nil {
+		return fmt.Errorf("failed to read payload: %w", err)
+	}
+	rc, err := layer.Compressed()
+	if err != nil {
+		return fmt.Errorf("failed to read payload: %w", err)
+	}
+	defer rc.Close()
+	payload, err := io.ReadAll(io.LimitReader(rc, maxSigstorePayloadSize))
+	if err != nil {
+		return fmt.Errorf("failed to read payload: %w", err)
+	}
+
+	if !r.verifySignature(payload, sig) {
+		return errors.New("signature does not match any of the public keys")
+	}
+
+	var p sigstorePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+	if p.Critical.Type != sigstoreSignatureType {
+		return fmt.Errorf("unexpected payload type %q", p.Critical.Type)
+	}
+	if p.Critical.Image.DockerManifestDigest != manifest.String() {
+		return fmt.Errorf(
+			"signed manifest digest %s does not match %s", p.Critical.Image.DockerManifestDigest, manifest,
+		)
+	}
+	if !r.SignedIdentity.matches(ref, p.Critical.Identity.DockerReference) {
+		return fmt.Errorf(
+			"signed identity %q does not match %s", p.Critical.Identity.DockerReference, ref,
+		)
+	}
+	return nil
+}
@@ -59,7 +59,7 @@ var _ = Describe("Push Bundle", func() {
 		go func() {
 			defer GinkgoRecover()
 
-			Expect(reg.ListenAndServe()).To(Succeed())
+			Expect(reg.ListenAndServe(context.Background())).To(Succeed())
 
 			close(done)
 		}()
@@ -121,7 +121,7 @@ var _ = Describe("Push Bundle", func() {
 		go func() {
 			defer GinkgoRecover()
 
-			Expect(reg.ListenAndServe()).To(Succeed())
+			Expect(reg.ListenAndServe(context.Background())).To(Succeed())
 
 			close(done)
 		}()
@@ -177,7 +177,7 @@ var _ = Describe("Push Bundle", func() {
 		go func() {
 			defer GinkgoRecover()
 
-			Expect(reg.ListenAndServe()).To(Succeed())
+			Expect(reg.ListenAndServe(context.Background())).To(Succeed())
 
 			close(done)
 		}()
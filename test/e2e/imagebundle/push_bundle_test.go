@@ -87,7 +87,7 @@ var _ = Describe("Push Bundle", func() {
 			go func() {
 				defer GinkgoRecover()
 
-				Expect(reg.ListenAndServe()).To(Succeed())
+				Expect(reg.ListenAndServe(context.Background())).To(Succeed())
 
 				close(done)
 			}()
@@ -122,6 +122,7 @@ var _ = Describe("Push Bundle", func() {
 				net.JoinHostPort(registryHost, strconv.Itoa(port)),
 				registryCACertFile != "",
 				registryCACertFile,
+				0,
 			)
 			Expect(err).NotTo(HaveOccurred())
 
@@ -266,7 +267,7 @@ var _ = Describe("Push Bundle", func() {
 				go func() {
 					defer GinkgoRecover()
 
-					Expect(reg.ListenAndServe()).To(Succeed())
+					Expect(reg.ListenAndServe(context.Background())).To(Succeed())
 
 					close(done)
 				}()
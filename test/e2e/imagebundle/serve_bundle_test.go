@@ -8,10 +8,13 @@ package imagebundle_test
 import (
 	"fmt"
 	"net"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"syscall"
 
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	. "github.com/onsi/ginkgo/v2"
@@ -130,6 +133,7 @@ var _ = Describe("Serve Bundle", func() {
 			net.JoinHostPort(ipAddr.String(), strconv.Itoa(port)),
 			false,
 			caCertFile,
+			0,
 		)
 		Expect(err).NotTo(HaveOccurred())
 
@@ -152,6 +156,65 @@ var _ = Describe("Serve Bundle", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("Load new bundles on SIGHUP", func() {
+		bundlesDir := filepath.Dir(bundleFile)
+		helpers.CreateBundle(
+			GinkgoT(),
+			bundleFile,
+			filepath.Join("testdata", "create-success.yaml"),
+		)
+
+		port, err := freeport.GetFreePort()
+		Expect(err).NotTo(HaveOccurred())
+		cmd.SetArgs([]string{
+			"--image-bundle", filepath.Join(bundlesDir, "*.tar"),
+			"--listen-port", strconv.Itoa(port),
+		})
+
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+
+			Expect(cmd.Execute()).To(Succeed())
+
+			close(done)
+		}()
+
+		helpers.WaitForTCPPort(GinkgoT(), "127.0.0.1", port)
+
+		platforms := []*v1.Platform{{
+			OS:           "linux",
+			Architecture: runtime.GOARCH,
+		}}
+		helpers.ValidateImageIsAvailable(
+			GinkgoT(), "127.0.0.1", port, "", "stefanprodan/podinfo", "6.2.0", platforms,
+		)
+
+		helpers.CreateBundle(
+			GinkgoT(),
+			filepath.Join(bundlesDir, "additional-image-bundle.tar"),
+			filepath.Join("testdata", "create-success-additional.yaml"),
+		)
+		Expect(syscall.Kill(os.Getpid(), syscall.SIGHUP)).To(Succeed())
+
+		ref, err := name.ParseReference(fmt.Sprintf("127.0.0.1:%d/stefanprodan/podinfo:6.3.0", port))
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() error {
+			_, err := remote.Head(ref)
+			return err
+		}).Should(Succeed())
+		helpers.ValidateImageIsAvailable(
+			GinkgoT(), "127.0.0.1", port, "", "stefanprodan/podinfo", "6.3.0", platforms,
+		)
+		helpers.ValidateImageIsAvailable(
+			GinkgoT(), "127.0.0.1", port, "", "stefanprodan/podinfo", "6.2.0", platforms,
+		)
+
+		close(stopCh)
+
+		Eventually(done).Should(BeClosed())
+	})
+
 	It("Bundle does not exist", func() {
 		cmd.SetArgs([]string{
 			"--image-bundle", bundleFile,
@@ -0,0 +1,135 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package warnings
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Kind string
+
+const (
+	// MissingPlatform is reported when an image does not provide one of the requested platforms.
+	MissingPlatform Kind = "missing platform"
+	// DigestNotFound is reported when an image requested by digest will not be available under
+	// that digest, e.g. because unrequested platforms were removed from its manifest list.
+	DigestNotFound Kind = "digest not found"
+	// Normalization is reported when an image reference is changed when normalizing it, e.g.
+	// nginx is normalized to docker.io/library/nginx:latest.
+	Normalization Kind = "normalization change"
+	// SignatureVerification is reported when the signatures of an image fail to be verified with a
+	// trust policy that only audits signatures.
+	SignatureVerification Kind = "signature verification"
+	// PlatformMismatch is reported when a platform of the destination, e.g. the architecture of the
+	// nodes of the destination cluster, is not requested.
+	PlatformMismatch Kind = "platform mismatch"
+	// Deprecated is reported when an image is marked as deprecated by its labels or annotations, e.g.
+	// because it has reached its end of life.
+	Deprecated Kind = "deprecated image"
+	// Vulnerability is reported when scanning an image finds vulnerabilities at or above the
+	// severity threshold and scan findings are only reported as warnings.
+	Vulnerability Kind = "vulnerability"
+)
+
+type Warning struct {
+	Kind    Kind
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Kind, w.Message)
+}
+
+// Error is returned for warnings that have been turned into errors in strict mode.
+type Error struct {
+	Warning Warning
+}
+
+func (e *Error) Error() string {
+	return e.Warning.String()
+}
+
+// Collector collects warnings, or turns them into errors in strict mode. A nil collector ignores
+// all warnings. It is safe for concurrent use.
+type Collector struct {
+	strict bool
+
+	mu       sync.Mutex
+	warnings []Warning
+}
+
+func NewCollector(strict bool) *Collector {
+	return &Collector{strict: strict}
+}
+
+// Warnf records a warning, returning an error if the collector is in strict mode.
+func (c *Collector) Warnf(kind Kind, format string, args ...any) error {
+	if c == nil {
+		return nil
+	}
+
+	w := Warning{Kind: kind, Message: fmt.Sprintf(format, args...)}
+	if c.strict {
+		return &Error{Warning: w}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warnings = append(c.warnings, w)
+
+	return nil
+}
+
+// Warnings returns all recorded warnings, sorted for deterministic output.
+func (c *Collector) Warnings() []Warning {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sorted := append([]Warning{}, c.warnings...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Kind != sorted[j].Kind {
+			return sorted[i].Kind < sorted[j].Kind
+		}
+		return sorted[i].Message < sorted[j].Message
+	})
+	return sorted
+}
+
+// Summary returns a one line summary of the recorded warnings with counts per kind, e.g.
+// "3 warnings (2 missing platform, 1 normalization change)", or an empty string if there are no
+// warnings.
+func (c *Collector) Summary() string {
+	ws := c.Warnings()
+	if len(ws) == 0 {
+		return ""
+	}
+
+	counts := map[Kind]int{}
+	kinds := []Kind{}
+	for _, w := range ws {
+		if counts[w.Kind] == 0 {
+			kinds = append(kinds, w.Kind)
+		}
+		counts[w.Kind]++
+	}
+
+	perKind := make([]string, 0, len(kinds))
+	for _, k := range kinds {
+		perKind = append(perKind, fmt.Sprintf("%d %s", counts[k], k))
+	}
+
+	noun := "warnings"
+	if len(ws) == 1 {
+		noun = "warning"
+	}
+
+	return fmt.Sprintf("%d %s (%s)", len(ws), noun, strings.Join(perKind, ", "))
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 D2iQ, Inc. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package warnings
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	t.Parallel()
+
+	c := NewCollector(false)
+	require.NoError(t, c.Warnf(Normalization, "image %q normalized to %q", "nginx", "docker.io/library/nginx:latest"))
+	require.NoError(t, c.Warnf(MissingPlatform, "image %q does not provide platform %q", "b", "linux/arm64"))
+	require.NoError(t, c.Warnf(MissingPlatform, "image %q does not provide platform %q", "a", "linux/arm64"))
+
+	assert.Equal(t, []Warning{{
+		Kind:    MissingPlatform,
+		Message: `image "a" does not provide platform "linux/arm64"`,
+	}, {
+		Kind:    MissingPlatform,
+		Message: `image "b" does not provide platform "linux/arm64"`,
+	}, {
+		Kind:    Normalization,
+		Message: `image "nginx" normalized to "docker.io/library/nginx:latest"`,
+	}}, c.Warnings())
+	assert.Equal(t, "3 warnings (2 missing platform, 1 normalization change)", c.Summary())
+}
+
+func TestCollectorStrict(t *testing.T) {
+	t.Parallel()
+
+	c := NewCollector(true)
+	err := c.Warnf(DigestNotFound, "digest %s not found", "sha256:abc")
+	var werr *Error
+	require.ErrorAs(t, err, &werr)
+	assert.Equal(t, DigestNotFound, werr.Warning.Kind)
+	assert.EqualError(t, err, "digest not found: digest sha256:abc not found")
+	assert.Empty(t, c.Warnings())
+	assert.Empty(t, c.Summary())
+}
+
+func TestNilCollector(t *testing.T) {
+	t.Parallel()
+
+	var c *Collector
+	require.NoError(t, c.Warnf(Normalization, "ignored"))
+	assert.Empty(t, c.Warnings())
+}